@@ -30,7 +30,12 @@ var (
 	network           string
 	networkArgs       []string
 	dns               string
+	addHosts          []string
+	publishPorts      []string
+	sysctls           []string
 	security          []string
+	seccompRecord     string
+	landlockRules     []string
 	cgroupsTOMLFile   string
 	containLibsPath   []string
 	fuseMount         []string
@@ -273,6 +278,42 @@ var actionDNSFlag = cmdline.Flag{
 	EnvKeys:      []string{"DNS"},
 }
 
+// --publish
+var actionPublishFlag = cmdline.Flag{
+	ID:           "actionPublishFlag",
+	Value:        &publishPorts,
+	DefaultValue: []string{},
+	Name:         "publish",
+	Usage:        "forward a host port to the container (hostPort[:containerPort][/protocol]), requires --net. With --network=slirp4netns ports are forwarded by the unprivileged user mode network, otherwise by the CNI portmap plugin",
+	EnvKeys:      []string{"PUBLISH"},
+	Tag:          "<port>",
+	EnvHandler:   cmdline.EnvAppendValue,
+}
+
+// --add-host
+var actionAddHostFlag = cmdline.Flag{
+	ID:           "actionAddHostFlag",
+	Value:        &addHosts,
+	DefaultValue: []string{},
+	Name:         "add-host",
+	Usage:        "add a custom host-to-IP mapping (name:ip) in /etc/hosts, the special ip host-gateway resolves to the network gateway and requires --net. Can be given multiple times",
+	EnvKeys:      []string{"ADD_HOST"},
+	Tag:          "<name:ip>",
+	EnvHandler:   cmdline.EnvAppendValue,
+}
+
+// --sysctl
+var actionSysctlFlag = cmdline.Flag{
+	ID:           "actionSysctlFlag",
+	Value:        &sysctls,
+	DefaultValue: cmdline.StringArray{},
+	Name:         "sysctl",
+	Usage:        "set a namespaced kernel parameter in the container (e.g. net.core.somaxconn=1024), requires the corresponding namespace (--net, --ipc or --uts). Can be given multiple times",
+	EnvKeys:      []string{"SYSCTL"},
+	Tag:          "<key=value>",
+	EnvHandler:   cmdline.EnvAppendValue,
+}
+
 // --security
 var actionSecurityFlag = cmdline.Flag{
 	ID:           "actionSecurityFlag",
@@ -283,6 +324,29 @@ var actionSecurityFlag = cmdline.Flag{
 	EnvKeys:      []string{"SECURITY"},
 }
 
+// --landlock
+var actionLandlockFlag = cmdline.Flag{
+	ID:           "actionLandlockFlag",
+	Value:        &landlockRules,
+	DefaultValue: []string{},
+	Name:         "landlock",
+	Usage:        "confine filesystem accesses with Landlock to the given container paths, as ro:<path> (read and execute) or rw:<path> (all accesses), or rules read from profile:<file>. Can be given multiple times",
+	EnvKeys:      []string{"LANDLOCK"},
+	Tag:          "<rule>",
+	EnvHandler:   cmdline.EnvAppendValue,
+}
+
+// --seccomp-record
+var actionSeccompRecordFlag = cmdline.Flag{
+	ID:           "actionSeccompRecordFlag",
+	Value:        &seccompRecord,
+	DefaultValue: "",
+	Name:         "seccomp-record",
+	Usage:        "record the system calls made in the container and write a seccomp profile allowing them to <file>, usable with --security seccomp:<file>",
+	EnvKeys:      []string{"SECCOMP_RECORD"},
+	Tag:          "<file>",
+}
+
 // --apply-cgroups
 var actionApplyCgroupsFlag = cmdline.Flag{
 	ID:           "actionApplyCgroupsFlag",
@@ -930,6 +994,8 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&actionContainLibsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionDisableCacheFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionDNSFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionAddHostFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionPublishFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionDropCapsFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionFakerootFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionFuseMountFlag, actionsInstanceCmd...)
@@ -960,6 +1026,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&actionPwdFlag, actionsCmd...)
 		cmdManager.RegisterFlagForCmd(&actionScratchFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionSecurityFlag, actionsInstanceCmd...)
+		cmdManager.RegisterFlagForCmd(&actionSysctlFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionShellFlag, ShellCmd)
 		cmdManager.RegisterFlagForCmd(&actionTmpDirFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionUserNamespaceFlag, actionsInstanceCmd...)
@@ -1000,5 +1067,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&actionIntelHpuFlag, actionsInstanceCmd...)
 		cmdManager.RegisterFlagForCmd(&actionDeviceFlag, actionsCmd...)
 		cmdManager.RegisterFlagForCmd(&actionCdiDirsFlag, actionsCmd...)
+		cmdManager.RegisterFlagForCmd(&actionSeccompRecordFlag, actionsCmd...)
+		cmdManager.RegisterFlagForCmd(&actionLandlockFlag, actionsInstanceCmd...)
 	})
 }
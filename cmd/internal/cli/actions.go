@@ -308,6 +308,21 @@ func launchContainer(cmd *cobra.Command, image string, args []string, instanceNa
 		cgJSON = ""
 		sylog.Warningf("Resource limits & cgroups configuration are only applied to instances at instance start.")
 	}
+	sysctlList := sysctls
+	if len(sysctlList) > 0 && strings.HasPrefix(image, "instance://") {
+		sysctlList = nil
+		sylog.Warningf("Kernel parameters set with --sysctl are only applied to instances at instance start.")
+	}
+	addHostList := addHosts
+	if len(addHostList) > 0 && strings.HasPrefix(image, "instance://") {
+		addHostList = nil
+		sylog.Warningf("Hosts entries set with --add-host are only applied to instances at instance start.")
+	}
+	publishList := publishPorts
+	if len(publishList) > 0 && strings.HasPrefix(image, "instance://") {
+		publishList = nil
+		sylog.Warningf("Ports set with --publish are only forwarded to instances at instance start.")
+	}
 
 	ki, err := getEncryptionMaterial(cmd)
 	if err != nil {
@@ -342,11 +357,16 @@ func launchContainer(cmd *cobra.Command, image string, args []string, instanceNa
 		launch.OptNetwork(network, networkArgs),
 		launch.OptHostname(hostname),
 		launch.OptDNS(dns),
+		launch.OptAddHosts(addHostList),
+		launch.OptPublishPorts(publishList),
+		launch.OptSysctls(sysctlList),
 		launch.OptCaps(addCaps, dropCaps),
 		launch.OptAllowSUID(allowSUID),
 		launch.OptKeepPrivs(keepPrivs),
 		launch.OptNoPrivs(noPrivs),
 		launch.OptSecurity(security),
+		launch.OptSeccompRecord(seccompRecord),
+		launch.OptLandlockRules(landlockRules),
 		launch.OptNoUmask(noUmask),
 		launch.OptCgroupsJSON(cgJSON),
 		launch.OptConfigFile(configurationFile),
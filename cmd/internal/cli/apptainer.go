@@ -13,6 +13,7 @@ package cli
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -23,13 +24,16 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/internal/pkg/ociplatform"
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
 	"github.com/apptainer/apptainer/internal/pkg/remote"
+	"github.com/apptainer/apptainer/internal/pkg/remote/credential"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	"github.com/apptainer/apptainer/internal/pkg/sypgp"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
@@ -768,6 +772,21 @@ func loadRemoteConf(filepath string) (*remote.Config, error) {
 	return c, nil
 }
 
+// refreshTokensOnce refreshes the access tokens of OIDC logins at most once.
+var refreshTokensOnce sync.Once
+
+// refreshTokens refreshes the access tokens obtained by OIDC logins to remotes
+// and registries, if they expire soon, before accessing them.
+func refreshTokens() {
+	refreshTokensOnce.Do(func() {
+		if err := apptainer.RefreshTokens(syfs.RemoteConf()); errors.Is(err, credential.ErrLoginExpired) {
+			sylog.Warningf("Unable to refresh access token, log in again with --oidc: %v", err)
+		} else if err != nil {
+			sylog.Warningf("Unable to refresh access token: %v", err)
+		}
+	})
+}
+
 // getRemote returns the remote in use or an error
 func getRemote() (*endpoint.Config, error) {
 	var c *remote.Config
@@ -887,6 +906,8 @@ func getLibraryClientConfig(uri string) (*libClient.Config, error) {
 	if currentRemoteEndpoint == nil {
 		var err error
 
+		refreshTokens()
+
 		// if we can load config and if default endpoint is set, use that
 		// otherwise fall back on regular authtoken and URI behavior
 		currentRemoteEndpoint, err = getRemote()
@@ -912,6 +933,30 @@ func getLibraryClientConfig(uri string) (*libClient.Config, error) {
 	return libClientConfig, nil
 }
 
+// getBuilderClientConfig returns the base URI and the authentication token
+// for build server access. A "" value for uri will return the build service of
+// the current endpoint.
+func getBuilderClientConfig(uri string) (baseURI, authToken string, err error) {
+	if currentRemoteEndpoint == nil {
+		refreshTokens()
+
+		// if we can load config and if default endpoint is set, use that
+		// otherwise fall back on regular authtoken and URI behavior
+		currentRemoteEndpoint, err = getRemote()
+		if err != nil {
+			return "", "", fmt.Errorf("unable to load remote configuration: %v", err)
+		}
+	}
+	if currentRemoteEndpoint == endpoint.DefaultEndpointConfig {
+		if uri == "" {
+			return "", "", fmt.Errorf("no default remote with build service in use, use --builder to specify a build server")
+		}
+		return uri, "", nil
+	}
+
+	return currentRemoteEndpoint.BuilderClientConfig(uri)
+}
+
 // getOCIPlatform returns the appropriate OCI platform to use according to `--arch` and `--platform`
 func getOCIPlatform() ggcrv1.Platform {
 	var (
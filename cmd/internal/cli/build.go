@@ -11,7 +11,6 @@
 package cli
 
 import (
-	"errors"
 	"fmt"
 	"os"
 	"runtime"
@@ -57,7 +56,8 @@ var buildArgs struct {
 	ignoreFakerootCmd   bool     // Ignore fakeroot command (hidden)
 	ignoreProot         bool     // Ignore proot command (hidden)
 	ignoreUserns        bool     // Ignore user namespace(hidden)
-	remote              bool     // Remote flag(hidden, only for helpful error message)
+	remote              bool     // Build on a remote build server
+	builderURL          string   // Build server URL, implies remote
 	reproducible        bool     // Reproducible build
 	buildVarArgs        []string // Variables passed to build procedure.
 	buildVarArgFile     string   // Variables file passed to build procedure.
@@ -337,14 +337,25 @@ var buildIgnoreUsernsFlag = cmdline.Flag{
 	Hidden:       true,
 }
 
+// --remote
 var buildRemoteFlag = cmdline.Flag{
 	ID:           "remoteFlag",
 	Value:        &buildArgs.remote,
 	DefaultValue: false,
 	Name:         "remote",
-	Usage:        "--remote is no longer supported, try building locally without it",
-	EnvKeys:      []string{},
-	Hidden:       true,
+	Usage:        "build image on the build server of the remote endpoint, or of --builder",
+	EnvKeys:      []string{"REMOTE"},
+}
+
+// --builder
+var buildBuilderFlag = cmdline.Flag{
+	ID:           "buildBuilderFlag",
+	Value:        &buildArgs.builderURL,
+	DefaultValue: "",
+	Name:         "builder",
+	Usage:        "build server URL to build the image on (implies --remote)",
+	Tag:          "<url>",
+	EnvKeys:      []string{"BUILDER"},
 }
 
 var buildReproducibleFlag = cmdline.Flag{
@@ -428,6 +439,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&buildIgnoreProot, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildIgnoreUsernsFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildRemoteFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildBuilderFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildReproducibleFlag, buildCmd)
 
 		cmdManager.RegisterFlagForCmd(&buildVarArgsFlag, buildCmd)
@@ -456,6 +468,14 @@ func preRun(cmd *cobra.Command, args []string) {
 		// these imply --encrypt
 		buildArgs.encrypt = true
 	}
+	if buildArgs.builderURL != "" {
+		buildArgs.remote = true
+	}
+	if buildArgs.remote {
+		// remote builds need no privileges on the host
+		return
+	}
+
 	spec := args[len(args)-1]
 	isDeffile := fs.IsFile(spec) && !isImage(spec)
 	if buildArgs.fakeroot {
@@ -471,11 +491,6 @@ func preRun(cmd *cobra.Command, args []string) {
 			}
 		}
 	}
-
-	if buildArgs.remote {
-		err := errors.New("--remote is no longer supported, try building locally without it")
-		cobra.CheckErr(err)
-	}
 }
 
 // checkBuildTarget makes sure output target doesn't exist, or is ok to overwrite.
@@ -583,5 +598,8 @@ func makeOCICredentials(cmd *cobra.Command) (*authn.AuthConfig, error) {
 	// If a username / password have not been explicitly set, return a nil
 	// pointer, which will mean containers/image falls back to looking for
 	// .docker/config.json
+	if reqAuthFile == "" {
+		refreshTokens()
+	}
 	return nil, nil
 }
@@ -16,6 +16,7 @@ import (
 	"fmt"
 	"os"
 	osExec "os/exec"
+	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
@@ -25,10 +26,12 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/build/oci"
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/internal/pkg/cache"
+	"github.com/apptainer/apptainer/internal/pkg/client/builder"
 	"github.com/apptainer/apptainer/internal/pkg/fakeroot"
 	"github.com/apptainer/apptainer/internal/pkg/ociplatform"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	fakerootConfig "github.com/apptainer/apptainer/internal/pkg/runtime/engine/fakeroot/config"
+	buildserver "github.com/apptainer/apptainer/internal/pkg/server/builder"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/internal/pkg/util/interactive"
@@ -40,6 +43,7 @@ import (
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/apptainer/pkg/util/cryptkey"
 	"github.com/apptainer/apptainer/pkg/util/namespaces"
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
 	keyClient "github.com/apptainer/container-key-client/client"
 	"github.com/ccoveille/go-safecast/v2"
 	"github.com/spf13/cobra"
@@ -233,6 +237,12 @@ func runBuild(cmd *cobra.Command, args []string) {
 		sylog.Fatalf("Custom authfile is not supported for remote build")
 	}
 
+	if buildArgs.remote {
+		runBuildRemote(cmd.Context(), cmd, dest, spec)
+		sylog.Infof("Build complete: %s", dest)
+		return
+	}
+
 	// check if target collides with existing file
 	if err := checkBuildTarget(dest); err != nil {
 		sylog.Fatalf("While checking build target: %s", err)
@@ -242,6 +252,82 @@ func runBuild(cmd *cobra.Command, args []string) {
 	sylog.Infof("Build complete: %s", dest)
 }
 
+// runBuildRemote builds spec on the build server of the remote endpoint, or of
+// --builder, then downloads the image built to dst, or has the build server
+// push it if dst is a library reference.
+func runBuildRemote(ctx context.Context, cmd *cobra.Command, dst, spec string) {
+	switch {
+	case buildArgs.sandbox:
+		sylog.Fatalf("Remote builds can't build sandboxes")
+	case buildArgs.update:
+		sylog.Fatalf("Remote builds can't update images")
+	case buildArgs.encrypt:
+		sylog.Fatalf("Remote builds can't build encrypted images")
+	case len(buildArgs.bindPaths) > 0 || len(buildArgs.mounts) > 0:
+		sylog.Fatalf("Remote builds can't bind or mount host paths")
+	}
+
+	buildArgsMap, err := args.ReadBuildArgs(buildArgs.buildVarArgs, buildArgs.buildVarArgFile)
+	if err != nil {
+		sylog.Fatalf("While processing the definition file: %v", err)
+	}
+	defs, unusedArgs, err := build.MakeAllDefs(spec, buildArgsMap)
+	if err != nil {
+		sylog.Fatalf("Unable to build from %s: %v", spec, err)
+	}
+	if len(unusedArgs) > 0 {
+		if buildArgs.buildArgsUnusedWarn {
+			sylog.Warningf("Unused build args: %s", strings.Join(unusedArgs, " "))
+		} else {
+			sylog.Fatalf("unused build args: %s. Use option --warn-unused-build-args to show a warning instead of a fatal message", strings.Join(unusedArgs, " "))
+		}
+	}
+	if err := buildserver.CheckStages(defs); err != nil {
+		sylog.Fatalf("Unable to build %s remotely: %v", spec, err)
+	}
+
+	br := buildserver.BuildRequest{
+		NoTest: buildArgs.noTest,
+	}
+	if cmd.Flags().Lookup("arch").Changed {
+		br.Arch = buildArgs.buildArch
+	}
+
+	if strings.HasPrefix(dst, "library://") {
+		// the build server pushes the image with the library credentials
+		lc, err := getLibraryClientConfig(buildArgs.libraryURL)
+		if err != nil {
+			sylog.Fatalf("Unable to get library client configuration: %v", err)
+		}
+		br.LibraryRef = dst
+		br.LibraryURL = lc.BaseURL
+		br.LibraryToken = lc.AuthToken
+	} else if err := checkBuildTarget(dst); err != nil {
+		sylog.Fatalf("While checking build target: %s", err)
+	}
+
+	baseURI, authToken, err := getBuilderClientConfig(buildArgs.builderURL)
+	if err != nil {
+		sylog.Fatalf("Unable to get build server configuration: %v", err)
+	}
+	c, err := builder.NewClient(&builder.Config{
+		BaseURL:   baseURI,
+		AuthToken: authToken,
+		UserAgent: useragent.Value(),
+	})
+	if err != nil {
+		sylog.Fatalf("Unable to create build server client: %v", err)
+	}
+
+	// cancel the remote build if interrupted
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := c.Build(ctx, defs[0].FullRaw, br, dst, os.Stdout); err != nil {
+		sylog.Fatalf("While performing remote build: %v", err)
+	}
+}
+
 func getEncryptionInfo(cmd *cobra.Command) (*cryptkey.KeyInfo, bool) {
 	var keyInfo *cryptkey.KeyInfo
 	unprivilege := false
@@ -0,0 +1,198 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/server"
+	"github.com/apptainer/apptainer/internal/pkg/server/builder"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	buildServerServeListen      string
+	buildServerServeDir         string
+	buildServerServeTokenFile   string
+	buildServerServeTLSCert     string
+	buildServerServeTLSKey      string
+	buildServerServeURL         string
+	buildServerServeConcurrency int
+)
+
+// --listen
+var buildServerServeListenFlag = cmdline.Flag{
+	ID:           "buildServerServeListenFlag",
+	Value:        &buildServerServeListen,
+	DefaultValue: ":8090",
+	Name:         "listen",
+	Usage:        "address to listen on",
+	Tag:          "<[host]:port>",
+	EnvKeys:      []string{"BUILD_SERVER_LISTEN"},
+}
+
+// --dir
+var buildServerServeDirFlag = cmdline.Flag{
+	ID:           "buildServerServeDirFlag",
+	Value:        &buildServerServeDir,
+	DefaultValue: "",
+	Name:         "dir",
+	Required:     true,
+	Usage:        "directory holding the build workspaces (required)",
+	Tag:          "<path>",
+	EnvKeys:      []string{"BUILD_SERVER_DIR"},
+}
+
+// --token-file
+var buildServerServeTokenFileFlag = cmdline.Flag{
+	ID:           "buildServerServeTokenFileFlag",
+	Value:        &buildServerServeTokenFile,
+	DefaultValue: "",
+	Name:         "token-file",
+	Required:     true,
+	Usage:        "file of the tokens allowed to build, one per line and optionally followed by a user name (required)",
+	Tag:          "<path>",
+	EnvKeys:      []string{"BUILD_SERVER_TOKEN_FILE"},
+}
+
+// --tls-cert
+var buildServerServeTLSCertFlag = cmdline.Flag{
+	ID:           "buildServerServeTLSCertFlag",
+	Value:        &buildServerServeTLSCert,
+	DefaultValue: "",
+	Name:         "tls-cert",
+	Usage:        "PEM certificate to serve HTTPS with",
+	Tag:          "<path>",
+	EnvKeys:      []string{"BUILD_SERVER_TLS_CERT"},
+}
+
+// --tls-key
+var buildServerServeTLSKeyFlag = cmdline.Flag{
+	ID:           "buildServerServeTLSKeyFlag",
+	Value:        &buildServerServeTLSKey,
+	DefaultValue: "",
+	Name:         "tls-key",
+	Usage:        "PEM private key of the certificate to serve HTTPS with",
+	Tag:          "<path>",
+	EnvKeys:      []string{"BUILD_SERVER_TLS_KEY"},
+}
+
+// --url
+var buildServerServeURLFlag = cmdline.Flag{
+	ID:           "buildServerServeURLFlag",
+	Value:        &buildServerServeURL,
+	DefaultValue: "",
+	Name:         "url",
+	Usage:        "base URL advertised to clients, when behind a reverse proxy (default: derived from requests)",
+	Tag:          "<url>",
+	EnvKeys:      []string{"BUILD_SERVER_URL"},
+}
+
+// --concurrency
+var buildServerServeConcurrencyFlag = cmdline.Flag{
+	ID:           "buildServerServeConcurrencyFlag",
+	Value:        &buildServerServeConcurrency,
+	DefaultValue: 1,
+	Name:         "concurrency",
+	Usage:        "number of builds run concurrently, the others being queued",
+	EnvKeys:      []string{"BUILD_SERVER_CONCURRENCY"},
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(BuildServerCmd)
+		cmdManager.RegisterSubCmd(BuildServerCmd, BuildServerServeCmd)
+
+		cmdManager.RegisterFlagForCmd(&buildServerServeListenFlag, BuildServerServeCmd)
+		cmdManager.RegisterFlagForCmd(&buildServerServeDirFlag, BuildServerServeCmd)
+		cmdManager.RegisterFlagForCmd(&buildServerServeTokenFileFlag, BuildServerServeCmd)
+		cmdManager.RegisterFlagForCmd(&buildServerServeTLSCertFlag, BuildServerServeCmd)
+		cmdManager.RegisterFlagForCmd(&buildServerServeTLSKeyFlag, BuildServerServeCmd)
+		cmdManager.RegisterFlagForCmd(&buildServerServeURLFlag, BuildServerServeCmd)
+		cmdManager.RegisterFlagForCmd(&buildServerServeConcurrencyFlag, BuildServerServeCmd)
+	})
+}
+
+// BuildServerCmd is the 'build-server' command that allows to host a build
+// server.
+var BuildServerCmd = &cobra.Command{
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return errors.New("invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.BuildServerUse,
+	Short:   docs.BuildServerShort,
+	Long:    docs.BuildServerLong,
+	Example: docs.BuildServerExample,
+}
+
+// BuildServerServeCmd is 'apptainer build-server serve' and serves the remote
+// builds of 'apptainer build --remote'.
+var BuildServerServeCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(0),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, _ []string) {
+		tokens, err := server.ReadTokenFile(buildServerServeTokenFile)
+		if err != nil {
+			sylog.Fatalf("Unable to read tokens: %v", err)
+		}
+		// builds are run by this very binary, with the same configuration
+		command, err := os.Executable()
+		if err != nil {
+			sylog.Fatalf("Unable to find the apptainer command: %v", err)
+		}
+		var args []string
+		if configurationFile != singConfigFileFlag.DefaultValue {
+			args = append(args, "--"+singConfigFileFlag.Name, configurationFile)
+		}
+		if os.Geteuid() == 0 {
+			sylog.Warningf("Running builds as root, bootstrap agents and %%post sections of submitted definitions run with root privileges on this host")
+		}
+
+		s, err := builder.New(builder.Config{
+			Dir:         buildServerServeDir,
+			Tokens:      tokens,
+			URL:         buildServerServeURL,
+			Version:     buildcfg.PACKAGE_VERSION,
+			Command:     command,
+			Args:        args,
+			Concurrency: buildServerServeConcurrency,
+		})
+		if err != nil {
+			sylog.Fatalf("Unable to create build server: %v", err)
+		}
+		defer s.Close()
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err = server.Serve(ctx, server.Config{
+			Addr:     buildServerServeListen,
+			CertFile: buildServerServeTLSCert,
+			KeyFile:  buildServerServeTLSKey,
+		}, "build server", s.Handler())
+		if err != nil {
+			s.Close()
+			sylog.Fatalf("Unable to serve builds: %v", err)
+		}
+	},
+
+	Use:     docs.BuildServerServeUse,
+	Short:   docs.BuildServerServeShort,
+	Long:    docs.BuildServerServeLong,
+	Example: docs.BuildServerServeExample,
+}
@@ -0,0 +1,244 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/cosign"
+	"github.com/apptainer/apptainer/internal/pkg/pkcs11"
+	sifsignature "github.com/apptainer/apptainer/internal/pkg/signature"
+	"github.com/apptainer/apptainer/internal/pkg/util/ociauth"
+	"github.com/apptainer/apptainer/internal/pkg/util/uri"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/spf13/cobra"
+)
+
+// dockerProtocol holds the docker URI of registry images.
+const dockerProtocol = "docker"
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		// registry access for docker:// and oras:// images
+		cmdManager.RegisterFlagForCmd(&dockerUsernameFlag, SignCmd, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&dockerPasswordFlag, SignCmd, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&dockerLoginFlag, SignCmd, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&commonAuthFileFlag, SignCmd, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, SignCmd, VerifyCmd)
+	})
+}
+
+// isRegistryImage returns true if path is a docker:// or oras:// image
+// reference, signed with cosign signatures rather than SIF signatures.
+func isRegistryImage(path string) bool {
+	transport, _ := uri.Split(path)
+	return transport == dockerProtocol || transport == OrasProtocol
+}
+
+// registryImageDigest resolves the docker:// or oras:// image reference path
+// to the digest of its manifest, and returns it with the options to access
+// the registry.
+func registryImageDigest(cmd *cobra.Command, path string) (name.Digest, []remote.Option, error) {
+	_, ref := uri.Split(path)
+	ref = strings.TrimPrefix(ref, "//")
+
+	nopts := []name.Option{name.WithDefaultTag(name.DefaultTag), name.WithDefaultRegistry(name.DefaultRegistry)}
+	if noHTTPS {
+		nopts = append(nopts, name.Insecure)
+	}
+	r, err := name.ParseReference(ref, nopts...)
+	if err != nil {
+		return name.Digest{}, nil, fmt.Errorf("invalid reference %q: %w", ref, err)
+	}
+
+	ociAuth, err := makeOCICredentials(cmd)
+	if err != nil {
+		return name.Digest{}, nil, fmt.Errorf("while creating docker credentials: %w", err)
+	}
+	ropts := []remote.Option{
+		ociauth.AuthOptn(ociAuth, reqAuthFile),
+		remote.WithUserAgent(useragent.Value()),
+		remote.WithContext(cmd.Context()),
+	}
+
+	d, err := cosign.Resolve(r, ropts...)
+	if err != nil {
+		return name.Digest{}, nil, err
+	}
+	return d, ropts, nil
+}
+
+// doSignRegistryCmd signs the docker:// or oras:// image path with a cosign
+// signature, made with the key material of --key or --pkcs11-module.
+func doSignRegistryCmd(cmd *cobra.Command, path string) {
+	for _, f := range []string{signTSAFlag.Name, signSifGroupIDFlag.Name, signSifDescSifIDFlag.Name} {
+		if cmd.Flag(f).Changed {
+			sylog.Fatalf("--%s is not supported to sign registry images", f)
+		}
+	}
+
+	var s signature.Signer
+
+	switch {
+	case cmd.Flag(signPrivateKeyFlag.Name).Changed:
+		sylog.Infof("Signing image with key material from '%v'", priKeyPath)
+
+		var err error
+		s, err = signature.LoadSignerFromPEMFile(priKeyPath, crypto.SHA256, cryptoutils.GetPasswordFromStdIn)
+		if err != nil {
+			sylog.Fatalf("Failed to load key material: %v", err)
+		}
+
+	case cmd.Flag(pkcs11ModuleFlag.Name).Changed:
+		sylog.Infof("Signing image with PKCS#11 key '%v'", pkcs11KeyLabel)
+
+		t, err := openPKCS11Token(cmd, true)
+		if err != nil {
+			sylog.Fatalf("Failed to open PKCS#11 token: %v", err)
+		}
+		defer t.Close()
+
+		s, err = pkcs11.NewSigner(t, pkcs11KeyLabel)
+		if err != nil {
+			sylog.Fatalf("Failed to load PKCS#11 key material: %v", err)
+		}
+
+	default:
+		sylog.Fatalf("Signing registry images requires --key or --pkcs11-module")
+	}
+
+	d, ropts, err := registryImageDigest(cmd, path)
+	if err != nil {
+		sylog.Fatalf("Failed to resolve image: %v", err)
+	}
+	if err := cosign.Sign(d, s, ropts...); err != nil {
+		sylog.Fatalf("Failed to sign container: %v", err)
+	}
+	sylog.Infof("Signature created and pushed for image '%v'", d)
+}
+
+// doVerifyRegistryCmd verifies the cosign signatures of the docker:// or
+// oras:// image path, with the key material of --key or --certificate.
+func doVerifyRegistryCmd(cmd *cobra.Command, path string) {
+	for _, f := range []string{verifyTSARootsFlag.Name, verifySifGroupIDFlag.Name, verifySifDescSifIDFlag.Name, verifyJSONFlag.Name} {
+		if cmd.Flag(f).Changed {
+			sylog.Fatalf("--%s is not supported to verify registry images", f)
+		}
+	}
+
+	var v signature.Verifier
+
+	switch {
+	case cmd.Flag(verifyCertificateFlag.Name).Changed:
+		sylog.Infof("Verifying image with key material from certificate '%v'", certificatePath)
+
+		c, err := loadCertificate(certificatePath)
+		if err != nil {
+			sylog.Fatalf("Failed to load certificate: %v", err)
+		}
+		if err := checkRegistryCertificate(cmd, c); err != nil {
+			sylog.Fatalf("Failed to verify certificate: %v", err)
+		}
+		v, err = signature.LoadVerifier(c.PublicKey, crypto.SHA256)
+		if err != nil {
+			sylog.Fatalf("Failed to load key material: %v", err)
+		}
+
+	case cmd.Flag(verifyPublicKeyFlag.Name).Changed:
+		sylog.Infof("Verifying image with key material from '%v'", pubKeyPath)
+
+		var err error
+		v, err = signature.LoadVerifierFromPEMFile(pubKeyPath, crypto.SHA256)
+		if err != nil {
+			sylog.Fatalf("Failed to load key material: %v", err)
+		}
+
+	default:
+		sylog.Fatalf("Verifying registry images requires --key or --certificate")
+	}
+
+	d, ropts, err := registryImageDigest(cmd, path)
+	if err != nil {
+		sylog.Fatalf("Failed to resolve image: %v", err)
+	}
+	if err := cosign.Verify(d, v, ropts...); err != nil {
+		sylog.Fatalf("Failed to verify container: %v", err)
+	}
+	sylog.Infof("Verified signature(s) from image '%v'", d)
+}
+
+// checkRegistryCertificate verifies that the certificate c chains to the
+// roots of the certificate flags, and is not revoked if --ocsp-verify is set.
+func checkRegistryCertificate(cmd *cobra.Command, c *x509.Certificate) error {
+	opts := x509.VerifyOptions{
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+
+	if cmd.Flag(verifyCertificateIntermediatesFlag.Name).Changed {
+		p, err := loadCertificatePool(certificateIntermediatesPath)
+		if err != nil {
+			return fmt.Errorf("while loading intermediate certificates: %w", err)
+		}
+		opts.Intermediates = p
+	}
+
+	if cmd.Flag(verifyCertificateRootsFlag.Name).Changed {
+		p, err := loadCertificatePool(certificateRootsPath)
+		if err != nil {
+			return fmt.Errorf("while loading root certificates: %w", err)
+		}
+		opts.Roots = p
+	}
+
+	chains, err := c.Verify(opts)
+	if err != nil {
+		return err
+	}
+
+	if ocspVerify {
+		return sifsignature.OCSPVerify(chains[0]...)
+	}
+	return nil
+}
+
+// verifyRegistryPull verifies the cosign signature of the docker:// or oras://
+// image path with the public key at keyPath, and returns the reference of the
+// verified digest to pull.
+func verifyRegistryPull(cmd *cobra.Command, path, keyPath string) string {
+	transport, _ := uri.Split(path)
+	if transport != dockerProtocol && transport != OrasProtocol {
+		sylog.Fatalf("--verify-key is only supported for docker:// and oras:// images")
+	}
+
+	v, err := signature.LoadVerifierFromPEMFile(keyPath, crypto.SHA256)
+	if err != nil {
+		sylog.Fatalf("Failed to load key material: %v", err)
+	}
+
+	d, ropts, err := registryImageDigest(cmd, path)
+	if err != nil {
+		sylog.Fatalf("Failed to resolve image: %v", err)
+	}
+	if err := cosign.Verify(d, v, ropts...); err != nil {
+		sylog.Fatalf("Failed to verify container: %v", err)
+	}
+	sylog.Infof("Verified signature(s) from image '%v'", d)
+
+	// pull the verified digest, not whatever the tag points to now
+	return transport + "://" + d.String()
+}
@@ -125,6 +125,17 @@ func init() {
 		cmdManager.RegisterFlagForCmd(keyNewPairCommentFlag, KeyNewPairCmd)
 		cmdManager.RegisterFlagForCmd(keyNewPairPasswordFlag, KeyNewPairCmd)
 		cmdManager.RegisterFlagForCmd(keyNewPairPushFlag, KeyNewPairCmd)
+		cmdManager.RegisterFlagForCmd(keyNewPairKeyTypeFlag, KeyNewPairCmd)
+		cmdManager.RegisterFlagForCmd(keyNewPairExpiryFlag, KeyNewPairCmd)
+		cmdManager.RegisterFlagForCmd(keyNewPairSigningSubkeyFlag, KeyNewPairCmd)
+
+		cmdManager.RegisterSubCmd(KeyCmd, KeyExtendCmd)
+		cmdManager.RegisterFlagForCmd(keyExtendExpiryFlag, KeyExtendCmd)
+
+		cmdManager.RegisterSubCmd(KeyCmd, KeyRevokeCmd)
+		cmdManager.RegisterFlagForCmd(keyRevokeReasonFlag, KeyRevokeCmd)
+		cmdManager.RegisterFlagForCmd(keyRevokeCommentFlag, KeyRevokeCmd)
+		cmdManager.RegisterFlagForCmd(keyRevokePushFlag, KeyRevokeCmd)
 
 		cmdManager.RegisterSubCmd(KeyCmd, KeyListCmd)
 		cmdManager.RegisterSubCmd(KeyCmd, KeySearchCmd)
@@ -134,7 +145,7 @@ func init() {
 		cmdManager.RegisterSubCmd(KeyCmd, KeyRemoveCmd)
 		cmdManager.RegisterSubCmd(KeyCmd, KeyExportCmd)
 
-		cmdManager.RegisterFlagForCmd(&keyServerURIFlag, KeySearchCmd, KeyPushCmd, KeyPullCmd)
+		cmdManager.RegisterFlagForCmd(&keyServerURIFlag, KeySearchCmd, KeyPushCmd, KeyPullCmd, KeyRevokeCmd)
 		cmdManager.RegisterFlagForCmd(&keySearchLongListFlag, KeySearchCmd)
 		cmdManager.RegisterFlagForCmd(&keyNewpairBitLengthFlag, KeyNewPairCmd)
 		cmdManager.RegisterFlagForCmd(&keyImportWithNewPasswordFlag, KeyImportCmd)
@@ -148,7 +159,7 @@ func init() {
 
 		cmdManager.RegisterFlagForCmd(
 			&keyLocalDirKeyFlag,
-			append(cmdManager.GetCmdGroup("key_group_cmd"), KeyNewPairCmd)...,
+			append(cmdManager.GetCmdGroup("key_group_cmd"), KeyNewPairCmd, KeyExtendCmd, KeyRevokeCmd)...,
 		)
 
 		// register public/private/both flags for KeyRemoveCmd only
@@ -0,0 +1,62 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/pkg/sypgp"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	keyExtendExpiry     string
+	keyExtendExpiryFlag = &cmdline.Flag{
+		ID:           "KeyExtendExpiryFlag",
+		Value:        &keyExtendExpiry,
+		DefaultValue: "1y",
+		Name:         "expiry",
+		Usage:        "new key expiry, a date (YYYY-MM-DD), a duration in days, weeks, months or years from now (e.g. 90d, 2y), or never",
+	}
+
+	// KeyExtendCmd is 'apptainer key extend <fingerprint>' and sets the expiry of a key pair
+	KeyExtendCmd = &cobra.Command{
+		Args:                  cobra.ExactArgs(1),
+		DisableFlagsInUseLine: true,
+		Run:                   runKeyExtendCmd,
+		Use:                   docs.KeyExtendUse,
+		Short:                 docs.KeyExtendShort,
+		Long:                  docs.KeyExtendLong,
+		Example:               docs.KeyExtendExample,
+	}
+)
+
+func runKeyExtendCmd(_ *cobra.Command, args []string) {
+	expiry, err := parseKeyExpiry(keyExtendExpiry, time.Now())
+	if err != nil {
+		sylog.Fatalf("Invalid --expiry: %v", err)
+	}
+
+	keyring := sypgp.NewHandle(keyLocalDir)
+	e, err := keyring.ExtendKey(args[0], expiry)
+	if err != nil {
+		sylog.Fatalf("Unable to extend key: %v", err)
+	}
+
+	if t, ok := sypgp.KeyExpiry(e); ok {
+		fmt.Printf("Key %X now expires on %s\n", e.PrimaryKey.Fingerprint, t)
+	} else {
+		fmt.Printf("Key %X now never expires\n", e.PrimaryKey.Fingerprint)
+	}
+	fmt.Println("Push the key to update it on the keystore")
+}
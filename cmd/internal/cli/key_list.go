@@ -15,13 +15,17 @@ import (
 
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/gpgagent"
 	"github.com/apptainer/apptainer/internal/pkg/sypgp"
 	"github.com/apptainer/apptainer/pkg/cmdline"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/spf13/cobra"
 )
 
-var secret bool
+var (
+	secret    bool
+	agentKeys bool
+)
 
 // -s|--secret
 var keyListSecretFlag = cmdline.Flag{
@@ -34,9 +38,19 @@ var keyListSecretFlag = cmdline.Flag{
 	EnvKeys:      []string{"SECRET"},
 }
 
+// --agent
+var keyListAgentFlag = cmdline.Flag{
+	ID:           "keyListAgentFlag",
+	Value:        &agentKeys,
+	DefaultValue: false,
+	Name:         "agent",
+	Usage:        "list the keys available through gpg-agent instead of the local ones",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterFlagForCmd(&keyListSecretFlag, KeyListCmd)
+		cmdManager.RegisterFlagForCmd(&keyListAgentFlag, KeyListCmd)
 	})
 }
 
@@ -45,6 +59,15 @@ var KeyListCmd = &cobra.Command{
 	Args:                  cobra.ExactArgs(0),
 	DisableFlagsInUseLine: true,
 	Run: func(_ *cobra.Command, _ []string) {
+		if agentKeys {
+			if secret {
+				sylog.Fatalf("--agent and --secret can't be used together")
+			}
+			if err := doKeyListAgentCmd(); err != nil {
+				sylog.Fatalf("While listing gpg-agent keys: %s", err)
+			}
+			return
+		}
 		if err := doKeyListCmd(secret); err != nil {
 			sylog.Fatalf("While listing keys: %s", err)
 		}
@@ -80,3 +103,31 @@ func doKeyListCmd(secret bool) error {
 
 	return nil
 }
+
+func doKeyListAgentCmd() error {
+	var opts []sypgp.HandleOpt
+	path := keyLocalDir
+
+	if keyGlobalPubKey {
+		path = buildcfg.APPTAINER_CONFDIR
+		opts = append(opts, sypgp.GlobalHandleOpt())
+	}
+
+	socket, err := gpgagent.SocketPath()
+	if err != nil {
+		return err
+	}
+	c, err := gpgagent.Connect()
+	if err != nil {
+		return fmt.Errorf("could not connect to gpg-agent: %s", err)
+	}
+	defer c.Close()
+
+	keyring := sypgp.NewHandle(path, opts...)
+	fmt.Printf("gpg-agent key listing (%s):\n\n", socket)
+	if err := keyring.PrintAgentKeys(c); err != nil {
+		return fmt.Errorf("could not list gpg-agent keys: %s", err)
+	}
+
+	return nil
+}
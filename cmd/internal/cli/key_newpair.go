@@ -14,6 +14,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
@@ -75,6 +77,33 @@ var (
 		Usage:        "specify to push the public key to the remote keystore",
 	}
 
+	keyNewPairKeyType     string
+	keyNewPairKeyTypeFlag = &cmdline.Flag{
+		ID:           "KeyNewPairKeyTypeFlag",
+		Value:        &keyNewPairKeyType,
+		DefaultValue: string(sypgp.KeyTypeRSA),
+		Name:         "key-type",
+		Usage:        "key algorithm, rsa or ed25519",
+	}
+
+	keyNewPairExpiry     string
+	keyNewPairExpiryFlag = &cmdline.Flag{
+		ID:           "KeyNewPairExpiryFlag",
+		Value:        &keyNewPairExpiry,
+		DefaultValue: "never",
+		Name:         "expiry",
+		Usage:        "key expiry, a date (YYYY-MM-DD), a duration in days, weeks, months or years (e.g. 90d, 2y), or never",
+	}
+
+	keyNewPairSigningSubkey     bool
+	keyNewPairSigningSubkeyFlag = &cmdline.Flag{
+		ID:           "KeyNewPairSigningSubkeyFlag",
+		Value:        &keyNewPairSigningSubkey,
+		DefaultValue: false,
+		Name:         "signing-subkey",
+		Usage:        "create a separate subkey to sign images",
+	}
+
 	// KeyNewPairCmd is 'apptainer key newpair' and generate a new OpenPGP key pair
 	KeyNewPairCmd = &cobra.Command{
 		Args:                  cobra.ExactArgs(0),
@@ -96,12 +125,30 @@ func runNewPairCmd(cmd *cobra.Command, _ []string) {
 	path := keyLocalDir
 	keyring := sypgp.NewHandle(path)
 
+	keyType := sypgp.KeyType(keyNewPairKeyType)
+	switch keyType {
+	case sypgp.KeyTypeRSA:
+	case sypgp.KeyTypeEd25519:
+		if cmd.Flags().Changed(keyNewpairBitLengthFlag.Name) {
+			sylog.Fatalf("--bit-length is only supported for rsa keys")
+		}
+	default:
+		sylog.Fatalf("Unsupported --key-type %q, must be rsa or ed25519", keyType)
+	}
+	expiry, err := parseKeyExpiry(keyNewPairExpiry, time.Now())
+	if err != nil {
+		sylog.Fatalf("Invalid --expiry: %v", err)
+	}
+
 	opts, err := collectInput(cmd)
 	if err != nil {
 		sylog.Errorf("could not collect user input: %v", err)
 		os.Exit(2)
 	}
 	opts.KeyLength = keyNewpairBitLength
+	opts.KeyType = keyType
+	opts.Expiry = expiry
+	opts.SigningSubkey = keyNewPairSigningSubkey
 
 	fmt.Printf("Generating Entity and OpenPGP Key Pair... ")
 	key, err := keyring.GenKeyPair(opts.GenKeyPairOptions)
@@ -193,3 +240,33 @@ func collectInput(cmd *cobra.Command) (*keyNewPairOptions, error) {
 
 	return &genOpts, nil
 }
+
+// parseKeyExpiry parses the key expiry s, a date, a number of days, weeks,
+// months or years after now, or never, returning a zero time for keys which
+// never expire.
+func parseKeyExpiry(s string, now time.Time) (time.Time, error) {
+	switch s {
+	case "", "never", "0":
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n <= 0 {
+		return time.Time{}, fmt.Errorf("%q is not a date, a duration or never", s)
+	}
+	switch s[len(s)-1] {
+	case 'd':
+		return now.AddDate(0, 0, n), nil
+	case 'w':
+		return now.AddDate(0, 0, 7*n), nil
+	case 'm':
+		return now.AddDate(0, n, 0), nil
+	case 'y':
+		return now.AddDate(n, 0, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date, a duration or never", s)
+}
@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/sypgp"
 	"github.com/spf13/cobra"
@@ -139,3 +140,38 @@ func TestCollectInput(t *testing.T) {
 		})
 	}
 }
+
+func TestParseKeyExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "Never", s: "never"},
+		{name: "Empty", s: ""},
+		{name: "Zero", s: "0"},
+		{name: "Date", s: "2026-06-30", want: time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC)},
+		{name: "Days", s: "90d", want: now.AddDate(0, 0, 90)},
+		{name: "Weeks", s: "2w", want: now.AddDate(0, 0, 14)},
+		{name: "Months", s: "6m", want: now.AddDate(0, 6, 0)},
+		{name: "Years", s: "2y", want: now.AddDate(2, 0, 0)},
+		{name: "NegativeDuration", s: "-1y", wantErr: true},
+		{name: "UnknownUnit", s: "3h", wantErr: true},
+		{name: "Invalid", s: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseKeyExpiry(tt.s, now)
+			if tt.wantErr {
+				assert.Assert(t, err != nil)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Assert(t, got.Equal(tt.want), "got %v, want %v", got, tt.want)
+		})
+	}
+}
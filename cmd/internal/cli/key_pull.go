@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/apptainer/apptainer/docs"
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
@@ -30,9 +31,15 @@ var KeyPullCmd = &cobra.Command{
 	Args:                  cobra.ExactArgs(1),
 	DisableFlagsInUseLine: true,
 	Run: func(cmd *cobra.Command, args []string) {
-		co, err := getKeyserverClientOpts(keyServerURI, endpoint.KeyserverPullOp)
-		if err != nil {
-			sylog.Fatalf("Keyserver client failed: %s", err)
+		var co []client.Option
+
+		// keys of an email address are pulled from its web key directory
+		if !sypgp.IsEmail(args[0]) {
+			var err error
+			co, err = getKeyserverClientOpts(keyServerURI, endpoint.KeyserverPullOp)
+			if err != nil {
+				sylog.Fatalf("Keyserver client failed: %s", err)
+			}
 		}
 
 		if err := doKeyPullCmd(cmd.Context(), args[0], co...); err != nil {
@@ -62,9 +69,18 @@ func doKeyPullCmd(ctx context.Context, fingerprint string, co ...client.Option)
 	keyring := sypgp.NewHandle(path, opts...)
 
 	// get matching keyring
-	el, err := sypgp.FetchPubkey(ctx, fingerprint, co...)
-	if err != nil {
-		return fmt.Errorf("unable to pull key from server: %v", err)
+	var el openpgp.EntityList
+	var err error
+	if sypgp.IsEmail(fingerprint) {
+		el, err = sypgp.FetchWKD(ctx, fingerprint)
+		if err != nil {
+			return fmt.Errorf("unable to pull key from web key directory: %v", err)
+		}
+	} else {
+		el, err = sypgp.FetchPubkey(ctx, fingerprint, co...)
+		if err != nil {
+			return fmt.Errorf("unable to pull key from server: %v", err)
+		}
 	}
 
 	elstore, err := keyring.LoadPubKeyring()
@@ -97,5 +113,14 @@ func doKeyPullCmd(ctx context.Context, fingerprint string, co ...client.Option)
 
 	fmt.Printf("%v key(s) added to keyring of trust %s\n", count, keyring.PublicPath())
 
+	// add revocations of keys already in keyring
+	revoked, err := keyring.UpdateRevocations(el)
+	if err != nil {
+		return fmt.Errorf("unable to update key revocations: %v", err)
+	}
+	for _, fp := range revoked {
+		fmt.Printf("Key %s has been revoked\n", fp)
+	}
+
 	return nil
 }
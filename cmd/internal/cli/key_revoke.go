@@ -0,0 +1,96 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
+	"github.com/apptainer/apptainer/internal/pkg/sypgp"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	keyRevokeReason     string
+	keyRevokeReasonFlag = &cmdline.Flag{
+		ID:           "KeyRevokeReasonFlag",
+		Value:        &keyRevokeReason,
+		DefaultValue: "unspecified",
+		Name:         "reason",
+		Usage:        "reason for revoking the key (" + strings.Join(sypgp.RevocationReasons(), ", ") + ")",
+	}
+
+	keyRevokeComment     string
+	keyRevokeCommentFlag = &cmdline.Flag{
+		ID:           "KeyRevokeCommentFlag",
+		Value:        &keyRevokeComment,
+		DefaultValue: "",
+		Name:         "comment",
+		Usage:        "text explaining why the key is revoked",
+	}
+
+	keyRevokePush     bool
+	keyRevokePushFlag = &cmdline.Flag{
+		ID:           "KeyRevokePushFlag",
+		Value:        &keyRevokePush,
+		DefaultValue: false,
+		Name:         "push",
+		ShortHand:    "U",
+		Usage:        "specify to push the revoked public key to the remote keystore",
+	}
+
+	// KeyRevokeCmd is 'apptainer key revoke <fingerprint>' and revokes a key pair
+	KeyRevokeCmd = &cobra.Command{
+		Args:                  cobra.ExactArgs(1),
+		DisableFlagsInUseLine: true,
+		Run:                   runKeyRevokeCmd,
+		Use:                   docs.KeyRevokeUse,
+		Short:                 docs.KeyRevokeShort,
+		Long:                  docs.KeyRevokeLong,
+		Example:               docs.KeyRevokeExample,
+	}
+)
+
+func runKeyRevokeCmd(cmd *cobra.Command, args []string) {
+	reason, err := sypgp.ParseRevocationReason(keyRevokeReason)
+	if err != nil {
+		sylog.Fatalf("Invalid --reason: %v", err)
+	}
+
+	keyring := sypgp.NewHandle(keyLocalDir)
+	e, err := keyring.RevokeKey(args[0], reason, keyRevokeComment)
+	if err != nil {
+		sylog.Fatalf("Unable to revoke key: %v", err)
+	}
+
+	fmt.Printf("Key %X revoked\n", e.PrimaryKey.Fingerprint)
+	fmt.Printf("Revocation certificate stored in %s\n", keyring.RevocationPath(e.PrimaryKey.Fingerprint))
+
+	if !keyRevokePush {
+		fmt.Println("Push the key to publish the revocation on the keystore")
+		return
+	}
+
+	// Only connect to the endpoint if we are pushing the key.
+	co, err := getKeyserverClientOpts(keyServerURI, endpoint.KeyserverPushOp)
+	if err != nil {
+		sylog.Fatalf("Keyserver client failed: %s", err)
+	}
+
+	if err := sypgp.PushPubkey(cmd.Context(), e, co...); err != nil {
+		sylog.Errorf("Failed to push revoked key to keystore: %s", err)
+		os.Exit(2)
+	}
+	fmt.Println("Revoked key successfully pushed to keystore")
+}
@@ -0,0 +1,162 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/pkg/server"
+	"github.com/apptainer/apptainer/internal/pkg/server/keyserver"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	keyserverServeListen     string
+	keyserverServeDir        string
+	keyserverServeReadOnly   bool
+	keyserverServeVerifyHook string
+	keyserverServeTLSCert    string
+	keyserverServeTLSKey     string
+	keyserverServeURL        string
+)
+
+// --listen
+var keyserverServeListenFlag = cmdline.Flag{
+	ID:           "keyserverServeListenFlag",
+	Value:        &keyserverServeListen,
+	DefaultValue: ":11371",
+	Name:         "listen",
+	Usage:        "address to listen on",
+	Tag:          "<[host]:port>",
+	EnvKeys:      []string{"KEYSERVER_LISTEN"},
+}
+
+// --dir
+var keyserverServeDirFlag = cmdline.Flag{
+	ID:           "keyserverServeDirFlag",
+	Value:        &keyserverServeDir,
+	DefaultValue: "",
+	Name:         "dir",
+	Required:     true,
+	Usage:        "directory storing the keys (required)",
+	Tag:          "<path>",
+	EnvKeys:      []string{"KEYSERVER_DIR"},
+}
+
+// --read-only
+var keyserverServeReadOnlyFlag = cmdline.Flag{
+	ID:           "keyserverServeReadOnlyFlag",
+	Value:        &keyserverServeReadOnly,
+	DefaultValue: false,
+	Name:         "read-only",
+	Usage:        "reject the keys added",
+	EnvKeys:      []string{"KEYSERVER_READ_ONLY"},
+}
+
+// --verify-hook
+var keyserverServeVerifyHookFlag = cmdline.Flag{
+	ID:           "keyserverServeVerifyHookFlag",
+	Value:        &keyserverServeVerifyHook,
+	DefaultValue: "",
+	Name:         "verify-hook",
+	Usage:        "command sending the verification link of new identities, run with the email address, the key fingerprint and the link as arguments",
+	Tag:          "<path>",
+	EnvKeys:      []string{"KEYSERVER_VERIFY_HOOK"},
+}
+
+// --tls-cert
+var keyserverServeTLSCertFlag = cmdline.Flag{
+	ID:           "keyserverServeTLSCertFlag",
+	Value:        &keyserverServeTLSCert,
+	DefaultValue: "",
+	Name:         "tls-cert",
+	Usage:        "PEM certificate to serve HTTPS with",
+	Tag:          "<path>",
+	EnvKeys:      []string{"KEYSERVER_TLS_CERT"},
+}
+
+// --tls-key
+var keyserverServeTLSKeyFlag = cmdline.Flag{
+	ID:           "keyserverServeTLSKeyFlag",
+	Value:        &keyserverServeTLSKey,
+	DefaultValue: "",
+	Name:         "tls-key",
+	Usage:        "PEM private key of the certificate to serve HTTPS with",
+	Tag:          "<path>",
+	EnvKeys:      []string{"KEYSERVER_TLS_KEY"},
+}
+
+// --url
+var keyserverServeURLFlag = cmdline.Flag{
+	ID:           "keyserverServeURLFlag",
+	Value:        &keyserverServeURL,
+	DefaultValue: "",
+	Name:         "url",
+	Usage:        "base URL of the verification links, when behind a reverse proxy (default: derived from requests)",
+	Tag:          "<url>",
+	EnvKeys:      []string{"KEYSERVER_URL"},
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterSubCmd(KeyserverCmd, KeyserverServeCmd)
+
+		cmdManager.RegisterFlagForCmd(&keyserverServeListenFlag, KeyserverServeCmd)
+		cmdManager.RegisterFlagForCmd(&keyserverServeDirFlag, KeyserverServeCmd)
+		cmdManager.RegisterFlagForCmd(&keyserverServeReadOnlyFlag, KeyserverServeCmd)
+		cmdManager.RegisterFlagForCmd(&keyserverServeVerifyHookFlag, KeyserverServeCmd)
+		cmdManager.RegisterFlagForCmd(&keyserverServeTLSCertFlag, KeyserverServeCmd)
+		cmdManager.RegisterFlagForCmd(&keyserverServeTLSKeyFlag, KeyserverServeCmd)
+		cmdManager.RegisterFlagForCmd(&keyserverServeURLFlag, KeyserverServeCmd)
+	})
+}
+
+// KeyserverServeCmd apptainer keyserver serve [serve options...]
+var KeyserverServeCmd = &cobra.Command{
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, _ []string) {
+		if keyserverServeReadOnly && keyserverServeVerifyHook != "" {
+			sylog.Fatalf("--read-only and --verify-hook are mutually exclusive")
+		}
+
+		s, err := keyserver.New(keyserver.Config{
+			Dir:        keyserverServeDir,
+			ReadOnly:   keyserverServeReadOnly,
+			VerifyHook: keyserverServeVerifyHook,
+			URL:        keyserverServeURL,
+		})
+		if err != nil {
+			sylog.Fatalf("Unable to open keyserver: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err = server.Serve(ctx, server.Config{
+			Addr:     keyserverServeListen,
+			CertFile: keyserverServeTLSCert,
+			KeyFile:  keyserverServeTLSKey,
+		}, "keyserver", s.Handler())
+		if err != nil {
+			sylog.Fatalf("Unable to serve keyserver: %v", err)
+		}
+	},
+
+	Use:     docs.KeyserverServeUse,
+	Short:   docs.KeyserverServeShort,
+	Long:    docs.KeyserverServeLong,
+	Example: docs.KeyserverServeExample,
+
+	DisableFlagsInUseLine: true,
+}
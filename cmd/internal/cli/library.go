@@ -0,0 +1,187 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/server"
+	"github.com/apptainer/apptainer/internal/pkg/server/library"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	libraryServeListen    string
+	libraryServeDir       string
+	libraryServeTokenFile string
+	libraryServeTLSCert   string
+	libraryServeTLSKey    string
+	libraryServeURL       string
+	libraryServePrivate   bool
+)
+
+// --listen
+var libraryServeListenFlag = cmdline.Flag{
+	ID:           "libraryServeListenFlag",
+	Value:        &libraryServeListen,
+	DefaultValue: ":8080",
+	Name:         "listen",
+	Usage:        "address to listen on",
+	Tag:          "<[host]:port>",
+	EnvKeys:      []string{"LIBRARY_LISTEN"},
+}
+
+// --dir
+var libraryServeDirFlag = cmdline.Flag{
+	ID:           "libraryServeDirFlag",
+	Value:        &libraryServeDir,
+	DefaultValue: "",
+	Name:         "dir",
+	Required:     true,
+	Usage:        "directory storing the images and their metadata (required)",
+	Tag:          "<path>",
+	EnvKeys:      []string{"LIBRARY_DIR"},
+}
+
+// --token-file
+var libraryServeTokenFileFlag = cmdline.Flag{
+	ID:           "libraryServeTokenFileFlag",
+	Value:        &libraryServeTokenFile,
+	DefaultValue: "",
+	Name:         "token-file",
+	Usage:        "file of the tokens allowed to push, tag and delete images, one per line and optionally followed by a user name",
+	Tag:          "<path>",
+	EnvKeys:      []string{"LIBRARY_TOKEN_FILE"},
+}
+
+// --tls-cert
+var libraryServeTLSCertFlag = cmdline.Flag{
+	ID:           "libraryServeTLSCertFlag",
+	Value:        &libraryServeTLSCert,
+	DefaultValue: "",
+	Name:         "tls-cert",
+	Usage:        "PEM certificate to serve HTTPS with",
+	Tag:          "<path>",
+	EnvKeys:      []string{"LIBRARY_TLS_CERT"},
+}
+
+// --tls-key
+var libraryServeTLSKeyFlag = cmdline.Flag{
+	ID:           "libraryServeTLSKeyFlag",
+	Value:        &libraryServeTLSKey,
+	DefaultValue: "",
+	Name:         "tls-key",
+	Usage:        "PEM private key of the certificate to serve HTTPS with",
+	Tag:          "<path>",
+	EnvKeys:      []string{"LIBRARY_TLS_KEY"},
+}
+
+// --url
+var libraryServeURLFlag = cmdline.Flag{
+	ID:           "libraryServeURLFlag",
+	Value:        &libraryServeURL,
+	DefaultValue: "",
+	Name:         "url",
+	Usage:        "base URL advertised to clients, when behind a reverse proxy (default: derived from requests)",
+	Tag:          "<url>",
+	EnvKeys:      []string{"LIBRARY_URL"},
+}
+
+// --private
+var libraryServePrivateFlag = cmdline.Flag{
+	ID:           "libraryServePrivateFlag",
+	Value:        &libraryServePrivate,
+	DefaultValue: false,
+	Name:         "private",
+	Usage:        "require a token to pull and search images too",
+	EnvKeys:      []string{"LIBRARY_PRIVATE"},
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(LibraryCmd)
+		cmdManager.RegisterSubCmd(LibraryCmd, LibraryServeCmd)
+
+		cmdManager.RegisterFlagForCmd(&libraryServeListenFlag, LibraryServeCmd)
+		cmdManager.RegisterFlagForCmd(&libraryServeDirFlag, LibraryServeCmd)
+		cmdManager.RegisterFlagForCmd(&libraryServeTokenFileFlag, LibraryServeCmd)
+		cmdManager.RegisterFlagForCmd(&libraryServeTLSCertFlag, LibraryServeCmd)
+		cmdManager.RegisterFlagForCmd(&libraryServeTLSKeyFlag, LibraryServeCmd)
+		cmdManager.RegisterFlagForCmd(&libraryServeURLFlag, LibraryServeCmd)
+		cmdManager.RegisterFlagForCmd(&libraryServePrivateFlag, LibraryServeCmd)
+	})
+}
+
+// LibraryCmd is the 'library' command that allows to host a library.
+var LibraryCmd = &cobra.Command{
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return errors.New("invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.LibraryUse,
+	Short:   docs.LibraryShort,
+	Long:    docs.LibraryLong,
+	Example: docs.LibraryExample,
+}
+
+// LibraryServeCmd is 'apptainer library serve' and serves a library of
+// images stored in a local directory.
+var LibraryServeCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(0),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, _ []string) {
+		cfg := library.Config{
+			Dir:     libraryServeDir,
+			URL:     libraryServeURL,
+			Private: libraryServePrivate,
+			Version: buildcfg.PACKAGE_VERSION,
+		}
+		if libraryServeTokenFile != "" {
+			tokens, err := server.ReadTokenFile(libraryServeTokenFile)
+			if err != nil {
+				sylog.Fatalf("Unable to read tokens: %v", err)
+			}
+			cfg.Tokens = tokens
+		} else if libraryServePrivate {
+			sylog.Fatalf("A private library requires a token file")
+		} else {
+			sylog.Warningf("No token file given, the library is read-only")
+		}
+
+		s, err := library.New(cfg)
+		if err != nil {
+			sylog.Fatalf("Unable to open library: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		err = server.Serve(ctx, server.Config{
+			Addr:     libraryServeListen,
+			CertFile: libraryServeTLSCert,
+			KeyFile:  libraryServeTLSKey,
+		}, "library", s.Handler())
+		if err != nil {
+			sylog.Fatalf("Unable to serve library: %v", err)
+		}
+	},
+
+	Use:     docs.LibraryServeUse,
+	Short:   docs.LibraryServeShort,
+	Long:    docs.LibraryServeLong,
+	Example: docs.LibraryServeExample,
+}
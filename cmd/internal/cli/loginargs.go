@@ -29,6 +29,7 @@ func ObtainLoginArgs(name string) *apptainer.LoginArgs {
 	loginArgs.Tokenfile = loginTokenFile
 	loginArgs.Insecure = loginInsecure
 	loginArgs.ReqAuthFile = reqAuthFile
+	loginArgs.OIDC = loginOIDC
 
 	if loginPasswordStdin {
 		p, err := io.ReadAll(os.Stdin)
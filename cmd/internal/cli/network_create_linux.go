@@ -0,0 +1,125 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	apptainernet "github.com/apptainer/apptainer/pkg/network"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+var networkCreateOpts apptainernet.ConfListOptions
+
+// --type
+var networkCreateTypeFlag = cmdline.Flag{
+	ID:           "networkCreateTypeFlag",
+	Value:        &networkCreateOpts.Type,
+	DefaultValue: apptainernet.BridgeType,
+	Name:         "type",
+	Usage:        "network type: bridge, macvlan or ipvlan",
+}
+
+// --subnet
+var networkCreateSubnetFlag = cmdline.Flag{
+	ID:           "networkCreateSubnetFlag",
+	Value:        &networkCreateOpts.Subnet,
+	DefaultValue: "",
+	Name:         "subnet",
+	Usage:        "network subnet in CIDR notation, required with host-local IPAM",
+}
+
+// --gateway
+var networkCreateGatewayFlag = cmdline.Flag{
+	ID:           "networkCreateGatewayFlag",
+	Value:        &networkCreateOpts.Gateway,
+	DefaultValue: "",
+	Name:         "gateway",
+	Usage:        "gateway address in the subnet (default: first address of the subnet)",
+}
+
+// --ip-range
+var networkCreateIPRangeFlag = cmdline.Flag{
+	ID:           "networkCreateIPRangeFlag",
+	Value:        &networkCreateOpts.IPRange,
+	DefaultValue: "",
+	Name:         "ip-range",
+	Usage:        "range of addresses allocated to containers, of the form start-end",
+}
+
+// --ipam
+var networkCreateIPAMFlag = cmdline.Flag{
+	ID:           "networkCreateIPAMFlag",
+	Value:        &networkCreateOpts.IPAM,
+	DefaultValue: "host-local",
+	Name:         "ipam",
+	Usage:        "IPAM plugin allocating container addresses: host-local or dhcp",
+}
+
+// --bridge
+var networkCreateBridgeFlag = cmdline.Flag{
+	ID:           "networkCreateBridgeFlag",
+	Value:        &networkCreateOpts.Bridge,
+	DefaultValue: "",
+	Name:         "bridge",
+	Usage:        "host bridge name for bridge networks (default: apptbr-<name>)",
+}
+
+// --parent
+var networkCreateParentFlag = cmdline.Flag{
+	ID:           "networkCreateParentFlag",
+	Value:        &networkCreateOpts.Parent,
+	DefaultValue: "",
+	Name:         "parent",
+	Usage:        "host interface for macvlan and ipvlan networks",
+}
+
+// --mode
+var networkCreateModeFlag = cmdline.Flag{
+	ID:           "networkCreateModeFlag",
+	Value:        &networkCreateOpts.Mode,
+	DefaultValue: "",
+	Name:         "mode",
+	Usage:        "macvlan mode (bridge, private, vepa, passthru) or ipvlan mode (l2, l3, l3s)",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&networkCreateTypeFlag, NetworkCreateCmd)
+		cmdManager.RegisterFlagForCmd(&networkCreateSubnetFlag, NetworkCreateCmd)
+		cmdManager.RegisterFlagForCmd(&networkCreateGatewayFlag, NetworkCreateCmd)
+		cmdManager.RegisterFlagForCmd(&networkCreateIPRangeFlag, NetworkCreateCmd)
+		cmdManager.RegisterFlagForCmd(&networkCreateIPAMFlag, NetworkCreateCmd)
+		cmdManager.RegisterFlagForCmd(&networkCreateBridgeFlag, NetworkCreateCmd)
+		cmdManager.RegisterFlagForCmd(&networkCreateParentFlag, NetworkCreateCmd)
+		cmdManager.RegisterFlagForCmd(&networkCreateModeFlag, NetworkCreateCmd)
+	})
+}
+
+// NetworkCreateCmd generates a CNI network configuration.
+//
+// apptainer network create [create options...] <name>
+var NetworkCreateCmd = &cobra.Command{
+	PreRun: CheckRoot,
+	Run: func(_ *cobra.Command, args []string) {
+		networkCreateOpts.Name = args[0]
+		if err := apptainer.CreateNetwork(networkCreateOpts); err != nil {
+			sylog.Fatalf("Failed to create network %q: %s.", args[0], err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+
+	Use:     docs.NetworkCreateUse,
+	Short:   docs.NetworkCreateShort,
+	Long:    docs.NetworkCreateLong,
+	Example: docs.NetworkCreateExample,
+}
@@ -0,0 +1,36 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// NetworkInspectCmd shows the configuration of a CNI network.
+//
+// apptainer network inspect <name>
+var NetworkInspectCmd = &cobra.Command{
+	Run: func(_ *cobra.Command, args []string) {
+		if err := apptainer.InspectNetwork(os.Stdout, args[0]); err != nil {
+			sylog.Fatalf("Failed to inspect network %q: %s.", args[0], err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+
+	Use:     docs.NetworkInspectUse,
+	Short:   docs.NetworkInspectShort,
+	Long:    docs.NetworkInspectLong,
+	Example: docs.NetworkInspectExample,
+}
@@ -0,0 +1,45 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(NetworkCmd)
+		cmdManager.RegisterSubCmd(NetworkCmd, NetworkListCmd)
+		cmdManager.RegisterSubCmd(NetworkCmd, NetworkInspectCmd)
+		cmdManager.RegisterSubCmd(NetworkCmd, NetworkCreateCmd)
+		cmdManager.RegisterSubCmd(NetworkCmd, NetworkRemoveCmd)
+	})
+}
+
+// NetworkCmd is the root command for all CNI network configuration
+// related functionality which is exposed via the CLI.
+//
+// apptainer network [...]
+var NetworkCmd = &cobra.Command{
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return errors.New("invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:           docs.NetworkUse,
+	Short:         docs.NetworkShort,
+	Long:          docs.NetworkLong,
+	Example:       docs.NetworkExample,
+	Aliases:       []string{"networks"},
+	SilenceErrors: true,
+}
@@ -0,0 +1,55 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/app/apptainer"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// -f|--force
+var networkRemoveForce bool
+
+var networkRemoveForceFlag = cmdline.Flag{
+	ID:           "networkRemoveForceFlag",
+	Value:        &networkRemoveForce,
+	DefaultValue: false,
+	Name:         "force",
+	ShortHand:    "f",
+	Usage:        "remove the network even if running instances are attached to it",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&networkRemoveForceFlag, NetworkRemoveCmd)
+	})
+}
+
+// NetworkRemoveCmd removes a CNI network configuration.
+//
+// apptainer network remove [remove options...] <name>
+var NetworkRemoveCmd = &cobra.Command{
+	PreRun: CheckRoot,
+	Run: func(_ *cobra.Command, args []string) {
+		if err := apptainer.RemoveNetwork(args[0], networkRemoveForce); err != nil {
+			sylog.Fatalf("Failed to remove network %q: %s.", args[0], err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+
+	Use:     docs.NetworkRemoveUse,
+	Short:   docs.NetworkRemoveShort,
+	Long:    docs.NetworkRemoveLong,
+	Example: docs.NetworkRemoveExample,
+	Aliases: []string{"rm"},
+}
@@ -17,10 +17,12 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	sifsignature "github.com/apptainer/apptainer/internal/pkg/signature"
 	"github.com/apptainer/apptainer/internal/pkg/sypgp"
@@ -107,7 +109,7 @@ func decryptPrivateKeyInteractive(e *openpgp.Entity) error {
 		return err
 	}
 
-	return e.PrivateKey.Decrypt([]byte(passphrase))
+	return e.DecryptPrivateKeys([]byte(passphrase))
 }
 
 // primaryIdentity returns the Identity marked as primary, or the first identity if none are so
@@ -171,6 +173,11 @@ func outputVerify(_ *sif.FileImage, r integrity.VerifyResult) bool {
 
 		// Always print fingerprint.
 		fmt.Printf("%-18v Fingerprint: %X\n", prefix, e.PrimaryKey.Fingerprint)
+
+		// Print why the key was rejected, if applicable.
+		if status := keyStatus(e, r.Error()); status != "" {
+			fmt.Printf("%-18v Key status: %v\n", prefix, status)
+		}
 	}
 
 	// Print table of signed objects.
@@ -204,6 +211,21 @@ func outputVerify(_ *sif.FileImage, r integrity.VerifyResult) bool {
 	return false
 }
 
+// keyStatus returns why the key of signing entity e was rejected with the verification error err,
+// or an empty string if it wasn't rejected for being revoked or expired.
+func keyStatus(e *openpgp.Entity, err error) string {
+	switch {
+	case errors.Is(err, pgperrors.ErrKeyRevoked):
+		return "revoked"
+	case errors.Is(err, pgperrors.ErrKeyExpired):
+		if t, ok := sypgp.KeyExpiry(e); ok {
+			return fmt.Sprintf("expired on %s", t.Format(time.DateOnly))
+		}
+		return "expired"
+	}
+	return ""
+}
+
 type key struct {
 	Signer keyEntity
 }
@@ -222,6 +244,11 @@ type keyEntity struct {
 type keyList struct {
 	Signatures int
 	SignerKeys []*key
+	// Threshold, Satisfied and Missing report the required fingerprints
+	// of verify --fingerprint.
+	Threshold int      `json:",omitempty"`
+	Satisfied []string `json:",omitempty"`
+	Missing   []string `json:",omitempty"`
 }
 
 // getJSONCallback returns a signature.VerifyCallback that appends to kl.
@@ -0,0 +1,115 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/apptainer/apptainer/internal/pkg/pkcs11"
+	"github.com/apptainer/apptainer/internal/pkg/util/interactive"
+	"github.com/apptainer/apptainer/pkg/cmdline"
+	"github.com/spf13/cobra"
+)
+
+// pkcs11PINEnv is the environment variable holding the PIN of the PKCS#11
+// token, it's not a flag to keep the PIN out of the process list.
+const pkcs11PINEnv = "APPTAINER_PKCS11_PIN"
+
+var (
+	pkcs11Module     string // --pkcs11-module flag
+	pkcs11TokenLabel string // --pkcs11-token flag
+	pkcs11Slot       uint32 // --pkcs11-slot flag
+	pkcs11KeyLabel   string // --pkcs11-key flag
+)
+
+// --pkcs11-module
+var pkcs11ModuleFlag = cmdline.Flag{
+	ID:           "pkcs11ModuleFlag",
+	Value:        &pkcs11Module,
+	DefaultValue: "",
+	Name:         "pkcs11-module",
+	Usage:        "path to the PKCS#11 module library of the token holding the key",
+	EnvKeys:      []string{"PKCS11_MODULE"},
+}
+
+// --pkcs11-token
+var pkcs11TokenFlag = cmdline.Flag{
+	ID:           "pkcs11TokenFlag",
+	Value:        &pkcs11TokenLabel,
+	DefaultValue: "",
+	Name:         "pkcs11-token",
+	Usage:        "label of the PKCS#11 token holding the key",
+	EnvKeys:      []string{"PKCS11_TOKEN"},
+}
+
+// --pkcs11-slot
+var pkcs11SlotFlag = cmdline.Flag{
+	ID:           "pkcs11SlotFlag",
+	Value:        &pkcs11Slot,
+	DefaultValue: uint32(0),
+	Name:         "pkcs11-slot",
+	Usage:        "slot ID of the PKCS#11 token holding the key, when --pkcs11-token is not set",
+	EnvKeys:      []string{"PKCS11_SLOT"},
+}
+
+// --pkcs11-key
+var pkcs11KeyFlag = cmdline.Flag{
+	ID:           "pkcs11KeyFlag",
+	Value:        &pkcs11KeyLabel,
+	DefaultValue: "",
+	Name:         "pkcs11-key",
+	Usage:        "label of the key, or certificate, on the PKCS#11 token",
+	EnvKeys:      []string{"PKCS11_KEY"},
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&pkcs11ModuleFlag, SignCmd, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&pkcs11TokenFlag, SignCmd, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&pkcs11SlotFlag, SignCmd, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&pkcs11KeyFlag, SignCmd, VerifyCmd)
+	})
+}
+
+// openPKCS11Token opens the PKCS#11 token set by the --pkcs11-* flags. When
+// login is true, the user is logged in with the PIN of APPTAINER_PKCS11_PIN,
+// or prompted for it.
+func openPKCS11Token(cmd *cobra.Command, login bool) (*pkcs11.Token, error) {
+	if pkcs11KeyLabel == "" {
+		return nil, fmt.Errorf("--pkcs11-key is required with --pkcs11-module")
+	}
+
+	c := pkcs11.Config{
+		Module:     pkcs11Module,
+		TokenLabel: pkcs11TokenLabel,
+		KeyLabel:   pkcs11KeyLabel,
+	}
+	if cmd.Flag(pkcs11SlotFlag.Name).Changed {
+		slot := uint(pkcs11Slot)
+		c.Slot = &slot
+	}
+
+	if login {
+		pin, ok := os.LookupEnv(pkcs11PINEnv)
+		if !ok {
+			var err error
+			pin, err = interactive.AskQuestionNoEcho("Enter PKCS#11 token PIN: ")
+			if err != nil {
+				return nil, err
+			}
+		}
+		if pin == "" {
+			return nil, fmt.Errorf("PKCS#11 token PIN is required to sign")
+		}
+		c.PIN = pin
+	}
+
+	return pkcs11.Open(c)
+}
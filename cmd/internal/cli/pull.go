@@ -67,6 +67,8 @@ var (
 	pullReproducible bool
 	// pullSandbox indicates whether pulling images as sandbox format
 	pullSandbox bool
+	// pullVerifyKeyPath is the public key verifying the signature of registry images before pulling them.
+	pullVerifyKeyPath string
 )
 
 // --arch
@@ -175,6 +177,16 @@ var pullSandboxFlag = cmdline.Flag{
 	EnvKeys:      []string{"SANDBOX"},
 }
 
+// --verify-key
+var pullVerifyKeyFlag = cmdline.Flag{
+	ID:           "pullVerifyKeyFlag",
+	Value:        &pullVerifyKeyPath,
+	DefaultValue: "",
+	Name:         "verify-key",
+	Usage:        "path to the public key verifying the signature of docker:// and oras:// images before they are pulled",
+	EnvKeys:      []string{"PULL_VERIFY_KEY"},
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(PullCmd)
@@ -201,6 +213,7 @@ func init() {
 
 		cmdManager.RegisterFlagForCmd(&pullReproducibleFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&pullSandboxFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullVerifyKeyFlag, PullCmd)
 	})
 }
 
@@ -252,6 +265,10 @@ func pullRun(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if cmd.Flag(pullVerifyKeyFlag.Name).Changed {
+		pullFrom = verifyRegistryPull(cmd, pullFrom, pullVerifyKeyPath)
+	}
+
 	switch transport {
 	case LibraryProtocol:
 		ref, err := library.NormalizeLibraryRef(pullFrom)
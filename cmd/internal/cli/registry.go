@@ -59,6 +59,16 @@ var registryLoginPasswordStdinFlag = cmdline.Flag{
 	Usage:        "take password from standard input",
 }
 
+// --oidc
+var registryLoginOIDCFlag = cmdline.Flag{
+	ID:           "registryLoginOIDCFlag",
+	Value:        &loginOIDC,
+	DefaultValue: false,
+	Name:         "oidc",
+	Usage:        "log in with an access token from the OIDC provider of the default remote, refreshing it automatically",
+	EnvKeys:      []string{"LOGIN_OIDC"},
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(RegistryCmd)
@@ -72,6 +82,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&registryLoginUsernameFlag, RegistryLoginCmd)
 		cmdManager.RegisterFlagForCmd(&registryLoginPasswordFlag, RegistryLoginCmd)
 		cmdManager.RegisterFlagForCmd(&registryLoginPasswordStdinFlag, RegistryLoginCmd)
+		cmdManager.RegisterFlagForCmd(&registryLoginOIDCFlag, RegistryLoginCmd)
 		cmdManager.RegisterFlagForCmd(&commonAuthFileFlag, RegistryLoginCmd)
 		cmdManager.RegisterFlagForCmd(&commonAuthFileFlag, RegistryLogoutCmd)
 	})
@@ -39,6 +39,7 @@ var (
 	remoteKeyserverInsecure bool
 	loginPasswordStdin      bool
 	loginInsecure           bool
+	loginOIDC               bool
 	remoteNoLogin           bool
 	global                  bool
 	remoteUseExclusive      bool
@@ -129,6 +130,16 @@ var remoteLoginInsecureFlag = cmdline.Flag{
 	EnvKeys:      []string{"LOGIN_INSECURE"},
 }
 
+// --oidc
+var remoteLoginOIDCFlag = cmdline.Flag{
+	ID:           "remoteLoginOIDCFlag",
+	Value:        &loginOIDC,
+	DefaultValue: false,
+	Name:         "oidc",
+	Usage:        "log in with the OIDC provider of the remote, refreshing the access token automatically",
+	EnvKeys:      []string{"LOGIN_OIDC"},
+}
+
 // -e|--exclusive
 var remoteUseExclusiveFlag = cmdline.Flag{
 	ID:           "remoteUseExclusiveFlag",
@@ -210,6 +221,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&remoteLoginPasswordFlag, RemoteLoginCmd)
 		cmdManager.RegisterFlagForCmd(&remoteLoginPasswordStdinFlag, RemoteLoginCmd)
 		cmdManager.RegisterFlagForCmd(&remoteLoginInsecureFlag, RemoteLoginCmd)
+		cmdManager.RegisterFlagForCmd(&remoteLoginOIDCFlag, RemoteLoginCmd)
 
 		cmdManager.RegisterFlagForCmd(&remoteUseExclusiveFlag, RemoteUseCmd)
 
@@ -393,6 +405,7 @@ var RemoteLoginCmd = &cobra.Command{
 		loginArgs.Tokenfile = loginTokenFile
 		loginArgs.Insecure = loginInsecure
 		loginArgs.ReqAuthFile = reqAuthFile
+		loginArgs.OIDC = loginOIDC
 
 		if loginPasswordStdin {
 			p, err := io.ReadAll(os.Stdin)
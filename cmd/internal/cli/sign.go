@@ -13,7 +13,10 @@ import (
 	"crypto"
 
 	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/pkg/gpgagent"
+	"github.com/apptainer/apptainer/internal/pkg/pkcs11"
 	sifsignature "github.com/apptainer/apptainer/internal/pkg/signature"
+	"github.com/apptainer/apptainer/internal/pkg/sshsig"
 	"github.com/apptainer/apptainer/internal/pkg/sypgp"
 	"github.com/apptainer/apptainer/pkg/cmdline"
 	"github.com/apptainer/apptainer/pkg/sylog"
@@ -24,8 +27,11 @@ import (
 
 var (
 	priKeyPath string
+	sshKeyPath string
 	priKeyIdx  int
 	signAll    bool
+	signTSAURL string
+	agentKeyID string
 )
 
 // -g|--group-id
@@ -78,6 +84,36 @@ var signPrivateKeyFlag = cmdline.Flag{
 	EnvKeys:      []string{"SIGN_KEY"},
 }
 
+// --ssh-key
+var signSSHKeyFlag = cmdline.Flag{
+	ID:           "signSSHKeyFlag",
+	Value:        &sshKeyPath,
+	DefaultValue: "",
+	Name:         "ssh-key",
+	Usage:        "path to the SSH private key file, or public key file of a key held by ssh-agent",
+	EnvKeys:      []string{"SIGN_SSH_KEY"},
+}
+
+// --gpg-agent-key
+var signGPGAgentKeyFlag = cmdline.Flag{
+	ID:           "signGPGAgentKeyFlag",
+	Value:        &agentKeyID,
+	DefaultValue: "",
+	Name:         "gpg-agent-key",
+	Usage:        "fingerprint or keygrip of the PGP key to sign with through gpg-agent",
+	EnvKeys:      []string{"SIGN_GPG_AGENT_KEY"},
+}
+
+// --tsa
+var signTSAFlag = cmdline.Flag{
+	ID:           "signTSAFlag",
+	Value:        &signTSAURL,
+	DefaultValue: "",
+	Name:         "tsa",
+	Usage:        "URL of an RFC 3161 Time Stamping Authority to timestamp the signature(s)",
+	EnvKeys:      []string{"SIGN_TSA"},
+}
+
 // -k|--keyidx
 var signKeyIdxFlag = cmdline.Flag{
 	ID:           "signKeyIdxFlag",
@@ -108,6 +144,9 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&signSifDescSifIDFlag, SignCmd)
 		cmdManager.RegisterFlagForCmd(&signSifDescIDFlag, SignCmd)
 		cmdManager.RegisterFlagForCmd(&signPrivateKeyFlag, SignCmd)
+		cmdManager.RegisterFlagForCmd(&signSSHKeyFlag, SignCmd)
+		cmdManager.RegisterFlagForCmd(&signGPGAgentKeyFlag, SignCmd)
+		cmdManager.RegisterFlagForCmd(&signTSAFlag, SignCmd)
 		cmdManager.RegisterFlagForCmd(&signKeyIdxFlag, SignCmd)
 		cmdManager.RegisterFlagForCmd(&signAllFlag, SignCmd)
 	})
@@ -132,6 +171,23 @@ var SignCmd = &cobra.Command{
 func doSignCmd(cmd *cobra.Command, cpath string) {
 	var opts []sifsignature.SignOpt
 
+	keyFlags := 0
+	for _, f := range []string{signPrivateKeyFlag.Name, signSSHKeyFlag.Name, pkcs11ModuleFlag.Name, signGPGAgentKeyFlag.Name} {
+		if cmd.Flag(f).Changed {
+			keyFlags++
+		}
+	}
+	if keyFlags > 1 {
+		sylog.Fatalf("only one of --key, --ssh-key, --pkcs11-module and --gpg-agent-key can be used")
+	}
+	if isRegistryImage(cpath) {
+		doSignRegistryCmd(cmd, cpath)
+		return
+	}
+	if cmd.Flag(signTSAFlag.Name).Changed && (keyFlags == 0 || cmd.Flag(signGPGAgentKeyFlag.Name).Changed) {
+		sylog.Fatalf("--tsa requires --key, --ssh-key or --pkcs11-module, PGP signatures can't be timestamped")
+	}
+
 	// Set key material.
 	switch {
 	case cmd.Flag(signPrivateKeyFlag.Name).Changed:
@@ -143,6 +199,44 @@ func doSignCmd(cmd *cobra.Command, cpath string) {
 		}
 		opts = append(opts, sifsignature.OptSignWithSigner(s))
 
+	case cmd.Flag(signSSHKeyFlag.Name).Changed:
+		sylog.Infof("Signing image with SSH key material from '%v'", sshKeyPath)
+
+		passphrase := func() ([]byte, error) {
+			return cryptoutils.GetPasswordFromStdIn(false)
+		}
+		s, closeAgent, err := sshsig.LoadSigner(sshKeyPath, passphrase)
+		if err != nil {
+			sylog.Fatalf("Failed to load SSH key material: %v", err)
+		}
+		defer closeAgent()
+		opts = append(opts, sifsignature.OptSignWithSSHSigner(s))
+
+	case cmd.Flag(pkcs11ModuleFlag.Name).Changed:
+		sylog.Infof("Signing image with PKCS#11 key '%v'", pkcs11KeyLabel)
+
+		t, err := openPKCS11Token(cmd, true)
+		if err != nil {
+			sylog.Fatalf("Failed to open PKCS#11 token: %v", err)
+		}
+		defer t.Close()
+
+		s, err := pkcs11.NewSigner(t, pkcs11KeyLabel)
+		if err != nil {
+			sylog.Fatalf("Failed to load PKCS#11 key material: %v", err)
+		}
+		opts = append(opts, sifsignature.OptSignWithSigner(s))
+
+	case cmd.Flag(signGPGAgentKeyFlag.Name).Changed:
+		sylog.Infof("Signing image with PGP key '%v' through gpg-agent", agentKeyID)
+
+		c, err := gpgagent.Connect()
+		if err != nil {
+			sylog.Fatalf("Failed to connect to gpg-agent: %v", err)
+		}
+		defer c.Close()
+		opts = append(opts, sifsignature.OptSignWithGPGAgent(c, agentKeyID))
+
 	default:
 		sylog.Infof("Signing image with PGP key material")
 
@@ -167,6 +261,11 @@ func doSignCmd(cmd *cobra.Command, cpath string) {
 		opts = append(opts, sifsignature.OptSignObjects(sifDescID))
 	}
 
+	// Set timestamp option, if applicable.
+	if cmd.Flag(signTSAFlag.Name).Changed {
+		opts = append(opts, sifsignature.OptSignWithTSA(signTSAURL))
+	}
+
 	// Sign the image.
 	if err := sifsignature.Sign(cmd.Context(), cpath, opts...); err != nil {
 		sylog.Fatalf("Failed to sign container: %v", err)
@@ -0,0 +1,66 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/sigstore"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+// doVerifySigstoreCmd verifies the image cpath with the Sigstore bundle of
+// --sigstore-bundle, offline against the trusted root of --trusted-root.
+func doVerifySigstoreCmd(cmd *cobra.Command, cpath string) {
+	for _, f := range []string{
+		verifyPublicKeyFlag.Name, verifyCertificateFlag.Name, verifyAllowedSignersFlag.Name, pkcs11ModuleFlag.Name,
+		verifyFingerprintFlag.Name, verifyTSARootsFlag.Name, verifySifGroupIDFlag.Name, verifySifDescSifIDFlag.Name,
+		verifyJSONFlag.Name,
+	} {
+		if cmd.Flag(f).Changed {
+			sylog.Fatalf("--%s can't be used with --sigstore-bundle", f)
+		}
+	}
+	if trustedRootPath == "" {
+		sylog.Fatalf("--sigstore-bundle requires --trusted-root")
+	}
+	if certificateIdentity == "" || certificateOIDCIssuer == "" {
+		sylog.Fatalf("--sigstore-bundle requires --certificate-identity and --certificate-oidc-issuer")
+	}
+
+	sylog.Infof("Verifying image with Sigstore bundle '%v'", sigstoreBundlePath)
+
+	tr, err := sigstore.LoadTrustedRoot(trustedRootPath)
+	if err != nil {
+		sylog.Fatalf("Failed to load trusted root: %v", err)
+	}
+	b, err := sigstore.LoadBundle(sigstoreBundlePath)
+	if err != nil {
+		sylog.Fatalf("Failed to load Sigstore bundle: %v", err)
+	}
+
+	f, err := os.Open(cpath)
+	if err != nil {
+		sylog.Fatalf("Failed to open image: %v", err)
+	}
+	defer f.Close()
+
+	r, err := sigstore.Verify(b, f, tr, sigstore.Identity{
+		SubjectAlternativeName: certificateIdentity,
+		Issuer:                 certificateOIDCIssuer,
+	})
+	if err != nil {
+		sylog.Fatalf("Failed to verify container: %v", err)
+	}
+	sylog.Infof("Signed by %q (issuer %q), logged at index %d on %s",
+		certificateIdentity, certificateOIDCIssuer, r.LogIndex, r.IntegratedTime.UTC().Format(time.RFC3339))
+	sylog.Infof("Verified signature(s) from image '%v'", cpath)
+}
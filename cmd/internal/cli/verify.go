@@ -12,11 +12,16 @@ package cli
 
 import (
 	"crypto"
+	"crypto/x509"
+	"errors"
 	"os"
+	"strings"
 
 	"github.com/apptainer/apptainer/docs"
+	"github.com/apptainer/apptainer/internal/pkg/pkcs11"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	sifsignature "github.com/apptainer/apptainer/internal/pkg/signature"
+	"github.com/apptainer/apptainer/internal/pkg/sshsig"
 	"github.com/apptainer/apptainer/pkg/cmdline"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/sigstore/sigstore/pkg/signature"
@@ -30,11 +35,20 @@ var (
 	certificateIntermediatesPath string // --certificate-intermediates flag
 	certificateRootsPath         string // --certificate-roots flag
 	ocspVerify                   bool   // --ocsp-verify flag
+	tsaRootsPath                 string // --tsa-roots flag
 	pubKeyPath                   string // --key flag
 	localVerify                  bool   // -l flag
 	jsonVerify                   bool   // -j flag
 	verifyAll                    bool
 	verifyLegacy                 bool
+	verifyFingerprints           []string // --fingerprint flag
+	verifyThreshold              int      // --threshold flag
+	allowedSignersPath           string   // --allowed-signers flag
+	verifyPrincipal              string   // --principal flag
+	sigstoreBundlePath           string   // --sigstore-bundle flag
+	trustedRootPath              string   // --trusted-root flag
+	certificateIdentity          string   // --certificate-identity flag
+	certificateOIDCIssuer        string   // --certificate-oidc-issuer flag
 )
 
 // -u|--url
@@ -128,6 +142,16 @@ var verifyOCSPFlag = cmdline.Flag{
 	EnvKeys:      []string{"VERIFY_OCSP"},
 }
 
+// --tsa-roots
+var verifyTSARootsFlag = cmdline.Flag{
+	ID:           "verifyTSARootsFlag",
+	Value:        &tsaRootsPath,
+	DefaultValue: "",
+	Name:         "tsa-roots",
+	Usage:        "path to pool of root certificates of Time Stamping Authorities, to verify certificates at the timestamped time of signatures",
+	EnvKeys:      []string{"VERIFY_TSA_ROOTS"},
+}
+
 // --key
 var verifyPublicKeyFlag = cmdline.Flag{
 	ID:           "publicKeyFlag",
@@ -138,6 +162,66 @@ var verifyPublicKeyFlag = cmdline.Flag{
 	EnvKeys:      []string{"VERIFY_KEY"},
 }
 
+// --allowed-signers
+var verifyAllowedSignersFlag = cmdline.Flag{
+	ID:           "verifyAllowedSignersFlag",
+	Value:        &allowedSignersPath,
+	DefaultValue: "",
+	Name:         "allowed-signers",
+	Usage:        "path to an OpenSSH allowed signers file of SSH keys",
+	EnvKeys:      []string{"VERIFY_ALLOWED_SIGNERS"},
+}
+
+// --principal
+var verifyPrincipalFlag = cmdline.Flag{
+	ID:           "verifyPrincipalFlag",
+	Value:        &verifyPrincipal,
+	DefaultValue: "",
+	Name:         "principal",
+	Usage:        "require the SSH signer to be allowed as this principal (with --allowed-signers)",
+	EnvKeys:      []string{"VERIFY_PRINCIPAL"},
+}
+
+// --sigstore-bundle
+var verifySigstoreBundleFlag = cmdline.Flag{
+	ID:           "verifySigstoreBundleFlag",
+	Value:        &sigstoreBundlePath,
+	DefaultValue: "",
+	Name:         "sigstore-bundle",
+	Usage:        "path to a Sigstore bundle of the image, verified offline against --trusted-root",
+	EnvKeys:      []string{"VERIFY_SIGSTORE_BUNDLE"},
+}
+
+// --trusted-root
+var verifyTrustedRootFlag = cmdline.Flag{
+	ID:           "verifyTrustedRootFlag",
+	Value:        &trustedRootPath,
+	DefaultValue: "",
+	Name:         "trusted-root",
+	Usage:        "path to a Sigstore trusted root JSON file of certificate authorities and transparency logs (with --sigstore-bundle)",
+	EnvKeys:      []string{"VERIFY_TRUSTED_ROOT"},
+}
+
+// --certificate-identity
+var verifyCertificateIdentityFlag = cmdline.Flag{
+	ID:           "verifyCertificateIdentityFlag",
+	Value:        &certificateIdentity,
+	DefaultValue: "",
+	Name:         "certificate-identity",
+	Usage:        "require the signing certificate to be issued to this email address or URI (with --sigstore-bundle)",
+	EnvKeys:      []string{"VERIFY_CERTIFICATE_IDENTITY"},
+}
+
+// --certificate-oidc-issuer
+var verifyCertificateOIDCIssuerFlag = cmdline.Flag{
+	ID:           "verifyCertificateOIDCIssuerFlag",
+	Value:        &certificateOIDCIssuer,
+	DefaultValue: "",
+	Name:         "certificate-oidc-issuer",
+	Usage:        "require the signing certificate identity to be authenticated by this OIDC issuer (with --sigstore-bundle)",
+	EnvKeys:      []string{"VERIFY_CERTIFICATE_OIDC_ISSUER"},
+}
+
 // -l|--local
 var verifyLocalFlag = cmdline.Flag{
 	ID:           "verifyLocalFlag",
@@ -178,6 +262,26 @@ var verifyLegacyFlag = cmdline.Flag{
 	Usage:        "enable verification of (insecure) legacy signatures",
 }
 
+// --fingerprint
+var verifyFingerprintFlag = cmdline.Flag{
+	ID:           "verifyFingerprintFlag",
+	Value:        &verifyFingerprints,
+	DefaultValue: []string{},
+	Name:         "fingerprint",
+	Usage:        "require a signature by the PGP key with this fingerprint (can be specified multiple times)",
+	EnvKeys:      []string{"VERIFY_FINGERPRINTS"},
+}
+
+// --threshold
+var verifyThresholdFlag = cmdline.Flag{
+	ID:           "verifyThresholdFlag",
+	Value:        &verifyThreshold,
+	DefaultValue: 0,
+	Name:         "threshold",
+	Usage:        "number of --fingerprint keys required to sign the image (default all)",
+	EnvKeys:      []string{"VERIFY_THRESHOLD"},
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(VerifyCmd)
@@ -191,11 +295,20 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&verifyCertificateIntermediatesFlag, VerifyCmd)
 		cmdManager.RegisterFlagForCmd(&verifyCertificateRootsFlag, VerifyCmd)
 		cmdManager.RegisterFlagForCmd(&verifyOCSPFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyTSARootsFlag, VerifyCmd)
 		cmdManager.RegisterFlagForCmd(&verifyPublicKeyFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyAllowedSignersFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyPrincipalFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifySigstoreBundleFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyTrustedRootFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyCertificateIdentityFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyCertificateOIDCIssuerFlag, VerifyCmd)
 		cmdManager.RegisterFlagForCmd(&verifyLocalFlag, VerifyCmd)
 		cmdManager.RegisterFlagForCmd(&verifyJSONFlag, VerifyCmd)
 		cmdManager.RegisterFlagForCmd(&verifyAllFlag, VerifyCmd)
 		cmdManager.RegisterFlagForCmd(&verifyLegacyFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyFingerprintFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyThresholdFlag, VerifyCmd)
 	})
 }
 
@@ -216,8 +329,39 @@ var VerifyCmd = &cobra.Command{
 }
 
 func doVerifyCmd(cmd *cobra.Command, cpath string) {
+	if isRegistryImage(cpath) {
+		doVerifyRegistryCmd(cmd, cpath)
+		return
+	}
+	if cmd.Flag(verifySigstoreBundleFlag.Name).Changed {
+		doVerifySigstoreCmd(cmd, cpath)
+		return
+	}
+
 	var opts []sifsignature.VerifyOpt
 
+	if len(verifyFingerprints) > 0 {
+		if cmd.Flag(verifyCertificateFlag.Name).Changed || cmd.Flag(verifyPublicKeyFlag.Name).Changed ||
+			cmd.Flag(verifyAllowedSignersFlag.Name).Changed || cmd.Flag(pkcs11ModuleFlag.Name).Changed {
+			sylog.Fatalf("--fingerprint requires PGP key material, it can't be used with --certificate, --key, --allowed-signers or --pkcs11-module")
+		}
+		if verifyThreshold < 0 || verifyThreshold > len(verifyFingerprints) {
+			sylog.Fatalf("--threshold must be a positive number not exceeding the number of --fingerprint keys (%d)", len(verifyFingerprints))
+		}
+		opts = append(opts, sifsignature.OptVerifyThreshold(verifyThreshold))
+	} else if cmd.Flag(verifyThresholdFlag.Name).Changed {
+		sylog.Fatalf("--threshold requires at least one --fingerprint")
+	}
+
+	if cmd.Flag(verifyPrincipalFlag.Name).Changed && !cmd.Flag(verifyAllowedSignersFlag.Name).Changed {
+		sylog.Fatalf("--principal requires --allowed-signers")
+	}
+
+	if cmd.Flag(verifyTSARootsFlag.Name).Changed &&
+		!cmd.Flag(verifyCertificateFlag.Name).Changed && !cmd.Flag(pkcs11ModuleFlag.Name).Changed {
+		sylog.Fatalf("--tsa-roots requires a certificate, with --certificate or --pkcs11-module")
+	}
+
 	switch {
 	case cmd.Flag(verifyCertificateFlag.Name).Changed:
 		sylog.Infof("Verifying image with key material from certificate '%v'", certificatePath)
@@ -226,27 +370,7 @@ func doVerifyCmd(cmd *cobra.Command, cpath string) {
 		if err != nil {
 			sylog.Fatalf("Failed to load certificate: %v", err)
 		}
-		opts = append(opts, sifsignature.OptVerifyWithCertificate(c))
-
-		if cmd.Flag(verifyCertificateIntermediatesFlag.Name).Changed {
-			p, err := loadCertificatePool(certificateIntermediatesPath)
-			if err != nil {
-				sylog.Fatalf("Failed to load intermediate certificates: %v", err)
-			}
-			opts = append(opts, sifsignature.OptVerifyWithIntermediates(p))
-		}
-
-		if cmd.Flag(verifyCertificateRootsFlag.Name).Changed {
-			p, err := loadCertificatePool(certificateRootsPath)
-			if err != nil {
-				sylog.Fatalf("Failed to load root certificates: %v", err)
-			}
-			opts = append(opts, sifsignature.OptVerifyWithRoots(p))
-		}
-
-		if cmd.Flag(verifyOCSPFlag.Name).Changed {
-			opts = append(opts, sifsignature.OptVerifyWithOCSP())
-		}
+		opts = append(opts, certificateVerifyOpts(cmd, c)...)
 
 	case cmd.Flag(verifyPublicKeyFlag.Name).Changed:
 		sylog.Infof("Verifying image with key material from '%v'", pubKeyPath)
@@ -257,6 +381,20 @@ func doVerifyCmd(cmd *cobra.Command, cpath string) {
 		}
 		opts = append(opts, sifsignature.OptVerifyWithVerifier(v))
 
+	case cmd.Flag(pkcs11ModuleFlag.Name).Changed:
+		sylog.Infof("Verifying image with PKCS#11 key material '%v'", pkcs11KeyLabel)
+
+		opts = append(opts, pkcs11VerifyOpts(cmd)...)
+
+	case cmd.Flag(verifyAllowedSignersFlag.Name).Changed:
+		sylog.Infof("Verifying image with SSH allowed signers from '%v'", allowedSignersPath)
+
+		as, err := sshsig.LoadAllowedSigners(allowedSignersPath)
+		if err != nil {
+			sylog.Fatalf("Failed to load allowed signers: %v", err)
+		}
+		opts = append(opts, sifsignature.OptVerifyWithAllowedSigners(as, verifyPrincipal))
+
 	default:
 		sylog.Infof("Verifying image with PGP key material")
 
@@ -268,7 +406,10 @@ func doVerifyCmd(cmd *cobra.Command, cpath string) {
 			if err != nil {
 				sylog.Fatalf("Error while getting keyserver client config: %v", err)
 			}
-			opts = append(opts, sifsignature.OptVerifyWithPGP(co...))
+			opts = append(opts,
+				sifsignature.OptVerifyWithPGP(co...),
+				sifsignature.OptVerifyWithWKD(),
+			)
 		}
 	}
 
@@ -298,7 +439,10 @@ func doVerifyCmd(cmd *cobra.Command, cpath string) {
 
 		opts = append(opts, sifsignature.OptVerifyCallback(getJSONCallback(&kl)))
 
-		verifyErr := sifsignature.Verify(cmd.Context(), cpath, opts...)
+		r, verifyErr := verifyImage(cmd, cpath, opts)
+		kl.Threshold = r.Threshold
+		kl.Satisfied = r.Satisfied
+		kl.Missing = r.Missing
 
 		// Always output JSON.
 		if err := outputJSON(os.Stdout, kl); err != nil {
@@ -311,10 +455,107 @@ func doVerifyCmd(cmd *cobra.Command, cpath string) {
 	} else {
 		opts = append(opts, sifsignature.OptVerifyCallback(outputVerify))
 
-		if err := sifsignature.Verify(cmd.Context(), cpath, opts...); err != nil {
+		r, err := verifyImage(cmd, cpath, opts)
+		var te *sifsignature.ThresholdError
+		if errors.As(err, &te) {
+			outputSigners(te.SignersResult)
+		}
+		if err != nil {
 			sylog.Fatalf("Failed to verify container: %v", err)
 		}
+		outputSigners(r)
 
 		sylog.Infof("Verified signature(s) from image '%v'", cpath)
 	}
 }
+
+// certificateVerifyOpts returns the options to verify with the certificate
+// c, and the certificate chain, OCSP and TSA flags.
+func certificateVerifyOpts(cmd *cobra.Command, c *x509.Certificate) []sifsignature.VerifyOpt {
+	opts := []sifsignature.VerifyOpt{sifsignature.OptVerifyWithCertificate(c)}
+
+	if cmd.Flag(verifyCertificateIntermediatesFlag.Name).Changed {
+		p, err := loadCertificatePool(certificateIntermediatesPath)
+		if err != nil {
+			sylog.Fatalf("Failed to load intermediate certificates: %v", err)
+		}
+		opts = append(opts, sifsignature.OptVerifyWithIntermediates(p))
+	}
+
+	if cmd.Flag(verifyCertificateRootsFlag.Name).Changed {
+		p, err := loadCertificatePool(certificateRootsPath)
+		if err != nil {
+			sylog.Fatalf("Failed to load root certificates: %v", err)
+		}
+		opts = append(opts, sifsignature.OptVerifyWithRoots(p))
+	}
+
+	if cmd.Flag(verifyOCSPFlag.Name).Changed {
+		opts = append(opts, sifsignature.OptVerifyWithOCSP())
+	}
+
+	if cmd.Flag(verifyTSARootsFlag.Name).Changed {
+		p, err := loadCertificatePool(tsaRootsPath)
+		if err != nil {
+			sylog.Fatalf("Failed to load TSA root certificates: %v", err)
+		}
+		opts = append(opts, sifsignature.OptVerifyWithTSARoots(p))
+	}
+	return opts
+}
+
+// pkcs11VerifyOpts returns the options to verify with the certificate of the
+// --pkcs11-key label on the token, or its public key when the token doesn't
+// hold a certificate with this label.
+func pkcs11VerifyOpts(cmd *cobra.Command) []sifsignature.VerifyOpt {
+	t, err := openPKCS11Token(cmd, false)
+	if err != nil {
+		sylog.Fatalf("Failed to open PKCS#11 token: %v", err)
+	}
+	defer t.Close()
+
+	c, err := t.Certificate(pkcs11KeyLabel)
+	if err == nil {
+		return certificateVerifyOpts(cmd, c)
+	} else if !errors.Is(err, pkcs11.ErrObjectNotFound) {
+		sylog.Fatalf("Failed to load PKCS#11 certificate: %v", err)
+	}
+
+	if cmd.Flag(verifyTSARootsFlag.Name).Changed {
+		sylog.Fatalf("--tsa-roots requires a certificate, the PKCS#11 token has none labeled %q", pkcs11KeyLabel)
+	}
+
+	pub, err := t.PublicKey(pkcs11KeyLabel)
+	if err != nil {
+		sylog.Fatalf("Failed to load PKCS#11 key material: %v", err)
+	}
+	v, err := signature.LoadVerifier(pub, crypto.SHA256)
+	if err != nil {
+		sylog.Fatalf("Failed to load PKCS#11 key material: %v", err)
+	}
+	return []sifsignature.VerifyOpt{sifsignature.OptVerifyWithVerifier(v)}
+}
+
+// verifyImage verifies the image cpath, and that it's signed by the required
+// fingerprints if --fingerprint is set.
+func verifyImage(cmd *cobra.Command, cpath string, opts []sifsignature.VerifyOpt) (sifsignature.SignersResult, error) {
+	if len(verifyFingerprints) == 0 {
+		return sifsignature.SignersResult{}, sifsignature.Verify(cmd.Context(), cpath, opts...)
+	}
+	return sifsignature.VerifySigners(cmd.Context(), cpath, verifyFingerprints, opts...)
+}
+
+// outputSigners prints the required fingerprints which signed the image, and
+// those missing.
+func outputSigners(r sifsignature.SignersResult) {
+	if r.Threshold == 0 {
+		return
+	}
+	sylog.Infof("Image signed by %d of %d fingerprint(s), %d required", len(r.Satisfied), len(r.Satisfied)+len(r.Missing), r.Threshold)
+	if len(r.Satisfied) > 0 {
+		sylog.Infof("Satisfied: %s", strings.Join(r.Satisfied, ", "))
+	}
+	if len(r.Missing) > 0 {
+		sylog.Infof("Missing: %s", strings.Join(r.Missing, ", "))
+	}
+}
@@ -78,7 +78,17 @@ Enterprise Performance Computing (EPC)`
   has enough space to hold the entire container image, uncompressed,
   including any temporary files that are created and later removed
   during the build. You may need to set APPTAINER_TMPDIR or TMPDIR when
-  building a large container on a system that has a small /tmp filesystem.`
+  building a large container on a system that has a small /tmp filesystem.
+
+  Remote builds:
+
+  With --remote, the image is built on the build server of the remote
+  endpoint, or on the one given with --builder, which needs no privileges on
+  this host. The files copied from the host by %files sections are sent
+  along with the definition file, and the build log is streamed back. The
+  image built is downloaded to IMAGE PATH, or pushed by the build server if
+  IMAGE PATH is a library:// URI. Remote builds can't build sandboxes,
+  encrypted images or from local images.`
 
 	BuildExample string = `
 
@@ -173,6 +183,11 @@ Enterprise Performance Computing (EPC)`
       %help
           This is a text file to be displayed with the run-help command.
 
+      %security
+          seccomp /path/in/container/seccomp.json
+          apparmor profile-name
+          capabilities CAP_NET_RAW,CAP_SYS_PTRACE
+
   COMMANDS:
 
       Build a sif file from an Apptainer recipe file:
@@ -184,7 +199,62 @@ Enterprise Performance Computing (EPC)`
       Build a base sandbox from DockerHub, make changes to it, then build sif
           $ apptainer build --sandbox /tmp/debian docker://debian:latest
           $ apptainer exec --writable /tmp/debian apt-get install python
-          $ apptainer build /tmp/debian2.sif /tmp/debian`
+          $ apptainer build /tmp/debian2.sif /tmp/debian
+
+      Build a sif file from an Apptainer recipe file on a build server:
+          $ apptainer build --builder https://builder.example.com /tmp/debian3.sif /path/to/debian.def`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// build-server
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	BuildServerUse   string = `build-server`
+	BuildServerShort string = `Host a build server`
+	BuildServerLong  string = `
+  The build-server command allows hosting a build server, running the builds
+  of 'apptainer build --remote' for hosts where images can't be built.`
+	BuildServerExample string = `
+  All build-server commands have their own help output:
+
+  $ apptainer help build-server serve
+  $ apptainer build-server serve --help`
+
+	BuildServerServeUse   string = `serve [serve options...]`
+	BuildServerServeShort string = `Serve remote builds`
+	BuildServerServeLong  string = `
+  The build-server serve command serves the builds submitted by
+  'apptainer build --remote'. Each build runs 'apptainer build' in its own
+  workspace under the directory given with --dir, with the files sent for
+  its %files sections. Build logs are streamed to clients over websocket,
+  and the images built are returned to them or pushed to a library. Builds
+  are removed once returned, and at the latest one day after completing.
+
+  Submitting builds requires one of the tokens listed in the file given with
+  --token-file, one per line and optionally followed by the name of its
+  user. Lines starting with # are ignored. Users only see their own builds.
+
+  Definitions running %setup or %pre sections on the host, bootstrapping
+  from images on the host, or copying %files sources not sent along,
+  including sources expanding variables, command substitutions or ~, are
+  rejected, as well as contexts larger than 4GiB or with more than 100000
+  files. Builds still run as the user running the server, with fakeroot when
+  not root, so run the server as a dedicated unprivileged user.
+
+  The server advertises itself as the builder and token services of a remote
+  endpoint, so that it can be added with 'apptainer remote add'. When behind
+  a reverse proxy, set its public URL with --url.`
+	BuildServerServeExample string = `
+  To serve builds on port 8090:
+  $ echo "$(openssl rand -hex 100) alice" > tokens
+  $ apptainer build-server serve --dir /srv/builds --token-file tokens
+
+  To serve builds over HTTPS, running up to 4 builds at once:
+  $ apptainer build-server serve --listen :443 --dir /srv/builds \
+      --token-file tokens --tls-cert cert.pem --tls-key key.pem --concurrency 4
+
+  To build on the server:
+  $ apptainer remote add --no-login mybuilder https://builder.example.com
+  $ apptainer remote login mybuilder
+  $ apptainer build --remote image.sif image.def`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Cache
@@ -258,10 +328,14 @@ Enterprise Performance Computing (EPC)`
 	KeyImportShort string = `Import a local key into the local or global keyring`
 	KeyImportLong  string = `
   The 'key import' command allows you to add a key to your local or global keyring
-  from a specific file.`
+  from a specific file. Importing a revocation certificate, as created by
+  'key revoke', revokes the matching key of the keyring.`
 	KeyImportExample string = `
   $ apptainer key import ./my-key.asc
 
+  # Revoke a key with its revocation certificate
+  $ apptainer key import ./8883491F4268F173C6E5DC49EDECE4F3F38D871E.rev
+
   # Import into global keyring (root user only)
   $ apptainer key import --global ./my-key.asc`
 
@@ -289,10 +363,61 @@ Enterprise Performance Computing (EPC)`
 	KeyNewPairLong  string = `
   The 'key newpair' command allows you to create a new key or public/private
   keys to be stored in the default user local keyring location (e.g., 
-  $HOME/.apptainer/keys).`
+  $HOME/.apptainer/keys).
+
+  Keys are RSA keys of --bit-length bits by default, or Ed25519 signing keys
+  with a Curve25519 encryption subkey with --key-type ed25519. With --expiry,
+  the key expires at a date, or after a number of days, weeks, months or years,
+  see 'apptainer key extend' to push out the expiry. With --signing-subkey, a
+  separate subkey is created and used to sign images, signatures being still
+  attributed to the fingerprint of the primary key.`
 	KeyNewPairExample string = `
   $ apptainer key newpair
-  $ apptainer key newpair --password=psk --name=your-name --comment="key comment" --email=mail@email.com --push=false`
+  $ apptainer key newpair --password=psk --name=your-name --comment="key comment" --email=mail@email.com --push=false
+
+  # Ed25519 key expiring in 2 years, with a signing subkey:
+  $ apptainer key newpair --key-type ed25519 --expiry 2y --signing-subkey`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// key extend
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	KeyExtendUse   string = `extend [extend options...] <fingerprint>`
+	KeyExtendShort string = `Change the expiry of a key pair in your local keyring`
+	KeyExtendLong  string = `
+  The 'key extend' command sets the expiry of a private key in your local
+  keyring, and of its subkeys which expire, to --expiry, one year from now by
+  default. The key is updated in both the private and public local keyrings,
+  push it to update it on a key server.`
+	KeyExtendExample string = `
+  $ apptainer key extend 8883491F4268F173C6E5DC49EDECE4F3F38D871E
+
+  # expire at the end of 2027:
+  $ apptainer key extend --expiry 2027-12-31 8883491F4268F173C6E5DC49EDECE4F3F38D871E
+
+  # never expire:
+  $ apptainer key extend --expiry never 8883491F4268F173C6E5DC49EDECE4F3F38D871E`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// key revoke
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	KeyRevokeUse   string = `revoke [revoke options...] <fingerprint>`
+	KeyRevokeShort string = `Revoke a key pair in your local keyring`
+	KeyRevokeLong  string = `
+  The 'key revoke' command revokes a private key in your local keyring, for
+  instance when it has been compromised. The revocation certificate is stored
+  in the 'revocations' directory of the local keyring, and the revoked key is
+  updated in both the private and public local keyrings. Use --push to send
+  the revoked key to the key server, so that other users pulling or verifying
+  with the key see the revocation.
+
+  Signatures made with a revoked key are no longer valid, whether the
+  revocation is found in the local keyring or on the key server by
+  'apptainer verify', or in the global keyring by the execution control list.`
+	KeyRevokeExample string = `
+  $ apptainer key revoke --reason compromised --comment "laptop stolen" 8883491F4268F173C6E5DC49EDECE4F3F38D871E
+
+  # revoke and publish the revocation on the key server:
+  $ apptainer key revoke --reason superseded --push 8883491F4268F173C6E5DC49EDECE4F3F38D871E`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key list
@@ -301,11 +426,18 @@ Enterprise Performance Computing (EPC)`
 	KeyListShort string = `List keys in your local or in the global keyring`
 	KeyListLong  string = `
   List your local keys in your keyring. Will list public (trusted) keys
-  by default.`
+  by default.
+
+  With --agent, the keys held by gpg-agent, including the keys stored on
+  smartcards, are listed with their keygrip, and the fingerprint and user IDs
+  of the matching public key of your keyring.`
 	KeyListExample string = `
   $ apptainer key list
   $ apptainer key list --secret
 
+  # list the keys available through gpg-agent
+  $ apptainer key list --agent
+
   # list global public keys
   $ apptainer key list --global`
 
@@ -330,17 +462,26 @@ Enterprise Performance Computing (EPC)`
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key pull
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
-	KeyPullUse   string = `pull [pull options...] <fingerprint>`
-	KeyPullShort string = `Download a public key from a key server`
+	KeyPullUse   string = `pull [pull options...] <fingerprint|email>`
+	KeyPullShort string = `Download a public key from a key server or web key directory`
 	KeyPullLong  string = `
   The 'key pull' command allows you to retrieve public key material from a
   remote key server, and add it to your keyring. Note that Apptainer consults
   your keyring when running commands such as 'apptainer verify', and thus
   adding a key to your keyring implies a level of trust. Because of this, it is
   recommended that you verify the fingerprint of the key with its owner prior
-  to running this command.`
+  to running this command. If the key is already in your keyring, any
+  revocation of the key found on the key server is added to it.
+
+  When given an email address, the keys are retrieved from the Web Key
+  Directory (WKD) of its domain instead of the key server, with the advanced
+  method, or the direct method if the former is not available. Only the keys
+  with a user ID matching the email address are added.`
 	KeyPullExample string = `
-  $ apptainer key pull 8883491F4268F173C6E5DC49EDECE4F3F38D871E`
+  $ apptainer key pull 8883491F4268F173C6E5DC49EDECE4F3F38D871E
+
+  # pull the keys of an email address from its web key directory:
+  $ apptainer key pull jdoe@example.org`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key push
@@ -693,7 +834,10 @@ Enterprise Performance Computing (EPC)`
       ipfs://cid
 
   http, https: Pull an image using the http(s?) protocol
-      https://example.com/alpine.sif`
+      https://example.com/alpine.sif
+
+  With --verify-key, docker and oras images must have a cosign signature
+  verified by this public key, and the verified digest is pulled.`
 	PullExample string = `
   From a library
   $ apptainer pull alpine.sif library://alpine:latest
@@ -708,6 +852,9 @@ Enterprise Performance Computing (EPC)`
   From supporting OCI registry (e.g. Azure Container Registry)
   $ apptainer pull image.sif oras://<username>.azurecr.io/namespace/image:tag
 
+  Only if signed by a public key
+  $ apptainer pull --verify-key public.pem image.sif oras://registry/namespace/image:tag
+
   From available IPFS cluster (using a local HTTP IPFS gateway)
   $ apptainer pull lolcow.sif ipfs://bafybeice667c6gxovimsb6gnk6vex7vhzluhkl5hjv4ac4lhilxn52c43m`
 
@@ -770,6 +917,52 @@ Enterprise Performance Computing (EPC)`
   In supported OCI registry
   $ apptainer tag oras://registry/namespace/image:tag newtag`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// library
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	LibraryUse   string = `library`
+	LibraryShort string = `Host a library of container images`
+	LibraryLong  string = `
+  The library command allows hosting a library of SIF container images, used
+  with library:// URIs.`
+	LibraryExample string = `
+  All library commands have their own help output:
+
+  $ apptainer help library serve
+  $ apptainer library serve --help`
+
+	LibraryServeUse   string = `serve [serve options...]`
+	LibraryServeShort string = `Serve a library of container images stored in a directory`
+	LibraryServeLong  string = `
+  The library serve command serves the library API used by the push, pull,
+  search, delete and tag commands with library:// URIs. Images are stored in
+  the directory given with --dir, along with their metadata.
+
+  Pushing, tagging and deleting images require one of the tokens listed in
+  the file given with --token-file, one per line and optionally followed by
+  the name of its user. Lines starting with # are ignored. Entities belong
+  to the user who created them, and only that user can write to them and
+  read their private collections and containers. Without a token file the
+  library is read-only. Pulling and searching images are anonymous, unless
+  --private is set.
+
+  The server advertises itself as the library and token services of a remote
+  endpoint, so that it can be added with 'apptainer remote add'. When behind
+  a reverse proxy, set its public URL with --url.`
+	LibraryServeExample string = `
+  To serve a library on port 8080:
+  $ echo "$(openssl rand -hex 32) alice" > tokens
+  $ apptainer library serve --dir /srv/library --token-file tokens
+
+  To serve a library over HTTPS, requiring a token to pull images:
+  $ apptainer library serve --listen :443 --dir /srv/library --token-file tokens \
+      --tls-cert cert.pem --tls-key key.pem --private
+
+  To use the library:
+  $ apptainer remote add --no-login mylibrary https://library.example.com
+  $ apptainer remote login mylibrary
+  $ apptainer push image.sif library://alice/default/image:latest`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// run
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -840,14 +1033,53 @@ Enterprise Performance Computing (EPC)`
   image. By default, one digital signature is added for each object group in
   the file.
 
-  Key material can be provided via PEM-encoded file, or an entity in the PGP
-  keyring. To manage the PGP keyring, see 'apptainer help key'.`
+  Key material can be provided via PEM-encoded file, SSH key, RSA or ECDSA key
+  of a PKCS#11 token such as an HSM, or an entity in the PGP keyring. To manage
+  the PGP keyring, see 'apptainer help key'.
+
+  SSH keys held by ssh-agent are used through the agent, their public key file
+  may then be given to --ssh-key. SSH signatures use the "apptainer"
+  namespace.
+
+  PKCS#11 keys are selected with --pkcs11-module, the token label or slot, and
+  --pkcs11-key, the label of the key. The token PIN is read from the
+  APPTAINER_PKCS11_PIN environment variable, or prompted for.
+
+  With --gpg-agent-key, PGP signatures are made through gpg-agent with the RSA
+  or ECDSA key of this fingerprint or keygrip, such as a key of your GnuPG
+  keyring or stored on a smartcard. The private key never leaves the agent,
+  which prompts for its passphrase or PIN. The public key must be imported in
+  the PGP keyring first, with 'gpg --export --armor' and 'apptainer key import'.
+
+  With --tsa, each signature made with --key, --ssh-key or --pkcs11-module is
+  timestamped by the RFC 3161 Time Stamping Authority at this URL, so that it
+  can be verified after the signing certificate has expired.
+
+  Images in OCI registries, docker:// or oras:// references, are signed with
+  --key or --pkcs11-module. The cosign compatible signature is pushed to the
+  registry, tagged after the digest of the image.`
 	SignExample string = `
   Sign with a private key:
   $ apptainer sign --key private.pem container.sif
 
+  Sign with an SSH key:
+  $ apptainer sign --ssh-key ~/.ssh/id_ed25519 container.sif
+
+  Sign with a key of a PKCS#11 token:
+  $ apptainer sign --pkcs11-module /usr/lib/softhsm/libsofthsm2.so \
+      --pkcs11-token release --pkcs11-key signing container.sif
+
+  Sign with a private key, and timestamp the signature:
+  $ apptainer sign --key private.pem --tsa https://freetsa.org/tsr container.sif
+
+  Sign an image in an OCI registry:
+  $ apptainer sign --key private.pem oras://registry/namespace/image:tag
+
   Sign with PGP:
-  $ apptainer sign container.sif`
+  $ apptainer sign container.sif
+
+  Sign with a PGP key held by gpg-agent:
+  $ apptainer sign --gpg-agent-key 8883491F4268F173C6E5DC49EDECE4F3F38D871E container.sif`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// verify
@@ -858,14 +1090,72 @@ Enterprise Performance Computing (EPC)`
   The verify command allows a user to verify one or more digital signatures
   within a SIF image.
 
-  Key material can be provided via PEM-encoded file, or via the PGP keyring. To
-  manage the PGP keyring, see 'apptainer help key'.`
+  Key material can be provided via PEM-encoded file, an OpenSSH allowed signers
+  file of SSH keys, a PKCS#11 token, or via the PGP keyring. To manage the PGP
+  keyring, see 'apptainer help key'. Allowed signers restricted with the
+  namespaces option must allow the "apptainer" namespace, and --principal
+  requires the signer to be allowed as that principal.
+
+  Unless --local is set, PGP keys missing from the keyrings are retrieved from
+  the key server, then from the Web Key Directory (WKD) of the signer when a
+  signature holds a Signer's User ID with an email address.
+
+  With --pkcs11-module, the certificate with the --pkcs11-key label on the
+  token is used, and verified with the certificate flags, or the public key
+  with this label when the token holds no such certificate.
+
+  With --tsa-roots, certificate signatures must be timestamped by a Time
+  Stamping Authority chaining to these roots, and the certificate is verified
+  at the timestamped time rather than the current time.
+
+  Images in OCI registries, docker:// or oras:// references, are verified with
+  --key or --certificate, against their cosign compatible signatures.
+
+  With --sigstore-bundle, the image file is verified offline against a
+  Sigstore bundle, such as made by 'cosign sign-blob --bundle'. The signing
+  certificate must chain to a certificate authority of the --trusted-root
+  file, and be issued to --certificate-identity by --certificate-oidc-issuer.
+  The signed entry timestamp and, when present, the inclusion proof of its
+  transparency log entry are verified against the logs of the trusted root,
+  and the certificate is verified at the time the signature was logged.
+
+  With --fingerprint, the image must also be signed by the listed PGP
+  fingerprints, all of them by default or at least --threshold of them. The
+  satisfied and missing fingerprints are reported.`
 	VerifyExample string = `
   Verify with a public key:
   $ apptainer verify --key public.pem container.sif
 
   Verify with PGP:
-  $ apptainer verify container.sif`
+  $ apptainer verify container.sif
+
+  Verify a timestamped signature of an expired certificate:
+  $ apptainer verify --certificate cert.pem --certificate-roots roots.pem \
+      --tsa-roots tsa-roots.pem container.sif
+
+  Verify with the public key or certificate of a PKCS#11 token:
+  $ apptainer verify --pkcs11-module /usr/lib/softhsm/libsofthsm2.so \
+      --pkcs11-token release --pkcs11-key signing container.sif
+
+  Verify an image in an OCI registry:
+  $ apptainer verify --key public.pem docker://registry/namespace/image:tag
+
+  Verify offline with a Sigstore bundle:
+  $ apptainer verify --sigstore-bundle container.sif.sigstore.json \
+      --trusted-root trusted_root.json \
+      --certificate-identity user@example.com \
+      --certificate-oidc-issuer https://accounts.google.com container.sif
+
+  Verify with SSH keys of an allowed signers file:
+  $ apptainer verify --allowed-signers ~/.ssh/allowed_signers \
+      --principal user@example.com container.sif
+
+  Verify the image is signed by at least 2 of 3 release managers:
+  $ apptainer verify --threshold 2 \
+      --fingerprint 5994BE54C31CF1B5E1994F987C52CF6D055F072B \
+      --fingerprint 7064B1D6EFF01B1262FED3F03581D99FE87EAFD1 \
+      --fingerprint F34371D0ACD5D09EB9BD853A80600A5FA11BBD29 \
+      container.sif`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Run-help
@@ -86,4 +86,40 @@ const (
   command will only list keyservers for the remote endpoint matching that name.`
 	KeyserverListExample string = `
   $ apptainer keyserver list`
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// keyserver serve command
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	KeyserverServeUse   string = `serve [serve options...]`
+	KeyserverServeShort string = `Serve a keyserver of the keys stored in a directory`
+	KeyserverServeLong  string = `
+  The 'keyserver serve' command serves the HKP lookup and add operations used
+  by the 'key push', 'key pull' and 'key search' commands. Keys are stored in a
+  public keyring in the directory given with --dir, and keys added to a key
+  already stored are merged with it.
+
+  Keys are published when added, unless --verify-hook is set. The hook is run
+  with the email address, the key fingerprint and a verification link as
+  arguments for each new identity of the keys added, and is expected to send
+  the link to the email address. The identity is published once the link is
+  opened, within 48 hours. Identities without an email address are never
+  published then, while the revocations and subkeys of keys already published
+  need no verification.
+
+  With --read-only, keys can only be looked up. When behind a reverse proxy,
+  set the public URL of the server with --url for the verification links.`
+	KeyserverServeExample string = `
+  To serve a keyserver on the default HKP port:
+  $ apptainer keyserver serve --dir /srv/keys
+
+  To serve a keyserver over HTTPS, verifying email addresses:
+  $ cat /usr/local/bin/send-verification
+  #!/bin/sh
+  echo "Open $3 to publish key $2" | mail -s "Key verification" "$1"
+  $ apptainer keyserver serve --listen :443 --dir /srv/keys \
+      --tls-cert cert.pem --tls-key key.pem \
+      --verify-hook /usr/local/bin/send-verification
+
+  To use the keyserver:
+  $ apptainer keyserver add https://keys.example.com
+  $ apptainer key push 8883491F4268F173C6E5DC49EDECE4F3F38D871E`
 )
@@ -0,0 +1,84 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package docs
+
+// Network command usage.
+const (
+	NetworkUse   string = `network [network options...]`
+	NetworkShort string = `Manage CNI network configurations`
+	NetworkLong  string = `
+  The 'network' command allows you to manage the CNI network configurations
+  found in the "cni configuration path" directory of apptainer.conf, which are
+  used with the --network option. Creating and removing networks requires root
+  privileges.`
+	NetworkExample string = `
+  All group commands have their own help output:
+
+  $ apptainer help network create
+  $ apptainer network list --help`
+)
+
+// Network list command usage.
+const (
+	NetworkListUse   string = `list`
+	NetworkListShort string = `List CNI networks`
+	NetworkListLong  string = `
+  The 'network list' command lists the CNI networks with their type, their
+  subnets and the number of running instances attached to them. Root sees the
+  instances of all users, other users only see their own instances.`
+	NetworkListExample string = `
+  $ apptainer network list
+  NAME      TYPE     SUBNET        INSTANCES
+  bridge    bridge   10.22.0.0/16  2
+  ptp       ptp      10.23.0.0/16  0`
+)
+
+// Network inspect command usage.
+const (
+	NetworkInspectUse   string = `inspect <name>`
+	NetworkInspectShort string = `Show the configuration of a CNI network`
+	NetworkInspectLong  string = `
+  The 'network inspect' command shows the configuration file of a CNI network,
+  the CNI plugins it requires, those missing from the "cni plugin path"
+  directory, and the running instances attached to it.`
+	NetworkInspectExample string = `
+  $ apptainer network inspect bridge`
+)
+
+// Network create command usage.
+const (
+	NetworkCreateUse   string = `create [create options...] <name>`
+	NetworkCreateShort string = `Create a CNI network configuration (root user only)`
+	NetworkCreateLong  string = `
+  The 'network create' command generates a CNI network configuration for a
+  bridge, macvlan or ipvlan network. Addresses are allocated by the host-local
+  IPAM plugin in the given subnet, or by the dhcp IPAM plugin. The command
+  checks that the required CNI plugins are installed in the "cni plugin path"
+  directory before writing the configuration.`
+	NetworkCreateExample string = `
+  To create a bridge network with NAT to the host network:
+  $ apptainer network create --subnet 10.30.0.0/16 mynet
+
+  To create a macvlan network on the host eth0 interface:
+  $ apptainer network create --type macvlan --parent eth0 \
+      --subnet 192.168.1.0/24 --gateway 192.168.1.254 \
+      --ip-range 192.168.1.100-192.168.1.199 lan`
+)
+
+// Network remove command usage.
+const (
+	NetworkRemoveUse   string = `remove [remove options...] <name>`
+	NetworkRemoveShort string = `Remove a CNI network configuration (root user only)`
+	NetworkRemoveLong  string = `
+  The 'network remove' command removes the configuration file of a CNI
+  network. A network with running instances attached is not removed unless
+  --force is given.`
+	NetworkRemoveExample string = `
+  $ apptainer network remove mynet`
+)
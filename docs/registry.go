@@ -33,11 +33,17 @@ const (
 	RegistryLoginShort string = `Login to an OCI/Docker registry`
 	RegistryLoginLong  string = `
   The 'registry login' command allows you to login to a specific OCI/Docker
-  registry.`
+  registry.
+
+  With --oidc, an access token obtained from the OIDC provider of the active
+  remote endpoint is used as the password, by opening the displayed URL in a
+  browser and entering the displayed code. The access token is then refreshed
+  automatically before docker:// and oras:// operations.`
 	RegistryLoginExample string = `
   To login in to a docker/OCI registry:
   $ apptainer registry login --username foo docker://docker.io
   $ apptainer registry login --username foo oras://myregistry.example.com
+  $ apptainer registry login --oidc --username foo docker://myregistry.example.com
 
   Note that many cloud OCI registries use token-based authentication. The token
   should be specified as the password for login. A username is still required.
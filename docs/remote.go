@@ -100,10 +100,18 @@ const (
   endpoint.
 
   If no endpoint or registry is specified, the command will login to the currently
-  active remote endpoint.`
+  active remote endpoint.
+
+  With --oidc, the access token is obtained from the OIDC provider advertised
+  by the endpoint, by opening the displayed URL in a browser and entering the
+  displayed code. The refresh token is stored along the access token, which is
+  then refreshed automatically before it expires.`
 	RemoteLoginExample string = `
   To log in to an endpoint:
-  $ apptainer remote login SylabsCloud`
+  $ apptainer remote login SylabsCloud
+
+  To log in to an endpoint with its OIDC provider:
+  $ apptainer remote login --oidc MyCloud`
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// remote logout command
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
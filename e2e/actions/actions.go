@@ -1162,6 +1162,132 @@ func (c actionTests) actionNetwork(t *testing.T) {
 	}
 }
 
+func (c actionTests) actionSysctl(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tests := []struct {
+		name       string
+		args       []string
+		expectExit int
+		resultOp   e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:       "NetSysctl",
+			args:       []string{"--net", "--network", "none", "--sysctl", "net.ipv4.ip_unprivileged_port_start=80", c.env.ImagePath, "cat", "/proc/sys/net/ipv4/ip_unprivileged_port_start"},
+			expectExit: 0,
+			resultOp:   e2e.ExpectOutput(e2e.ExactMatch, "80"),
+		},
+		{
+			name:       "IpcSysctl",
+			args:       []string{"--ipc", "--sysctl", "kernel.shmmni=1024", c.env.ImagePath, "cat", "/proc/sys/kernel/shmmni"},
+			expectExit: 0,
+			resultOp:   e2e.ExpectOutput(e2e.ExactMatch, "1024"),
+		},
+		{
+			name:       "NetSysctlWithoutNetNamespace",
+			args:       []string{"--sysctl", "net.core.somaxconn=1024", c.env.ImagePath, "true"},
+			expectExit: 255,
+		},
+		{
+			name:       "NotNamespacedSysctl",
+			args:       []string{"--net", "--network", "none", "--sysctl", "kernel.pid_max=4096", c.env.ImagePath, "true"},
+			expectExit: 255,
+		},
+		{
+			name:       "InvalidSysctl",
+			args:       []string{"--net", "--network", "none", "--sysctl", "net.core.somaxconn", c.env.ImagePath, "true"},
+			expectExit: 255,
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.expectExit, tt.resultOp),
+		)
+	}
+}
+
+func (c actionTests) actionAddHost(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tests := []struct {
+		name       string
+		profile    e2e.Profile
+		args       []string
+		expectExit int
+		resultOp   e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:       "HostEntry",
+			profile:    e2e.UserProfile,
+			args:       []string{"--add-host", "myhost:10.1.2.3", c.env.ImagePath, "cat", "/etc/hosts"},
+			expectExit: 0,
+			resultOp:   e2e.ExpectOutput(e2e.RegexMatch, `(?m)^10\.1\.2\.3\s+myhost$`),
+		},
+		{
+			name:       "HostEntryIPv6",
+			profile:    e2e.UserProfile,
+			args:       []string{"--add-host", "myhost6:[fd00::1]", c.env.ImagePath, "cat", "/etc/hosts"},
+			expectExit: 0,
+			resultOp:   e2e.ExpectOutput(e2e.RegexMatch, `(?m)^fd00::1\s+myhost6$`),
+		},
+		{
+			name:       "HostEntryContain",
+			profile:    e2e.UserProfile,
+			args:       []string{"--contain", "--add-host", "myhost:10.1.2.3", c.env.ImagePath, "cat", "/etc/hosts"},
+			expectExit: 0,
+			resultOp:   e2e.ExpectOutput(e2e.RegexMatch, `(?m)^10\.1\.2\.3\s+myhost$`),
+		},
+		{
+			name:       "HostEntryContainNet",
+			profile:    e2e.RootProfile,
+			args:       []string{"--contain", "--net", "--network", "none", "--add-host", "myhost:10.1.2.3", c.env.ImagePath, "cat", "/etc/hosts"},
+			expectExit: 0,
+			resultOp:   e2e.ExpectOutput(e2e.RegexMatch, `(?m)^10\.1\.2\.3\s+myhost$`),
+		},
+		{
+			name:       "HostGatewayWithoutNet",
+			profile:    e2e.UserProfile,
+			args:       []string{"--add-host", "gw:host-gateway", c.env.ImagePath, "true"},
+			expectExit: 255,
+		},
+		{
+			name:       "HostGatewayNoneNetwork",
+			profile:    e2e.RootProfile,
+			args:       []string{"--net", "--network", "none", "--add-host", "gw:host-gateway", c.env.ImagePath, "true"},
+			expectExit: 255,
+		},
+		{
+			name:       "InvalidEntry",
+			profile:    e2e.UserProfile,
+			args:       []string{"--add-host", "myhost", c.env.ImagePath, "true"},
+			expectExit: 255,
+		},
+		{
+			name:       "InvalidAddress",
+			profile:    e2e.UserProfile,
+			args:       []string{"--add-host", "myhost:10.1.2", c.env.ImagePath, "true"},
+			expectExit: 255,
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.expectExit, tt.resultOp),
+		)
+	}
+}
+
 func (c actionTests) actionNetnsPath(t *testing.T) {
 	e2e.EnsureImage(t, c.env)
 	require.Command(t, "ip")
@@ -3325,6 +3451,8 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"issue 1848":                   c.issue1848,             // https://github.com/apptainer/apptainer/issues/1848
 		"network":                      c.actionNetwork,         // test basic networking
 		"netns-path":                   c.actionNetnsPath,       // test netns joining
+		"sysctl":                       c.actionSysctl,          // test --sysctl
+		"add-host":                     c.actionAddHost,         // test --add-host
 		"binds":                        c.actionBinds,           // test various binds with --bind and --mount
 		"layerType":                    c.actionLayerType,       // verify the various layer types
 		"exit and signals":             c.exitSignals,           // test exit and signals propagation
@@ -10,15 +10,18 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
 
 	"github.com/apptainer/apptainer/e2e/internal/e2e"
 	"github.com/apptainer/apptainer/e2e/internal/testhelper"
+	"github.com/apptainer/apptainer/internal/pkg/audit"
 	"github.com/apptainer/apptainer/internal/pkg/test/tool/require"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/internal/pkg/util/user"
@@ -1071,6 +1074,62 @@ func (c configTests) configGlobalCombination(t *testing.T) {
 			},
 			exit: 255,
 		},
+		{
+			name:    "AllowSysctlsNone",
+			argv:    []string{"--net", "--network", "none", "--sysctl", "net.core.somaxconn=1024", c.env.ImagePath, "true"},
+			profile: e2e.UserProfile,
+			exit:    255,
+		},
+		{
+			name:    "AllowSysctlsOther",
+			argv:    []string{"--net", "--network", "none", "--sysctl", "net.core.somaxconn=1024", c.env.ImagePath, "true"},
+			profile: e2e.UserProfile,
+			directives: map[string]string{
+				"allow sysctls": "net.ipv4.tcp_*",
+			},
+			exit: 255,
+		},
+		{
+			name:    "AllowSysctlsPattern",
+			argv:    []string{"--net", "--network", "none", "--sysctl", "net.core.somaxconn=1024", c.env.ImagePath, "cat", "/proc/sys/net/core/somaxconn"},
+			profile: e2e.UserProfile,
+			directives: map[string]string{
+				"allow sysctls": "net.ipv4.tcp_*, net.core.*",
+			},
+			resultOp: e2e.ExpectOutput(e2e.ExactMatch, "1024"),
+			exit:     0,
+		},
+		{
+			name:              "LandlockRulesDenied",
+			addRequirementsFn: require.Landlock,
+			argv:              []string{c.env.ImagePath, "touch", "/tmp/landlock"},
+			profile:           e2e.UserProfile,
+			directives: map[string]string{
+				"landlock rules": "ro:/tmp",
+			},
+			exit: 1,
+		},
+		{
+			name:              "LandlockRulesAllowed",
+			addRequirementsFn: require.Landlock,
+			argv:              []string{c.env.ImagePath, "sh", "-c", "touch /tmp/landlock && rm /tmp/landlock"},
+			profile:           e2e.UserProfile,
+			directives: map[string]string{
+				"landlock rules": "rw:/tmp",
+			},
+			exit: 0,
+		},
+		{
+			// user rules can't lift administrator rules
+			name:              "LandlockRulesUser",
+			addRequirementsFn: require.Landlock,
+			argv:              []string{"--landlock", "rw:/tmp", c.env.ImagePath, "touch", "/tmp/landlock"},
+			profile:           e2e.UserProfile,
+			directives: map[string]string{
+				"landlock rules": "ro:/tmp",
+			},
+			exit: 1,
+		},
 		{
 			name:    "EnableOverlayNoUnderlayNo",
 			argv:    []string{"--bind", "/etc/passwd:/passwd", c.env.ImagePath, "test", "-f", "/passwd"},
@@ -1311,6 +1370,149 @@ func (c configTests) configFile(t *testing.T) {
 	}
 }
 
+// Tests the admission policy of the policy file directive, enforced by
+// the setuid engine and evaluated by the launcher otherwise.
+func (c configTests) configPolicy(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, "", "config-policy-", "CONFIG")
+	defer cleanup(t)
+
+	policyFile := filepath.Join(tmpDir, "policy.yaml")
+	policy := `
+rules:
+  - name: no-writable-tmpfs
+    deny: request.writable_tmpfs
+    reason: --writable-tmpfs is not allowed by the e2e policy
+  - name: ro-etc
+    deny: request.binds.exists(b, b.source == "/etc" && !b.readonly)
+    reason: /etc must be bound read-only
+  - name: sif-only
+    deny: image.format != "sif" || !image.digest.startsWith("sha256:")
+    reason: only SIF images are allowed
+`
+	// the policy file must be owned by root in setuid mode
+	e2e.Privileged(func(t *testing.T) {
+		if err := os.WriteFile(policyFile, []byte(policy), 0o644); err != nil {
+			t.Fatalf("could not write policy file: %s", err)
+		}
+	})(t)
+
+	e2e.SetDirective(t, c.env, "policy file", policyFile)
+	defer e2e.ResetDirective(t, c.env, "policy file")
+
+	tests := []struct {
+		name    string
+		argv    []string
+		exit    int
+		message string
+	}{
+		{
+			name: "Allowed",
+			argv: []string{"--bind", "/etc:/host/etc:ro", c.env.ImagePath, "true"},
+			exit: 0,
+		},
+		{
+			name:    "DeniedWritableTmpfs",
+			argv:    []string{"--writable-tmpfs", c.env.ImagePath, "true"},
+			exit:    255,
+			message: "--writable-tmpfs is not allowed by the e2e policy",
+		},
+		{
+			name:    "DeniedBind",
+			argv:    []string{"--bind", "/etc:/host/etc", c.env.ImagePath, "true"},
+			exit:    255,
+			message: "/etc must be bound read-only",
+		},
+	}
+
+	for _, profile := range []e2e.Profile{e2e.UserProfile, e2e.UserNamespaceProfile} {
+		t.Run(profile.String(), func(t *testing.T) {
+			for _, tt := range tests {
+				var resultOps []e2e.ApptainerCmdResultOp
+				if tt.message != "" {
+					resultOps = append(resultOps, e2e.ExpectError(e2e.ContainMatch, tt.message))
+				}
+				c.env.RunApptainer(
+					t,
+					e2e.AsSubtest(tt.name),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs(tt.argv...),
+					e2e.ExpectExit(tt.exit, resultOps...),
+				)
+			}
+		})
+	}
+}
+
+// configAudit tests the audit events written for container starts and exits.
+func (c configTests) configAudit(t *testing.T) {
+	e2e.EnsureImage(t, c.env)
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, "", "config-audit-", "CONFIG")
+	defer cleanup(t)
+
+	auditLog := filepath.Join(tmpDir, "audit.log")
+
+	e2e.SetDirective(t, c.env, "audit log", "file")
+	defer e2e.ResetDirective(t, c.env, "audit log")
+	e2e.SetDirective(t, c.env, "audit log file", auditLog)
+	defer e2e.ResetDirective(t, c.env, "audit log file")
+
+	for _, profile := range []e2e.Profile{e2e.UserProfile, e2e.RootProfile} {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(profile.String()),
+			e2e.WithProfile(profile),
+			e2e.WithCommand("exec"),
+			e2e.WithArgs(c.env.ImagePath, "sh", "-c", "exit 3"),
+			e2e.ExpectExit(3),
+			e2e.PostRun(func(t *testing.T) {
+				var events []audit.Event
+
+				// the audit log file is only readable by root
+				e2e.Privileged(func(t *testing.T) {
+					b, err := os.ReadFile(auditLog)
+					if err != nil {
+						t.Fatalf("could not read audit log: %s", err)
+					}
+					if err := os.Remove(auditLog); err != nil {
+						t.Fatalf("could not remove audit log: %s", err)
+					}
+					for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+						var ev audit.Event
+						if err := json.Unmarshal([]byte(line), &ev); err != nil {
+							t.Fatalf("invalid audit event %q: %s", line, err)
+						}
+						events = append(events, ev)
+					}
+				})(t)
+
+				if len(events) != 2 {
+					t.Fatalf("got %d audit events, want 2", len(events))
+				}
+				start, exit := events[0], events[1]
+				if start.Event != audit.EventStart || exit.Event != audit.EventExit {
+					t.Errorf("got events %s and %s, want start and exit", start.Event, exit.Event)
+				}
+				if uid := int(profile.HostUser(t).UID); start.UID != uid {
+					t.Errorf("got uid %d, want %d", start.UID, uid)
+				}
+				if !strings.HasPrefix(start.ImageDigest, "sha256:") {
+					t.Errorf("got image digest %q", start.ImageDigest)
+				}
+				if len(start.Command) == 0 || start.Command[len(start.Command)-1] != "exit 3" {
+					t.Errorf("got command %q", start.Command)
+				}
+				if exit.ExitCode == nil || *exit.ExitCode != 3 {
+					t.Errorf("got exit code %v, want 3", exit.ExitCode)
+				}
+			}),
+		)
+	}
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := configTests{
@@ -1324,5 +1526,7 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"config global":             np(c.configGlobal),            // test various global configuration
 		"config global combination": np(c.configGlobalCombination), // test various global configuration with combination
 		"config user netns":         np(c.configUserNetns),         // test entering a network namespace as an unpriv user
+		"config policy":             np(c.configPolicy),            // test the admission policy file
+		"config audit":              np(c.configAudit),             // test the audit log of container launches
 	}
 }
@@ -24,6 +24,7 @@ import (
 
 	"github.com/apptainer/apptainer/e2e/internal/e2e"
 	"github.com/apptainer/apptainer/e2e/internal/testhelper"
+	"github.com/apptainer/apptainer/internal/pkg/test/tool/require"
 	"github.com/apptainer/apptainer/pkg/util/fs/proc"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -295,6 +296,73 @@ func (c *ctx) testContain(t *testing.T) {
 	}
 }
 
+// Test that instances attached to the same CNI network resolve each
+// other by instance name.
+func (c *ctx) testNetworkHosts(t *testing.T) {
+	if !c.profile.Privileged() {
+		t.Skip("CNI bridge network requires privileges")
+	}
+
+	instances := []string{"hostsdb", "hostsapp"}
+	for i, name := range instances {
+		c.env.RunApptainer(
+			t,
+			e2e.WithProfile(c.profile),
+			e2e.WithCommand("instance start"),
+			e2e.WithArgs("--net", "--network", "bridge", c.env.ImagePath, name, strconv.Itoa(instanceStartPort+i)),
+			e2e.ExpectExit(0),
+		)
+	}
+
+	// wait for the hosts file of an instance to contain, or not, an entry
+	waitEntry := func(instance, name string, present bool) {
+		grep := "grep -q"
+		if !present {
+			grep = "! grep -q"
+		}
+		script := fmt.Sprintf(`for i in $(seq 10); do %s "[[:space:]]%s$" /etc/hosts && exit 0; sleep 1; done; exit 1`, grep, name)
+		c.execInstance(t, instance, "sh", "-c", script)
+	}
+
+	waitEntry("hostsapp", "hostsdb", true)
+	waitEntry("hostsdb", "hostsapp", true)
+	waitEntry("hostsapp", "hostsapp", true)
+
+	c.stopInstance(t, "hostsdb")
+	waitEntry("hostsapp", "hostsdb", false)
+	c.stopInstance(t, "hostsapp")
+}
+
+// Test the unprivileged user mode network and its port forwarding.
+func (c *ctx) testSlirpNetwork(t *testing.T) {
+	require.Command(t, "slirp4netns")
+
+	const instanceName = "slirp"
+	// forward a host port different from the echo server port
+	hostPort := instanceStartPort + 100
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(c.profile),
+		e2e.WithCommand("instance start"),
+		e2e.WithArgs(
+			"--network", "slirp4netns",
+			"--publish", fmt.Sprintf("%d:%d", hostPort, instanceStartPort),
+			c.env.ImagePath,
+			instanceName,
+			strconv.Itoa(instanceStartPort),
+		),
+		e2e.PostRun(func(t *testing.T) {
+			if t.Failed() {
+				return
+			}
+			echo(t, hostPort, false)
+			c.stopInstance(t, instanceName)
+		}),
+		e2e.ExpectExit(0),
+	)
+}
+
 // Test by running directly from URI
 func (c *ctx) testInstanceFromURI(t *testing.T) {
 	e2e.EnsureORASImage(t, c.env)
@@ -599,6 +667,8 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 				{"CheckpointInstance", c.testCheckpointInstance},
 				{"InstanceWithConfigDir", c.testInstanceWithConfigDir},
 				{"ShareNSMode", c.testShareNSMode},
+				{"NetworkHosts", c.testNetworkHosts},
+				{"SlirpNetwork", c.testSlirpNetwork},
 				{"issue 2189", c.issue2189},
 			}
 
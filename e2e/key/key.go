@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"testing"
 
@@ -640,6 +641,174 @@ func (c ctx) apptainerKeyNewpairWithLen(t *testing.T) {
 	}
 }
 
+// apptainerKeyNewpairEd25519 creates an expiring Ed25519 key pair with a
+// signing subkey, and extends its expiry.
+func (c ctx) apptainerKeyNewpairEd25519(t *testing.T) {
+	tempKeyring, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "keyring-", "")
+	defer cleanup(t)
+	c.env.KeyringDir = tempKeyring
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("key newpair"),
+		e2e.WithArgs(
+			"--name", "e2e test key", "--email", "jdoe@apptainer.org", "--comment", "for e2e tests",
+			"--password", "", "--push=false",
+			"--key-type", "ed25519", "--expiry", "1y", "--signing-subkey",
+		),
+		e2e.ExpectExit(0),
+	)
+
+	var fingerprint string
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("key list"),
+		e2e.WithArgs("--secret"),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.RegexMatch, `Expiry time:[ ]+`),
+			func(t *testing.T, r *e2e.ApptainerCmdResult) {
+				m := regexp.MustCompile(`Fingerprint:[ ]+([0-9A-F]{40})`).FindSubmatch(r.Stdout)
+				if m == nil {
+					t.Fatalf("no fingerprint in key list output: %s", r.Stdout)
+				}
+				fingerprint = string(m[1])
+			},
+		),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("key extend"),
+		e2e.WithArgs("--expiry", "2099-01-01", fingerprint),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.ContainMatch, "now expires on 2099-01-01")),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("key list"),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.RegexMatch, `Expiry time:[ ]+2099-01-01`)),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("key newpair"),
+		e2e.WithArgs("--key-type", "dsa"),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "must be rsa or ed25519")),
+	)
+}
+
+func (c ctx) apptainerKeyRevoke(t *testing.T) {
+	tempKeyring, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "keyring-", "")
+	defer cleanup(t)
+	c.env.KeyringDir = tempKeyring
+
+	b, err := os.ReadFile(filepath.Join("..", "test", "images", "one-group.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := filepath.Join(tempKeyring, "image.sif")
+	if err := os.WriteFile(image, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("key newpair"),
+		e2e.WithArgs(
+			"--name", "e2e test key", "--email", "jdoe@apptainer.org", "--comment", "for e2e tests",
+			"--password", "", "--push=false", "--key-type", "ed25519",
+		),
+		e2e.ExpectExit(0),
+	)
+
+	var fingerprint string
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("key list"),
+		e2e.ExpectExit(
+			0,
+			func(t *testing.T, r *e2e.ApptainerCmdResult) {
+				m := regexp.MustCompile(`Fingerprint:[ ]+([0-9A-F]{40})`).FindSubmatch(r.Stdout)
+				if m == nil {
+					t.Fatalf("no fingerprint in key list output: %s", r.Stdout)
+				}
+				fingerprint = string(m[1])
+			},
+		),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("sign"),
+		e2e.WithArgs(image),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("verify"),
+		e2e.WithArgs("--local", image),
+		e2e.ExpectExit(0),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("key revoke"),
+		e2e.WithArgs("--reason", "compromised", "--comment", "e2e test", fingerprint),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectOutput(e2e.ContainMatch, "Key "+fingerprint+" revoked"),
+			e2e.ExpectOutput(e2e.ContainMatch, filepath.Join("revocations", fingerprint+".rev")),
+		),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("key list"),
+		e2e.ExpectExit(0, e2e.ExpectOutput(e2e.RegexMatch, `Revocation time:[ ]+`)),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("verify"),
+		e2e.WithArgs("--local", image),
+		e2e.ExpectExit(
+			255,
+			e2e.ExpectOutput(e2e.ContainMatch, "Key status: revoked"),
+			e2e.ExpectError(e2e.ContainMatch, "signing key has been revoked"),
+		),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("key revoke"),
+		e2e.WithArgs(fingerprint),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "already revoked")),
+	)
+
+	c.env.RunApptainer(
+		t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("key revoke"),
+		e2e.WithArgs("--reason", "lost", fingerprint),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "unknown revocation reason")),
+	)
+}
+
 func (c *ctx) checkKeyLength(t *testing.T, expectedKeyLength int) {
 	if expectedKeyLength >= 0 {
 		cmdArgs := []string{"list"}
@@ -846,6 +1015,8 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"ordered": func(t *testing.T) {
 			t.Run("keyCmd", c.apptainerKeyCmd)                                 // Run all the tests in order
 			t.Run("keyNewpairWithLen", c.apptainerKeyNewpairWithLen)           // We run a separate test for `key newpair --bit-length` because it requires handling a keyring a specific way
+			t.Run("keyNewpairEd25519", c.apptainerKeyNewpairEd25519)           // run a separated test for `key newpair --key-type ed25519` and `key extend`
+			t.Run("keyRevoke", c.apptainerKeyRevoke)                           // run a separated test for `key revoke`
 			t.Run("keyRemoveOpts", c.apptainerKeyRemoveOpts)                   // run a separated test for `key remove --public/--secret/--both`
 			t.Run("keyDirCmdRegression", c.apptainerLocalKeyDirFlagRegression) // run a separated test for regression purpose after we add a new feature of manually setting --keysdir through cli
 		},
@@ -0,0 +1,158 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apptainer/apptainer/e2e/internal/e2e"
+	"github.com/apptainer/apptainer/e2e/internal/testhelper"
+)
+
+type ctx struct {
+	env e2e.TestEnv
+}
+
+func (c ctx) testNetworkCommands(t *testing.T) {
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "network-", "")
+	defer cleanup(t)
+
+	confDir := filepath.Join(tmpDir, "conf")
+	pluginDir := filepath.Join(tmpDir, "plugins")
+	for _, d := range []string{confDir, pluginDir} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// only the presence of plugins is checked
+	for _, p := range []string{"bridge", "host-local", "firewall", "portmap"} {
+		if err := os.WriteFile(filepath.Join(pluginDir, p), []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e2e.SetDirective(t, c.env, "cni configuration path", confDir)
+	defer e2e.ResetDirective(t, c.env, "cni configuration path")
+	e2e.SetDirective(t, c.env, "cni plugin path", pluginDir)
+	defer e2e.ResetDirective(t, c.env, "cni plugin path")
+
+	tests := []struct {
+		name       string
+		profile    e2e.Profile
+		command    string
+		args       []string
+		expectExit int
+		expectOp   e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:       "CreateAsUser",
+			profile:    e2e.UserProfile,
+			command:    "network create",
+			args:       []string{"--subnet", "10.30.0.0/16", "e2enet"},
+			expectExit: 255,
+		},
+		{
+			name:       "Create",
+			profile:    e2e.RootProfile,
+			command:    "network create",
+			args:       []string{"--subnet", "10.30.0.0/16", "--gateway", "10.30.0.254", "e2enet"},
+			expectExit: 0,
+		},
+		{
+			name:       "CreateExisting",
+			profile:    e2e.RootProfile,
+			command:    "network create",
+			args:       []string{"--subnet", "10.31.0.0/16", "e2enet"},
+			expectExit: 255,
+		},
+		{
+			name:       "CreateMissingPlugin",
+			profile:    e2e.RootProfile,
+			command:    "network create",
+			args:       []string{"--type", "macvlan", "--parent", "eth0", "--subnet", "10.32.0.0/16", "e2emac"},
+			expectExit: 255,
+		},
+		{
+			name:       "CreateBadSubnet",
+			profile:    e2e.RootProfile,
+			command:    "network create",
+			args:       []string{"--subnet", "10.33.0.0", "e2ebad"},
+			expectExit: 255,
+		},
+		{
+			name:       "List",
+			profile:    e2e.UserProfile,
+			command:    "network list",
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.RegexMatch, `(?m)^e2enet\s+bridge\s+10\.30\.0\.0/16\s+0$`),
+		},
+		{
+			name:       "Inspect",
+			profile:    e2e.UserProfile,
+			command:    "network inspect",
+			args:       []string{"e2enet"},
+			expectExit: 0,
+			expectOp:   e2e.ExpectOutput(e2e.ContainMatch, `"gateway": "10.30.0.254"`),
+		},
+		{
+			name:       "InspectUnknown",
+			profile:    e2e.UserProfile,
+			command:    "network inspect",
+			args:       []string{"unknown"},
+			expectExit: 255,
+		},
+		{
+			name:       "RemoveAsUser",
+			profile:    e2e.UserProfile,
+			command:    "network remove",
+			args:       []string{"e2enet"},
+			expectExit: 255,
+		},
+		{
+			name:       "Remove",
+			profile:    e2e.RootProfile,
+			command:    "network remove",
+			args:       []string{"e2enet"},
+			expectExit: 0,
+		},
+		{
+			name:       "RemoveUnknown",
+			profile:    e2e.RootProfile,
+			command:    "network remove",
+			args:       []string{"e2enet"},
+			expectExit: 255,
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand(tt.command),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(tt.expectExit, tt.expectOp),
+		)
+	}
+}
+
+// E2ETests is the main func to trigger the test suite
+func E2ETests(env e2e.TestEnv) testhelper.Tests {
+	c := ctx{
+		env: env,
+	}
+
+	np := testhelper.NoParallel
+
+	return testhelper.Tests{
+		"commands": np(c.testNetworkCommands),
+	}
+}
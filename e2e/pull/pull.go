@@ -717,6 +717,76 @@ func (c ctx) testPullIpfsGateway(t *testing.T) {
 }
 
 // E2ETests is the main func to trigger the test suite
+// testPullVerifyKey signs an ORAS SIF in the local registry with a cosign
+// signature, and checks it's verified before being pulled.
+func (c ctx) testPullVerifyKey(t *testing.T) {
+	ref := fmt.Sprintf("oras://%s/pull_test_signed_sif:latest", c.env.TestRegistry)
+	if err := orasPushNoCheck(c.env.ImagePath, ref, oras.SifLayerMediaTypeV1); err != nil {
+		t.Fatalf("while prepping registry for signature tests: %v", err)
+	}
+
+	keysDir := filepath.Join("..", "test", "keys")
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Sign"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("sign"),
+		e2e.WithArgs("--no-https", "--key", filepath.Join(keysDir, "ecdsa-private.pem"), ref),
+		e2e.ExpectExit(0),
+	)
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("Verify"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("verify"),
+		e2e.WithArgs("--no-https", "--key", filepath.Join(keysDir, "ecdsa-public.pem"), ref),
+		e2e.ExpectExit(
+			0,
+			e2e.ExpectError(e2e.ContainMatch, "Verified signature(s) from image"),
+		),
+	)
+
+	tempDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "pull-verify-key-", "")
+	defer cleanup(t)
+
+	tests := []struct {
+		name       string
+		key        string
+		expectCode int
+		expectOps  []e2e.ApptainerCmdResultOp
+	}{
+		{
+			name: "SignedKey",
+			key:  "ecdsa-public.pem",
+		},
+		{
+			name:       "OtherKey",
+			key:        "rsa-public.pem",
+			expectCode: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "no valid signature found"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(
+			t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("pull"),
+			e2e.WithArgs(
+				"--no-https",
+				"--verify-key", filepath.Join(keysDir, tt.key),
+				filepath.Join(tempDir, tt.name+".sif"),
+				ref,
+			),
+			e2e.ExpectExit(tt.expectCode, tt.expectOps...),
+		)
+	}
+}
+
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := ctx{
 		env: env,
@@ -732,6 +802,7 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 			c.setup(t)
 			t.Run("pull", c.testPullCmd)
 			t.Run("pullDisableCache", c.testPullDisableCacheCmd)
+			t.Run("pullVerifyKey", c.testPullVerifyKey)
 			t.Run("concurrencyConfig", c.testConcurrencyConfig)
 			t.Run("concurrentPulls", c.testConcurrentPulls)
 		},
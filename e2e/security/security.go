@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 
 	"github.com/apptainer/apptainer/e2e/internal/e2e"
@@ -374,6 +375,252 @@ func (c ctx) testSELinux(t *testing.T) {
 	}
 }
 
+// testSeccompRecord records the system calls of a command into a seccomp
+// profile and checks the command runs with the generated profile while
+// other commands are denied.
+func (c ctx) testSeccompRecord(t *testing.T) {
+	require.Seccomp(t)
+	e2e.EnsureImage(t, c.env)
+
+	for _, profile := range []e2e.Profile{e2e.UserProfile, e2e.UserNamespaceProfile, e2e.RootProfile} {
+		t.Run(profile.String(), func(t *testing.T) {
+			dir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "seccomp-record-", "")
+			t.Cleanup(func() {
+				if !t.Failed() {
+					cleanup(t)
+				}
+			})
+			out := filepath.Join(dir, "profile.json")
+
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("record"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--seccomp-record", out, c.env.ImagePath, "ls", "/"),
+				e2e.ExpectExit(0),
+			)
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("replay"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--security", "seccomp:"+out, c.env.ImagePath, "ls", "/"),
+				e2e.ExpectExit(0),
+			)
+			// mkdir is not used by ls
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest("denied"),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs("--security", "seccomp:"+out, c.env.ImagePath, "mkdir", "/tmp/seccomp-record"),
+				e2e.ExpectExit(1),
+			)
+		})
+	}
+
+	c.env.RunApptainer(
+		t,
+		e2e.AsSubtest("with profile"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("exec"),
+		e2e.WithArgs("--seccomp-record", "/tmp/profile.json", "--security", "seccomp:./security/testdata/seccomp-profile.json", c.env.ImagePath, "true"),
+		e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, "can't be used with --security seccomp")),
+	)
+}
+
+// testLandlock tests the filesystem confinement of the --landlock flag.
+func (c ctx) testLandlock(t *testing.T) {
+	require.Landlock(t)
+	e2e.EnsureImage(t, c.env)
+
+	dir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "landlock-", "")
+	t.Cleanup(func() {
+		if !t.Failed() {
+			cleanup(t)
+		}
+	})
+	profileFile := filepath.Join(dir, "profile")
+	if err := os.WriteFile(profileFile, []byte("# landlock profile\nrw:/tmp\nro:/mnt\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		argv       []string
+		expectOp   e2e.ApptainerCmdResultOp
+		expectExit int
+	}{
+		{
+			name: "ReadWrite",
+			argv: []string{"--landlock", "rw:/tmp", c.env.ImagePath, "sh", "-c", "touch /tmp/landlock && rm /tmp/landlock"},
+		},
+		{
+			name:       "ReadOnly",
+			argv:       []string{"--landlock", "ro:/tmp", c.env.ImagePath, "touch", "/tmp/landlock"},
+			expectExit: 1,
+		},
+		{
+			name:       "NotAllowed",
+			argv:       []string{"--landlock", "rw:/tmp", c.env.ImagePath, "ls", "/mnt"},
+			expectExit: 1,
+		},
+		{
+			name: "SystemDirectories",
+			argv: []string{"--landlock", "rw:/tmp", c.env.ImagePath, "cat", "/etc/passwd"},
+		},
+		{
+			name: "Profile",
+			argv: []string{"--landlock", "profile:" + profileFile, c.env.ImagePath, "sh", "-c", "ls /mnt && touch /tmp/landlock && rm /tmp/landlock"},
+		},
+		{
+			name:       "InvalidRule",
+			argv:       []string{"--landlock", "wo:/tmp", c.env.ImagePath, "true"},
+			expectOp:   e2e.ExpectError(e2e.ContainMatch, "invalid access"),
+			expectExit: 255,
+		},
+		{
+			name:       "MissingPath",
+			argv:       []string{"--landlock", "ro:/landlock/missing", c.env.ImagePath, "true"},
+			expectExit: 255,
+		},
+	}
+
+	for _, profile := range []e2e.Profile{e2e.UserProfile, e2e.UserNamespaceProfile, e2e.RootProfile} {
+		t.Run(profile.String(), func(t *testing.T) {
+			for _, tt := range tests {
+				c.env.RunApptainer(
+					t,
+					e2e.AsSubtest(tt.name),
+					e2e.WithProfile(profile),
+					e2e.WithCommand("exec"),
+					e2e.WithArgs(tt.argv...),
+					e2e.ExpectExit(tt.expectExit, tt.expectOp),
+				)
+			}
+		})
+	}
+}
+
+// testImageSecurityProfile tests that the security profile declared by the
+// %security section of a definition file is only applied to images signed
+// by a key trusted in apptainer.conf.
+func (c ctx) testImageSecurityProfile(t *testing.T) {
+	require.Seccomp(t)
+	e2e.EnsureImage(t, c.env)
+
+	tmpDir, remove := e2e.MakeTempDir(t, c.env.TestDir, "security-profile-", "")
+	pgpDir, _ := e2e.MakeKeysDir(t, tmpDir)
+	c.env.KeyringDir = pgpDir
+
+	const key1 = "0C5B8C9A5FFC44E2A0AC79851CD6FA281D476DD1"
+	const key2 = "78F8AD36B0DCB84B707F23853D608DAE21C8CA10"
+
+	defer func() {
+		e2e.ResetDirective(t, c.env, "security profile keys")
+		c.env.RunApptainer(
+			t,
+			e2e.WithProfile(e2e.RootProfile),
+			e2e.WithCommand("key remove"),
+			e2e.WithArgs("--global", key1),
+			e2e.ExpectExit(0),
+		)
+		remove(t)
+	}()
+
+	seccompProfile, err := filepath.Abs(filepath.Join("security", "testdata", "seccomp-profile.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	definition := fmt.Sprintf("Bootstrap: localimage\nFrom: %s\n\n%%files\n    %s /seccomp.json\n\n%%security\n    seccomp /seccomp.json\n", c.env.ImagePath, seccompProfile)
+	defFile, err := e2e.WriteTempFile(tmpDir, "security-profile-", definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imagePath := filepath.Join(tmpDir, "image.sif")
+
+	prep := []struct {
+		name       string
+		profile    e2e.Profile
+		command    string
+		args       []string
+		consoleOps []e2e.ApptainerConsoleOp
+	}{
+		{
+			name:    "build image",
+			profile: e2e.UserProfile,
+			command: "build",
+			args:    []string{imagePath, defFile},
+		},
+		{
+			name:    "import key1 local",
+			profile: e2e.UserProfile,
+			command: "key import",
+			args:    []string{"testdata/ecl-pgpkeys/key1.asc"},
+			consoleOps: []e2e.ApptainerConsoleOp{
+				e2e.ConsoleSendLine("e2e"),
+			},
+		},
+		{
+			name:    "sign image with key1",
+			profile: e2e.UserProfile,
+			command: "sign",
+			args:    []string{"-k", "0", imagePath},
+			consoleOps: []e2e.ApptainerConsoleOp{
+				e2e.ConsoleSendLine("e2e"),
+			},
+		},
+		{
+			name:    "import key1 global",
+			profile: e2e.RootProfile,
+			command: "key import",
+			args:    []string{"--global", "testdata/ecl-pgpkeys/pubkey1.asc"},
+		},
+	}
+	for _, tt := range prep {
+		cmdOps := []e2e.ApptainerCmdOp{
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(tt.profile),
+			e2e.WithCommand(tt.command),
+			e2e.WithArgs(tt.args...),
+			e2e.ExpectExit(0),
+		}
+		if tt.consoleOps != nil {
+			cmdOps = append(cmdOps, e2e.ConsoleRun(tt.consoleOps...))
+		}
+		c.env.RunApptainer(t, cmdOps...)
+	}
+
+	tests := []struct {
+		name       string
+		keys       string
+		expectExit int
+	}{
+		{"NoTrustedKeys", "", 0},
+		{"UntrustedKey", key2, 0},
+		// process should be killed with SIGSYS (128+31)
+		{"TrustedKey", key1, 159},
+	}
+	for _, tt := range tests {
+		if tt.keys != "" {
+			e2e.SetDirective(t, c.env, "security profile keys", tt.keys)
+		} else {
+			e2e.ResetDirective(t, c.env, "security profile keys")
+		}
+		for _, profile := range []e2e.Profile{e2e.UserProfile, e2e.UserNamespaceProfile} {
+			c.env.RunApptainer(
+				t,
+				e2e.AsSubtest(tt.name+"/"+profile.String()),
+				e2e.WithProfile(profile),
+				e2e.WithCommand("exec"),
+				e2e.WithArgs(imagePath, "sh", "-c", "mkdir /tmp/security-profile.$$ && rmdir /tmp/security-profile.$$"),
+				e2e.ExpectExit(tt.expectExit),
+			)
+		}
+	}
+}
+
 // E2ETests is the main func to trigger the test suite
 func E2ETests(env e2e.TestEnv) testhelper.Tests {
 	c := ctx{
@@ -388,5 +635,8 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 		"testSecurityConfOwnership": np(c.testSecurityConfOwnership),
 		"testApparmor":              c.testApparmor,
 		"testSELinux":               c.testSELinux,
+		"testSeccompRecord":         c.testSeccompRecord,
+		"testLandlock":              c.testLandlock,
+		"testImageSecurityProfile":  np(c.testImageSecurityProfile),
 	}
 }
@@ -17,6 +17,7 @@ import (
 
 	"github.com/apptainer/apptainer/e2e/internal/e2e"
 	"github.com/apptainer/apptainer/e2e/internal/testhelper"
+	"golang.org/x/crypto/ssh"
 )
 
 type ctx struct {
@@ -142,6 +143,55 @@ func (c *ctx) sign(t *testing.T) {
 				e2e.ExpectError(e2e.ContainMatch, "Signature created and applied"),
 			},
 		},
+		{
+			name:  "SSHKeyFlag",
+			flags: []string{"--ssh-key", keyPath},
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "Signing image with SSH key material from '"+keyPath+"'"),
+				e2e.ExpectError(e2e.ContainMatch, "Signature created and applied"),
+			},
+		},
+		{
+			name:       "SSHKeyAndKeyFlags",
+			flags:      []string{"--ssh-key", keyPath, "--key", keyPath},
+			expectCode: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "only one of --key, --ssh-key and --pkcs11-module can be used"),
+			},
+		},
+		{
+			name:       "PKCS11AndKeyFlags",
+			flags:      []string{"--pkcs11-module", "/nonexistent/module.so", "--key", keyPath},
+			expectCode: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "only one of --key, --ssh-key and --pkcs11-module can be used"),
+			},
+		},
+		{
+			name:       "TSAWithoutKey",
+			flags:      []string{"--tsa", "http://localhost:9999"},
+			expectCode: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "PGP signatures can't be timestamped"),
+			},
+		},
+		{
+			name:       "PKCS11WithoutKeyLabel",
+			flags:      []string{"--pkcs11-module", "/nonexistent/module.so"},
+			expectCode: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "--pkcs11-key is required with --pkcs11-module"),
+			},
+		},
+		{
+			name:       "PKCS11InvalidModule",
+			flags:      []string{"--pkcs11-module", "/nonexistent/module.so", "--pkcs11-key", "signing"},
+			envs:       []string{"APPTAINER_PKCS11_PIN=1234"},
+			expectCode: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "could not load PKCS#11 module /nonexistent/module.so"),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -159,6 +209,81 @@ func (c *ctx) sign(t *testing.T) {
 	}
 }
 
+// signSSH signs an image with an SSH key, and verifies it with an allowed
+// signers file.
+func (c *ctx) signSSH(t *testing.T) {
+	keyPath := filepath.Join("..", "test", "keys", "ed25519-private.pem")
+
+	b, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpDir, cleanup := e2e.MakeTempDir(t, c.TestDir, "sign-ssh-", "")
+	defer cleanup(t)
+
+	allowedSigners := filepath.Join(tmpDir, "allowed_signers")
+	line := `user@example.com namespaces="apptainer" ` + string(ssh.MarshalAuthorizedKey(s.PublicKey()))
+	if err := os.WriteFile(allowedSigners, []byte(line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	imgPath := getImage(t)
+	defer os.Remove(imgPath)
+
+	c.RunApptainer(t,
+		e2e.AsSubtest("Sign"),
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("sign"),
+		e2e.WithArgs("--ssh-key", keyPath, imgPath),
+		e2e.ExpectExit(0),
+	)
+
+	tests := []struct {
+		name       string
+		flags      []string
+		expectCode int
+		expectOps  []e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:  "Verify",
+			flags: []string{"--allowed-signers", allowedSigners},
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "Verifying image with SSH allowed signers from '"+allowedSigners+"'"),
+				e2e.ExpectError(e2e.ContainMatch, "Verified signature(s) from image"),
+			},
+		},
+		{
+			name:  "VerifyPrincipal",
+			flags: []string{"--allowed-signers", allowedSigners, "--principal", "user@example.com"},
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "Verified signature(s) from image"),
+			},
+		},
+		{
+			name:       "VerifyWrongPrincipal",
+			flags:      []string{"--allowed-signers", allowedSigners, "--principal", "other@example.com"},
+			expectCode: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, `no allowed signer for principal "other@example.com"`),
+			},
+		},
+	}
+	for _, tt := range tests {
+		c.RunApptainer(t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("verify"),
+			e2e.WithArgs(append(tt.flags, imgPath)...),
+			e2e.ExpectExit(tt.expectCode, tt.expectOps...),
+		)
+	}
+}
+
 func (c *ctx) importPGPKeypairs(t *testing.T) {
 	c.RunApptainer(
 		t,
@@ -194,6 +319,7 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 			c.importPGPKeypairs(t)
 
 			t.Run("Sign", c.sign)
+			t.Run("SignSSH", c.signSSH)
 		},
 	}
 }
@@ -43,6 +43,7 @@ import (
 	"github.com/apptainer/apptainer/e2e/keyserver"
 	"github.com/apptainer/apptainer/e2e/legacy"
 	"github.com/apptainer/apptainer/e2e/nested"
+	"github.com/apptainer/apptainer/e2e/network"
 	"github.com/apptainer/apptainer/e2e/oci"
 	"github.com/apptainer/apptainer/e2e/overlay"
 	"github.com/apptainer/apptainer/e2e/plugin"
@@ -230,6 +231,7 @@ func Run(t *testing.T) {
 	suite.AddGroup("KEYSERVER", keyserver.E2ETests)
 	suite.AddGroup("LEGACY", legacy.E2ETests)
 	suite.AddGroup("NESTED", nested.E2ETests)
+	suite.AddGroup("NETWORK", network.E2ETests)
 	suite.AddGroup("OCI", oci.E2ETests)
 	suite.AddGroup("OVERLAY", overlay.E2ETests)
 	suite.AddGroup("PLUGIN", plugin.E2ETests)
@@ -21,6 +21,8 @@ import (
 
 	"github.com/apptainer/apptainer/e2e/internal/e2e"
 	"github.com/apptainer/apptainer/e2e/internal/testhelper"
+	"github.com/apptainer/apptainer/internal/pkg/test/tool/tsa"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 )
 
 type ctx struct {
@@ -137,6 +139,45 @@ func (c *ctx) verify(t *testing.T) {
 				e2e.ExpectError(e2e.ContainMatch, "Verifying image with PGP key material"),
 			},
 		},
+		{
+			name:      "ThresholdOK",
+			imagePath: filepath.Join("..", "test", "images", "one-group-signed-pgp.sif"),
+			flags: []string{
+				"--local", "--threshold", "1",
+				"--fingerprint", "F34371D0ACD5D09EB9BD853A80600A5FA11BBD29",
+				"--fingerprint", "7064B1D6EFF01B1262FED3F03581D99FE87EAFD1",
+			},
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "Image signed by 1 of 2 fingerprint(s), 1 required"),
+				e2e.ExpectError(e2e.ContainMatch, "Satisfied: F34371D0ACD5D09EB9BD853A80600A5FA11BBD29"),
+				e2e.ExpectError(e2e.ContainMatch, "Missing: 7064B1D6EFF01B1262FED3F03581D99FE87EAFD1"),
+				e2e.ExpectError(e2e.ContainMatch, "Verified signature(s) from image"),
+			},
+		},
+		{
+			name:      "ThresholdNotMet",
+			imagePath: filepath.Join("..", "test", "images", "one-group-signed-pgp.sif"),
+			flags: []string{
+				"--local",
+				"--fingerprint", "F34371D0ACD5D09EB9BD853A80600A5FA11BBD29",
+				"--fingerprint", "7064B1D6EFF01B1262FED3F03581D99FE87EAFD1",
+			},
+			expectCode: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "Image signed by 1 of 2 fingerprint(s), 2 required"),
+				e2e.ExpectError(e2e.ContainMatch, "Missing: 7064B1D6EFF01B1262FED3F03581D99FE87EAFD1"),
+				e2e.ExpectError(e2e.ContainMatch, "image not signed by required entities"),
+			},
+		},
+		{
+			name:       "ThresholdWithoutFingerprint",
+			imagePath:  filepath.Join("..", "test", "images", "one-group-signed-pgp.sif"),
+			flags:      []string{"--local", "--threshold", "1"},
+			expectCode: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "--threshold requires at least one --fingerprint"),
+			},
+		},
 		{
 			name:      "KeyFlag",
 			flags:     []string{"--key", pubKeyPath},
@@ -249,6 +290,156 @@ func (c *ctx) verify(t *testing.T) {
 	}
 }
 
+// verifyTimestamp signs an image with an RFC 3161 timestamp, and verifies the
+// certificate at the timestamped time.
+func (c *ctx) verifyTimestamp(t *testing.T) {
+	keyPath := filepath.Join("..", "test", "keys", "rsa-private.pem")
+	certPath := filepath.Join("..", "test", "certs", "leaf.pem")
+	intPath := filepath.Join("..", "test", "certs", "intermediate.pem")
+	rootPath := filepath.Join("..", "test", "certs", "root.pem")
+
+	srv := tsa.NewServer(t)
+	srv.SetTime(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	tempDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "", "")
+	defer cleanup(t)
+
+	tsaRootPath := filepath.Join(tempDir, "tsa-root.pem")
+	if err := os.WriteFile(tsaRootPath, srv.RootPEM, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	imgPath := filepath.Join(tempDir, "timestamped.sif")
+	if err := fs.CopyFile(filepath.Join("..", "test", "images", "one-group.sif"), imgPath, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c.env.RunApptainer(t,
+		e2e.WithProfile(e2e.UserProfile),
+		e2e.WithCommand("sign"),
+		e2e.WithArgs("--key", keyPath, "--tsa", srv.URL, imgPath),
+		e2e.ExpectExit(0),
+	)
+
+	certFlags := []string{
+		"--certificate", certPath,
+		"--certificate-intermediates", intPath,
+		"--certificate-roots", rootPath,
+	}
+
+	tests := []struct {
+		name       string
+		flags      []string
+		imagePath  string
+		expectCode int
+		expectOps  []e2e.ApptainerCmdResultOp
+	}{
+		{
+			name:      "Timestamped",
+			flags:     append([]string{"--tsa-roots", tsaRootPath}, certFlags...),
+			imagePath: imgPath,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "Verified signature(s) from image"),
+			},
+		},
+		{
+			name:       "WrongTSARoots",
+			flags:      append([]string{"--tsa-roots", rootPath}, certFlags...),
+			imagePath:  imgPath,
+			expectCode: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "while verifying timestamp"),
+			},
+		},
+		{
+			name:       "NotTimestamped",
+			flags:      append([]string{"--tsa-roots", tsaRootPath}, certFlags...),
+			imagePath:  filepath.Join("..", "test", "images", "one-group-signed-dsse.sif"),
+			expectCode: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "signature is not timestamped"),
+			},
+		},
+		{
+			name:       "TSARootsWithoutCertificate",
+			flags:      []string{"--tsa-roots", tsaRootPath, "--key", filepath.Join("..", "test", "keys", "rsa-public.pem")},
+			imagePath:  imgPath,
+			expectCode: 255,
+			expectOps: []e2e.ApptainerCmdResultOp{
+				e2e.ExpectError(e2e.ContainMatch, "--tsa-roots requires a certificate"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("verify"),
+			e2e.WithArgs(append(tt.flags, tt.imagePath)...),
+			e2e.ExpectExit(tt.expectCode, tt.expectOps...),
+		)
+	}
+}
+
+// verifySigstoreBundle checks the flag requirements of --sigstore-bundle, and
+// that invalid bundles and trusted roots are rejected.
+func (c *ctx) verifySigstoreBundle(t *testing.T) {
+	imgPath := filepath.Join("..", "test", "images", "one-group-signed-dsse.sif")
+
+	tempDir, cleanup := e2e.MakeTempDir(t, c.env.TestDir, "", "")
+	defer cleanup(t)
+
+	invalidPath := filepath.Join(tempDir, "invalid.json")
+	if err := os.WriteFile(invalidPath, []byte(`{"mediaType": "application/json"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	identityFlags := []string{
+		"--certificate-identity", "user@example.com",
+		"--certificate-oidc-issuer", "https://issuer.example.com",
+	}
+
+	tests := []struct {
+		name      string
+		flags     []string
+		expectErr string
+	}{
+		{
+			name:      "NoTrustedRoot",
+			flags:     append([]string{"--sigstore-bundle", invalidPath}, identityFlags...),
+			expectErr: "--sigstore-bundle requires --trusted-root",
+		},
+		{
+			name:      "NoIdentity",
+			flags:     []string{"--sigstore-bundle", invalidPath, "--trusted-root", invalidPath},
+			expectErr: "--sigstore-bundle requires --certificate-identity and --certificate-oidc-issuer",
+		},
+		{
+			name: "WithKey",
+			flags: append([]string{
+				"--sigstore-bundle", invalidPath, "--trusted-root", invalidPath,
+				"--key", filepath.Join("..", "test", "keys", "ecdsa-public.pem"),
+			}, identityFlags...),
+			expectErr: "--key can't be used with --sigstore-bundle",
+		},
+		{
+			name:      "InvalidTrustedRoot",
+			flags:     append([]string{"--sigstore-bundle", invalidPath, "--trusted-root", invalidPath}, identityFlags...),
+			expectErr: "Failed to load trusted root",
+		},
+	}
+
+	for _, tt := range tests {
+		c.env.RunApptainer(t,
+			e2e.AsSubtest(tt.name),
+			e2e.WithProfile(e2e.UserProfile),
+			e2e.WithCommand("verify"),
+			e2e.WithArgs(append(tt.flags, imgPath)...),
+			e2e.ExpectExit(255, e2e.ExpectError(e2e.ContainMatch, tt.expectErr)),
+		)
+	}
+}
+
 func (c *ctx) importPGPKeypairs(t *testing.T) {
 	c.env.RunApptainer(
 		t,
@@ -311,6 +502,8 @@ func E2ETests(env e2e.TestEnv) testhelper.Tests {
 			c.importPGPKeypairs(t)
 
 			t.Run("Verify", c.verify)
+			t.Run("VerifyTimestamp", c.verifyTimestamp)
 		},
+		"VerifySigstoreBundle": c.verifySigstoreBundle,
 	}
 }
@@ -21,6 +21,12 @@ import (
 
 // KeyserverLogin logs in to a keyserver.
 func KeyserverLogin(usrConfigFile string, args *LoginArgs) (err error) {
+	unlock, err := lockConfig(usrConfigFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// opening config file
 	file, err := os.OpenFile(usrConfigFile, os.O_RDWR|os.O_CREATE, 0o600)
 	if err != nil {
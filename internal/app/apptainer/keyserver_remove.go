@@ -26,6 +26,12 @@ func KeyserverRemove(name, uri string) error {
 		return fmt.Errorf("invalid URI: cannot have empty URI")
 	}
 
+	unlock, err := lockConfig(remote.SystemConfigPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// opening config file
 	file, err := os.OpenFile(remote.SystemConfigPath, os.O_RDWR|os.O_CREATE, 0o644)
 	if err != nil {
@@ -0,0 +1,324 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/pkg/network"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/runtime/engine/config"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/apptainer/pkg/util/apptainerconf"
+	"github.com/containernetworking/cni/libcni"
+)
+
+// networkFilePrefix is the ordering prefix of configuration files
+// created by 'network create', placed after the default networks.
+const networkFilePrefix = "50_"
+
+// networkConf associates a network configuration with its file.
+type networkConf struct {
+	path string
+	conf *libcni.NetworkConfigList
+}
+
+// cniPaths returns the CNI configuration and plugin directories set
+// in apptainer.conf or their default values.
+func cniPaths() (confPath, pluginPath string) {
+	cfg := apptainerconf.GetCurrentConfig()
+	if cfg != nil {
+		confPath = cfg.CniConfPath
+		pluginPath = cfg.CniPluginPath
+	}
+	if confPath == "" {
+		confPath = filepath.Join(buildcfg.SYSCONFDIR, "apptainer", "network")
+	}
+	if pluginPath == "" {
+		pluginPath = filepath.Join(buildcfg.LIBEXECDIR, "apptainer", "cni")
+	}
+	return confPath, pluginPath
+}
+
+// loadNetworks returns the network configurations found in the CNI
+// configuration directory, sorted by file name.
+func loadNetworks(confPath string) ([]networkConf, error) {
+	files, err := libcni.ConfFiles(confPath, []string{".conf", ".json", ".conflist"})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	networks := make([]networkConf, 0, len(files))
+	for _, file := range files {
+		var conf *libcni.NetworkConfigList
+		if strings.HasSuffix(file, ".conflist") {
+			conf, err = libcni.NetworkConfFromFile(file)
+		} else {
+			var c *libcni.NetworkConfig
+			// Note - deprecations warnings disabled - this code is explicitly
+			// to handle files in non-conflist format.
+			c, err = libcni.ConfFromFile(file) //nolint:staticcheck
+			if err == nil {
+				conf, err = libcni.ConfListFromConf(c) //nolint:staticcheck
+			}
+		}
+		if err != nil {
+			sylog.Warningf("Ignoring %s: %s", file, err)
+			continue
+		}
+		networks = append(networks, networkConf{path: file, conf: conf})
+	}
+	return networks, nil
+}
+
+// findNetwork returns the configuration of the named network.
+func findNetwork(confPath, name string) (*networkConf, error) {
+	networks, err := loadNetworks(confPath)
+	if err != nil {
+		return nil, err
+	}
+	for i := range networks {
+		if networks[i].conf.Name == name {
+			return &networks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("network %s not found in %s", name, confPath)
+}
+
+// networkSubnets returns the subnets declared by the IPAM configuration
+// of the network plugins.
+func networkSubnets(conf *libcni.NetworkConfigList) []string {
+	var subnets []string
+	for _, p := range conf.Plugins {
+		ipam := struct {
+			IPAM struct {
+				Type   string `json:"type"`
+				Subnet string `json:"subnet"`
+				Ranges [][]struct {
+					Subnet string `json:"subnet"`
+				} `json:"ranges"`
+				Addresses []struct {
+					Address string `json:"address"`
+				} `json:"addresses"`
+			} `json:"ipam"`
+		}{}
+		if err := json.Unmarshal(p.Bytes, &ipam); err != nil {
+			continue
+		}
+		if ipam.IPAM.Subnet != "" {
+			subnets = append(subnets, ipam.IPAM.Subnet)
+		}
+		for _, rs := range ipam.IPAM.Ranges {
+			for _, r := range rs {
+				subnets = append(subnets, r.Subnet)
+			}
+		}
+		for _, a := range ipam.IPAM.Addresses {
+			subnets = append(subnets, a.Address)
+		}
+		if ipam.IPAM.Type == "dhcp" {
+			subnets = append(subnets, "dhcp")
+		}
+	}
+	return subnets
+}
+
+// networkInstances returns the names of running instances attached to
+// each network. Root sees the instances of all users, other users see
+// their own instances.
+func networkInstances() map[string][]string {
+	users := []string{""}
+	if os.Geteuid() == 0 {
+		users = instanceUsers()
+	}
+
+	attached := make(map[string][]string)
+	for _, u := range users {
+		files, err := instance.List(u, "*", instance.AppSubDir, true)
+		if err != nil {
+			sylog.Debugf("Could not list instances of user %q: %s", u, err)
+			continue
+		}
+		for _, file := range files {
+			engineConfig := apptainerConfig.NewConfig()
+			common := &config.Common{EngineConfig: engineConfig}
+			if err := json.Unmarshal(file.Config, common); err != nil {
+				continue
+			}
+			name := file.Name
+			if os.Geteuid() == 0 {
+				name = file.User + "/" + file.Name
+			}
+			for _, n := range strings.Split(engineConfig.GetNetwork(), ",") {
+				if n != "" && n != "none" {
+					attached[n] = append(attached[n], name)
+				}
+			}
+		}
+	}
+	for n := range attached {
+		sort.Strings(attached[n])
+	}
+	return attached
+}
+
+// instanceUsers returns the users running instances, found by
+// looking for instance master processes.
+func instanceUsers() []string {
+	users := []string{}
+	seen := make(map[string]bool)
+
+	cmdlines, _ := filepath.Glob("/proc/[0-9]*/cmdline")
+	for _, c := range cmdlines {
+		b, err := os.ReadFile(c)
+		if err != nil {
+			continue
+		}
+		// instance master process name is "<prefix>: <user> [<name>]"
+		rest, ok := strings.CutPrefix(string(b), instance.ProgPrefix+": ")
+		if !ok {
+			continue
+		}
+		u, _, ok := strings.Cut(rest, " [")
+		if ok && !seen[u] {
+			seen[u] = true
+			users = append(users, u)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+// ListNetworks lists the CNI networks available to containers and
+// the running instances attached to them.
+func ListNetworks(w io.Writer) error {
+	confPath, _ := cniPaths()
+	networks, err := loadNetworks(confPath)
+	if err != nil {
+		return fmt.Errorf("while loading network configurations: %s", err)
+	}
+	attached := networkInstances()
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tSUBNET\tINSTANCES")
+	for _, n := range networks {
+		netType := ""
+		if len(n.conf.Plugins) > 0 && n.conf.Plugins[0].Network != nil {
+			netType = n.conf.Plugins[0].Network.Type
+		}
+		subnet := strings.Join(networkSubnets(n.conf), ",")
+		if subnet == "" {
+			subnet = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", n.conf.Name, netType, subnet, len(attached[n.conf.Name]))
+	}
+	return tw.Flush()
+}
+
+// InspectNetwork displays the configuration of a CNI network, the
+// availability of its plugins and the running instances attached to it.
+func InspectNetwork(w io.Writer, name string) error {
+	confPath, pluginPath := cniPaths()
+	n, err := findNetwork(confPath, name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Name:      %s\n", n.conf.Name)
+	fmt.Fprintf(w, "File:      %s\n", n.path)
+	fmt.Fprintf(w, "Plugins:   %s\n", strings.Join(network.PluginTypes(n.conf), ", "))
+	if missing := network.MissingPlugins(n.conf, pluginPath); len(missing) > 0 {
+		fmt.Fprintf(w, "Missing:   %s (in %s)\n", strings.Join(missing, ", "), pluginPath)
+	}
+	instances := networkInstances()[n.conf.Name]
+	if len(instances) > 0 {
+		fmt.Fprintf(w, "Instances: %s\n", strings.Join(instances, ", "))
+	} else {
+		fmt.Fprintf(w, "Instances: none\n")
+	}
+	fmt.Fprintf(w, "Configuration:\n%s\n", strings.TrimSpace(string(n.conf.Bytes)))
+	return nil
+}
+
+// CreateNetwork generates a CNI network configuration file from the
+// provided options, after checking that the required plugins exist.
+func CreateNetwork(opts network.ConfListOptions) error {
+	confPath, pluginPath := cniPaths()
+
+	b, err := network.NewConfList(opts)
+	if err != nil {
+		return err
+	}
+	conf, err := libcni.ConfListFromBytes(b)
+	if err != nil {
+		return fmt.Errorf("while checking generated configuration: %s", err)
+	}
+	if missing := network.MissingPlugins(conf, pluginPath); len(missing) > 0 {
+		return fmt.Errorf("CNI plugins %s not found in %s", strings.Join(missing, ", "), pluginPath)
+	}
+
+	if _, err := findNetwork(confPath, opts.Name); err == nil {
+		return fmt.Errorf("network %s already exists", opts.Name)
+	}
+
+	path := filepath.Join(confPath, networkFilePrefix+opts.Name+".conflist")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("network configuration file %s already exists", path)
+		}
+		return fmt.Errorf("while creating %s: %s", path, err)
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("while writing %s: %s", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("while writing %s: %s", path, err)
+	}
+
+	sylog.Infof("Network %s created in %s", opts.Name, path)
+	return nil
+}
+
+// RemoveNetwork removes the configuration file of a CNI network. A
+// network with running instances attached is only removed if force
+// is true.
+func RemoveNetwork(name string, force bool) error {
+	confPath, _ := cniPaths()
+	n, err := findNetwork(confPath, name)
+	if err != nil {
+		return err
+	}
+
+	if instances := networkInstances()[name]; len(instances) > 0 {
+		if !force {
+			return fmt.Errorf("network %s is used by instances %s, use --force to remove it anyway", name, strings.Join(instances, ", "))
+		}
+		sylog.Warningf("Removing network %s used by instances %s", name, strings.Join(instances, ", "))
+	}
+
+	if err := os.Remove(n.path); err != nil {
+		return fmt.Errorf("while removing %s: %s", n.path, err)
+	}
+	sylog.Infof("Network %s removed (%s)", name, n.path)
+	return nil
+}
@@ -11,6 +11,7 @@
 package apptainer
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -21,6 +22,12 @@ import (
 
 // RegistryLogin logs in to an OCI/Docker registry.
 func RegistryLogin(usrConfigFile string, args *LoginArgs) (err error) {
+	unlock, err := lockConfig(usrConfigFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// opening config file
 	file, err := os.OpenFile(usrConfigFile, os.O_RDWR|os.O_CREATE, 0o600)
 	if err != nil {
@@ -38,7 +45,12 @@ func RegistryLogin(usrConfigFile string, args *LoginArgs) (err error) {
 		return err
 	}
 
-	if err := c.Login(args.Name, args.Username, args.Password, args.Insecure, args.ReqAuthFile); err != nil {
+	if args.OIDC {
+		err = registryOIDCLogin(c, args)
+	} else {
+		err = c.Login(args.Name, args.Username, args.Password, args.Insecure, args.ReqAuthFile)
+	}
+	if err != nil {
 		return fmt.Errorf("while login to %s: %s", args.Name, err)
 	}
 
@@ -62,3 +74,30 @@ func RegistryLogin(usrConfigFile string, args *LoginArgs) (err error) {
 	sylog.Infof("Token stored in %s", file.Name())
 	return nil
 }
+
+// registryOIDCLogin logs in to an OCI/Docker registry with an access token
+// obtained by a device login with the OIDC provider of the default remote.
+func registryOIDCLogin(c *remote.Config, args *LoginArgs) error {
+	// refreshed tokens are stored in the default auth file
+	if args.ReqAuthFile != "" {
+		return fmt.Errorf("--authfile is not supported with --oidc")
+	}
+	if args.Username == "" {
+		return fmt.Errorf("Docker/OCI registry requires a username")
+	}
+
+	ep, err := c.GetDefault()
+	if err != nil {
+		return err
+	}
+	oc, err := ep.OIDCConfig()
+	if err != nil {
+		return err
+	}
+	token, err := oc.DeviceLogin(context.TODO(), printDeviceCode)
+	if err != nil {
+		return fmt.Errorf("while logging in with OIDC provider %s: %v", oc.Issuer, err)
+	}
+
+	return c.LoginOIDC(args.Name, args.Username, oc, token, args.Insecure)
+}
@@ -37,6 +37,12 @@ func RemoteAdd(configFile, name, uri string, global bool, insecure bool, makeDef
 		perm = os.FileMode(0o644)
 	}
 
+	unlock, err := lockConfig(configFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// opening config file
 	file, err := os.OpenFile(configFile, os.O_RDWR|os.O_CREATE, perm)
 	if err != nil {
@@ -0,0 +1,62 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/apptainer/apptainer/internal/pkg/remote"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/pkg/util/fs/lock"
+)
+
+// lockConfig applies an exclusive lock serializing the updates of the remote
+// config file configFile, it must be taken before opening the file. The lock
+// is held on the parent directory as the file may be replaced by a rename.
+// The returned function releases the lock and may be called more than once.
+func lockConfig(configFile string) (func(), error) {
+	dir := filepath.Dir(configFile)
+	fd, err := lock.Exclusive(dir)
+	if err != nil {
+		return nil, fmt.Errorf("while acquiring lock in %s: %s", dir, err)
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { lock.Release(fd) })
+	}, nil
+}
+
+// writeConfig replaces the remote config file configFile with c, through
+// a temporary file renamed over it so that readers never see a partial file.
+func writeConfig(configFile string, c *remote.Config, mode os.FileMode) error {
+	file, err := fs.MakeTmpFile(filepath.Dir(configFile), filepath.Base(configFile)+".*", mode)
+	if err != nil {
+		return fmt.Errorf("while creating remote config file: %s", err)
+	}
+	defer func() {
+		file.Close()
+		os.Remove(file.Name())
+	}()
+
+	if _, err := c.WriteTo(file); err != nil {
+		return fmt.Errorf("while writing remote config to file: %s", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to flush remote config file %s: %s", file.Name(), err)
+	}
+
+	if err := os.Rename(file.Name(), configFile); err != nil {
+		return fmt.Errorf("while replacing remote config file %s: %s", configFile, err)
+	}
+	return nil
+}
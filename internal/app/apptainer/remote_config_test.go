@@ -0,0 +1,117 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apptainer/apptainer/internal/pkg/remote"
+	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
+	"github.com/apptainer/apptainer/internal/pkg/test"
+	"github.com/apptainer/apptainer/pkg/util/fs/lock"
+)
+
+func TestLockConfig(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "remote.yaml")
+
+	unlock, err := lockConfig(cfgFile)
+	if err != nil {
+		t.Fatalf("unexpected error while locking %s: %s", cfgFile, err)
+	}
+
+	fd, acquired, err := lock.TryExclusive(dir)
+	if err != nil {
+		t.Fatalf("unexpected error while locking %s: %s", dir, err)
+	} else if acquired {
+		lock.Release(fd)
+		t.Fatalf("lock of %s acquired while held by lockConfig", dir)
+	}
+
+	// releasing more than once is allowed
+	unlock()
+	unlock()
+
+	fd, acquired, err = lock.TryExclusive(dir)
+	if err != nil {
+		t.Fatalf("unexpected error while locking %s: %s", dir, err)
+	} else if !acquired {
+		t.Fatalf("lock of %s not acquired after release", dir)
+	}
+	lock.Release(fd)
+}
+
+func TestWriteConfig(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "remote.yaml")
+
+	if err := os.WriteFile(cfgFile, []byte("previous content\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &remote.Config{
+		DefaultRemote: validRemoteName,
+		Remotes: map[string]*endpoint.Config{
+			validRemoteName: {URI: validURI},
+		},
+	}
+	if err := writeConfig(cfgFile, c, 0o600); err != nil {
+		t.Fatalf("unexpected error while writing %s: %s", cfgFile, err)
+	}
+
+	fi, err := os.Stat(cfgFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0o600 {
+		t.Errorf("unexpected mode %o for %s, expected 600", mode, cfgFile)
+	}
+
+	f, err := os.Open(cfgFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := remote.ReadFrom(f)
+	if err != nil {
+		t.Fatalf("unexpected error while reading %s: %s", cfgFile, err)
+	}
+	if ep, err := r.GetDefault(); err != nil {
+		t.Errorf("unexpected error while getting default remote: %s", err)
+	} else if ep.URI != validURI {
+		t.Errorf("unexpected default remote URI %q, expected %q", ep.URI, validURI)
+	}
+
+	// the temporary file was renamed over the config file
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("unexpected %d entries in %s, expected 1", len(entries), dir)
+	}
+}
+
+func TestRefreshTokensNoConfig(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	if err := RefreshTokens(filepath.Join(t.TempDir(), "remote.yaml")); err != nil {
+		t.Errorf("unexpected error without remote config file: %s", err)
+	}
+}
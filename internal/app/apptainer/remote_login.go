@@ -11,12 +11,14 @@
 package apptainer
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 
 	"github.com/apptainer/apptainer/internal/pkg/remote"
+	"github.com/apptainer/apptainer/internal/pkg/remote/credential"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	"github.com/apptainer/apptainer/internal/pkg/util/auth"
 	"github.com/apptainer/apptainer/internal/pkg/util/interactive"
@@ -30,6 +32,8 @@ type LoginArgs struct {
 	Tokenfile   string
 	Insecure    bool
 	ReqAuthFile string
+	// OIDC logs in with the OIDC provider of the default remote
+	OIDC bool
 }
 
 // ErrLoginAborted is raised when the login process has been aborted by the user
@@ -39,6 +43,12 @@ var ErrLoginAborted = errors.New("user aborted login")
 // If the supplied remote name is an empty string, it will attempt
 // to use the default remote.
 func RemoteLogin(usrConfigFile string, args *LoginArgs) (err error) {
+	unlock, err := lockConfig(usrConfigFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// opening config file
 	file, err := os.OpenFile(usrConfigFile, os.O_RDWR|os.O_CREATE, 0o600)
 	if err != nil {
@@ -78,6 +88,7 @@ func RemoteLogin(usrConfigFile string, args *LoginArgs) (err error) {
 			return fmt.Errorf("--tokenfile is only supported for login to a remote endpoint, not OCI (docker/oras) or keyservers")
 		}
 		sylog.Warningf("'remote login' is deprecated for registries or keyservers and will be removed in a future release; running 'registry login'")
+		unlock()
 		return RegistryLogin(usrConfigFile, args)
 	}
 
@@ -109,6 +120,13 @@ func endPointLogin(ep *endpoint.Config, args *LoginArgs) error {
 		token string
 		err   error
 	)
+	if args.OIDC {
+		if args.Tokenfile != "" {
+			return fmt.Errorf("--tokenfile and --oidc are mutually exclusive")
+		}
+		return oidcEndPointLogin(ep)
+	}
+
 	// Non-interactive with a token file
 	if args.Tokenfile != "" {
 		token, err = auth.ReadToken(args.Tokenfile)
@@ -152,5 +170,74 @@ func endPointLogin(ep *endpoint.Config, args *LoginArgs) error {
 	}
 	// Token is verified, update the endpoint config with it
 	ep.Token = token
+	ep.OIDC = nil
 	return nil
 }
+
+// oidcEndPointLogin sets a new token against a remote endpoint config, obtained
+// by a device login with the OIDC provider advertised by the endpoint.
+func oidcEndPointLogin(ep *endpoint.Config) error {
+	oc, err := ep.OIDCConfig()
+	if err != nil {
+		return err
+	}
+	token, err := oc.DeviceLogin(context.TODO(), printDeviceCode)
+	if err != nil {
+		return fmt.Errorf("while logging in with OIDC provider %s: %v", oc.Issuer, err)
+	}
+
+	if err := ep.VerifyToken(token.AccessToken); err != nil {
+		return fmt.Errorf("while verifying token: %v", err)
+	}
+	ep.Token = token.AccessToken
+	ep.OIDC = credential.NewOIDCLogin(oc, "", token)
+	return nil
+}
+
+// printDeviceCode prints the instructions to authorize a device login.
+func printDeviceCode(dc credential.DeviceCode) {
+	if dc.VerificationURIComplete != "" {
+		fmt.Printf("Open %s in a browser to log in, and check that the code %s is shown.\n", dc.VerificationURIComplete, dc.UserCode)
+	} else {
+		fmt.Printf("Open %s in a browser to log in, and enter the code %s.\n", dc.VerificationURI, dc.UserCode)
+	}
+	fmt.Println("Waiting for the login to complete...")
+}
+
+// RefreshTokens refreshes the access tokens obtained by OIDC logins to remotes
+// and registries which expire soon, updating the remote config file.
+func RefreshTokens(usrConfigFile string) error {
+	if _, err := os.Stat(usrConfigFile); os.IsNotExist(err) {
+		return nil
+	}
+
+	unlock, err := lockConfig(usrConfigFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := os.Open(usrConfigFile)
+	if err != nil && os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("while opening remote config file: %s", err)
+	}
+	defer file.Close()
+
+	c, err := remote.ReadFrom(file)
+	if err != nil {
+		return fmt.Errorf("while parsing remote config data: %s", err)
+	}
+
+	updated, refreshErr := c.RefreshTokens(context.TODO())
+	if !updated {
+		return refreshErr
+	}
+
+	if err := writeConfig(usrConfigFile, c, 0o600); err != nil {
+		return err
+	}
+
+	return refreshErr
+}
@@ -22,6 +22,12 @@ import (
 
 // RemoteLogout logs out from an endpoint.
 func RemoteLogout(usrConfigFile, name string) (err error) {
+	unlock, err := lockConfig(usrConfigFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// opening config file
 	file, err := os.OpenFile(usrConfigFile, os.O_RDWR|os.O_CREATE, 0o600)
 	if err != nil {
@@ -52,6 +58,7 @@ func RemoteLogout(usrConfigFile, name string) (err error) {
 	} else {
 		// services
 		sylog.Warningf("'remote logout' is deprecated for registries or keyservers and will be removed in a future release; running 'registry logout'")
+		unlock()
 		return RegistryLogout(usrConfigFile, name, "")
 	}
 
@@ -76,6 +83,12 @@ func RemoteLogout(usrConfigFile, name string) (err error) {
 }
 
 func CommonLoggout(usrConfigFile, name string, reqAuthFile string) (err error) {
+	unlock, err := lockConfig(usrConfigFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// opening config file
 	file, err := os.OpenFile(usrConfigFile, os.O_RDWR|os.O_CREATE, 0o600)
 	if err != nil {
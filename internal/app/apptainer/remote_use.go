@@ -54,6 +54,12 @@ func RemoteUse(usrConfigFile, name string, global, exclusive bool) (err error) {
 		perm = os.FileMode(0o644)
 	}
 
+	unlock, err := lockConfig(usrConfigFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// opening config file
 	file, err := os.OpenFile(usrConfigFile, os.O_RDWR|os.O_CREATE, perm)
 	if err != nil {
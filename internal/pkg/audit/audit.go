@@ -0,0 +1,156 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package audit writes structured audit events of container starts and
+// exits, in JSON format, to a file, syslog or journald.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/journal"
+	"golang.org/x/sys/unix"
+)
+
+// Audit log destinations of the audit log directive.
+const (
+	DestNone     = "none"
+	DestFile     = "file"
+	DestSyslog   = "syslog"
+	DestJournald = "journald"
+)
+
+// Event types.
+const (
+	EventStart = "start"
+	EventExit  = "exit"
+)
+
+// Bind describes a bind mount of the container.
+type Bind struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	ReadOnly    bool   `json:"readonly"`
+}
+
+// Event is an audit event of a container start or exit.
+type Event struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	// PID is the container process PID.
+	PID      int    `json:"pid,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	UID  int    `json:"uid"`
+	GID  int    `json:"gid"`
+	GIDs []int  `json:"gids,omitempty"`
+	User string `json:"user,omitempty"`
+
+	Image string `json:"image"`
+	// ImagePath is the resolved path of the image.
+	ImagePath string `json:"image_path"`
+	// ImageDigest is the sha256:<hex> digest of the image file.
+	ImageDigest string `json:"image_digest,omitempty"`
+	// Signers are the fingerprints of the keys of the global keyring which
+	// signed the image.
+	Signers []string `json:"signers,omitempty"`
+
+	Command      []string        `json:"command"`
+	Binds        []Bind          `json:"binds,omitempty"`
+	Namespaces   []string        `json:"namespaces,omitempty"`
+	Capabilities []string        `json:"capabilities,omitempty"`
+	Cgroups      json.RawMessage `json:"cgroups,omitempty"`
+
+	// ExitCode is the exit code of the container process, set for exit
+	// events when the process was not killed by a signal.
+	ExitCode *int `json:"exit_code,omitempty"`
+	// Signal is the name of the signal which killed the container process.
+	Signal string `json:"signal,omitempty"`
+}
+
+// Start returns the start event of the container process pid.
+func (e Event) Start(pid int) Event {
+	e.Time = time.Now()
+	e.Event = EventStart
+	e.PID = pid
+	return e
+}
+
+// Exit returns the exit event of the container process with its wait
+// status.
+func (e Event) Exit(status syscall.WaitStatus) Event {
+	e.Time = time.Now()
+	e.Event = EventExit
+	if status.Signaled() {
+		e.Signal = unix.SignalName(status.Signal())
+	} else {
+		code := status.ExitStatus()
+		e.ExitCode = &code
+	}
+	return e
+}
+
+// Write writes the event to the destination dest, path is the audit log
+// file for the file destination.
+func Write(dest, path string, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	switch dest {
+	case DestNone, "":
+		return nil
+	case DestFile:
+		return writeFile(path, b)
+	case DestSyslog:
+		w, err := syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_INFO, "apptainer")
+		if err != nil {
+			return fmt.Errorf("while connecting to syslog: %s", err)
+		}
+		defer w.Close()
+		return w.Info(string(b))
+	case DestJournald:
+		if !journal.Enabled() {
+			return fmt.Errorf("journald is not available")
+		}
+		return journal.Send(string(b), journal.PriInfo, map[string]string{
+			"SYSLOG_IDENTIFIER": "apptainer",
+			"APPTAINER_EVENT":   e.Event,
+			"APPTAINER_UID":     strconv.Itoa(e.UID),
+			"APPTAINER_IMAGE":   e.ImagePath,
+		})
+	}
+	return fmt.Errorf("unknown audit log destination %q", dest)
+}
+
+// writeFile appends an event line to the audit log file, creating it
+// readable by its owner only.
+func writeFile(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("while creating audit log directory: %s", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("while opening audit log file: %s", err)
+	}
+	defer f.Close()
+
+	// a single write with O_APPEND keeps concurrent events on their own line
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("while writing audit log file: %s", err)
+	}
+	return nil
+}
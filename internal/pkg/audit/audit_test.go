@@ -0,0 +1,99 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestStartExit(t *testing.T) {
+	ev := Event{UID: 1000, Command: []string{"true"}}
+
+	start := ev.Start(42)
+	if start.Event != EventStart || start.PID != 42 || start.Time.IsZero() {
+		t.Errorf("unexpected start event %+v", start)
+	}
+
+	tests := []struct {
+		name     string
+		status   syscall.WaitStatus
+		exitCode *int
+		signal   string
+	}{
+		{"Exited", syscall.WaitStatus(3 << 8), func() *int { i := 3; return &i }(), ""},
+		{"Signaled", syscall.WaitStatus(syscall.SIGKILL), nil, "SIGKILL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exit := start.Exit(tt.status)
+			if exit.Event != EventExit || exit.PID != 42 {
+				t.Errorf("unexpected exit event %+v", exit)
+			}
+			if !reflect.DeepEqual(exit.ExitCode, tt.exitCode) {
+				t.Errorf("got exit code %v, want %v", exit.ExitCode, tt.exitCode)
+			}
+			if exit.Signal != tt.signal {
+				t.Errorf("got signal %q, want %q", exit.Signal, tt.signal)
+			}
+		})
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log", "audit.log")
+
+	ev := Event{UID: 1000, Image: "alpine.sif", Command: []string{"true"}}
+	for _, e := range []Event{ev.Start(42), ev.Start(42).Exit(0)} {
+		if err := Write(DestFile, path, e); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0o600 {
+		t.Errorf("got audit log permissions %o, want 600", perm)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var events []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid audit event %q: %s", scanner.Text(), err)
+		}
+		events = append(events, e.Event)
+	}
+	if want := []string{EventStart, EventExit}; !reflect.DeepEqual(events, want) {
+		t.Errorf("got events %v, want %v", events, want)
+	}
+}
+
+func TestWriteUnknown(t *testing.T) {
+	if err := Write(DestNone, "", Event{}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := Write("database", "", Event{}); err == nil {
+		t.Errorf("unexpected success with an unknown destination")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/policy"
+	"github.com/apptainer/apptainer/internal/pkg/sypgp"
+	"github.com/apptainer/apptainer/pkg/image"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+)
+
+// NewEvent describes the container started by the user uid with an opened
+// image and an engine configuration. The image digest and signers, which
+// require to read the whole image, are only computed with digest set,
+// signers are verified with the global keyring.
+func NewEvent(img *image.Image, c *apptainerConfig.EngineConfig, uid int, gids []int, digest bool) (Event, error) {
+	var kr openpgp.KeyRing
+	if digest {
+		keyring := sypgp.NewHandle(buildcfg.APPTAINER_CONFDIR, sypgp.GlobalHandleOpt())
+		el, err := keyring.LoadPubKeyring()
+		if err != nil {
+			return Event{}, fmt.Errorf("while obtaining global keyring: %s", err)
+		}
+		kr = el
+	}
+
+	source := c.GetImageArg()
+	if source == "" {
+		source = img.Path
+	}
+	i, err := policy.NewImage(img, digest, kr)
+	if err != nil {
+		return Event{}, err
+	}
+	u := policy.NewUser(uid, gids)
+	r := policy.NewRequest(c)
+
+	e := Event{
+		UID:         u.UID,
+		GID:         u.GID,
+		GIDs:        u.GIDs,
+		User:        u.Name,
+		Image:       source,
+		ImagePath:   i.Path,
+		ImageDigest: i.Digest,
+		Signers:     i.Signers,
+		Namespaces:  r.Namespaces,
+	}
+	if c.OciConfig.Process != nil {
+		e.Command = c.OciConfig.Process.Args
+		if c.OciConfig.Process.Capabilities != nil {
+			e.Capabilities = c.OciConfig.Process.Capabilities.Permitted
+		}
+	}
+	for _, b := range r.Binds {
+		e.Binds = append(e.Binds, Bind{
+			Source:      b.Source,
+			Destination: b.Destination,
+			ReadOnly:    b.ReadOnly,
+		})
+	}
+	if cg := c.GetCgroupsJSON(); cg != "" && json.Valid([]byte(cg)) {
+		e.Cgroups = json.RawMessage(cg)
+	}
+	return e, nil
+}
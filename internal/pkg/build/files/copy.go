@@ -55,7 +55,7 @@ func makeParentDir(path string) error {
 // All symlinks encountered in the copy will be dereferenced (cp -L behavior).
 func CopyFromHost(src, dstRel, dstRootfs string) error {
 	// resolve any bash globbing in filepath
-	paths, err := expandPath(src)
+	paths, err := ExpandPath(src)
 	if err != nil {
 		return fmt.Errorf("while expanding source path with bash: %s: %s", src, err)
 	}
@@ -108,7 +108,7 @@ func CopyFromStage(src, dst, srcRootfs, dstRootfs string) error {
 	srcAbs := joinKeepSlash(srcRootfs, src)
 
 	// resolve any bash globbing in filepath
-	paths, err := expandPath(srcAbs)
+	paths, err := ExpandPath(srcAbs)
 	if err != nil {
 		return fmt.Errorf("while expanding source path with bash: %s: %s", srcAbs, err)
 	}
@@ -19,7 +19,9 @@ import (
 	"mvdan.cc/sh/v3/syntax"
 )
 
-func expandPath(path string) ([]string, error) {
+// ExpandPath returns the paths matching the bash glob pattern path, or path
+// itself if none matches.
+func ExpandPath(path string) ([]string, error) {
 	path = strings.ReplaceAll(path, " ", "\\ ")
 	parsedPath, err := syntax.NewParser().Document(strings.NewReader(path))
 	if err != nil {
@@ -234,7 +234,7 @@ func TestExpandPath(t *testing.T) {
 			// make tt.path relative to testDir
 			path := filepath.Join(testDir, tt.path) // + "/" + tt.path
 			// run it through wildcard function
-			files, err := expandPath(path)
+			files, err := ExpandPath(path)
 			if err != nil {
 				t.Errorf("while expanding path: %s", err)
 			}
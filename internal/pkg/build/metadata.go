@@ -23,6 +23,7 @@ import (
 
 	"github.com/apptainer/apptainer/internal/pkg/build/oci"
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/security/profile"
 	"github.com/apptainer/apptainer/pkg/build/types"
 	"github.com/apptainer/apptainer/pkg/build/types/parser"
 	"github.com/apptainer/apptainer/pkg/image"
@@ -66,6 +67,11 @@ func (s *stage) insertMetadata() error {
 		return fmt.Errorf("while inserting test script: %v", err)
 	}
 
+	// insert security profile
+	if err := insertSecurityProfile(s.b); err != nil {
+		return fmt.Errorf("while inserting security profile: %v", err)
+	}
+
 	// insert JSON inspect metadata (must be the last call)
 	if err := insertJSONInspectMetadata(s.b, []string{"--all"}); err != nil {
 		return fmt.Errorf("while inserting JSON inspect metadata: %v", err)
@@ -287,6 +293,28 @@ func insertLabelsJSON(b *types.Bundle) (err error) {
 	return err
 }
 
+func insertSecurityProfile(b *types.Bundle) error {
+	if !b.RunSection("security") || strings.TrimSpace(b.Recipe.Security.Script) == "" {
+		return nil
+	}
+
+	readFile := func(name string) ([]byte, error) {
+		return b.Rootfs.ReadFile(strings.TrimPrefix(filepath.Clean(name), "/"))
+	}
+	p, err := profile.Parse(b.Recipe.Security.Script, readFile)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	b.JSONObjects[image.SIFDescSecurityProfileJSON] = data
+
+	return nil
+}
+
 func insertJSONInspectMetadata(b *types.Bundle, inspectOpt []string) error {
 	metadata := new(inspect.Metadata)
 
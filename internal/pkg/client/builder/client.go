@@ -0,0 +1,316 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package builder implements a client of the build server, running builds
+// remotely.
+package builder
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	buildserver "github.com/apptainer/apptainer/internal/pkg/server/builder"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	jsonresp "github.com/sylabs/json-resp"
+	"golang.org/x/net/websocket"
+)
+
+// Config is the configuration of a build server client.
+type Config struct {
+	// BaseURL is the base URL of the build server.
+	BaseURL string
+	// AuthToken is the bearer token authenticating with the build server.
+	AuthToken string
+	// UserAgent is the user agent sent to the build server.
+	UserAgent string
+	// HTTPClient is the HTTP client used, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// Client is a build server client.
+type Client struct {
+	baseURL    *url.URL
+	authToken  string
+	userAgent  string
+	httpClient *http.Client
+}
+
+// NewClient returns a client of the build server described by cfg.
+func NewClient(cfg *Config) (*Client, error) {
+	u, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid build server URL %q: %w", cfg.BaseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid build server URL %q: scheme must be http or https", cfg.BaseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	c := &Client{
+		baseURL:    u,
+		authToken:  cfg.AuthToken,
+		userAgent:  cfg.UserAgent,
+		httpClient: cfg.HTTPClient,
+	}
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+	return c, nil
+}
+
+// url returns the URL of the build server API at path.
+func (c *Client) url(path string) *url.URL {
+	u := *c.baseURL
+	u.Path += path
+	return &u
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.authToken)
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	return req, nil
+}
+
+// do sends req, decoding the build description of the response into info.
+func (c *Client) do(req *http.Request) (buildserver.BuildInfo, error) {
+	var info buildserver.BuildInfo
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return info, err
+	}
+	defer res.Body.Close()
+
+	if err := jsonresp.ReadResponse(res.Body, &info); err != nil {
+		return info, fmt.Errorf("build server: %w", err)
+	}
+	return info, nil
+}
+
+// Submit submits the build of the definition def with the options of br,
+// sending the files copied from the host by def along.
+func (c *Client) Submit(ctx context.Context, def []byte, br buildserver.BuildRequest) (buildserver.BuildInfo, error) {
+	def, sources, err := contextDefinition(def)
+	if err != nil {
+		return buildserver.BuildInfo{}, err
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeForm(mw, def, br, sources))
+	}()
+	defer pr.Close()
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/v1/builds", pr)
+	if err != nil {
+		return buildserver.BuildInfo{}, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	return c.do(req)
+}
+
+// writeForm writes the multipart form submitting a build to mw.
+func writeForm(mw *multipart.Writer, def []byte, br buildserver.BuildRequest, sources []source) error {
+	w, err := mw.CreateFormField(buildserver.RequestField)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(w).Encode(br); err != nil {
+		return err
+	}
+
+	w, err = mw.CreateFormField(buildserver.DefinitionField)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(def); err != nil {
+		return err
+	}
+
+	if len(sources) > 0 {
+		w, err = mw.CreateFormFile(buildserver.ContextField, "context.tar.gz")
+		if err != nil {
+			return err
+		}
+		if err := writeContext(w, sources); err != nil {
+			return fmt.Errorf("while sending %%files sources: %w", err)
+		}
+	}
+
+	return mw.Close()
+}
+
+// Info returns the description of the build id.
+func (c *Client) Info(ctx context.Context, id string) (buildserver.BuildInfo, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/v1/builds/"+url.PathEscape(id), nil)
+	if err != nil {
+		return buildserver.BuildInfo{}, err
+	}
+	return c.do(req)
+}
+
+// Delete cancels the build id if in progress, and removes it from the build
+// server.
+func (c *Client) Delete(ctx context.Context, id string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, "/v1/builds/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(req)
+	return err
+}
+
+// FollowLog writes the log of the build id to w as it is written, until the
+// build completes.
+func (c *Client) FollowLog(ctx context.Context, id string, w io.Writer) error {
+	u := c.url("/v1/builds/" + url.PathEscape(id) + "/log")
+	origin := c.url("").String()
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+
+	config, err := websocket.NewConfig(u.String(), origin)
+	if err != nil {
+		return err
+	}
+	if c.authToken != "" {
+		config.Header.Set("Authorization", "Bearer "+c.authToken)
+	}
+	if c.userAgent != "" {
+		config.Header.Set("User-Agent", c.userAgent)
+	}
+
+	ws, err := config.DialContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to follow build log: %w", err)
+	}
+	defer ws.Close()
+
+	// unblock the reads on cancellation
+	stop := context.AfterFunc(ctx, func() { ws.Close() })
+	defer stop()
+
+	for {
+		var p []byte
+		if err := websocket.Message.Receive(ws, &p); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("while reading build log: %w", err)
+		}
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+}
+
+// Download downloads the image built by the build id to dest, checking it
+// against checksum.
+func (c *Client) Download(ctx context.Context, id, dest, checksum string) error {
+	req, err := c.newRequest(ctx, http.MethodGet, "/v1/builds/"+url.PathEscape(id)+"/image", nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("build server: %w", jsonresp.ReadError(res.Body))
+	}
+
+	// download next to dest, to only replace it once complete
+	f, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), res.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("while downloading image: %w", err)
+	}
+
+	if got := "sha256." + hex.EncodeToString(h.Sum(nil)); got != checksum {
+		return fmt.Errorf("image checksum %s does not match the expected %s", got, checksum)
+	}
+	if err := os.Chmod(f.Name(), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), dest)
+}
+
+// Build builds the definition def with the options of br on the build
+// server, writing the build log to log. The image built is downloaded to dest,
+// unless pushed to a library by the build server.
+func (c *Client) Build(ctx context.Context, def []byte, br buildserver.BuildRequest, dest string, log io.Writer) error {
+	info, err := c.Submit(ctx, def, br)
+	if err != nil {
+		return fmt.Errorf("unable to submit build: %w", err)
+	}
+	sylog.Infof("Build %s submitted to %s", info.ID, c.baseURL)
+
+	// the build is canceled if interrupted, and removed once downloaded
+	defer func() {
+		if err := c.Delete(context.WithoutCancel(ctx), info.ID); err != nil {
+			sylog.Warningf("Unable to remove build %s: %v", info.ID, err)
+		}
+	}()
+
+	if err := c.FollowLog(ctx, info.ID, log); err != nil {
+		return err
+	}
+
+	info, err = c.Info(ctx, info.ID)
+	if err != nil {
+		return err
+	}
+	switch info.State {
+	case buildserver.StateSucceeded:
+	case buildserver.StateFailed:
+		return fmt.Errorf("remote build failed: %s", info.Error)
+	default:
+		return fmt.Errorf("remote build %s", info.State)
+	}
+
+	if info.LibraryRef != "" {
+		return nil
+	}
+	return c.Download(ctx, info.ID, dest, info.ImageChecksum)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package builder
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	buildserver "github.com/apptainer/apptainer/internal/pkg/server/builder"
+)
+
+const testToken = "s3cr3t"
+
+// testCommand fakes the build command, writing the definition followed by
+// the %files sources of the context to the image. Definitions holding fail
+// make the build fail.
+const testCommand = `#!/bin/sh
+while [ $# -gt 2 ]; do shift; done
+echo "Building $1"
+grep -q fail "$2" && exit 1
+cat "$2" > "$1"
+if [ -d files ]; then find files -type f | sort | xargs cat >> "$1"; fi
+`
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+
+	command := filepath.Join(t.TempDir(), "apptainer")
+	if err := os.WriteFile(command, []byte(testCommand), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s, err := buildserver.New(buildserver.Config{
+		Dir:     t.TempDir(),
+		Tokens:  map[string]string{testToken: "alice"},
+		Command: command,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+
+	c, err := NewClient(&Config{BaseURL: ts.URL, AuthToken: testToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestBuild(t *testing.T) {
+	c := newTestClient(t)
+
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("a.txt", []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	def := "Bootstrap: scratch\n%files\n    a.txt /a.txt\n"
+	dest := filepath.Join(t.TempDir(), "image.sif")
+	var log bytes.Buffer
+	if err := c.Build(context.Background(), []byte(def), buildserver.BuildRequest{}, dest, &log); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(log.String(), "Building ") {
+		t.Errorf("unexpected log %q", log.String())
+	}
+	image, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Bootstrap: scratch\n%files\n\tfiles/0/a.txt /a.txt\ncontent"; string(image) != want {
+		t.Errorf("got image %q, want %q", image, want)
+	}
+
+	// the build is removed once downloaded
+	entries, err := os.ReadDir(filepath.Dir(dest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("unexpected files next to the image: %v", entries)
+	}
+}
+
+func TestBuildFailed(t *testing.T) {
+	c := newTestClient(t)
+
+	dest := filepath.Join(t.TempDir(), "image.sif")
+	err := c.Build(context.Background(), []byte("Bootstrap: fail\n"), buildserver.BuildRequest{}, dest, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "remote build failed") {
+		t.Fatalf("got error %v, want remote build failure", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("unexpected image after failed build: %v", err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	c := newTestClient(t)
+	c.authToken = "invalid"
+
+	_, err := c.Submit(context.Background(), []byte("Bootstrap: scratch\n"), buildserver.BuildRequest{})
+	if err == nil || !strings.Contains(err.Error(), "authentication required") {
+		t.Errorf("got error %v, want authentication failure", err)
+	}
+}
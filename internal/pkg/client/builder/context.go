@@ -0,0 +1,206 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package builder
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/apptainer/apptainer/internal/pkg/build/files"
+)
+
+var (
+	// stageHeader matches the first line of the header of a stage.
+	stageHeader = regexp.MustCompile(`(?i)^bootstrap:`)
+	// filesSplitter splits the lines of %files sections at spaces, but not
+	// within quotes.
+	filesSplitter = regexp.MustCompile(`[^\s"']+|"([^"]*)"|'([^']*)'`)
+)
+
+// source is a %files source sent in the context.
+type source struct {
+	// path is the path of the source on the host.
+	path string
+	// name is the path of the source in the context.
+	name string
+}
+
+// quote returns s, quoted if holding spaces.
+func quote(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// contextDefinition returns def with the sources of its %files sections
+// copying files from the host replaced with their path in the context, and
+// the sources to send in the context. The %files sections copying files from
+// other stages are left unchanged.
+func contextDefinition(def []byte) ([]byte, []source, error) {
+	var out bytes.Buffer
+	var sources []source
+
+	inFiles := false
+	scanner := bufio.NewScanner(bytes.NewReader(def))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+
+		switch {
+		case len(fields) > 0 && strings.HasPrefix(fields[0], "%"):
+			inFiles = strings.EqualFold(fields[0], "%files") && len(fields) == 1
+		case stageHeader.MatchString(line):
+			inFiles = false
+		case inFiles && len(fields) > 0 && !strings.HasPrefix(fields[0], "#"):
+			tokens := filesSplitter.FindAllString(line, -1)
+			if len(tokens) == 0 {
+				break
+			}
+			src := strings.Trim(tokens[0], `"'`)
+			dst := ""
+			if len(tokens) > 1 {
+				dst = tokens[1]
+			}
+
+			// sources are globbed on the host, as done by local builds,
+			// relative to the current directory
+			pattern := src
+			if !filepath.IsAbs(src) {
+				pattern = "./" + src
+			}
+			paths, err := files.ExpandPath(pattern)
+			if err != nil {
+				return nil, nil, fmt.Errorf("while expanding %%files source %s: %w", src, err)
+			}
+			for _, p := range paths {
+				p = filepath.Clean(p)
+				if _, err := os.Stat(p); err != nil {
+					return nil, nil, fmt.Errorf("%%files source %s: %w", src, err)
+				}
+				base := filepath.Base(p)
+				if base == "/" || base == "." || base == ".." {
+					return nil, nil, fmt.Errorf("%%files source %s: can't copy %s remotely", src, p)
+				}
+				s := source{
+					path: p,
+					name: path.Join("files", fmt.Sprint(len(sources)), base),
+				}
+				sources = append(sources, s)
+
+				// an empty destination is the path of the source
+				pdst := dst
+				if pdst == "" {
+					pdst = quote(p)
+				}
+				fmt.Fprintf(&out, "\t%s %s\n", quote(s.name), pdst)
+			}
+			continue
+		}
+
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return out.Bytes(), sources, nil
+}
+
+// writeContext writes the gzip compressed tar archive of sources to w.
+func writeContext(w io.Writer, sources []source) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+
+	for _, s := range sources {
+		if err := addPath(tw, s.path, s.name, nil); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// addPath adds the file or directory at src to tw as name, following
+// symbolic links as done when copying files into local builds. parents holds
+// the directories being added, to detect loops.
+func addPath(tw *tar.Writer, src, name string, parents []string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		real, err := filepath.EvalSymlinks(src)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(parents, real) {
+			return fmt.Errorf("%s: symbolic link loop", src)
+		}
+
+		err = tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     name + "/",
+			Mode:     int64(fi.Mode().Perm()),
+			ModTime:  fi.ModTime(),
+		})
+		if err != nil {
+			return err
+		}
+
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := addPath(tw, filepath.Join(src, e.Name()), name+"/"+e.Name(), append(parents, real)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s: unsupported file type", src)
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(fi.Mode().Perm()),
+		Size:     fi.Size(),
+		ModTime:  fi.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
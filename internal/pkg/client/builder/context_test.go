@@ -0,0 +1,197 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestContextDefinition(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	tests := []struct {
+		name    string
+		def     string
+		wantDef string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "Files",
+			def: `Bootstrap: scratch
+%files
+    a.txt /opt/a.txt
+    # comment
+    "*.txt" /opt
+%post
+    a.txt /opt
+`,
+			wantDef: `Bootstrap: scratch
+%files
+	files/0/a.txt /opt/a.txt
+    # comment
+	files/1/a.txt /opt
+	files/2/b.txt /opt
+%post
+    a.txt /opt
+`,
+			want: map[string]string{
+				"files/0/a.txt": "a.txt",
+				"files/1/a.txt": "a.txt",
+				"files/2/b.txt": "b.txt",
+			},
+		},
+		{
+			name: "NoDestination",
+			def: `Bootstrap: scratch
+%files
+    ` + filepath.Join(dir, "a.txt") + `
+`,
+			wantDef: `Bootstrap: scratch
+%files
+	files/0/a.txt ` + filepath.Join(dir, "a.txt") + `
+`,
+			want: map[string]string{
+				"files/0/a.txt": "a.txt",
+			},
+		},
+		{
+			name: "FromStage",
+			def: `Bootstrap: scratch
+Stage: one
+%files
+    a.txt /a.txt
+
+Bootstrap: scratch
+Stage: two
+%files from one
+    /a.txt /b.txt
+`,
+			wantDef: `Bootstrap: scratch
+Stage: one
+%files
+	files/0/a.txt /a.txt
+
+Bootstrap: scratch
+Stage: two
+%files from one
+    /a.txt /b.txt
+`,
+			want: map[string]string{
+				"files/0/a.txt": "a.txt",
+			},
+		},
+		{
+			name: "Missing",
+			def: `Bootstrap: scratch
+%files
+    missing /missing
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def, sources, err := contextDefinition([]byte(tt.def))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if string(def) != tt.wantDef {
+				t.Errorf("got definition:\n%s\nwant:\n%s", def, tt.wantDef)
+			}
+
+			var buf bytes.Buffer
+			if err := writeContext(&buf, sources); err != nil {
+				t.Fatal(err)
+			}
+			if got := readContext(t, &buf); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got context %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteContextDirectory(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(filepath.Join("d", "e"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("d", "e", "f"), []byte("f"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, sources, err := contextDefinition([]byte("Bootstrap: scratch\n%files\n    d /d\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeContext(&buf, sources); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"files/0/d/":    "",
+		"files/0/d/e/":  "",
+		"files/0/d/e/f": "f",
+	}
+	if got := readContext(t, &buf); !reflect.DeepEqual(got, want) {
+		t.Errorf("got context %v, want %v", got, want)
+	}
+
+	// symbolic link loops are detected
+	if err := os.Symlink("..", filepath.Join("d", "e", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeContext(io.Discard, sources); err == nil {
+		t.Errorf("unexpected success writing symbolic link loop")
+	}
+}
+
+// readContext returns the contents of the entries of the gzip compressed tar
+// archive r.
+func readContext(t *testing.T, r io.Reader) map[string]string {
+	t.Helper()
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+
+	entries := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return entries
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[hdr.Name] = string(b)
+	}
+}
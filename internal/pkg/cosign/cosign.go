@@ -0,0 +1,254 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package cosign signs and verifies images in OCI registries, with signatures
+// in the format of cosign, stored in a signature image tagged
+// sha256-<digest>.sig, or attached through the referrers API.
+package cosign
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+const (
+	// SimpleSigningMediaType is the media type of the layers holding a signed payload.
+	SimpleSigningMediaType types.MediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// ArtifactType is the artifact type of signature images attached through the referrers API.
+	ArtifactType = "application/vnd.dev.cosign.artifact.sig.v1+json"
+
+	// signatureAnnotation is the layer annotation holding the base64 encoded signature of the
+	// payload.
+	signatureAnnotation = "dev.cosignproject.cosign/signature"
+	// payloadType is the type of the payloads signing an image.
+	payloadType = "cosign container image signature"
+
+	// maxPayloadSize bounds the size of the payloads read from a registry.
+	maxPayloadSize = 1 << 20
+)
+
+var (
+	// ErrNoSignatures is returned when no signatures are found for an image.
+	ErrNoSignatures = errors.New("no signatures found")
+	// ErrNoValidSignature is returned when none of the signatures of an image verify.
+	ErrNoValidSignature = errors.New("no valid signature found")
+)
+
+// payload is the simple signing payload signed for an image.
+type payload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]any `json:"optional"`
+}
+
+// Resolve returns the digest of the manifest, or index, that ref points to.
+func Resolve(ref name.Reference, opts ...remote.Option) (name.Digest, error) {
+	if d, ok := ref.(name.Digest); ok {
+		return d, nil
+	}
+	desc, err := remote.Head(ref, opts...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("while resolving %s: %w", ref, err)
+	}
+	return ref.Context().Digest(desc.Digest.String()), nil
+}
+
+// signatureTag returns the tag of the signature image of the image d.
+func signatureTag(d name.Digest) (name.Tag, error) {
+	h, err := v1.NewHash(d.DigestStr())
+	if err != nil {
+		return name.Tag{}, err
+	}
+	return d.Context().Tag(fmt.Sprintf("%s-%s.sig", h.Algorithm, h.Hex)), nil
+}
+
+// isNotFound returns true if err is a registry error for a missing manifest.
+func isNotFound(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound
+}
+
+// Sign signs the image d with s, and adds the signature to the signature image of d, creating
+// it if needed.
+func Sign(d name.Digest, s signature.Signer, opts ...remote.Option) error {
+	var p payload
+	p.Critical.Identity.DockerReference = d.Context().Name()
+	p.Critical.Image.DockerManifestDigest = d.DigestStr()
+	p.Critical.Type = payloadType
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	sig, err := s.SignMessage(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("while signing payload: %w", err)
+	}
+
+	tag, err := signatureTag(d)
+	if err != nil {
+		return err
+	}
+	img, err := remote.Image(tag, opts...)
+	if isNotFound(err) {
+		img = mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+		img = mutate.ConfigMediaType(img, types.OCIConfigJSON)
+	} else if err != nil {
+		return fmt.Errorf("while fetching signatures of %s: %w", d, err)
+	}
+
+	img, err = mutate.Append(img, mutate.Addendum{
+		Layer: static.NewLayer(b, SimpleSigningMediaType),
+		Annotations: map[string]string{
+			signatureAnnotation: base64.StdEncoding.EncodeToString(sig),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := remote.Write(tag, img, opts...); err != nil {
+		return fmt.Errorf("while writing signatures of %s: %w", d, err)
+	}
+	sylog.Debugf("Wrote signature of %s to %s", d, tag)
+	return nil
+}
+
+// signatureImages returns the signature images of d, tagged or attached through the referrers
+// API.
+func signatureImages(d name.Digest, opts ...remote.Option) ([]v1.Image, error) {
+	var imgs []v1.Image
+
+	tag, err := signatureTag(d)
+	if err != nil {
+		return nil, err
+	}
+	img, err := remote.Image(tag, opts...)
+	if err == nil {
+		imgs = append(imgs, img)
+	} else if !isNotFound(err) {
+		return nil, fmt.Errorf("while fetching signatures of %s: %w", d, err)
+	}
+
+	idx, err := remote.Referrers(d, append(opts, remote.WithFilter("artifactType", ArtifactType))...)
+	if err != nil {
+		// registries may not support the referrers API, nor its fallback tag schema
+		sylog.Debugf("Ignoring referrers of %s: %v", d, err)
+		return imgs, nil
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range im.Manifests {
+		if desc.ArtifactType != ArtifactType {
+			continue
+		}
+		img, err := remote.Image(d.Context().Digest(desc.Digest.String()), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("while fetching signature %s of %s: %w", desc.Digest, d, err)
+		}
+		imgs = append(imgs, img)
+	}
+	return imgs, nil
+}
+
+// verifyLayer verifies the signature of the payload of layer l of img with v, and checks the
+// payload signs the image d.
+func verifyLayer(img v1.Image, l v1.Descriptor, d name.Digest, v signature.Verifier) error {
+	sig, err := base64.StdEncoding.DecodeString(l.Annotations[signatureAnnotation])
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+
+	layer, err := img.LayerByDigest(l.Digest)
+	if err != nil {
+		return err
+	}
+	rc, err := layer.Compressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, maxPayloadSize))
+	if err != nil {
+		return err
+	}
+
+	if err := v.VerifySignature(bytes.NewReader(sig), bytes.NewReader(b)); err != nil {
+		return err
+	}
+
+	var p payload
+	if err := json.Unmarshal(b, &p); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if p.Critical.Type != payloadType {
+		return fmt.Errorf("unexpected payload type %q", p.Critical.Type)
+	}
+	if p.Critical.Image.DockerManifestDigest != d.DigestStr() {
+		return fmt.Errorf("payload signs %s, not %s", p.Critical.Image.DockerManifestDigest, d.DigestStr())
+	}
+	return nil
+}
+
+// Verify checks that the image d has at least one signature verified by v.
+func Verify(d name.Digest, v signature.Verifier, opts ...remote.Option) error {
+	imgs, err := signatureImages(d, opts...)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, img := range imgs {
+		m, err := img.Manifest()
+		if err != nil {
+			return err
+		}
+		for _, l := range m.Layers {
+			if l.MediaType != SimpleSigningMediaType {
+				continue
+			}
+			found = true
+
+			if err := verifyLayer(img, l, d, v); err != nil {
+				sylog.Debugf("Ignoring signature layer %s: %v", l.Digest, err)
+				continue
+			}
+			return nil
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("%w for %s", ErrNoSignatures, d)
+	}
+	return fmt.Errorf("%w for %s", ErrNoValidSignature, d)
+}
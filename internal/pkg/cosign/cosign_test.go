@@ -0,0 +1,190 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cosign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+// pushImage starts a registry, pushes a random image to it, and returns the image reference.
+func pushImage(t *testing.T, repo string) name.Reference {
+	t.Helper()
+
+	srv := httptest.NewServer(registry.New(registry.WithReferrersSupport(true), registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(srv.Close)
+
+	ref, err := name.ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/" + repo + ":latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+func newSignerVerifier(t *testing.T) signature.SignerVerifier {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv, err := signature.LoadECDSASignerVerifier(key, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sv
+}
+
+func TestSignVerify(t *testing.T) {
+	ref := pushImage(t, "test/sign")
+	d, err := Resolve(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sv := newSignerVerifier(t)
+	other := newSignerVerifier(t)
+
+	if err := Verify(d, sv); !errors.Is(err, ErrNoSignatures) {
+		t.Errorf("got error %v, want %v", err, ErrNoSignatures)
+	}
+
+	if err := Sign(d, sv); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	if err := Verify(d, sv); err != nil {
+		t.Errorf("failed to verify: %v", err)
+	}
+	if err := Verify(d, other); !errors.Is(err, ErrNoValidSignature) {
+		t.Errorf("got error %v, want %v", err, ErrNoValidSignature)
+	}
+
+	// A second signature is added to the signature image.
+	if err := Sign(d, other); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	for _, v := range []signature.Verifier{sv, other} {
+		if err := Verify(d, v); err != nil {
+			t.Errorf("failed to verify: %v", err)
+		}
+	}
+	tag, err := signatureTag(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := remote.Image(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layers, err := img.Layers(); err != nil {
+		t.Fatal(err)
+	} else if len(layers) != 2 {
+		t.Errorf("got %d signature layers, want 2", len(layers))
+	}
+
+	// A signature of another image doesn't verify this one.
+	otherDigest := d.Context().Digest("sha256:" + strings.Repeat("0", 64))
+	if err := writeSignatureAt(d, otherDigest); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(otherDigest, sv); !errors.Is(err, ErrNoValidSignature) {
+		t.Errorf("got error %v, want %v", err, ErrNoValidSignature)
+	}
+}
+
+// writeSignatureAt copies the signature image of from to the signature tag of to.
+func writeSignatureAt(from, to name.Digest) error {
+	ft, err := signatureTag(from)
+	if err != nil {
+		return err
+	}
+	tt, err := signatureTag(to)
+	if err != nil {
+		return err
+	}
+	img, err := remote.Image(ft)
+	if err != nil {
+		return err
+	}
+	return remote.Write(tt, img)
+}
+
+func TestVerifyReferrers(t *testing.T) {
+	ref := pushImage(t, "test/referrers")
+	d, err := Resolve(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv := newSignerVerifier(t)
+
+	// Sign with a tag, then move the signature image to a referrer of the image.
+	if err := Sign(d, sv); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	tag, err := signatureTag(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := remote.Image(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Delete(tag); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(d, sv); !errors.Is(err, ErrNoSignatures) {
+		t.Fatalf("got error %v, want %v", err, ErrNoSignatures)
+	}
+
+	desc, err := remote.Head(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = mutate.ConfigMediaType(img, types.MediaType(ArtifactType))
+	img = mutate.Subject(img, v1.Descriptor{
+		MediaType: desc.MediaType,
+		Digest:    desc.Digest,
+		Size:      desc.Size,
+	}).(v1.Image)
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(d.Context().Digest(h.String()), img); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Verify(d, sv); err != nil {
+		t.Errorf("failed to verify: %v", err)
+	}
+}
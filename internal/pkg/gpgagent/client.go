@@ -0,0 +1,325 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package gpgagent implements a client of the Assuan protocol of gpg-agent,
+// to list and sign with the keys it holds, including the keys stored on
+// smartcards, without the private key material leaving the agent.
+package gpgagent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// socketName is the name of the standard socket of gpg-agent.
+const socketName = "S.gpg-agent"
+
+// gpgErrNoSecretKey is the GPG_ERR_NO_SECKEY error code.
+const gpgErrNoSecretKey = 17
+
+// ErrNoSecretKey is returned when the agent doesn't hold a secret key.
+var ErrNoSecretKey = errors.New("no secret key")
+
+// Error is an error returned by gpg-agent.
+type Error struct {
+	Code    uint32
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("gpg-agent: %s (%d)", e.Message, e.Code)
+}
+
+// Is returns whether the error matches target, ErrNoSecretKey matches the
+// GPG_ERR_NO_SECKEY errors of all error sources.
+func (e *Error) Is(target error) bool {
+	return target == ErrNoSecretKey && e.Code&0xffff == gpgErrNoSecretKey
+}
+
+// KeyInfo describes a key held by gpg-agent.
+type KeyInfo struct {
+	// Keygrip is the hex encoded keygrip identifying the key in the agent.
+	Keygrip string
+	// Smartcard is true when the key is stored on a smartcard.
+	Smartcard bool
+	// SerialNumber is the serial number of the smartcard holding the key.
+	SerialNumber string
+}
+
+// Client is a connection to gpg-agent. It is not safe for concurrent use.
+type Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// SocketPath returns the path of the gpg-agent socket, as reported by
+// gpgconf, or the standard socket of the GnuPG home directory.
+func SocketPath() (string, error) {
+	if out, err := exec.Command("gpgconf", "--list-dirs", "agent-socket").Output(); err == nil {
+		if p := strings.TrimSpace(string(out)); p != "" {
+			return unescape(p), nil
+		}
+	}
+
+	if home := os.Getenv("GNUPGHOME"); home != "" {
+		return filepath.Join(home, socketName), nil
+	}
+	if p := filepath.Join("/run/user", strconv.Itoa(os.Getuid()), "gnupg", socketName); fileExists(p) {
+		return p, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not locate gpg-agent socket: %w", err)
+	}
+	return filepath.Join(home, ".gnupg", socketName), nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Connect connects to the running gpg-agent, starting it with gpgconf if it
+// isn't running yet.
+func Connect() (*Client, error) {
+	path, err := SocketPath()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := Dial(path)
+	if err == nil {
+		return c, nil
+	}
+	sylog.Debugf("Could not connect to gpg-agent at %s: %v", path, err)
+
+	if lerr := exec.Command("gpgconf", "--launch", "gpg-agent").Run(); lerr != nil {
+		return nil, fmt.Errorf("could not connect to gpg-agent at %s: %w", path, err)
+	}
+	return Dial(path)
+}
+
+// Dial connects to the gpg-agent socket at path, following the redirection
+// of the socket files used on systems without Unix sockets support.
+func Dial(path string) (*Client, error) {
+	b, err := os.ReadFile(path)
+	if err == nil && bytes.HasPrefix(b, []byte("%Assuan%\nsocket=")) {
+		line, _, _ := bytes.Cut(b[len("%Assuan%\nsocket="):], []byte("\n"))
+		path = string(line)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+	if _, err := c.response(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("while connecting to gpg-agent: %w", err)
+	}
+
+	c.setOptions()
+
+	return c, nil
+}
+
+// Close closes the connection to the agent.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// setOptions passes the terminal and display of the user to the agent, so
+// pinentry can prompt for the passphrase or PIN of keys.
+func (c *Client) setOptions() {
+	tty := os.Getenv("GPG_TTY")
+	if tty == "" {
+		if p, err := os.Readlink("/proc/self/fd/0"); err == nil && strings.HasPrefix(p, "/dev/") {
+			tty = p
+		}
+	}
+
+	options := []struct{ name, value string }{
+		{"ttyname", tty},
+		{"ttytype", os.Getenv("TERM")},
+		{"display", os.Getenv("DISPLAY")},
+	}
+	for _, o := range options {
+		if o.value == "" {
+			continue
+		}
+		if _, err := c.transact("OPTION " + o.name + "=" + escape(o.value)); err != nil {
+			sylog.Debugf("Could not set gpg-agent option %s: %v", o.name, err)
+		}
+	}
+}
+
+// response is the data and status lines returned by a command.
+type response struct {
+	data   []byte
+	status []string
+}
+
+// transact sends cmd to the agent and returns its response.
+func (c *Client) transact(cmd string) (*response, error) {
+	if _, err := c.conn.Write([]byte(cmd + "\n")); err != nil {
+		return nil, err
+	}
+	return c.response()
+}
+
+// response reads the response of a command, up to its final OK or ERR line.
+// Inquiries of the agent are declined, except the PINENTRY_LAUNCHED
+// notification.
+func (c *Client) response() (*response, error) {
+	res := new(response)
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" || strings.HasPrefix(line, "#") {
+			// comment line
+			continue
+		}
+
+		keyword, rest, _ := strings.Cut(line, " ")
+		switch keyword {
+		case "OK":
+			return res, nil
+		case "ERR":
+			code, msg, _ := strings.Cut(rest, " ")
+			n, err := strconv.ParseUint(code, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("gpg-agent: %s", rest)
+			}
+			return nil, &Error{Code: uint32(n), Message: msg}
+		case "D":
+			res.data = append(res.data, unescape(rest)...)
+		case "S":
+			res.status = append(res.status, rest)
+		case "INQUIRE":
+			reply := "CAN"
+			if name, _, _ := strings.Cut(rest, " "); name == "PINENTRY_LAUNCHED" {
+				reply = "END"
+			}
+			if _, err := c.conn.Write([]byte(reply + "\n")); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unexpected response from gpg-agent: %q", line)
+		}
+	}
+}
+
+// Keys returns the keys held by the agent.
+func (c *Client) Keys() ([]KeyInfo, error) {
+	res, err := c.transact("KEYINFO --list")
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []KeyInfo
+	for _, s := range res.status {
+		// KEYINFO <keygrip> <type> <serialno> <idstr> ...
+		f := strings.Fields(s)
+		if len(f) < 4 || f[0] != "KEYINFO" {
+			continue
+		}
+		k := KeyInfo{
+			Keygrip:   f[1],
+			Smartcard: f[2] == "T",
+		}
+		if f[3] != "-" {
+			k.SerialNumber = f[3]
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// HasKey returns whether the agent holds the key with keygrip.
+func (c *Client) HasKey(keygrip string) (bool, error) {
+	if err := checkKeygrip(keygrip); err != nil {
+		return false, err
+	}
+	_, err := c.transact("HAVEKEY " + keygrip)
+	if errors.Is(err, ErrNoSecretKey) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ReadKey returns the public key of the key with keygrip, a *rsa.PublicKey,
+// *ecdsa.PublicKey or ed25519.PublicKey.
+func (c *Client) ReadKey(keygrip string) (any, error) {
+	if err := checkKeygrip(keygrip); err != nil {
+		return nil, err
+	}
+	res, err := c.transact("READKEY " + keygrip)
+	if err != nil {
+		return nil, fmt.Errorf("while reading key %s: %w", keygrip, err)
+	}
+	return parsePublicKey(res.data)
+}
+
+// checkKeygrip returns an error if keygrip isn't a hex encoded keygrip.
+func checkKeygrip(keygrip string) error {
+	if b, err := hex.DecodeString(keygrip); err != nil || len(b) != 20 {
+		return fmt.Errorf("invalid keygrip %q", keygrip)
+	}
+	return nil
+}
+
+// escape percent-escapes the characters of s not allowed in Assuan lines.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; ch {
+		case '%', '\r', '\n':
+			fmt.Fprintf(&b, "%%%02X", ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// unescape decodes the percent-escaped characters of s.
+func unescape(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
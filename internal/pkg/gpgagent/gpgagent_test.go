@@ -0,0 +1,397 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package gpgagent
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	rsaKeygrip     = "448511D6D3FC0DAC1B48D1F40F06BD971C809CDD"
+	ecdsaKeygrip   = "7F4589870FD9EBE5A03087372F27EE2C0D37C4CF"
+	ed25519Keygrip = "0123456789ABCDEF0123456789ABCDEF01234567"
+	missingKeygrip = "0000000000000000000000000000000000000000"
+)
+
+// atom returns the canonical encoding of an S-expression atom.
+func atom(b []byte) string {
+	return strconv.Itoa(len(b)) + ":" + string(b)
+}
+
+// publicKeySexp returns the public-key S-expression of pub.
+func publicKeySexp(t *testing.T, pub crypto.PublicKey) string {
+	t.Helper()
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("(10:public-key(3:rsa(1:n%s)(1:e%s)))", atom(pub.N.Bytes()), atom(big.NewInt(int64(pub.E)).Bytes()))
+	case *ecdsa.PublicKey:
+		q, err := pub.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf("(10:public-key(3:ecc(5:curve10:NIST P-256)(1:q%s)))", atom(q))
+	case ed25519.PublicKey:
+		return fmt.Sprintf("(10:public-key(3:ecc(5:curve7:Ed25519)(5:flags5:eddsa)(1:q%s)))", atom(append([]byte{0x40}, pub...)))
+	}
+	t.Fatalf("unsupported key type %T", pub)
+	return ""
+}
+
+// fakeAgent serves the Assuan protocol of gpg-agent, signing with keys.
+type fakeAgent struct {
+	t    *testing.T
+	keys map[string]crypto.Signer
+}
+
+// newFakeAgent starts a fake agent holding an RSA, an ECDSA and an Ed25519
+// key, and returns the path of its socket.
+func newFakeAgent(t *testing.T) (*fakeAgent, string) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &fakeAgent{
+		t: t,
+		keys: map[string]crypto.Signer{
+			rsaKeygrip:     rsaKey,
+			ecdsaKeygrip:   ecdsaKey,
+			ed25519Keygrip: ed25519Key,
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), socketName)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go a.serve(conn)
+		}
+	}()
+
+	return a, path
+}
+
+// serve handles the commands of a connection.
+func (a *fakeAgent) serve(conn net.Conn) {
+	defer conn.Close()
+
+	w := bufio.NewWriter(conn)
+	r := bufio.NewReader(conn)
+
+	reply := func(lines ...string) {
+		for _, l := range lines {
+			w.WriteString(l + "\n")
+		}
+		w.Flush()
+	}
+	data := func(b []byte) string {
+		return "D " + escape(string(b))
+	}
+
+	reply("# fake agent", "OK Pleased to meet you")
+
+	var keygrip string
+	var hash crypto.Hash
+	var digest []byte
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+
+		switch cmd {
+		case "OPTION":
+			reply("OK")
+		case "KEYINFO":
+			reply(
+				"S KEYINFO "+rsaKeygrip+" D - - - P - - -",
+				"S KEYINFO "+ecdsaKeygrip+" T D2760001240100000006012345670000 OPENPGP.1 - - - - -",
+				"S KEYINFO "+ed25519Keygrip+" D - - - P - - -",
+				"OK",
+			)
+		case "HAVEKEY", "READKEY", "SIGKEY":
+			k, ok := a.keys[arg]
+			if !ok {
+				reply("ERR 67108881 No secret key <GPG Agent>")
+				continue
+			}
+			switch cmd {
+			case "READKEY":
+				reply(data([]byte(publicKeySexp(a.t, k.Public()))), "OK")
+			case "SIGKEY":
+				keygrip = arg
+				reply("OK")
+			default:
+				reply("OK")
+			}
+		case "SETHASH":
+			algo, h, _ := strings.Cut(arg, " ")
+			switch algo {
+			case "8":
+				hash = crypto.SHA256
+			case "10":
+				hash = crypto.SHA512
+			default:
+				reply("ERR 67108949 Invalid digest algorithm <GPG Agent>")
+				continue
+			}
+			digest, _ = hex.DecodeString(h)
+			reply("OK")
+		case "PKSIGN":
+			// pinentry notifications must be acknowledged
+			reply("INQUIRE PINENTRY_LAUNCHED 1234 curses 1.2.1 - - - - 0/0 0")
+			if l, _ := r.ReadString('\n'); l != "END\n" {
+				reply("ERR 83886179 Operation cancelled <Pinentry>")
+				continue
+			}
+
+			var sig string
+			switch k := a.keys[keygrip].(type) {
+			case *rsa.PrivateKey:
+				s, err := rsa.SignPKCS1v15(rand.Reader, k, hash, digest)
+				if err != nil {
+					reply("ERR 1 " + err.Error())
+					continue
+				}
+				// strip a leading zero, as libgcrypt does
+				for len(s) > 0 && s[0] == 0 {
+					s = s[1:]
+				}
+				sig = fmt.Sprintf("(7:sig-val(3:rsa(1:s%s)))", atom(s))
+			case *ecdsa.PrivateKey:
+				rr, ss, err := ecdsa.Sign(rand.Reader, k, digest)
+				if err != nil {
+					reply("ERR 1 " + err.Error())
+					continue
+				}
+				sig = fmt.Sprintf("(7:sig-val(5:ecdsa(1:r%s)(1:s%s)))", atom(rr.Bytes()), atom(ss.Bytes()))
+			default:
+				reply("ERR 67108892 Wrong public key algorithm <GPG Agent>")
+				continue
+			}
+			reply(data([]byte(sig)), "OK")
+		case "BYE":
+			reply("OK closing connection")
+			return
+		default:
+			reply("ERR 536871187 Unknown IPC command <User defined source 1>")
+		}
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519Pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		sexp    string
+		want    crypto.PublicKey
+		wantErr bool
+	}{
+		{name: "RSA", sexp: publicKeySexp(t, &rsaKey.PublicKey), want: &rsaKey.PublicKey},
+		{name: "ECDSA", sexp: publicKeySexp(t, &ecdsaKey.PublicKey), want: &ecdsaKey.PublicKey},
+		{name: "Ed25519", sexp: publicKeySexp(t, ed25519Pub), want: ed25519Pub},
+		{name: "UnsupportedCurve", sexp: "(10:public-key(3:ecc(5:curve10:Curve25519)(1:q1:x)))", wantErr: true},
+		{name: "UnsupportedAlgorithm", sexp: "(10:public-key(3:dsa(1:p1:x)))", wantErr: true},
+		{name: "MissingParameter", sexp: "(10:public-key(3:rsa(1:n1:x)))", wantErr: true},
+		{name: "NotPublicKey", sexp: "(11:private-key(3:rsa(1:n1:x)(1:e1:x)))", wantErr: true},
+		{name: "Truncated", sexp: "(10:public-key(3:rsa(1:n1:x)", wantErr: true},
+		{name: "InvalidLength", sexp: "(10:public-key(3:rsa(1:n99:x)))", wantErr: true},
+		{name: "TrailingData", sexp: "(10:public-key(3:rsa(1:n1:x)(1:e1:x)))x", wantErr: true},
+		{name: "TooDeep", sexp: strings.Repeat("(", 20) + strings.Repeat(")", 20), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePublicKey([]byte(tt.sexp))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want == nil {
+				return
+			}
+			if k, ok := got.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(tt.want) {
+				t.Errorf("got public key %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscape(t *testing.T) {
+	s := "100%\r\nsure"
+	if got, want := escape(s), "100%25%0D%0Asure"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := unescape(escape(s)); got != s {
+		t.Errorf("got %q, want %q", got, s)
+	}
+}
+
+func TestClient(t *testing.T) {
+	a, path := newFakeAgent(t)
+
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer c.Close()
+
+	keys, err := c.Keys()
+	if err != nil {
+		t.Fatalf("failed to list keys: %v", err)
+	}
+	want := []KeyInfo{
+		{Keygrip: rsaKeygrip},
+		{Keygrip: ecdsaKeygrip, Smartcard: true, SerialNumber: "D2760001240100000006012345670000"},
+		{Keygrip: ed25519Keygrip},
+	}
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("got keys %v, want %v", keys, want)
+	}
+
+	if ok, err := c.HasKey(rsaKeygrip); err != nil || !ok {
+		t.Errorf("HasKey(%s) = %v, %v, want true", rsaKeygrip, ok, err)
+	}
+	if ok, err := c.HasKey(missingKeygrip); err != nil || ok {
+		t.Errorf("HasKey(%s) = %v, %v, want false", missingKeygrip, ok, err)
+	}
+	if _, err := c.HasKey("invalid"); err == nil {
+		t.Errorf("unexpected success with invalid keygrip")
+	}
+
+	pub, err := c.ReadKey(ecdsaKeygrip)
+	if err != nil {
+		t.Fatalf("failed to read key: %v", err)
+	}
+	if !a.keys[ecdsaKeygrip].Public().(*ecdsa.PublicKey).Equal(pub) {
+		t.Errorf("unexpected public key")
+	}
+	if _, err := c.ReadKey(missingKeygrip); !errors.Is(err, ErrNoSecretKey) {
+		t.Errorf("got error %v, want %v", err, ErrNoSecretKey)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	a, path := newFakeAgent(t)
+
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.NewSigner(missingKeygrip); err == nil {
+		t.Errorf("unexpected success with missing key")
+	}
+	if _, err := c.NewSigner(ed25519Keygrip); err == nil {
+		t.Errorf("unexpected success with Ed25519 key")
+	}
+
+	sum256 := sha256.Sum256([]byte("message"))
+	sum512 := sha512.Sum512([]byte("message"))
+
+	tests := []struct {
+		name    string
+		keygrip string
+		digest  []byte
+		opts    crypto.SignerOpts
+		wantErr bool
+	}{
+		{name: "RSA", keygrip: rsaKeygrip, digest: sum256[:], opts: crypto.SHA256},
+		{name: "RSASHA512", keygrip: rsaKeygrip, digest: sum512[:], opts: crypto.SHA512},
+		{name: "ECDSA", keygrip: ecdsaKeygrip, digest: sum256[:], opts: crypto.SHA256},
+		{name: "DigestLength", keygrip: rsaKeygrip, digest: sum256[:], opts: crypto.SHA512, wantErr: true},
+		{name: "UnsupportedHash", keygrip: rsaKeygrip, digest: sum256[:20], opts: crypto.SHA1, wantErr: true},
+		{name: "PSS", keygrip: rsaKeygrip, digest: sum256[:], opts: &rsa.PSSOptions{Hash: crypto.SHA256}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := c.NewSigner(tt.keygrip)
+			if err != nil {
+				t.Fatalf("failed to create signer: %v", err)
+			}
+			if got := s.Keygrip(); got != tt.keygrip {
+				t.Errorf("got keygrip %s, want %s", got, tt.keygrip)
+			}
+
+			sig, err := s.Sign(rand.Reader, tt.digest, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			switch pub := a.keys[tt.keygrip].Public().(type) {
+			case *rsa.PublicKey:
+				if len(sig) != pub.Size() {
+					t.Errorf("got signature length %d, want %d", len(sig), pub.Size())
+				}
+				if err := rsa.VerifyPKCS1v15(pub, tt.opts.HashFunc(), tt.digest, sig); err != nil {
+					t.Errorf("failed to verify signature: %v", err)
+				}
+			case *ecdsa.PublicKey:
+				if !ecdsa.VerifyASN1(pub, tt.digest, sig) {
+					t.Errorf("failed to verify signature")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package gpgagent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// maxSexpDepth is the maximum nesting of the S-expressions returned by the
+// agent.
+const maxSexpDepth = 8
+
+var errInvalidSexp = errors.New("invalid S-expression")
+
+// sexp is a list of a canonical S-expression, its elements are []byte atoms
+// or sexp lists.
+type sexp []any
+
+// parseSexp parses the canonical S-expression of b.
+func parseSexp(b []byte) (sexp, error) {
+	l, rest, err := parseList(b, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 && rest[0] != 0 {
+		return nil, fmt.Errorf("%w: trailing data", errInvalidSexp)
+	}
+	return l, nil
+}
+
+// parseList parses the list at the start of b and returns the remaining
+// bytes.
+func parseList(b []byte, depth int) (sexp, []byte, error) {
+	if depth > maxSexpDepth {
+		return nil, nil, fmt.Errorf("%w: too deeply nested", errInvalidSexp)
+	}
+	if len(b) == 0 || b[0] != '(' {
+		return nil, nil, fmt.Errorf("%w: list expected", errInvalidSexp)
+	}
+	b = b[1:]
+
+	var l sexp
+	for len(b) > 0 {
+		switch {
+		case b[0] == ')':
+			return l, b[1:], nil
+		case b[0] == '(':
+			sub, rest, err := parseList(b, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			l = append(l, sub)
+			b = rest
+		case b[0] >= '0' && b[0] <= '9':
+			i := bytes.IndexByte(b, ':')
+			if i < 0 {
+				return nil, nil, fmt.Errorf("%w: missing atom length separator", errInvalidSexp)
+			}
+			n, err := strconv.Atoi(string(b[:i]))
+			if err != nil || n > len(b)-i-1 {
+				return nil, nil, fmt.Errorf("%w: invalid atom length", errInvalidSexp)
+			}
+			l = append(l, b[i+1:i+1+n])
+			b = b[i+1+n:]
+		default:
+			return nil, nil, fmt.Errorf("%w: unexpected character %q", errInvalidSexp, b[0])
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: truncated", errInvalidSexp)
+}
+
+// name returns the first atom of l.
+func (l sexp) name() string {
+	if len(l) > 0 {
+		if a, ok := l[0].([]byte); ok {
+			return string(a)
+		}
+	}
+	return ""
+}
+
+// list returns the first sub-list of l named name.
+func (l sexp) list(name string) sexp {
+	for _, e := range l {
+		if sub, ok := e.(sexp); ok && sub.name() == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// value returns the value of the sub-list of l named name.
+func (l sexp) value(name string) []byte {
+	if sub := l.list(name); len(sub) > 1 {
+		if a, ok := sub[1].([]byte); ok {
+			return a
+		}
+	}
+	return nil
+}
+
+// curves are the NIST curves supported for ECDSA keys, by their libgcrypt
+// names and aliases.
+var curves = map[string]elliptic.Curve{
+	"NIST P-256":          elliptic.P256(),
+	"nistp256":            elliptic.P256(),
+	"prime256v1":          elliptic.P256(),
+	"secp256r1":           elliptic.P256(),
+	"1.2.840.10045.3.1.7": elliptic.P256(),
+	"NIST P-384":          elliptic.P384(),
+	"nistp384":            elliptic.P384(),
+	"secp384r1":           elliptic.P384(),
+	"1.3.132.0.34":        elliptic.P384(),
+	"NIST P-521":          elliptic.P521(),
+	"nistp521":            elliptic.P521(),
+	"secp521r1":           elliptic.P521(),
+	"1.3.132.0.35":        elliptic.P521(),
+}
+
+// parsePublicKey parses the public-key S-expression returned by READKEY.
+func parsePublicKey(b []byte) (any, error) {
+	l, err := parseSexp(b)
+	if err != nil {
+		return nil, err
+	}
+	if l.name() != "public-key" || len(l) < 2 {
+		return nil, fmt.Errorf("%w: public key expected", errInvalidSexp)
+	}
+	alg, ok := l[1].(sexp)
+	if !ok {
+		return nil, fmt.Errorf("%w: public key algorithm expected", errInvalidSexp)
+	}
+
+	switch alg.name() {
+	case "rsa":
+		n, e := alg.value("n"), alg.value("e")
+		if n == nil || e == nil {
+			return nil, fmt.Errorf("%w: missing RSA public key parameter", errInvalidSexp)
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("unsupported RSA public exponent")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exp.Int64()),
+		}, nil
+
+	case "ecc", "ecdsa":
+		curve := string(alg.value("curve"))
+		q := alg.value("q")
+		if q == nil {
+			return nil, fmt.Errorf("%w: missing ECC public key point", errInvalidSexp)
+		}
+		if curve == "Ed25519" || curve == "1.3.6.1.4.1.11591.15.1" {
+			// the point may be prefixed with 0x40 to flag its native format
+			if len(q) == ed25519.PublicKeySize+1 && q[0] == 0x40 {
+				q = q[1:]
+			}
+			if len(q) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("invalid Ed25519 public key")
+			}
+			return ed25519.PublicKey(q), nil
+		}
+		c, ok := curves[curve]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", curve)
+		}
+		return ecdsa.ParseUncompressedPublicKey(c, q)
+	}
+	return nil, fmt.Errorf("unsupported public key algorithm %q", alg.name())
+}
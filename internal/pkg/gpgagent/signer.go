@@ -0,0 +1,132 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package gpgagent
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// hashAlgos are the libgcrypt identifiers of the hash functions supported to
+// sign.
+var hashAlgos = map[crypto.Hash]int{
+	crypto.SHA256: 8,
+	crypto.SHA384: 9,
+	crypto.SHA512: 10,
+	crypto.SHA224: 11,
+}
+
+// Signer signs with a key held by gpg-agent, it implements crypto.Signer.
+type Signer struct {
+	c       *Client
+	keygrip string
+	pub     crypto.PublicKey
+}
+
+// NewSigner returns a signer of the RSA or ECDSA key with keygrip.
+func (c *Client) NewSigner(keygrip string) (*Signer, error) {
+	ok, err := c.HasKey(keygrip)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("gpg-agent holds no secret key with keygrip %s", keygrip)
+	}
+
+	pub, err := c.ReadKey(keygrip)
+	if err != nil {
+		return nil, err
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, only RSA and ECDSA keys are supported", pub)
+	}
+
+	return &Signer{
+		c:       c,
+		keygrip: keygrip,
+		pub:     pub,
+	}, nil
+}
+
+// Keygrip returns the keygrip of the key of the signer.
+func (s *Signer) Keygrip() string {
+	return s.keygrip
+}
+
+// Public returns the public key of the signer.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs digest with the key held by the agent, with PKCS #1 v1.5 for
+// RSA keys, and returns ASN.1 encoded signatures for ECDSA keys. The agent
+// may prompt for the passphrase, or smartcard PIN, of the key.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, fmt.Errorf("RSA PSS signatures are not supported")
+	}
+	algo, ok := hashAlgos[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash function %v", opts.HashFunc())
+	}
+	if len(digest) != opts.HashFunc().Size() {
+		return nil, fmt.Errorf("digest length %d doesn't match hash function %v", len(digest), opts.HashFunc())
+	}
+
+	if _, err := s.c.transact("SIGKEY " + s.keygrip); err != nil {
+		return nil, fmt.Errorf("while selecting key %s: %w", s.keygrip, err)
+	}
+	if _, err := s.c.transact(fmt.Sprintf("SETHASH %d %s", algo, hex.EncodeToString(digest))); err != nil {
+		return nil, fmt.Errorf("while setting digest: %w", err)
+	}
+	res, err := s.c.transact("PKSIGN")
+	if err != nil {
+		return nil, fmt.Errorf("while signing with key %s: %w", s.keygrip, err)
+	}
+
+	l, err := parseSexp(res.data)
+	if err != nil {
+		return nil, err
+	}
+	var sig sexp
+	if l.name() == "sig-val" && len(l) > 1 {
+		sig, _ = l[1].(sexp)
+	}
+
+	switch pub := s.pub.(type) {
+	case *rsa.PublicKey:
+		v := sig.value("s")
+		if sig.name() != "rsa" || v == nil || len(v) > pub.Size() {
+			return nil, fmt.Errorf("%w: RSA signature expected", errInvalidSexp)
+		}
+		// the signature must be as long as the modulus
+		b := make([]byte, pub.Size())
+		copy(b[len(b)-len(v):], v)
+		return b, nil
+
+	case *ecdsa.PublicKey:
+		r, v := sig.value("r"), sig.value("s")
+		if sig.name() != "ecdsa" || r == nil || v == nil {
+			return nil, fmt.Errorf("%w: ECDSA signature expected", errInvalidSexp)
+		}
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			R: new(big.Int).SetBytes(r),
+			S: new(big.Int).SetBytes(v),
+		})
+	}
+	return nil, fmt.Errorf("unsupported key type %T", s.pub)
+}
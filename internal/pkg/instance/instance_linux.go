@@ -52,6 +52,7 @@ type File struct {
 	UserNs      bool   `json:"userns"`
 	Cgroup      bool   `json:"cgroup"`
 	IP          string `json:"ip"`
+	Network     string `json:"network,omitempty"`
 	LogErrPath  string `json:"logErrPath"`
 	LogOutPath  string `json:"logOutPath"`
 	Checkpoint  string `json:"checkpoint"`
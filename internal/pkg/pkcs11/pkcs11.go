@@ -0,0 +1,291 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package pkcs11 provides access to RSA and ECDSA keys, and certificates,
+// stored on PKCS#11 tokens, such as HSMs, to sign and verify SIF images.
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	p11 "github.com/miekg/pkcs11"
+)
+
+// ErrObjectNotFound is returned when a key or certificate is not found on the
+// token.
+var ErrObjectNotFound = errors.New("object not found on PKCS#11 token")
+
+// Config identifies a key on a PKCS#11 token.
+type Config struct {
+	// Module is the path of the PKCS#11 module library.
+	Module string
+	// Slot is the slot ID of the token, used when TokenLabel is empty.
+	Slot *uint
+	// TokenLabel is the label of the token.
+	TokenLabel string
+	// KeyLabel is the label of the key, or certificate, on the token.
+	KeyLabel string
+	// PIN is the user PIN, required to sign.
+	PIN string
+}
+
+// Token is a session opened on a PKCS#11 token.
+type Token struct {
+	ctx      *p11.Ctx
+	session  p11.SessionHandle
+	loggedIn bool
+}
+
+// Open loads the PKCS#11 module, and opens a session on the token of c. The
+// user is logged in if the PIN is set.
+func Open(c Config) (*Token, error) {
+	if c.Module == "" {
+		return nil, fmt.Errorf("PKCS#11 module is required")
+	}
+	ctx := p11.New(c.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("could not load PKCS#11 module %s", c.Module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("while initializing PKCS#11 module %s: %w", c.Module, err)
+	}
+
+	t := &Token{ctx: ctx}
+	if err := t.open(c); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// open opens a session on the token of c.
+func (t *Token) open(c Config) error {
+	slot, err := t.findSlot(c)
+	if err != nil {
+		return err
+	}
+	t.session, err = t.ctx.OpenSession(slot, p11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return fmt.Errorf("while opening PKCS#11 session: %w", err)
+	}
+	if c.PIN != "" {
+		if err := t.ctx.Login(t.session, p11.CKU_USER, c.PIN); err != nil {
+			return fmt.Errorf("while logging in PKCS#11 token: %w", err)
+		}
+		t.loggedIn = true
+	}
+	return nil
+}
+
+// findSlot returns the slot of the token with the label of c, or the slot
+// of c, or the only slot with a token.
+func (t *Token) findSlot(c Config) (uint, error) {
+	slots, err := t.ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("while listing PKCS#11 slots: %w", err)
+	}
+
+	switch {
+	case c.TokenLabel != "":
+		for _, s := range slots {
+			ti, err := t.ctx.GetTokenInfo(s)
+			if err != nil {
+				continue
+			}
+			if ti.Label == c.TokenLabel {
+				return s, nil
+			}
+		}
+		return 0, fmt.Errorf("no PKCS#11 token with label %q", c.TokenLabel)
+	case c.Slot != nil:
+		for _, s := range slots {
+			if s == *c.Slot {
+				return s, nil
+			}
+		}
+		return 0, fmt.Errorf("no PKCS#11 token in slot %d", *c.Slot)
+	case len(slots) == 1:
+		return slots[0], nil
+	case len(slots) == 0:
+		return 0, fmt.Errorf("no PKCS#11 token found")
+	}
+	return 0, fmt.Errorf("%d PKCS#11 tokens found, a token label or slot is required", len(slots))
+}
+
+// Close closes the session and unloads the module.
+func (t *Token) Close() error {
+	if t.session != 0 {
+		if t.loggedIn {
+			t.ctx.Logout(t.session) //nolint:errcheck
+		}
+		t.ctx.CloseSession(t.session) //nolint:errcheck
+	}
+	err := t.ctx.Finalize()
+	t.ctx.Destroy()
+	return err
+}
+
+// findObject returns the object of class with label, or with id if not
+// nil.
+func (t *Token) findObject(class uint, label string, id []byte) (p11.ObjectHandle, error) {
+	template := []*p11.Attribute{p11.NewAttribute(p11.CKA_CLASS, class)}
+	if id != nil {
+		template = append(template, p11.NewAttribute(p11.CKA_ID, id))
+	} else {
+		template = append(template, p11.NewAttribute(p11.CKA_LABEL, label))
+	}
+
+	if err := t.ctx.FindObjectsInit(t.session, template); err != nil {
+		return 0, err
+	}
+	objs, _, err := t.ctx.FindObjects(t.session, 2)
+	if ferr := t.ctx.FindObjectsFinal(t.session); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	switch len(objs) {
+	case 0:
+		return 0, ErrObjectNotFound
+	case 1:
+		return objs[0], nil
+	}
+	return 0, fmt.Errorf("several PKCS#11 objects with label %q", label)
+}
+
+// attribute returns the value of the attribute typ of the object o.
+func (t *Token) attribute(o p11.ObjectHandle, typ uint) ([]byte, error) {
+	attrs, err := t.ctx.GetAttributeValue(t.session, o, []*p11.Attribute{p11.NewAttribute(typ, nil)})
+	if err != nil {
+		return nil, err
+	}
+	return attrs[0].Value, nil
+}
+
+// Certificate returns the certificate with label on the token.
+func (t *Token) Certificate(label string) (*x509.Certificate, error) {
+	o, err := t.findObject(p11.CKO_CERTIFICATE, label, nil)
+	if err != nil {
+		return nil, err
+	}
+	return t.certificate(o)
+}
+
+func (t *Token) certificate(o p11.ObjectHandle) (*x509.Certificate, error) {
+	der, err := t.attribute(o, p11.CKA_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// PublicKey returns the public key with label on the token, or the public
+// key of the certificate with label.
+func (t *Token) PublicKey(label string) (crypto.PublicKey, error) {
+	return t.publicKey(label, nil)
+}
+
+// publicKey returns the public key with label, or with id if not nil.
+func (t *Token) publicKey(label string, id []byte) (crypto.PublicKey, error) {
+	o, err := t.findObject(p11.CKO_PUBLIC_KEY, label, id)
+	if errors.Is(err, ErrObjectNotFound) {
+		o, err = t.findObject(p11.CKO_CERTIFICATE, label, id)
+		if err != nil {
+			return nil, err
+		}
+		c, err := t.certificate(o)
+		if err != nil {
+			return nil, err
+		}
+		return c.PublicKey, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	kt, err := t.attribute(o, p11.CKA_KEY_TYPE)
+	if err != nil {
+		return nil, err
+	}
+	switch bytesToUint(kt) {
+	case p11.CKK_RSA:
+		return t.rsaPublicKey(o)
+	case p11.CKK_EC:
+		return t.ecdsaPublicKey(o)
+	}
+	return nil, fmt.Errorf("unsupported PKCS#11 key type %d, only RSA and ECDSA keys are supported", bytesToUint(kt))
+}
+
+func (t *Token) rsaPublicKey(o p11.ObjectHandle) (*rsa.PublicKey, error) {
+	n, err := t.attribute(o, p11.CKA_MODULUS)
+	if err != nil {
+		return nil, err
+	}
+	e, err := t.attribute(o, p11.CKA_PUBLIC_EXPONENT)
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+var curves = map[string]elliptic.Curve{
+	"1.2.840.10045.3.1.7": elliptic.P256(),
+	"1.3.132.0.34":        elliptic.P384(),
+	"1.3.132.0.35":        elliptic.P521(),
+}
+
+func (t *Token) ecdsaPublicKey(o p11.ObjectHandle) (*ecdsa.PublicKey, error) {
+	params, err := t.attribute(o, p11.CKA_EC_PARAMS)
+	if err != nil {
+		return nil, err
+	}
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(params, &oid); err != nil {
+		return nil, fmt.Errorf("unsupported EC parameters: %w", err)
+	}
+	curve, ok := curves[oid.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported EC curve %s", oid)
+	}
+
+	point, err := t.attribute(o, p11.CKA_EC_POINT)
+	if err != nil {
+		return nil, err
+	}
+	// the point is DER encoded in an octet string, some modules omit it
+	var raw []byte
+	if rest, err := asn1.Unmarshal(point, &raw); err == nil && len(rest) == 0 {
+		point = raw
+	}
+	return ecdsa.ParseUncompressedPublicKey(curve, point)
+}
+
+// bytesToUint decodes a CK_ULONG attribute value, in native byte order.
+func bytesToUint(b []byte) uint {
+	switch len(b) {
+	case 8:
+		return uint(binary.NativeEndian.Uint64(b))
+	case 4:
+		return uint(binary.NativeEndian.Uint32(b))
+	}
+	return 0
+}
@@ -0,0 +1,256 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	p11 "github.com/miekg/pkcs11"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/options"
+)
+
+const (
+	testTokenLabel = "apptainer"
+	testSOPIN      = "12345678"
+	testUserPIN    = "1234"
+)
+
+// softHSMModule returns the path of the SoftHSM module, set with the
+// SOFTHSM2_MODULE environment variable or found in the usual locations. The
+// test is skipped if SoftHSM is not installed.
+func softHSMModule(t *testing.T) string {
+	t.Helper()
+
+	paths := []string{
+		os.Getenv("SOFTHSM2_MODULE"),
+		"/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/lib/aarch64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/lib64/pkcs11/libsofthsm2.so",
+		"/usr/local/lib/softhsm/libsofthsm2.so",
+	}
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	t.Skip("SoftHSM is not installed")
+	return ""
+}
+
+// initToken initializes a SoftHSM token in a temporary directory, holding
+// an RSA key pair labeled "rsa" and an ECDSA P-256 key pair labeled "ecdsa".
+func initToken(t *testing.T, module string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	tokenDir := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokenDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(dir, "softhsm2.conf")
+	data := fmt.Sprintf("directories.tokendir = %s\nobjectstore.backend = file\nlog.level = ERROR\n", tokenDir)
+	if err := os.WriteFile(conf, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	ctx := p11.New(module)
+	if ctx == nil {
+		t.Fatalf("could not load %s", module)
+	}
+	defer ctx.Destroy()
+	if err := ctx.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Finalize()
+
+	slots, err := ctx.GetSlotList(false)
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("no SoftHSM slot: %v", err)
+	}
+	if err := ctx.InitToken(slots[0], testSOPIN, testTokenLabel); err != nil {
+		t.Fatal(err)
+	}
+
+	// SoftHSM moves initialized tokens to a new slot
+	slots, err = ctx.GetSlotList(true)
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("no SoftHSM token: %v", err)
+	}
+	sh, err := ctx.OpenSession(slots[0], p11.CKF_SERIAL_SESSION|p11.CKF_RW_SESSION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.CloseSession(sh)
+
+	if err := ctx.Login(sh, p11.CKU_SO, testSOPIN); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.InitPIN(sh, testUserPIN); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.Logout(sh); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.Login(sh, p11.CKU_USER, testUserPIN); err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Logout(sh)
+
+	p256, err := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []struct {
+		label string
+		mech  uint
+		attrs []*p11.Attribute
+	}{
+		{"rsa", p11.CKM_RSA_PKCS_KEY_PAIR_GEN, []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_MODULUS_BITS, 2048),
+			p11.NewAttribute(p11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+		}},
+		{"ecdsa", p11.CKM_EC_KEY_PAIR_GEN, []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_EC_PARAMS, p256),
+		}},
+	}
+	for i, k := range keys {
+		id := []byte{byte(i + 1)}
+		pub := append([]*p11.Attribute{
+			p11.NewAttribute(p11.CKA_TOKEN, true),
+			p11.NewAttribute(p11.CKA_PRIVATE, false),
+			p11.NewAttribute(p11.CKA_VERIFY, true),
+			p11.NewAttribute(p11.CKA_LABEL, k.label),
+			p11.NewAttribute(p11.CKA_ID, id),
+		}, k.attrs...)
+		priv := []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_TOKEN, true),
+			p11.NewAttribute(p11.CKA_PRIVATE, true),
+			p11.NewAttribute(p11.CKA_SENSITIVE, true),
+			p11.NewAttribute(p11.CKA_SIGN, true),
+			p11.NewAttribute(p11.CKA_LABEL, k.label),
+			p11.NewAttribute(p11.CKA_ID, id),
+		}
+		if _, _, err := ctx.GenerateKeyPair(sh, []*p11.Mechanism{p11.NewMechanism(k.mech, nil)}, pub, priv); err != nil {
+			t.Fatalf("while generating %s key pair: %s", k.label, err)
+		}
+	}
+}
+
+func TestSigner(t *testing.T) {
+	module := softHSMModule(t)
+	initToken(t, module)
+
+	tests := []struct {
+		name    string
+		label   string
+		hash    crypto.Hash
+		wantPub interface{}
+	}{
+		{"RSA", "rsa", crypto.SHA256, &rsa.PublicKey{}},
+		{"RSASHA512", "rsa", crypto.SHA512, &rsa.PublicKey{}},
+		{"ECDSA", "ecdsa", crypto.SHA256, &ecdsa.PublicKey{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := Open(Config{Module: module, TokenLabel: testTokenLabel, PIN: testUserPIN})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tok.Close()
+
+			s, err := NewSigner(tok, tt.label)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := fmt.Sprintf("%T", s.Public()), fmt.Sprintf("%T", tt.wantPub); got != want {
+				t.Errorf("got public key %s, want %s", got, want)
+			}
+
+			sig, err := s.SignMessage(strings.NewReader("message"), options.WithCryptoSignerOpts(tt.hash))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			v, err := signature.LoadVerifier(s.Public(), tt.hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := v.VerifySignature(strings.NewReader(string(sig)), strings.NewReader("message")); err != nil {
+				t.Errorf("unexpected verification error: %s", err)
+			}
+		})
+	}
+}
+
+func TestPublicKey(t *testing.T) {
+	module := softHSMModule(t)
+	initToken(t, module)
+
+	// public keys are readable without the user PIN
+	tok, err := Open(Config{Module: module, TokenLabel: testTokenLabel})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tok.Close()
+
+	if _, err := tok.PublicKey("rsa"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := tok.PublicKey("ecdsa"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := tok.PublicKey("missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrObjectNotFound)
+	}
+	if _, err := NewSigner(tok, "rsa"); err == nil {
+		t.Errorf("unexpected access to the private key without the user PIN")
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	module := softHSMModule(t)
+	initToken(t, module)
+
+	slot := uint(1 << 20)
+	tests := []struct {
+		name string
+		c    Config
+	}{
+		{"NoModule", Config{}},
+		{"InvalidModule", Config{Module: "/nonexistent/module.so"}},
+		{"UnknownToken", Config{Module: module, TokenLabel: "unknown"}},
+		{"UnknownSlot", Config{Module: module, Slot: &slot}},
+		{"WrongPIN", Config{Module: module, TokenLabel: testTokenLabel, PIN: "0000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, err := Open(tt.c)
+			if err == nil {
+				tok.Close()
+				t.Errorf("unexpected success")
+			}
+		})
+	}
+}
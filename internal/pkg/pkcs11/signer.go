@@ -0,0 +1,140 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	p11 "github.com/miekg/pkcs11"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+// hashPrefixes are the DER encoded DigestInfo prefixes of PKCS #1 v1.5
+// signatures, the CKM_RSA_PKCS mechanism doesn't hash the data.
+var hashPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// Signer signs with a private key of a PKCS#11 token, it's both a
+// crypto.Signer and a signature.Signer.
+type Signer struct {
+	t       *Token
+	priv    p11.ObjectHandle
+	keyType uint
+	pub     crypto.PublicKey
+}
+
+// NewSigner returns a signer of the private RSA or ECDSA key with label on
+// the token, which must be logged in. The public key is read from the public
+// key or certificate with the same label, or ID, as the private key.
+func NewSigner(t *Token, label string) (*Signer, error) {
+	priv, err := t.findObject(p11.CKO_PRIVATE_KEY, label, nil)
+	if err != nil {
+		return nil, fmt.Errorf("private key %q: %w", label, err)
+	}
+	kt, err := t.attribute(priv, p11.CKA_KEY_TYPE)
+	if err != nil {
+		return nil, err
+	}
+	keyType := bytesToUint(kt)
+	if keyType != p11.CKK_RSA && keyType != p11.CKK_EC {
+		return nil, fmt.Errorf("unsupported PKCS#11 key type %d, only RSA and ECDSA keys are supported", keyType)
+	}
+
+	pub, err := t.publicKey(label, nil)
+	if errors.Is(err, ErrObjectNotFound) {
+		if id, ierr := t.attribute(priv, p11.CKA_ID); ierr == nil && len(id) > 0 {
+			pub, err = t.publicKey(label, id)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("public key %q: %w", label, err)
+	}
+
+	return &Signer{
+		t:       t,
+		priv:    priv,
+		keyType: keyType,
+		pub:     pub,
+	}, nil
+}
+
+// Public returns the public key of the signer.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs digest with the private key of the token, with PKCS #1 v1.5
+// for RSA keys, and returns ASN.1 encoded signatures for ECDSA keys.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, fmt.Errorf("RSA PSS signatures are not supported")
+	}
+
+	var m *p11.Mechanism
+	data := digest
+	switch s.keyType {
+	case p11.CKK_RSA:
+		prefix, ok := hashPrefixes[opts.HashFunc()]
+		if !ok {
+			return nil, fmt.Errorf("unsupported hash function %v", opts.HashFunc())
+		}
+		m = p11.NewMechanism(p11.CKM_RSA_PKCS, nil)
+		data = append(append([]byte{}, prefix...), digest...)
+	case p11.CKK_EC:
+		m = p11.NewMechanism(p11.CKM_ECDSA, nil)
+	}
+
+	if err := s.t.ctx.SignInit(s.t.session, []*p11.Mechanism{m}, s.priv); err != nil {
+		return nil, fmt.Errorf("while signing with PKCS#11 key: %w", err)
+	}
+	sig, err := s.t.ctx.Sign(s.t.session, data)
+	if err != nil {
+		return nil, fmt.Errorf("while signing with PKCS#11 key: %w", err)
+	}
+
+	if s.keyType == p11.CKK_EC {
+		// CKM_ECDSA signatures are the concatenation of r and s
+		half := len(sig) / 2
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			R: new(big.Int).SetBytes(sig[:half]),
+			S: new(big.Int).SetBytes(sig[half:]),
+		})
+	}
+	return sig, nil
+}
+
+// PublicKey returns the public key of the signer.
+func (s *Signer) PublicKey(...signature.PublicKeyOption) (crypto.PublicKey, error) {
+	return s.pub, nil
+}
+
+// SignMessage hashes message, with SHA256 unless overridden by opts, and
+// signs the digest.
+func (s *Signer) SignMessage(message io.Reader, opts ...signature.SignOption) ([]byte, error) {
+	var so crypto.SignerOpts = crypto.SHA256
+	for _, opt := range opts {
+		opt.ApplyCryptoSignerOpts(&so)
+	}
+
+	h := so.HashFunc().New()
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, err
+	}
+	return s.Sign(rand.Reader, h.Sum(nil), so)
+}
@@ -0,0 +1,320 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/sypgp"
+	"github.com/apptainer/apptainer/internal/pkg/util/user"
+	"github.com/apptainer/apptainer/pkg/image"
+	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
+	"github.com/apptainer/apptainer/pkg/util/capabilities"
+	"github.com/apptainer/sif/v2/pkg/integrity"
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+// Input is the data rules are evaluated against.
+type Input struct {
+	Image   Image
+	User    User
+	Request Request
+}
+
+// Image describes the container image, available as the image variable.
+// The image argument given by the user, like a registry URI, can't be
+// trusted, images are identified by their digest and signers.
+type Image struct {
+	// Path is the resolved path of the image, in the cache for remote images.
+	Path string
+	// Format is one of sif, squashfs, ext3, sandbox or unknown.
+	Format string
+	// Digest is the sha256:<hex> digest of image files, empty for sandboxes.
+	Digest string
+	// Signers are the upper case fingerprints of the keys of the global
+	// keyring which signed all the objects of a SIF image.
+	Signers []string
+}
+
+// User describes the user starting the container, available as the user
+// variable.
+type User struct {
+	Name   string
+	UID    int
+	GID    int
+	Groups []string
+	GIDs   []int
+}
+
+// Bind describes a requested bind mount.
+type Bind struct {
+	Source      string
+	Destination string
+	ReadOnly    bool
+}
+
+// Request describes the requested container configuration, available as
+// the request variable.
+type Request struct {
+	Writable      bool
+	WritableTmpfs bool
+	Fakeroot      bool
+	Instance      bool
+	Binds         []Bind
+	// Namespaces are OCI namespace types: pid, network, ipc, uts, user,
+	// cgroup and mount.
+	Namespaces []string
+	Network    string
+	AddCaps    []string
+	DropCaps   []string
+	// Devices are nvidia, rocm, intel-hpu and requested CDI device names.
+	Devices []string
+}
+
+// NewInput gathers the rules input for a container started by the user
+// uid with an opened image and an engine configuration. The image digest
+// and signers are only computed when a rule may use them, signers are
+// verified with the global keyring.
+func (p *Policy) NewInput(img *image.Image, c *apptainerConfig.EngineConfig, uid int, gids []int) (Input, error) {
+	var kr openpgp.KeyRing
+	if p.Uses("signers") {
+		keyring := sypgp.NewHandle(buildcfg.APPTAINER_CONFDIR, sypgp.GlobalHandleOpt())
+		el, err := keyring.LoadPubKeyring()
+		if err != nil {
+			return Input{}, fmt.Errorf("while obtaining global keyring: %s", err)
+		}
+		kr = el
+	}
+
+	i, err := NewImage(img, p.Uses("digest"), kr)
+	if err != nil {
+		return Input{}, err
+	}
+	return Input{
+		Image:   i,
+		User:    NewUser(uid, gids),
+		Request: NewRequest(c),
+	}, nil
+}
+
+func (in Input) vars() map[string]any {
+	binds := make([]any, 0, len(in.Request.Binds))
+	for _, b := range in.Request.Binds {
+		binds = append(binds, map[string]any{
+			"source":      b.Source,
+			"destination": b.Destination,
+			"readonly":    b.ReadOnly,
+		})
+	}
+	gids := make([]int64, 0, len(in.User.GIDs))
+	for _, gid := range in.User.GIDs {
+		gids = append(gids, int64(gid))
+	}
+
+	return map[string]any{
+		"image": map[string]any{
+			"path":    in.Image.Path,
+			"format":  in.Image.Format,
+			"digest":  in.Image.Digest,
+			"signers": nonNil(in.Image.Signers),
+		},
+		"user": map[string]any{
+			"name":   in.User.Name,
+			"uid":    int64(in.User.UID),
+			"gid":    int64(in.User.GID),
+			"groups": nonNil(in.User.Groups),
+			"gids":   gids,
+		},
+		"request": map[string]any{
+			"writable":       in.Request.Writable,
+			"writable_tmpfs": in.Request.WritableTmpfs,
+			"fakeroot":       in.Request.Fakeroot,
+			"instance":       in.Request.Instance,
+			"binds":          binds,
+			"namespaces":     nonNil(in.Request.Namespaces),
+			"network":        in.Request.Network,
+			"add_caps":       nonNil(in.Request.AddCaps),
+			"drop_caps":      nonNil(in.Request.DropCaps),
+			"devices":        nonNil(in.Request.Devices),
+		},
+	}
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// NewImage describes an opened image. The digest is only computed with
+// digest set, and the signers only with a keyring.
+func NewImage(img *image.Image, digest bool, kr openpgp.KeyRing) (Image, error) {
+	i := Image{
+		Path:   img.Path,
+		Format: formatName(img.Type),
+	}
+	if img.Type == image.SANDBOX {
+		return i, nil
+	}
+
+	if digest {
+		h := sha256.New()
+		if _, err := io.Copy(h, io.NewSectionReader(img.File, 0, 1<<63-1)); err != nil {
+			return i, fmt.Errorf("while computing image digest: %s", err)
+		}
+		i.Digest = "sha256:" + hex.EncodeToString(h.Sum(nil))
+	}
+
+	if kr != nil && img.Type == image.SIF {
+		signers, err := signers(img.File, kr)
+		if err != nil {
+			return i, fmt.Errorf("while getting image signers: %s", err)
+		}
+		i.Signers = signers
+	}
+	return i, nil
+}
+
+func formatName(t int) string {
+	switch t {
+	case image.SIF:
+		return "sif"
+	case image.SQUASHFS:
+		return "squashfs"
+	case image.EXT3:
+		return "ext3"
+	case image.SANDBOX:
+		return "sandbox"
+	}
+	return "unknown"
+}
+
+// signers returns the fingerprints of the keys from the keyring which
+// signed all the objects of a SIF image with a valid signature.
+func signers(fp *os.File, kr openpgp.KeyRing) ([]string, error) {
+	f, err := sif.LoadContainer(fp,
+		sif.OptLoadWithFlag(os.O_RDONLY),
+		sif.OptLoadWithCloseOnUnload(false),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer f.UnloadContainer()
+
+	var invalid []string
+	cb := func(r integrity.VerifyResult) bool {
+		var sigerr *integrity.SignatureNotValidError
+		if !errors.As(r.Error(), &sigerr) {
+			return false
+		}
+		od, err := f.GetDescriptor(sif.WithID(sigerr.ID))
+		if err != nil {
+			return false
+		}
+		_, sfp, err := od.SignatureMetadata()
+		if err != nil {
+			return false
+		}
+		invalid = append(invalid, hex.EncodeToString(sfp))
+		return true
+	}
+
+	v, err := integrity.NewVerifier(f,
+		integrity.OptVerifyWithKeyRing(kr),
+		integrity.OptVerifyCallback(cb),
+	)
+	if err != nil {
+		// unsigned image
+		return nil, nil
+	}
+	if err := v.Verify(); err != nil {
+		return nil, nil
+	}
+	fps, err := v.AllSignedBy()
+	if err != nil {
+		return nil, err
+	}
+
+	var signers []string
+	for _, fp := range fps {
+		s := strings.ToUpper(hex.EncodeToString(fp))
+		if !slices.ContainsFunc(invalid, func(i string) bool { return strings.EqualFold(i, s) }) {
+			signers = append(signers, s)
+		}
+	}
+	return signers, nil
+}
+
+// NewUser describes a user from its IDs, the primary group is added to the
+// supplementary groups gids and unknown groups are ignored.
+func NewUser(uid int, gids []int) User {
+	u := User{UID: uid, GID: -1, GIDs: gids}
+	if pw, err := user.GetPwUID(uint32(uid)); err == nil {
+		u.Name = pw.Name
+		u.GID = int(pw.GID)
+		if !slices.Contains(gids, u.GID) {
+			u.GIDs = append([]int{u.GID}, gids...)
+		}
+	}
+	for _, gid := range u.GIDs {
+		if gr, err := user.GetGrGID(uint32(gid)); err == nil {
+			u.Groups = append(u.Groups, gr.Name)
+		}
+	}
+	return u
+}
+
+// NewRequest describes the container configuration requested with an
+// engine configuration.
+func NewRequest(c *apptainerConfig.EngineConfig) Request {
+	r := Request{
+		Writable:      c.GetWritableImage(),
+		WritableTmpfs: c.GetWritableTmpfs(),
+		Fakeroot:      c.GetFakeroot(),
+		Instance:      c.GetInstance(),
+		Network:       c.GetNetwork(),
+	}
+
+	for _, b := range c.GetBindPath() {
+		r.Binds = append(r.Binds, Bind{
+			Source:      b.Source,
+			Destination: b.Destination,
+			ReadOnly:    b.Readonly(),
+		})
+	}
+	if c.OciConfig.Linux != nil {
+		for _, ns := range c.OciConfig.Linux.Namespaces {
+			r.Namespaces = append(r.Namespaces, string(ns.Type))
+		}
+	}
+	r.AddCaps, _ = capabilities.Split(c.GetAddCaps())
+	r.DropCaps, _ = capabilities.Split(c.GetDropCaps())
+
+	if c.GetNvLegacy() || c.GetNvCCLI() {
+		r.Devices = append(r.Devices, "nvidia")
+	}
+	if c.GetRocm() {
+		r.Devices = append(r.Devices, "rocm")
+	}
+	if c.GetIntelHpu() {
+		r.Devices = append(r.Devices, "intel-hpu")
+	}
+	r.Devices = append(r.Devices, c.GetDevices()...)
+	return r
+}
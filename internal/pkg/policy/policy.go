@@ -0,0 +1,149 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package policy evaluates the admission policy of an administrator before
+// a container is started. A policy is a list of rules whose CEL expressions
+// deny the launch when they evaluate to true.
+package policy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"go.yaml.in/yaml/v4"
+)
+
+// Rule denies a container launch when its Deny expression is true.
+type Rule struct {
+	// Name identifies the rule in messages.
+	Name string `yaml:"name"`
+	// Deny is a CEL expression evaluated against the image, user and
+	// request variables.
+	Deny string `yaml:"deny"`
+	// Reason is the human readable message reported when the rule denies
+	// the launch.
+	Reason string `yaml:"reason"`
+}
+
+// Policy is a compiled list of rules.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+
+	programs []cel.Program
+}
+
+// DeniedError is returned by Evaluate with the reasons of all the rules
+// denying a launch.
+type DeniedError struct {
+	Reasons []string
+}
+
+func (e *DeniedError) Error() string {
+	return "container denied by policy: " + strings.Join(e.Reasons, "; ")
+}
+
+// Load reads and compiles the policy file at path.
+func Load(path string) (*Policy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("while reading policy file: %s", err)
+	}
+	p, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing policy file %s: %s", path, err)
+	}
+	return p, nil
+}
+
+// Parse compiles a policy in YAML format.
+func Parse(data []byte) (*Policy, error) {
+	p := new(Policy)
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+
+	env, err := cel.NewEnv(
+		cel.Variable("image", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("user", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if strings.TrimSpace(r.Deny) == "" {
+			return nil, fmt.Errorf("%s: missing deny expression", r.Name)
+		}
+		ast, iss := env.Compile(r.Deny)
+		if iss.Err() != nil {
+			return nil, fmt.Errorf("%s: %s", r.Name, iss.Err())
+		}
+		if t := ast.OutputType(); t != cel.BoolType && t != cel.DynType {
+			return nil, fmt.Errorf("%s: deny expression must be a boolean, not %s", r.Name, t)
+		}
+		prg, err := env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", r.Name, err)
+		}
+		p.programs = append(p.programs, prg)
+	}
+	return p, nil
+}
+
+// Uses reports whether a rule may reference field, it allows to skip
+// computing expensive fields like the image digest.
+func (p *Policy) Uses(field string) bool {
+	for _, r := range p.Rules {
+		if strings.Contains(r.Deny, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate evaluates all rules against the input and returns a DeniedError
+// if any of them denies the launch. A rule which can't be evaluated denies
+// the launch.
+func (p *Policy) Evaluate(in Input) error {
+	vars := in.vars()
+
+	var reasons []string
+	for i, prg := range p.programs {
+		r := p.Rules[i]
+		out, _, err := prg.Eval(vars)
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("%s could not be evaluated: %s", r.Name, err))
+			continue
+		}
+		deny, ok := out.Value().(bool)
+		if !ok {
+			reasons = append(reasons, fmt.Sprintf("%s returned a non boolean value", r.Name))
+			continue
+		}
+		if !deny {
+			continue
+		}
+		if r.Reason != "" {
+			reasons = append(reasons, r.Reason)
+		} else {
+			reasons = append(reasons, "denied by "+r.Name)
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &DeniedError{Reasons: reasons}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/apptainer/apptainer/pkg/image"
+)
+
+const testPolicy = `
+rules:
+  - name: signed
+    deny: '!("0123456789ABCDEF0123456789ABCDEF01234567" in image.signers)'
+    reason: images must be signed by the site key
+  - name: writable-shared
+    deny: request.writable && image.path.startsWith("/shared/")
+    reason: --writable is not allowed on shared storage
+  - name: gpus
+    deny: '"nvidia" in request.devices && !("gpu-users" in user.groups)'
+    reason: GPUs are reserved to the gpu-users group
+  - deny: request.binds.exists(b, b.source == "/etc" && !b.readonly)
+`
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Rules) != 4 {
+		t.Fatalf("got %d rules, want 4", len(p.Rules))
+	}
+	if p.Rules[3].Name != "rule 4" {
+		t.Errorf("got default rule name %q, want %q", p.Rules[3].Name, "rule 4")
+	}
+	if !p.Uses("signers") || p.Uses("digest") {
+		t.Errorf("unexpected fields usage")
+	}
+
+	tests := []struct {
+		name   string
+		policy string
+	}{
+		{"BadYAML", "rules: [name"},
+		{"MissingDeny", "rules:\n  - name: empty\n"},
+		{"SyntaxError", "rules:\n  - deny: request.writable &&\n"},
+		{"UndeclaredVariable", "rules:\n  - deny: host.name == 'x'\n"},
+		{"NotBoolean", "rules:\n  - deny: '\"string\"'\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.policy)); err == nil {
+				t.Errorf("unexpected success")
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allowed := Input{
+		Image: Image{Path: "/home/user/.apptainer/cache/app.sif", Signers: []string{"0123456789ABCDEF0123456789ABCDEF01234567"}},
+		User:  User{Name: "user", Groups: []string{"user", "gpu-users"}},
+		Request: Request{
+			Writable: true,
+			Devices:  []string{"nvidia"},
+			Binds:    []Bind{{Source: "/etc", Destination: "/etc", ReadOnly: true}},
+		},
+	}
+	if err := p.Evaluate(allowed); err != nil {
+		t.Errorf("unexpected denial: %s", err)
+	}
+
+	denied := Input{
+		Image: Image{Path: "/shared/alpine.sif"},
+		User:  User{Name: "user", Groups: []string{"user"}},
+		Request: Request{
+			Writable: true,
+			Devices:  []string{"nvidia"},
+			Binds:    []Bind{{Source: "/etc", Destination: "/host/etc"}},
+		},
+	}
+	err = p.Evaluate(denied)
+	var de *DeniedError
+	if !errors.As(err, &de) {
+		t.Fatalf("got error %v, want a DeniedError", err)
+	}
+	want := []string{
+		"images must be signed by the site key",
+		"--writable is not allowed on shared storage",
+		"GPUs are reserved to the gpu-users group",
+		"denied by rule 4",
+	}
+	if !reflect.DeepEqual(de.Reasons, want) {
+		t.Errorf("got reasons %q, want %q", de.Reasons, want)
+	}
+}
+
+func TestEvaluateError(t *testing.T) {
+	// a missing map key is an evaluation error, which denies the launch
+	p, err := Parse([]byte("rules:\n  - name: typo\n    deny: request.writeable\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Evaluate(Input{})
+	if err == nil || !strings.Contains(err.Error(), "typo could not be evaluated") {
+		t.Errorf("got error %v, want an evaluation error", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(testPolicy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("unexpected success with a missing policy file")
+	}
+}
+
+func TestNewImage(t *testing.T) {
+	f, err := os.Open(filepath.Join("..", "..", "..", "test", "keys", "pgp-public.asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	kr, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	images := filepath.Join("..", "..", "..", "test", "images")
+	tests := []struct {
+		name    string
+		path    string
+		signers []string
+	}{
+		{"Unsigned", filepath.Join(images, "one-group.sif"), nil},
+		{"Signed", filepath.Join(images, "one-group-signed-pgp.sif"), []string{"F34371D0ACD5D09EB9BD853A80600A5FA11BBD29"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Open(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			img := &image.Image{Path: tt.path, Type: image.SIF, File: f}
+			i, err := NewImage(img, true, kr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i.Format != "sif" {
+				t.Errorf("got format %q, want sif", i.Format)
+			}
+			if !strings.HasPrefix(i.Digest, "sha256:") || len(i.Digest) != 71 {
+				t.Errorf("got invalid digest %q", i.Digest)
+			}
+			if !reflect.DeepEqual(i.Signers, tt.signers) {
+				t.Errorf("got signers %v, want %v", i.Signers, tt.signers)
+			}
+		})
+	}
+}
@@ -26,4 +26,7 @@ type Config struct {
 	// or that credentials are stored elsewhere
 	Auth     string `yaml:"Auth,omitempty"`
 	Insecure bool   `yaml:"Insecure"`
+	// OIDC is the OIDC login refreshing the credentials of Docker/OCI
+	// registries, if they were obtained by an OIDC login.
+	OIDC *OIDCLogin `yaml:"OIDC,omitempty"`
 }
@@ -0,0 +1,335 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package credential
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/ociauth"
+)
+
+const (
+	// discoveryPath is the path of the OpenID provider metadata, relative to
+	// the issuer URL.
+	discoveryPath = "/.well-known/openid-configuration"
+	// deviceCodeGrantType is the grant type of device access token requests.
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	// defaultPollInterval is the interval between device access token
+	// requests, if not set by the provider.
+	defaultPollInterval = 5 * time.Second
+	// expiryDelta is how long before their expiry access tokens are
+	// refreshed.
+	expiryDelta = time.Minute
+)
+
+// defaultScopes are the scopes requested if not configured, with
+// offline_access to obtain a refresh token.
+var defaultScopes = []string{"openid", "offline_access"}
+
+// ErrLoginExpired is returned when the refresh token of an OIDC login is
+// rejected, the user having to log in again.
+var ErrLoginExpired = errors.New("OIDC login expired")
+
+var oidcClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// OIDCConfig holds the OIDC provider and client used to log in.
+type OIDCConfig struct {
+	// Issuer is the issuer URL of the OIDC provider.
+	Issuer string `yaml:"Issuer"`
+	// ClientID is the identifier of the public client logging in.
+	ClientID string `yaml:"ClientID"`
+	// Scopes are the scopes requested, openid and offline_access if empty.
+	Scopes []string `yaml:"Scopes,omitempty"`
+}
+
+// OIDCToken holds the tokens obtained from an OIDC provider.
+type OIDCToken struct {
+	AccessToken  string
+	RefreshToken string
+	// Expiry is the expiry of the access token, zero if unknown.
+	Expiry time.Time
+}
+
+// OIDCLogin holds an OIDC login, to refresh its access token.
+type OIDCLogin struct {
+	OIDCConfig `yaml:",inline"`
+	// Username is the username sent along the access token to registries.
+	Username     string    `yaml:"Username,omitempty"`
+	RefreshToken string    `yaml:"RefreshToken,omitempty"`
+	Expiry       time.Time `yaml:"Expiry,omitempty"`
+}
+
+// DeviceCode holds the code entered by users to authorize a device login.
+type DeviceCode struct {
+	UserCode        string
+	VerificationURI string
+	// VerificationURIComplete is the verification URI including the user
+	// code, if provided.
+	VerificationURIComplete string
+}
+
+// oidcError is an error response of an OAuth 2.0 endpoint.
+type oidcError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *oidcError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Description)
+	}
+	return e.Code
+}
+
+// providerMetadata holds the endpoints of an OIDC provider.
+type providerMetadata struct {
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+}
+
+// metadata discovers the endpoints of the OIDC provider of c.
+func (c OIDCConfig) metadata(ctx context.Context) (*providerMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.Issuer, "/")+discoveryPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := oidcClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to OIDC provider: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error response from OIDC provider: %s", res.Status)
+	}
+	var m providerMetadata
+	if err := json.NewDecoder(res.Body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid OIDC provider metadata: %v", err)
+	}
+	if m.TokenEndpoint == "" {
+		return nil, fmt.Errorf("OIDC provider has no token endpoint")
+	}
+	return &m, nil
+}
+
+// postForm posts the form values to endpoint, decoding the JSON response
+// into v.
+func postForm(ctx context.Context, endpoint string, values url.Values, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := oidcClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request to OIDC provider: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		oe := new(oidcError)
+		if err := json.NewDecoder(res.Body).Decode(oe); err != nil || oe.Code == "" {
+			return fmt.Errorf("error response from OIDC provider: %s", res.Status)
+		}
+		return oe
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid response from OIDC provider: %v", err)
+	}
+	return nil
+}
+
+// requestToken requests tokens from the token endpoint with the form values.
+func requestToken(ctx context.Context, endpoint string, values url.Values) (*OIDCToken, error) {
+	var res struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := postForm(ctx, endpoint, values, &res); err != nil {
+		return nil, err
+	}
+	if res.AccessToken == "" {
+		return nil, errors.New("no access token returned by OIDC provider")
+	}
+
+	t := &OIDCToken{
+		AccessToken:  res.AccessToken,
+		RefreshToken: res.RefreshToken,
+	}
+	if res.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+	return t, nil
+}
+
+// DeviceLogin logs in with the OAuth 2.0 device authorization grant, calling
+// prompt with the code users enter to authorize the login, then waiting for
+// their authorization.
+func (c OIDCConfig) DeviceLogin(ctx context.Context, prompt func(DeviceCode)) (*OIDCToken, error) {
+	m, err := c.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if m.DeviceAuthorizationEndpoint == "" {
+		return nil, fmt.Errorf("OIDC provider %s doesn't support device login", c.Issuer)
+	}
+
+	scopes := c.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	}
+	var da struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int64  `json:"expires_in"`
+		Interval                int64  `json:"interval"`
+	}
+	err = postForm(ctx, m.DeviceAuthorizationEndpoint, url.Values{
+		"client_id": {c.ClientID},
+		"scope":     {strings.Join(scopes, " ")},
+	}, &da)
+	if err != nil {
+		return nil, fmt.Errorf("while requesting device code: %w", err)
+	}
+
+	prompt(DeviceCode{
+		UserCode:                da.UserCode,
+		VerificationURI:         da.VerificationURI,
+		VerificationURIComplete: da.VerificationURIComplete,
+	})
+
+	if da.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(da.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+	interval := time.Duration(da.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	values := url.Values{
+		"grant_type":  {deviceCodeGrantType},
+		"device_code": {da.DeviceCode},
+		"client_id":   {c.ClientID},
+	}
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, errors.New("device code expired before the login was authorized")
+			}
+			return nil, ctx.Err()
+		}
+
+		t, err := requestToken(ctx, m.TokenEndpoint, values)
+		if oe := (*oidcError)(nil); errors.As(err, &oe) {
+			switch oe.Code {
+			case "authorization_pending":
+				continue
+			case "slow_down":
+				interval += 5 * time.Second
+				continue
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("while waiting for login authorization: %w", err)
+		}
+		return t, nil
+	}
+}
+
+// NewOIDCLogin returns the OIDC login with the provider and client of c
+// having obtained t, sending username along the access token to registries.
+func NewOIDCLogin(c OIDCConfig, username string, t *OIDCToken) *OIDCLogin {
+	return &OIDCLogin{
+		OIDCConfig:   c,
+		Username:     username,
+		RefreshToken: t.RefreshToken,
+		Expiry:       t.Expiry,
+	}
+}
+
+// Expiring returns whether the access token expires soon and can be
+// refreshed.
+func (l *OIDCLogin) Expiring() bool {
+	return l.RefreshToken != "" && !l.Expiry.IsZero() && time.Until(l.Expiry) < expiryDelta
+}
+
+// Refresh returns a new access token obtained with the refresh token,
+// updating the login with the refresh token and expiry returned. If the
+// refresh token is rejected, it is removed from the login and ErrLoginExpired
+// is returned.
+func (l *OIDCLogin) Refresh(ctx context.Context) (string, error) {
+	m, err := l.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	t, err := requestToken(ctx, m.TokenEndpoint, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {l.RefreshToken},
+		"client_id":     {l.ClientID},
+	})
+	if oe := (*oidcError)(nil); errors.As(err, &oe) && oe.Code == "invalid_grant" {
+		// don't try to refresh again until the next login
+		l.RefreshToken = ""
+		return "", fmt.Errorf("%w: %v", ErrLoginExpired, oe)
+	} else if err != nil {
+		return "", fmt.Errorf("while refreshing access token: %w", err)
+	}
+
+	// providers may not rotate refresh tokens
+	if t.RefreshToken != "" {
+		l.RefreshToken = t.RefreshToken
+	}
+	l.Expiry = t.Expiry
+	return t.AccessToken, nil
+}
+
+// RefreshToken refreshes Docker/OCI registry credentials obtained by an OIDC
+// login if they expire soon, storing the new access token in the default OCI
+// registry auth file. It returns whether the OIDC login was updated.
+func (c *Config) RefreshToken(ctx context.Context) (bool, error) {
+	if c.OIDC == nil || !c.OIDC.Expiring() {
+		return false, nil
+	}
+
+	u, err := url.Parse(c.URI)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := loginHandlers[u.Scheme].(*ociHandler); !ok {
+		return false, fmt.Errorf("OIDC login is not supported for %s", c.URI)
+	}
+
+	token, err := c.OIDC.Refresh(ctx)
+	if err != nil {
+		return errors.Is(err, ErrLoginExpired), err
+	}
+	if _, err := ociauth.StoreCredentials(u.Host+u.Path, c.OIDC.Username, token, ""); err != nil {
+		return true, err
+	}
+	return true, nil
+}
@@ -0,0 +1,248 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package credential
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/util/ociauth"
+)
+
+const (
+	testClientID   = "apptainer"
+	testDeviceCode = "device-code"
+	testUserCode   = "ABCD-EFGH"
+)
+
+// mockIdP is an OIDC provider supporting device logins and refresh tokens.
+type mockIdP struct {
+	*httptest.Server
+	// pending is the number of access token requests answered with
+	// authorization_pending before the login is authorized.
+	pending int
+	// deny makes users deny the device login.
+	deny bool
+	// scope is the scope requested by the last device login.
+	scope string
+	// refreshToken is the refresh token currently valid.
+	refreshToken string
+	// issued is the number of access tokens issued.
+	issued int
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	m := &mockIdP{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+discoveryPath, func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                        m.URL,
+			"device_authorization_endpoint": m.URL + "/device",
+			"token_endpoint":                m.URL + "/token",
+		})
+	})
+	mux.HandleFunc("POST /device", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != testClientID {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+		m.scope = r.FormValue("scope")
+		writeJSON(w, http.StatusOK, map[string]any{
+			"device_code":      testDeviceCode,
+			"user_code":        testUserCode,
+			"verification_uri": m.URL + "/activate",
+			"expires_in":       60,
+			"interval":         1,
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("grant_type") {
+		case deviceCodeGrantType:
+			switch {
+			case r.FormValue("device_code") != testDeviceCode:
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+				return
+			case m.pending > 0:
+				m.pending--
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "authorization_pending"})
+				return
+			case m.deny:
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "access_denied"})
+				return
+			}
+		case "refresh_token":
+			if r.FormValue("refresh_token") != m.refreshToken {
+				writeJSON(w, http.StatusBadRequest, map[string]string{
+					"error":             "invalid_grant",
+					"error_description": "refresh token expired",
+				})
+				return
+			}
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+			return
+		}
+
+		m.issued++
+		m.refreshToken = "refresh-" + strconv.Itoa(m.issued)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token":  "access-" + strconv.Itoa(m.issued),
+			"token_type":    "Bearer",
+			"refresh_token": m.refreshToken,
+			"expires_in":    300,
+		})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (m *mockIdP) config() OIDCConfig {
+	return OIDCConfig{Issuer: m.URL, ClientID: testClientID}
+}
+
+func TestDeviceLogin(t *testing.T) {
+	m := newMockIdP(t)
+	m.pending = 1
+
+	var code DeviceCode
+	token, err := m.config().DeviceLogin(context.Background(), func(dc DeviceCode) { code = dc })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code.UserCode != testUserCode || code.VerificationURI != m.URL+"/activate" {
+		t.Errorf("unexpected device code %+v", code)
+	}
+	if m.scope != "openid offline_access" {
+		t.Errorf("got scope %q, want default scopes", m.scope)
+	}
+	if token.AccessToken != "access-1" || token.RefreshToken != "refresh-1" {
+		t.Errorf("unexpected token %+v", token)
+	}
+	if d := time.Until(token.Expiry); d <= 4*time.Minute || d > 5*time.Minute {
+		t.Errorf("unexpected token expiry in %v", d)
+	}
+}
+
+func TestDeviceLoginDenied(t *testing.T) {
+	m := newMockIdP(t)
+	m.deny = true
+
+	cfg := m.config()
+	cfg.Scopes = []string{"openid", "offline_access", "library"}
+	_, err := cfg.DeviceLogin(context.Background(), func(DeviceCode) {})
+	if err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("got error %v, want access denied", err)
+	}
+	if m.scope != "openid offline_access library" {
+		t.Errorf("got scope %q, want configured scopes", m.scope)
+	}
+
+	cfg.ClientID = "unknown"
+	if _, err := cfg.DeviceLogin(context.Background(), func(DeviceCode) {}); err == nil {
+		t.Errorf("unexpected success with unknown client")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	m := newMockIdP(t)
+	m.refreshToken = "refresh-0"
+
+	l := NewOIDCLogin(m.config(), "", &OIDCToken{
+		AccessToken:  "access-0",
+		RefreshToken: "refresh-0",
+		Expiry:       time.Now().Add(10 * time.Second),
+	})
+	if !l.Expiring() {
+		t.Fatalf("access token expiring in 10s not refreshed")
+	}
+
+	token, err := l.Refresh(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "access-1" || l.RefreshToken != "refresh-1" {
+		t.Errorf("got access token %q and refresh token %q", token, l.RefreshToken)
+	}
+	if l.Expiring() {
+		t.Errorf("refreshed access token still expiring")
+	}
+
+	// rejected refresh tokens require to log in again
+	l.RefreshToken = "refresh-0"
+	if _, err := l.Refresh(context.Background()); !errors.Is(err, ErrLoginExpired) {
+		t.Errorf("got error %v, want %v", err, ErrLoginExpired)
+	}
+	if l.RefreshToken != "" {
+		t.Errorf("rejected refresh token kept")
+	}
+	l.Expiry = time.Now()
+	if l.Expiring() {
+		t.Errorf("login without refresh token refreshed")
+	}
+}
+
+func TestConfigRefreshToken(t *testing.T) {
+	m := newMockIdP(t)
+	m.refreshToken = "refresh-0"
+
+	// refreshed credentials are stored in the default auth file
+	dir := t.TempDir()
+	t.Setenv("APPTAINER_CONFIGDIR", dir)
+	authFile := filepath.Join(dir, "docker-config.json")
+	if err := os.WriteFile(authFile, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Config{
+		URI: "docker://registry.example.com",
+		OIDC: &OIDCLogin{
+			OIDCConfig:   m.config(),
+			Username:     "alice",
+			RefreshToken: "refresh-0",
+			Expiry:       time.Now().Add(-time.Minute),
+		},
+	}
+	ok, err := c.RefreshToken(context.Background())
+	if err != nil || !ok {
+		t.Fatalf("got %v, %v, want refreshed credentials", ok, err)
+	}
+
+	cf, err := ociauth.ConfigFileFromPath(authFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := cf.GetAuthConfigs()["registry.example.com"]
+	if auth.Username != "alice" || auth.Password != "access-1" {
+		t.Errorf("got stored credentials %s:%s, want alice:access-1", auth.Username, auth.Password)
+	}
+
+	// credentials not expiring are left as is
+	if ok, err := c.RefreshToken(context.Background()); ok || err != nil {
+		t.Errorf("got %v, %v, want no refresh", ok, err)
+	}
+}
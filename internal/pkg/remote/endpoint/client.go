@@ -133,6 +133,39 @@ func (config *Config) LibraryClientConfig(uri string) (*libClient.Config, error)
 	return libraryConfig, nil
 }
 
+// BuilderClientConfig returns the base URI and the authentication token of
+// the build server at uri, or of the build service of the endpoint if uri is
+// empty.
+func (config *Config) BuilderClientConfig(uri string) (baseURI, authToken string, err error) {
+	// empty uri means to use the default endpoint
+	if uri == "" {
+		builderURI, err := config.GetServiceURI(Builder)
+		if err != nil {
+			return "", "", fmt.Errorf("unable to get builder service URI: %v", err)
+		}
+		return builderURI, config.Token, nil
+	}
+
+	builderURI, err := config.GetServiceURI(Builder)
+	if config.Exclusive {
+		if err != nil {
+			return "", "", fmt.Errorf("unable to get builder service URI: %v", err)
+		}
+		if !remoteutil.SameURI(uri, builderURI) {
+			return "", "", fmt.Errorf(
+				"endpoint is set as exclusive by the system administrator: only %q can be used",
+				builderURI,
+			)
+		}
+	}
+
+	// the token of the endpoint is only sent to its own build service
+	if err == nil && remoteutil.SameURI(uri, builderURI) {
+		return uri, config.Token, nil
+	}
+	return uri, "", nil
+}
+
 // RegistryURI returns the URI of the backing OCI registry for the library service, associated with ep.
 func (config *Config) RegistryURI() (string, error) {
 	registryURI, err := config.getServiceConfigVal(Library, RegistryURIConfigKey)
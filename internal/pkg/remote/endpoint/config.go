@@ -41,6 +41,8 @@ type Config struct {
 	Exclusive  bool             `yaml:"Exclusive"`          // true if the endpoint must be used exclusively
 	Insecure   bool             `yaml:"Insecure,omitempty"` // Allow use of http for service discovery
 	Keyservers []*ServiceConfig `yaml:"Keyservers,omitempty"`
+	// OIDC login refreshing Token, if obtained by an OIDC login
+	OIDC *credential.OIDCLogin `yaml:"OIDC,omitempty"`
 
 	// for internal purpose
 	credentials []*credential.Config
@@ -46,11 +46,18 @@ const (
 	Keystore  = "keystore" // alias for keyserver
 	Keyserver = "keyserver"
 	Builder   = "builder"
+	OIDC      = "oidc" // OIDC provider issuing the tokens of the endpoint
 )
 
 // RegistryURIConfigKey is the config key for the library OCI registry URI
 const RegistryURIConfigKey = "registryUri"
 
+// Config keys of the OIDC client logging in to the endpoint.
+const (
+	OIDCClientIDConfigKey = "clientId"
+	OIDCScopesConfigKey   = "scopes" // space separated
+)
+
 var errorCodeMap = map[int]string{
 	404: "Invalid Credentials",
 	500: "Internal Server Error",
@@ -214,6 +221,15 @@ func (config *Config) GetAllServices() (map[string][]Service, error) {
 			}
 		}
 
+		// Store the OIDC client settings.
+		if s == OIDC {
+			for _, key := range []string{OIDCClientIDConfigKey, OIDCScopesConfigKey} {
+				if val, ok := v[key].(string); ok {
+					sConfigMap[key] = val
+				}
+			}
+		}
+
 		config.services[s] = []Service{
 			&service{
 				cfg:       sConfig,
@@ -11,8 +11,11 @@
 package endpoint
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/apptainer/apptainer/internal/pkg/remote/credential"
 	"github.com/apptainer/apptainer/pkg/sylog"
@@ -74,3 +77,45 @@ func (config *Config) VerifyToken(token string) (err error) {
 
 	return nil
 }
+
+// OIDCConfig returns the OIDC provider and client to log in to the endpoint
+// with, as advertised by its oidc service.
+func (config *Config) OIDCConfig() (credential.OIDCConfig, error) {
+	issuer, err := config.GetServiceURI(OIDC)
+	if err != nil {
+		return credential.OIDCConfig{}, fmt.Errorf("no OIDC login at endpoint: %w", err)
+	}
+	clientID, err := config.getServiceConfigVal(OIDC, OIDCClientIDConfigKey)
+	if err != nil {
+		return credential.OIDCConfig{}, err
+	} else if clientID == "" {
+		return credential.OIDCConfig{}, fmt.Errorf("oidc service at endpoint failed to provide %s in response", OIDCClientIDConfigKey)
+	}
+	scopes, err := config.getServiceConfigVal(OIDC, OIDCScopesConfigKey)
+	if err != nil {
+		return credential.OIDCConfig{}, err
+	}
+
+	return credential.OIDCConfig{
+		Issuer:   issuer,
+		ClientID: clientID,
+		Scopes:   strings.Fields(scopes),
+	}, nil
+}
+
+// RefreshToken refreshes the token of the endpoint if obtained by an OIDC login
+// and expiring soon. It returns whether the OIDC login was updated.
+func (config *Config) RefreshToken(ctx context.Context) (bool, error) {
+	if config.OIDC == nil || !config.OIDC.Expiring() {
+		return false, nil
+	}
+
+	token, err := config.OIDC.Refresh(ctx)
+	if err != nil {
+		return errors.Is(err, credential.ErrLoginExpired), err
+	}
+	config.Token = token
+	// services hold credentials with the previous token
+	config.services = nil
+	return true, nil
+}
@@ -12,11 +12,13 @@ package remote
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/internal/pkg/remote/credential"
@@ -305,6 +307,50 @@ func (c *Config) Logout(uri string, reqAuthFile string) error {
 	return nil
 }
 
+// LoginOIDC validates and stores the access token of token, obtained by an
+// OIDC login with oc, as the password of username for a Docker/OCI registry.
+// The OIDC login is stored along the credentials to refresh the access token.
+func (c *Config) LoginOIDC(uri, username string, oc credential.OIDCConfig, token *credential.OIDCToken, insecure bool) error {
+	if !strings.HasPrefix(uri, "docker://") && !strings.HasPrefix(uri, "oras://") {
+		return fmt.Errorf("OIDC login is only supported for docker:// and oras:// registries")
+	}
+	if err := c.Login(uri, username, token.AccessToken, insecure, ""); err != nil {
+		return err
+	}
+
+	for _, cred := range c.Credentials {
+		if remoteutil.SameURI(cred.URI, uri) {
+			cred.OIDC = credential.NewOIDCLogin(oc, username, token)
+		}
+	}
+	return nil
+}
+
+// RefreshTokens refreshes the tokens of remotes and the registry credentials
+// obtained by OIDC logins, which expire soon. It returns whether c was
+// updated, including when some of the refreshes failed.
+func (c *Config) RefreshTokens(ctx context.Context) (bool, error) {
+	var updated bool
+	var errs []error
+
+	for name, e := range c.Remotes {
+		ok, err := e.RefreshToken(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("remote %s: %w", name, err))
+		}
+		updated = updated || ok
+	}
+	for _, cred := range c.Credentials {
+		ok, err := cred.RefreshToken(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", cred.URI, err))
+		}
+		updated = updated || ok
+	}
+
+	return updated, errors.Join(errs...)
+}
+
 // Rename an existing remote
 // returns an error if it does not exist
 func (c *Config) Rename(name, newName string) error {
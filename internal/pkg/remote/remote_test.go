@@ -16,7 +16,9 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/apptainer/apptainer/internal/pkg/remote/credential"
 	"github.com/apptainer/apptainer/internal/pkg/remote/endpoint"
 	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
 	"go.yaml.in/yaml/v4"
@@ -75,6 +77,41 @@ func TestWriteToReadFrom(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "config with OIDC logins",
+			c: Config{
+				DefaultRemote: "cloud",
+				Remotes: map[string]*endpoint.Config{
+					"cloud": {
+						URI:   "cloud.sycloud.io",
+						Token: testToken,
+						OIDC: &credential.OIDCLogin{
+							OIDCConfig: credential.OIDCConfig{
+								Issuer:   "https://sso.sycloud.io",
+								ClientID: "apptainer",
+								Scopes:   []string{"openid", "offline_access"},
+							},
+							RefreshToken: "refresh-token",
+							Expiry:       time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+						},
+					},
+				},
+				Credentials: []*credential.Config{
+					{
+						URI: "docker://registry.sycloud.io",
+						OIDC: &credential.OIDCLogin{
+							OIDCConfig: credential.OIDCConfig{
+								Issuer:   "https://sso.sycloud.io",
+								ClientID: "apptainer",
+							},
+							Username:     "alice",
+							RefreshToken: "refresh-token",
+							Expiry:       time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+						},
+					},
+				},
+			},
+		},
 	}
 
 	testsFail := []struct {
@@ -0,0 +1,103 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/apptainer/apptainer/internal/pkg/audit"
+	"github.com/apptainer/apptainer/internal/pkg/util/priv"
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// auditEnabled returns whether container starts and exits are audited.
+func (e *EngineOperations) auditEnabled() bool {
+	return e.EngineConfig.File.AuditLog != "" && e.EngineConfig.File.AuditLog != audit.DestNone
+}
+
+// prepareAuditEvent gathers the audit event describing the container in
+// stage 1, it's written later by the master process.
+func (e *EngineOperations) prepareAuditEvent(img *image.Image) error {
+	gids, err := os.Getgroups()
+	if err != nil {
+		return fmt.Errorf("while getting user groups: %s", err)
+	}
+	ev, err := audit.NewEvent(img, e.EngineConfig, os.Getuid(), gids, e.EngineConfig.File.AuditImageDigest)
+	if err != nil {
+		return fmt.Errorf("while gathering audit event: %s", err)
+	}
+	if e.EngineConfig.GetInstance() {
+		ev.Instance = e.CommonConfig.ContainerID
+	}
+
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	e.EngineConfig.SetAuditEvent(b)
+	return nil
+}
+
+// writeAuditStart writes the start event of the container process pid.
+func (e *EngineOperations) writeAuditStart(pid int) error {
+	var ev audit.Event
+	if err := json.Unmarshal(e.EngineConfig.GetAuditEvent(), &ev); err != nil {
+		return fmt.Errorf("while decoding audit event: %s", err)
+	}
+	ev = ev.Start(pid)
+
+	// keep the process PID for the exit event
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	e.EngineConfig.SetAuditEvent(b)
+
+	return e.writeAuditEvent(ev)
+}
+
+// writeAuditExit writes the exit event of the container process.
+func (e *EngineOperations) writeAuditExit(status syscall.WaitStatus) {
+	var ev audit.Event
+	if err := json.Unmarshal(e.EngineConfig.GetAuditEvent(), &ev); err != nil {
+		sylog.Errorf("While decoding audit event: %s", err)
+		return
+	}
+	// the container process was not started
+	if ev.PID == 0 {
+		return
+	}
+	if err := e.writeAuditEvent(ev.Exit(status)); err != nil {
+		sylog.Errorf("While writing audit exit event: %s", err)
+	}
+}
+
+// writeAuditEvent writes an audit event, with privileges in the setuid
+// workflow. Without privileges, events are written on a best effort basis
+// and skipped if they can't be written.
+func (e *EngineOperations) writeAuditEvent(ev audit.Event) error {
+	file := e.EngineConfig.File
+
+	if os.Geteuid() != 0 {
+		dropPrivilege, err := priv.Escalate()
+		if err != nil {
+			if err := audit.Write(file.AuditLog, file.AuditLogFile, ev); err != nil {
+				sylog.Debugf("Skipping audit event, unable to write it without privileges: %s", err)
+			}
+			return nil
+		}
+		defer dropPrivilege()
+	}
+
+	return audit.Write(file.AuditLog, file.AuditLogFile, ev)
+}
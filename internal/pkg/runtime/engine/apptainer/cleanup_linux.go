@@ -43,8 +43,12 @@ import (
 // For better understanding of runtime flow in general refer to
 // https://github.com/opencontainers/runtime-spec/blob/master/runtime.md#lifecycle.
 // CleanupContainer is performing step 8/9 here.
-func (e *EngineOperations) CleanupContainer(ctx context.Context, _ error, _ syscall.WaitStatus) error {
+func (e *EngineOperations) CleanupContainer(ctx context.Context, _ error, status syscall.WaitStatus) error {
 	sylog.Debugf("Cleanup container")
+
+	if len(e.EngineConfig.GetAuditEvent()) > 0 {
+		e.writeAuditExit(status)
+	}
 	if fd := e.EngineConfig.GetShareNSFd(); fd != -1 && e.EngineConfig.GetShareNSMode() {
 		br := lock.NewByteRange(fd, 0, 0)
 		// wait all other processes first
@@ -126,6 +130,17 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, _ error, _ sysc
 		}
 	}
 
+	if seccompRecord != nil {
+		e.writeSeccompRecord()
+	}
+
+	if slirpNetwork != nil {
+		sylog.Debugf("Stopping user mode network")
+		if err := slirpNetwork.Stop(); err != nil {
+			sylog.Errorf("could not stop user mode network: %v", err)
+		}
+	}
+
 	if cgroupsManager != nil {
 		if err := cgroupsManager.Destroy(); err != nil {
 			sylog.Warningf("failed to remove cgroup configuration: %v", err)
@@ -15,6 +15,7 @@ import (
 	"os"
 	osuser "os/user"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
@@ -24,6 +25,7 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/image/driver"
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/apptainer/rpc/client"
+	"github.com/apptainer/apptainer/internal/pkg/util/bin"
 	"github.com/apptainer/apptainer/internal/pkg/util/cdi"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs/files"
@@ -44,6 +46,7 @@ import (
 	"github.com/apptainer/apptainer/pkg/util/fs/proc"
 	"github.com/apptainer/apptainer/pkg/util/namespaces"
 	"github.com/apptainer/apptainer/pkg/util/slice"
+	"github.com/apptainer/apptainer/pkg/util/sysctl"
 	"github.com/ccoveille/go-safecast/v2"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
@@ -66,6 +69,9 @@ var (
 	imageDriver    image.Driver
 	umountPoints   []umountPoint
 	cgroupsManager *cgroups.Manager
+	instanceHosts  *hostsFile
+	slirpNetwork   *network.Slirp
+	seccompRecord  *seccompRecorder
 )
 
 // defaultCNIConfPath is the default directory to CNI network configuration files.
@@ -96,6 +102,7 @@ type container struct {
 	suidFlag      uintptr
 	devSourcePath string
 	skipCwd       bool
+	hostsContent  []byte
 }
 
 //nolint:maintidx
@@ -377,6 +384,21 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 		}
 	}
 
+	// hosts entries depending on network addresses are set once
+	// network interfaces are created
+	if err := c.updateHostsFile(); err != nil {
+		return err
+	}
+	if c.hostsContent != nil && c.isInstanceOnNetwork() {
+		path, _ := c.session.GetPath("/etc/hosts")
+		instanceHosts = &hostsFile{path: path, content: c.hostsContent}
+	}
+
+	// kernel parameters are set once network interfaces are created
+	if err := c.setSysctls(pid); err != nil {
+		return err
+	}
+
 	cgJSON := engine.EngineConfig.GetCgroupsJSON()
 	if cgJSON != "" {
 		// Rootless cgroups setup interacts with systemd over D-Bus.
@@ -1832,6 +1854,15 @@ func (c *container) addBindsMount(system *mount.System) error {
 
 	skipBinds := c.engine.EngineConfig.GetSkipBinds()
 	skipAllBinds := slice.ContainsString(skipBinds, "*")
+	skipHosts := skipAllBinds || slice.ContainsString(skipBinds, hostsPath)
+
+	if len(c.engine.EngineConfig.GetAddHosts()) > 0 && skipHosts {
+		sylog.Warningf("Ignoring --add-host entries as %s mount is disabled", hostsPath)
+	}
+	// containers with a network namespace get a staging hosts file,
+	// completed with their hostname and network address, and with
+	// the other instances on the same network for instances
+	stageHosts := !skipHosts && (len(c.engine.EngineConfig.GetAddHosts()) > 0 || c.netNS)
 
 	if c.engine.EngineConfig.GetContain() {
 		hosts := hostsPath
@@ -1844,15 +1875,17 @@ func (c *container) addBindsMount(system *mount.System) error {
 			sylog.Debugf("Binding /etc/hosts and /etc/localtime only with contain")
 		} else {
 			sylog.Debugf("Skipping bind mounts as contain was requested")
-
+		}
+		if c.netNS || stageHosts {
 			sylog.Verbosef("Binding staging /etc/hosts as contain is set")
-			if err := c.session.AddFile(hostsPath, files.DefaultHosts()); err != nil {
-				return fmt.Errorf("while adding /etc/hosts staging file: %s", err)
+			staged, err := c.stageHostsFile(hostsPath, c.netNS)
+			if err != nil {
+				return err
 			}
-			hosts, _ = c.session.GetPath(hostsPath)
+			hosts = staged
 		}
 
-		if !skipAllBinds && !slice.ContainsString(skipBinds, hostsPath) {
+		if !skipHosts {
 			// #5465 If hosts/localtime mount fails, it should not be fatal so skip-on-error
 			if err := system.Points.AddBind(mount.BindsTag, hosts, hostsPath, flags, "skip-on-error"); err != nil {
 				return fmt.Errorf("unable to add %s to mount list: %s", hosts, err)
@@ -1876,6 +1909,18 @@ func (c *container) addBindsMount(system *mount.System) error {
 		return nil
 	}
 
+	// additional entries and the container address are written in a
+	// staging copy of the host /etc/hosts which replaces the original bind
+	stagedHosts := ""
+	if stageHosts {
+		sylog.Verbosef("Binding staging /etc/hosts with additional entries")
+		staged, err := c.stageHostsFile(hostsPath, false)
+		if err != nil {
+			return err
+		}
+		stagedHosts = staged
+	}
+
 	for _, bindpath := range c.engine.EngineConfig.File.BindPath {
 		splitted := strings.Split(bindpath, ":")
 		src := splitted[0]
@@ -1898,9 +1943,13 @@ func (c *container) addBindsMount(system *mount.System) error {
 				return err
 			}
 		}
+		if src == hostsPath && stagedHosts != "" {
+			src = stagedHosts
+			stagedHosts = ""
+		}
 		// #5465 If hosts/localtime mount fails, it should not be fatal so skip-on-error
 		bindOpt := ""
-		if src == localtimePath || src == hostsPath {
+		if src == localtimePath || src == hostsPath || dst == hostsPath {
 			bindOpt = "skip-on-error"
 		}
 
@@ -1913,6 +1962,139 @@ func (c *container) addBindsMount(system *mount.System) error {
 		}
 	}
 
+	// /etc/hosts is not part of the bind path configuration,
+	// bind the staging file anyway to honor additional entries
+	if stagedHosts != "" {
+		if err := system.Points.AddBind(mount.BindsTag, stagedHosts, hostsPath, flags, "skip-on-error"); err != nil {
+			return fmt.Errorf("unable to add %s to mount list: %s", stagedHosts, err)
+		}
+		if err := system.Points.AddRemount(mount.BindsTag, hostsPath, flags); err != nil {
+			return fmt.Errorf("unable to add %s for remount: %s", hostsPath, err)
+		}
+	}
+
+	return nil
+}
+
+// isInstanceOnNetwork returns true if the container is an instance
+// attached to a CNI network created for it.
+func (c *container) isInstanceOnNetwork() bool {
+	if !c.engine.EngineConfig.GetInstance() || !c.netNS {
+		return false
+	}
+	if net := c.engine.EngineConfig.GetNetwork(); net == "" || net == "none" || net == network.SlirpNetwork {
+		return false
+	}
+	_, joinPath := c.engine.hasNamespace(specs.NetworkNamespace)
+	return joinPath == ""
+}
+
+// stageHostsFile creates the staging hosts file in the session directory
+// and returns its path. The content is the default hosts content when
+// defaultHosts is true or the host hosts file otherwise, followed by the
+// entries requested with --add-host. Entries resolving to the network
+// gateway are added by updateHostsFile once the network is set up.
+func (c *container) stageHostsFile(hostsPath string, defaultHosts bool) (string, error) {
+	content := files.DefaultHosts()
+	if !defaultHosts {
+		b, err := os.ReadFile(hostsPath)
+		if err != nil {
+			sylog.Warningf("Could not read host %s, using default content: %s", hostsPath, err)
+		} else {
+			content = b
+		}
+	}
+
+	for _, entry := range c.engine.EngineConfig.GetAddHosts() {
+		name, ip, err := files.ParseHostEntry(entry)
+		if err != nil {
+			return "", fmt.Errorf("invalid hosts entry: %s", err)
+		}
+		if ip == files.HostGateway {
+			continue
+		}
+		content, err = files.AppendHost(content, name, ip)
+		if err != nil {
+			return "", fmt.Errorf("while adding hosts entry %s: %s", entry, err)
+		}
+	}
+
+	if err := c.session.AddFile(hostsPath, content); err != nil {
+		return "", fmt.Errorf("while adding %s staging file: %s", hostsPath, err)
+	}
+	c.hostsContent = content
+
+	path, _ := c.session.GetPath(hostsPath)
+	return path, nil
+}
+
+// updateHostsFile completes the staging hosts file with the container
+// hostname mapped to its network address and with the --add-host entries
+// resolving to the network gateway.
+func (c *container) updateHostsFile() error {
+	if c.hostsContent == nil {
+		return nil
+	}
+
+	content := c.hostsContent
+	updated := false
+
+	for _, entry := range c.engine.EngineConfig.GetAddHosts() {
+		name, ip, err := files.ParseHostEntry(entry)
+		if err != nil {
+			return fmt.Errorf("invalid hosts entry: %s", err)
+		}
+		if ip != files.HostGateway {
+			continue
+		}
+		if networkSetup == nil {
+			return fmt.Errorf("--add-host %s requires a container network", entry)
+		}
+		n := strings.Split(c.engine.EngineConfig.GetNetwork(), ",")[0]
+		gw, err := networkSetup.GetNetworkGateway(n, "4")
+		if err != nil {
+			gw, err = networkSetup.GetNetworkGateway(n, "6")
+		}
+		if err != nil {
+			return fmt.Errorf("while resolving %s for %s: %s", files.HostGateway, name, err)
+		}
+		content, err = files.AppendHost(content, name, gw.String())
+		if err != nil {
+			return fmt.Errorf("while adding hosts entry %s: %s", entry, err)
+		}
+		updated = true
+	}
+
+	if networkSetup != nil {
+		ip, err := c.engine.getIP()
+		if err == nil && ip != "" {
+			hostname := c.engine.EngineConfig.GetHostname()
+			if hostname == "" {
+				hostname, _ = os.Hostname()
+			}
+			if hostname != "" {
+				if content, err = files.AppendHost(content, hostname, ip); err != nil {
+					sylog.Debugf("Not adding hostname to hosts file: %s", err)
+				} else {
+					updated = true
+				}
+			}
+		}
+	}
+
+	if !updated {
+		return nil
+	}
+
+	path, err := c.session.GetPath("/etc/hosts")
+	if err != nil {
+		return err
+	}
+	// the staging file is bind mounted in the container, rewrite it in place
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return fmt.Errorf("while updating hosts staging file: %s", err)
+	}
+	c.hostsContent = content
 	return nil
 }
 
@@ -2840,6 +3022,11 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 		return nil, nil
 	}
 
+	// The user mode network doesn't rely on CNI and is available to unprivileged users.
+	if net == network.SlirpNetwork {
+		return c.prepareSlirpSetup(pid)
+	}
+
 	// In fakeroot mode only permit the `fakeroot` CNI config, overriding any other request.
 	euid := os.Geteuid()
 	fakeroot := c.engine.EngineConfig.GetFakeroot()
@@ -2948,6 +3135,131 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 	}, nil
 }
 
+// prepareSlirpSetup returns a function connecting the container network
+// namespace to the host network with slirp4netns, which also forwards
+// the ports requested with --publish.
+func (c *container) prepareSlirpSetup(pid int) (func(context.Context) error, error) {
+	if !c.userNS && os.Getuid() != 0 {
+		return nil, fmt.Errorf("network %s requires a user namespace, use --userns or --fakeroot", network.SlirpNetwork)
+	}
+
+	binary, err := bin.FindBin("slirp4netns")
+	if err != nil {
+		return nil, fmt.Errorf("network %s requires slirp4netns: %s", network.SlirpNetwork, err)
+	}
+
+	ports := make([]network.PortMapEntry, 0, len(c.engine.EngineConfig.GetPublishPorts()))
+	for _, p := range c.engine.EngineConfig.GetPublishPorts() {
+		pm, err := network.ParsePortMapping(p)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, pm)
+	}
+
+	cfg := network.SlirpConfig{
+		Binary:    binary,
+		Pid:       pid,
+		UserNS:    c.userNS,
+		APISocket: filepath.Join(c.session.Path(), "slirp4netns.sock"),
+	}
+	// never run the helper with the privileges of a setuid installation
+	if os.Geteuid() != os.Getuid() {
+		cfg.Credential = &syscall.Credential{
+			Uid: uint32(os.Getuid()),
+			Gid: uint32(os.Getgid()),
+		}
+	}
+
+	return func(_ context.Context) error {
+		sylog.Debugf("Starting %s for container network", binary)
+		s, err := network.StartSlirp(cfg)
+		if err != nil {
+			return fmt.Errorf("while setting up user mode network: %s", err)
+		}
+		slirpNetwork = s
+
+		for _, pm := range ports {
+			sylog.Debugf("Forwarding host port %d/%s to container port %d", pm.HostPort, pm.Protocol, pm.ContainerPort)
+			if err := s.AddPortMapping(pm); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// setSysctls sets the namespaced kernel parameters requested for the
+// container, each parameter must belong to a namespace created for the
+// container and non-root users are restricted to the parameters listed
+// in the 'allow sysctls' directive.
+func (c *container) setSysctls(pid int) error {
+	if c.engine.EngineConfig.OciConfig.Linux == nil || len(c.engine.EngineConfig.OciConfig.Linux.Sysctl) == 0 {
+		return nil
+	}
+	sysctls := c.engine.EngineConfig.OciConfig.Linux.Sysctl
+
+	euid := os.Geteuid()
+	nsTypes := make(map[string]struct{})
+
+	for key := range sysctls {
+		ns, err := sysctl.Namespace(key)
+		if err != nil {
+			return err
+		}
+		unshared := false
+		switch ns {
+		case "net":
+			_, joinPath := c.engine.hasNamespace(specs.NetworkNamespace)
+			unshared = c.netNS && joinPath == ""
+		case "ipc":
+			_, joinPath := c.engine.hasNamespace(specs.IPCNamespace)
+			unshared = c.ipcNS && joinPath == ""
+		case "uts":
+			_, joinPath := c.engine.hasNamespace(specs.UTSNamespace)
+			unshared = c.utsNS && joinPath == ""
+		}
+		if !unshared {
+			return fmt.Errorf("sysctl %s requires a new %s namespace", key, ns)
+		}
+		if euid != 0 && !sysctl.Allowed(key, c.engine.EngineConfig.File.AllowSysctls) {
+			return fmt.Errorf("sysctl %s is not permitted for unprivileged users", key)
+		}
+		nsTypes[ns] = struct{}{}
+	}
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		// the thread joins the container namespaces and is never
+		// unlocked, so it is terminated along with this goroutine
+		runtime.LockOSThread()
+
+		if euid != 0 {
+			if _, err := priv.Escalate(); err != nil {
+				errCh <- fmt.Errorf("while escalating privileges: %s", err)
+				return
+			}
+		}
+		for ns := range nsTypes {
+			if err := namespaces.Enter(pid, ns); err != nil {
+				errCh <- fmt.Errorf("while joining container %s namespace: %s", ns, err)
+				return
+			}
+		}
+		for key, value := range sysctls {
+			sylog.Debugf("Setting sysctl %s = %s", key, value)
+			if err := sysctl.Set(key, value); err != nil {
+				errCh <- fmt.Errorf("while setting sysctl %s: %s", key, err)
+				return
+			}
+		}
+		errCh <- nil
+	}()
+
+	return <-errCh
+}
+
 // getFuseFdFromRPC returns fuse file descriptors from RPC server based on
 // the file descriptor list provided in argument, it also returns an
 // additional file descriptor corresponding to /proc/self/ns/user.
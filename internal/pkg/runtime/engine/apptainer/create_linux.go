@@ -66,6 +66,10 @@ func (e *EngineOperations) CreateContainer(ctx context.Context, pid int, rpcConn
 		return nil
 	}
 
+	if e.EngineConfig.GetSeccompRecord() != "" {
+		e.startSeccompRecord()
+	}
+
 	rpcOps := &client.RPC{
 		Client: rpc.NewClient(rpcConn),
 		Name:   e.CommonConfig.EngineName,
@@ -87,5 +91,13 @@ func (e *EngineOperations) CreateContainer(ctx context.Context, pid int, rpcConn
 		return err
 	}
 
+	// the container process is released once the container is created,
+	// the start event is written before so that a failure stops it
+	if len(e.EngineConfig.GetAuditEvent()) > 0 {
+		if err := e.writeAuditStart(pid); err != nil {
+			return fmt.Errorf("while writing audit start event: %s", err)
+		}
+	}
+
 	return nil
 }
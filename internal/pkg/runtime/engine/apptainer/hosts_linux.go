@@ -0,0 +1,121 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/apptainer/apptainer/internal/pkg/instance"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs/files"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// hostsFile describes the staging hosts file of an instance attached
+// to a CNI network.
+type hostsFile struct {
+	// path is the staging hosts file path in the session directory.
+	path string
+	// content is the hosts content set up at container creation.
+	content []byte
+}
+
+// sync rewrites the hosts file with an entry for each instance attached
+// to the same network as the instance described by file, so instances are
+// able to resolve each other by name. The hosts file is updated whenever an
+// instance starts or stops, as notified by changes of the instance files.
+// Only the instances of the same user are listed, as the instance files of
+// other users are not visible. It runs in the instance master process until
+// it exits.
+func (h *hostsFile) sync(file *instance.File) {
+	// the directory holding the instance directories of the user
+	dir := filepath.Dir(filepath.Dir(file.Path))
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		sylog.Debugf("Could not watch instances for hosts file: %s", err)
+		return
+	}
+	defer unix.Close(fd)
+
+	// instance directories are created and removed as instances start and
+	// stop, and instance files are written once their network is set up
+	if _, err := unix.InotifyAddWatch(fd, dir, unix.IN_CREATE|unix.IN_DELETE|unix.IN_MOVED_TO); err != nil {
+		sylog.Debugf("Could not watch instances for hosts file: %s", err)
+		return
+	}
+
+	current := h.content
+	buf := make([]byte, 4096)
+	for {
+		// watch new instance directories before listing instances, to
+		// not miss their updates, watches of removed ones are dropped
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			sylog.Debugf("Could not list instance directories for hosts file: %s", err)
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+			if _, err := unix.InotifyAddWatch(fd, filepath.Join(dir, e.Name()), unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO); err != nil {
+				sylog.Debugf("Could not watch instance %s for hosts file: %s", e.Name(), err)
+			}
+		}
+
+		content, err := h.generate(file)
+		if err != nil {
+			sylog.Debugf("Could not list instances for hosts file: %s", err)
+		} else if !bytes.Equal(content, current) {
+			// the staging file is bind mounted in the container, rewrite it in place
+			if err := os.WriteFile(h.path, content, 0o644); err != nil {
+				sylog.Debugf("Could not update instance hosts file: %s", err)
+			} else {
+				current = content
+			}
+		}
+
+		// wait for instances to start or stop, the events read at once
+		// are handled by a single update
+		if _, err := unix.Read(fd, buf); err != nil && err != unix.EINTR {
+			sylog.Debugf("Could not watch instances for hosts file: %s", err)
+			return
+		}
+	}
+}
+
+// generate returns the hosts content with the entries of the instances
+// attached to the same network as the instance described by file,
+// including this instance.
+func (h *hostsFile) generate(file *instance.File) ([]byte, error) {
+	list, err := instance.List("", "*", instance.AppSubDir, false)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	content := append([]byte(nil), h.content...)
+	for _, peer := range list {
+		if peer.IP == "" || peer.Network != file.Network {
+			continue
+		}
+		c, err := files.AppendHost(content, peer.Name, peer.IP)
+		if err != nil {
+			sylog.Debugf("Skipping instance %s in hosts file: %s", peer.Name, err)
+			continue
+		}
+		content = c
+	}
+	return content, nil
+}
@@ -29,8 +29,10 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/image/driver"
 	"github.com/apptainer/apptainer/internal/pkg/instance"
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
+	"github.com/apptainer/apptainer/internal/pkg/policy"
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/starter"
 	"github.com/apptainer/apptainer/internal/pkg/security"
+	"github.com/apptainer/apptainer/internal/pkg/security/profile"
 	"github.com/apptainer/apptainer/internal/pkg/security/seccomp"
 	"github.com/apptainer/apptainer/internal/pkg/syecl"
 	"github.com/apptainer/apptainer/internal/pkg/sypgp"
@@ -55,6 +57,9 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+// profileImage is the root filesystem image opened by loadSecurityProfile.
+var profileImage *image.Image
+
 var nsProcName = map[specs.LinuxNamespaceType]string{
 	specs.PIDNamespace:     "pid",
 	specs.UTSNamespace:     "uts",
@@ -102,6 +107,10 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		if !fs.IsOwner(buildcfg.ECL_FILE, 0) {
 			return fmt.Errorf("%s must be owned by root", buildcfg.ECL_FILE)
 		}
+		// check for ownership of the policy file
+		if policyFile := e.EngineConfig.File.PolicyFile; policyFile != "" && !fs.IsOwner(policyFile, 0) {
+			return fmt.Errorf("%s must be owned by root", policyFile)
+		}
 		if fakerootPath := e.EngineConfig.GetFakerootPath(); fakerootPath != "" {
 			// look for fakeroot again because the PATH used is
 			//  more restricted at this point than it was earlier
@@ -163,7 +172,7 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 			return err
 		}
 
-		if err := e.prepareContainerConfig(starterConfig); err != nil {
+		if err := e.prepareContainerConfig(starterConfig, userNS, elevated); err != nil {
 			return err
 		}
 		if err := e.loadImages(starterConfig, userNS, elevated); err != nil {
@@ -171,6 +180,11 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		}
 	}
 
+	// Landlock rules can only be enforced with no_new_privs
+	if len(e.EngineConfig.File.LandlockRules) > 0 || len(e.EngineConfig.GetLandlockRules()) > 0 {
+		e.EngineConfig.OciConfig.SetProcessNoNewPrivileges(true)
+	}
+
 	starterConfig.SetMasterPropagateMount(true)
 	starterConfig.SetNoNewPrivs(e.EngineConfig.OciConfig.Process.NoNewPrivileges)
 
@@ -653,7 +667,7 @@ func (e *EngineOperations) joinNetns(starterConfig *starter.Config) error {
 
 // prepareContainerConfig is responsible for getting and applying
 // user supplied configuration for container creation.
-func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config) error {
+func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config, userNS bool, elevated bool) error {
 	// always set mount namespace
 	e.EngineConfig.OciConfig.AddOrReplaceLinuxNamespace(specs.MountNamespace, "")
 
@@ -688,6 +702,16 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 		return err
 	}
 
+	// apply the image security profile before checking capabilities
+	imageProfile, err := e.loadSecurityProfile(userNS, elevated)
+	if err != nil {
+		return fmt.Errorf("while loading image security profile: %s", err)
+	}
+	if imageProfile != nil {
+		sylog.Verbosef("Applying security profile of image %s", e.EngineConfig.GetImage())
+		e.applySecurityProfile(imageProfile)
+	}
+
 	if os.Getuid() == 0 {
 		if err := e.prepareRootCaps(); err != nil {
 			return err
@@ -801,18 +825,59 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 		e.EngineConfig.OciConfig.SetProcessApparmorProfile(param)
 	}
 	param = security.GetParam(e.EngineConfig.GetSecurity(), "seccomp")
+	seccompProfile := param != ""
 	if param != "" {
 		sylog.Debugf("Applying seccomp rule from %s", param)
 		generator := &e.EngineConfig.OciConfig.Generator
 		if err := seccomp.LoadProfileFromFile(param, generator); err != nil {
 			return err
 		}
+	} else if imageProfile != nil && len(imageProfile.Seccomp) > 0 {
+		sylog.Debugf("Applying seccomp rule from image security profile")
+		generator := &e.EngineConfig.OciConfig.Generator
+		if err := seccomp.LoadProfile(imageProfile.Seccomp, generator); err != nil {
+			return fmt.Errorf("while loading image seccomp profile: %s", err)
+		}
+		seccompProfile = true
+	}
+
+	if err := e.prepareSeccompRecord(starterConfig, seccompProfile); err != nil {
+		return err
 	}
 
 	// open file descriptors (autofs bug path)
 	return e.prepareAutofs(starterConfig)
 }
 
+// prepareSeccompRecord creates the socketpair used by the container process
+// to pass the seccomp notification file descriptor of the record filter to
+// master, which records the system calls.
+func (e *EngineOperations) prepareSeccompRecord(starterConfig *starter.Config, hasProfile bool) error {
+	if e.EngineConfig.GetSeccompRecord() == "" {
+		e.EngineConfig.SetSeccompRecordPair([2]int{-1, -1})
+		return nil
+	}
+	if !seccomp.Enabled() {
+		return fmt.Errorf("--seccomp-record requested but seccomp is not enabled, seccomp library is missing or too old")
+	}
+	if hasProfile {
+		return fmt.Errorf("--seccomp-record can't be used with a seccomp profile")
+	}
+	if e.EngineConfig.GetInstance() {
+		return fmt.Errorf("--seccomp-record is not supported with instances")
+	}
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to create socketpair to pass seccomp notification file descriptor: %s", err)
+	}
+	e.EngineConfig.SetSeccompRecordPair(fds)
+	if err := starterConfig.KeepFileDescriptor(fds[0]); err != nil {
+		return err
+	}
+	return starterConfig.KeepFileDescriptor(fds[1])
+}
+
 // prepareInstanceJoinConfig is responsible for getting and
 // applying configuration to join a running instance.
 //
@@ -1258,14 +1323,81 @@ func (e *EngineOperations) setSessionLayer(img *image.Image) error {
 	return nil
 }
 
+// checkPolicy evaluates the policy file rules for the root filesystem
+// image and the requested container configuration.
+func (e *EngineOperations) checkPolicy(img *image.Image) error {
+	p, err := policy.Load(e.EngineConfig.File.PolicyFile)
+	if err != nil {
+		return err
+	}
+	gids, err := os.Getgroups()
+	if err != nil {
+		return fmt.Errorf("while getting user groups: %s", err)
+	}
+	in, err := p.NewInput(img, e.EngineConfig, os.Getuid(), gids)
+	if err != nil {
+		return fmt.Errorf("while gathering policy input: %s", err)
+	}
+	return p.Evaluate(in)
+}
+
+// loadSecurityProfile returns the security profile declared by the SIF root
+// filesystem image if it is signed by a key trusted for profiles, or nil.
+// The image is only opened when keys are trusted for profiles, and kept
+// in profileImage so that the profile comes from the mounted image.
+func (e *EngineOperations) loadSecurityProfile(userNS bool, elevated bool) (*profile.Profile, error) {
+	keys := e.EngineConfig.File.SecurityProfileKeys
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	img, err := e.loadImage(e.EngineConfig.GetImage(), e.EngineConfig.GetWritableImage(), userNS, elevated)
+	if err != nil {
+		return nil, err
+	}
+	profileImage = img
+
+	if img.Type != image.SIF {
+		return nil, nil
+	}
+
+	keyring := sypgp.NewHandle(buildcfg.APPTAINER_CONFDIR, sypgp.GlobalHandleOpt())
+	kr, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return nil, fmt.Errorf("while obtaining global keyring: %s", err)
+	}
+	return profile.Load(img.File, kr, keys)
+}
+
+// applySecurityProfile adds the capabilities and the AppArmor profile of
+// the image security profile to the requested ones. Options given with
+// --security take precedence.
+func (e *EngineOperations) applySecurityProfile(p *profile.Profile) {
+	if len(p.Capabilities) > 0 {
+		sylog.Debugf("Adding capabilities %s from image security profile", strings.Join(p.Capabilities, ","))
+		caps := p.Capabilities
+		if c := e.EngineConfig.GetAddCaps(); c != "" {
+			caps = append([]string{c}, caps...)
+		}
+		e.EngineConfig.SetAddCaps(strings.Join(caps, ","))
+	}
+	if p.AppArmor != "" && security.GetParam(e.EngineConfig.GetSecurity(), "apparmor") == "" {
+		e.EngineConfig.SetSecurity(append(e.EngineConfig.GetSecurity(), "apparmor:"+p.AppArmor))
+	}
+}
+
 func (e *EngineOperations) loadImages(starterConfig *starter.Config, userNS bool, elevated bool) error {
 	images := make([]image.Image, 0)
 
-	// load rootfs image
+	// load rootfs image, unless already opened for its security profile
 	writable := e.EngineConfig.GetWritableImage()
-	img, err := e.loadImage(e.EngineConfig.GetImage(), writable, userNS, elevated)
-	if err != nil {
-		return err
+	img := profileImage
+	if img == nil {
+		var err error
+		img, err = e.loadImage(e.EngineConfig.GetImage(), writable, userNS, elevated)
+		if err != nil {
+			return err
+		}
 	}
 
 	rootFs, err := img.GetRootFsPartition()
@@ -1277,6 +1409,20 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config, userNS bool
 		return fmt.Errorf("could not use %s for writing, you don't have write permissions", img.Path)
 	}
 
+	// the policy can be bypassed without the setuid workflow, the launcher
+	// already evaluated it
+	if starterConfig.GetIsSUID() && e.EngineConfig.File.PolicyFile != "" {
+		if err := e.checkPolicy(img); err != nil {
+			return err
+		}
+	}
+
+	if e.auditEnabled() {
+		if err := e.prepareAuditEvent(img); err != nil {
+			return err
+		}
+	}
+
 	if err := e.setSessionLayer(img); err != nil {
 		return err
 	}
@@ -1339,6 +1485,13 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config, userNS bool
 			if err = ecl.ValidateConfig(); err != nil {
 				return fmt.Errorf("while validating ECL configuration: %s", err)
 			}
+			if starterConfig.GetIsSUID() {
+				for _, f := range ecl.Files() {
+					if !fs.IsOwner(f, 0) {
+						return fmt.Errorf("ECL key material file %s must be owned by root", f)
+					}
+				}
+			}
 
 			// Only try to load the global keyring here if the ECL is active.
 			// Otherwise pass through an empty keyring rather than avoiding calling
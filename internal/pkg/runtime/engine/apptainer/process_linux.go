@@ -35,6 +35,7 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/instance"
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
 	"github.com/apptainer/apptainer/internal/pkg/security"
+	"github.com/apptainer/apptainer/internal/pkg/security/landlock"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs/files"
 	"github.com/apptainer/apptainer/internal/pkg/util/machine"
@@ -172,9 +173,18 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 		}
 	}
 
+	if err := e.applyLandlock(); err != nil {
+		return err
+	}
+
 	if err := security.Configure(&e.EngineConfig.OciConfig.Spec); err != nil {
 		return fmt.Errorf("failed to apply security configuration: %s", err)
 	}
+	if e.EngineConfig.GetSeccompRecord() != "" {
+		if err := e.loadSeccompRecordFilter(); err != nil {
+			return err
+		}
+	}
 
 	// If necessary, set the umask that was saved from the calling environment
 	// https://github.com/apptainer/singularity/issues/5214
@@ -333,6 +343,38 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 	}
 }
 
+// applyLandlock confines the filesystem accesses of the container process
+// with the Landlock rules set by the administrator, then with those requested
+// by the user, each set stacking a new ruleset. When the kernel doesn't support
+// Landlock the rules are not enforced.
+func (e *EngineOperations) applyLandlock() error {
+	ruleSets := []struct {
+		origin string
+		rules  []string
+	}{
+		{"apptainer.conf", e.EngineConfig.File.LandlockRules},
+		{"--landlock", e.EngineConfig.GetLandlockRules()},
+	}
+
+	for _, set := range ruleSets {
+		if len(set.rules) == 0 {
+			continue
+		}
+		rules, err := landlock.ParseRules(set.rules)
+		if err != nil {
+			return fmt.Errorf("while parsing %s landlock rules: %s", set.origin, err)
+		}
+		if err := landlock.Restrict(rules); errors.Is(err, landlock.ErrNotSupported) {
+			sylog.Debugf("Landlock is not supported by the kernel, %s rules are not enforced", set.origin)
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("while applying %s landlock rules: %s", set.origin, err)
+		}
+		sylog.Debugf("Landlock ABI %d enforcing %s rules: %s", landlock.ABI(), set.origin, strings.Join(set.rules, ", "))
+	}
+	return nil
+}
+
 // PostStartProcess is called from master after successful
 // execution of the container process. It will write instance
 // state/config files (if any).
@@ -397,6 +439,9 @@ func (e *EngineOperations) PostStartProcess(_ context.Context, pid int) error {
 			sylog.Warningf("Could not get ip for %s: %s", pw.Name, err)
 		}
 		file.IP = ip
+		if ip != "" {
+			file.Network = strings.Split(e.EngineConfig.GetNetwork(), ",")[0]
+		}
 
 		// by default we add all namespaces except the user namespace which
 		// is added conditionally. This delegates checks to the C starter code
@@ -444,6 +489,13 @@ func (e *EngineOperations) PostStartProcess(_ context.Context, pid int) error {
 			return err
 		}
 
+		// keep the hosts file up to date with the other instances
+		// attached to the same network, instances without a network
+		// address have nothing to watch
+		if file.IP != "" && instanceHosts != nil {
+			go instanceHosts.sync(file)
+		}
+
 		if !e.EngineConfig.GetShareNSMode() {
 			// send SIGUSR1 to the parent process in order to tell it
 			// to detach container process and run as instance.
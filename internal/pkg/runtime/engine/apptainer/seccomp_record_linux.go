@@ -0,0 +1,124 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package apptainer
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/security/seccomp"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// seccompRecordTimeout is the time to wait for the recorder to stop once
+// the container process exited, processes left in background may still
+// use the record filter.
+const seccompRecordTimeout = 2 * time.Second
+
+// seccompRecorder records the system calls of the container processes
+// in master.
+type seccompRecorder struct {
+	recorder *seccomp.Recorder
+	done     chan struct{}
+}
+
+// loadSeccompRecordFilter is called from the container process to load
+// the seccomp record filter and pass its notification file descriptor
+// to master. Once loaded, every system call not part of the baseline
+// blocks until master lets it continue.
+func (e *EngineOperations) loadSeccompRecordFilter() error {
+	// the filter only applies to the calling thread, keep it dedicated
+	// to this goroutine so other goroutines don't run under the filter
+	// before master receives the notification file descriptor
+	runtime.LockOSThread()
+
+	fds := e.EngineConfig.GetSeccompRecordPair()
+	unix.Close(fds[0])
+
+	fd, err := seccomp.LoadRecordFilter(e.EngineConfig.OciConfig.Process.NoNewPrivileges, fds[1])
+	if err != nil {
+		unix.Close(fds[1])
+		return fmt.Errorf("while loading seccomp record filter: %s", err)
+	}
+
+	err = unix.Sendmsg(fds[1], []byte{'s'}, unix.UnixRights(fd), nil, 0)
+	// the close calls below are recorded, so they return once master
+	// received the notification file descriptor
+	unix.Close(fd)
+	unix.Close(fds[1])
+	if err != nil {
+		return fmt.Errorf("while sending seccomp notification file descriptor: %s", err)
+	}
+	return nil
+}
+
+// startSeccompRecord is called from master to receive the notification
+// file descriptor of the record filter and record the system calls in
+// background until the container processes exit.
+func (e *EngineOperations) startSeccompRecord() {
+	fds := e.EngineConfig.GetSeccompRecordPair()
+	unix.Close(fds[1])
+
+	seccompRecord = &seccompRecorder{
+		recorder: seccomp.NewRecorder(),
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(seccompRecord.done)
+		defer unix.Close(fds[0])
+
+		buf := make([]byte, unix.CmsgSpace(4))
+		_, oobn, _, _, err := unix.Recvmsg(fds[0], make([]byte, 1), buf, 0)
+		if err != nil {
+			sylog.Errorf("While receiving seccomp notification file descriptor: %s", err)
+			return
+		} else if oobn == 0 {
+			// container process failed before loading the filter
+			sylog.Debugf("No seccomp notification file descriptor received")
+			return
+		}
+		msgs, err := unix.ParseSocketControlMessage(buf[:oobn])
+		if err != nil || len(msgs) == 0 {
+			sylog.Errorf("While parsing socket control message: %v", err)
+			return
+		}
+		nfds, err := unix.ParseUnixRights(&msgs[0])
+		if err != nil || len(nfds) != 1 {
+			sylog.Errorf("While getting seccomp notification file descriptor: %v", err)
+			return
+		}
+		defer unix.Close(nfds[0])
+
+		sylog.Debugf("Recording container system calls")
+		if err := seccomp.RecordNotifications(nfds[0], seccompRecord.recorder); err != nil {
+			sylog.Errorf("Seccomp record stopped: %s", err)
+		}
+	}()
+}
+
+// writeSeccompRecord is called from master after the container process
+// exited to write the seccomp profile generated from the recorded system
+// calls.
+func (e *EngineOperations) writeSeccompRecord() {
+	select {
+	case <-seccompRecord.done:
+	case <-time.After(seccompRecordTimeout):
+		sylog.Warningf("Container processes are still running, seccomp profile may be incomplete")
+	}
+
+	path := e.EngineConfig.GetSeccompRecord()
+	if err := seccompRecord.recorder.WriteProfile(path); err != nil {
+		sylog.Errorf("Could not write recorded seccomp profile: %s", err)
+		return
+	}
+	sylog.Infof("Seccomp profile written to %s", path)
+}
@@ -221,6 +221,15 @@ func (g *Generator) AddLinuxGIDMapping(host, container, size uint32) {
 	g.Config.Linux.GIDMappings = append(g.Config.Linux.GIDMappings, idMapping)
 }
 
+// AddLinuxSysctl adds or replaces a container sysctl parameter.
+func (g *Generator) AddLinuxSysctl(key, value string) {
+	g.initLinux()
+	if g.Config.Linux.Sysctl == nil {
+		g.Config.Linux.Sysctl = make(map[string]string)
+	}
+	g.Config.Linux.Sysctl[key] = value
+}
+
 // AddProcessRlimits adds a container process rlimit.
 func (g *Generator) AddProcessRlimits(rType string, rHard uint64, rSoft uint64) {
 	g.initProcess()
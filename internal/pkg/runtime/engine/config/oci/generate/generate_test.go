@@ -178,6 +178,15 @@ func TestGenerate(t *testing.T) {
 	if rlimit.Type != "A_SEC_LIMIT" || rlimit.Hard != 2048 || rlimit.Soft != 1024 {
 		t.Fatalf("wrong OCI process rlimit entry: %v", rlimit)
 	}
+
+	g.AddLinuxSysctl("net.core.somaxconn", "1024")
+	g.AddLinuxSysctl("net.core.somaxconn", "2048")
+	if len(config.Linux.Sysctl) != 1 {
+		t.Fatalf("wrong OCI linux sysctl size: %d instead of 1", len(config.Linux.Sysctl))
+	}
+	if v := config.Linux.Sysctl["net.core.somaxconn"]; v != "2048" {
+		t.Fatalf("wrong OCI linux sysctl value: %s instead of 2048", v)
+	}
 }
 
 var ociJSON = `{
@@ -29,18 +29,22 @@ import (
 	"github.com/apptainer/apptainer/internal/pkg/image/unpacker"
 	"github.com/apptainer/apptainer/internal/pkg/instance"
 	"github.com/apptainer/apptainer/internal/pkg/plugin"
+	"github.com/apptainer/apptainer/internal/pkg/policy"
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/oci"
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/oci/generate"
 	"github.com/apptainer/apptainer/internal/pkg/security"
+	"github.com/apptainer/apptainer/internal/pkg/security/landlock"
 	"github.com/apptainer/apptainer/internal/pkg/util/bin"
 	"github.com/apptainer/apptainer/internal/pkg/util/env"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs"
+	"github.com/apptainer/apptainer/internal/pkg/util/fs/files"
 	"github.com/apptainer/apptainer/internal/pkg/util/fs/squashfs"
 	"github.com/apptainer/apptainer/internal/pkg/util/gpu"
 	"github.com/apptainer/apptainer/internal/pkg/util/starter"
 	"github.com/apptainer/apptainer/internal/pkg/util/user"
 	"github.com/apptainer/apptainer/pkg/build/types"
 	imgutil "github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/network"
 	clicallback "github.com/apptainer/apptainer/pkg/plugin/callback/cli"
 	apptainercallback "github.com/apptainer/apptainer/pkg/plugin/callback/runtime/engine/apptainer"
 	apptainerConfig "github.com/apptainer/apptainer/pkg/runtime/engine/apptainer/config"
@@ -53,6 +57,7 @@ import (
 	"github.com/apptainer/apptainer/pkg/util/fs/proc"
 	"github.com/apptainer/apptainer/pkg/util/namespaces"
 	"github.com/apptainer/apptainer/pkg/util/rlimit"
+	"github.com/apptainer/apptainer/pkg/util/sysctl"
 	"github.com/ccoveille/go-safecast/v2"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
@@ -274,6 +279,11 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 	// Container networking configuration.
 	l.engineConfig.SetNetwork(l.cfg.Network)
 	l.engineConfig.SetDNS(l.cfg.DNS)
+	// resolvers listening on the host loopback are not reachable from the
+	// user mode network, use the slirp4netns DNS forwarder by default
+	if l.cfg.Network == network.SlirpNetwork && l.cfg.DNS == "" {
+		l.engineConfig.SetDNS(network.SlirpDNS)
+	}
 	l.engineConfig.SetNetworkArgs(l.cfg.NetworkArgs)
 
 	// If user wants to set a hostname, it requires the UTS namespace.
@@ -315,6 +325,26 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 	// Set engine --security options (selinux, apparmor, seccomp functionality).
 	l.engineConfig.SetSecurity(l.cfg.SecurityOpts)
 
+	// Confine the container filesystem accesses with Landlock.
+	if err := l.setLandlockRules(); err != nil {
+		return fmt.Errorf("while setting landlock rules: %s", err)
+	}
+
+	// Record the system calls made in the container into a seccomp profile.
+	if l.cfg.SeccompRecord != "" {
+		if instanceName != "" || l.engineConfig.GetInstanceJoin() {
+			return fmt.Errorf("--seccomp-record is not supported with instances")
+		}
+		if security.GetParam(l.cfg.SecurityOpts, "seccomp") != "" {
+			return fmt.Errorf("--seccomp-record can't be used with --security seccomp")
+		}
+		path, err := filepath.Abs(l.cfg.SeccompRecord)
+		if err != nil {
+			return fmt.Errorf("while resolving --seccomp-record path: %s", err)
+		}
+		l.engineConfig.SetSeccompRecord(path)
+	}
+
 	// User can override shell used when entering container.
 	l.engineConfig.SetShell(l.cfg.ShellPath)
 	if l.cfg.ShellPath != "" {
@@ -393,6 +423,18 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 
 	// Set the required namespaces in the engine config.
 	l.setNamespaces()
+	// Set the requested kernel parameters, they depend on namespaces.
+	if err := l.setSysctls(); err != nil {
+		return fmt.Errorf("while setting kernel parameters: %s", err)
+	}
+	// Set the forwarded ports, they depend on the network.
+	if err := l.setPublishPorts(); err != nil {
+		return fmt.Errorf("while setting published ports: %s", err)
+	}
+	// Set the extra hosts entries, host-gateway depends on network namespace.
+	if err := l.setAddHosts(); err != nil {
+		return fmt.Errorf("while setting hosts entries: %s", err)
+	}
 	// Set the container environment.
 	if err := l.setEnvVars(ctx, args); err != nil {
 		return fmt.Errorf("while setting environment: %s", err)
@@ -406,6 +448,13 @@ func (l *Launcher) Exec(ctx context.Context, image string, args []string, instan
 		l.generator.SetProcessEnvWithPrefixes(env.ApptainerPrefixes, "SHARENS_MASTER", "1")
 	}
 
+	// Evaluate the admission policy, the setuid engine evaluates it itself.
+	if !useSuid && !l.engineConfig.GetInstanceJoin() && l.engineConfig.File.PolicyFile != "" {
+		if err := l.checkPolicy(); err != nil {
+			return err
+		}
+	}
+
 	// Get image ready to run, if needed, via FUSE mount / extraction / image driver handling.
 	if err := l.prepareImage(ctx, insideUserNs, image); err != nil {
 		return fmt.Errorf("while preparing image: %s", err)
@@ -640,6 +689,13 @@ func (l *Launcher) useSuid(insideUserNs bool) (useSuid bool) {
 		}
 	}
 
+	// user mode network needs a network namespace owned by
+	// a user namespace to be joined by an unprivileged helper
+	if l.cfg.Network == network.SlirpNetwork && !l.cfg.Namespaces.User && l.uid != 0 {
+		sylog.Verbosef("Network %s requires a user namespace, using user namespace", network.SlirpNetwork)
+		l.cfg.Namespaces.User = true
+	}
+
 	// use non privileged starter binary:
 	// - if running as root
 	// - if already running inside a user namespace
@@ -986,6 +1042,10 @@ func (l *Launcher) setNamespaces() {
 		sylog.Infof("Setting --net (required by --network-args)")
 		l.cfg.Namespaces.Net = true
 	}
+	if !l.cfg.Namespaces.Net && len(l.cfg.PublishPorts) != 0 {
+		sylog.Infof("Setting --net (required by --publish)")
+		l.cfg.Namespaces.Net = true
+	}
 	if l.cfg.Namespaces.Net {
 		if l.cfg.Network == "" {
 			l.cfg.Network = "bridge"
@@ -997,7 +1057,7 @@ func (l *Launcher) setNamespaces() {
 		// unprivileged installation could not use fakeroot
 		// network because it requires a setuid installation
 		// so we fallback to none
-		if l.cfg.Fakeroot && l.cfg.Network != "none" {
+		if l.cfg.Fakeroot && l.cfg.Network != "none" && l.cfg.Network != network.SlirpNetwork {
 			// unprivileged installation could not use fakeroot
 			// network because it requires a setuid installation
 			// so we fallback to none
@@ -1043,6 +1103,138 @@ func (l *Launcher) setNamespaces() {
 	}
 }
 
+// setSysctls adds the kernel parameters requested with --sysctl to the
+// container configuration. Only parameters of a namespace created for the
+// container are accepted, the administrator allow list is enforced by the
+// runtime.
+func (l *Launcher) setSysctls() error {
+	for _, s := range l.cfg.Sysctls {
+		key, value, ok := strings.Cut(s, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("invalid --sysctl %q, must be in key=value format", s)
+		}
+		ns, err := sysctl.Namespace(key)
+		if err != nil {
+			return err
+		}
+		unshared := false
+		switch ns {
+		case "net":
+			unshared = l.cfg.Namespaces.Net
+		case "ipc":
+			unshared = l.cfg.Namespaces.IPC
+		case "uts":
+			unshared = l.cfg.Namespaces.UTS
+		}
+		if !unshared {
+			return fmt.Errorf("sysctl %s requires a new %s namespace", key, ns)
+		}
+		l.generator.AddLinuxSysctl(key, value)
+	}
+	return nil
+}
+
+// setPublishPorts checks the ports requested with --publish. They are
+// forwarded by slirp4netns for the user mode network, or passed as
+// portmap arguments to the first CNI network.
+func (l *Launcher) setPublishPorts() error {
+	if len(l.cfg.PublishPorts) == 0 {
+		return nil
+	}
+	net := l.engineConfig.GetNetwork()
+	if net == "none" {
+		return fmt.Errorf("--publish can't be used with --network=none")
+	}
+
+	ports := make([]string, 0, len(l.cfg.PublishPorts))
+	for _, p := range l.cfg.PublishPorts {
+		if !strings.Contains(p, "/") {
+			p += "/tcp"
+		}
+		if _, err := network.ParsePortMapping(p); err != nil {
+			return fmt.Errorf("invalid --publish %q: %s", p, err)
+		}
+		ports = append(ports, p)
+	}
+
+	if net == network.SlirpNetwork {
+		l.engineConfig.SetPublishPorts(ports)
+		return nil
+	}
+	args := l.engineConfig.GetNetworkArgs()
+	for _, p := range ports {
+		args = append(args, "portmap="+p)
+	}
+	l.engineConfig.SetNetworkArgs(args)
+	return nil
+}
+
+// setAddHosts checks the name:ip entries requested with --add-host and
+// passes them to the engine, which writes them into the container hosts file.
+func (l *Launcher) setAddHosts() error {
+	for _, entry := range l.cfg.AddHosts {
+		_, ip, err := files.ParseHostEntry(entry)
+		if err != nil {
+			return fmt.Errorf("invalid --add-host: %s", err)
+		}
+		if ip == files.HostGateway && !l.cfg.Namespaces.Net {
+			return fmt.Errorf("--add-host with %s requires --net", files.HostGateway)
+		}
+	}
+	l.engineConfig.SetAddHosts(l.cfg.AddHosts)
+	return nil
+}
+
+// setLandlockRules checks the rules requested with --landlock, rules of
+// profile files are read from the host and expanded.
+func (l *Launcher) setLandlockRules() error {
+	var rules []string
+	for _, entry := range l.cfg.LandlockRules {
+		if path, ok := strings.CutPrefix(entry, landlock.ProfilePrefix); ok {
+			profile, err := landlock.LoadProfile(path)
+			if err != nil {
+				return err
+			}
+			for _, r := range profile {
+				rules = append(rules, r.String())
+			}
+			continue
+		}
+		r, err := landlock.ParseRule(entry)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, r.String())
+	}
+	l.engineConfig.SetLandlockRules(rules)
+	return nil
+}
+
+// checkPolicy evaluates the policy file rules for the image and the
+// requested container configuration.
+func (l *Launcher) checkPolicy() error {
+	p, err := policy.Load(l.engineConfig.File.PolicyFile)
+	if err != nil {
+		return err
+	}
+	img, err := imgutil.Init(l.engineConfig.GetImage(), false)
+	if err != nil {
+		return fmt.Errorf("while opening image for policy evaluation: %s", err)
+	}
+	defer img.File.Close()
+
+	gids, err := os.Getgroups()
+	if err != nil {
+		return fmt.Errorf("while getting user groups: %s", err)
+	}
+	in, err := p.NewInput(img, l.engineConfig, int(l.uid), gids)
+	if err != nil {
+		return fmt.Errorf("while gathering policy input: %s", err)
+	}
+	return p.Evaluate(in)
+}
+
 // setEnvVars sets the environment for the container, from the host environment, glads, env-file.
 func (l *Launcher) setEnvVars(ctx context.Context, args []string) error {
 	if len(l.cfg.EnvFiles) > 0 {
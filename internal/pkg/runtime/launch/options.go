@@ -97,6 +97,12 @@ type launchOptions struct {
 	Hostname string
 	// DNS is the comma separated list of DNS servers to be set in the container's resolv.conf.
 	DNS string
+	// PublishPorts lists hostPort[:containerPort][/protocol] ports to forward from the host to the container.
+	PublishPorts []string
+	// AddHosts lists name:ip entries to be added to the container's hosts file.
+	AddHosts []string
+	// Sysctls lists key=value namespaced kernel parameters to set in the container.
+	Sysctls []string
 
 	// AddCaps is the list of capabilities to Add to the container process.
 	AddCaps string
@@ -110,6 +116,10 @@ type launchOptions struct {
 	NoPrivs bool
 	// SecurityOpts is the list of security options (selinux, apparmor, seccomp) to apply.
 	SecurityOpts []string
+	// LandlockRules lists ro:<path> and rw:<path> Landlock rules, or profile:<file> entries containing rules.
+	LandlockRules []string
+	// SeccompRecord is the path of a seccomp profile generated from the system calls made in the container.
+	SeccompRecord string
 	// NoUmask disables propagation of the host umask into the container, using a default 0022.
 	NoUmask bool
 
@@ -382,6 +392,30 @@ func OptDNS(d string) Option {
 	}
 }
 
+// OptPublishPorts sets host ports to forward to the container network.
+func OptPublishPorts(p []string) Option {
+	return func(lo *launchOptions) error {
+		lo.PublishPorts = p
+		return nil
+	}
+}
+
+// OptAddHosts sets name:ip entries to add in the container hosts file.
+func OptAddHosts(h []string) Option {
+	return func(lo *launchOptions) error {
+		lo.AddHosts = h
+		return nil
+	}
+}
+
+// OptSysctls sets namespaced kernel parameters, in key=value format, for the container.
+func OptSysctls(s []string) Option {
+	return func(lo *launchOptions) error {
+		lo.Sysctls = s
+		return nil
+	}
+}
+
 // OptCaps sets capabilities to add and drop.
 func OptCaps(add, drop string) Option {
 	return func(lo *launchOptions) error {
@@ -423,6 +457,22 @@ func OptSecurity(s []string) Option {
 	}
 }
 
+// OptLandlockRules sets Landlock rules confining the filesystem accesses of the container.
+func OptLandlockRules(rules []string) Option {
+	return func(lo *launchOptions) error {
+		lo.LandlockRules = rules
+		return nil
+	}
+}
+
+// OptSeccompRecord sets the path of a seccomp profile generated from the system calls made in the container.
+func OptSeccompRecord(path string) Option {
+	return func(lo *launchOptions) error {
+		lo.SeccompRecord = path
+		return nil
+	}
+}
+
 // OptNoUmask disables propagation of the host umask into the container, using a default 0022.
 func OptNoUmask(b bool) Option {
 	return func(lo *launchOptions) error {
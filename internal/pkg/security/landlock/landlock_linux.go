@@ -0,0 +1,247 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package landlock confines the filesystem accesses of the container
+// process with the Landlock LSM.
+package landlock
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// ReadOnly grants read and execute access beneath a path.
+	ReadOnly = "ro"
+	// ReadWrite grants all filesystem accesses beneath a path.
+	ReadWrite = "rw"
+	// ProfilePrefix introduces a file containing one rule per line.
+	ProfilePrefix = "profile:"
+)
+
+// ErrNotSupported is returned when Landlock is not supported or disabled
+// by the running kernel.
+var ErrNotSupported = errors.New("landlock is not supported by the kernel")
+
+const (
+	readAccess = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_DIR
+
+	// fileAccess are the only accesses applicable to a rule on a file.
+	fileAccess = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_TRUNCATE |
+		unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+)
+
+// abiAccess are the filesystem accesses handled by each Landlock ABI version.
+var abiAccess = []uint64{
+	1: unix.LANDLOCK_ACCESS_FS_MAKE_SYM<<1 - 1,
+	2: unix.LANDLOCK_ACCESS_FS_REFER<<1 - 1,
+	3: unix.LANDLOCK_ACCESS_FS_TRUNCATE<<1 - 1,
+	4: unix.LANDLOCK_ACCESS_FS_TRUNCATE<<1 - 1,
+	5: unix.LANDLOCK_ACCESS_FS_IOCTL_DEV<<1 - 1,
+}
+
+// systemRules are added to every ruleset so that programs of the
+// container image can be executed. Missing paths are ignored.
+var systemRules = []Rule{
+	{Access: ReadOnly, Path: "/bin"},
+	{Access: ReadOnly, Path: "/sbin"},
+	{Access: ReadOnly, Path: "/usr"},
+	{Access: ReadOnly, Path: "/lib"},
+	{Access: ReadOnly, Path: "/lib32"},
+	{Access: ReadOnly, Path: "/lib64"},
+	{Access: ReadOnly, Path: "/libx32"},
+	{Access: ReadOnly, Path: "/etc"},
+	{Access: ReadOnly, Path: "/proc"},
+	{Access: ReadOnly, Path: "/sys"},
+	{Access: ReadOnly, Path: "/.singularity.d"},
+	{Access: ReadWrite, Path: "/dev"},
+}
+
+// Rule grants an access level beneath a path.
+type Rule struct {
+	// Access is ReadOnly or ReadWrite.
+	Access string
+	// Path is an absolute path in the container.
+	Path string
+}
+
+// String returns the rule in the access:path format.
+func (r Rule) String() string {
+	return r.Access + ":" + r.Path
+}
+
+// ParseRule parses a rule in the access:path format.
+func ParseRule(s string) (Rule, error) {
+	access, path, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok || path == "" {
+		return Rule{}, fmt.Errorf("invalid landlock rule %q, must be of form %s:<path> or %s:<path>", s, ReadOnly, ReadWrite)
+	}
+	if access != ReadOnly && access != ReadWrite {
+		return Rule{}, fmt.Errorf("invalid access %q in landlock rule %q, must be %s or %s", access, s, ReadOnly, ReadWrite)
+	}
+	if !filepath.IsAbs(path) {
+		return Rule{}, fmt.Errorf("landlock rule path %q must be absolute", path)
+	}
+	return Rule{Access: access, Path: filepath.Clean(path)}, nil
+}
+
+// ParseRules parses a list of rules.
+func ParseRules(entries []string) ([]Rule, error) {
+	rules := make([]Rule, 0, len(entries))
+	for _, e := range entries {
+		r, err := ParseRule(e)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// ParseProfile parses a profile containing one rule per line, empty lines
+// and lines starting with # are ignored.
+func ParseProfile(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := ParseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// ABI returns the Landlock ABI version supported by the running kernel,
+// or 0 if Landlock is not supported.
+func ABI() int {
+	v, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return 0
+	}
+	return int(v)
+}
+
+// handledAccess returns the filesystem accesses handled with an ABI version.
+func handledAccess(abi int) uint64 {
+	if abi >= len(abiAccess) {
+		abi = len(abiAccess) - 1
+	}
+	return abiAccess[abi]
+}
+
+// Restrict confines the filesystem accesses of the calling thread and of
+// its future children to the paths of the system and provided rules. Each
+// call stacks a new ruleset, so accesses can only be further reduced. The
+// no_new_privs attribute must be set. ErrNotSupported is returned if the
+// kernel doesn't support Landlock.
+func Restrict(rules []Rule) error {
+	abi := ABI()
+	if abi == 0 {
+		return ErrNotSupported
+	}
+	handled := handledAccess(abi)
+
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	// the size only covers the filesystem accesses supported by all
+	// ABI versions
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr.Access_fs), 0)
+	if errno != 0 {
+		return fmt.Errorf("while creating landlock ruleset: %s", errno)
+	}
+	defer unix.Close(int(fd))
+
+	for _, r := range append(systemRules, rules...) {
+		if err := addRule(int(fd), r, handled); err != nil {
+			return err
+		}
+	}
+
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, fd, 0, 0); errno != 0 {
+		return fmt.Errorf("while enforcing landlock ruleset: %s", errno)
+	}
+	return nil
+}
+
+// addRule adds a rule to the ruleset fd, system rules with a missing path
+// are ignored.
+func addRule(fd int, r Rule, handled uint64) error {
+	pfd, err := unix.Open(r.Path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		if err == unix.ENOENT && isSystemRule(r) {
+			return nil
+		}
+		return fmt.Errorf("while opening landlock rule path %s: %s", r.Path, err)
+	}
+	defer unix.Close(pfd)
+
+	access := handled
+	if r.Access == ReadOnly {
+		access &= readAccess
+	}
+	var st unix.Stat_t
+	if err := unix.Fstat(pfd, &st); err != nil {
+		return fmt.Errorf("while getting landlock rule path %s information: %s", r.Path, err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= fileAccess
+	}
+
+	attr := unix.LandlockPathBeneathAttr{
+		Allowed_access: access,
+		Parent_fd:      int32(pfd),
+	}
+	_, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(fd), unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&attr)), 0, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("while adding landlock rule %s: %s", r, errno)
+	}
+	return nil
+}
+
+func isSystemRule(r Rule) bool {
+	for _, s := range systemRules {
+		if s == r {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadProfile reads the rules of a profile file.
+func LoadProfile(path string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("while opening landlock profile: %s", err)
+	}
+	defer f.Close()
+
+	rules, err := ParseProfile(f)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing landlock profile %s: %s", path, err)
+	}
+	return rules, nil
+}
@@ -0,0 +1,156 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package landlock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    Rule
+		wantErr bool
+	}{
+		{rule: "ro:/data", want: Rule{Access: ReadOnly, Path: "/data"}},
+		{rule: " rw:/scratch/job123/ ", want: Rule{Access: ReadWrite, Path: "/scratch/job123"}},
+		{rule: "ro:/path:with:colons", want: Rule{Access: ReadOnly, Path: "/path:with:colons"}},
+		{rule: "/data", wantErr: true},
+		{rule: "ro:", wantErr: true},
+		{rule: "wo:/data", wantErr: true},
+		{rule: "ro:data", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRule(tt.rule)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRule(%q) unexpected error state: %v", tt.rule, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRule(%q) = %+v, want %+v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	profile := `
+# job directories
+ro:/data
+rw:/scratch/job123
+
+rw:/tmp
+`
+	rules, err := ParseProfile(strings.NewReader(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{
+		{Access: ReadOnly, Path: "/data"},
+		{Access: ReadWrite, Path: "/scratch/job123"},
+		{Access: ReadWrite, Path: "/tmp"},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("got rules %+v, want %+v", rules, want)
+	}
+
+	_, err = ParseProfile(strings.NewReader("ro:/data\nbad\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected error on line 2, got %v", err)
+	}
+}
+
+func TestRestrict(t *testing.T) {
+	if ABI() == 0 {
+		t.Skip("landlock not supported by the kernel")
+	}
+
+	dir := t.TempDir()
+	rw := filepath.Join(dir, "rw")
+	ro := filepath.Join(dir, "ro")
+	other := filepath.Join(dir, "other")
+	for _, d := range []string{rw, ro, other} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(d, "file"), []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Landlock and no_new_privs only apply to the calling thread, the
+	// locked thread is terminated with the goroutine.
+	errCh := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			errCh <- err
+			return
+		}
+		rules := []Rule{{Access: ReadWrite, Path: rw}, {Access: ReadOnly, Path: ro}}
+		if err := Restrict(rules); err != nil {
+			errCh <- err
+			return
+		}
+
+		if err := unix.Access(filepath.Join(rw, "file"), unix.W_OK); err != nil {
+			errCh <- errors.New("write access denied in read-write directory")
+			return
+		}
+		fd, err := unix.Open(filepath.Join(ro, "file"), unix.O_RDONLY, 0)
+		if err != nil {
+			errCh <- errors.New("read access denied in read-only directory")
+			return
+		}
+		unix.Close(fd)
+		if fd, err := unix.Open(filepath.Join(ro, "file"), unix.O_WRONLY, 0); err == nil {
+			unix.Close(fd)
+			errCh <- errors.New("write access granted in read-only directory")
+			return
+		}
+		if fd, err := unix.Open(filepath.Join(other, "file"), unix.O_RDONLY, 0); err == nil {
+			unix.Close(fd)
+			errCh <- errors.New("read access granted outside of rules")
+			return
+		}
+		errCh <- nil
+	}()
+
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	// a missing path in user rules is an error
+	go func() {
+		runtime.LockOSThread()
+
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			errCh <- err
+			return
+		}
+		if err := Restrict([]Rule{{Access: ReadOnly, Path: filepath.Join(dir, "missing")}}); err == nil {
+			errCh <- errors.New("unexpected success with a missing rule path")
+			return
+		}
+		errCh <- nil
+	}()
+
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+}
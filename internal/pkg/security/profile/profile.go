@@ -0,0 +1,194 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package profile handles the security profile declared by the %security
+// section of a definition file. The profile is stored in SIF images as a
+// JSON data object, covered by the image signatures, and is only applied
+// when the image is signed by a key trusted for profiles by the
+// administrator.
+package profile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/apptainer/apptainer/pkg/build/types/parser"
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/apptainer/pkg/util/capabilities"
+	"github.com/apptainer/sif/v2/pkg/integrity"
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+// Profile describes the security features required by an image.
+type Profile struct {
+	// Seccomp is an OCI seccomp profile in JSON format.
+	Seccomp json.RawMessage `json:"seccomp,omitempty"`
+	// AppArmor is the name of an AppArmor profile loaded on the host.
+	AppArmor string `json:"apparmor,omitempty"`
+	// Capabilities are added to the container process, they are subject to
+	// the capability configuration like --add-caps.
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// Parse returns the profile declared by a %security section. Each line
+// is a keyword followed by its value:
+//
+//	seccomp <path of a seccomp profile in the container>
+//	apparmor <profile name>
+//	capabilities <comma separated list of capabilities>
+//
+// The seccomp profile is read with readFile, relative to the container root
+// filesystem.
+func Parse(section string, readFile func(string) ([]byte, error)) (*Profile, error) {
+	p := new(Profile)
+
+	for key, val := range parser.GetLabels(section) {
+		if val == "" {
+			return nil, fmt.Errorf("missing value for %s", key)
+		}
+		switch key {
+		case "seccomp":
+			b, err := readFile(val)
+			if err != nil {
+				return nil, fmt.Errorf("while reading seccomp profile: %s", err)
+			}
+			if !json.Valid(b) {
+				return nil, fmt.Errorf("seccomp profile %s is not valid JSON", val)
+			}
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, b); err != nil {
+				return nil, err
+			}
+			p.Seccomp = buf.Bytes()
+		case "apparmor":
+			p.AppArmor = val
+		case "capabilities":
+			caps, ignored := capabilities.Split(val)
+			if len(ignored) > 0 {
+				return nil, fmt.Errorf("unknown capabilities: %s", strings.Join(ignored, ","))
+			}
+			p.Capabilities = caps
+		default:
+			return nil, fmt.Errorf("unknown keyword %s, expected seccomp, apparmor or capabilities", key)
+		}
+	}
+	return p, nil
+}
+
+// Load returns the security profile of the SIF image fp if the object group
+// holding the profile and the root filesystem partition was signed by a key
+// of the keyring with one of the trusted fingerprints, so that a trusted
+// profile can't be applied to another root filesystem. A nil profile is
+// returned for images without a profile, and for images whose profile is
+// not trusted.
+func Load(fp *os.File, kr openpgp.KeyRing, trusted []string) (*Profile, error) {
+	f, err := sif.LoadContainer(fp,
+		sif.OptLoadWithFlag(os.O_RDONLY),
+		sif.OptLoadWithCloseOnUnload(false),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer f.UnloadContainer()
+
+	ods, err := f.GetDescriptors(sif.WithDataType(sif.DataGenericJSON))
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(ods, func(od sif.Descriptor) bool {
+		return od.Name() == image.SIFDescSecurityProfileJSON
+	})
+	if i < 0 {
+		return nil, nil
+	}
+	od := ods[i]
+
+	// the profile is only trusted along with the root filesystem
+	part, err := f.GetDescriptor(sif.WithPartitionType(sif.PartPrimSys))
+	if err != nil || part.GroupID() == 0 || part.GroupID() != od.GroupID() {
+		return nil, nil
+	}
+
+	ok, err := trustedSigner(f, od.GroupID(), kr, trusted)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, nil
+	}
+
+	b, err := od.GetData()
+	if err != nil {
+		return nil, fmt.Errorf("while reading security profile: %s", err)
+	}
+	p := new(Profile)
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("while decoding security profile: %s", err)
+	}
+	return p, nil
+}
+
+// trustedSigner reports whether all the objects of the group groupID were
+// signed by one of the trusted fingerprints with a valid signature.
+func trustedSigner(f *sif.FileImage, groupID uint32, kr openpgp.KeyRing, trusted []string) (bool, error) {
+	if len(trusted) == 0 {
+		return false, nil
+	}
+
+	var invalid [][]byte
+	cb := func(r integrity.VerifyResult) bool {
+		var sigerr *integrity.SignatureNotValidError
+		if !errors.As(r.Error(), &sigerr) {
+			return false
+		}
+		sd, err := f.GetDescriptor(sif.WithID(sigerr.ID))
+		if err != nil {
+			return false
+		}
+		_, sfp, err := sd.SignatureMetadata()
+		if err != nil {
+			return false
+		}
+		invalid = append(invalid, sfp)
+		return true
+	}
+
+	v, err := integrity.NewVerifier(f,
+		integrity.OptVerifyWithKeyRing(kr),
+		integrity.OptVerifyGroup(groupID),
+		integrity.OptVerifyCallback(cb),
+	)
+	if err != nil {
+		// the group is not signed
+		return false, nil
+	}
+	if err := v.Verify(); err != nil {
+		return false, nil
+	}
+
+	fps, err := v.AllSignedBy()
+	if err != nil {
+		return false, err
+	}
+	for _, fp := range fps {
+		if slices.ContainsFunc(invalid, func(i []byte) bool { return bytes.Equal(i, fp) }) {
+			continue
+		}
+		s := hex.EncodeToString(fp)
+		if slices.ContainsFunc(trusted, func(t string) bool { return strings.EqualFold(t, s) }) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,250 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/apptainer/apptainer/pkg/image"
+	"github.com/apptainer/sif/v2/pkg/integrity"
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+const testFingerprint = "F34371D0ACD5D09EB9BD853A80600A5FA11BBD29"
+
+func TestParse(t *testing.T) {
+	files := map[string][]byte{
+		"/etc/seccomp.json": []byte("{\n  \"defaultAction\": \"SCMP_ACT_ALLOW\"\n}\n"),
+		"/etc/invalid.json": []byte("{"),
+	}
+	readFile := func(name string) ([]byte, error) {
+		if b, ok := files[name]; ok {
+			return b, nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	tests := []struct {
+		name    string
+		section string
+		want    *Profile
+		wantErr bool
+	}{
+		{
+			name:    "Empty",
+			section: "",
+			want:    &Profile{},
+		},
+		{
+			name:    "Full",
+			section: "\n    # comment\n    seccomp /etc/seccomp.json\n    apparmor app\n    capabilities net_raw,CAP_SYS_PTRACE\n",
+			want: &Profile{
+				Seccomp:      json.RawMessage(`{"defaultAction":"SCMP_ACT_ALLOW"}`),
+				AppArmor:     "app",
+				Capabilities: []string{"CAP_NET_RAW", "CAP_SYS_PTRACE"},
+			},
+		},
+		{"MissingSeccomp", "seccomp /etc/missing.json", nil, true},
+		{"InvalidSeccomp", "seccomp /etc/invalid.json", nil, true},
+		{"UnknownCapability", "capabilities CAP_UNKNOWN", nil, true},
+		{"UnknownKeyword", "selinux unconfined_t", nil, true},
+		{"MissingValue", "apparmor", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.section, readFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got err %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got profile %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func getTestEntity(t *testing.T, name string) *openpgp.Entity {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("..", "..", "..", "..", "test", "keys", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	el, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return el[0]
+}
+
+// createImage creates a SIF image holding a security profile p, signed
+// with the entity e if not nil.
+func createImage(t *testing.T, p *Profile, e *openpgp.Entity) string {
+	t.Helper()
+
+	var dis []sif.DescriptorInput
+	if p != nil {
+		b, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		di, err := sif.NewDescriptorInput(sif.DataGenericJSON, bytes.NewReader(b),
+			sif.OptObjectName(image.SIFDescSecurityProfileJSON),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dis = append(dis, di)
+	}
+	di, err := sif.NewDescriptorInput(sif.DataPartition, bytes.NewReader([]byte("rootfs")),
+		sif.OptPartitionMetadata(sif.FsSquash, sif.PartPrimSys, "amd64"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dis = append(dis, di)
+
+	path := filepath.Join(t.TempDir(), "image.sif")
+	f, err := sif.CreateContainerAtPath(path, sif.OptCreateWithDescriptors(dis...), sif.OptCreateDeterministic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer()
+
+	if e != nil {
+		s, err := integrity.NewSigner(f, integrity.OptSignWithEntity(e))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Sign(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+// graftImage returns the path of a copy of the signed image with its
+// profile and signatures, but another root filesystem signed with the
+// entity e if not nil.
+func graftImage(t *testing.T, signed string, e *openpgp.Entity) string {
+	t.Helper()
+
+	src, err := sif.LoadContainerFromPath(signed, sif.OptLoadWithFlag(os.O_RDONLY))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.UnloadContainer()
+
+	var dis []sif.DescriptorInput
+	src.WithDescriptors(func(od sif.Descriptor) bool {
+		var di sif.DescriptorInput
+		switch od.DataType() {
+		case sif.DataGenericJSON:
+			di, err = sif.NewDescriptorInput(sif.DataGenericJSON, od.GetReader(),
+				sif.OptObjectName(od.Name()),
+			)
+		case sif.DataPartition:
+			// same size as the original root filesystem
+			di, err = sif.NewDescriptorInput(sif.DataPartition, bytes.NewReader([]byte("evilfs")),
+				sif.OptPartitionMetadata(sif.FsSquash, sif.PartPrimSys, "amd64"),
+			)
+		case sif.DataSignature:
+			ht, fp, merr := od.SignatureMetadata()
+			if merr != nil {
+				err = merr
+				return true
+			}
+			di, err = sif.NewDescriptorInput(sif.DataSignature, od.GetReader(),
+				sif.OptLinkedGroupID(1),
+				sif.OptSignatureMetadata(ht, fp),
+			)
+		}
+		dis = append(dis, di)
+		return err != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "graft.sif")
+	f, err := sif.CreateContainerAtPath(path, sif.OptCreateWithDescriptors(dis...), sif.OptCreateDeterministic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer()
+
+	if e != nil {
+		s, err := integrity.NewSigner(f, integrity.OptSignWithEntity(e))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Sign(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	entity := getTestEntity(t, "pgp-private.asc")
+	kr := openpgp.EntityList{getTestEntity(t, "pgp-public.asc")}
+
+	p := &Profile{AppArmor: "app", Capabilities: []string{"CAP_NET_RAW"}}
+	signed := createImage(t, p, entity)
+
+	// a profile copied onto another root filesystem isn't trusted, even
+	// if the root filesystem is signed
+	other, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		kr      openpgp.KeyRing
+		trusted []string
+		want    *Profile
+	}{
+		{"Trusted", signed, kr, []string{testFingerprint}, p},
+		{"TrustedLowerCase", signed, kr, []string{"f34371d0acd5d09eb9bd853a80600a5fa11bbd29"}, p},
+		{"NoTrustedKeys", signed, kr, nil, nil},
+		{"UntrustedKey", signed, kr, []string{"5994BE54C31CF1B5E1994F987C52CF6D055F072B"}, nil},
+		{"KeyNotInKeyring", signed, openpgp.EntityList{}, []string{testFingerprint}, nil},
+		{"Unsigned", createImage(t, p, nil), kr, []string{testFingerprint}, nil},
+		{"NoProfile", createImage(t, nil, entity), kr, []string{testFingerprint}, nil},
+		{"GraftedUnsigned", graftImage(t, signed, nil), kr, []string{testFingerprint}, nil},
+		{"GraftedSigned", graftImage(t, signed, other), append(kr, other), []string{testFingerprint}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Open(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			got, err := Load(f, tt.kr, tt.trusted)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got profile %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
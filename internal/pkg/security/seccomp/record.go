@@ -0,0 +1,204 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// recordBaseline lists the system calls allowed without notification by
+// the record filter. Until the notification file descriptor reaches the
+// recorder, a notified system call blocks forever, so this covers every
+// system call the Go runtime of the container process may issue on its own
+// while the filter is handed off (memory management, signals, scheduler
+// threads and netpoller). They are always allowed by generated profiles.
+var recordBaseline = []string{
+	"clone",
+	"epoll_ctl",
+	"epoll_pwait",
+	"epoll_wait",
+	"exit",
+	"futex",
+	"getpid",
+	"gettid",
+	"madvise",
+	"mmap",
+	"mprotect",
+	"munmap",
+	"nanosleep",
+	"read",
+	"rt_sigaction",
+	"rt_sigprocmask",
+	"rt_sigreturn",
+	"sched_yield",
+	"sigaltstack",
+	"tgkill",
+	"write",
+}
+
+// recordedArgs associates system calls with the index of an argument
+// whose values are recorded. It's limited to arguments selecting a
+// feature (protocol family, execution domain, operation), the generated
+// profile only allows the values observed for them.
+var recordedArgs = map[string]uint{
+	"personality": 0,
+	"prctl":       0,
+	"socket":      0,
+}
+
+// maxRecordedValues is the number of distinct values of a recorded
+// argument above which the argument isn't restricted anymore.
+const maxRecordedValues = 16
+
+type recordedSyscall struct {
+	count  uint64
+	values map[uint64]bool
+	// any is set when the argument values aren't restricted
+	any bool
+}
+
+// Recorder collects the system calls reported by the record filter and
+// generates an OCI seccomp profile allowing them.
+type Recorder struct {
+	mu       sync.Mutex
+	archs    map[specs.Arch]bool
+	syscalls map[string]*recordedSyscall
+}
+
+// NewRecorder returns an empty system call recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		archs:    make(map[specs.Arch]bool),
+		syscalls: make(map[string]*recordedSyscall),
+	}
+}
+
+// Add records a system call made with the architecture and arguments.
+func (r *Recorder) Add(arch specs.Arch, name string, args []uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if arch != "" {
+		r.archs[arch] = true
+	}
+	s, ok := r.syscalls[name]
+	if !ok {
+		s = &recordedSyscall{values: make(map[uint64]bool)}
+		r.syscalls[name] = s
+	}
+	s.count++
+
+	idx, ok := recordedArgs[name]
+	if !ok || s.any {
+		return
+	}
+	if int(idx) >= len(args) {
+		s.any = true
+		return
+	}
+	s.values[args[idx]] = true
+	if len(s.values) > maxRecordedValues {
+		s.any = true
+		s.values = nil
+	}
+}
+
+// Count returns the number of calls recorded for a system call.
+func (r *Recorder) Count(name string) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s, ok := r.syscalls[name]; ok {
+		return s.count
+	}
+	return 0
+}
+
+// Profile returns a seccomp profile denying with an error every system
+// call which wasn't recorded.
+func (r *Recorder) Profile() *specs.LinuxSeccomp {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	profile := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+	}
+	for arch := range r.archs {
+		profile.Architectures = append(profile.Architectures, arch)
+	}
+	sort.Slice(profile.Architectures, func(i, j int) bool {
+		return profile.Architectures[i] < profile.Architectures[j]
+	})
+
+	allowed := make(map[string]bool)
+	for _, name := range recordBaseline {
+		allowed[name] = true
+	}
+	var restricted []string
+	for name, s := range r.syscalls {
+		if _, ok := recordedArgs[name]; ok && !s.any && !allowed[name] {
+			restricted = append(restricted, name)
+			continue
+		}
+		allowed[name] = true
+	}
+
+	names := make([]string, 0, len(allowed))
+	for name := range allowed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	profile.Syscalls = append(profile.Syscalls, specs.LinuxSyscall{
+		Names:  names,
+		Action: specs.ActAllow,
+	})
+
+	sort.Strings(restricted)
+	for _, name := range restricted {
+		s := r.syscalls[name]
+		values := make([]uint64, 0, len(s.values))
+		for v := range s.values {
+			values = append(values, v)
+		}
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		for _, v := range values {
+			profile.Syscalls = append(profile.Syscalls, specs.LinuxSyscall{
+				Names:  []string{name},
+				Action: specs.ActAllow,
+				Args: []specs.LinuxSeccompArg{
+					{
+						Index: recordedArgs[name],
+						Value: v,
+						Op:    specs.OpEqualTo,
+					},
+				},
+			})
+		}
+	}
+
+	return profile
+}
+
+// WriteProfile writes the generated seccomp profile in JSON format to path.
+func (r *Recorder) WriteProfile(path string) error {
+	b, err := json.MarshalIndent(r.Profile(), "", "    ")
+	if err != nil {
+		return fmt.Errorf("while encoding seccomp profile: %s", err)
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("while writing seccomp profile: %s", err)
+	}
+	return nil
+}
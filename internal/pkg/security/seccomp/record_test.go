@@ -0,0 +1,103 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestRecorderProfile(t *testing.T) {
+	r := NewRecorder()
+	r.Add(specs.ArchX86_64, "openat", []uint64{0, 0, 0, 0, 0, 0})
+	r.Add(specs.ArchX86_64, "openat", []uint64{1, 0, 0, 0, 0, 0})
+	r.Add(specs.ArchX86_64, "socket", []uint64{10, 1, 0, 0, 0, 0})
+	r.Add(specs.ArchX86_64, "socket", []uint64{2, 1, 0, 0, 0, 0})
+	r.Add(specs.ArchX86_64, "socket", []uint64{10, 2, 0, 0, 0, 0})
+	for i := uint64(0); i <= maxRecordedValues; i++ {
+		r.Add(specs.ArchX86_64, "prctl", []uint64{i, 0, 0, 0, 0, 0})
+	}
+	r.Add(specs.ArchX86, "write", []uint64{1, 0, 0, 0, 0, 0})
+
+	if got := r.Count("openat"); got != 2 {
+		t.Errorf("got %d openat calls, want 2", got)
+	}
+	if got := r.Count("read"); got != 0 {
+		t.Errorf("got %d read calls, want 0", got)
+	}
+
+	p := r.Profile()
+	if p.DefaultAction != specs.ActErrno {
+		t.Errorf("got default action %s, want %s", p.DefaultAction, specs.ActErrno)
+	}
+	if want := []specs.Arch{specs.ArchX86, specs.ArchX86_64}; !reflect.DeepEqual(p.Architectures, want) {
+		t.Errorf("got architectures %v, want %v", p.Architectures, want)
+	}
+	if len(p.Syscalls) != 3 {
+		t.Fatalf("got %d syscall rules, want 3: %+v", len(p.Syscalls), p.Syscalls)
+	}
+
+	allowed := p.Syscalls[0].Names
+	for _, name := range append([]string{"openat", "prctl", "write"}, recordBaseline...) {
+		if !slices.Contains(allowed, name) {
+			t.Errorf("%s is not allowed by the generated profile", name)
+		}
+	}
+	if slices.Contains(allowed, "socket") {
+		t.Errorf("socket is allowed without argument restriction")
+	}
+	if !slices.IsSorted(allowed) {
+		t.Errorf("allowed syscalls are not sorted: %v", allowed)
+	}
+
+	// socket is only allowed for the recorded protocol families
+	for i, family := range []uint64{2, 10} {
+		rule := p.Syscalls[i+1]
+		want := specs.LinuxSyscall{
+			Names:  []string{"socket"},
+			Action: specs.ActAllow,
+			Args:   []specs.LinuxSeccompArg{{Index: 0, Value: family, Op: specs.OpEqualTo}},
+		}
+		if !reflect.DeepEqual(rule, want) {
+			t.Errorf("got rule %+v, want %+v", rule, want)
+		}
+	}
+}
+
+func TestRecorderWriteProfile(t *testing.T) {
+	r := NewRecorder()
+	r.Add(specs.ArchX86_64, "read", []uint64{0, 0, 0, 0, 0, 0})
+
+	path := filepath.Join(t.TempDir(), "profile.json")
+	if err := r.WriteProfile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p specs.LinuxSeccomp
+	if err := json.Unmarshal(b, &p); err != nil {
+		t.Fatalf("generated profile is not valid JSON: %s", err)
+	}
+	if !reflect.DeepEqual(&p, r.Profile()) {
+		t.Errorf("written profile %+v doesn't match %+v", p, r.Profile())
+	}
+
+	if err := r.WriteProfile(filepath.Join(t.TempDir(), "missing", "profile.json")); err == nil {
+		t.Errorf("unexpected success while writing to a missing directory")
+	}
+}
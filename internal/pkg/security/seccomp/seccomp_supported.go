@@ -12,6 +12,7 @@
 package seccomp
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -23,6 +24,7 @@ import (
 	"github.com/opencontainers/runtime-spec/specs-go"
 	cseccomp "github.com/seccomp/containers-golang"
 	lseccomp "github.com/seccomp/libseccomp-golang"
+	"golang.org/x/sys/unix"
 )
 
 var scmpArchMap = map[specs.Arch]lseccomp.ScmpArch{
@@ -212,6 +214,109 @@ func LoadSeccompConfig(config *specs.LinuxSeccomp, noNewPrivs bool, errNo int16)
 	return nil
 }
 
+// LoadRecordFilter loads a seccomp filter for the current process reporting
+// every system call through a user notification, except the baseline system
+// calls and sendmsg calls on socket, which is used to pass the returned
+// notification file descriptor to the recorder (see RecordNotifications).
+func LoadRecordFilter(noNewPrivs bool, socket int) (int, error) {
+	if err := prctl(syscall.PR_GET_SECCOMP, 0, 0, 0, 0); err == syscall.EINVAL {
+		return -1, fmt.Errorf("can't load seccomp filter: not supported by kernel")
+	}
+
+	filter, err := lseccomp.NewFilter(lseccomp.ActNotify)
+	if err != nil {
+		return -1, fmt.Errorf("error creating new filter: %s (seccomp user notification requires libseccomp 2.5 and kernel 5.5 or later)", err)
+	}
+	if err := filter.SetNoNewPrivsBit(noNewPrivs); err != nil {
+		return -1, fmt.Errorf("failed to set no new priv flag: %s", err)
+	}
+
+	for _, name := range recordBaseline {
+		sysNr, err := lseccomp.GetSyscallFromName(name)
+		if err != nil {
+			continue
+		}
+		if err := filter.AddRule(sysNr, lseccomp.ActAllow); err != nil {
+			return -1, fmt.Errorf("failed adding seccomp rule for syscall %s: %s", name, err)
+		}
+	}
+
+	sysNr, err := lseccomp.GetSyscallFromName("sendmsg")
+	if err != nil {
+		return -1, fmt.Errorf("failed to resolve sendmsg syscall: %s", err)
+	}
+	cond, err := lseccomp.MakeCondition(0, lseccomp.CompareEqual, uint64(socket))
+	if err != nil {
+		return -1, fmt.Errorf("error making syscall rule condition: %s", err)
+	}
+	if err := filter.AddRuleConditional(sysNr, lseccomp.ActAllow, []lseccomp.ScmpCondition{cond}); err != nil {
+		return -1, fmt.Errorf("failed adding rule condition for syscall sendmsg: %s", err)
+	}
+
+	if err := filter.Load(); err != nil {
+		return -1, fmt.Errorf("failed loading seccomp filter: %s", err)
+	}
+	fd, err := filter.GetNotifFd()
+	if err != nil {
+		return -1, fmt.Errorf("failed to get seccomp notification file descriptor: %s", err)
+	}
+	return int(fd), nil
+}
+
+// RecordNotifications records the system calls reported on the notification
+// file descriptor fd of a record filter and lets them continue, until no
+// process uses the filter anymore.
+func RecordNotifications(fd int, r *Recorder) error {
+	archs := make(map[lseccomp.ScmpArch]specs.Arch)
+	for arch, scmpArch := range scmpArchMap {
+		if arch != "" {
+			archs[scmpArch] = arch
+		}
+	}
+
+	pfd := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	for {
+		pfd[0].Revents = 0
+		if _, err := unix.Poll(pfd, -1); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return fmt.Errorf("while polling seccomp notifications: %s", err)
+		}
+		if pfd[0].Revents&unix.POLLIN == 0 {
+			if pfd[0].Revents&(unix.POLLHUP|unix.POLLERR|unix.POLLNVAL) != 0 {
+				return nil
+			}
+			continue
+		}
+
+		req, err := lseccomp.NotifReceive(lseccomp.ScmpFd(fd))
+		if err != nil {
+			// ENOENT means the process was killed before the
+			// notification was received
+			if errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.ENOENT) {
+				continue
+			}
+			return fmt.Errorf("while receiving seccomp notification: %s", err)
+		}
+
+		name, err := req.Data.Syscall.GetNameByArch(req.Data.Arch)
+		if err != nil {
+			sylog.Debugf("Ignoring unknown syscall %d for architecture %s", req.Data.Syscall, req.Data.Arch)
+		} else {
+			r.Add(archs[req.Data.Arch], name, req.Data.Args)
+		}
+
+		resp := &lseccomp.ScmpNotifResp{
+			ID:    req.ID,
+			Flags: lseccomp.NotifRespFlagContinue,
+		}
+		if err := lseccomp.NotifRespond(lseccomp.ScmpFd(fd), resp); err != nil && !errors.Is(err, syscall.ENOENT) {
+			return fmt.Errorf("while responding to seccomp notification: %s", err)
+		}
+	}
+}
+
 func isUnrecognizedSyscall(err error) bool {
 	return strings.Contains(err.Error(), "unrecognized syscall")
 }
@@ -251,6 +356,11 @@ func LoadProfileFromFile(profile string, generator *generate.Generator) error {
 		return err
 	}
 
+	return LoadProfile(data, generator)
+}
+
+// LoadProfile loads seccomp rules from json data and fill in provided OCI configuration.
+func LoadProfile(data []byte, generator *generate.Generator) error {
 	if generator.Config.Linux == nil {
 		generator.Config.Linux = &specs.Linux{}
 	}
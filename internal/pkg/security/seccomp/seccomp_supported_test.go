@@ -12,15 +12,29 @@
 package seccomp
 
 import (
+	"errors"
 	"os"
+	"os/exec"
+	"runtime"
+	"sync"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/apptainer/apptainer/internal/pkg/runtime/engine/config/oci/generate"
 	"github.com/apptainer/apptainer/internal/pkg/test"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
 )
 
+// recordChildEnv is set to run TestLoadRecordFilter as the recorded
+// child process.
+const recordChildEnv = "APPTAINER_SECCOMP_RECORD_CHILD"
+
+// recordChildUnsupported is the exit code of the recorded child process
+// when the record filter can't be loaded.
+const recordChildUnsupported = 2
+
 func defaultProfile() *specs.LinuxSeccomp {
 	syscalls := []specs.LinuxSyscall{
 		{
@@ -97,3 +111,124 @@ func TestLoadProfileFromFile(t *testing.T) {
 
 	testFchmod(t)
 }
+
+// recordChild loads the record filter while the Go runtime is busy with
+// allocating and sleeping goroutines, then passes the notification file
+// descriptor on the socket inherited as file descriptor 3.
+func recordChild() {
+	const socket = 3
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_ = make([]byte, 1<<16)
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+
+	runtime.LockOSThread()
+	fd, err := LoadRecordFilter(true, socket)
+	if err != nil {
+		os.Exit(recordChildUnsupported)
+	}
+	// let the runtime schedule, collect garbage and park this thread
+	// before the recorder receives the notification file descriptor
+	runtime.GC()
+	time.Sleep(50 * time.Millisecond)
+
+	if err := unix.Sendmsg(socket, []byte{'s'}, unix.UnixRights(fd), nil, 0); err != nil {
+		os.Exit(1)
+	}
+	unix.Close(fd)
+	unix.Close(socket)
+
+	close(stop)
+	wg.Wait()
+	if _, err := os.ReadDir("/proc/self/fd"); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestLoadRecordFilter(t *testing.T) {
+	if os.Getenv(recordChildEnv) != "" {
+		recordChild()
+	}
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("while creating socket pair: %s", err)
+	}
+	defer unix.Close(fds[0])
+	child := os.NewFile(uintptr(fds[1]), "record-child")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLoadRecordFilter$")
+	// a single P makes the runtime more likely to block on the
+	// filtered thread
+	cmd.Env = append(os.Environ(), recordChildEnv+"=1", "GOMAXPROCS=1")
+	cmd.ExtraFiles = []*os.File{child}
+	if err := cmd.Start(); err != nil {
+		child.Close()
+		t.Fatalf("while starting recorded process: %s", err)
+	}
+	child.Close()
+
+	r := NewRecorder()
+	recorded := make(chan error, 1)
+	go func() {
+		buf := make([]byte, unix.CmsgSpace(4))
+		_, oobn, _, _, err := unix.Recvmsg(fds[0], make([]byte, 1), buf, 0)
+		if err != nil || oobn == 0 {
+			recorded <- errors.New("no notification file descriptor received")
+			return
+		}
+		msgs, err := unix.ParseSocketControlMessage(buf[:oobn])
+		if err != nil || len(msgs) == 0 {
+			recorded <- errors.New("no socket control message received")
+			return
+		}
+		nfds, err := unix.ParseUnixRights(&msgs[0])
+		if err != nil || len(nfds) != 1 {
+			recorded <- errors.New("no notification file descriptor received")
+			return
+		}
+		defer unix.Close(nfds[0])
+		recorded <- RecordNotifications(nfds[0], r)
+	}()
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == recordChildUnsupported {
+			t.Skip("seccomp user notification not supported")
+		} else if err != nil {
+			t.Fatalf("recorded process failed: %s", err)
+		}
+	case <-time.After(30 * time.Second):
+		_ = cmd.Process.Kill()
+		<-exited
+		t.Fatalf("recorded process blocked before the notification file descriptor was received")
+	}
+
+	if err := <-recorded; err != nil {
+		t.Fatalf("while recording: %s", err)
+	}
+	if r.Count("getdents64") == 0 {
+		t.Errorf("getdents64 was not recorded")
+	}
+}
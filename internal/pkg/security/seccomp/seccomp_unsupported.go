@@ -28,6 +28,16 @@ func LoadSeccompConfig(_ *specs.LinuxSeccomp, _ bool, _ int16) error {
 	return fmt.Errorf("can't load seccomp filter: not enabled at compilation time")
 }
 
+// LoadRecordFilter loads a seccomp filter reporting system calls through user notifications.
+func LoadRecordFilter(_ bool, _ int) (int, error) {
+	return -1, fmt.Errorf("can't load seccomp filter: not enabled at compilation time")
+}
+
+// RecordNotifications records the system calls reported by a record filter.
+func RecordNotifications(_ int, _ *Recorder) error {
+	return fmt.Errorf("can't record seccomp notifications: not enabled at compilation time")
+}
+
 // LoadProfileFromFile loads seccomp rules from json file and fill in provided OCI configuration.
 func LoadProfileFromFile(_ string, generator *generate.Generator) error {
 	if generator.Config.Linux == nil {
@@ -38,3 +48,8 @@ func LoadProfileFromFile(_ string, generator *generate.Generator) error {
 	}
 	return nil
 }
+
+// LoadProfile loads seccomp rules from json data and fill in provided OCI configuration.
+func LoadProfile(_ []byte, generator *generate.Generator) error {
+	return LoadProfileFromFile("", generator)
+}
@@ -0,0 +1,467 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package builder
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	buildpkg "github.com/apptainer/apptainer/internal/pkg/build"
+	"github.com/apptainer/apptainer/internal/pkg/build/files"
+	"github.com/apptainer/apptainer/internal/pkg/client/library"
+	"github.com/apptainer/apptainer/pkg/build/types"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	scslibrary "github.com/apptainer/container-library-client/client"
+)
+
+const (
+	// contextDir is the directory of the %files sources in a workspace, and
+	// the working directory of the build.
+	contextDir = "context"
+	// stopTimeout is the time given to canceled builds to clean up.
+	stopTimeout = 30 * time.Second
+)
+
+// hostBootstraps are the bootstrap agents reading images from the host.
+var hostBootstraps = []string{
+	"localimage",
+	"docker-archive",
+	"docker-daemon",
+	"oci",
+	"oci-archive",
+	"buildkit",
+	"dockerfile",
+}
+
+// CheckStages returns an error if one of the stages defs can't be built
+// remotely, running scripts or reading images on the host.
+func CheckStages(defs []types.Definition) error {
+	for _, def := range defs {
+		switch {
+		case def.BuildData.Pre.Script != "":
+			return errors.New("%pre sections run on the host")
+		case def.BuildData.Setup.Script != "":
+			return errors.New("%setup sections run on the host")
+		case slices.Contains(hostBootstraps, def.Header["bootstrap"]):
+			return fmt.Errorf("%s bootstrap reads images from the host", def.Header["bootstrap"])
+		}
+	}
+	return nil
+}
+
+// checkDefinition returns an error if the stages of the definition at path
+// can't be built remotely, or copy %files sources from outside the context
+// directory ctxDir.
+func checkDefinition(path, ctxDir string) error {
+	defs, _, err := buildpkg.MakeAllDefs(path, nil)
+	if err != nil {
+		return err
+	}
+	if err := CheckStages(defs); err != nil {
+		return err
+	}
+	for _, def := range defs {
+		for _, f := range def.BuildData.Files {
+			// sections with arguments copy files from other stages
+			if strings.Split(f.Args, "#")[0] != "" {
+				continue
+			}
+			for _, t := range f.Files {
+				if err := checkSource(t.Src, ctxDir); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkSource returns an error if the %files source src, expanded like the
+// build does, matches paths outside of the context directory ctxDir.
+func checkSource(src, ctxDir string) error {
+	// variables, command substitutions and home directories expand to
+	// paths of the build server host
+	if strings.ContainsAny(src, "$`~") {
+		return fmt.Errorf("%%files source %s uses shell expansion", src)
+	}
+	if filepath.IsAbs(src) {
+		return fmt.Errorf("%%files source %s outside of the context", src)
+	}
+	paths, err := files.ExpandPath(filepath.Join(ctxDir, src))
+	if err != nil {
+		return fmt.Errorf("%%files source %s: %w", src, err)
+	}
+	for _, p := range paths {
+		rel, err := filepath.Rel(ctxDir, p)
+		if err != nil || !filepath.IsLocal(rel) {
+			return fmt.Errorf("%%files source %s outside of the context", src)
+		}
+	}
+	return nil
+}
+
+// build is a build and its workspace.
+type build struct {
+	id   string
+	user string
+	dir  string
+	req  BuildRequest
+
+	cancel context.CancelFunc
+	// done is closed once the build is completed.
+	done chan struct{}
+
+	mu      sync.Mutex
+	state   BuildInfo
+	log     []byte
+	changed chan struct{}
+}
+
+func newBuild(id, user, dir string) *build {
+	return &build{
+		id:   id,
+		user: user,
+		dir:  dir,
+		done: make(chan struct{}),
+		state: BuildInfo{
+			ID:        id,
+			State:     StateQueued,
+			Submitted: time.Now(),
+		},
+		changed: make(chan struct{}),
+	}
+}
+
+func (b *build) definitionPath() string {
+	return filepath.Join(b.dir, "definition.def")
+}
+
+func (b *build) imagePath() string {
+	return filepath.Join(b.dir, "image.sif")
+}
+
+// info returns the description of the build.
+func (b *build) info() BuildInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// notify wakes up the followers of the log, with b.mu held.
+func (b *build) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// Write appends p to the log of the build.
+func (b *build) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.log = append(b.log, p...)
+	b.notify()
+	return len(p), nil
+}
+
+// setState updates the state of the build, with the error making it fail.
+func (b *build) setState(state State, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state.State = state
+	if err != nil {
+		b.state.Error = err.Error()
+	}
+	if state.Completed() {
+		b.state.Completed = time.Now()
+	}
+	b.notify()
+}
+
+// follow calls send with the log of the build as it is written, until the
+// build completes or ctx is done.
+func (b *build) follow(ctx context.Context, send func([]byte) error) {
+	offset := 0
+	for {
+		b.mu.Lock()
+		p := b.log[offset:]
+		completed := b.state.State.Completed()
+		changed := b.changed
+		b.mu.Unlock()
+
+		if len(p) > 0 {
+			if err := send(p); err != nil {
+				return
+			}
+			offset += len(p)
+			continue
+		}
+		if completed {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// readForm reads the build request, the definition and the context of the
+// multipart form of r into the workspace.
+func (b *build) readForm(r *http.Request) error {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(b.dir, contextDir), 0o700); err != nil {
+		return err
+	}
+
+	hasDef := false
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("invalid request: %w", err)
+		}
+
+		switch part.FormName() {
+		case RequestField:
+			err = json.NewDecoder(io.LimitReader(part, maxDefinitionSize)).Decode(&b.req)
+		case DefinitionField:
+			var def []byte
+			def, err = io.ReadAll(io.LimitReader(part, maxDefinitionSize+1))
+			if err == nil && len(def) > maxDefinitionSize {
+				err = errors.New("too large")
+			}
+			if err == nil {
+				err = os.WriteFile(b.definitionPath(), def, 0o600)
+			}
+			hasDef = true
+		case ContextField:
+			err = extractContext(part, filepath.Join(b.dir, contextDir))
+		default:
+			err = errors.New("unknown field")
+		}
+		part.Close()
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", part.FormName(), err)
+		}
+	}
+
+	if !hasDef {
+		return errors.New("no definition to build")
+	}
+	if err := checkDefinition(b.definitionPath(), filepath.Join(b.dir, contextDir)); err != nil {
+		return fmt.Errorf("invalid definition: %w", err)
+	}
+	if b.req.LibraryRef != "" {
+		if !strings.HasPrefix(b.req.LibraryRef, "library://") {
+			return fmt.Errorf("invalid library reference %q", b.req.LibraryRef)
+		}
+		if b.req.LibraryURL == "" {
+			return errors.New("no library URL to push to")
+		}
+		b.state.LibraryRef = b.req.LibraryRef
+	}
+	return nil
+}
+
+// extractContext extracts the regular files and directories of the gzip
+// compressed tar archive r into dir, up to maxContextEntries entries and
+// maxContextSize bytes.
+func extractContext(r io.Reader, dir string) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+
+	entries := 0
+	var size int64
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if entries++; entries > maxContextEntries {
+			return fmt.Errorf("more than %d entries", maxContextEntries)
+		}
+		if !filepath.IsLocal(hdr.Name) {
+			return fmt.Errorf("%s: path outside of the context", hdr.Name)
+		}
+		path := filepath.Join(dir, hdr.Name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if hdr.Size > maxContextSize-size {
+				return fmt.Errorf("larger than %d bytes", maxContextSize)
+			}
+			size += hdr.Size
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(hdr.Mode)&0o777|0o600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s: unsupported file type", hdr.Name)
+		}
+	}
+}
+
+// run runs the build once one of the concurrent builds is available, then
+// pushes the image if requested.
+func (s *Server) run(ctx context.Context, b *build) {
+	defer close(b.done)
+	defer b.cancel()
+
+	select {
+	case s.sem <- struct{}{}:
+		defer func() { <-s.sem }()
+	case <-ctx.Done():
+		b.setState(StateCanceled, nil)
+		return
+	}
+	b.setState(StateRunning, nil)
+
+	err := s.runBuild(ctx, b)
+	if err == nil && b.req.LibraryRef != "" {
+		err = push(ctx, b)
+	}
+	if ctx.Err() != nil {
+		sylog.Infof("Build %s canceled", b.id)
+		b.setState(StateCanceled, nil)
+		return
+	}
+	if err != nil {
+		sylog.Infof("Build %s failed: %v", b.id, err)
+		fmt.Fprintf(b, "Build failed: %v\n", err)
+		b.setState(StateFailed, err)
+		return
+	}
+
+	size, checksum, err := hashImage(b.imagePath())
+	if err != nil {
+		b.setState(StateFailed, err)
+		return
+	}
+	b.mu.Lock()
+	b.state.ImageSize = size
+	b.state.ImageChecksum = checksum
+	b.mu.Unlock()
+
+	sylog.Infof("Build %s succeeded", b.id)
+	b.setState(StateSucceeded, nil)
+}
+
+// runBuild runs the build command in the context directory of the
+// workspace, writing its output to the log.
+func (s *Server) runBuild(ctx context.Context, b *build) error {
+	tmpDir := filepath.Join(b.dir, "tmp")
+	if err := os.Mkdir(tmpDir, 0o700); err != nil {
+		return err
+	}
+
+	args := append(slices.Clone(s.cfg.Args), "build", "--tmpdir", tmpDir)
+	if b.req.Arch != "" {
+		args = append(args, "--arch", b.req.Arch)
+	}
+	if b.req.NoTest {
+		args = append(args, "--notest")
+	}
+	args = append(args, b.imagePath(), b.definitionPath())
+
+	cmd := exec.CommandContext(ctx, s.cfg.Command, args...)
+	cmd.Dir = filepath.Join(b.dir, contextDir)
+	cmd.Stdout = b
+	cmd.Stderr = b
+	// stop the whole build on cancellation, giving it time to clean up
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = stopTimeout
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("build command failed: %w", err)
+	}
+	return nil
+}
+
+// push pushes the image built to the requested library reference.
+func push(ctx context.Context, b *build) error {
+	ref, err := library.NormalizeLibraryRef(b.req.LibraryRef)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(b, "Pushing image to %s\n", b.req.LibraryRef)
+	_, err = library.Push(ctx, b.imagePath(), ref, "", &scslibrary.Config{
+		BaseURL:    b.req.LibraryURL,
+		AuthToken:  b.req.LibraryToken,
+		HTTPClient: &http.Client{},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to push image to library: %w", err)
+	}
+	fmt.Fprintf(b, "Pushed image to %s\n", b.req.LibraryRef)
+	return nil
+}
+
+// hashImage returns the size and the checksum of the image at path.
+func hashImage(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, "sha256." + hex.EncodeToString(h.Sum(nil)), nil
+}
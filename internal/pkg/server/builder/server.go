@@ -0,0 +1,354 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package builder implements a build server, building images from the
+// definitions and %files context submitted by remote builds in their own
+// workspaces, streaming their logs over websocket, and returning the images
+// or pushing them to a library.
+package builder
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/server"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	jsonresp "github.com/sylabs/json-resp"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// buildsDir is the directory of the build workspaces.
+	buildsDir = "builds"
+	// buildRetention is the time completed builds are kept.
+	buildRetention = 24 * time.Hour
+	// maxDefinitionSize is the maximum size of definitions and build
+	// requests.
+	maxDefinitionSize = 1 << 20
+)
+
+// Limits of the contexts of build submissions, variables for tests.
+var (
+	// maxContextSize is the maximum size of the files of a context, and of
+	// the gzip compressed archive of submissions.
+	maxContextSize int64 = 4 << 30
+	// maxContextEntries is the maximum number of files and directories of
+	// a context.
+	maxContextEntries = 100000
+)
+
+// Multipart form fields of build submissions.
+const (
+	// RequestField holds the JSON encoded BuildRequest.
+	RequestField = "request"
+	// DefinitionField holds the definition to build.
+	DefinitionField = "definition"
+	// ContextField holds the gzip compressed tar archive of the %files
+	// sources, which the definition refers to relative to its root.
+	ContextField = "context"
+)
+
+// State is the state of a build.
+type State string
+
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCanceled  State = "canceled"
+)
+
+// Completed returns whether the build is completed.
+func (s State) Completed() bool {
+	return s == StateSucceeded || s == StateFailed || s == StateCanceled
+}
+
+// BuildRequest holds the options of a build.
+type BuildRequest struct {
+	// Arch is the architecture to build for, the architecture of the server
+	// if empty.
+	Arch string `json:"arch,omitempty"`
+	// NoTest skips the %test section.
+	NoTest bool `json:"noTest,omitempty"`
+	// LibraryRef is the library reference the image is pushed to, with the
+	// library at LibraryURL authenticated with LibraryToken, instead of being
+	// returned.
+	LibraryRef   string `json:"libraryRef,omitempty"`
+	LibraryURL   string `json:"libraryURL,omitempty"`
+	LibraryToken string `json:"libraryToken,omitempty"`
+}
+
+// BuildInfo describes a build.
+type BuildInfo struct {
+	ID         string    `json:"id"`
+	State      State     `json:"state"`
+	Error      string    `json:"error,omitempty"`
+	Submitted  time.Time `json:"submitted"`
+	Completed  time.Time `json:"completed,omitzero"`
+	LibraryRef string    `json:"libraryRef,omitempty"`
+	// ImageSize and ImageChecksum, the hex encoded SHA-256 hash prefixed
+	// with sha256., describe the image built.
+	ImageSize     int64  `json:"imageSize,omitempty"`
+	ImageChecksum string `json:"imageChecksum,omitempty"`
+}
+
+// Config is the configuration of a build server.
+type Config struct {
+	// Dir is the directory of the build workspaces.
+	Dir string
+	// Tokens maps the bearer tokens accepted by the server to the names of
+	// their users.
+	Tokens map[string]string
+	// URL is the base URL advertised to clients, derived from the requests
+	// if empty.
+	URL string
+	// Version is the version reported by the server.
+	Version string
+	// Command is the apptainer command run to build images, with the global
+	// options of Args.
+	Command string
+	Args    []string
+	// Concurrency is the number of builds run concurrently, 1 if not set.
+	Concurrency int
+}
+
+// Server serves builds.
+type Server struct {
+	cfg Config
+	sem chan struct{}
+
+	mu     sync.Mutex
+	builds map[string]*build
+}
+
+// New returns a build server with its workspaces in cfg.Dir, creating it if
+// needed.
+func New(cfg Config) (*Server, error) {
+	if len(cfg.Tokens) == 0 {
+		return nil, errors.New("no token accepted by the build server")
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+
+	// builds don't survive restarts
+	dir := filepath.Join(cfg.Dir, buildsDir)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("while creating build directory: %w", err)
+	}
+
+	return &Server{
+		cfg:    cfg,
+		sem:    make(chan struct{}, cfg.Concurrency),
+		builds: make(map[string]*build),
+	}, nil
+}
+
+// Close cancels the builds in progress, and waits for their completion.
+func (s *Server) Close() {
+	s.mu.Lock()
+	builds := make([]*build, 0, len(s.builds))
+	for _, b := range s.builds {
+		builds = append(builds, b)
+	}
+	s.mu.Unlock()
+
+	for _, b := range builds {
+		b.cancel()
+		<-b.done
+	}
+}
+
+// Handler returns the HTTP handler of the build server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /version", s.handleVersion)
+	mux.HandleFunc("GET /assets/config/config.prod.json", s.handleConfig)
+	mux.HandleFunc("GET /v1/token-status", s.handleTokenStatus)
+
+	mux.HandleFunc("POST /v1/builds", s.auth(s.handleSubmit))
+	mux.HandleFunc("GET /v1/builds/{id}", s.auth(s.build(s.handleGetBuild)))
+	mux.HandleFunc("DELETE /v1/builds/{id}", s.auth(s.build(s.handleDeleteBuild)))
+	mux.HandleFunc("GET /v1/builds/{id}/log", s.auth(s.build(s.handleLog)))
+	mux.HandleFunc("GET /v1/builds/{id}/image", s.auth(s.build(s.handleImage)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sylog.Debugf("%s %s %s", r.RemoteAddr, r.Method, r.URL.Path)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// userHandlerFunc is a handler of requests from an authenticated user.
+type userHandlerFunc func(w http.ResponseWriter, r *http.Request, user string)
+
+// auth returns a handler calling h if the request is authenticated.
+func (s *Server) auth(h userHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := server.TokenUser(s.cfg.Tokens, r)
+		if !ok {
+			jsonresp.WriteError(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		h(w, r, user)
+	}
+}
+
+// buildHandlerFunc is a handler of requests about a build.
+type buildHandlerFunc func(w http.ResponseWriter, r *http.Request, b *build)
+
+// build returns a handler calling h with the build of the request, if
+// submitted by the user.
+func (s *Server) build(h buildHandlerFunc) userHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, user string) {
+		s.mu.Lock()
+		b, ok := s.builds[r.PathValue("id")]
+		s.mu.Unlock()
+		if !ok || b.user != user {
+			jsonresp.WriteError(w, fmt.Sprintf("build %q not found", r.PathValue("id")), http.StatusNotFound)
+			return
+		}
+		h(w, r, b)
+	}
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, _ *http.Request) {
+	jsonresp.WriteResponse(w, struct {
+		Version string `json:"version"`
+	}{s.cfg.Version}, http.StatusOK)
+}
+
+// handleConfig advertises the server as the builder and token services of
+// the remote endpoint.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	base := server.BaseURL(s.cfg.URL, r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]map[string]string{
+		"builderAPI": {"uri": base},
+		"tokenAPI":   {"uri": base},
+	})
+}
+
+func (s *Server) handleTokenStatus(w http.ResponseWriter, r *http.Request) {
+	if _, ok := server.TokenUser(s.cfg.Tokens, r); !ok {
+		jsonresp.WriteError(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	jsonresp.WriteResponse(w, struct {
+		Status string `json:"status"`
+	}{"valid"}, http.StatusOK)
+}
+
+// removeExpired removes the builds completed for too long.
+func (s *Server) removeExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, b := range s.builds {
+		if info := b.info(); info.State.Completed() && time.Since(info.Completed) > buildRetention {
+			delete(s.builds, id)
+			os.RemoveAll(b.dir)
+		}
+	}
+}
+
+// handleSubmit creates a build from the multipart form of the request, and
+// starts it.
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request, user string) {
+	s.removeExpired()
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	b := newBuild(hex.EncodeToString(id), user, filepath.Join(s.cfg.Dir, buildsDir, hex.EncodeToString(id)))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxContextSize+2*maxDefinitionSize)
+
+	if err := b.readForm(r); err != nil {
+		os.RemoveAll(b.dir)
+		jsonresp.WriteError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+
+	s.mu.Lock()
+	s.builds[b.id] = b
+	s.mu.Unlock()
+
+	sylog.Infof("Build %s submitted by %s", b.id, user)
+	go s.run(ctx, b)
+
+	jsonresp.WriteResponse(w, b.info(), http.StatusCreated)
+}
+
+func (s *Server) handleGetBuild(w http.ResponseWriter, _ *http.Request, b *build) {
+	jsonresp.WriteResponse(w, b.info(), http.StatusOK)
+}
+
+// handleDeleteBuild cancels the build if in progress, and removes it.
+func (s *Server) handleDeleteBuild(w http.ResponseWriter, _ *http.Request, b *build) {
+	b.cancel()
+	<-b.done
+
+	s.mu.Lock()
+	delete(s.builds, b.id)
+	s.mu.Unlock()
+	os.RemoveAll(b.dir)
+
+	jsonresp.WriteResponse(w, b.info(), http.StatusOK)
+}
+
+// handleLog streams the log of the build over websocket, until the build
+// completes.
+func (s *Server) handleLog(w http.ResponseWriter, r *http.Request, b *build) {
+	websocket.Server{
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			b.follow(r.Context(), func(p []byte) error {
+				return websocket.Message.Send(ws, p)
+			})
+		},
+	}.ServeHTTP(w, r)
+}
+
+// handleImage serves the image built.
+func (s *Server) handleImage(w http.ResponseWriter, r *http.Request, b *build) {
+	if info := b.info(); info.State != StateSucceeded || info.LibraryRef != "" {
+		jsonresp.WriteError(w, fmt.Sprintf("build %s has no image", b.id), http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(b.imagePath())
+	if err != nil {
+		jsonresp.WriteError(w, fmt.Sprintf("build %s has no image", b.id), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		jsonresp.WriteError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "image.sif", fi.ModTime(), f)
+}
@@ -0,0 +1,440 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jsonresp "github.com/sylabs/json-resp"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	testToken  = "s3cr3t"
+	otherToken = "0th3r"
+)
+
+// testCommand fakes the build command, writing the definition followed by
+// the %files sources of the context to the image. Definitions holding fail
+// make the build fail, and the ones holding sleep hang it.
+const testCommand = `#!/bin/sh
+while [ $# -gt 2 ]; do shift; done
+echo "Building $1"
+grep -q fail "$2" && { echo "oops" >&2; exit 1; }
+grep -q sleep "$2" && sleep 60
+cat "$2" > "$1"
+if [ -d files ]; then find files -type f | sort | xargs cat >> "$1"; fi
+`
+
+type testServer struct {
+	*httptest.Server
+	t *testing.T
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	command := filepath.Join(t.TempDir(), "apptainer")
+	if err := os.WriteFile(command, []byte(testCommand), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(Config{
+		Dir:     t.TempDir(),
+		Tokens:  map[string]string{testToken: "alice", otherToken: "bob"},
+		Version: "1.0.0",
+		Command: command,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &testServer{httptest.NewServer(s.Handler()), t}
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+	return ts
+}
+
+func (ts *testServer) do(method, path, token, contentType string, body io.Reader) *http.Response {
+	ts.t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+path, body)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return res
+}
+
+// call sends a request, checking its status code and decoding its build
+// description.
+func (ts *testServer) call(method, path, token string, code int) BuildInfo {
+	ts.t.Helper()
+
+	res := ts.do(method, path, token, "", nil)
+	defer res.Body.Close()
+	if res.StatusCode != code {
+		ts.t.Fatalf("%s %s: got status %d, want %d", method, path, res.StatusCode, code)
+	}
+
+	var info BuildInfo
+	if code < 300 {
+		if err := jsonresp.ReadResponse(res.Body, &info); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	return info
+}
+
+// submit submits the build of def with the options of req and the context
+// files, checking the status code of the response.
+func (ts *testServer) submit(token, def string, req BuildRequest, files map[string]string, code int) BuildInfo {
+	ts.t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	w, _ := mw.CreateFormField(RequestField)
+	json.NewEncoder(w).Encode(req)
+	if def != "" {
+		w, _ = mw.CreateFormField(DefinitionField)
+		io.WriteString(w, def)
+	}
+	if files != nil {
+		w, _ = mw.CreateFormFile(ContextField, "context.tar.gz")
+		w.Write(testContext(ts.t, files))
+	}
+	mw.Close()
+
+	res := ts.do(http.MethodPost, "/v1/builds", token, mw.FormDataContentType(), &body)
+	defer res.Body.Close()
+	if res.StatusCode != code {
+		ts.t.Fatalf("got status %d, want %d", res.StatusCode, code)
+	}
+
+	var info BuildInfo
+	if code == http.StatusCreated {
+		if err := jsonresp.ReadResponse(res.Body, &info); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	return info
+}
+
+// wait waits for the completion of the build id.
+func (ts *testServer) wait(id string) BuildInfo {
+	ts.t.Helper()
+
+	for range 100 {
+		info := ts.call(http.MethodGet, "/v1/builds/"+id, testToken, http.StatusOK)
+		if info.State.Completed() {
+			return info
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	ts.t.Fatalf("build %s not completed", id)
+	return BuildInfo{}
+}
+
+// log returns the log of the build id, followed over websocket.
+func (ts *testServer) log(id string) string {
+	ts.t.Helper()
+
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(ts.URL, "http")+"/v1/builds/"+id+"/log", ts.URL)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	config.Header.Set("Authorization", "Bearer "+testToken)
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer ws.Close()
+
+	var log []byte
+	for {
+		var p []byte
+		if err := websocket.Message.Receive(ws, &p); errors.Is(err, io.EOF) {
+			return string(log)
+		} else if err != nil {
+			ts.t.Fatal(err)
+		}
+		log = append(log, p...)
+	}
+}
+
+// testContext returns the gzip compressed tar archive of files.
+func testContext(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+		})
+		io.WriteString(tw, content)
+	}
+	tw.Close()
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestBuild(t *testing.T) {
+	ts := newTestServer(t)
+
+	def := "Bootstrap: scratch\n%files\n\tfiles/a /a\n"
+	info := ts.submit(testToken, def, BuildRequest{}, map[string]string{"files/a": "content"}, http.StatusCreated)
+	if info.ID == "" || info.State.Completed() {
+		t.Fatalf("unexpected submitted build %+v", info)
+	}
+
+	if log := ts.log(info.ID); !strings.Contains(log, "Building ") {
+		t.Errorf("unexpected log %q", log)
+	}
+
+	info = ts.wait(info.ID)
+	if info.State != StateSucceeded {
+		t.Fatalf("got state %s (%s), want %s", info.State, info.Error, StateSucceeded)
+	}
+	want := def + "content"
+	if info.ImageSize != int64(len(want)) || !strings.HasPrefix(info.ImageChecksum, "sha256.") {
+		t.Errorf("unexpected image size %d and checksum %q", info.ImageSize, info.ImageChecksum)
+	}
+
+	res := ts.do(http.MethodGet, "/v1/builds/"+info.ID+"/image", testToken, "", nil)
+	image, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(image) != want {
+		t.Errorf("got image %q with status %d, want %q", image, res.StatusCode, want)
+	}
+
+	ts.call(http.MethodDelete, "/v1/builds/"+info.ID, testToken, http.StatusOK)
+	ts.call(http.MethodGet, "/v1/builds/"+info.ID, testToken, http.StatusNotFound)
+}
+
+func TestBuildFailed(t *testing.T) {
+	ts := newTestServer(t)
+
+	info := ts.submit(testToken, "Bootstrap: fail\n", BuildRequest{}, nil, http.StatusCreated)
+	if log := ts.log(info.ID); !strings.Contains(log, "oops") || !strings.Contains(log, "Build failed") {
+		t.Errorf("unexpected log %q", log)
+	}
+	if info = ts.wait(info.ID); info.State != StateFailed || info.Error == "" {
+		t.Errorf("got state %s (%s), want %s", info.State, info.Error, StateFailed)
+	}
+	ts.call(http.MethodGet, "/v1/builds/"+info.ID+"/image", testToken, http.StatusNotFound)
+}
+
+func TestCancel(t *testing.T) {
+	ts := newTestServer(t)
+
+	info := ts.submit(testToken, "Bootstrap: sleep\n", BuildRequest{}, nil, http.StatusCreated)
+	// the second build is queued behind the first one
+	queued := ts.submit(testToken, "Bootstrap: scratch\n", BuildRequest{}, nil, http.StatusCreated)
+
+	start := time.Now()
+	if info = ts.call(http.MethodDelete, "/v1/builds/"+info.ID, testToken, http.StatusOK); info.State != StateCanceled {
+		t.Errorf("got state %s, want %s", info.State, StateCanceled)
+	}
+	if time.Since(start) > stopTimeout {
+		t.Errorf("build not stopped on cancellation")
+	}
+
+	if queued = ts.wait(queued.ID); queued.State != StateSucceeded {
+		t.Errorf("got state %s (%s), want %s", queued.State, queued.Error, StateSucceeded)
+	}
+}
+
+func TestInvalidSubmission(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		name  string
+		def   string
+		req   BuildRequest
+		files map[string]string
+	}{
+		{name: "NoDefinition"},
+		{
+			name:  "OutsideContext",
+			def:   "Bootstrap: scratch\n",
+			files: map[string]string{"../a": "content"},
+		},
+		{
+			name: "Setup",
+			def:  "Bootstrap: scratch\n%setup\n\ttouch /tmp/setup\n",
+		},
+		{
+			name: "Pre",
+			def:  "Bootstrap: scratch\n%pre\n\ttouch /tmp/pre\n",
+		},
+		{
+			name: "SetupLastStage",
+			def:  "Bootstrap: scratch\nStage: one\n\nBootstrap: scratch\nStage: two\n%setup\n\ttouch /tmp/setup\n",
+		},
+		{
+			name: "LocalImage",
+			def:  "Bootstrap: localimage\nFrom: /srv/image.sif\n",
+		},
+		{
+			name: "LocalImageLastStage",
+			def:  "Bootstrap: scratch\nStage: one\n\nBootstrap: localimage\nFrom: /srv/image.sif\nStage: two\n",
+		},
+		{
+			name: "OCIArchive",
+			def:  "Bootstrap: oci-archive\nFrom: /srv/image.tar\n",
+		},
+		{
+			name: "AbsoluteFiles",
+			def:  "Bootstrap: scratch\n%files\n\t/etc/shadow /shadow\n",
+		},
+		{
+			name:  "RelativeFiles",
+			def:   "Bootstrap: scratch\n%files\n\t../../../secret /secret\n",
+			files: map[string]string{"files/a": "content"},
+		},
+		{
+			name:  "VariableFiles",
+			def:   "Bootstrap: scratch\n%files\n\t$HOME/.ssh/id_rsa /id_rsa\n",
+			files: map[string]string{"files/a": "content"},
+		},
+		{
+			name:  "DefaultValueFiles",
+			def:   "Bootstrap: scratch\n%files\n\t${X:-/etc/shadow} /shadow\n",
+			files: map[string]string{"files/a": "content"},
+		},
+		{
+			name:  "TildeFiles",
+			def:   "Bootstrap: scratch\n%files\n\t~root/.ssh/id_rsa /id_rsa\n",
+			files: map[string]string{"files/a": "content"},
+		},
+		{
+			name:  "CommandFiles",
+			def:   "Bootstrap: scratch\n%files\n\t`echo /etc/shadow` /shadow\n",
+			files: map[string]string{"files/a": "content"},
+		},
+		{
+			name:  "QuotedFiles",
+			def:   "Bootstrap: scratch\n%files\n\t\"..\"/\"..\"/\"..\"/etc/shadow /shadow\n",
+			files: map[string]string{"files/a": "content"},
+		},
+		{
+			name:  "BraceFiles",
+			def:   "Bootstrap: scratch\n%files\n\t{..,files}/../../etc/shadow /shadow\n",
+			files: map[string]string{"files/a": "content"},
+		},
+		{
+			name: "FilesLastStage",
+			def:  "Bootstrap: scratch\nStage: one\n\nBootstrap: scratch\nStage: two\n%files\n\t/etc/shadow /shadow\n",
+		},
+		{
+			name: "InvalidLibraryRef",
+			def:  "Bootstrap: scratch\n",
+			req:  BuildRequest{LibraryRef: "docker://alpine", LibraryURL: "https://library.example.com"},
+		},
+		{
+			name: "NoLibraryURL",
+			def:  "Bootstrap: scratch\n",
+			req:  BuildRequest{LibraryRef: "library://alice/default/image"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts.submit(testToken, tt.def, tt.req, tt.files, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestFilesGlob(t *testing.T) {
+	ts := newTestServer(t)
+
+	def := "Bootstrap: scratch\n%files\n\tfiles/* /\n"
+	info := ts.submit(testToken, def, BuildRequest{}, map[string]string{"files/a": "content"}, http.StatusCreated)
+	if info = ts.wait(info.ID); info.State != StateSucceeded {
+		t.Errorf("got state %s (%s), want %s", info.State, info.Error, StateSucceeded)
+	}
+}
+
+func TestContextLimits(t *testing.T) {
+	ts := newTestServer(t)
+
+	size, entries := maxContextSize, maxContextEntries
+	t.Cleanup(func() {
+		maxContextSize, maxContextEntries = size, entries
+	})
+	maxContextSize, maxContextEntries = 8, 2
+
+	def := "Bootstrap: scratch\n"
+	ts.submit(testToken, def, BuildRequest{}, map[string]string{"a": "content"}, http.StatusCreated)
+	ts.submit(testToken, def, BuildRequest{}, map[string]string{"a": "content", "b": "content"}, http.StatusBadRequest)
+	ts.submit(testToken, def, BuildRequest{}, map[string]string{"a": "a", "b": "b", "c": "c"}, http.StatusBadRequest)
+}
+
+func TestFilesFromStage(t *testing.T) {
+	ts := newTestServer(t)
+
+	// %files sections copying from other stages don't read the host
+	def := "Bootstrap: scratch\nStage: one\n\nBootstrap: scratch\nStage: two\n%files from one\n\t/etc/a /a\n"
+	info := ts.submit(testToken, def, BuildRequest{}, nil, http.StatusCreated)
+	if info = ts.wait(info.ID); info.State != StateSucceeded {
+		t.Errorf("got state %s (%s), want %s", info.State, info.Error, StateSucceeded)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.submit("", "Bootstrap: scratch\n", BuildRequest{}, nil, http.StatusUnauthorized)
+	ts.submit("invalid", "Bootstrap: scratch\n", BuildRequest{}, nil, http.StatusUnauthorized)
+
+	info := ts.submit(testToken, "Bootstrap: scratch\n", BuildRequest{}, nil, http.StatusCreated)
+	ts.wait(info.ID)
+
+	// builds are only visible to their users
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		ts.call(method, "/v1/builds/"+info.ID, "", http.StatusUnauthorized)
+		ts.call(method, "/v1/builds/"+info.ID, otherToken, http.StatusNotFound)
+	}
+	ts.call(http.MethodGet, "/v1/builds/"+info.ID+"/image", otherToken, http.StatusNotFound)
+	ts.call(http.MethodGet, "/v1/builds/"+info.ID+"/log", otherToken, http.StatusNotFound)
+	ts.call(http.MethodGet, "/v1/builds/"+info.ID, testToken, http.StatusOK)
+
+	res := ts.do(http.MethodGet, "/v1/token-status", testToken, "", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("got token status %d, want %d", res.StatusCode, http.StatusOK)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package keyserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	jsonresp "github.com/sylabs/json-resp"
+)
+
+const (
+	// pendingDir is the directory of the identities pending verification.
+	pendingDir = "pending"
+	// verifyTimeout is the time given to verify an identity.
+	verifyTimeout = 48 * time.Hour
+	// hookTimeout is the time given to the verification hook to complete.
+	hookTimeout = time.Minute
+)
+
+// withIdentities returns a copy of e holding only the identities for which
+// keep returns true.
+func withIdentities(e *openpgp.Entity, keep func(*openpgp.Identity) bool) *openpgp.Entity {
+	ne := *e
+	ne.Identities = maps.Clone(e.Identities)
+	maps.DeleteFunc(ne.Identities, func(_ string, id *openpgp.Identity) bool { return !keep(id) })
+	return &ne
+}
+
+// merge merges e into the keyring, and returns a message describing the
+// change.
+func (s *Server) merge(e *openpgp.Entity) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed, err := s.keyring.MergePubKey(e)
+	if err != nil {
+		return "", err
+	}
+	if !changed {
+		return fmt.Sprintf("Key %X unchanged", e.PrimaryKey.Fingerprint), nil
+	}
+	sylog.Infof("Key %X added or updated", e.PrimaryKey.Fingerprint)
+	return fmt.Sprintf("Key %X added or updated", e.PrimaryKey.Fingerprint), nil
+}
+
+// handleAdd adds the keys of the keytext form field to the keyring, once
+// their new identities are verified if a verification hook is set.
+func (s *Server) handleAdd(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.ReadOnly {
+		jsonresp.WriteError(w, "keyserver is read-only", http.StatusForbidden)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxKeySize)
+	if err := r.ParseForm(); err != nil {
+		jsonresp.WriteError(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(r.PostForm.Get("keytext")))
+	if err == nil && len(el) == 0 {
+		err = errors.New("no key found")
+	}
+	if err != nil {
+		jsonresp.WriteError(w, fmt.Sprintf("invalid key text: %v", err), http.StatusBadRequest)
+		return
+	}
+	for _, e := range el {
+		if e.PrivateKey != nil {
+			jsonresp.WriteError(w, "private keys are not accepted", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var msgs []string
+	for _, e := range el {
+		if s.cfg.VerifyHook != "" {
+			m, err := s.addVerified(r, e)
+			if err != nil {
+				sylog.Errorf("While adding key %X: %v", e.PrimaryKey.Fingerprint, err)
+				jsonresp.WriteError(w, fmt.Sprintf("could not add key %X", e.PrimaryKey.Fingerprint), http.StatusInternalServerError)
+				return
+			}
+			msgs = append(msgs, m...)
+			continue
+		}
+
+		if len(e.Identities) == 0 {
+			msgs = append(msgs, fmt.Sprintf("Key %X ignored, it has no identity", e.PrimaryKey.Fingerprint))
+			continue
+		}
+		m, err := s.merge(e)
+		if err != nil {
+			sylog.Errorf("While adding key %X: %v", e.PrimaryKey.Fingerprint, err)
+			jsonresp.WriteError(w, fmt.Sprintf("could not add key %X", e.PrimaryKey.Fingerprint), http.StatusInternalServerError)
+			return
+		}
+		msgs = append(msgs, m)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, strings.Join(msgs, "\n"))
+}
+
+// published returns the key of the keyring with the fingerprint of e, if
+// any.
+func (s *Server) published(e *openpgp.Entity) (*openpgp.Entity, error) {
+	el, err := s.keys()
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range el {
+		if bytes.Equal(k.PrimaryKey.Fingerprint, e.PrimaryKey.Fingerprint) {
+			return k, nil
+		}
+	}
+	return nil, nil
+}
+
+// addVerified merges e into the keyring if already published, with its
+// published identities only, and sends the verification links of its new
+// identities with an email address. It returns messages describing the
+// changes.
+func (s *Server) addVerified(r *http.Request, e *openpgp.Entity) ([]string, error) {
+	var msgs []string
+
+	pub, err := s.published(e)
+	if err != nil {
+		return nil, err
+	}
+	if pub != nil {
+		// revocations, subkeys and signatures of published keys need no
+		// verification
+		m, err := s.merge(withIdentities(e, func(id *openpgp.Identity) bool {
+			return pub.Identities[id.Name] != nil
+		}))
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+
+	for name, id := range e.Identities {
+		if pub != nil && pub.Identities[name] != nil {
+			continue
+		}
+		if id.UserId.Email == "" {
+			msgs = append(msgs, fmt.Sprintf("Identity %q of key %X ignored, it has no email address to verify", name, e.PrimaryKey.Fingerprint))
+			continue
+		}
+		if err := s.sendVerification(r, withIdentities(e, func(i *openpgp.Identity) bool { return i == id }), id.UserId.Email); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, fmt.Sprintf("Verification sent to %s for key %X", id.UserId.Email, e.PrimaryKey.Fingerprint))
+	}
+	return msgs, nil
+}
+
+// removeExpired removes the identities pending verification for too long.
+func (s *Server) removeExpired() {
+	entries, err := os.ReadDir(filepath.Join(s.cfg.Dir, pendingDir))
+	if err != nil {
+		return
+	}
+	for _, de := range entries {
+		if fi, err := de.Info(); err == nil && time.Since(fi.ModTime()) > verifyTimeout {
+			os.Remove(filepath.Join(s.cfg.Dir, pendingDir, de.Name()))
+		}
+	}
+}
+
+// sendVerification stores e, holding an identity with email, until verified
+// with the link sent by the verification hook.
+func (s *Server) sendVerification(r *http.Request, e *openpgp.Entity, email string) error {
+	s.removeExpired()
+
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+
+	path := filepath.Join(s.cfg.Dir, pendingDir, token)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	aw, err := armor.Encode(f, openpgp.PublicKeyType, nil)
+	if err == nil {
+		err = e.Serialize(aw)
+	}
+	if err == nil {
+		err = aw.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	link := s.baseURL(r) + "/pks/verify?" + url.Values{"token": {token}}.Encode()
+	fp := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+
+	ctx, cancel := context.WithTimeout(r.Context(), hookTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, s.cfg.VerifyHook, email, fp, link).CombinedOutput()
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("verification hook failed: %w: %s", err, out)
+	}
+	sylog.Infof("Verification of %s for key %s sent", email, fp)
+	return nil
+}
+
+// handleVerify publishes the identity verified by the token of the request.
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.VerifyHook == "" || s.cfg.ReadOnly {
+		http.NotFound(w, r)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if _, err := hex.DecodeString(token); err != nil || len(token) != 64 {
+		jsonresp.WriteError(w, "invalid token", http.StatusBadRequest)
+		return
+	}
+	path := filepath.Join(s.cfg.Dir, pendingDir, token)
+
+	fi, err := os.Stat(path)
+	if err == nil && time.Since(fi.ModTime()) > verifyTimeout {
+		os.Remove(path)
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		jsonresp.WriteError(w, "unknown or expired token", http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		jsonresp.WriteError(w, "unknown or expired token", http.StatusNotFound)
+		return
+	}
+	el, err := openpgp.ReadArmoredKeyRing(f)
+	f.Close()
+	if err != nil || len(el) != 1 {
+		sylog.Errorf("While reading pending key %s: %v", path, err)
+		jsonresp.WriteError(w, "invalid pending key", http.StatusInternalServerError)
+		return
+	}
+
+	m, err := s.merge(el[0])
+	if err != nil {
+		sylog.Errorf("While adding key %X: %v", el[0].PrimaryKey.Fingerprint, err)
+		jsonresp.WriteError(w, "could not add key", http.StatusInternalServerError)
+		return
+	}
+	os.Remove(path)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, m)
+}
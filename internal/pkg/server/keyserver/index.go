@@ -0,0 +1,88 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package keyserver
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/apptainer/apptainer/internal/pkg/sypgp"
+)
+
+// escapeField percent-encodes the characters of s which can't appear in a
+// field of a machine readable index.
+func escapeField(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == ':' || c == '%' || c == '+' || c < 0x20 || c == 0x7f {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// unixTime returns the field of t in a machine readable index.
+func unixTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return fmt.Sprint(t.Unix())
+}
+
+// writeIndex writes the machine readable index of keys to w, as described in
+// https://tools.ietf.org/html/draft-shaw-openpgp-hkp-00#section-5.2.
+func writeIndex(w io.Writer, keys openpgp.EntityList, now time.Time) {
+	fmt.Fprintf(w, "info:1:%d\n", len(keys))
+
+	for _, e := range keys {
+		var expiry time.Time
+		if t, ok := sypgp.KeyExpiry(e); ok {
+			expiry = t
+		}
+		flags := ""
+		if e.Revoked(now) {
+			flags += "r"
+		}
+		if !expiry.IsZero() && now.After(expiry) {
+			flags += "e"
+		}
+		bits, _ := e.PrimaryKey.BitLength()
+		fmt.Fprintf(w, "pub:%X:%d:%d:%s:%s:%s\n",
+			e.PrimaryKey.Fingerprint, e.PrimaryKey.PubKeyAlgo, bits,
+			unixTime(e.PrimaryKey.CreationTime), unixTime(expiry), flags)
+
+		names := make([]string, 0, len(e.Identities))
+		for name := range e.Identities {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			id := e.Identities[name]
+			var created, expires time.Time
+			if sig := id.SelfSignature; sig != nil {
+				created = sig.CreationTime
+				if sig.SigLifetimeSecs != nil && *sig.SigLifetimeSecs != 0 {
+					expires = created.Add(time.Duration(*sig.SigLifetimeSecs) * time.Second)
+				}
+			}
+			flags := ""
+			if id.Revoked(now) {
+				flags = "r"
+			}
+			fmt.Fprintf(w, "uid:%s:%s:%s:%s\n", escapeField(name), unixTime(created), unixTime(expires), flags)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package keyserver implements an HKP keyserver, serving the lookup and add
+// operations used by the key commands, and storing the keys in a public
+// keyring.
+package keyserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/apptainer/apptainer/internal/pkg/server"
+	"github.com/apptainer/apptainer/internal/pkg/sypgp"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	jsonresp "github.com/sylabs/json-resp"
+)
+
+const (
+	// maxKeySize is the maximum size of add requests.
+	maxKeySize = 8 << 20
+	// defaultPageSize is the number of keys indexed per page, unless the
+	// client asks for less.
+	defaultPageSize = 256
+)
+
+// Config is the configuration of a keyserver.
+type Config struct {
+	// Dir is the directory storing the keyring, and the keys pending
+	// verification.
+	Dir string
+	// ReadOnly rejects the keys added.
+	ReadOnly bool
+	// VerifyHook is the command run to send the verification link of each
+	// new identity of the keys added, with the email address, the key
+	// fingerprint and the link as arguments. Identities are published once
+	// verified if set, otherwise they are published when added.
+	VerifyHook string
+	// URL is the base URL advertised in verification links, derived from the
+	// requests if empty.
+	URL string
+}
+
+// Server serves the HKP lookup and add operations.
+type Server struct {
+	cfg     Config
+	keyring *sypgp.Handle
+
+	mu sync.RWMutex
+}
+
+// New returns a keyserver of the keyring stored in cfg.Dir, creating it if
+// needed.
+func New(cfg Config) (*Server, error) {
+	keyring := sypgp.NewHandle(cfg.Dir)
+	if err := keyring.PathsCheck(); err != nil {
+		return nil, fmt.Errorf("while creating keyring: %w", err)
+	}
+	if cfg.VerifyHook != "" {
+		if err := os.MkdirAll(filepath.Join(cfg.Dir, pendingDir), 0o700); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Server{
+		cfg:     cfg,
+		keyring: keyring,
+	}, nil
+}
+
+// Handler returns the HTTP handler of the keyserver.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /pks/lookup", s.handleLookup)
+	mux.HandleFunc("POST /pks/add", s.handleAdd)
+	mux.HandleFunc("GET /pks/verify", s.handleVerify)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sylog.Debugf("%s %s %s", r.RemoteAddr, r.Method, r.URL.Path)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// baseURL returns the base URL of the server advertised to the client of r.
+func (s *Server) baseURL(r *http.Request) string {
+	return server.BaseURL(s.cfg.URL, r)
+}
+
+// keys returns the keys of the keyring.
+func (s *Server) keys() (openpgp.EntityList, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.keyring.LoadPubKeyring()
+}
+
+// matchKeyID returns the keys of el whose primary key or a subkey has the
+// hex encoded fingerprint, 64-bit or 32-bit key ID id.
+func matchKeyID(el openpgp.EntityList, id string) openpgp.EntityList {
+	b, err := hex.DecodeString(id)
+	if err != nil {
+		return nil
+	}
+
+	var match func(k *packet.PublicKey) bool
+	switch len(b) {
+	case 4:
+		id := binary.BigEndian.Uint32(b)
+		match = func(k *packet.PublicKey) bool { return uint32(k.KeyId) == id }
+	case 8:
+		id := binary.BigEndian.Uint64(b)
+		match = func(k *packet.PublicKey) bool { return k.KeyId == id }
+	case 20, 32:
+		match = func(k *packet.PublicKey) bool { return bytes.Equal(k.Fingerprint, b) }
+	default:
+		return nil
+	}
+
+	var keys openpgp.EntityList
+	for _, e := range el {
+		found := match(e.PrimaryKey)
+		for _, sk := range e.Subkeys {
+			found = found || match(sk.PublicKey)
+		}
+		if found {
+			keys = append(keys, e)
+		}
+	}
+	return keys
+}
+
+// matchText returns the keys of el with a user ID containing text, or with
+// a user ID or email address equal to text if exact is set.
+func matchText(el openpgp.EntityList, text string, exact bool) openpgp.EntityList {
+	text = strings.ToLower(text)
+
+	var keys openpgp.EntityList
+	for _, e := range el {
+		for _, id := range e.Identities {
+			name := strings.ToLower(id.Name)
+			email := strings.ToLower(id.UserId.Email)
+			if exact && (name == text || email == text) || !exact && strings.Contains(name, text) {
+				keys = append(keys, e)
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// search returns the keys of el matching search, a key ID or fingerprint
+// prefixed with 0x, or text.
+func search(el openpgp.EntityList, search string, exact bool) openpgp.EntityList {
+	if len(search) > 2 && strings.EqualFold(search[:2], "0x") {
+		return matchKeyID(el, search[2:])
+	}
+	return matchText(el, search, exact)
+}
+
+// handleLookup serves the get, index and vindex operations. Indexes are
+// machine readable.
+func (s *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	op := q.Get("op")
+	if q.Get("search") == "" {
+		jsonresp.WriteError(w, "search required", http.StatusBadRequest)
+		return
+	}
+	if op != "get" && op != "index" && op != "vindex" {
+		jsonresp.WriteError(w, fmt.Sprintf("operation %q not implemented", op), http.StatusNotImplemented)
+		return
+	}
+
+	el, err := s.keys()
+	if err != nil {
+		sylog.Errorf("While loading keyring: %v", err)
+		jsonresp.WriteError(w, "could not load keys", http.StatusInternalServerError)
+		return
+	}
+	keys := search(el, q.Get("search"), q.Get("exact") == "on")
+	if len(keys) == 0 {
+		jsonresp.WriteError(w, "no matching keys found", http.StatusNotFound)
+		return
+	}
+
+	if op == "get" {
+		w.Header().Set("Content-Type", "application/pgp-keys")
+		aw, err := armor.Encode(w, openpgp.PublicKeyType, nil)
+		if err != nil {
+			return
+		}
+		for _, e := range keys {
+			if err := e.Serialize(aw); err != nil {
+				sylog.Errorf("While serializing key %X: %v", e.PrimaryKey.Fingerprint, err)
+				return
+			}
+		}
+		aw.Close()
+		return
+	}
+
+	// the page token is the offset of the page
+	offset, _ := strconv.Atoi(q.Get("x-pagetoken"))
+	size, err := strconv.Atoi(q.Get("x-pagesize"))
+	if err != nil || size <= 0 || size > defaultPageSize {
+		size = defaultPageSize
+	}
+	offset = min(max(offset, 0), len(keys))
+	end := min(offset+size, len(keys))
+	if end < len(keys) {
+		w.Header().Set("X-HKP-Next-Page-Token", strconv.Itoa(end))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writeIndex(w, keys[offset:end], time.Now())
+}
@@ -0,0 +1,379 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package keyserver
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/apptainer/container-key-client/client"
+)
+
+var testConfig = &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+
+// newTestKey returns a new key with an identity for name and email.
+func newTestKey(t *testing.T, name, email string) *openpgp.Entity {
+	t.Helper()
+
+	e, err := openpgp.NewEntity(name, "", email, testConfig)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return e
+}
+
+// armored returns the armored public key of e.
+func armored(t *testing.T, e *openpgp.Entity) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// newTestClient starts a keyserver of cfg, and returns a client of it and its
+// URL.
+func newTestClient(t *testing.T, cfg Config) (*client.Client, string) {
+	t.Helper()
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	c, err := client.NewClient(client.OptBaseURL(ts.URL), client.OptHTTPClient(ts.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, ts.URL
+}
+
+// getKey returns the key with fingerprint fp, or nil if not found.
+func getKey(t *testing.T, c *client.Client, fp []byte) *openpgp.Entity {
+	t.Helper()
+
+	kt, err := c.GetKey(context.Background(), fp)
+	var httpErr *client.HTTPError
+	if errors.As(err, &httpErr) && httpErr.Code() == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("failed to get key: %v", err)
+	}
+	el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(kt))
+	if err != nil {
+		t.Fatalf("failed to read key: %v", err)
+	}
+	if len(el) != 1 {
+		t.Fatalf("got %d keys, want 1", len(el))
+	}
+	return el[0]
+}
+
+func TestLookup(t *testing.T) {
+	c, _ := newTestClient(t, Config{Dir: t.TempDir()})
+	ctx := context.Background()
+
+	alice := newTestKey(t, "Alice", "alice@example.com")
+	if err := alice.AddSigningSubkey(testConfig); err != nil {
+		t.Fatal(err)
+	}
+	bob := newTestKey(t, "Bob: the builder", "bob@example.com")
+	for _, e := range []*openpgp.Entity{alice, bob} {
+		if err := c.PKSAdd(ctx, armored(t, e)); err != nil {
+			t.Fatalf("failed to add key: %v", err)
+		}
+	}
+
+	if e := getKey(t, c, alice.PrimaryKey.Fingerprint); e == nil || len(e.Subkeys) != 2 {
+		t.Errorf("got key %v, want key with 2 subkeys", e)
+	}
+
+	tests := []struct {
+		name    string
+		search  string
+		exact   bool
+		want    []*openpgp.Entity
+		wantErr int
+	}{
+		{name: "Fingerprint", search: fmt.Sprintf("0x%X", bob.PrimaryKey.Fingerprint), want: []*openpgp.Entity{bob}},
+		{name: "KeyID", search: fmt.Sprintf("0x%016X", alice.PrimaryKey.KeyId), want: []*openpgp.Entity{alice}},
+		{name: "ShortKeyID", search: fmt.Sprintf("0x%08X", uint32(alice.PrimaryKey.KeyId)), want: []*openpgp.Entity{alice}},
+		{name: "SubkeyID", search: fmt.Sprintf("0x%016X", alice.Subkeys[1].PublicKey.KeyId), want: []*openpgp.Entity{alice}},
+		{name: "Text", search: "EXAMPLE.com", want: []*openpgp.Entity{alice, bob}},
+		{name: "ExactEmail", search: "bob@example.com", exact: true, want: []*openpgp.Entity{bob}},
+		{name: "ExactPartial", search: "example.com", exact: true, wantErr: http.StatusNotFound},
+		{name: "NotFound", search: "carol", wantErr: http.StatusNotFound},
+		{name: "BadKeyID", search: "0xZZ", wantErr: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kt, err := c.PKSLookup(ctx, nil, tt.search, client.OperationGet, false, tt.exact, nil)
+			if tt.wantErr != 0 {
+				var httpErr *client.HTTPError
+				if !errors.As(err, &httpErr) || httpErr.Code() != tt.wantErr {
+					t.Fatalf("got error %v, want code %d", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to lookup: %v", err)
+			}
+			el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(kt))
+			if err != nil {
+				t.Fatalf("failed to read keys: %v", err)
+			}
+			if len(el) != len(tt.want) {
+				t.Fatalf("got %d keys, want %d", len(el), len(tt.want))
+			}
+			for i, e := range el {
+				if !bytes.Equal(e.PrimaryKey.Fingerprint, tt.want[i].PrimaryKey.Fingerprint) {
+					t.Errorf("got key %X, want %X", e.PrimaryKey.Fingerprint, tt.want[i].PrimaryKey.Fingerprint)
+				}
+			}
+		})
+	}
+
+	t.Run("Index", func(t *testing.T) {
+		pd := &client.PageDetails{Size: 1}
+		var pages []string
+		for {
+			idx, err := c.PKSLookup(ctx, pd, "example", client.OperationIndex, true, false, []string{client.OptionMachineReadable})
+			if err != nil {
+				t.Fatalf("failed to lookup index: %v", err)
+			}
+			pages = append(pages, idx)
+			if pd.Token == "" {
+				break
+			}
+		}
+		if len(pages) != 2 {
+			t.Fatalf("got %d pages, want 2", len(pages))
+		}
+		bits, _ := bob.PrimaryKey.BitLength()
+		want := fmt.Sprintf("info:1:1\npub:%X:%d:%d:%d::\nuid:Bob%%3A the builder <bob@example.com>:%d::\n",
+			bob.PrimaryKey.Fingerprint, bob.PrimaryKey.PubKeyAlgo, bits, bob.PrimaryKey.CreationTime.Unix(),
+			bob.Identities["Bob: the builder <bob@example.com>"].SelfSignature.CreationTime.Unix())
+		if pages[1] != want {
+			t.Errorf("got index %q, want %q", pages[1], want)
+		}
+	})
+
+	t.Run("UnknownOperation", func(t *testing.T) {
+		_, err := c.PKSLookup(ctx, nil, "alice", "stats", false, false, nil)
+		var httpErr *client.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Code() != http.StatusNotImplemented {
+			t.Errorf("got error %v, want code %d", err, http.StatusNotImplemented)
+		}
+	})
+}
+
+func TestAdd(t *testing.T) {
+	c, _ := newTestClient(t, Config{Dir: t.TempDir()})
+	ctx := context.Background()
+
+	e := newTestKey(t, "Alice", "alice@example.com")
+	if err := c.PKSAdd(ctx, armored(t, e)); err != nil {
+		t.Fatalf("failed to add key: %v", err)
+	}
+
+	if err := e.RevokeKey(packet.KeyCompromised, "lost", testConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PKSAdd(ctx, armored(t, e)); err != nil {
+		t.Fatalf("failed to add revoked key: %v", err)
+	}
+	if got := getKey(t, c, e.PrimaryKey.Fingerprint); got == nil || !got.Revoked(time.Now()) {
+		t.Errorf("got key %v, want revoked key", got)
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	err = c.PKSAdd(ctx, buf.String())
+	var httpErr *client.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code() != http.StatusBadRequest {
+		t.Errorf("got error %v adding private key, want code %d", err, http.StatusBadRequest)
+	}
+}
+
+// revokeIdentity adds a revocation of the identity id of e, as read from
+// a key.
+func revokeIdentity(t *testing.T, e *openpgp.Entity, id string) {
+	t.Helper()
+
+	reason := packet.UserIDNotValid
+	sig := &packet.Signature{
+		Version:           e.PrimaryKey.Version,
+		SigType:           packet.SigTypeCertificationRevocation,
+		PubKeyAlgo:        e.PrimaryKey.PubKeyAlgo,
+		Hash:              crypto.SHA256,
+		CreationTime:      time.Now(),
+		IssuerKeyId:       &e.PrimaryKey.KeyId,
+		IssuerFingerprint: e.PrimaryKey.Fingerprint,
+		RevocationReason:  &reason,
+	}
+	if err := sig.SignUserId(id, e.PrimaryKey, e.PrivateKey, testConfig); err != nil {
+		t.Fatalf("failed to revoke identity: %v", err)
+	}
+	ident := e.Identities[id]
+	ident.Signatures = append(ident.Signatures, sig)
+	ident.Revocations = append(ident.Revocations, sig)
+}
+
+func TestAddIdentityRevocation(t *testing.T) {
+	c, _ := newTestClient(t, Config{Dir: t.TempDir()})
+	ctx := context.Background()
+
+	e := newTestKey(t, "Alice", "alice@example.com")
+	if err := e.AddUserId("Alice", "", "alice@example.org", testConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PKSAdd(ctx, armored(t, e)); err != nil {
+		t.Fatalf("failed to add key: %v", err)
+	}
+
+	// the update only holds the revocation of an identity
+	const revoked = "Alice <alice@example.org>"
+	revokeIdentity(t, e, revoked)
+	if err := c.PKSAdd(ctx, armored(t, e)); err != nil {
+		t.Fatalf("failed to add identity revocation: %v", err)
+	}
+
+	got := getKey(t, c, e.PrimaryKey.Fingerprint)
+	if got == nil {
+		t.Fatal("got no key")
+	}
+	if id, ok := got.Identities[revoked]; !ok || !id.Revoked(time.Now()) {
+		t.Errorf("identity %s not revoked", revoked)
+	}
+	if id, ok := got.Identities["Alice <alice@example.com>"]; !ok || id.Revoked(time.Now()) {
+		t.Errorf("identity alice@example.com missing or revoked")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	e := newTestKey(t, "Alice", "alice@example.com")
+	if _, err := New(Config{Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := newTestClient(t, Config{Dir: dir, ReadOnly: true})
+	err := c.PKSAdd(context.Background(), armored(t, e))
+	var httpErr *client.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code() != http.StatusForbidden {
+		t.Errorf("got error %v, want code %d", err, http.StatusForbidden)
+	}
+}
+
+func TestVerifyHook(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "hook.out")
+	hook := filepath.Join(dir, "hook.sh")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %s\n", out)
+	if err := os.WriteFile(hook, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	c, url := newTestClient(t, Config{Dir: filepath.Join(dir, "keys"), VerifyHook: hook})
+	ctx := context.Background()
+
+	// verify publishes the identities of the links sent by the hook
+	verify := func(wantLinks int) {
+		t.Helper()
+		b, err := os.ReadFile(out)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		os.Remove(out)
+		lines := strings.Fields(string(b))
+		if len(lines) != 3*wantLinks {
+			t.Fatalf("got hook arguments %q, want %d links", lines, wantLinks)
+		}
+		for i := 2; i < len(lines); i += 3 {
+			res, err := http.Get(lines[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("got status %d verifying %s, want %d", res.StatusCode, lines[i], http.StatusOK)
+			}
+		}
+	}
+
+	e := newTestKey(t, "Alice", "alice@example.com")
+	if err := c.PKSAdd(ctx, armored(t, e)); err != nil {
+		t.Fatalf("failed to add key: %v", err)
+	}
+	if got := getKey(t, c, e.PrimaryKey.Fingerprint); got != nil {
+		t.Fatalf("got key published before verification")
+	}
+	verify(1)
+	if got := getKey(t, c, e.PrimaryKey.Fingerprint); got == nil {
+		t.Fatalf("got no key published after verification")
+	}
+
+	if err := e.AddUserId("Alice", "", "alice@example.org", testConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddSigningSubkey(testConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PKSAdd(ctx, armored(t, e)); err != nil {
+		t.Fatalf("failed to add key: %v", err)
+	}
+	if got := getKey(t, c, e.PrimaryKey.Fingerprint); len(got.Identities) != 1 || len(got.Subkeys) != 2 {
+		t.Errorf("got key with %d identities and %d subkeys, want 1 identity and 2 subkeys", len(got.Identities), len(got.Subkeys))
+	}
+	verify(1)
+	if got := getKey(t, c, e.PrimaryKey.Fingerprint); len(got.Identities) != 2 {
+		t.Errorf("got key with %d identities after verification, want 2", len(got.Identities))
+	}
+
+	res, err := http.Get(url + "/pks/verify?token=" + strings.Repeat("0", 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("got status %d verifying unknown token, want %d", res.StatusCode, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	jsonresp "github.com/sylabs/json-resp"
+)
+
+// maxRequestSize is the maximum size of JSON request bodies.
+const maxRequestSize = 1 << 20
+
+// readRequest decodes the JSON body of r into v.
+func readRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(v); err != nil {
+		jsonresp.WriteError(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, _ *http.Request) {
+	jsonresp.WriteResponse(w, struct {
+		Version    string `json:"version"`
+		APIVersion string `json:"apiVersion"`
+	}{s.cfg.Version, apiVersion}, http.StatusOK)
+}
+
+// handleConfig advertises the server as the library and token services of
+// the remote endpoint.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	base := s.baseURL(r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]map[string]string{
+		"libraryAPI": {"uri": base},
+		"tokenAPI":   {"uri": base},
+	})
+}
+
+func (s *Server) handleTokenStatus(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.user(r); !ok {
+		jsonresp.WriteError(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	jsonresp.WriteResponse(w, struct {
+		Status string `json:"status"`
+	}{"valid"}, http.StatusOK)
+}
+
+func (s *Server) handleGetEntity(w http.ResponseWriter, r *http.Request, _ string) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	e, err := s.db.entity(r.PathValue("name"))
+	if err != nil {
+		writeError(w, fmt.Errorf("entity %q: %w", r.PathValue("name"), err))
+		return
+	}
+	jsonresp.WriteResponse(w, e, http.StatusOK)
+}
+
+func (s *Server) handleCreateEntity(w http.ResponseWriter, r *http.Request, user string) {
+	var req Entity
+	if !readRequest(w, r, &req) {
+		return
+	}
+
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	e, err := s.db.createEntity(req.Name, req.Description, user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	sylog.Infof("User %s created entity %s", user, e.Name)
+	jsonresp.WriteResponse(w, e, http.StatusOK)
+}
+
+func (s *Server) handleGetCollection(w http.ResponseWriter, r *http.Request, user string) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	name := r.PathValue("entity") + "/" + r.PathValue("name")
+	c, err := s.db.collection(r.PathValue("entity"), r.PathValue("name"))
+	if err == nil && !s.db.readable(c.Private, c.EntityName, user) {
+		err = errNotFound
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("collection %q: %w", name, err))
+		return
+	}
+	jsonresp.WriteResponse(w, c, http.StatusOK)
+}
+
+func (s *Server) handleCreateCollection(w http.ResponseWriter, r *http.Request, user string) {
+	var req Collection
+	if !readRequest(w, r, &req) {
+		return
+	}
+
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	c, err := s.db.createCollection(req.Entity, req.Name, req.Description, req.Private, user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	sylog.Infof("User %s created collection %s/%s", user, c.EntityName, c.Name)
+	jsonresp.WriteResponse(w, c, http.StatusOK)
+}
+
+func (s *Server) handleGetContainer(w http.ResponseWriter, r *http.Request, user string) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	name := r.PathValue("entity") + "/" + r.PathValue("collection") + "/" + r.PathValue("name")
+	c, err := s.db.container(r.PathValue("entity"), r.PathValue("collection"), r.PathValue("name"))
+	if err == nil && !s.db.readable(c.Private, c.EntityName, user) {
+		err = errNotFound
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("container %q: %w", name, err))
+		return
+	}
+	jsonresp.WriteResponse(w, c, http.StatusOK)
+}
+
+func (s *Server) handleCreateContainer(w http.ResponseWriter, r *http.Request, user string) {
+	var req Container
+	if !readRequest(w, r, &req) {
+		return
+	}
+
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	c, err := s.db.createContainer(req.Collection, req.Name, req.Description, req.Private, user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	sylog.Infof("User %s created container %s/%s/%s", user, c.EntityName, c.CollectionName, c.Name)
+	jsonresp.WriteResponse(w, c, http.StatusOK)
+}
+
+// image returns the image of ref visible to user, with its tags. The
+// database must be locked.
+func (s *Server) image(ref, arch, user string) (*Image, error) {
+	img, err := s.db.resolveImage(ref, arch)
+	if err != nil {
+		return nil, err
+	}
+	if c := s.db.Containers[img.Container]; !s.db.readable(c.Private, c.EntityName, user) {
+		return nil, fmt.Errorf("image %q: %w", ref, errNotFound)
+	}
+	res := *img
+	res.Tags = s.db.imageTags(img)
+	return &res, nil
+}
+
+func (s *Server) handleGetImage(w http.ResponseWriter, r *http.Request, user string) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	img, err := s.image(r.PathValue("ref"), r.URL.Query().Get("arch"), user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonresp.WriteResponse(w, img, http.StatusOK)
+}
+
+func (s *Server) handleCreateImage(w http.ResponseWriter, r *http.Request, user string) {
+	var req Image
+	if !readRequest(w, r, &req) {
+		return
+	}
+
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	img, err := s.db.createImage(req.Container, req.Hash, req.Description, user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonresp.WriteResponse(w, img, http.StatusOK)
+}
+
+func (s *Server) handleDeleteImage(w http.ResponseWriter, r *http.Request, user string) {
+	ref := r.PathValue("ref")
+
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	img, err := s.db.resolveImage(ref, r.URL.Query().Get("arch"))
+	if err == nil {
+		err = s.db.authorize(img.EntityName, user)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	shared, err := s.db.deleteImage(img)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if img.Uploaded && !shared {
+		if err := os.Remove(s.blobPath(img.Hash)); err != nil && !os.IsNotExist(err) {
+			sylog.Warningf("While removing image file of %s: %v", ref, err)
+		}
+	}
+	sylog.Infof("User %s deleted image %s (%s)", user, ref, img.Hash)
+	jsonresp.WriteResponse(w, struct{}{}, http.StatusOK)
+}
+
+// blobPath returns the path of the file of the image with hash.
+func (s *Server) blobPath(hash string) string {
+	return filepath.Join(s.cfg.Dir, imagesDir, strings.TrimPrefix(hash, hashPrefix)+".sif")
+}
+
+// visibleContainer returns the container with ID id, if visible to user.
+func (s *Server) visibleContainer(id, user string) (*Container, error) {
+	c, ok := s.db.Containers[id]
+	if !ok || !s.db.readable(c.Private, c.EntityName, user) {
+		return nil, fmt.Errorf("container %q: %w", id, errNotFound)
+	}
+	return c, nil
+}
+
+func (s *Server) handleGetTags(w http.ResponseWriter, r *http.Request, user string) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	c, err := s.visibleContainer(r.PathValue("id"), user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonresp.WriteResponse(w, c.ImageTags, http.StatusOK)
+}
+
+func (s *Server) handleGetArchTags(w http.ResponseWriter, r *http.Request, user string) {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	c, err := s.visibleContainer(r.PathValue("id"), user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	jsonresp.WriteResponse(w, c.ArchTags, http.StatusOK)
+}
+
+func (s *Server) handleSetTag(w http.ResponseWriter, r *http.Request, user string) {
+	var req struct {
+		Tag     string
+		ImageID string
+	}
+	if !readRequest(w, r, &req) {
+		return
+	}
+	s.setTag(w, r.PathValue("id"), "", req.Tag, req.ImageID, user)
+}
+
+func (s *Server) handleSetArchTag(w http.ResponseWriter, r *http.Request, user string) {
+	var req struct {
+		Arch    string
+		Tag     string
+		ImageID string
+	}
+	if !readRequest(w, r, &req) {
+		return
+	}
+	if req.Arch == "" {
+		jsonresp.WriteError(w, "architecture required", http.StatusBadRequest)
+		return
+	}
+	s.setTag(w, r.PathValue("id"), req.Arch, req.Tag, req.ImageID, user)
+}
+
+func (s *Server) setTag(w http.ResponseWriter, containerID, arch, tag, imageID, user string) {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	if err := s.db.setTag(containerID, arch, tag, imageID, user); err != nil {
+		writeError(w, err)
+		return
+	}
+	c := s.db.Containers[containerID]
+	sylog.Infof("User %s tagged image %s of %s/%s/%s as %q", user, s.db.Images[imageID].Hash, c.EntityName, c.CollectionName, c.Name, tag)
+	jsonresp.WriteResponse(w, struct{}{}, http.StatusOK)
+}
+
+// SearchResults are the results of a search of the library.
+type SearchResults struct {
+	Entities    []*Entity     `json:"entity"`
+	Collections []*Collection `json:"collection"`
+	Containers  []*Container  `json:"container"`
+	Images      []*Image      `json:"image"`
+}
+
+// handleSearch returns the entities, collections, containers and uploaded
+// images whose name contains the value searched, optionally only images of
+// an architecture or signed ones.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request, user string) {
+	q := r.URL.Query()
+	value := strings.ToLower(q.Get("value"))
+	if len(value) < 3 {
+		jsonresp.WriteError(w, "search value must be at least 3 characters", http.StatusBadRequest)
+		return
+	}
+	arch := q.Get("arch")
+	signed := q.Get("signed") == "true"
+
+	match := func(name, description string) bool {
+		return strings.Contains(strings.ToLower(name), value) || strings.Contains(strings.ToLower(description), value)
+	}
+
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	res := SearchResults{
+		Entities:    []*Entity{},
+		Collections: []*Collection{},
+		Containers:  []*Container{},
+		Images:      []*Image{},
+	}
+	for _, e := range s.db.Entities {
+		if match(e.Name, e.Description) {
+			res.Entities = append(res.Entities, e)
+		}
+	}
+	for _, c := range s.db.Collections {
+		if s.db.readable(c.Private, c.EntityName, user) && match(c.Name, c.Description) {
+			res.Collections = append(res.Collections, c)
+		}
+	}
+	for _, c := range s.db.Containers {
+		if !s.db.readable(c.Private, c.EntityName, user) {
+			continue
+		}
+		if match(c.Name, c.Description) {
+			res.Containers = append(res.Containers, c)
+		}
+		for _, id := range c.Images {
+			img := s.db.Images[id]
+			if !img.Uploaded || !match(c.Name, img.Description) {
+				continue
+			}
+			if arch != "" && (img.Architecture == nil || *img.Architecture != arch) {
+				continue
+			}
+			if signed && (img.Signed == nil || !*img.Signed) {
+				continue
+			}
+			i := *img
+			i.Tags = s.db.imageTags(img)
+			res.Images = append(res.Images, &i)
+		}
+	}
+
+	sort.Slice(res.Entities, func(i, j int) bool { return res.Entities[i].Name < res.Entities[j].Name })
+	sort.Slice(res.Collections, func(i, j int) bool { return res.Collections[i].ID < res.Collections[j].ID })
+	sort.Slice(res.Containers, func(i, j int) bool { return res.Containers[i].ID < res.Containers[j].ID })
+	sort.Slice(res.Images, func(i, j int) bool { return res.Images[i].ID < res.Images[j].ID })
+
+	jsonresp.WriteResponse(w, res, http.StatusOK)
+}
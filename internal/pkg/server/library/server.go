@@ -0,0 +1,187 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package library implements a server of the subset of the library API used
+// to push, pull, search, tag and delete images, storing the images and their
+// metadata in a local directory.
+package library
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/apptainer/apptainer/internal/pkg/server"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	jsonresp "github.com/sylabs/json-resp"
+)
+
+const (
+	// hashPrefix prefixes the hex encoded SHA-256 hash of images.
+	hashPrefix = "sha256."
+	// apiVersion is the version of the library API served.
+	apiVersion = "2.0.0"
+
+	imagesDir  = "images"
+	uploadsDir = "uploads"
+)
+
+// Config is the configuration of a library server.
+type Config struct {
+	// Dir is the directory storing the images and their metadata.
+	Dir string
+	// Tokens maps the bearer tokens accepted by the server to the names of
+	// their users.
+	Tokens map[string]string
+	// URL is the base URL advertised to clients, derived from the requests
+	// if empty.
+	URL string
+	// Private requires a token to read images, otherwise only writing
+	// requires one.
+	Private bool
+	// Version is the version reported by the server.
+	Version string
+}
+
+// Server serves the library API.
+type Server struct {
+	cfg Config
+	db  *store
+
+	mu      sync.Mutex
+	uploads map[string]*upload
+}
+
+// New returns a server of the library stored in cfg.Dir, creating it if
+// needed.
+func New(cfg Config) (*Server, error) {
+	for _, d := range []string{cfg.Dir, filepath.Join(cfg.Dir, imagesDir), filepath.Join(cfg.Dir, uploadsDir)} {
+		if err := os.MkdirAll(d, 0o700); err != nil {
+			return nil, fmt.Errorf("while creating library directory: %w", err)
+		}
+	}
+
+	// uploads don't survive restarts
+	staged, err := filepath.Glob(filepath.Join(cfg.Dir, uploadsDir, "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range staged {
+		os.RemoveAll(f)
+	}
+
+	db, err := openStore(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		cfg:     cfg,
+		db:      db,
+		uploads: make(map[string]*upload),
+	}, nil
+}
+
+// Handler returns the HTTP handler of the library API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /version", s.handleVersion)
+	mux.HandleFunc("GET /assets/config/config.prod.json", s.handleConfig)
+	mux.HandleFunc("GET /v1/token-status", s.handleTokenStatus)
+
+	mux.HandleFunc("GET /v1/entities/{name}", s.read(s.handleGetEntity))
+	mux.HandleFunc("POST /v1/entities", s.write(s.handleCreateEntity))
+	mux.HandleFunc("GET /v1/collections/{entity}/{name}", s.read(s.handleGetCollection))
+	mux.HandleFunc("POST /v1/collections", s.write(s.handleCreateCollection))
+	mux.HandleFunc("GET /v1/containers/{entity}/{collection}/{name}", s.read(s.handleGetContainer))
+	mux.HandleFunc("POST /v1/containers", s.write(s.handleCreateContainer))
+
+	mux.HandleFunc("GET /v1/images/{ref...}", s.read(s.handleGetImage))
+	mux.HandleFunc("POST /v1/images", s.write(s.handleCreateImage))
+	mux.HandleFunc("DELETE /v1/images/{ref...}", s.write(s.handleDeleteImage))
+
+	mux.HandleFunc("GET /v1/tags/{id}", s.read(s.handleGetTags))
+	mux.HandleFunc("POST /v1/tags/{id}", s.write(s.handleSetTag))
+	mux.HandleFunc("GET /v2/tags/{id}", s.read(s.handleGetArchTags))
+	mux.HandleFunc("POST /v2/tags/{id}", s.write(s.handleSetArchTag))
+
+	mux.HandleFunc("GET /v1/search", s.read(s.handleSearch))
+
+	mux.HandleFunc("GET /v1/imagefile/{ref...}", s.read(s.handleDownload))
+	mux.HandleFunc("POST /v1/imagefile/{id}", s.write(s.handleLegacyUpload))
+	mux.HandleFunc("POST /v2/imagefile/{id}", s.write(s.handleUploadRequest))
+	mux.HandleFunc("PUT /v2/imagefile/{id}/_upload", s.handleUpload)
+	mux.HandleFunc("PUT /v2/imagefile/{id}/_complete", s.write(s.handleUploadComplete))
+	mux.HandleFunc("POST /v2/imagefile/{id}/_multipart", s.write(s.handleMultipartStart))
+	mux.HandleFunc("PUT /v2/imagefile/{id}/_multipart", s.write(s.handleMultipartPartRequest))
+	mux.HandleFunc("PUT /v2/imagefile/{id}/_part", s.handleMultipartPart)
+	mux.HandleFunc("PUT /v2/imagefile/{id}/_multipart_complete", s.write(s.handleMultipartComplete))
+	mux.HandleFunc("PUT /v2/imagefile/{id}/_multipart_abort", s.write(s.handleMultipartAbort))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sylog.Debugf("%s %s %s", r.RemoteAddr, r.Method, r.URL.Path)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// user returns the name of the user authenticated by the bearer token of r.
+func (s *Server) user(r *http.Request) (string, bool) {
+	return server.TokenUser(s.cfg.Tokens, r)
+}
+
+// userHandlerFunc is a handler of requests from the authenticated user, or
+// the anonymous user with an empty name.
+type userHandlerFunc func(w http.ResponseWriter, r *http.Request, user string)
+
+// read returns a handler calling h if the request may read the library.
+func (s *Server) read(h userHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := s.user(r)
+		if !ok && s.cfg.Private {
+			jsonresp.WriteError(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		h(w, r, user)
+	}
+}
+
+// write returns a handler calling h if the request may write to the
+// library.
+func (s *Server) write(h userHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := s.user(r)
+		if !ok {
+			jsonresp.WriteError(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		h(w, r, user)
+	}
+}
+
+// baseURL returns the base URL of the server advertised to the client of r.
+func (s *Server) baseURL(r *http.Request) string {
+	return server.BaseURL(s.cfg.URL, r)
+}
+
+// writeError writes err to w, with the status code matching it.
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusBadRequest
+	switch {
+	case errors.Is(err, errNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, os.ErrNotExist):
+		code = http.StatusNotFound
+	case errors.Is(err, errForbidden):
+		code = http.StatusForbidden
+	}
+	jsonresp.WriteError(w, err.Error(), code)
+}
@@ -0,0 +1,438 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apptainer/sif/v2/pkg/sif"
+	jsonresp "github.com/sylabs/json-resp"
+)
+
+const (
+	testToken  = "s3cr3t"
+	otherToken = "0th3r"
+)
+
+// testImage returns a SIF image of arch, signed by fingerprint fp if set,
+// and its hash.
+func testImage(t *testing.T, arch string, fp []byte) ([]byte, string) {
+	t.Helper()
+
+	part, err := sif.NewDescriptorInput(sif.DataPartition, bytes.NewReader([]byte(arch+" rootfs")),
+		sif.OptPartitionMetadata(sif.FsSquash, sif.PartPrimSys, arch),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dis := []sif.DescriptorInput{part}
+	if fp != nil {
+		sig, err := sif.NewDescriptorInput(sif.DataSignature, bytes.NewReader([]byte("signature")),
+			sif.OptLinkedID(1),
+			sif.OptSignatureMetadata(crypto.SHA256, fp),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dis = append(dis, sig)
+	}
+
+	buf := sif.NewBuffer(nil)
+	f, err := sif.CreateContainer(buf, sif.OptCreateWithDescriptors(dis...), sif.OptCreateDeterministic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.UnloadContainer(); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	return buf.Bytes(), hashPrefix + hex.EncodeToString(sum[:])
+}
+
+type testServer struct {
+	*httptest.Server
+	t   *testing.T
+	dir string
+}
+
+func newTestServer(t *testing.T, dir string, private bool) *testServer {
+	t.Helper()
+
+	s, err := New(Config{
+		Dir:     dir,
+		Tokens:  map[string]string{testToken: "alice", otherToken: "bob"},
+		Private: private,
+		Version: "1.0.0",
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return &testServer{Server: ts, t: t, dir: dir}
+}
+
+// do sends a request with body, encoded as JSON unless raw bytes, and
+// returns the response.
+func (ts *testServer) do(method, url, token string, body any) *http.Response {
+	ts.t.Helper()
+
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		r = bytes.NewReader(b)
+	default:
+		j, err := json.Marshal(b)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		r = bytes.NewReader(j)
+	}
+	if url[0] == '/' {
+		url = ts.URL + url
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	ts.t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+// call sends a request and decodes the data of the response into v,
+// failing the test if the status code isn't code.
+func (ts *testServer) call(method, url, token string, body any, code int, v any) {
+	ts.t.Helper()
+
+	res := ts.do(method, url, token, body)
+	if res.StatusCode != code {
+		b, _ := io.ReadAll(res.Body)
+		ts.t.Fatalf("%s %s: got status %d, want %d: %s", method, url, res.StatusCode, code, b)
+	}
+	if v != nil {
+		if err := jsonresp.ReadResponse(res.Body, v); err != nil {
+			ts.t.Fatalf("%s %s: %v", method, url, err)
+		}
+	}
+}
+
+// createContainer creates the container entity/collection/name.
+func (ts *testServer) createContainer(entity, collection, name string) *Container {
+	ts.t.Helper()
+
+	var e Entity
+	ts.call(http.MethodPost, "/v1/entities", testToken, Entity{Name: entity}, http.StatusOK, &e)
+	var col Collection
+	ts.call(http.MethodPost, "/v1/collections", testToken, Collection{Name: collection, Entity: e.ID}, http.StatusOK, &col)
+	var c Container
+	ts.call(http.MethodPost, "/v1/containers", testToken, Container{Name: name, Collection: col.ID}, http.StatusOK, &c)
+	return &c
+}
+
+// push uploads data as an image of the container c with the v2 upload API,
+// and tags it for arch.
+func (ts *testServer) push(c *Container, data []byte, hash, arch, tag string) *Image {
+	ts.t.Helper()
+
+	var img Image
+	ts.call(http.MethodPost, "/v1/images", testToken, Image{Hash: hash, Container: c.ID, Description: "test image"}, http.StatusOK, &img)
+
+	var up struct {
+		UploadURL string `json:"uploadURL"`
+	}
+	ts.call(http.MethodPost, "/v2/imagefile/"+img.ID, testToken, map[string]any{
+		"filesize":  len(data),
+		"sha256sum": hash[len(hashPrefix):],
+	}, http.StatusOK, &up)
+	// the upload URL is authorized by itself
+	if res := ts.do(http.MethodPut, up.UploadURL, "", data); res.StatusCode != http.StatusOK {
+		ts.t.Fatalf("upload failed with status %d", res.StatusCode)
+	}
+	var complete UploadImageComplete
+	ts.call(http.MethodPut, "/v2/imagefile/"+img.ID+"/_complete", testToken, struct{}{}, http.StatusOK, &complete)
+	if complete.Quota.QuotaUsageBytes < int64(len(data)) {
+		ts.t.Errorf("got quota usage %d, want at least %d", complete.Quota.QuotaUsageBytes, len(data))
+	}
+
+	ts.call(http.MethodPost, "/v2/tags/"+c.ID, testToken, map[string]string{
+		"Arch":    arch,
+		"Tag":     tag,
+		"ImageID": img.ID,
+	}, http.StatusOK, nil)
+	return &img
+}
+
+func TestPushPull(t *testing.T) {
+	ts := newTestServer(t, t.TempDir(), false)
+
+	c := ts.createContainer("alice", "tools", "alpine")
+	amd64, amd64Hash := testImage(t, "amd64", nil)
+	fp := bytes.Repeat([]byte{0xab}, 20)
+	arm64, arm64Hash := testImage(t, "arm64", fp)
+	ts.push(c, amd64, amd64Hash, "amd64", "latest")
+	ts.push(c, arm64, arm64Hash, "arm64", "latest")
+
+	// the same tag resolves by architecture
+	var img Image
+	ts.call(http.MethodGet, "/v1/images/alice/tools/alpine:latest?arch=arm64", "", nil, http.StatusOK, &img)
+	if img.Hash != arm64Hash || img.Architecture == nil || *img.Architecture != "arm64" {
+		t.Errorf("got image %s, want arm64 image %s", img.Hash, arm64Hash)
+	}
+	if img.Signed == nil || !*img.Signed || !reflect.DeepEqual(img.Fingerprints, []string{strings.ToUpper(hex.EncodeToString(fp))}) {
+		t.Errorf("got signed %v with fingerprints %v, want signed by %X", img.Signed, img.Fingerprints, fp)
+	}
+	if !reflect.DeepEqual(img.Tags, []string{"latest"}) {
+		t.Errorf("got tags %v, want [latest]", img.Tags)
+	}
+	ts.call(http.MethodGet, "/v1/images/alice/tools/alpine:"+amd64Hash, "", nil, http.StatusOK, &img)
+	if img.Hash != amd64Hash {
+		t.Errorf("got image %s, want %s", img.Hash, amd64Hash)
+	}
+	ts.call(http.MethodGet, "/v1/images/alice/tools/alpine:latest?arch=ppc64le", "", nil, http.StatusNotFound, nil)
+
+	res := ts.do(http.MethodGet, "/v1/imagefile/alice/tools/alpine:latest?arch=amd64", "", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("download failed with status %d", res.StatusCode)
+	}
+	if b, _ := io.ReadAll(res.Body); !bytes.Equal(b, amd64) {
+		t.Errorf("downloaded image doesn't match pushed image")
+	}
+
+	var tags map[string]map[string]string
+	ts.call(http.MethodGet, "/v2/tags/"+c.ID, "", nil, http.StatusOK, &tags)
+	if len(tags) != 2 || tags["amd64"]["latest"] == "" || tags["arm64"]["latest"] == "" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+
+	var sr SearchResults
+	ts.call(http.MethodGet, "/v1/search?value=alp&arch=arm64&signed=true", "", nil, http.StatusOK, &sr)
+	if len(sr.Containers) != 1 || len(sr.Images) != 1 || sr.Images[0].Hash != arm64Hash {
+		t.Errorf("unexpected search results %+v", sr)
+	}
+	ts.call(http.MethodGet, "/v1/search?value=alp&arch=amd64&signed=true", "", nil, http.StatusOK, &sr)
+	if len(sr.Images) != 0 {
+		t.Errorf("unexpected search results %+v", sr)
+	}
+
+	ts.call(http.MethodDelete, "/v1/images/alice/tools/alpine:latest?arch=amd64", "", nil, http.StatusUnauthorized, nil)
+	ts.call(http.MethodDelete, "/v1/images/alice/tools/alpine:latest?arch=amd64", testToken, nil, http.StatusOK, nil)
+	ts.call(http.MethodGet, "/v1/imagefile/alice/tools/alpine:latest?arch=amd64", "", nil, http.StatusNotFound, nil)
+	ts.call(http.MethodGet, "/v1/imagefile/alice/tools/alpine:latest?arch=arm64", "", nil, http.StatusOK, nil)
+}
+
+func TestUploadChecksum(t *testing.T) {
+	ts := newTestServer(t, t.TempDir(), false)
+
+	c := ts.createContainer("alice", "tools", "alpine")
+	data, hash := testImage(t, "amd64", nil)
+	other, _ := testImage(t, "arm64", nil)
+
+	var img Image
+	ts.call(http.MethodPost, "/v1/images", testToken, Image{Hash: hash, Container: c.ID}, http.StatusOK, &img)
+
+	// legacy upload of a file not matching the image hash
+	ts.call(http.MethodPost, "/v1/imagefile/"+img.ID, testToken, other, http.StatusBadRequest, nil)
+	// legacy upload of a file not being a SIF image
+	ts.call(http.MethodPost, "/v1/imagefile/"+img.ID, testToken, []byte("not an image"), http.StatusBadRequest, nil)
+	ts.call(http.MethodGet, "/v1/imagefile/alice/tools/alpine:"+hash, "", nil, http.StatusNotFound, nil)
+
+	ts.call(http.MethodPost, "/v1/imagefile/"+img.ID, testToken, data, http.StatusOK, nil)
+	ts.call(http.MethodGet, "/v1/imagefile/alice/tools/alpine:"+hash, "", nil, http.StatusOK, nil)
+}
+
+func TestMultipartUpload(t *testing.T) {
+	ts := newTestServer(t, t.TempDir(), false)
+
+	c := ts.createContainer("alice", "tools", "alpine")
+	data, hash := testImage(t, "amd64", nil)
+	sum := sha256.Sum256(data)
+
+	var img Image
+	ts.call(http.MethodPost, "/v1/images", testToken, Image{Hash: hash, Container: c.ID}, http.StatusOK, &img)
+
+	var start struct {
+		UploadID   string `json:"uploadID"`
+		TotalParts int    `json:"totalParts"`
+		PartSize   int64  `json:"partSize"`
+	}
+	ts.call(http.MethodPost, "/v2/imagefile/"+img.ID+"/_multipart", testToken, map[string]any{"filesize": len(data)}, http.StatusOK, &start)
+	if start.TotalParts != 1 {
+		t.Fatalf("got %d parts, want 1", start.TotalParts)
+	}
+
+	var part struct {
+		PresignedURL string `json:"presignedURL"`
+	}
+	ts.call(http.MethodPut, "/v2/imagefile/"+img.ID+"/_multipart", testToken, map[string]any{
+		"uploadID":   start.UploadID,
+		"partSize":   len(data),
+		"partNumber": 1,
+		"sha256sum":  hex.EncodeToString(sum[:]),
+	}, http.StatusOK, &part)
+
+	if res := ts.do(http.MethodPut, part.PresignedURL, "", []byte("corrupted")); res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got status %d uploading a corrupted part", res.StatusCode)
+	}
+	res := ts.do(http.MethodPut, part.PresignedURL, "", data)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("part upload failed with status %d", res.StatusCode)
+	}
+	etag := res.Header.Get("ETag")
+
+	complete := func(token string) map[string]any {
+		return map[string]any{
+			"uploadID":       start.UploadID,
+			"completedParts": []map[string]any{{"partNumber": 1, "token": token}},
+		}
+	}
+	ts.call(http.MethodPut, "/v2/imagefile/"+img.ID+"/_multipart_complete", "", complete(etag), http.StatusUnauthorized, nil)
+	ts.call(http.MethodPut, "/v2/imagefile/"+img.ID+"/_multipart_complete", testToken, complete(etag), http.StatusOK, nil)
+
+	res = ts.do(http.MethodGet, "/v1/imagefile/alice/tools/alpine:"+hash, "", nil)
+	if b, _ := io.ReadAll(res.Body); !bytes.Equal(b, data) {
+		t.Errorf("downloaded image doesn't match pushed image")
+	}
+	entries, err := os.ReadDir(filepath.Join(ts.dir, uploadsDir))
+	if err == nil && len(entries) != 0 {
+		t.Errorf("got %d staged files after upload, want none", len(entries))
+	}
+}
+
+func TestAuth(t *testing.T) {
+	dir := t.TempDir()
+	ts := newTestServer(t, dir, false)
+
+	ts.call(http.MethodGet, "/v1/token-status", testToken, nil, http.StatusOK, nil)
+	ts.call(http.MethodGet, "/v1/token-status", "wrong", nil, http.StatusUnauthorized, nil)
+	ts.call(http.MethodPost, "/v1/entities", "", Entity{Name: "alice"}, http.StatusUnauthorized, nil)
+	ts.call(http.MethodPost, "/v1/entities", "wrong", Entity{Name: "alice"}, http.StatusUnauthorized, nil)
+	ts.createContainer("alice", "tools", "alpine")
+
+	var c Container
+	ts.call(http.MethodGet, "/v1/containers/alice/tools/alpine", "", nil, http.StatusOK, &c)
+	if c.CreatedBy != "alice" {
+		t.Errorf("got container created by %q, want alice", c.CreatedBy)
+	}
+
+	// the metadata persists, and a private library requires a token to read
+	private := newTestServer(t, dir, true)
+	private.call(http.MethodGet, "/v1/containers/alice/tools/alpine", "", nil, http.StatusUnauthorized, nil)
+	private.call(http.MethodGet, "/v1/containers/alice/tools/alpine", testToken, nil, http.StatusOK, nil)
+	private.call(http.MethodGet, "/version", "", nil, http.StatusOK, nil)
+
+	var cfg map[string]map[string]string
+	res := private.do(http.MethodGet, "/assets/config/config.prod.json", "", nil)
+	if err := json.NewDecoder(res.Body).Decode(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg["libraryAPI"]["uri"] != private.URL || cfg["tokenAPI"]["uri"] != private.URL {
+		t.Errorf("unexpected service configuration %v", cfg)
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	ts := newTestServer(t, t.TempDir(), false)
+
+	c := ts.createContainer("alice", "tools", "alpine")
+	data, hash := testImage(t, "amd64", nil)
+	img := ts.push(c, data, hash, "amd64", "latest")
+
+	// other users can't write to the entity of alice
+	var col Collection
+	ts.call(http.MethodGet, "/v1/collections/alice/tools", "", nil, http.StatusOK, &col)
+	ts.call(http.MethodPost, "/v1/collections", otherToken, Collection{Name: "other", Entity: col.Entity}, http.StatusForbidden, nil)
+	ts.call(http.MethodPost, "/v1/containers", otherToken, Container{Name: "other", Collection: col.ID}, http.StatusForbidden, nil)
+	ts.call(http.MethodPost, "/v1/images", otherToken, Image{Hash: hash, Container: c.ID}, http.StatusForbidden, nil)
+	ts.call(http.MethodPost, "/v2/imagefile/"+img.ID, otherToken, map[string]any{"filesize": len(data)}, http.StatusForbidden, nil)
+	ts.call(http.MethodPost, "/v1/tags/"+c.ID, otherToken, map[string]string{
+		"Tag":     "stable",
+		"ImageID": img.ID,
+	}, http.StatusForbidden, nil)
+	ts.call(http.MethodPost, "/v2/tags/"+c.ID, otherToken, map[string]string{
+		"Arch":    "amd64",
+		"Tag":     "latest",
+		"ImageID": img.ID,
+	}, http.StatusForbidden, nil)
+	ts.call(http.MethodDelete, "/v1/images/alice/tools/alpine:latest?arch=amd64", otherToken, nil, http.StatusForbidden, nil)
+	ts.call(http.MethodGet, "/v1/imagefile/alice/tools/alpine:latest?arch=amd64", "", nil, http.StatusOK, nil)
+
+	// nor take the name of an existing entity
+	ts.call(http.MethodPost, "/v1/entities", otherToken, Entity{Name: "alice"}, http.StatusBadRequest, nil)
+
+	// but can write to their own entities
+	var e Entity
+	ts.call(http.MethodPost, "/v1/entities", otherToken, Entity{Name: "bob"}, http.StatusOK, &e)
+	ts.call(http.MethodPost, "/v1/collections", otherToken, Collection{Name: "tools", Entity: e.ID}, http.StatusOK, nil)
+
+	ts.call(http.MethodPost, "/v1/tags/"+c.ID, testToken, map[string]string{
+		"Tag":     "stable",
+		"ImageID": img.ID,
+	}, http.StatusOK, nil)
+	ts.call(http.MethodDelete, "/v1/images/alice/tools/alpine:latest?arch=amd64", testToken, nil, http.StatusOK, nil)
+}
+
+func TestPrivateContainers(t *testing.T) {
+	ts := newTestServer(t, t.TempDir(), false)
+
+	var e Entity
+	ts.call(http.MethodPost, "/v1/entities", testToken, Entity{Name: "alice"}, http.StatusOK, &e)
+	var col Collection
+	ts.call(http.MethodPost, "/v1/collections", testToken, Collection{Name: "secret", Entity: e.ID, Private: true}, http.StatusOK, &col)
+	var c Container
+	ts.call(http.MethodPost, "/v1/containers", testToken, Container{Name: "alpine", Collection: col.ID}, http.StatusOK, &c)
+	data, hash := testImage(t, "amd64", nil)
+	ts.push(&c, data, hash, "amd64", "latest")
+
+	// private containers are only readable by the owner of their entity
+	for _, token := range []string{"", otherToken} {
+		ts.call(http.MethodGet, "/v1/collections/alice/secret", token, nil, http.StatusNotFound, nil)
+		ts.call(http.MethodGet, "/v1/containers/alice/secret/alpine", token, nil, http.StatusNotFound, nil)
+		ts.call(http.MethodGet, "/v1/images/alice/secret/alpine:latest?arch=amd64", token, nil, http.StatusNotFound, nil)
+		ts.call(http.MethodGet, "/v1/imagefile/alice/secret/alpine:latest?arch=amd64", token, nil, http.StatusNotFound, nil)
+		ts.call(http.MethodGet, "/v1/tags/"+c.ID, token, nil, http.StatusNotFound, nil)
+		ts.call(http.MethodGet, "/v2/tags/"+c.ID, token, nil, http.StatusNotFound, nil)
+
+		var sr SearchResults
+		ts.call(http.MethodGet, "/v1/search?value=alp", token, nil, http.StatusOK, &sr)
+		if len(sr.Collections) != 0 || len(sr.Containers) != 0 || len(sr.Images) != 0 {
+			t.Errorf("private containers found by search: %+v", sr)
+		}
+	}
+
+	ts.call(http.MethodGet, "/v1/collections/alice/secret", testToken, nil, http.StatusOK, nil)
+	ts.call(http.MethodGet, "/v1/containers/alice/secret/alpine", testToken, nil, http.StatusOK, nil)
+	ts.call(http.MethodGet, "/v1/imagefile/alice/secret/alpine:latest?arch=amd64", testToken, nil, http.StatusOK, nil)
+	ts.call(http.MethodGet, "/v2/tags/"+c.ID, testToken, nil, http.StatusOK, nil)
+	var sr SearchResults
+	ts.call(http.MethodGet, "/v1/search?value=alp", testToken, nil, http.StatusOK, &sr)
+	if len(sr.Containers) != 1 || len(sr.Images) != 1 {
+		t.Errorf("private containers not found by their owner: %+v", sr)
+	}
+}
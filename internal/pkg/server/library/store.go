@@ -0,0 +1,507 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metadataFile is the name of the metadata database in the library
+// directory.
+const metadataFile = "library.json"
+
+var errNotFound = errors.New("not found")
+
+// errForbidden is returned when a user writes to an entity owned by another
+// user.
+var errForbidden = errors.New("permission denied")
+
+// Entity is the top level namespace of collections. It is owned by the user
+// who created it, the only one allowed to write to it.
+type Entity struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Collections []string  `json:"collections"`
+	CreatedBy   string    `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Collection is a namespace of containers, in an entity.
+type Collection struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Entity      string    `json:"entity"`
+	EntityName  string    `json:"entityName"`
+	Containers  []string  `json:"containers"`
+	Private     bool      `json:"private"`
+	CreatedBy   string    `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Container is a set of tagged images, in a collection.
+type Container struct {
+	ID             string                       `json:"id"`
+	Name           string                       `json:"name"`
+	Description    string                       `json:"description"`
+	Collection     string                       `json:"collection"`
+	CollectionName string                       `json:"collectionName"`
+	EntityName     string                       `json:"entityName"`
+	Images         []string                     `json:"images"`
+	ImageTags      map[string]string            `json:"imageTags"`
+	ArchTags       map[string]map[string]string `json:"archTags"`
+	Private        bool                         `json:"private"`
+	CreatedBy      string                       `json:"createdBy"`
+	CreatedAt      time.Time                    `json:"createdAt"`
+}
+
+// Image is a SIF image of a container, identified by the SHA-256 hash of
+// its content.
+type Image struct {
+	ID             string    `json:"id"`
+	Hash           string    `json:"hash"`
+	Description    string    `json:"description"`
+	Container      string    `json:"container"`
+	ContainerName  string    `json:"containerName"`
+	CollectionName string    `json:"collectionName"`
+	EntityName     string    `json:"entityName"`
+	Size           int64     `json:"size"`
+	Uploaded       bool      `json:"uploaded"`
+	Signed         *bool     `json:"signed,omitempty"`
+	Architecture   *string   `json:"arch,omitempty"`
+	Fingerprints   []string  `json:"fingerprints,omitempty"`
+	Tags           []string  `json:"tags,omitempty"`
+	CreatedBy      string    `json:"createdBy"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// store is the metadata database of the library, persisted as a JSON file.
+// Its methods must be called with the lock held.
+type store struct {
+	sync.RWMutex `json:"-"`
+
+	path string
+
+	Entities    map[string]*Entity     `json:"entities"`
+	Collections map[string]*Collection `json:"collections"`
+	Containers  map[string]*Container  `json:"containers"`
+	Images      map[string]*Image      `json:"images"`
+}
+
+// openStore loads the metadata database of the library directory dir, or
+// returns an empty one.
+func openStore(dir string) (*store, error) {
+	s := &store{
+		path:        filepath.Join(dir, metadataFile),
+		Entities:    make(map[string]*Entity),
+		Collections: make(map[string]*Collection),
+		Containers:  make(map[string]*Container),
+		Images:      make(map[string]*Image),
+	}
+
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("while parsing %s: %w", s.path, err)
+	}
+	return s, nil
+}
+
+// save writes the metadata database atomically.
+func (s *store) save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), metadataFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+// newID returns a random identifier.
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// entity returns the entity named name.
+func (s *store) entity(name string) (*Entity, error) {
+	for _, e := range s.Entities {
+		if e.Name == name {
+			return e, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+// collection returns the collection named name of the entity named entity.
+func (s *store) collection(entity, name string) (*Collection, error) {
+	for _, c := range s.Collections {
+		if c.EntityName == entity && c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+// container returns the container named name of the collection named
+// collection.
+func (s *store) container(entity, collection, name string) (*Container, error) {
+	for _, c := range s.Containers {
+		if c.EntityName == entity && c.CollectionName == collection && c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+// authorize returns an error unless user owns the entity named name, which
+// is owned by the user who created it.
+func (s *store) authorize(name, user string) error {
+	e, err := s.entity(name)
+	if err != nil {
+		return fmt.Errorf("entity %q: %w", name, err)
+	}
+	if e.CreatedBy != user {
+		return fmt.Errorf("entity %q is owned by another user: %w", name, errForbidden)
+	}
+	return nil
+}
+
+// readable returns whether user can read a collection or container of the
+// entity named name, private ones being only readable by the entity owner.
+func (s *store) readable(private bool, name, user string) bool {
+	return !private || user != "" && s.authorize(name, user) == nil
+}
+
+// validName returns whether name can name an entity, collection or
+// container.
+func validName(name string) bool {
+	if name == "" || len(name) > 128 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return name[0] != '.'
+}
+
+// createEntity creates the entity named name.
+func (s *store) createEntity(name, description, user string) (*Entity, error) {
+	if !validName(name) {
+		return nil, fmt.Errorf("invalid entity name %q", name)
+	}
+	if _, err := s.entity(name); err == nil {
+		return nil, fmt.Errorf("entity %q already exists", name)
+	}
+
+	e := &Entity{
+		ID:          newID(),
+		Name:        name,
+		Description: description,
+		Collections: []string{},
+		CreatedBy:   user,
+		CreatedAt:   time.Now().UTC(),
+	}
+	s.Entities[e.ID] = e
+	return e, s.save()
+}
+
+// createCollection creates the collection named name in the entity with ID
+// entityID.
+func (s *store) createCollection(entityID, name, description string, private bool, user string) (*Collection, error) {
+	e, ok := s.Entities[entityID]
+	if !ok {
+		return nil, fmt.Errorf("entity %q: %w", entityID, errNotFound)
+	}
+	if err := s.authorize(e.Name, user); err != nil {
+		return nil, err
+	}
+	if !validName(name) {
+		return nil, fmt.Errorf("invalid collection name %q", name)
+	}
+	if _, err := s.collection(e.Name, name); err == nil {
+		return nil, fmt.Errorf("collection %q already exists", e.Name+"/"+name)
+	}
+
+	c := &Collection{
+		ID:          newID(),
+		Name:        name,
+		Description: description,
+		Entity:      e.ID,
+		EntityName:  e.Name,
+		Containers:  []string{},
+		Private:     private,
+		CreatedBy:   user,
+		CreatedAt:   time.Now().UTC(),
+	}
+	s.Collections[c.ID] = c
+	e.Collections = append(e.Collections, c.ID)
+	return c, s.save()
+}
+
+// createContainer creates the container named name in the collection with
+// ID collectionID.
+func (s *store) createContainer(collectionID, name, description string, private bool, user string) (*Container, error) {
+	col, ok := s.Collections[collectionID]
+	if !ok {
+		return nil, fmt.Errorf("collection %q: %w", collectionID, errNotFound)
+	}
+	if err := s.authorize(col.EntityName, user); err != nil {
+		return nil, err
+	}
+	if !validName(name) {
+		return nil, fmt.Errorf("invalid container name %q", name)
+	}
+	if _, err := s.container(col.EntityName, col.Name, name); err == nil {
+		return nil, fmt.Errorf("container %q already exists", col.EntityName+"/"+col.Name+"/"+name)
+	}
+
+	c := &Container{
+		ID:             newID(),
+		Name:           name,
+		Description:    description,
+		Collection:     col.ID,
+		CollectionName: col.Name,
+		EntityName:     col.EntityName,
+		Images:         []string{},
+		ImageTags:      make(map[string]string),
+		ArchTags:       make(map[string]map[string]string),
+		Private:        private || col.Private,
+		CreatedBy:      user,
+		CreatedAt:      time.Now().UTC(),
+	}
+	s.Containers[c.ID] = c
+	col.Containers = append(col.Containers, c.ID)
+	return c, s.save()
+}
+
+// createImage creates the image with hash in the container with ID
+// containerID, or returns the existing one.
+func (s *store) createImage(containerID, hash, description, user string) (*Image, error) {
+	c, ok := s.Containers[containerID]
+	if !ok {
+		return nil, fmt.Errorf("container %q: %w", containerID, errNotFound)
+	}
+	if err := s.authorize(c.EntityName, user); err != nil {
+		return nil, err
+	}
+	if !validHash(hash) {
+		return nil, fmt.Errorf("invalid image hash %q", hash)
+	}
+	for _, id := range c.Images {
+		if img := s.Images[id]; img.Hash == hash {
+			return img, nil
+		}
+	}
+
+	img := &Image{
+		ID:             newID(),
+		Hash:           hash,
+		Description:    description,
+		Container:      c.ID,
+		ContainerName:  c.Name,
+		CollectionName: c.CollectionName,
+		EntityName:     c.EntityName,
+		CreatedBy:      user,
+		CreatedAt:      time.Now().UTC(),
+	}
+	s.Images[img.ID] = img
+	c.Images = append(c.Images, img.ID)
+	return img, s.save()
+}
+
+// validHash returns whether hash is a SHA-256 image hash, as computed by the
+// library client.
+func validHash(hash string) bool {
+	h, ok := strings.CutPrefix(hash, hashPrefix)
+	if !ok || len(h) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(h)
+	return err == nil
+}
+
+// setTag points tag of the container with ID containerID to the image with
+// ID imageID, for arch if set.
+func (s *store) setTag(containerID, arch, tag, imageID, user string) error {
+	c, ok := s.Containers[containerID]
+	if !ok {
+		return fmt.Errorf("container %q: %w", containerID, errNotFound)
+	}
+	if err := s.authorize(c.EntityName, user); err != nil {
+		return err
+	}
+	if !slices.Contains(c.Images, imageID) {
+		return fmt.Errorf("image %q: %w", imageID, errNotFound)
+	}
+	if !validTag(tag) {
+		return fmt.Errorf("invalid tag %q", tag)
+	}
+
+	if arch == "" {
+		c.ImageTags[tag] = imageID
+	} else {
+		if c.ArchTags[arch] == nil {
+			c.ArchTags[arch] = make(map[string]string)
+		}
+		c.ArchTags[arch][tag] = imageID
+	}
+	return s.save()
+}
+
+// validTag returns whether tag can tag an image.
+func validTag(tag string) bool {
+	return validName(tag) && !strings.HasPrefix(tag, hashPrefix)
+}
+
+// imageTags returns the tags of img, sorted.
+func (s *store) imageTags(img *Image) []string {
+	c := s.Containers[img.Container]
+	var tags []string
+	for tag, id := range c.ImageTags {
+		if id == img.ID {
+			tags = append(tags, tag)
+		}
+	}
+	for _, m := range c.ArchTags {
+		for tag, id := range m {
+			if id == img.ID && !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// resolveImage returns the image of the container ref, with a tag or image
+// hash, for arch if set.
+func (s *store) resolveImage(ref, arch string) (*Image, error) {
+	path, tag, _ := strings.Cut(ref, ":")
+	if tag == "" {
+		tag = "latest"
+	}
+	entity, collection, name, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.container(entity, collection, name)
+	if err != nil {
+		return nil, fmt.Errorf("container %q: %w", path, err)
+	}
+
+	if strings.HasPrefix(tag, hashPrefix) {
+		for _, id := range c.Images {
+			if img := s.Images[id]; img.Hash == tag {
+				return img, nil
+			}
+		}
+		return nil, fmt.Errorf("image %q: %w", ref, errNotFound)
+	}
+
+	if arch != "" {
+		if id, ok := c.ArchTags[arch][tag]; ok {
+			return s.Images[id], nil
+		}
+	}
+	if id, ok := c.ImageTags[tag]; ok {
+		img := s.Images[id]
+		if arch == "" || img.Architecture == nil || *img.Architecture == arch {
+			return img, nil
+		}
+	}
+	return nil, fmt.Errorf("image %q: %w", ref, errNotFound)
+}
+
+// splitPath returns the entity, collection and container names of path.
+func splitPath(path string) (entity, collection, container string, err error) {
+	p := strings.Split(strings.Trim(path, "/"), "/")
+	if len(p) != 3 {
+		return "", "", "", fmt.Errorf("invalid container path %q, must be entity/collection/container", path)
+	}
+	return p[0], p[1], p[2], nil
+}
+
+// deleteImage removes img and its tags, and returns whether another image
+// has the same hash.
+func (s *store) deleteImage(img *Image) (bool, error) {
+	c := s.Containers[img.Container]
+	c.Images = slices.DeleteFunc(c.Images, func(id string) bool { return id == img.ID })
+	for tag, id := range c.ImageTags {
+		if id == img.ID {
+			delete(c.ImageTags, tag)
+		}
+	}
+	for arch, m := range c.ArchTags {
+		for tag, id := range m {
+			if id == img.ID {
+				delete(m, tag)
+			}
+		}
+		if len(m) == 0 {
+			delete(c.ArchTags, arch)
+		}
+	}
+	delete(s.Images, img.ID)
+
+	shared := false
+	for _, other := range s.Images {
+		if other.Hash == img.Hash && other.Uploaded {
+			shared = true
+			break
+		}
+	}
+	return shared, s.save()
+}
+
+// usage returns the size of the distinct uploaded images.
+func (s *store) usage() int64 {
+	seen := make(map[string]bool)
+	var size int64
+	for _, img := range s.Images {
+		if img.Uploaded && !seen[img.Hash] {
+			seen[img.Hash] = true
+			size += img.Size
+		}
+	}
+	return size
+}
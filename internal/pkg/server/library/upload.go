@@ -0,0 +1,600 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/sif/v2/pkg/sif"
+	jsonresp "github.com/sylabs/json-resp"
+)
+
+const (
+	// partSize is the size of the parts of multipart uploads, but the last.
+	partSize = 64 << 20
+	// uploadTimeout is the time after which unfinished uploads are removed.
+	uploadTimeout = 24 * time.Hour
+)
+
+// upload is an upload of the file of an image in progress. Its ID
+// authorizes the unauthenticated requests sending the file content.
+type upload struct {
+	id      string
+	imageID string
+	size    int64
+	created time.Time
+
+	// sha256 is the checksum of the file announced by the client, if any.
+	sha256 string
+	// done is set once the file has been received.
+	done bool
+
+	// multipart uploads send totalParts parts, whose checksums are
+	// recorded by part number.
+	multipart  bool
+	totalParts int
+	parts      map[int]string
+	partSums   map[int]string
+}
+
+// stagePath returns the path of the file received by u, or of its part n if
+// n is positive.
+func (s *Server) stagePath(u *upload, n int) string {
+	name := u.id
+	if n > 0 {
+		name += "." + strconv.Itoa(n)
+	}
+	return filepath.Join(s.cfg.Dir, uploadsDir, name)
+}
+
+// startUpload registers a new upload of the file of the image with ID
+// imageID, removing the expired ones.
+func (s *Server) startUpload(imageID string, size int64, sum string, multipart bool) (*upload, error) {
+	s.db.RLock()
+	img, ok := s.db.Images[imageID]
+	s.db.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("image %q: %w", imageID, errNotFound)
+	}
+	if img.Uploaded {
+		return nil, fmt.Errorf("image %q already uploaded", imageID)
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid file size %d", size)
+	}
+
+	u := &upload{
+		id:      newID(),
+		imageID: imageID,
+		size:    size,
+		created: time.Now(),
+		sha256:  sum,
+	}
+	if multipart {
+		u.multipart = true
+		u.totalParts = int((size + partSize - 1) / partSize)
+		u.parts = make(map[int]string)
+		u.partSums = make(map[int]string)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, old := range s.uploads {
+		if time.Since(old.created) > uploadTimeout {
+			s.removeUpload(old)
+			delete(s.uploads, id)
+		}
+	}
+	s.uploads[u.id] = u
+	return u, nil
+}
+
+// authorizeImage returns an error unless user owns the entity of the image
+// with ID imageID.
+func (s *Server) authorizeImage(imageID, user string) error {
+	s.db.RLock()
+	defer s.db.RUnlock()
+
+	img, ok := s.db.Images[imageID]
+	if !ok {
+		return fmt.Errorf("image %q: %w", imageID, errNotFound)
+	}
+	return s.db.authorize(img.EntityName, user)
+}
+
+// removeUpload removes the files received by u.
+func (s *Server) removeUpload(u *upload) {
+	os.Remove(s.stagePath(u, 0))
+	for n := 1; n <= u.totalParts; n++ {
+		os.Remove(s.stagePath(u, n))
+	}
+}
+
+// getUpload returns the upload with ID id of the image with ID imageID.
+func (s *Server) getUpload(id, imageID string) (*upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.uploads[id]
+	if !ok || u.imageID != imageID {
+		return nil, fmt.Errorf("upload %q: %w", id, errNotFound)
+	}
+	return u, nil
+}
+
+// endUpload unregisters u and removes its files.
+func (s *Server) endUpload(u *upload) {
+	s.mu.Lock()
+	delete(s.uploads, u.id)
+	s.mu.Unlock()
+	s.removeUpload(u)
+}
+
+// receive writes the content of r to path, and returns its size and
+// SHA-256 checksum.
+func receive(path string, r io.Reader) (int64, string, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return 0, "", fmt.Errorf("while receiving file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// inspect returns the architecture and signing key fingerprints of the SIF
+// image at path.
+func inspect(path string) (string, []string, error) {
+	f, err := sif.LoadContainerFromPath(path, sif.OptLoadWithFlag(os.O_RDONLY))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid SIF image: %w", err)
+	}
+	defer f.UnloadContainer()
+
+	var fps []string
+	sigs, err := f.GetDescriptors(sif.WithDataType(sif.DataSignature))
+	if err != nil {
+		return "", nil, err
+	}
+	for _, d := range sigs {
+		_, fp, err := d.SignatureMetadata()
+		if err != nil || len(fp) == 0 {
+			continue
+		}
+		s := strings.ToUpper(hex.EncodeToString(fp))
+		if !slices.Contains(fps, s) {
+			fps = append(fps, s)
+		}
+	}
+	return f.PrimaryArch(), fps, nil
+}
+
+// finalize stores the file received at path, of size and with checksum sum,
+// as the file of the image with ID imageID.
+func (s *Server) finalize(imageID, path string, size int64, sum string) (*Image, error) {
+	arch, fps, err := inspect(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	img, ok := s.db.Images[imageID]
+	if !ok {
+		return nil, fmt.Errorf("image %q: %w", imageID, errNotFound)
+	}
+	if img.Hash != hashPrefix+sum {
+		return nil, fmt.Errorf("checksum mismatch: image hash is %s, received file hash is %s%s", img.Hash, hashPrefix, sum)
+	}
+	if err := os.Rename(path, s.blobPath(img.Hash)); err != nil {
+		return nil, err
+	}
+
+	signed := len(fps) > 0
+	img.Uploaded = true
+	img.Size = size
+	img.Signed = &signed
+	img.Fingerprints = fps
+	if arch != "unknown" {
+		img.Architecture = &arch
+	}
+	if err := s.db.save(); err != nil {
+		return nil, err
+	}
+
+	sylog.Infof("Received image %s/%s/%s %s (%d bytes)", img.EntityName, img.CollectionName, img.ContainerName, img.Hash, size)
+	return img, nil
+}
+
+// UploadImageComplete is the response to a completed upload.
+type UploadImageComplete struct {
+	Quota struct {
+		QuotaTotalBytes int64 `json:"quotaTotal"`
+		QuotaUsageBytes int64 `json:"quotaUsage"`
+	} `json:"quota"`
+	ContainerURL string `json:"containerUrl"`
+}
+
+// writeUploadComplete writes the response to the completed upload of img.
+func (s *Server) writeUploadComplete(w http.ResponseWriter, r *http.Request, img *Image) {
+	var res UploadImageComplete
+	s.db.RLock()
+	res.Quota.QuotaUsageBytes = s.db.usage()
+	s.db.RUnlock()
+	res.ContainerURL = s.baseURL(r) + "/v1/containers/" + img.EntityName + "/" + img.CollectionName + "/" + img.ContainerName
+	jsonresp.WriteResponse(w, res, http.StatusOK)
+}
+
+// handleLegacyUpload receives the file of an image in the request body.
+func (s *Server) handleLegacyUpload(w http.ResponseWriter, r *http.Request, user string) {
+	if err := s.authorizeImage(r.PathValue("id"), user); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	u, err := s.startUpload(r.PathValue("id"), max(r.ContentLength, 1), "", false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer s.endUpload(u)
+
+	size, sum, err := receive(s.stagePath(u, 0), r.Body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	img, err := s.finalize(u.imageID, s.stagePath(u, 0), size, sum)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeUploadComplete(w, r, img)
+}
+
+// handleUploadRequest starts the upload of the file of an image, and returns
+// the URL to send it to.
+func (s *Server) handleUploadRequest(w http.ResponseWriter, r *http.Request, user string) {
+	if err := s.authorizeImage(r.PathValue("id"), user); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req struct {
+		Size   int64  `json:"filesize"`
+		SHA256 string `json:"sha256sum"`
+		MD5    string `json:"md5sum"`
+	}
+	if !readRequest(w, r, &req) {
+		return
+	}
+
+	u, err := s.startUpload(r.PathValue("id"), req.Size, strings.ToLower(req.SHA256), false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	jsonresp.WriteResponse(w, struct {
+		UploadURL string `json:"uploadURL"`
+	}{
+		UploadURL: s.baseURL(r) + "/v2/imagefile/" + url.PathEscape(u.imageID) + "/_upload?" + url.Values{"upload": {u.id}}.Encode(),
+	}, http.StatusOK)
+}
+
+// handleUpload receives the file of an upload, authorized by the upload ID.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	u, err := s.getUpload(r.URL.Query().Get("upload"), r.PathValue("id"))
+	if err != nil || u.multipart {
+		jsonresp.WriteError(w, "invalid upload", http.StatusForbidden)
+		return
+	}
+
+	size, sum, err := receive(s.stagePath(u, 0), io.LimitReader(r.Body, u.size+1))
+	if err == nil && size != u.size {
+		err = fmt.Errorf("received %d bytes, expected %d", size, u.size)
+	}
+	if err == nil && u.sha256 != "" && sum != u.sha256 {
+		err = errors.New("checksum mismatch")
+	}
+	if err != nil {
+		os.Remove(s.stagePath(u, 0))
+		writeError(w, err)
+		return
+	}
+
+	s.mu.Lock()
+	u.done = true
+	u.sha256 = sum
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleUploadComplete stores the file received for an image.
+func (s *Server) handleUploadComplete(w http.ResponseWriter, r *http.Request, user string) {
+	if err := s.authorizeImage(r.PathValue("id"), user); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	imageID := r.PathValue("id")
+
+	var u *upload
+	s.mu.Lock()
+	for _, v := range s.uploads {
+		if v.imageID == imageID && v.done && !v.multipart {
+			u = v
+			break
+		}
+	}
+	s.mu.Unlock()
+	if u == nil {
+		writeError(w, fmt.Errorf("no completed upload for image %q: %w", imageID, errNotFound))
+		return
+	}
+	defer s.endUpload(u)
+
+	img, err := s.finalize(imageID, s.stagePath(u, 0), u.size, u.sha256)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeUploadComplete(w, r, img)
+}
+
+// handleMultipartStart starts the upload of the file of an image in parts.
+func (s *Server) handleMultipartStart(w http.ResponseWriter, r *http.Request, user string) {
+	if err := s.authorizeImage(r.PathValue("id"), user); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req struct {
+		Size int64 `json:"filesize"`
+	}
+	if !readRequest(w, r, &req) {
+		return
+	}
+
+	u, err := s.startUpload(r.PathValue("id"), req.Size, "", true)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	jsonresp.WriteResponse(w, struct {
+		UploadID   string `json:"uploadID"`
+		TotalParts int    `json:"totalParts"`
+		PartSize   int64  `json:"partSize"`
+	}{u.id, u.totalParts, partSize}, http.StatusOK)
+}
+
+// handleMultipartPartRequest returns the URL to send a part of a multipart
+// upload to.
+func (s *Server) handleMultipartPartRequest(w http.ResponseWriter, r *http.Request, user string) {
+	if err := s.authorizeImage(r.PathValue("id"), user); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req struct {
+		UploadID   string `json:"uploadID"`
+		PartSize   int64  `json:"partSize"`
+		PartNumber int    `json:"partNumber"`
+		SHA256     string `json:"sha256sum"`
+	}
+	if !readRequest(w, r, &req) {
+		return
+	}
+
+	u, err := s.getUpload(req.UploadID, r.PathValue("id"))
+	if err == nil && !u.multipart {
+		err = fmt.Errorf("upload %q: %w", req.UploadID, errNotFound)
+	}
+	if err == nil && (req.PartNumber < 1 || req.PartNumber > u.totalParts) {
+		err = fmt.Errorf("invalid part number %d", req.PartNumber)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.mu.Lock()
+	u.partSums[req.PartNumber] = strings.ToLower(req.SHA256)
+	s.mu.Unlock()
+
+	q := url.Values{"upload": {u.id}, "part": {strconv.Itoa(req.PartNumber)}}
+	jsonresp.WriteResponse(w, struct {
+		PresignedURL string `json:"presignedURL"`
+	}{
+		PresignedURL: s.baseURL(r) + "/v2/imagefile/" + url.PathEscape(u.imageID) + "/_part?" + q.Encode(),
+	}, http.StatusOK)
+}
+
+// handleMultipartPart receives a part of a multipart upload, authorized by
+// the upload ID, and returns its checksum as ETag.
+func (s *Server) handleMultipartPart(w http.ResponseWriter, r *http.Request) {
+	u, err := s.getUpload(r.URL.Query().Get("upload"), r.PathValue("id"))
+	if err != nil || !u.multipart {
+		jsonresp.WriteError(w, "invalid upload", http.StatusForbidden)
+		return
+	}
+	n, err := strconv.Atoi(r.URL.Query().Get("part"))
+	if err != nil || n < 1 || n > u.totalParts {
+		jsonresp.WriteError(w, "invalid part number", http.StatusBadRequest)
+		return
+	}
+
+	size, sum, err := receive(s.stagePath(u, n), io.LimitReader(r.Body, partSize+1))
+	if err == nil && size > partSize {
+		err = fmt.Errorf("part larger than %d bytes", partSize)
+	}
+	s.mu.Lock()
+	if err == nil && u.partSums[n] != "" && u.partSums[n] != sum {
+		err = errors.New("checksum mismatch")
+	}
+	if err == nil {
+		u.parts[n] = sum
+	}
+	s.mu.Unlock()
+	if err != nil {
+		os.Remove(s.stagePath(u, n))
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", strconv.Quote(sum))
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleMultipartComplete assembles the parts of a multipart upload, and
+// stores the file received for an image.
+func (s *Server) handleMultipartComplete(w http.ResponseWriter, r *http.Request, user string) {
+	if err := s.authorizeImage(r.PathValue("id"), user); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req struct {
+		UploadID       string `json:"uploadID"`
+		CompletedParts []struct {
+			PartNumber int    `json:"partNumber"`
+			Token      string `json:"token"`
+		} `json:"completedParts"`
+	}
+	if !readRequest(w, r, &req) {
+		return
+	}
+
+	u, err := s.getUpload(req.UploadID, r.PathValue("id"))
+	if err == nil && !u.multipart {
+		err = fmt.Errorf("upload %q: %w", req.UploadID, errNotFound)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer s.endUpload(u)
+
+	// the client must have sent every part, as received
+	s.mu.Lock()
+	if len(req.CompletedParts) != u.totalParts || len(u.parts) != u.totalParts {
+		err = fmt.Errorf("expected %d parts", u.totalParts)
+	}
+	for _, p := range req.CompletedParts {
+		if err == nil && u.parts[p.PartNumber] != strings.Trim(p.Token, `"`) {
+			err = fmt.Errorf("part %d doesn't match the part received", p.PartNumber)
+		}
+	}
+	s.mu.Unlock()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	size, sum, err := s.assemble(u)
+	if err == nil && size != u.size {
+		err = fmt.Errorf("received %d bytes, expected %d", size, u.size)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	img, err := s.finalize(u.imageID, s.stagePath(u, 0), size, sum)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeUploadComplete(w, r, img)
+}
+
+// assemble concatenates the parts of the multipart upload u.
+func (s *Server) assemble(u *upload) (int64, string, error) {
+	readers := make([]io.Reader, 0, u.totalParts)
+	for n := 1; n <= u.totalParts; n++ {
+		f, err := os.Open(s.stagePath(u, n))
+		if err != nil {
+			return 0, "", err
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	return receive(s.stagePath(u, 0), io.MultiReader(readers...))
+}
+
+// handleMultipartAbort cancels a multipart upload.
+func (s *Server) handleMultipartAbort(w http.ResponseWriter, r *http.Request, user string) {
+	if err := s.authorizeImage(r.PathValue("id"), user); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req struct {
+		UploadID string `json:"uploadID"`
+	}
+	if !readRequest(w, r, &req) {
+		return
+	}
+
+	u, err := s.getUpload(req.UploadID, r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.endUpload(u)
+	jsonresp.WriteResponse(w, struct{}{}, http.StatusOK)
+}
+
+// handleDownload sends the file of an image, supporting range requests.
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request, user string) {
+	s.db.RLock()
+	img, err := s.image(r.PathValue("ref"), r.URL.Query().Get("arch"), user)
+	if err == nil && !img.Uploaded {
+		err = fmt.Errorf("image %q not uploaded: %w", r.PathValue("ref"), errNotFound)
+	}
+	var f *os.File
+	if err == nil {
+		// the file stays readable if the image is deleted meanwhile
+		f, err = os.Open(s.blobPath(img.Hash))
+	}
+	s.db.RUnlock()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, img.Hash+".sif", img.CreatedAt, f)
+}
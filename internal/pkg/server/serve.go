@@ -0,0 +1,98 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package server provides the common code of the services apptainer can
+// host.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// shutdownTimeout is the time given to requests in progress to complete on
+// shutdown.
+const shutdownTimeout = 30 * time.Second
+
+// Config is the configuration of the listener of a service.
+type Config struct {
+	// Addr is the TCP address to listen on.
+	Addr string
+	// CertFile and KeyFile are the paths of the certificate and private key
+	// to serve TLS with, plain HTTP is served if unset.
+	CertFile string
+	KeyFile  string
+}
+
+// Serve serves h as configured by cfg until ctx is done, then shuts down
+// gracefully.
+func Serve(ctx context.Context, cfg Config, name string, h http.Handler) error {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return errors.New("both a TLS certificate and key are required to serve TLS")
+	}
+
+	l, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	scheme := "http"
+	if cfg.CertFile != "" {
+		scheme = "https"
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		if cfg.CertFile != "" {
+			errCh <- srv.ServeTLS(l, cfg.CertFile, cfg.KeyFile)
+		} else {
+			errCh <- srv.Serve(l)
+		}
+	}()
+
+	sylog.Infof("Serving %s on %s://%s", name, scheme, l.Addr())
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	sylog.Infof("Shutting down %s", name)
+	sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(sctx); err != nil {
+		return fmt.Errorf("while shutting down %s: %w", name, err)
+	}
+	return nil
+}
+
+// BaseURL returns the base URL of the server advertised to the client of r,
+// url if set.
+func BaseURL(url string, r *http.Request) string {
+	if url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -12,14 +12,22 @@ package signature
 import (
 	"context"
 
+	"github.com/apptainer/apptainer/internal/pkg/gpgagent"
+	"github.com/apptainer/apptainer/internal/pkg/sshsig"
 	"github.com/apptainer/apptainer/internal/pkg/sypgp"
 	"github.com/apptainer/sif/v2/pkg/integrity"
 	"github.com/apptainer/sif/v2/pkg/sif"
 	"github.com/sigstore/sigstore/pkg/signature"
+	"golang.org/x/crypto/ssh"
 )
 
+// SSHNamespace is the namespace of SSH signatures of SIF images, which
+// allowed signers may be restricted to.
+const SSHNamespace = "apptainer"
+
 type signer struct {
-	opts []integrity.SignerOpt
+	opts   []integrity.SignerOpt
+	tsaURL string
 }
 
 // SignOpt are used to configure s.
@@ -33,6 +41,12 @@ func OptSignWithSigner(ss signature.Signer) SignOpt {
 	}
 }
 
+// OptSignWithSSHSigner specifies the SSH key ss, which may be held by an SSH agent, be used to
+// generate signature(s) in the SSHNamespace namespace.
+func OptSignWithSSHSigner(ss ssh.Signer) SignOpt {
+	return OptSignWithSigner(sshsig.NewSigner(ss, SSHNamespace))
+}
+
 // OptSignEntitySelector specifies f be used to select (and decrypt, if necessary) the entity to
 // use to generate signature(s).
 func OptSignEntitySelector(f sypgp.EntitySelector) SignOpt {
@@ -41,6 +55,30 @@ func OptSignEntitySelector(f sypgp.EntitySelector) SignOpt {
 		if err != nil {
 			return err
 		}
+		e, err = sypgp.SigningEntity(e)
+		if err != nil {
+			return err
+		}
+
+		s.opts = append(s.opts, integrity.OptSignWithEntity(e))
+
+		return nil
+	}
+}
+
+// OptSignWithGPGAgent specifies the PGP key identified by id, the fingerprint of a key of the
+// Apptainer public keyring or the keygrip of a key held by gpg-agent, be used to generate
+// signature(s) through the agent connected to c.
+func OptSignWithGPGAgent(c *gpgagent.Client, id string) SignOpt {
+	return func(s *signer) error {
+		el, err := sypgp.NewHandle("").LoadPubKeyring()
+		if err != nil {
+			return err
+		}
+		e, err := sypgp.AgentSigningEntity(c, el, id)
+		if err != nil {
+			return err
+		}
 
 		s.opts = append(s.opts, integrity.OptSignWithEntity(e))
 
@@ -48,6 +86,15 @@ func OptSignEntitySelector(f sypgp.EntitySelector) SignOpt {
 	}
 }
 
+// OptSignWithTSA specifies that an RFC 3161 timestamp token, issued by the Time Stamping Authority
+// at url, be attached to each signature. Timestamps require non-PGP key material.
+func OptSignWithTSA(url string) SignOpt {
+	return func(s *signer) error {
+		s.tsaURL = url
+		return nil
+	}
+}
+
 // OptSignGroup specifies that a signature be applied to cover all objects in the group with the
 // specified groupID. This may be called multiple times to add multiple group signatures.
 func OptSignGroup(groupID uint32) SignOpt {
@@ -68,10 +115,12 @@ func OptSignObjects(ids ...uint32) SignOpt {
 }
 
 // Sign adds one or more digital signatures to the SIF image found at path, according to opts. Key
-// material must be provided via OptSignEntitySelector.
+// material must be provided via OptSignEntitySelector, OptSignWithGPGAgent or OptSignWithSigner.
 //
 // By default, one digital signature is added per object group in f. To override this behavior,
 // consider using OptSignGroup and/or OptSignObject.
+//
+// To timestamp the signature(s), use OptSignWithTSA.
 func Sign(ctx context.Context, path string, opts ...SignOpt) error {
 	// Apply options to signer.
 	s := signer{
@@ -92,10 +141,26 @@ func Sign(ctx context.Context, path string, opts ...SignOpt) error {
 	}
 	defer f.UnloadContainer()
 
+	// Record existing signature(s), to only timestamp new ones.
+	var skip map[uint32]bool
+	if s.tsaURL != "" {
+		if skip, err = signatureIDs(f); err != nil {
+			return err
+		}
+	}
+
 	// Apply signature(s).
 	is, err := integrity.NewSigner(f, s.opts...)
 	if err != nil {
 		return err
 	}
-	return is.Sign()
+	if err := is.Sign(); err != nil {
+		return err
+	}
+
+	// Timestamp signature(s), if applicable.
+	if s.tsaURL != "" {
+		return addTimestamps(ctx, f, s.tsaURL, skip)
+	}
+	return nil
 }
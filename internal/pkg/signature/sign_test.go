@@ -19,11 +19,19 @@ import (
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/apptainer/apptainer/internal/pkg/sypgp"
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
 	"github.com/apptainer/sif/v2/pkg/integrity"
 	"github.com/sigstore/sigstore/pkg/cryptoutils"
 	"github.com/sigstore/sigstore/pkg/signature"
+	"golang.org/x/crypto/ssh"
 )
 
+func TestMain(m *testing.M) {
+	useragent.InitValue("apptainer", "v0.1.0-30-g67692d50f-dirty")
+
+	os.Exit(m.Run())
+}
+
 // getTestSigner returns a fixed test Signer.
 func getTestSigner(t *testing.T, file string) signature.Signer {
 	t.Helper()
@@ -38,6 +46,23 @@ func getTestSigner(t *testing.T, file string) signature.Signer {
 	return sv
 }
 
+// getTestSSHSigner returns a fixed test SSH signer.
+func getTestSSHSigner(t *testing.T, file string) ssh.Signer {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("..", "..", "..", "test", "keys", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
 // getTestEntity returns a fixed test PGP entity.
 func getTestEntity(t *testing.T) *openpgp.Entity {
 	t.Helper()
@@ -120,6 +145,11 @@ func TestSign(t *testing.T) {
 			path: filepath.Join("..", "..", "..", "test", "images", "one-group.sif"),
 			opts: []SignOpt{OptSignWithSigner(rsa)},
 		},
+		{
+			name: "OptSignWithSSHSigner",
+			path: filepath.Join("..", "..", "..", "test", "images", "one-group.sif"),
+			opts: []SignOpt{OptSignWithSSHSigner(getTestSSHSigner(t, "ed25519-private.pem"))},
+		},
 		{
 			name: "OptSignEntitySelector",
 			path: filepath.Join("..", "..", "..", "test", "images", "one-group.sif"),
@@ -0,0 +1,210 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/apptainer/apptainer/internal/pkg/tsa"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/apptainer/sif/v2/pkg/sif"
+	"github.com/pkg/errors"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+// timestampObjectName is the name of the SIF signature objects holding the RFC 3161 timestamp
+// token of a signature, linked to the signature object. Being linked to a signature object rather
+// than an object group, they are not selected to verify data objects.
+const timestampObjectName = "rfc3161-timestamp"
+
+var errNotTimestamped = errors.New("signature is not timestamped")
+
+// envelope holds the signatures of a DSSE envelope.
+type envelope struct {
+	Signatures []struct {
+		Sig string `json:"sig"`
+	} `json:"signatures"`
+}
+
+// dsseSignatures returns the raw signatures of the DSSE envelope of the signature object od.
+func dsseSignatures(od sif.Descriptor) ([][]byte, error) {
+	b, err := od.GetData()
+	if err != nil {
+		return nil, err
+	}
+
+	var e envelope
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("signature object %d is not a DSSE envelope: %w", od.ID(), err)
+	}
+
+	sigs := make([][]byte, 0, len(e.Signatures))
+	for _, s := range e.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			return nil, fmt.Errorf("signature object %d: %w", od.ID(), err)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+// isTimestamp returns true if od holds a timestamp token.
+func isTimestamp(od sif.Descriptor) (bool, error) {
+	return od.DataType() == sif.DataSignature && od.Name() == timestampObjectName, nil
+}
+
+// signatureIDs returns the IDs of the signature objects of f, including timestamps.
+func signatureIDs(f *sif.FileImage) (map[uint32]bool, error) {
+	ods, err := f.GetDescriptors(sif.WithDataType(sif.DataSignature))
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[uint32]bool, len(ods))
+	for _, od := range ods {
+		ids[od.ID()] = true
+	}
+	return ids, nil
+}
+
+// addTimestamps adds a timestamp object, issued by the TSA at url, for each signature of the
+// signature objects of f not in skip.
+func addTimestamps(ctx context.Context, f *sif.FileImage, url string, skip map[uint32]bool) error {
+	ods, err := f.GetDescriptors(sif.WithDataType(sif.DataSignature))
+	if err != nil {
+		return err
+	}
+
+	for _, od := range ods {
+		if skip[od.ID()] {
+			continue
+		}
+
+		sigs, err := dsseSignatures(od)
+		if err != nil {
+			return fmt.Errorf("timestamps require non-PGP signatures: %w", err)
+		}
+
+		for _, sig := range sigs {
+			token, err := tsa.Request(ctx, url, sig)
+			if err != nil {
+				return err
+			}
+
+			di, err := sif.NewDescriptorInput(sif.DataSignature, bytes.NewReader(token),
+				sif.OptNoGroup(),
+				sif.OptLinkedID(od.ID()),
+				sif.OptObjectName(timestampObjectName),
+				sif.OptSignatureMetadata(crypto.SHA256, nil),
+			)
+			if err != nil {
+				return err
+			}
+			if err := f.AddObject(di); err != nil {
+				return err
+			}
+			sylog.Debugf("Added timestamp of signature object %d", od.ID())
+		}
+	}
+	return nil
+}
+
+// signatureTime is the timestamped time of a signature, or the reason it couldn't be verified.
+type signatureTime struct {
+	t   time.Time
+	err error
+}
+
+// loadTimestamps returns the timestamped times of the signatures of f, indexed by the raw
+// signature, verified with the TSA roots.
+func loadTimestamps(f *sif.FileImage, roots *x509.CertPool) (map[string]signatureTime, error) {
+	ods, err := f.GetDescriptors(isTimestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	times := make(map[string]signatureTime)
+	for _, od := range ods {
+		id, isGroup := od.LinkedID()
+		if isGroup {
+			continue
+		}
+		sd, err := f.GetDescriptor(sif.WithID(id))
+		if err != nil || sd.DataType() != sif.DataSignature || sd.Name() == timestampObjectName {
+			sylog.Debugf("Ignoring timestamp object %d not linked to a signature object", od.ID())
+			continue
+		}
+		sigs, err := dsseSignatures(sd)
+		if err != nil {
+			sylog.Debugf("Ignoring timestamp object %d: %v", od.ID(), err)
+			continue
+		}
+		token, err := od.GetData()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sig := range sigs {
+			t, err := tsa.Verify(token, sig, roots)
+			if errors.Is(err, tsa.ErrMessageMismatch) {
+				continue
+			}
+			// a valid timestamp takes precedence over an invalid one of the same signature
+			if st, ok := times[string(sig)]; ok && st.err == nil {
+				continue
+			}
+			times[string(sig)] = signatureTime{t: t, err: err}
+		}
+	}
+	return times, nil
+}
+
+// timestampVerifier verifies signatures with a Verifier, then checks the key is valid at the
+// timestamped time of the signature.
+type timestampVerifier struct {
+	signature.Verifier
+	times map[string]signatureTime
+	check func(time.Time) error
+}
+
+// VerifySignature verifies the signature sig of message, and checks the key was valid when sig
+// was timestamped.
+func (v *timestampVerifier) VerifySignature(sig, message io.Reader, opts ...signature.VerifyOption) error {
+	b, err := io.ReadAll(sig)
+	if err != nil {
+		return err
+	}
+	if err := v.Verifier.VerifySignature(bytes.NewReader(b), message, opts...); err != nil {
+		return err
+	}
+
+	st, ok := v.times[string(b)]
+	if !ok {
+		err = errNotTimestamped
+	} else if st.err != nil {
+		err = st.err
+	} else if err = v.check(st.t); err != nil {
+		err = fmt.Errorf("certificate not valid at timestamp %s: %w", st.t.UTC().Format(time.RFC3339), err)
+	}
+	if err != nil {
+		// the DSSE verifier doesn't report why signatures are rejected
+		sylog.Warningf("Rejecting signature: %v", err)
+		return err
+	}
+	sylog.Debugf("Signature timestamped at %s", st.t.UTC().Format(time.RFC3339))
+	return nil
+}
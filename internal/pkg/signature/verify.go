@@ -11,16 +11,20 @@
 package signature
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/x509"
 	"encoding/hex"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
-	"github.com/ProtonMail/go-crypto/openpgp"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
+	"github.com/apptainer/apptainer/internal/pkg/sshsig"
 	"github.com/apptainer/apptainer/internal/pkg/sypgp"
 	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/container-key-client/client"
@@ -40,13 +44,17 @@ type verifier struct {
 	intermediates *x509.CertPool
 	roots         *x509.CertPool
 	ocsp          bool
+	tsaRoots      *x509.CertPool
 	svs           []signature.Verifier
 	pgp           bool
 	pgpOpts       []client.Option
+	wkd           bool
+	wkdOpts       []sypgp.WKDOpt
 	groupIDs      []uint32
 	objectIDs     []uint32
 	all           bool
 	legacy        bool
+	threshold     int
 	cb            VerifyCallback
 }
 
@@ -79,6 +87,16 @@ func OptVerifyWithRoots(p *x509.CertPool) VerifyOpt {
 	}
 }
 
+// OptVerifyWithTSARoots specifies that certificates be verified at the time of the RFC 3161
+// timestamp of each signature rather than now, with the Time Stamping Authority certificates
+// verified against roots. Signatures without a valid timestamp are rejected.
+func OptVerifyWithTSARoots(p *x509.CertPool) VerifyOpt {
+	return func(v *verifier) error {
+		v.tsaRoots = p
+		return nil
+	}
+}
+
 // OptVerifyWithVerifier appends sv as a source of key material to verify signatures.
 func OptVerifyWithVerifier(sv signature.Verifier) VerifyOpt {
 	return func(v *verifier) error {
@@ -87,6 +105,25 @@ func OptVerifyWithVerifier(sv signature.Verifier) VerifyOpt {
 	}
 }
 
+// OptVerifyWithAllowedSigners adds the keys of the SSH allowed signers as, allowed to sign in the
+// SSHNamespace namespace as principal, or as any principal if empty, as sources of key material to
+// verify signatures.
+func OptVerifyWithAllowedSigners(as sshsig.AllowedSigners, principal string) VerifyOpt {
+	return func(v *verifier) error {
+		svs := as.Verifiers(principal, SSHNamespace, time.Now())
+		if len(svs) == 0 {
+			if principal != "" {
+				return fmt.Errorf("no allowed signer for principal %q in namespace %q", principal, SSHNamespace)
+			}
+			return fmt.Errorf("no allowed signer in namespace %q", SSHNamespace)
+		}
+		for _, sv := range svs {
+			v.svs = append(v.svs, sv)
+		}
+		return nil
+	}
+}
+
 // OptVerifyWithPGP adds the local public keyring as a source of key material to verify signatures.
 // If supplied, opts specify a keyserver to use in addition to the local public keyring.
 func OptVerifyWithPGP(opts ...client.Option) VerifyOpt {
@@ -97,6 +134,17 @@ func OptVerifyWithPGP(opts ...client.Option) VerifyOpt {
 	}
 }
 
+// OptVerifyWithWKD retrieves PGP keys missing from the keyrings from the Web Key Directory of the
+// email address found in the Signer's User ID of signatures. It has no effect unless
+// OptVerifyWithPGP is also specified.
+func OptVerifyWithWKD(opts ...sypgp.WKDOpt) VerifyOpt {
+	return func(v *verifier) error {
+		v.wkd = true
+		v.wkdOpts = opts
+		return nil
+	}
+}
+
 // OptVerifyWithOCSP subjects the x509 certificate chains to online revocation checks,
 // before the leaf certificate is deemed as trusted for validating the signature.
 func OptVerifyWithOCSP() VerifyOpt {
@@ -143,6 +191,18 @@ func OptVerifyLegacy() VerifyOpt {
 	}
 }
 
+// OptVerifyThreshold sets the number of fingerprints which must have signed the image in
+// VerifyFingerprints. By default, or when n is 0, all fingerprints are required.
+func OptVerifyThreshold(n int) VerifyOpt {
+	return func(v *verifier) error {
+		if n < 0 {
+			return fmt.Errorf("invalid signature threshold %d", n)
+		}
+		v.threshold = n
+		return nil
+	}
+}
+
 // OptVerifyCallback registers f as the verification callback.
 func OptVerifyCallback(cb VerifyCallback) VerifyOpt {
 	return func(v *verifier) error {
@@ -162,13 +222,14 @@ func newVerifier(opts []VerifyOpt) (verifier, error) {
 	return v, nil
 }
 
-// verifyCertificate attempts to verify c is a valid code signing certificate by building one or
-// more chains from c to a certificate in roots, using certificates in intermediates if needed.
-// This function does not do any revocation checking.
-func verifyCertificate(c *x509.Certificate, intermediates, roots *x509.CertPool) (chains [][]*x509.Certificate, err error) {
+// verifyCertificate attempts to verify c is a valid code signing certificate at time t, or now if
+// t is zero, by building one or more chains from c to a certificate in roots, using certificates
+// in intermediates if needed. This function does not do any revocation checking.
+func verifyCertificate(c *x509.Certificate, intermediates, roots *x509.CertPool, t time.Time) (chains [][]*x509.Certificate, err error) {
 	opts := x509.VerifyOptions{
 		Intermediates: intermediates,
 		Roots:         roots,
+		CurrentTime:   t,
 		KeyUsages: []x509.ExtKeyUsage{
 			x509.ExtKeyUsageCodeSigning,
 		},
@@ -177,38 +238,63 @@ func verifyCertificate(c *x509.Certificate, intermediates, roots *x509.CertPool)
 	return c.Verify(opts)
 }
 
+// checkCertificate verifies that c is valid at time t, or now if t is zero, and not revoked if
+// OCSP verification is enabled.
+func (v verifier) checkCertificate(c *x509.Certificate, t time.Time) error {
+	// verify that the leaf certificate is not tampered and that is adequate for signing purposes.
+	chain, err := verifyCertificate(c, v.intermediates, v.roots, t)
+	if err != nil {
+		return err
+	}
+
+	// Verify that the certificate is issued by a trustworthy CA (i.e the certificate chain is not revoked or expired).
+	if v.ocsp {
+		if len(chain) != 1 {
+			return fmt.Errorf("unhandled OCSP condition, chain length %d != 1", len(chain))
+		}
+
+		ocspErr := OCSPVerify(chain[0]...)
+		if ocspErr != nil {
+			// TODO: We need to decide whether this should be strict or permissive.
+			return ocspErr
+		}
+
+		sylog.Debugf("OCSP validation has passed")
+	}
+	return nil
+}
+
 // getOpts returns integrity.VerifierOpt necessary to validate f.
 func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.VerifierOpt, error) {
 	iopts := []integrity.VerifierOpt{
 		integrity.OptVerifyWithContext(ctx),
 	}
 
+	// Load signature timestamps, if applicable.
+	var times map[string]signatureTime
+	if v.tsaRoots != nil {
+		var err error
+		if times, err = loadTimestamps(f, v.tsaRoots); err != nil {
+			return nil, err
+		}
+	}
+
 	// Add key material from certificate(s).
 	for _, c := range v.certs {
-		// verify that the leaf certificate is not tampered and that is adequate for signing purposes.
-		chain, err := verifyCertificate(c, v.intermediates, v.roots)
+		// verify the signature by using the certificate.
+		sv, err := signature.LoadVerifier(c.PublicKey, crypto.SHA256)
 		if err != nil {
 			return nil, err
 		}
 
-		// Verify that the certificate is issued by a trustworthy CA (i.e the certificate chain is not revoked or expired).
-		if v.ocsp {
-			if len(chain) != 1 {
-				return nil, fmt.Errorf("unhandled OCSP condition, chain length %d != 1", len(chain))
-			}
-
-			ocspErr := OCSPVerify(chain[0]...)
-			if ocspErr != nil {
-				// TODO: We need to decide whether this should be strict or permissive.
-				return nil, ocspErr
+		// check the certificate when the signature was timestamped, or now.
+		if v.tsaRoots != nil {
+			sv = &timestampVerifier{
+				Verifier: sv,
+				times:    times,
+				check:    func(t time.Time) error { return v.checkCertificate(c, t) },
 			}
-
-			sylog.Debugf("OCSP validation has passed")
-		}
-
-		// verify the signature by using the certificate.
-		sv, err := signature.LoadVerifier(c.PublicKey, crypto.SHA256)
-		if err != nil {
+		} else if err := v.checkCertificate(c, time.Time{}); err != nil {
 			return nil, err
 		}
 
@@ -222,19 +308,9 @@ func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.Ve
 
 	// Add PGP key material, if applicable.
 	if v.pgp {
-		var kr openpgp.KeyRing
-		if v.pgpOpts != nil {
-			hkr, err := sypgp.NewHybridKeyRing(ctx, v.pgpOpts...)
-			if err != nil {
-				return nil, err
-			}
-			kr = hkr
-		} else {
-			pkr, err := sypgp.PublicKeyRing()
-			if err != nil {
-				return nil, err
-			}
-			kr = pkr
+		pkr, err := sypgp.PublicKeyRing()
+		if err != nil {
+			return nil, err
 		}
 
 		// wrap the global keyring around
@@ -243,7 +319,25 @@ func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.Ve
 		if err != nil {
 			return nil, err
 		}
-		kr = sypgp.NewMultiKeyRing(gkr, kr)
+		kr := sypgp.NewMultiKeyRing(gkr, pkr)
+
+		// use the keyserver for missing keys, and to check for revocations of local keys.
+		if v.pgpOpts != nil {
+			if kr, err = sypgp.NewHybridKeyRingFrom(ctx, kr, v.pgpOpts...); err != nil {
+				return nil, err
+			}
+		}
+
+		// use the web key directory of signers for keys still missing.
+		if v.wkd {
+			emails, err := signerEmails(f)
+			if err != nil {
+				return nil, err
+			}
+			if len(emails) > 0 {
+				kr = sypgp.NewWKDKeyRing(ctx, kr, emails, v.wkdOpts...)
+			}
+		}
 
 		iopts = append(iopts, integrity.OptVerifyWithKeyRing(kr))
 	}
@@ -293,9 +387,14 @@ func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.Ve
 // the platform verifier will be used to verify the certificate, unless OptVerifyWithIntermediates
 // and/or OptVerifyWithRoots are specified.
 //
+// To verify certificates at the time signatures were timestamped, use OptVerifyWithTSARoots.
+//
 // To use raw key material, use OptVerifyWithVerifier.
 //
-// To use PGP key material, use OptVerifyWithPGP.
+// To use SSH keys of an allowed signers file, use OptVerifyWithAllowedSigners.
+//
+// To use PGP key material, use OptVerifyWithPGP. To also retrieve the keys of signers from their
+// Web Key Directory, use OptVerifyWithWKD.
 //
 // By default, non-legacy signatures for all object groups are verified. To override the default
 // behavior, consider using OptVerifyGroup, OptVerifyObject, OptVerifyAll, and/or OptVerifyLegacy.
@@ -324,11 +423,92 @@ func Verify(ctx context.Context, path string, opts ...VerifyOpt) error {
 		return err
 	}
 
-	return iv.Verify()
+	return keyStatusError(iv.Verify())
+}
+
+// keyStatusError returns err with an explicit message when a signature was rejected because its
+// PGP signing key has been revoked or has expired.
+func keyStatusError(err error) error {
+	switch {
+	case errors.Is(err, pgperrors.ErrKeyRevoked):
+		return fmt.Errorf("signing key has been revoked: %w", err)
+	case errors.Is(err, pgperrors.ErrKeyExpired):
+		return fmt.Errorf("signing key has expired: %w", err)
+	case errors.Is(err, pgperrors.ErrSignatureExpired):
+		return fmt.Errorf("signature or key binding has expired: %w", err)
+	}
+	return err
+}
+
+// SignersResult reports which of the required fingerprints signed an image.
+type SignersResult struct {
+	// Threshold is the number of fingerprints required to sign the image.
+	Threshold int
+	// Satisfied are the required fingerprints which signed the image.
+	Satisfied []string
+	// Missing are the required fingerprints which did not sign the image.
+	Missing []string
+}
+
+// ThresholdError is returned by VerifyFingerprints when fewer than the required number of
+// fingerprints signed the image.
+type ThresholdError struct {
+	SignersResult
+}
+
+func (e *ThresholdError) Error() string {
+	return fmt.Sprintf("%s: signed by %d of %d required, missing %s",
+		errNotSignedByRequired, len(e.Satisfied), e.Threshold, strings.Join(e.Missing, ", "))
+}
+
+// Is reports whether target is the error of an image not signed by required entities.
+func (e *ThresholdError) Is(target error) bool {
+	return target == errNotSignedByRequired
+}
+
+// checkSigners checks the signers keyfps include at least threshold of the fingerprints, all
+// of them if threshold is 0.
+func checkSigners(fingerprints []string, keyfps [][]byte, threshold int) (SignersResult, error) {
+	r := SignersResult{Threshold: threshold}
+
+	seen := map[string]bool{}
+	for _, v := range fingerprints {
+		fp := strings.ToUpper(v)
+		if seen[fp] {
+			continue
+		}
+		seen[fp] = true
+
+		signed := false
+		for _, u := range keyfps {
+			if strings.EqualFold(fp, hex.EncodeToString(u[:])) {
+				signed = true
+				break
+			}
+		}
+		if signed {
+			r.Satisfied = append(r.Satisfied, fp)
+		} else {
+			r.Missing = append(r.Missing, fp)
+		}
+	}
+
+	if r.Threshold == 0 {
+		r.Threshold = len(seen)
+	}
+	if r.Threshold > len(seen) {
+		return r, fmt.Errorf("signature threshold %d exceeds the %d fingerprints provided", r.Threshold, len(seen))
+	}
+	if len(r.Satisfied) < r.Threshold {
+		return r, &ThresholdError{r}
+	}
+	return r, nil
 }
 
 // VerifyFingerprints verifies an image and checks it was signed by *all* of the provided
-// fingerprints.
+// fingerprints. To require only some of them, use OptVerifyThreshold. A *ThresholdError
+// reporting the satisfied and missing fingerprints is returned if not enough of them signed the
+// image.
 //
 // To use key material from an x.509 certificate, use OptVerifyWithCertificate. The system roots or
 // the platform verifier will be used to verify the certificate, unless OptVerifyWithIntermediates
@@ -336,59 +516,90 @@ func Verify(ctx context.Context, path string, opts ...VerifyOpt) error {
 //
 // To use raw key material, use OptVerifyWithVerifier.
 //
-// To use PGP key material, use OptVerifyWithPGP.
+// To use SSH keys of an allowed signers file, use OptVerifyWithAllowedSigners.
+//
+// To use PGP key material, use OptVerifyWithPGP. To also retrieve the keys of signers from their
+// Web Key Directory, use OptVerifyWithWKD.
 //
 // By default, non-legacy signatures for all object groups are verified. To override the default
 // behavior, consider using OptVerifyGroup, OptVerifyObject, OptVerifyAll, and/or OptVerifyLegacy.
 func VerifyFingerprints(ctx context.Context, path string, fingerprints []string, opts ...VerifyOpt) error {
+	_, err := VerifySigners(ctx, path, fingerprints, opts...)
+	return err
+}
+
+// VerifySigners is like VerifyFingerprints, it also returns which of the provided fingerprints
+// signed the image. Invalid signatures, like the ones of revoked or unknown keys, are ignored
+// with a warning instead of failing the verification, so that the threshold applies to the
+// valid signatures.
+func VerifySigners(ctx context.Context, path string, fingerprints []string, opts ...VerifyOpt) (SignersResult, error) {
 	v, err := newVerifier(opts)
 	if err != nil {
-		return err
+		return SignersResult{}, err
 	}
 
 	// Load container.
 	f, err := sif.LoadContainerFromPath(path, sif.OptLoadWithFlag(os.O_RDONLY))
 	if err != nil {
-		return err
+		return SignersResult{}, err
 	}
 	defer f.UnloadContainer()
 
+	// Ignore invalid signatures, like the ones of revoked or unknown keys, so that the threshold
+	// applies to the valid ones.
+	var invalid [][]byte
+	cb := v.cb
+	v.cb = func(f *sif.FileImage, r integrity.VerifyResult) bool {
+		ignore := cb != nil && cb(f, r)
+		if ignore || r.Error() == nil {
+			return ignore
+		}
+		var sigerr *integrity.SignatureNotValidError
+		if !errors.As(r.Error(), &sigerr) {
+			return false
+		}
+		od, err := f.GetDescriptor(sif.WithID(sigerr.ID))
+		if err != nil {
+			return false
+		}
+		_, fp, err := od.SignatureMetadata()
+		if err != nil {
+			return false
+		}
+		sylog.Warningf("Signature object %d of key %X ignored: %v", sigerr.ID, fp, keyStatusError(r.Error()))
+		invalid = append(invalid, fp)
+		return true
+	}
+
 	// Get options to validate f.
 	vopts, err := v.getOpts(ctx, f)
 	if err != nil {
-		return err
+		return SignersResult{}, err
 	}
 
 	// Verify signature(s).
 	iv, err := integrity.NewVerifier(f, vopts...)
 	if err != nil {
-		return err
+		return SignersResult{}, err
 	}
 	err = iv.Verify()
 	if err != nil {
-		return err
+		return SignersResult{}, keyStatusError(err)
 	}
 
-	// get signing entities fingerprints that have signed all selected objects
-	keyfps, err := iv.AllSignedBy()
+	// get signing entities fingerprints that have signed all selected objects with a valid
+	// signature
+	allfps, err := iv.AllSignedBy()
 	if err != nil {
-		return err
+		return SignersResult{}, err
 	}
-	// were the selected objects signed by the provided fingerprints?
-
-	m := map[string]bool{}
-	for _, v := range fingerprints {
-		m[v] = false
-		for _, u := range keyfps {
-			if strings.EqualFold(v, hex.EncodeToString(u[:])) {
-				m[v] = true
-			}
+	var keyfps [][]byte
+	for _, fp := range allfps {
+		if !slices.ContainsFunc(invalid, func(ifp []byte) bool { return bytes.Equal(fp, ifp) }) {
+			keyfps = append(keyfps, fp)
 		}
 	}
-	for _, v := range m {
-		if !v {
-			return errNotSignedByRequired
-		}
-	}
-	return nil
+
+	// were the selected objects signed by enough of the provided fingerprints?
+	return checkSigners(fingerprints, keyfps, v.threshold)
 }
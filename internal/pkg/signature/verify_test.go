@@ -12,22 +12,34 @@ package signature
 import (
 	"bytes"
 	"crypto"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/apptainer/apptainer/internal/pkg/sshsig"
+	testtsa "github.com/apptainer/apptainer/internal/pkg/test/tool/tsa"
 	"github.com/apptainer/container-key-client/client"
 	"github.com/apptainer/sif/v2/pkg/integrity"
 	"github.com/apptainer/sif/v2/pkg/sif"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
 	"github.com/sigstore/sigstore/pkg/signature"
+	"golang.org/x/crypto/ssh"
 )
 
 const (
@@ -169,6 +181,11 @@ func Test_newVerifier(t *testing.T) {
 				pgpOpts: pgpOpts,
 			},
 		},
+		{
+			name:         "OptVerifyWithWKD",
+			opts:         []VerifyOpt{OptVerifyWithWKD()},
+			wantVerifier: verifier{wkd: true},
+		},
 		{
 			name:         "OptVerifyGroup",
 			opts:         []VerifyOpt{OptVerifyGroup(1)},
@@ -741,6 +758,29 @@ func TestVerifyFingerPrint(t *testing.T) {
 			wantEntity:   e,
 			wantErr:      errNotSignedByRequired,
 		},
+		{
+			name:         "ThresholdOneOfTwo",
+			path:         filepath.Join("..", "..", "..", "test", "images", "one-group-signed-pgp.sif"),
+			fingerprints: []string{testFingerPrint, invalidFingerPrint},
+			opts: []VerifyOpt{
+				OptVerifyWithPGP(client.OptBaseURL(s.URL)),
+				OptVerifyThreshold(1),
+			},
+			wantVerified: [][]uint32{{1, 2}},
+			wantEntity:   e,
+		},
+		{
+			name:         "ThresholdTwoOfTwo",
+			path:         filepath.Join("..", "..", "..", "test", "images", "one-group-signed-pgp.sif"),
+			fingerprints: []string{testFingerPrint, invalidFingerPrint},
+			opts: []VerifyOpt{
+				OptVerifyWithPGP(client.OptBaseURL(s.URL)),
+				OptVerifyThreshold(2),
+			},
+			wantVerified: [][]uint32{{1, 2}},
+			wantEntity:   e,
+			wantErr:      errNotSignedByRequired,
+		},
 	}
 
 	for _, tt := range tests {
@@ -778,3 +818,486 @@ func TestVerifyFingerPrint(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifySignersInvalidSignature(t *testing.T) {
+	// Start up a mock HKP server, which only knows the test entity.
+	e := getTestEntity(t)
+	s := httptest.NewServer(mockHKP{e: e})
+	defer s.Close()
+
+	// Signing modifies the file, so work with a temporary file.
+	path, err := tempFileFrom(filepath.Join("..", "..", "..", "test", "images", "one-group-signed-pgp.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	// Add a signature of a key unknown to the key server.
+	other, err := openpgp.NewEntity("Other", "", "other@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := sif.LoadContainerFromPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	is, err := integrity.NewSigner(f, integrity.OptSignWithEntity(other))
+	if err == nil {
+		err = is.Sign()
+	}
+	if uerr := f.UnloadContainer(); err == nil {
+		err = uerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherFingerPrint := strings.ToUpper(hex.EncodeToString(other.PrimaryKey.Fingerprint))
+
+	tests := []struct {
+		name          string
+		threshold     int
+		wantSatisfied []string
+		wantMissing   []string
+		wantErr       error
+	}{
+		{
+			name:          "ThresholdMet",
+			threshold:     1,
+			wantSatisfied: []string{testFingerPrint},
+			wantMissing:   []string{otherFingerPrint},
+		},
+		{
+			name:          "ThresholdNotMet",
+			threshold:     2,
+			wantSatisfied: []string{testFingerPrint},
+			wantMissing:   []string{otherFingerPrint},
+			wantErr:       errNotSignedByRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := VerifySigners(t.Context(), path, []string{testFingerPrint, otherFingerPrint},
+				OptVerifyWithPGP(client.OptBaseURL(s.URL)),
+				OptVerifyThreshold(tt.threshold),
+			)
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if !reflect.DeepEqual(r.Satisfied, tt.wantSatisfied) || !reflect.DeepEqual(r.Missing, tt.wantMissing) {
+				t.Errorf("got satisfied %v and missing %v, want %v and %v", r.Satisfied, r.Missing, tt.wantSatisfied, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestCheckSigners(t *testing.T) {
+	signed, err := hex.DecodeString(testFingerPrint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyfps := [][]byte{signed}
+
+	tests := []struct {
+		name          string
+		fingerprints  []string
+		threshold     int
+		wantSatisfied []string
+		wantMissing   []string
+		wantErr       bool
+	}{
+		{
+			name:          "All",
+			fingerprints:  []string{testFingerPrint},
+			wantSatisfied: []string{testFingerPrint},
+		},
+		{
+			name:          "AllMissing",
+			fingerprints:  []string{testFingerPrint, invalidFingerPrint},
+			wantSatisfied: []string{testFingerPrint},
+			wantMissing:   []string{invalidFingerPrint},
+			wantErr:       true,
+		},
+		{
+			name:          "Threshold",
+			fingerprints:  []string{strings.ToLower(testFingerPrint), invalidFingerPrint},
+			threshold:     1,
+			wantSatisfied: []string{testFingerPrint},
+			wantMissing:   []string{invalidFingerPrint},
+		},
+		{
+			name:          "Duplicates",
+			fingerprints:  []string{testFingerPrint, strings.ToLower(testFingerPrint)},
+			threshold:     1,
+			wantSatisfied: []string{testFingerPrint},
+		},
+		{
+			name:          "ThresholdTooHigh",
+			fingerprints:  []string{testFingerPrint},
+			threshold:     2,
+			wantSatisfied: []string{testFingerPrint},
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := checkSigners(tt.fingerprints, keyfps, tt.threshold)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got err %v, wantErr %v", err, tt.wantErr)
+			}
+			if got, want := r.Satisfied, tt.wantSatisfied; !reflect.DeepEqual(got, want) {
+				t.Errorf("got satisfied %v, want %v", got, want)
+			}
+			if got, want := r.Missing, tt.wantMissing; !reflect.DeepEqual(got, want) {
+				t.Errorf("got missing %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifyAllowedSigners(t *testing.T) {
+	ss := getTestSSHSigner(t, "ed25519-private.pem")
+
+	// Signing modifies the file, so work with a temporary file.
+	path, err := tempFileFrom(filepath.Join("..", "..", "..", "test", "images", "one-group.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	if err := Sign(t.Context(), path, OptSignWithSSHSigner(ss)); err != nil {
+		t.Fatal(err)
+	}
+
+	key := string(ssh.MarshalAuthorizedKey(ss.PublicKey()))
+	other := string(ssh.MarshalAuthorizedKey(getTestSSHSigner(t, "ecdsa-private.pem").PublicKey()))
+
+	tests := []struct {
+		name      string
+		allowed   string
+		principal string
+		wantErr   bool
+	}{
+		{"OK", "user@example.com " + key, "", false},
+		{"Principal", "user@example.com " + key, "user@example.com", false},
+		{"Namespace", `user@example.com namespaces="apptainer" ` + key, "", false},
+		{"WrongPrincipal", "user@example.com " + key, "other@example.com", true},
+		{"WrongNamespace", `user@example.com namespaces="git" ` + key, "", true},
+		{"WrongKey", "user@example.com " + other, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			as, err := sshsig.ParseAllowedSigners(strings.NewReader(tt.allowed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = Verify(t.Context(), path, OptVerifyWithAllowedSigners(as, tt.principal))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// getExpiredLeaf returns a code signing certificate of the RSA test key, issued by the test
+// intermediate certificate, which expired in 2021.
+func getExpiredLeaf(t *testing.T) *x509.Certificate {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("..", "..", "..", "test", "keys", "ecdsa-private.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := cryptoutils.UnmarshalPEMToPrivateKey(b, cryptoutils.SkipPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(4),
+		Subject:      pkix.Name{CommonName: "expired leaf"},
+		NotBefore:    time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	pub, err := getTestSigner(t, "rsa-private.pem").PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, getCertificate(t, "intermediate.pem"), pub, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestVerifyTimestamp(t *testing.T) {
+	srv := testtsa.NewServer(t)
+	other := testtsa.NewServer(t)
+	rsa := getTestSigner(t, "rsa-private.pem")
+	leaf := getCertificate(t, "leaf.pem")
+	expired := getExpiredLeaf(t)
+
+	tests := []struct {
+		name     string
+		tsaTime  time.Time
+		cert     *x509.Certificate
+		tsaRoots *x509.CertPool
+		wantErr  bool
+	}{
+		{
+			name:     "Timestamped",
+			tsaTime:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			cert:     leaf,
+			tsaRoots: srv.Roots,
+		},
+		{
+			name:    "TimestampIgnored",
+			tsaTime: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			cert:    leaf,
+		},
+		{
+			name:     "TimestampBeforeValidity",
+			tsaTime:  time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+			cert:     leaf,
+			tsaRoots: srv.Roots,
+			wantErr:  true,
+		},
+		{
+			name:     "ExpiredTimestamped",
+			tsaTime:  time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+			cert:     expired,
+			tsaRoots: srv.Roots,
+		},
+		{
+			name:    "ExpiredTimestampIgnored",
+			tsaTime: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+			cert:    expired,
+			wantErr: true,
+		},
+		{
+			name:     "NotTimestamped",
+			cert:     leaf,
+			tsaRoots: srv.Roots,
+			wantErr:  true,
+		},
+		{
+			name:     "OtherTSARoots",
+			tsaTime:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			cert:     leaf,
+			tsaRoots: other.Roots,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Signing modifies the file, so work with a temporary file.
+			path, err := tempFileFrom(filepath.Join("..", "..", "..", "test", "images", "one-group.sif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(path)
+
+			opts := []SignOpt{OptSignWithSigner(rsa)}
+			if !tt.tsaTime.IsZero() {
+				srv.SetTime(tt.tsaTime)
+				opts = append(opts, OptSignWithTSA(srv.URL))
+			}
+			if err := Sign(t.Context(), path, opts...); err != nil {
+				t.Fatal(err)
+			}
+
+			vopts := []VerifyOpt{
+				OptVerifyWithCertificate(tt.cert),
+				OptVerifyWithIntermediates(getCertificatePool(t, "intermediate.pem")),
+				OptVerifyWithRoots(getCertificatePool(t, "root.pem")),
+			}
+			if tt.tsaRoots != nil {
+				vopts = append(vopts, OptVerifyWithTSARoots(tt.tsaRoots))
+			}
+			err = Verify(t.Context(), path, vopts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("PGP", func(t *testing.T) {
+		path, err := tempFileFrom(filepath.Join("..", "..", "..", "test", "images", "one-group.sif"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(path)
+
+		if err := Sign(t.Context(), path, OptSignEntitySelector(mockEntitySelector(t)), OptSignWithTSA(srv.URL)); err == nil {
+			t.Errorf("unexpected success timestamping PGP signatures")
+		}
+	})
+}
+
+func TestKeyStatusError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantMsg string
+	}{
+		{
+			name: "Nil",
+		},
+		{
+			name:    "Revoked",
+			err:     &integrity.SignatureNotValidError{ID: 3, Err: pgperrors.ErrKeyRevoked},
+			wantMsg: "signing key has been revoked",
+		},
+		{
+			name:    "Expired",
+			err:     &integrity.SignatureNotValidError{ID: 3, Err: pgperrors.ErrKeyExpired},
+			wantMsg: "signing key has expired",
+		},
+		{
+			name:    "SignatureExpired",
+			err:     &integrity.SignatureNotValidError{ID: 3, Err: pgperrors.ErrSignatureExpired},
+			wantMsg: "signature or key binding has expired",
+		},
+		{
+			name:    "Other",
+			err:     errors.New("other"),
+			wantMsg: "other",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := keyStatusError(tt.err)
+			if tt.wantMsg == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantMsg) {
+				t.Fatalf("got error %v, want %q", err, tt.wantMsg)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("error %v doesn't wrap %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSignerEmails(t *testing.T) {
+	e, err := openpgp.NewEntity("WKD Test", "", "jdoe@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// clearsign returns a clearsigned message with the Signer's User ID uid.
+	clearsign := func(uid string) []byte {
+		sig := &packet.Signature{
+			Version:      e.PrimaryKey.Version,
+			SigType:      packet.SigTypeText,
+			PubKeyAlgo:   e.PrimaryKey.PubKeyAlgo,
+			Hash:         crypto.SHA256,
+			CreationTime: time.Now(),
+			IssuerKeyId:  &e.PrimaryKey.KeyId,
+		}
+		if uid != "" {
+			sig.SignerUserId = &uid
+		}
+		h, err := sig.PrepareSign(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Write([]byte("data"))
+		if err := sig.Sign(h, e.PrivateKey, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		var b bytes.Buffer
+		b.WriteString("-----BEGIN PGP SIGNED MESSAGE-----\nHash: SHA256\n\ndata\n")
+		w, err := armor.Encode(&b, "PGP SIGNATURE", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sig.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return b.Bytes()
+	}
+
+	tests := []struct {
+		name string
+		sigs [][]byte
+		want []string
+	}{
+		{
+			name: "None",
+		},
+		{
+			name: "NoSignerUserID",
+			sigs: [][]byte{clearsign("")},
+		},
+		{
+			name: "Email",
+			sigs: [][]byte{clearsign("jdoe@example.com")},
+			want: []string{"jdoe@example.com"},
+		},
+		{
+			name: "NameAndEmail",
+			sigs: [][]byte{clearsign("WKD Test <jdoe@example.com>"), clearsign("jdoe@example.com")},
+			want: []string{"jdoe@example.com"},
+		},
+		{
+			name: "NotEmail",
+			sigs: [][]byte{clearsign("WKD Test")},
+		},
+		{
+			name: "NotPGP",
+			sigs: [][]byte{[]byte("{}")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dis := []sif.DescriptorInput{}
+			di, err := sif.NewDescriptorInput(sif.DataGeneric, bytes.NewReader([]byte("data")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dis = append(dis, di)
+			for _, sig := range tt.sigs {
+				di, err := sif.NewDescriptorInput(sif.DataSignature, bytes.NewReader(sig),
+					sif.OptLinkedID(1),
+					sif.OptSignatureMetadata(crypto.SHA256, e.PrimaryKey.Fingerprint),
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+				dis = append(dis, di)
+			}
+
+			f, err := sif.CreateContainer(sif.NewBuffer(nil), sif.OptCreateWithDescriptors(dis...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer()
+
+			got, err := signerEmails(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got emails %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
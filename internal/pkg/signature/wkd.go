@@ -0,0 +1,65 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package signature
+
+import (
+	"net/mail"
+	"slices"
+
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/apptainer/sif/v2/pkg/sif"
+)
+
+// signerUserID returns the Signer's User ID of the PGP signature held by
+// od, if any.
+func signerUserID(od sif.Descriptor) (string, bool) {
+	b, err := od.GetData()
+	if err != nil {
+		return "", false
+	}
+	block, _ := clearsign.Decode(b)
+	if block == nil {
+		return "", false
+	}
+	p, err := packet.NewReader(block.ArmoredSignature.Body).Next()
+	if err != nil {
+		return "", false
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok || sig.SignerUserId == nil {
+		return "", false
+	}
+	return *sig.SignerUserId, true
+}
+
+// signerEmails returns the email addresses found in the Signer's User ID of
+// the PGP signatures of f.
+func signerEmails(f *sif.FileImage) ([]string, error) {
+	ods, err := f.GetDescriptors(sif.WithDataType(sif.DataSignature))
+	if err != nil {
+		return nil, err
+	}
+
+	var emails []string
+	for _, od := range ods {
+		uid, ok := signerUserID(od)
+		if !ok {
+			continue
+		}
+		a, err := mail.ParseAddress(uid)
+		if err != nil {
+			continue
+		}
+		if !slices.Contains(emails, a.Address) {
+			emails = append(emails, a.Address)
+		}
+	}
+	return emails, nil
+}
@@ -0,0 +1,225 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package sigstore verifies Sigstore bundles offline, against a trusted root of
+// certificate authorities and transparency logs.
+package sigstore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/sigstore/fulcio/pkg/certificate"
+	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
+	protocommon "github.com/sigstore/protobuf-specs/gen/pb-go/common/v1"
+	protorekor "github.com/sigstore/protobuf-specs/gen/pb-go/rekor/v1"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/options"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// bundleMediaTypePrefix is the prefix of the media types of all Sigstore bundle versions.
+const bundleMediaTypePrefix = "application/vnd.dev.sigstore.bundle"
+
+// Bundle is a Sigstore bundle, holding the signature of an artifact, the certificate of the
+// signer, and the transparency log entries of the signature.
+type Bundle struct {
+	pb *protobundle.Bundle
+}
+
+// LoadBundle loads the Sigstore bundle JSON file at path.
+func LoadBundle(path string) (*Bundle, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseBundle(b)
+}
+
+// ParseBundle parses the Sigstore bundle JSON document b.
+func ParseBundle(b []byte) (*Bundle, error) {
+	var pb protobundle.Bundle
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(b, &pb); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if !strings.HasPrefix(pb.GetMediaType(), bundleMediaTypePrefix) {
+		return nil, fmt.Errorf("invalid bundle: unsupported media type %q", pb.GetMediaType())
+	}
+	return &Bundle{pb: &pb}, nil
+}
+
+// certificate returns the signing certificate of the bundle.
+func (b *Bundle) certificate() (*x509.Certificate, error) {
+	vm := b.pb.GetVerificationMaterial()
+
+	var der []byte
+	if c := vm.GetCertificate(); c != nil {
+		der = c.GetRawBytes()
+	} else if chain := vm.GetX509CertificateChain().GetCertificates(); len(chain) > 0 {
+		der = chain[0].GetRawBytes()
+	} else {
+		return nil, errors.New("bundle has no signing certificate")
+	}
+	return x509.ParseCertificate(der)
+}
+
+// Identity is the identity of a signer, as certified by a Fulcio-style certificate authority.
+type Identity struct {
+	// SubjectAlternativeName is the email address or URI of the signer.
+	SubjectAlternativeName string
+	// Issuer is the OIDC issuer that authenticated the signer.
+	Issuer string
+}
+
+// check checks that the certificate c certifies the identity id.
+func (id Identity) check(c *x509.Certificate) error {
+	var sans []string
+	sans = append(sans, c.EmailAddresses...)
+	for _, u := range c.URIs {
+		sans = append(sans, u.String())
+	}
+	found := false
+	for _, san := range sans {
+		if san == id.SubjectAlternativeName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("certificate identity %q doesn't match %q", strings.Join(sans, ", "), id.SubjectAlternativeName)
+	}
+
+	ext, err := certificate.ParseExtensions(c.Extensions)
+	if err != nil {
+		return fmt.Errorf("invalid certificate extensions: %w", err)
+	}
+	if ext.Issuer != id.Issuer {
+		return fmt.Errorf("certificate OIDC issuer %q doesn't match %q", ext.Issuer, id.Issuer)
+	}
+	return nil
+}
+
+// Result is the result of the verification of a bundle.
+type Result struct {
+	// Certificate is the signing certificate.
+	Certificate *x509.Certificate
+	// IntegratedTime is the time the signature was logged in the transparency log.
+	IntegratedTime time.Time
+	// LogIndex is the index of the transparency log entry of the signature.
+	LogIndex int64
+}
+
+// hashFunc returns the hash function of the hash algorithm alg.
+func hashFunc(alg protocommon.HashAlgorithm) (crypto.Hash, error) {
+	switch alg {
+	case protocommon.HashAlgorithm_HASH_ALGORITHM_UNSPECIFIED, protocommon.HashAlgorithm_SHA2_256:
+		return crypto.SHA256, nil
+	case protocommon.HashAlgorithm_SHA2_384:
+		return crypto.SHA384, nil
+	case protocommon.HashAlgorithm_SHA2_512:
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported hash algorithm %v", alg)
+}
+
+// Verify verifies that the bundle b holds a signature of artifact by the identity id, with a
+// certificate issued by a certificate authority of tr, and logged in a transparency log of tr.
+// The certificate is verified at the time the signature was logged, proven by the signed entry
+// timestamp of the log. When the bundle holds an inclusion proof, it's verified along with the
+// log checkpoint.
+func Verify(b *Bundle, artifact io.Reader, tr *TrustedRoot, id Identity) (Result, error) {
+	ms := b.pb.GetMessageSignature()
+	if ms == nil {
+		return Result{}, errors.New("only bundles of message signatures are supported")
+	}
+
+	c, err := b.certificate()
+	if err != nil {
+		return Result{}, err
+	}
+
+	h, err := hashFunc(ms.GetMessageDigest().GetAlgorithm())
+	if err != nil {
+		return Result{}, err
+	}
+	hasher := h.New()
+	if _, err := io.Copy(hasher, artifact); err != nil {
+		return Result{}, err
+	}
+	digest := hasher.Sum(nil)
+	if d := ms.GetMessageDigest().GetDigest(); len(d) > 0 && !bytes.Equal(d, digest) {
+		return Result{}, errors.New("bundle is not for this artifact, digest mismatch")
+	}
+
+	v, err := signature.LoadVerifier(c.PublicKey, h)
+	if err != nil {
+		return Result{}, err
+	}
+	err = v.VerifySignature(bytes.NewReader(ms.GetSignature()), nil, options.WithDigest(digest), options.WithCryptoSignerOpts(h))
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid signature: %w", err)
+	}
+
+	entries := b.pb.GetVerificationMaterial().GetTlogEntries()
+	if len(entries) == 0 {
+		return Result{}, errors.New("bundle has no transparency log entry")
+	}
+	for _, e := range entries {
+		var t time.Time
+		t, err = verifyEntry(e, tr, c, ms.GetSignature(), digest, h)
+		if err != nil {
+			sylog.Debugf("Ignoring transparency log entry %d: %v", e.GetLogIndex(), err)
+			continue
+		}
+
+		if err := tr.verifyCertificate(c, t); err != nil {
+			return Result{}, err
+		}
+		if err := id.check(c); err != nil {
+			return Result{}, err
+		}
+		return Result{Certificate: c, IntegratedTime: t, LogIndex: e.GetLogIndex()}, nil
+	}
+	return Result{}, fmt.Errorf("no valid transparency log entry: %w", err)
+}
+
+// verifyEntry verifies that the transparency log entry e logs the signature sig of the artifact
+// digest by the certificate c, in a log of tr, and returns the time it was logged.
+func verifyEntry(e *protorekor.TransparencyLogEntry, tr *TrustedRoot, c *x509.Certificate, sig, digest []byte, h crypto.Hash) (time.Time, error) {
+	l, ok := tr.tlogs[hex.EncodeToString(e.GetLogId().GetKeyId())]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown transparency log %x", e.GetLogId().GetKeyId())
+	}
+
+	if err := checkBody(e, c, sig, digest, h); err != nil {
+		return time.Time{}, err
+	}
+	if err := verifySET(e, l); err != nil {
+		return time.Time{}, err
+	}
+	if e.GetInclusionProof() != nil {
+		if err := verifyInclusionProof(e, l); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	t := time.Unix(e.GetIntegratedTime(), 0)
+	if !validAt(l.validFor, t) {
+		return time.Time{}, fmt.Errorf("transparency log key not valid at %s", t.UTC().Format(time.RFC3339))
+	}
+	return t, nil
+}
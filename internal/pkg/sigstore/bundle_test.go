@@ -0,0 +1,473 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sigstore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sigstore/fulcio/pkg/certificate"
+	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
+	protocommon "github.com/sigstore/protobuf-specs/gen/pb-go/common/v1"
+	protorekor "github.com/sigstore/protobuf-specs/gen/pb-go/rekor/v1"
+	prototrustroot "github.com/sigstore/protobuf-specs/gen/pb-go/trustroot/v1"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	testIdentity = "user@example.com"
+	testIssuer   = "https://issuer.example.com"
+)
+
+// testInfra is a Fulcio-style certificate authority and a Rekor-style transparency log.
+type testInfra struct {
+	rootKey, caKey, logKey *ecdsa.PrivateKey
+	root, ca               *x509.Certificate
+	logID                  []byte
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func createCert(t *testing.T, tmpl, parent *x509.Certificate, pub crypto.PublicKey, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func newTestInfra(t *testing.T) *testInfra {
+	t.Helper()
+
+	in := &testInfra{
+		rootKey: newKey(t),
+		caKey:   newKey(t),
+		logKey:  newKey(t),
+	}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sigstore root"},
+		NotBefore:             start,
+		NotAfter:              start.AddDate(20, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	in.root = createCert(t, rootTmpl, rootTmpl, in.rootKey.Public(), in.rootKey)
+	in.ca = createCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "sigstore intermediate"},
+		NotBefore:             start,
+		NotAfter:              start.AddDate(20, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, in.root, in.caKey.Public(), in.rootKey)
+
+	der, err := x509.MarshalPKIXPublicKey(in.logKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := sha256.Sum256(der)
+	in.logID = id[:]
+	return in
+}
+
+// trustedRoot returns the trusted root JSON document of the infrastructure.
+func (in *testInfra) trustedRoot(t *testing.T) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(in.logKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &prototrustroot.TrustedRoot{
+		MediaType: "application/vnd.dev.sigstore.trustedroot+json;version=0.1",
+		Tlogs: []*prototrustroot.TransparencyLogInstance{{
+			BaseUrl:       "https://rekor.example.com",
+			HashAlgorithm: protocommon.HashAlgorithm_SHA2_256,
+			PublicKey: &protocommon.PublicKey{
+				RawBytes:   der,
+				KeyDetails: protocommon.PublicKeyDetails_PKIX_ECDSA_P256_SHA_256,
+				ValidFor:   &protocommon.TimeRange{Start: timestamppb.New(in.root.NotBefore)},
+			},
+			LogId: &protocommon.LogId{KeyId: in.logID},
+		}},
+		CertificateAuthorities: []*prototrustroot.CertificateAuthority{{
+			Uri: "https://fulcio.example.com",
+			CertChain: &protocommon.X509CertificateChain{
+				Certificates: []*protocommon.X509Certificate{
+					{RawBytes: in.ca.Raw},
+					{RawBytes: in.root.Raw},
+				},
+			},
+			ValidFor: &protocommon.TimeRange{Start: timestamppb.New(in.root.NotBefore)},
+		}},
+	}
+	b, err := protojson.Marshal(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// bundleOpts tweaks the bundle created by testInfra.bundle.
+type bundleOpts struct {
+	identity     string
+	issuer       string
+	signTime     time.Time
+	otherLogSET  bool
+	noProof      bool
+	tamperProof  bool
+	checkpointBy *ecdsa.PrivateKey
+}
+
+// hashTree returns the RFC 6962 Merkle tree hash of leaves.
+func hashTree(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := 1
+	for k*2 < len(leaves) {
+		k *= 2
+	}
+	return hashChildren(hashTree(leaves[:k]), hashTree(leaves[k:]))
+}
+
+// inclusionProof returns the RFC 6962 inclusion proof of the leaf at index.
+func inclusionProof(index int, leaves [][]byte) [][]byte {
+	if len(leaves) == 1 {
+		return nil
+	}
+	k := 1
+	for k*2 < len(leaves) {
+		k *= 2
+	}
+	if index < k {
+		return append(inclusionProof(index, leaves[:k]), hashTree(leaves[k:]))
+	}
+	return append(inclusionProof(index-k, leaves[k:]), hashTree(leaves[:k]))
+}
+
+// bundle returns a Sigstore bundle JSON document of a signature of artifact.
+func (in *testInfra) bundle(t *testing.T, artifact []byte, o bundleOpts) []byte {
+	t.Helper()
+
+	if o.identity == "" {
+		o.identity = testIdentity
+	}
+	if o.issuer == "" {
+		o.issuer = testIssuer
+	}
+	if o.signTime.IsZero() {
+		o.signTime = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	}
+	if o.checkpointBy == nil {
+		o.checkpointBy = in.logKey
+	}
+
+	// short-lived signing certificate
+	key := newKey(t)
+	exts, err := certificate.Extensions{Issuer: o.issuer}.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := createCert(t, &x509.Certificate{
+		SerialNumber:    big.NewInt(3),
+		NotBefore:       o.signTime.Add(-time.Minute),
+		NotAfter:        o.signTime.Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses:  []string{o.identity},
+		ExtraExtensions: exts,
+	}, in.ca, key.Public(), in.caKey)
+
+	digest := sha256.Sum256(artifact)
+	sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// transparency log entry
+	pemCert, err := cryptoutils.MarshalCertificateToPEM(leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body hashedRekord
+	body.APIVersion = "0.0.1"
+	body.Kind = "hashedrekord"
+	body.Spec.Data.Hash.Algorithm = "sha256"
+	body.Spec.Data.Hash.Value = hex.EncodeToString(digest[:])
+	body.Spec.Signature.Content = base64.StdEncoding.EncodeToString(sig)
+	body.Spec.Signature.PublicKey.Content = base64.StdEncoding.EncodeToString(pemCert)
+	canonicalBody, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const logIndex = 5
+	integratedTime := o.signTime.Unix()
+
+	setKey := in.logKey
+	if o.otherLogSET {
+		setKey = newKey(t)
+	}
+	payload, err := json.Marshal(setPayload{
+		Body:           base64.StdEncoding.EncodeToString(canonicalBody),
+		IntegratedTime: integratedTime,
+		LogID:          hex.EncodeToString(in.logID),
+		LogIndex:       logIndex,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadDigest := sha256.Sum256(payload)
+	set, err := setKey.Sign(rand.Reader, payloadDigest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := &protorekor.TransparencyLogEntry{
+		LogIndex:          logIndex,
+		LogId:             &protocommon.LogId{KeyId: in.logID},
+		KindVersion:       &protorekor.KindVersion{Kind: "hashedrekord", Version: "0.0.1"},
+		IntegratedTime:    integratedTime,
+		InclusionPromise:  &protorekor.InclusionPromise{SignedEntryTimestamp: set},
+		CanonicalizedBody: canonicalBody,
+	}
+
+	if !o.noProof {
+		// tree of 7 entries, the signature being the 3rd one
+		const treeIndex = 2
+		var leaves [][]byte
+		for i := 0; i < 7; i++ {
+			if i == treeIndex {
+				leaves = append(leaves, hashLeaf(canonicalBody))
+			} else {
+				leaves = append(leaves, hashLeaf([]byte(fmt.Sprintf("entry %d", i))))
+			}
+		}
+		root := hashTree(leaves)
+		proof := inclusionProof(treeIndex, leaves)
+		if o.tamperProof {
+			proof[0] = hashLeaf([]byte("tampered"))
+		}
+
+		text := fmt.Sprintf("rekor.example.com - 1\n%d\n%s\n", len(leaves), base64.StdEncoding.EncodeToString(root))
+		textDigest := sha256.Sum256([]byte(text))
+		noteSig, err := o.checkpointBy.Sign(rand.Reader, textDigest[:], crypto.SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkpoint := fmt.Sprintf("%s\n— rekor.example.com %s\n", text, base64.StdEncoding.EncodeToString(append(in.logID[:4:4], noteSig...)))
+
+		entry.InclusionProof = &protorekor.InclusionProof{
+			LogIndex:   treeIndex,
+			RootHash:   root,
+			TreeSize:   int64(len(leaves)),
+			Hashes:     proof,
+			Checkpoint: &protorekor.Checkpoint{Envelope: checkpoint},
+		}
+	}
+
+	b := &protobundle.Bundle{
+		MediaType: "application/vnd.dev.sigstore.bundle.v0.3+json",
+		VerificationMaterial: &protobundle.VerificationMaterial{
+			Content: &protobundle.VerificationMaterial_Certificate{
+				Certificate: &protocommon.X509Certificate{RawBytes: leaf.Raw},
+			},
+			TlogEntries: []*protorekor.TransparencyLogEntry{entry},
+		},
+		Content: &protobundle.Bundle_MessageSignature{
+			MessageSignature: &protocommon.MessageSignature{
+				MessageDigest: &protocommon.HashOutput{
+					Algorithm: protocommon.HashAlgorithm_SHA2_256,
+					Digest:    digest[:],
+				},
+				Signature: sig,
+			},
+		},
+	}
+	j, err := protojson.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+func TestVerify(t *testing.T) {
+	in := newTestInfra(t)
+	tr, err := ParseTrustedRoot(in.trustedRoot(t))
+	if err != nil {
+		t.Fatalf("failed to parse trusted root: %v", err)
+	}
+	otherTR, err := ParseTrustedRoot(newTestInfra(t).trustedRoot(t))
+	if err != nil {
+		t.Fatalf("failed to parse trusted root: %v", err)
+	}
+
+	artifact := []byte("image contents")
+	id := Identity{SubjectAlternativeName: testIdentity, Issuer: testIssuer}
+
+	tests := []struct {
+		name        string
+		opts        bundleOpts
+		artifact    []byte
+		trustedRoot *TrustedRoot
+		identity    Identity
+		wantErr     string
+	}{
+		{
+			name: "Valid",
+		},
+		{
+			name: "NoInclusionProof",
+			opts: bundleOpts{noProof: true},
+		},
+		{
+			name:     "OtherArtifact",
+			artifact: []byte("other contents"),
+			wantErr:  "digest mismatch",
+		},
+		{
+			name:     "OtherIdentity",
+			identity: Identity{SubjectAlternativeName: "other@example.com", Issuer: testIssuer},
+			wantErr:  "doesn't match",
+		},
+		{
+			name:     "OtherIssuer",
+			identity: Identity{SubjectAlternativeName: testIdentity, Issuer: "https://other.example.com"},
+			wantErr:  "OIDC issuer",
+		},
+		{
+			name:        "OtherTrustedRoot",
+			trustedRoot: otherTR,
+			wantErr:     "unknown transparency log",
+		},
+		{
+			name:    "InvalidSET",
+			opts:    bundleOpts{otherLogSET: true},
+			wantErr: "invalid signed entry timestamp",
+		},
+		{
+			name:    "TamperedInclusionProof",
+			opts:    bundleOpts{tamperProof: true},
+			wantErr: "root hash mismatch",
+		},
+		{
+			name:    "CheckpointNotSignedByLog",
+			opts:    bundleOpts{checkpointBy: newKey(t)},
+			wantErr: "invalid checkpoint",
+		},
+		{
+			name:    "SignedBeforeCertificateAuthority",
+			opts:    bundleOpts{signTime: time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)},
+			wantErr: "not valid at",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := ParseBundle(in.bundle(t, artifact, tt.opts))
+			if err != nil {
+				t.Fatalf("failed to parse bundle: %v", err)
+			}
+
+			a := artifact
+			if tt.artifact != nil {
+				a = tt.artifact
+			}
+			r := tr
+			if tt.trustedRoot != nil {
+				r = tt.trustedRoot
+			}
+			i := id
+			if tt.identity != (Identity{}) {
+				i = tt.identity
+			}
+
+			res, err := Verify(b, bytes.NewReader(a), r, i)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.LogIndex != 5 {
+				t.Errorf("got log index %d, want 5", res.LogIndex)
+			}
+			if res.Certificate == nil || res.Certificate.EmailAddresses[0] != testIdentity {
+				t.Errorf("unexpected certificate %v", res.Certificate)
+			}
+		})
+	}
+}
+
+func TestParseBundle(t *testing.T) {
+	if _, err := ParseBundle([]byte(`{"mediaType": "application/json"}`)); err == nil {
+		t.Errorf("unexpected success with other media type")
+	}
+	if _, err := ParseBundle([]byte(`not json`)); err == nil {
+		t.Errorf("unexpected success with invalid JSON")
+	}
+}
+
+func TestRootFromInclusionProof(t *testing.T) {
+	for size := 1; size <= 17; size++ {
+		var leaves [][]byte
+		for i := 0; i < size; i++ {
+			leaves = append(leaves, hashLeaf([]byte{byte(i)}))
+		}
+		want := hashTree(leaves)
+		for i := range leaves {
+			got, err := rootFromInclusionProof(uint64(i), uint64(size), leaves[i], inclusionProof(i, leaves))
+			if err != nil {
+				t.Fatalf("size %d, index %d: unexpected error: %v", size, i, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("size %d, index %d: root mismatch", size, i)
+			}
+		}
+	}
+}
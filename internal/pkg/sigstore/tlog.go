@@ -0,0 +1,245 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sigstore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	protorekor "github.com/sigstore/protobuf-specs/gen/pb-go/rekor/v1"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+// hashedRekord is the body of a hashedrekord transparency log entry.
+type hashedRekord struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content   string `json:"content"`
+			PublicKey struct {
+				Content string `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// checkBody checks that the body of the transparency log entry e logs the signature sig of the
+// artifact digest by the certificate c.
+func checkBody(e *protorekor.TransparencyLogEntry, c *x509.Certificate, sig, digest []byte, h crypto.Hash) error {
+	if k := e.GetKindVersion().GetKind(); k != "hashedrekord" {
+		return fmt.Errorf("unsupported transparency log entry kind %q", k)
+	}
+
+	var body hashedRekord
+	if err := json.Unmarshal(e.GetCanonicalizedBody(), &body); err != nil {
+		return fmt.Errorf("invalid transparency log entry: %w", err)
+	}
+	if body.Kind != "hashedrekord" {
+		return fmt.Errorf("unsupported transparency log entry kind %q", body.Kind)
+	}
+
+	alg := strings.ToLower(strings.ReplaceAll(h.String(), "-", ""))
+	if body.Spec.Data.Hash.Algorithm != alg || body.Spec.Data.Hash.Value != hex.EncodeToString(digest) {
+		return errors.New("transparency log entry is not for the artifact")
+	}
+
+	logged, err := base64.StdEncoding.DecodeString(body.Spec.Signature.Content)
+	if err != nil || !bytes.Equal(logged, sig) {
+		return errors.New("transparency log entry is not for the signature")
+	}
+
+	pemCert, err := base64.StdEncoding.DecodeString(body.Spec.Signature.PublicKey.Content)
+	if err != nil {
+		return fmt.Errorf("invalid transparency log entry: %w", err)
+	}
+	certs, err := cryptoutils.UnmarshalCertificatesFromPEM(pemCert)
+	if err != nil || len(certs) == 0 || !certs[0].Equal(c) {
+		return errors.New("transparency log entry is not for the certificate")
+	}
+	return nil
+}
+
+// setPayload is the payload of a signed entry timestamp, its fields sorted to marshal to
+// canonical JSON.
+type setPayload struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+}
+
+// verifySET verifies the signed entry timestamp of the transparency log entry e, promising the
+// inclusion of the entry at its integrated time.
+func verifySET(e *protorekor.TransparencyLogEntry, l transparencyLog) error {
+	set := e.GetInclusionPromise().GetSignedEntryTimestamp()
+	if len(set) == 0 {
+		return errors.New("transparency log entry has no signed entry timestamp")
+	}
+
+	payload, err := json.Marshal(setPayload{
+		Body:           base64.StdEncoding.EncodeToString(e.GetCanonicalizedBody()),
+		IntegratedTime: e.GetIntegratedTime(),
+		LogID:          hex.EncodeToString(l.id),
+		LogIndex:       e.GetLogIndex(),
+	})
+	if err != nil {
+		return err
+	}
+
+	v, err := signature.LoadVerifier(l.key, crypto.SHA256)
+	if err != nil {
+		return err
+	}
+	if err := v.VerifySignature(bytes.NewReader(set), bytes.NewReader(payload)); err != nil {
+		return fmt.Errorf("invalid signed entry timestamp: %w", err)
+	}
+	return nil
+}
+
+// verifyInclusionProof verifies the inclusion proof of the transparency log entry e, and its
+// checkpoint signed by the log.
+func verifyInclusionProof(e *protorekor.TransparencyLogEntry, l transparencyLog) error {
+	p := e.GetInclusionProof()
+	if p.GetLogIndex() < 0 || p.GetTreeSize() <= 0 || p.GetLogIndex() >= p.GetTreeSize() {
+		return fmt.Errorf("invalid inclusion proof: index %d not in tree of size %d", p.GetLogIndex(), p.GetTreeSize())
+	}
+
+	leaf := hashLeaf(e.GetCanonicalizedBody())
+	root, err := rootFromInclusionProof(uint64(p.GetLogIndex()), uint64(p.GetTreeSize()), leaf, p.GetHashes())
+	if err != nil {
+		return fmt.Errorf("invalid inclusion proof: %w", err)
+	}
+	if !bytes.Equal(root, p.GetRootHash()) {
+		return errors.New("invalid inclusion proof: root hash mismatch")
+	}
+
+	size, checkpointRoot, err := verifyCheckpoint(p.GetCheckpoint().GetEnvelope(), l)
+	if err != nil {
+		return err
+	}
+	if size != uint64(p.GetTreeSize()) || !bytes.Equal(checkpointRoot, root) {
+		return errors.New("invalid inclusion proof: checkpoint is not for the proven tree")
+	}
+	return nil
+}
+
+// verifyCheckpoint verifies the signed note checkpoint, signed by the log l, and returns the
+// tree size and root hash it commits to.
+func verifyCheckpoint(checkpoint string, l transparencyLog) (uint64, []byte, error) {
+	text, sigs, ok := strings.Cut(checkpoint, "\n\n")
+	if !ok {
+		return 0, nil, errors.New("invalid checkpoint: no signature")
+	}
+	text += "\n"
+
+	der, err := x509.MarshalPKIXPublicKey(l.key)
+	if err != nil {
+		return 0, nil, err
+	}
+	keyHash := sha256.Sum256(der)
+
+	v, err := signature.LoadVerifier(l.key, crypto.SHA256)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	verified := false
+	for _, line := range strings.Split(strings.TrimSuffix(sigs, "\n"), "\n") {
+		// — <name> <base64(key hint || signature)>
+		fields := strings.Fields(strings.TrimPrefix(line, "— "))
+		if len(fields) != 2 {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(b) < 5 || !bytes.Equal(b[:4], keyHash[:4]) {
+			continue
+		}
+		if v.VerifySignature(bytes.NewReader(b[4:]), strings.NewReader(text)) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return 0, nil, errors.New("invalid checkpoint: no valid signature of the transparency log")
+	}
+
+	lines := strings.Split(text, "\n")
+	if len(lines) < 3 {
+		return 0, nil, errors.New("invalid checkpoint")
+	}
+	size, err := strconv.ParseUint(lines[1], 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid checkpoint: %w", err)
+	}
+	root, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid checkpoint: %w", err)
+	}
+	return size, root, nil
+}
+
+// hashLeaf returns the RFC 6962 Merkle tree hash of the leaf data.
+func hashLeaf(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// hashChildren returns the RFC 6962 Merkle tree hash of the node with children l and r.
+func hashChildren(l, r []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(l)
+	h.Write(r)
+	return h.Sum(nil)
+}
+
+// rootFromInclusionProof returns the root hash of the tree of the given size, computed from the
+// hash of the leaf at index and its RFC 6962 inclusion proof.
+func rootFromInclusionProof(index, size uint64, leaf []byte, proof [][]byte) ([]byte, error) {
+	// the proof holds the siblings below the node where the paths to the leaf and to the last
+	// leaf diverge, then the left siblings on the right border of the tree
+	inner := bits.Len64(index ^ (size - 1))
+	border := bits.OnesCount64(index >> uint(inner))
+	if len(proof) != inner+border {
+		return nil, fmt.Errorf("wrong proof size %d, want %d", len(proof), inner+border)
+	}
+
+	seed := leaf
+	for i, h := range proof[:inner] {
+		if (index>>uint(i))&1 == 0 {
+			seed = hashChildren(seed, h)
+		} else {
+			seed = hashChildren(h, seed)
+		}
+	}
+	for _, h := range proof[inner:] {
+		seed = hashChildren(h, seed)
+	}
+	return seed, nil
+}
@@ -0,0 +1,150 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sigstore
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	protocommon "github.com/sigstore/protobuf-specs/gen/pb-go/common/v1"
+	prototrustroot "github.com/sigstore/protobuf-specs/gen/pb-go/trustroot/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// TrustedRoot holds the certificate authorities and transparency logs trusted to verify
+// bundles.
+type TrustedRoot struct {
+	cas   []certificateAuthority
+	tlogs map[string]transparencyLog
+}
+
+// certificateAuthority is a Fulcio-style certificate authority.
+type certificateAuthority struct {
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+	validFor      *protocommon.TimeRange
+}
+
+// transparencyLog is a Rekor-style transparency log.
+type transparencyLog struct {
+	id       []byte
+	key      crypto.PublicKey
+	validFor *protocommon.TimeRange
+}
+
+// LoadTrustedRoot loads the trusted root JSON file at path.
+func LoadTrustedRoot(path string) (*TrustedRoot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTrustedRoot(b)
+}
+
+// ParseTrustedRoot parses the trusted root JSON document b.
+func ParseTrustedRoot(b []byte) (*TrustedRoot, error) {
+	var pb prototrustroot.TrustedRoot
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(b, &pb); err != nil {
+		return nil, fmt.Errorf("invalid trusted root: %w", err)
+	}
+
+	tr := TrustedRoot{
+		tlogs: make(map[string]transparencyLog),
+	}
+
+	for _, ca := range pb.GetCertificateAuthorities() {
+		certs := ca.GetCertChain().GetCertificates()
+		if len(certs) == 0 {
+			return nil, fmt.Errorf("invalid trusted root: certificate authority %q has no certificate", ca.GetUri())
+		}
+
+		c := certificateAuthority{
+			roots:         x509.NewCertPool(),
+			intermediates: x509.NewCertPool(),
+			validFor:      ca.GetValidFor(),
+		}
+		// the chain is ordered from the issuing certificate to the root
+		for i, pc := range certs {
+			cert, err := x509.ParseCertificate(pc.GetRawBytes())
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted root: certificate authority %q: %w", ca.GetUri(), err)
+			}
+			if i == len(certs)-1 {
+				c.roots.AddCert(cert)
+			} else {
+				c.intermediates.AddCert(cert)
+			}
+		}
+		tr.cas = append(tr.cas, c)
+	}
+
+	for _, tl := range pb.GetTlogs() {
+		pub, err := x509.ParsePKIXPublicKey(tl.GetPublicKey().GetRawBytes())
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted root: transparency log %q: %w", tl.GetBaseUrl(), err)
+		}
+		id := tl.GetLogId().GetKeyId()
+		if len(id) == 0 {
+			return nil, fmt.Errorf("invalid trusted root: transparency log %q has no log ID", tl.GetBaseUrl())
+		}
+		tr.tlogs[hex.EncodeToString(id)] = transparencyLog{
+			id:       id,
+			key:      pub,
+			validFor: tl.GetPublicKey().GetValidFor(),
+		}
+	}
+
+	if len(tr.cas) == 0 {
+		return nil, errors.New("invalid trusted root: no certificate authority")
+	}
+	if len(tr.tlogs) == 0 {
+		return nil, errors.New("invalid trusted root: no transparency log")
+	}
+	return &tr, nil
+}
+
+// validAt returns true if t is in the time range r, unbounded when r or its end are not set.
+func validAt(r *protocommon.TimeRange, t time.Time) bool {
+	if r == nil {
+		return true
+	}
+	if r.GetStart() != nil && t.Before(r.GetStart().AsTime()) {
+		return false
+	}
+	if r.GetEnd() != nil && t.After(r.GetEnd().AsTime()) {
+		return false
+	}
+	return true
+}
+
+// verifyCertificate verifies that c is a code signing certificate issued by a certificate
+// authority of tr, valid at time t.
+func (tr *TrustedRoot) verifyCertificate(c *x509.Certificate, t time.Time) error {
+	err := errors.New("no certificate authority valid at the signing time")
+	for _, ca := range tr.cas {
+		if !validAt(ca.validFor, t) {
+			continue
+		}
+		_, err = c.Verify(x509.VerifyOptions{
+			Roots:         ca.roots,
+			Intermediates: ca.intermediates,
+			CurrentTime:   t,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		})
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("while verifying certificate: %w", err)
+}
@@ -0,0 +1,248 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sshsig
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// AllowedSigner is an entry of an OpenSSH allowed signers file, see the
+// ALLOWED SIGNERS section of ssh-keygen(1).
+type AllowedSigner struct {
+	// Principals is the list of principal patterns of the signer.
+	Principals []string
+	// CertAuthority is set when Key is a certificate authority key, which
+	// signed the certificates of the signers.
+	CertAuthority bool
+	// Namespaces is the optional list of namespace patterns the signer is
+	// allowed to sign.
+	Namespaces []string
+	// ValidAfter and ValidBefore, if not zero, restrict the validity period
+	// of the key.
+	ValidAfter  time.Time
+	ValidBefore time.Time
+	Key         ssh.PublicKey
+}
+
+// AllowedSigners is the list of entries of an allowed signers file.
+type AllowedSigners []AllowedSigner
+
+// LoadAllowedSigners reads the allowed signers file at path.
+func LoadAllowedSigners(path string) (AllowedSigners, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	as, err := ParseAllowedSigners(f)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing %s: %w", path, err)
+	}
+	return as, nil
+}
+
+// ParseAllowedSigners parses an allowed signers file.
+func ParseAllowedSigners(r io.Reader) (AllowedSigners, error) {
+	var as AllowedSigners
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		s, err := parseAllowedSigner(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		as = append(as, s)
+	}
+	return as, scanner.Err()
+}
+
+// parseAllowedSigner parses an allowed signers line, made of principals
+// followed by a key in the authorized_keys format, with options.
+func parseAllowedSigner(line []byte) (AllowedSigner, error) {
+	var s AllowedSigner
+
+	principals, rest, err := splitPrincipals(string(line))
+	if err != nil {
+		return s, err
+	}
+	s.Principals = strings.Split(principals, ",")
+
+	key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(rest))
+	if err != nil {
+		return s, fmt.Errorf("invalid key: %w", err)
+	}
+	s.Key = key
+
+	for _, o := range options {
+		name, value, _ := strings.Cut(o, "=")
+		value = strings.Trim(value, `"`)
+
+		switch strings.ToLower(name) {
+		case "cert-authority":
+			s.CertAuthority = true
+		case "namespaces":
+			s.Namespaces = strings.Split(value, ",")
+		case "valid-after":
+			s.ValidAfter, err = parseTime(value)
+		case "valid-before":
+			s.ValidBefore, err = parseTime(value)
+		default:
+			return s, fmt.Errorf("unknown option %q", name)
+		}
+		if err != nil {
+			return s, fmt.Errorf("invalid %s option: %w", name, err)
+		}
+	}
+	return s, nil
+}
+
+// splitPrincipals splits the principals, which may be quoted, from the
+// rest of an allowed signers line.
+func splitPrincipals(line string) (principals, rest string, err error) {
+	if strings.HasPrefix(line, `"`) {
+		end := strings.Index(line[1:], `"`)
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated quoted principals")
+		}
+		return line[1 : end+1], strings.TrimSpace(line[end+2:]), nil
+	}
+	principals, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		principals, rest, ok = strings.Cut(line, "\t")
+	}
+	if !ok {
+		return "", "", fmt.Errorf("missing key")
+	}
+	return principals, strings.TrimSpace(rest), nil
+}
+
+// parseTime parses a time of the valid-after and valid-before options in
+// the YYYYMMDD[HHMM[SS]][Z] format, in UTC with the Z suffix or in the
+// local time zone.
+func parseTime(s string) (time.Time, error) {
+	loc := time.Local
+	if strings.HasSuffix(s, "Z") {
+		s = strings.TrimSuffix(s, "Z")
+		loc = time.UTC
+	}
+	for _, layout := range []string{"20060102", "200601021504", "20060102150405"} {
+		if len(s) == len(layout) {
+			return time.ParseInLocation(layout, s, loc)
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// matchPatternList returns whether s matches the comma separated patterns,
+// with the * and ? wildcards, where a pattern prefixed with ! negates the
+// match, like OpenSSH match_pattern_list.
+func matchPatternList(s string, patterns []string) bool {
+	matched := false
+	for _, p := range patterns {
+		negated := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+		// path.Match also handles character classes, which OpenSSH
+		// doesn't, escape them
+		p = strings.NewReplacer("[", `\[`, "]", `\]`, `\`, `\\`).Replace(p)
+		if ok, _ := path.Match(p, s); !ok {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// allows returns whether the signer is allowed to sign in namespace at t,
+// as principal if not empty.
+func (s AllowedSigner) allows(principal, namespace string, t time.Time) bool {
+	if principal != "" && !matchPatternList(principal, s.Principals) {
+		return false
+	}
+	if len(s.Namespaces) > 0 && !matchPatternList(namespace, s.Namespaces) {
+		return false
+	}
+	if !s.ValidAfter.IsZero() && t.Before(s.ValidAfter) {
+		return false
+	}
+	if !s.ValidBefore.IsZero() && t.After(s.ValidBefore) {
+		return false
+	}
+	return true
+}
+
+// accept checks that the key pub, which made a signature, is the signer
+// key, or a valid certificate signed by the signer authority key for
+// principal if not empty, or for one of the signer principals.
+func (s AllowedSigner) accept(pub ssh.PublicKey, principal string) error {
+	if !s.CertAuthority {
+		if bytes.Equal(pub.Marshal(), s.Key.Marshal()) {
+			return nil
+		}
+		return errKeyNotAllowed
+	}
+
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return fmt.Errorf("%w: not a certificate", errKeyNotAllowed)
+	}
+	if !bytes.Equal(cert.SignatureKey.Marshal(), s.Key.Marshal()) {
+		return fmt.Errorf("%w: certificate not signed by the certificate authority", errKeyNotAllowed)
+	}
+	if cert.CertType != ssh.UserCert {
+		return fmt.Errorf("%w: not a user certificate", errKeyNotAllowed)
+	}
+
+	principals := []string{principal}
+	if principal == "" {
+		principals = cert.ValidPrincipals
+	}
+	for _, p := range principals {
+		if !matchPatternList(p, s.Principals) {
+			continue
+		}
+		checker := ssh.CertChecker{}
+		if err := checker.CheckCert(p, cert); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: certificate not valid for the allowed principals", errKeyNotAllowed)
+}
+
+// Verifiers returns the verifiers of SSH signatures in namespace by the
+// signers allowed at t, as principal if not empty.
+func (as AllowedSigners) Verifiers(principal, namespace string, t time.Time) []*Verifier {
+	var vs []*Verifier
+	for _, s := range as {
+		if s.allows(principal, namespace, t) {
+			vs = append(vs, &Verifier{
+				as:        s,
+				principal: principal,
+				namespace: namespace,
+			})
+		}
+	}
+	return vs
+}
@@ -0,0 +1,173 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sshsig
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func authorizedKey(s ssh.Signer) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(s.PublicKey())))
+}
+
+func TestParseAllowedSigners(t *testing.T) {
+	key := authorizedKey(getTestSigner(t, "ed25519-private.pem"))
+
+	tests := []struct {
+		name    string
+		line    string
+		want    AllowedSigner
+		wantErr bool
+	}{
+		{
+			name: "Simple",
+			line: "user@example.com " + key,
+			want: AllowedSigner{Principals: []string{"user@example.com"}},
+		},
+		{
+			name: "Options",
+			line: `*@example.com,!admin@example.com cert-authority,namespaces="apptainer,git",valid-after="20240101",valid-before="20300101120000Z" ` + key + " comment",
+			want: AllowedSigner{
+				Principals:    []string{"*@example.com", "!admin@example.com"},
+				CertAuthority: true,
+				Namespaces:    []string{"apptainer", "git"},
+				ValidAfter:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local),
+				ValidBefore:   time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "QuotedPrincipals",
+			line: `"user@example.com,other@example.com" ` + key,
+			want: AllowedSigner{Principals: []string{"user@example.com", "other@example.com"}},
+		},
+		{"MissingKey", "user@example.com", AllowedSigner{}, true},
+		{"InvalidKey", "user@example.com ssh-ed25519 invalid", AllowedSigner{}, true},
+		{"UnknownOption", "user@example.com unknown " + key, AllowedSigner{}, true},
+		{"InvalidTime", `user@example.com valid-after="2024" ` + key, AllowedSigner{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := strings.NewReader("# comment\n\n" + tt.line + "\n")
+			as, err := ParseAllowedSigners(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got err %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(as) != 1 {
+				t.Fatalf("got %d allowed signers, want 1", len(as))
+			}
+			got := as[0]
+			if got.Key == nil {
+				t.Fatalf("missing key")
+			}
+			got.Key = nil
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got allowed signer %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchPatternList(t *testing.T) {
+	tests := []struct {
+		s        string
+		patterns string
+		want     bool
+	}{
+		{"user@example.com", "user@example.com", true},
+		{"user@example.com", "*@example.com", true},
+		{"user@example.com", "use?@example.com", true},
+		{"user@example.com", "*@example.org", false},
+		{"admin@example.com", "*@example.com,!admin@example.com", false},
+		{"[user]", "[user]", true},
+	}
+	for _, tt := range tests {
+		if got := matchPatternList(tt.s, strings.Split(tt.patterns, ",")); got != tt.want {
+			t.Errorf("matchPatternList(%q, %q) = %v, want %v", tt.s, tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestVerifiers(t *testing.T) {
+	user := getTestSigner(t, "ed25519-private.pem")
+	other := getTestSigner(t, "ecdsa-private.pem")
+	ca := getTestSigner(t, "rsa-private.pem")
+
+	// a certificate of the other key for the ci@example.com principal
+	cert := &ssh.Certificate{
+		Key:             other.PublicKey(),
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"ci@example.com"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	certSigner, err := ssh.NewCertSigner(cert, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allowed := strings.Join([]string{
+		"user@example.com " + authorizedKey(user),
+		`old@example.com valid-before="20000101" ` + authorizedKey(other),
+		`git@example.com namespaces="git" ` + authorizedKey(other),
+		`*@example.com cert-authority,namespaces="apptainer" ` + authorizedKey(ca),
+	}, "\n")
+	as, err := ParseAllowedSigners(strings.NewReader(allowed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		s         ssh.Signer
+		principal string
+		wantErr   bool
+	}{
+		{"User", user, "", false},
+		{"UserPrincipal", user, "user@example.com", false},
+		{"UserWrongPrincipal", user, "other@example.com", true},
+		{"ExpiredOrWrongNamespace", other, "", true},
+		{"Certificate", certSigner, "", false},
+		{"CertificatePrincipal", certSigner, "ci@example.com", false},
+		{"CertificateWrongPrincipal", certSigner, "user@example.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := Sign(tt.s, "apptainer", strings.NewReader("message"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var verr error = errKeyNotAllowed
+			for _, v := range as.Verifiers(tt.principal, "apptainer", time.Now()) {
+				if verr = v.VerifySignature(bytes.NewReader(sig), strings.NewReader("message")); verr == nil {
+					break
+				}
+			}
+			if (verr != nil) != tt.wantErr {
+				t.Errorf("got err %v, wantErr %v", verr, tt.wantErr)
+			}
+			if verr != nil && !errors.Is(verr, errKeyNotAllowed) {
+				t.Errorf("got error %v, want %v", verr, errKeyNotAllowed)
+			}
+		})
+	}
+}
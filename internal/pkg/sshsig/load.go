@@ -0,0 +1,121 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sshsig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// PassphraseFunc returns the passphrase of an encrypted private key.
+type PassphraseFunc func() ([]byte, error)
+
+// LoadSigner returns a signer for the SSH key at path, which is either a
+// private key or, when the private key is held by an SSH agent, a public
+// key. When the SSH agent of SSH_AUTH_SOCK holds the key, it signs in place
+// of the private key, otherwise an encrypted private key is decrypted with
+// the passphrase returned by passphrase. The returned function releases the
+// agent connection.
+func LoadSigner(path string, passphrase PassphraseFunc) (ssh.Signer, func(), error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pub, priv := loadPublicKey(path, data)
+
+	if pub != nil {
+		if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+			conn, err := net.Dial("unix", sock)
+			if err != nil {
+				sylog.Debugf("Could not connect to SSH agent: %s", err)
+			} else {
+				s, err := AgentSigner(agent.NewClient(conn), pub)
+				if err == nil {
+					sylog.Debugf("Signing with SSH agent key %s", ssh.FingerprintSHA256(pub))
+					return s, func() { conn.Close() }, nil
+				}
+				conn.Close()
+				sylog.Debugf("Could not use SSH agent: %s", err)
+			}
+		}
+	}
+
+	if priv == nil {
+		return nil, nil, fmt.Errorf("%s is a public key, and its private key is not held by an SSH agent", path)
+	}
+
+	s, err := ssh.ParsePrivateKey(priv)
+	var pme *ssh.PassphraseMissingError
+	if errors.As(err, &pme) {
+		if passphrase == nil {
+			return nil, nil, fmt.Errorf("%s is encrypted", path)
+		}
+		p, perr := passphrase()
+		if perr != nil {
+			return nil, nil, perr
+		}
+		s, err = ssh.ParsePrivateKeyWithPassphrase(priv, p)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("while parsing SSH private key %s: %w", path, err)
+	}
+	return s, func() {}, nil
+}
+
+// loadPublicKey returns the public key of the SSH key file at path holding
+// data, and its private key data if it's a private key. The public key of a
+// private key is read from the .pub file next to it, or from the private
+// key file itself.
+func loadPublicKey(path string, data []byte) (ssh.PublicKey, []byte) {
+	if pub, _, _, _, err := ssh.ParseAuthorizedKey(data); err == nil {
+		return pub, nil
+	}
+
+	if !strings.HasSuffix(path, ".pub") {
+		if b, err := os.ReadFile(path + ".pub"); err == nil {
+			if pub, _, _, _, err := ssh.ParseAuthorizedKey(b); err == nil {
+				return pub, data
+			}
+		}
+	}
+
+	s, err := ssh.ParsePrivateKey(data)
+	if err == nil {
+		return s.PublicKey(), data
+	}
+	// the public key of encrypted OpenSSH keys is not encrypted
+	var pme *ssh.PassphraseMissingError
+	if errors.As(err, &pme) && pme.PublicKey != nil {
+		return pme.PublicKey, data
+	}
+	return nil, data
+}
+
+// AgentSigner returns the signer of the SSH agent a for the key pub.
+func AgentSigner(a agent.Agent, pub ssh.PublicKey) (ssh.Signer, error) {
+	signers, err := a.Signers()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range signers {
+		if bytes.Equal(s.PublicKey().Marshal(), pub.Marshal()) {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("key %s not found in SSH agent", ssh.FingerprintSHA256(pub))
+}
@@ -0,0 +1,247 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package sshsig implements SSH signatures, in the format of 'ssh-keygen -Y
+// sign' described in the OpenSSH PROTOCOL.sshsig file, as sigstore signers
+// and verifiers, and the OpenSSH allowed signers file format.
+package sshsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/sigstore/sigstore/pkg/signature"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	magicPreamble = "SSHSIG"
+	sigVersion    = 1
+	hashAlgorithm = "sha512"
+)
+
+var (
+	errInvalidSignature = errors.New("invalid SSH signature")
+	errKeyNotAllowed    = errors.New("SSH signature key is not allowed")
+)
+
+// signedData is the data signed by the SSH key, following the magic
+// preamble.
+type signedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// blob is the SSH signature blob, following the magic preamble.
+type blob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// messageData returns the data signed for the message read from r, in
+// namespace, hashed with hashAlg.
+func messageData(namespace, hashAlg string, r io.Reader) ([]byte, error) {
+	var h hash.Hash
+	switch hashAlg {
+	case "sha512":
+		h = sha512.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return nil, fmt.Errorf("%w: unsupported hash algorithm %q", errInvalidSignature, hashAlg)
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	sd := ssh.Marshal(signedData{
+		Namespace:     namespace,
+		HashAlgorithm: hashAlg,
+		Hash:          h.Sum(nil),
+	})
+	return append([]byte(magicPreamble), sd...), nil
+}
+
+// Sign returns the SSH signature blob of the message read from r, in
+// namespace, signed by s.
+func Sign(s ssh.Signer, namespace string, r io.Reader) ([]byte, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("SSH signature namespace is required")
+	}
+	data, err := messageData(namespace, hashAlgorithm, r)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := s.PublicKey()
+
+	var sig *ssh.Signature
+	// ssh-rsa signatures use SHA-1, sign with SHA-512 like ssh-keygen
+	if as, ok := s.(ssh.AlgorithmSigner); ok && isRSA(pub) {
+		sig, err = as.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = s.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("while signing with SSH key: %w", err)
+	}
+
+	b := ssh.Marshal(blob{
+		Version:       sigVersion,
+		PublicKey:     pub.Marshal(),
+		Namespace:     namespace,
+		HashAlgorithm: hashAlgorithm,
+		Signature:     ssh.Marshal(sig),
+	})
+	return append([]byte(magicPreamble), b...), nil
+}
+
+// parse parses an SSH signature blob.
+func parse(sig []byte) (*blob, ssh.PublicKey, *ssh.Signature, error) {
+	if !bytes.HasPrefix(sig, []byte(magicPreamble)) {
+		return nil, nil, nil, errInvalidSignature
+	}
+	var b blob
+	if err := ssh.Unmarshal(sig[len(magicPreamble):], &b); err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %s", errInvalidSignature, err)
+	}
+	if b.Version != sigVersion {
+		return nil, nil, nil, fmt.Errorf("%w: unsupported version %d", errInvalidSignature, b.Version)
+	}
+	pub, err := ssh.ParsePublicKey(b.PublicKey)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %s", errInvalidSignature, err)
+	}
+	s := new(ssh.Signature)
+	if err := ssh.Unmarshal(b.Signature, s); err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %s", errInvalidSignature, err)
+	}
+	return &b, pub, s, nil
+}
+
+// Verify verifies the SSH signature blob sig of the message read from r in
+// namespace, and returns the public key which made it.
+func Verify(sig []byte, namespace string, r io.Reader) (ssh.PublicKey, error) {
+	b, pub, s, err := parse(sig)
+	if err != nil {
+		return nil, err
+	}
+	if b.Namespace != namespace {
+		return nil, fmt.Errorf("%w: namespace %q, expected %q", errInvalidSignature, b.Namespace, namespace)
+	}
+	if s.Format == ssh.KeyAlgoRSA {
+		return nil, fmt.Errorf("%w: SHA-1 RSA signatures are not supported", errInvalidSignature)
+	}
+
+	data, err := messageData(b.Namespace, b.HashAlgorithm, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := pub.Verify(data, s); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidSignature, err)
+	}
+	return pub, nil
+}
+
+// isRSA returns whether pub is an RSA key or certificate.
+func isRSA(pub ssh.PublicKey) bool {
+	if c, ok := pub.(*ssh.Certificate); ok {
+		pub = c.Key
+	}
+	return pub.Type() == ssh.KeyAlgoRSA
+}
+
+// cryptoPublicKey returns the crypto.PublicKey of an SSH key or certificate.
+func cryptoPublicKey(pub ssh.PublicKey) (crypto.PublicKey, error) {
+	if c, ok := pub.(*ssh.Certificate); ok {
+		pub = c.Key
+	}
+	// keys from agents don't implement ssh.CryptoPublicKey
+	if _, ok := pub.(ssh.CryptoPublicKey); !ok {
+		k, err := ssh.ParsePublicKey(pub.Marshal())
+		if err != nil {
+			return nil, err
+		}
+		pub = k
+	}
+	cpk, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported SSH key type %s", pub.Type())
+	}
+	return cpk.CryptoPublicKey(), nil
+}
+
+// Signer is a signature.Signer making SSH signatures in a namespace.
+type Signer struct {
+	s         ssh.Signer
+	namespace string
+}
+
+// NewSigner returns a signer making SSH signatures in namespace with s,
+// which may be a key held by an SSH agent.
+func NewSigner(s ssh.Signer, namespace string) *Signer {
+	return &Signer{s: s, namespace: namespace}
+}
+
+// PublicKey returns the public key of the signer.
+func (s *Signer) PublicKey(...signature.PublicKeyOption) (crypto.PublicKey, error) {
+	return cryptoPublicKey(s.s.PublicKey())
+}
+
+// SignMessage returns the SSH signature blob of message.
+func (s *Signer) SignMessage(message io.Reader, _ ...signature.SignOption) ([]byte, error) {
+	return Sign(s.s, s.namespace, message)
+}
+
+// Verifier is a signature.Verifier of SSH signatures in a namespace, made
+// by the key of an allowed signer.
+type Verifier struct {
+	as        AllowedSigner
+	principal string
+	namespace string
+}
+
+// NewVerifier returns a verifier of SSH signatures in namespace made by
+// key.
+func NewVerifier(key ssh.PublicKey, namespace string) *Verifier {
+	return &Verifier{
+		as:        AllowedSigner{Key: key},
+		namespace: namespace,
+	}
+}
+
+// PublicKey returns the public key of the allowed signer, it's the
+// certificate authority key of cert-authority signers.
+func (v *Verifier) PublicKey(...signature.PublicKeyOption) (crypto.PublicKey, error) {
+	return cryptoPublicKey(v.as.Key)
+}
+
+// VerifySignature verifies the SSH signature blob of message.
+func (v *Verifier) VerifySignature(sig, message io.Reader, _ ...signature.VerifyOption) error {
+	b, err := io.ReadAll(sig)
+	if err != nil {
+		return err
+	}
+	pub, err := Verify(b, v.namespace, message)
+	if err != nil {
+		return err
+	}
+	return v.as.accept(pub, v.principal)
+}
@@ -0,0 +1,151 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sshsig
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// getTestKey returns the private key of a PEM test key.
+func getTestKey(t *testing.T, file string) crypto.PrivateKey {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("..", "..", "..", "test", "keys", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := ssh.ParseRawPrivateKey(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// getTestSigner returns an SSH signer of a PEM test key.
+func getTestSigner(t *testing.T, file string) ssh.Signer {
+	t.Helper()
+
+	s, err := ssh.NewSignerFromKey(getTestKey(t, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// sshKeygenSig is a signature of "hello\n" by the sshKeygenKey ed25519 key,
+// in the "apptainer" namespace, made by 'ssh-keygen -Y sign -n apptainer'.
+const (
+	sshKeygenKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIN438GeCrotv956jAiSDGiwAoGZ/KfiwJPwfURaR2Knf"
+	sshKeygenSig = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAg3jfwZ4Kui2/3nqMCJIMaLACgZn
+8p+LAk/B9RFpHYqd8AAAAJYXBwdGFpbmVyAAAAAAAAAAZzaGE1MTIAAABTAAAAC3NzaC1l
+ZDI1NTE5AAAAQG1ZdTcCXV3IvOU6idhdm5fVVrgFfhO8pxdh1EGyKvWG4D0WKMNp3l7RUt
+NSBNwDlUdGp1ThxzbeG+WkDKNq6Ak=
+-----END SSH SIGNATURE-----
+`
+)
+
+func TestVerifySSHKeygen(t *testing.T) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(sshKeygenKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := pem.Decode([]byte(sshKeygenSig))
+	if p == nil {
+		t.Fatal("invalid signature PEM")
+	}
+
+	pub, err := Verify(p.Bytes, "apptainer", strings.NewReader("hello\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(pub.Marshal(), key.Marshal()) {
+		t.Errorf("got key %s, want %s", ssh.FingerprintSHA256(pub), ssh.FingerprintSHA256(key))
+	}
+
+	if _, err := Verify(p.Bytes, "file", strings.NewReader("hello\n")); !errors.Is(err, errInvalidSignature) {
+		t.Errorf("got error %v, want %v", err, errInvalidSignature)
+	}
+	if _, err := Verify(p.Bytes, "apptainer", strings.NewReader("bye\n")); !errors.Is(err, errInvalidSignature) {
+		t.Errorf("got error %v, want %v", err, errInvalidSignature)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: getTestKey(t, "rsa-private.pem")}); err != nil {
+		t.Fatal(err)
+	}
+	agentRSA, err := AgentSigner(keyring, getTestSigner(t, "rsa-private.pem").PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecdsa := getTestSigner(t, "ecdsa-private.pem")
+	ed25519 := getTestSigner(t, "ed25519-private.pem")
+
+	tests := []struct {
+		name  string
+		s     ssh.Signer
+		other ssh.Signer
+	}{
+		{"ECDSA", ecdsa, ed25519},
+		{"Ed25519", ed25519, ecdsa},
+		{"RSA", getTestSigner(t, "rsa-private.pem"), ed25519},
+		{"AgentRSA", agentRSA, ed25519},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSigner(tt.s, "apptainer")
+			sig, err := s.SignMessage(strings.NewReader("message"))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			v := NewVerifier(tt.s.PublicKey(), "apptainer")
+			if err := v.VerifySignature(bytes.NewReader(sig), strings.NewReader("message")); err != nil {
+				t.Errorf("unexpected verification error: %s", err)
+			}
+
+			other := NewVerifier(tt.other.PublicKey(), "apptainer")
+			if err := other.VerifySignature(bytes.NewReader(sig), strings.NewReader("message")); !errors.Is(err, errKeyNotAllowed) {
+				t.Errorf("got error %v, want %v", err, errKeyNotAllowed)
+			}
+
+			pub, err := s.PublicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			vpub, err := v.PublicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(vpub) {
+				t.Errorf("signer and verifier public keys differ")
+			}
+		})
+	}
+}
+
+func TestAgentSignerNotFound(t *testing.T) {
+	keyring := agent.NewKeyring()
+	if _, err := AgentSigner(keyring, getTestSigner(t, "ed25519-private.pem").PublicKey()); err == nil {
+		t.Errorf("unexpected success with a key not held by the agent")
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package syecl
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+
+	sifsignature "github.com/apptainer/apptainer/internal/pkg/signature"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+var errFailedToDecodePEM = errors.New("failed to decode PEM")
+
+// keyMaterial holds the PEM keys and x509 certificates of an execution
+// group. Keys are identified by the hex encoded SHA256 digest of their
+// PKIX encoding.
+type keyMaterial struct {
+	// ids are the identifiers of all the keys listed by the execution group
+	ids []string
+	// verifiers are the verifiers of the trusted keys
+	verifiers []signature.Verifier
+}
+
+// keyID returns the identifier of a public key.
+func keyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// loadCertificates returns the certificates read from the PEM file at path.
+func loadCertificates(path string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for rest := bytes.TrimSpace(b); len(rest) > 0; {
+		var p *pem.Block
+
+		if p, rest = pem.Decode(rest); p == nil {
+			return nil, fmt.Errorf("%s: %w", path, errFailedToDecodePEM)
+		}
+		c, err := x509.ParseCertificate(p.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		certs = append(certs, c)
+	}
+	return certs, nil
+}
+
+// loadCertificatePool returns the pool of certificates read from path, or
+// nil to use the system roots if path is empty.
+func loadCertificatePool(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	certs, err := loadCertificates(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	for _, c := range certs {
+		pool.AddCert(c)
+	}
+	return pool, nil
+}
+
+// matchCertificate checks that the certificate subject or one of its
+// subject alternative names are allowed by the execution group.
+func (eg *Execgroup) matchCertificate(c *x509.Certificate) bool {
+	if len(eg.Subjects) == 0 && len(eg.SANs) == 0 {
+		return true
+	}
+	if slices.Contains(eg.Subjects, c.Subject.String()) || slices.Contains(eg.Subjects, c.Subject.CommonName) {
+		return true
+	}
+
+	sans := slices.Concat(c.DNSNames, c.EmailAddresses)
+	for _, u := range c.URIs {
+		sans = append(sans, u.String())
+	}
+	for _, san := range eg.SANs {
+		if slices.Contains(sans, san) {
+			return true
+		}
+		if ip := net.ParseIP(san); ip != nil && slices.ContainsFunc(c.IPAddresses, ip.Equal) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyCertificate checks that c is a code signing certificate issued by
+// a trusted root, matching the execution group subjects or SANs and not
+// revoked when OCSP checking is enabled.
+func (eg *Execgroup) verifyCertificate(c *x509.Certificate, intermediates, roots *x509.CertPool) error {
+	if !eg.matchCertificate(c) {
+		return fmt.Errorf("subject %q doesn't match the execgroup subjects or sans", c.Subject)
+	}
+
+	chains, err := c.Verify(x509.VerifyOptions{
+		Intermediates: intermediates,
+		Roots:         roots,
+		KeyUsages: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageCodeSigning,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if eg.OCSP {
+		if err := sifsignature.OCSPVerify(chains[0]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadKeyMaterial reads the key files and certificates of the execution
+// group. Certificates are only trusted once verified, except for blacklist
+// mode where key material of forbidden entities is always used.
+func (eg *Execgroup) loadKeyMaterial() (*keyMaterial, error) {
+	km := new(keyMaterial)
+
+	for _, path := range eg.KeyFiles {
+		v, err := signature.LoadVerifierFromPEMFile(path, crypto.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("while loading key file %s: %w", path, err)
+		}
+		pub, err := v.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		id, err := keyID(pub)
+		if err != nil {
+			return nil, err
+		}
+		km.ids = append(km.ids, id)
+		km.verifiers = append(km.verifiers, v)
+	}
+
+	if len(eg.Certificates) == 0 {
+		return km, nil
+	}
+
+	intermediates, err := loadCertificatePool(eg.Intermediates)
+	if err != nil {
+		return nil, fmt.Errorf("while loading intermediate certificates: %w", err)
+	}
+	roots, err := loadCertificatePool(eg.Roots)
+	if err != nil {
+		return nil, fmt.Errorf("while loading root certificates: %w", err)
+	}
+
+	for _, path := range eg.Certificates {
+		certs, err := loadCertificates(path)
+		if err != nil {
+			return nil, fmt.Errorf("while loading certificates: %w", err)
+		}
+		for _, c := range certs {
+			id, err := keyID(c.PublicKey)
+			if err != nil {
+				return nil, err
+			}
+			km.ids = append(km.ids, id)
+
+			if eg.ListMode != "blacklist" {
+				if err := eg.verifyCertificate(c, intermediates, roots); err != nil {
+					sylog.Warningf("ECL execgroup %s: certificate %q from %s is not trusted: %s", eg.TagName, c.Subject, path, err)
+					continue
+				}
+			}
+			v, err := signature.LoadVerifier(c.PublicKey, crypto.SHA256)
+			if err != nil {
+				return nil, err
+			}
+			km.verifiers = append(km.verifiers, v)
+		}
+	}
+
+	return km, nil
+}
@@ -15,15 +15,19 @@
 package syecl
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/apptainer/apptainer/pkg/sylog"
 	"github.com/apptainer/sif/v2/pkg/integrity"
 	"github.com/apptainer/sif/v2/pkg/sif"
 	toml "github.com/pelletier/go-toml/v2"
@@ -45,16 +49,58 @@ type EclConfig struct {
 //
 //	TagName: a descriptive identifier
 //	ListMode: whether the execgroup follows a whitelist, whitestrict or blacklist model
-//		whitelist: one or more KeyFP's present and verified,
+//		whitelist: one or more KeyFP's present and verified, or at least
+//			Threshold of them if set,
 //		whitestrict: all KeyFP's present and verified,
 //		blacklist: none of the KeyFP should be present
 //	DirPath: containers must be stored in this directory path
 //	KeyFPs: list of Key Fingerprints of entities to verify
+//	KeyFiles: list of PEM public key files of entities to verify
+//	Certificates: list of PEM x509 certificate files of entities to verify
+//	Intermediates: PEM file of intermediate certificates used to verify Certificates
+//	Roots: PEM file of root certificates used to verify Certificates, the
+//		system roots are used if empty
+//	Subjects: optional list of allowed certificate subjects or common names
+//	SANs: optional list of allowed certificate subject alternative names
+//	OCSP: check that Certificates are not revoked with OCSP
+//	Threshold: number of entities required to sign the container in
+//		whitelist mode, 1 by default
 type Execgroup struct {
-	TagName  string   `toml:"tagname"`
-	ListMode string   `toml:"mode"`
-	DirPath  string   `toml:"dirpath"`
-	KeyFPs   []string `toml:"keyfp"`
+	TagName       string   `toml:"tagname"`
+	ListMode      string   `toml:"mode"`
+	DirPath       string   `toml:"dirpath"`
+	KeyFPs        []string `toml:"keyfp"`
+	KeyFiles      []string `toml:"keyfiles,omitempty"`
+	Certificates  []string `toml:"certificates,omitempty"`
+	Intermediates string   `toml:"intermediates,omitempty"`
+	Roots         string   `toml:"roots,omitempty"`
+	Subjects      []string `toml:"subjects,omitempty"`
+	SANs          []string `toml:"sans,omitempty"`
+	OCSP          bool     `toml:"ocsp,omitempty"`
+	Threshold     int      `toml:"threshold,omitempty"`
+}
+
+// files returns the key material files referenced by the execution group.
+func (eg *Execgroup) files() []string {
+	files := append([]string{}, eg.KeyFiles...)
+	files = append(files, eg.Certificates...)
+	if eg.Intermediates != "" {
+		files = append(files, eg.Intermediates)
+	}
+	if eg.Roots != "" {
+		files = append(files, eg.Roots)
+	}
+	return files
+}
+
+// Files returns the key and certificate files referenced by all execution
+// groups.
+func (ecl *EclConfig) Files() []string {
+	var files []string
+	for _, eg := range ecl.ExecGroups {
+		files = append(files, eg.files()...)
+	}
+	return files
 }
 
 // LoadConfig opens an ECL config file and unmarshals it into structures
@@ -114,106 +160,115 @@ func (ecl *EclConfig) ValidateConfig() error {
 				return fmt.Errorf("expecting a 40 chars hex fingerprint string")
 			}
 		}
+		for _, f := range v.files() {
+			if !filepath.IsAbs(f) {
+				return fmt.Errorf("execgroup key and certificate paths must be absolute: %s", f)
+			}
+		}
+		if len(v.Certificates) == 0 && (len(v.Subjects) > 0 || len(v.SANs) > 0 || v.OCSP) {
+			return fmt.Errorf("execgroup subjects, sans and ocsp fields require certificates")
+		}
+		if v.Threshold < 0 {
+			return fmt.Errorf("execgroup threshold must be a positive number")
+		}
+		if v.Threshold > 0 && v.ListMode != "whitelist" {
+			return fmt.Errorf("execgroup threshold is only supported in whitelist mode")
+		}
+		if v.Threshold > len(v.KeyFPs)+len(v.KeyFiles)+len(v.Certificates) {
+			return fmt.Errorf("execgroup threshold %d exceeds the number of entities", v.Threshold)
+		}
 	}
 
 	return nil
 }
 
-// checkWhiteList evaluates authorization by requiring at least 1 entity
-func checkWhiteList(v *integrity.Verifier, egroup *Execgroup, unvalidatedFingerprints [][]byte) (ok bool, err error) {
-	// get signing entities fingerprints that have signed all selected objects
-	keyfps, err := v.AllSignedBy()
-	if err != nil {
-		return false, err
-	}
+// signers are the entities which signed the objects of an image. PGP
+// entities are identified by their upper case fingerprint, other keys by
+// their keyID.
+type signers struct {
+	// all lists the entities with a valid signature for all objects
+	all []string
+	// any lists the entities which signed any object, including PGP
+	// signatures which were not validated
+	any []string
+}
 
-	// were the selected objects signed by an authorized entity?
-	for _, v := range egroup.KeyFPs {
-		for _, u := range keyfps {
-			if strings.EqualFold(v, hex.EncodeToString(u[:])) {
-				ok = true
-				for _, ufp := range unvalidatedFingerprints {
-					if strings.EqualFold(v, hex.EncodeToString(ufp[:])) {
-						ok = false
-						break
-					}
-				}
-			}
-			if ok {
-				break
-			}
-		}
-		if ok {
-			break
-		}
+// required returns the entities listed by the execution group.
+func (eg *Execgroup) required(km *keyMaterial) []string {
+	ids := make([]string, 0, len(eg.KeyFPs)+len(km.ids))
+	for _, fp := range eg.KeyFPs {
+		ids = append(ids, strings.ToUpper(fp))
 	}
+	return append(ids, km.ids...)
+}
 
-	if !ok {
-		return false, errNotSignedByRequired
+// checkWhiteList evaluates authorization by requiring at least threshold
+// entities, 1 if threshold is 0
+func checkWhiteList(s signers, required []string, threshold int) (ok bool, err error) {
+	if threshold == 0 {
+		threshold = 1
 	}
-
-	return true, nil
+	// were the selected objects signed by enough authorized entities?
+	return checkSigned(s, required, threshold)
 }
 
 // checkWhiteStrict evaluates authorization by requiring all entities
-func checkWhiteStrict(v *integrity.Verifier, egroup *Execgroup, unvalidatedFingerprints [][]byte) (ok bool, err error) {
-	// get signing entities fingerprints that have signed all selected objects
-	keyfps, err := v.AllSignedBy()
-	if err != nil {
-		return
-	}
-
+func checkWhiteStrict(s signers, required []string) (ok bool, err error) {
 	// were all selected objects signed by all authorized entity?
-	m := map[string]bool{}
-	for _, v := range egroup.KeyFPs {
-		m[v] = false
-		for _, u := range keyfps {
-			if strings.EqualFold(v, hex.EncodeToString(u[:])) {
-				m[v] = true
-				for _, ufp := range unvalidatedFingerprints {
-					if strings.EqualFold(v, hex.EncodeToString(ufp[:])) {
-						m[v] = false
-					}
-				}
-			}
-		}
-	}
+	return checkSigned(s, required, len(required))
+}
 
-	for _, v := range m {
-		if !v {
-			return false, errNotSignedByRequired
+// checkSigned requires at least threshold of the required entities to have
+// signed all selected objects, the error reports the satisfied and missing
+// entities otherwise.
+func checkSigned(s signers, required []string, threshold int) (ok bool, err error) {
+	var satisfied, missing []string
+	for _, id := range required {
+		if slices.Contains(satisfied, id) || slices.Contains(missing, id) {
+			continue
+		}
+		if slices.Contains(s.all, id) {
+			satisfied = append(satisfied, id)
+		} else {
+			missing = append(missing, id)
 		}
 	}
-
+	if len(satisfied) < threshold {
+		return false, fmt.Errorf("%w: signed by %d of %d required (satisfied: [%s], missing: [%s])",
+			errNotSignedByRequired, len(satisfied), threshold,
+			strings.Join(satisfied, ", "), strings.Join(missing, ", "))
+	}
 	return true, nil
 }
 
 // checkBlackList evaluates authorization by requiring all entities to be absent
-func checkBlackList(v *integrity.Verifier, egroup *Execgroup) (ok bool, err error) {
-	// get all signing entities fingerprints that have signed any selected object
-	keyfps, err := v.AnySignedBy()
-	if err != nil {
-		return
-	}
-
+func checkBlackList(s signers, required []string) (ok bool, err error) {
 	// was a selected object signed by a forbidden entity?
-	for _, v := range egroup.KeyFPs {
-		for _, u := range keyfps {
-			if strings.EqualFold(v, hex.EncodeToString(u[:])) {
-				return false, errSignedByForbidden
-			}
+	for _, id := range required {
+		if slices.Contains(s.any, id) {
+			return false, errSignedByForbidden
 		}
 	}
-
 	return true, nil
 }
 
+// task identifies the object group or object covered by a signature.
+type task struct {
+	id      uint32
+	isGroup bool
+}
+
 func shouldRun(ctx context.Context, ecl *EclConfig, fp *os.File, kr openpgp.KeyRing) (ok bool, err error) {
 	egroup := getExecGroup(ecl, fp)
 	if egroup == nil {
 		return false, fmt.Errorf("%s not part of any execgroup", fp.Name())
 	}
 
+	km, err := egroup.loadKeyMaterial()
+	if err != nil {
+		return false, err
+	}
+
 	f, err := sif.LoadContainer(fp,
 		sif.OptLoadWithFlag(os.O_RDONLY),
 		sif.OptLoadWithCloseOnUnload(false),
@@ -225,9 +280,30 @@ func shouldRun(ctx context.Context, ecl *EclConfig, fp *os.File, kr openpgp.KeyR
 
 	// Collect unvalidated signature fingerprints via an integrity.VerifyCallback
 	// to allow whitelist or whitestrict checks to ensure all required signatures
-	// have been validated.
+	// have been validated. Keys which validated a signature are also collected
+	// for each verification task, as non PGP signatures have no fingerprint.
 	unvalidatedFingerprints := make([][]byte, 0)
+	tasks := make(map[task]bool)
+	keyTasks := make(map[string]map[task]bool)
 	verifyCallback := func(r integrity.VerifyResult) (ignoreError bool) {
+		id, isGroup := r.Signature().LinkedID()
+		t := task{id: id, isGroup: isGroup}
+		tasks[t] = true
+
+		if r.Error() == nil {
+			for _, pub := range r.Keys() {
+				kid, err := keyID(pub)
+				if err != nil {
+					continue
+				}
+				if keyTasks[kid] == nil {
+					keyTasks[kid] = make(map[task]bool)
+				}
+				keyTasks[kid][t] = true
+			}
+			return false
+		}
+
 		var sigerr *integrity.SignatureNotValidError
 		if !errors.As(r.Error(), &sigerr) {
 			return false
@@ -240,6 +316,9 @@ func shouldRun(ctx context.Context, ecl *EclConfig, fp *os.File, kr openpgp.KeyR
 		if sigmetaerr != nil {
 			return false
 		}
+		if errors.Is(r.Error(), pgperrors.ErrKeyRevoked) {
+			sylog.Warningf("Signature object %d ignored, signing key %X has been revoked", sigerr.ID, fp)
+		}
 
 		unvalidatedFingerprints = append(unvalidatedFingerprints, fp)
 		return true
@@ -250,6 +329,9 @@ func shouldRun(ctx context.Context, ecl *EclConfig, fp *os.File, kr openpgp.KeyR
 		integrity.OptVerifyWithKeyRing(kr),
 		integrity.OptVerifyCallback(verifyCallback),
 	}
+	for _, v := range km.verifiers {
+		opts = append(opts, integrity.OptVerifyWithVerifier(v))
+	}
 	if ecl.Legacy {
 		// Legacy behavior is to verify the primary partition only.
 		od, err := f.GetDescriptor(sif.WithPartitionType(sif.PartPrimSys))
@@ -269,19 +351,59 @@ func shouldRun(ctx context.Context, ecl *EclConfig, fp *os.File, kr openpgp.KeyR
 		return false, fmt.Errorf("image signature not valid: %v", err)
 	}
 
-	// Check fingerprints against policy.
+	s, err := getSigners(v, unvalidatedFingerprints, tasks, keyTasks)
+	if err != nil {
+		return false, err
+	}
+
+	// Check entities against policy.
+	required := egroup.required(km)
 	switch egroup.ListMode {
 	case "whitelist":
-		return checkWhiteList(v, egroup, unvalidatedFingerprints)
+		return checkWhiteList(s, required, egroup.Threshold)
 	case "whitestrict":
-		return checkWhiteStrict(v, egroup, unvalidatedFingerprints)
+		return checkWhiteStrict(s, required)
 	case "blacklist":
-		return checkBlackList(v, egroup)
+		return checkBlackList(s, required)
 	}
 
 	return false, fmt.Errorf("ecl config file invalid")
 }
 
+// getSigners returns the entities which signed the objects selected by v.
+func getSigners(v *integrity.Verifier, unvalidatedFingerprints [][]byte, tasks map[task]bool, keyTasks map[string]map[task]bool) (signers, error) {
+	var s signers
+
+	// get signing entities fingerprints that have signed all selected objects
+	allfps, err := v.AllSignedBy()
+	if err != nil {
+		return s, err
+	}
+	for _, fp := range allfps {
+		if !slices.ContainsFunc(unvalidatedFingerprints, func(ufp []byte) bool { return bytes.Equal(fp, ufp) }) {
+			s.all = append(s.all, strings.ToUpper(hex.EncodeToString(fp)))
+		}
+	}
+
+	// get all signing entities fingerprints that have signed any selected object
+	anyfps, err := v.AnySignedBy()
+	if err != nil {
+		return s, err
+	}
+	for _, fp := range anyfps {
+		s.any = append(s.any, strings.ToUpper(hex.EncodeToString(fp)))
+	}
+
+	for kid, kt := range keyTasks {
+		s.any = append(s.any, kid)
+		if len(kt) == len(tasks) {
+			s.all = append(s.all, kid)
+		}
+	}
+
+	return s, nil
+}
+
 func getExecGroup(ecl *EclConfig, fp *os.File) *Execgroup {
 	var v Execgroup
 	// look what execgroup a container is part of
@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"gotest.tools/v3/golden"
 )
 
@@ -377,6 +378,18 @@ func TestShouldRun(t *testing.T) {
 		DirPath:  dirPath,
 		KeyFPs:   []string{KeyFP2},
 	}
+	th1 := Execgroup{
+		ListMode:  "whitelist",
+		DirPath:   dirPath,
+		KeyFPs:    []string{KeyFP1, KeyFP2},
+		Threshold: 1,
+	}
+	th2 := Execgroup{
+		ListMode:  "whitelist",
+		DirPath:   dirPath,
+		KeyFPs:    []string{KeyFP1, KeyFP2},
+		Threshold: 2,
+	}
 	bl1 := Execgroup{
 		ListMode: "blacklist",
 		DirPath:  dirPath,
@@ -409,6 +422,8 @@ func TestShouldRun(t *testing.T) {
 		{"WhitelistError", true, false, wl2, signed, true},
 		{"WhitestrictOK", true, false, ws1, signed, false},
 		{"WhitestrictError", true, false, ws2, signed, true},
+		{"ThresholdOK", true, false, th1, signed, false},
+		{"ThresholdError", true, false, th2, signed, true},
 		{"BlacklistOK", true, false, bl2, signed, false},
 		{"BlacklistError", true, false, bl1, signed, true},
 		{"LegacyDeactivated", false, true, Execgroup{}, unsigned, false},
@@ -460,3 +475,194 @@ func TestShouldRun(t *testing.T) {
 		})
 	}
 }
+
+// getRevokedTestEntity returns the fixed test PGP entity, revoked.
+func getRevokedTestEntity(t *testing.T) *openpgp.Entity {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("..", "..", "..", "test", "keys", "pgp-private.asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	el, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(el), 1; got != want {
+		t.Fatalf("got %v entities, want %v", got, want)
+	}
+	if err := el[0].RevokeKey(packet.KeyCompromised, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	return el[0]
+}
+
+func TestShouldRunRevoked(t *testing.T) {
+	dirPath, err := filepath.Abs(filepath.Join("..", "..", "..", "test", "images"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := filepath.Join(dirPath, "one-group-signed-pgp.sif")
+	legacySigned := filepath.Join(dirPath, "one-group-signed-legacy.sif")
+
+	tests := []struct {
+		name   string
+		legacy bool
+		eg     Execgroup
+		path   string
+	}{
+		{"Whitelist", false, Execgroup{ListMode: "whitelist", DirPath: dirPath, KeyFPs: []string{KeyFP1}}, signed},
+		{"Whitestrict", false, Execgroup{ListMode: "whitestrict", DirPath: dirPath, KeyFPs: []string{KeyFP1}}, signed},
+		{"Blacklist", false, Execgroup{ListMode: "blacklist", DirPath: dirPath, KeyFPs: []string{KeyFP1}}, signed},
+		{"LegacyWhitelist", true, Execgroup{ListMode: "whitelist", DirPath: dirPath, KeyFPs: []string{KeyFP1}}, legacySigned},
+	}
+
+	kr := openpgp.EntityList{getRevokedTestEntity(t)}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := EclConfig{
+				Activated:  true,
+				Legacy:     tt.legacy,
+				ExecGroups: []Execgroup{tt.eg},
+			}
+
+			got, err := c.ShouldRun(t.Context(), tt.path, kr)
+			if got {
+				t.Errorf("image signed by revoked key allowed to run")
+			}
+			if err == nil {
+				t.Errorf("got no error, want error")
+			}
+		})
+	}
+}
+
+func TestShouldRunKeyMaterial(t *testing.T) {
+	testDir, err := filepath.Abs(filepath.Join("..", "..", "..", "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKey := filepath.Join(testDir, "keys", "rsa-public.pem")
+	ecdsaKey := filepath.Join(testDir, "keys", "ecdsa-public.pem")
+	leaf := filepath.Join(testDir, "certs", "leaf.pem")
+	intermediate := filepath.Join(testDir, "certs", "intermediate.pem")
+	root := filepath.Join(testDir, "certs", "root.pem")
+
+	unsigned := filepath.Join(testDir, "images", "one-group.sif")
+	signed := filepath.Join(testDir, "images", "one-group-signed-dsse.sif")
+
+	//nolint:maligned // the aligned form, with eg first, is not as easy to read
+	tests := []struct {
+		name    string
+		eg      Execgroup
+		path    string
+		wantErr bool
+	}{
+		{"KeyWhitelistOK", Execgroup{ListMode: "whitelist", KeyFiles: []string{rsaKey}}, signed, false},
+		{"KeyWhitelistError", Execgroup{ListMode: "whitelist", KeyFiles: []string{ecdsaKey}}, signed, true},
+		{"KeyWhitelistUnsigned", Execgroup{ListMode: "whitelist", KeyFiles: []string{rsaKey}}, unsigned, true},
+		{"KeyWhitestrictOK", Execgroup{ListMode: "whitestrict", KeyFiles: []string{rsaKey}}, signed, false},
+		{"KeyWhitestrictError", Execgroup{ListMode: "whitestrict", KeyFiles: []string{rsaKey, ecdsaKey}}, signed, true},
+		{"KeyThresholdOK", Execgroup{ListMode: "whitelist", KeyFiles: []string{rsaKey, ecdsaKey}, Threshold: 1}, signed, false},
+		{"KeyThresholdError", Execgroup{ListMode: "whitelist", KeyFiles: []string{rsaKey, ecdsaKey}, Threshold: 2}, signed, true},
+		{"KeyBlacklistOK", Execgroup{ListMode: "blacklist", KeyFiles: []string{ecdsaKey}}, signed, false},
+		{"KeyBlacklistError", Execgroup{ListMode: "blacklist", KeyFiles: []string{rsaKey}}, signed, true},
+		{"CertificateOK", Execgroup{
+			ListMode:      "whitelist",
+			Certificates:  []string{leaf},
+			Intermediates: intermediate,
+			Roots:         root,
+		}, signed, false},
+		{"CertificateSubjectOK", Execgroup{
+			ListMode:      "whitelist",
+			Certificates:  []string{leaf},
+			Intermediates: intermediate,
+			Roots:         root,
+			Subjects:      []string{"CN=leaf,O=Apptainer,C=US"},
+		}, signed, false},
+		{"CertificateCommonNameOK", Execgroup{
+			ListMode:      "whitelist",
+			Certificates:  []string{leaf},
+			Intermediates: intermediate,
+			Roots:         root,
+			Subjects:      []string{"leaf"},
+		}, signed, false},
+		{"CertificateSubjectError", Execgroup{
+			ListMode:      "whitelist",
+			Certificates:  []string{leaf},
+			Intermediates: intermediate,
+			Roots:         root,
+			Subjects:      []string{"other"},
+		}, signed, true},
+		{"CertificateSANError", Execgroup{
+			ListMode:      "whitelist",
+			Certificates:  []string{leaf},
+			Intermediates: intermediate,
+			Roots:         root,
+			SANs:          []string{"user@example.com"},
+		}, signed, true},
+		{"CertificateUntrusted", Execgroup{
+			ListMode:      "whitelist",
+			Certificates:  []string{leaf},
+			Intermediates: intermediate,
+		}, signed, true},
+		{"CertificateBlacklistError", Execgroup{
+			ListMode:     "blacklist",
+			Certificates: []string{leaf},
+		}, signed, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := EclConfig{
+				Activated:  true,
+				ExecGroups: []Execgroup{tt.eg},
+			}
+			if err := c.ValidateConfig(); err != nil {
+				t.Fatalf("unexpected validation error: %s", err)
+			}
+
+			got, err := c.ShouldRun(t.Context(), tt.path, openpgp.EntityList{})
+
+			if want := !tt.wantErr; got != want {
+				t.Errorf("got run %v, want %v", got, want)
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateConfigKeyMaterial(t *testing.T) {
+	tests := []struct {
+		name    string
+		eg      Execgroup
+		wantErr bool
+	}{
+		{"AbsoluteKeyFile", Execgroup{ListMode: "whitelist", KeyFiles: []string{"/etc/key.pem"}}, false},
+		{"RelativeKeyFile", Execgroup{ListMode: "whitelist", KeyFiles: []string{"key.pem"}}, true},
+		{"RelativeRoots", Execgroup{ListMode: "whitelist", Certificates: []string{"/etc/cert.pem"}, Roots: "roots.pem"}, true},
+		{"SubjectsWithoutCertificates", Execgroup{ListMode: "whitelist", Subjects: []string{"leaf"}}, true},
+		{"Threshold", Execgroup{ListMode: "whitelist", KeyFPs: []string{KeyFP1, KeyFP2}, KeyFiles: []string{"/etc/key.pem"}, Threshold: 3}, false},
+		{"ThresholdTooHigh", Execgroup{ListMode: "whitelist", KeyFPs: []string{KeyFP1, KeyFP2}, Threshold: 3}, true},
+		{"ThresholdNegative", Execgroup{ListMode: "whitelist", KeyFPs: []string{KeyFP1}, Threshold: -1}, true},
+		{"ThresholdWhitestrict", Execgroup{ListMode: "whitestrict", KeyFPs: []string{KeyFP1, KeyFP2}, Threshold: 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := EclConfig{ExecGroups: []Execgroup{tt.eg}}
+			if err := c.ValidateConfig(); (err != nil) != tt.wantErr {
+				t.Errorf("got err %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"bytes"
+	stdecdsa "crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/ecdsa"
+	"github.com/ProtonMail/go-crypto/openpgp/eddsa"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/apptainer/apptainer/internal/pkg/gpgagent"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// AgentKey is a key held by gpg-agent, with the public key of the keyring
+// matching it, if any.
+type AgentKey struct {
+	gpgagent.KeyInfo
+
+	// Entity holds PublicKey, nil if the keyring has no matching key.
+	Entity *openpgp.Entity
+	// PublicKey is the primary key or subkey of Entity held by the agent.
+	PublicKey *packet.PublicKey
+}
+
+// samePublicKey returns whether k holds the public key material pub returned
+// by gpg-agent.
+func samePublicKey(k *packet.PublicKey, pub any) bool {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		kp, ok := k.PublicKey.(*rsa.PublicKey)
+		return ok && kp.E == pub.E && kp.N.Cmp(pub.N) == 0
+	case *stdecdsa.PublicKey:
+		kp, ok := k.PublicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		b, err := pub.Bytes()
+		return err == nil && bytes.Equal(kp.MarshalPoint(), b)
+	case ed25519.PublicKey:
+		kp, ok := k.PublicKey.(*eddsa.PublicKey)
+		return ok && bytes.Equal(kp.X, pub)
+	}
+	return false
+}
+
+// findPublicKey returns the entity of el, and its primary key or subkey,
+// holding the public key material pub.
+func findPublicKey(el openpgp.EntityList, pub any) (*openpgp.Entity, *packet.PublicKey) {
+	for _, e := range el {
+		if samePublicKey(e.PrimaryKey, pub) {
+			return e, e.PrimaryKey
+		}
+		for _, sk := range e.Subkeys {
+			if samePublicKey(sk.PublicKey, pub) {
+				return e, sk.PublicKey
+			}
+		}
+	}
+	return nil, nil
+}
+
+// AgentKeys returns the keys held by gpg-agent, matched with the public keys
+// of el.
+func AgentKeys(c *gpgagent.Client, el openpgp.EntityList) ([]AgentKey, error) {
+	infos, err := c.Keys()
+	if err != nil {
+		return nil, fmt.Errorf("while listing gpg-agent keys: %w", err)
+	}
+
+	keys := make([]AgentKey, 0, len(infos))
+	for _, info := range infos {
+		k := AgentKey{KeyInfo: info}
+		if pub, err := c.ReadKey(info.Keygrip); err != nil {
+			sylog.Debugf("Could not read gpg-agent key %s: %v", info.Keygrip, err)
+		} else {
+			k.Entity, k.PublicKey = findPublicKey(el, pub)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// AgentSigningEntity returns a copy of the entity of el identified by id,
+// the fingerprint of a key of el or the keygrip of a key held by gpg-agent,
+// whose private signing key signs through gpg-agent. The private key
+// material never leaves the agent, which may prompt for its passphrase or
+// smartcard PIN when signing.
+func AgentSigningEntity(c *gpgagent.Client, el openpgp.EntityList, id string) (*openpgp.Entity, error) {
+	id = strings.ToUpper(strings.TrimPrefix(id, "0x"))
+	now := time.Now()
+
+	var keygrip string
+	var k *packet.PublicKey
+
+	e := findKeyByFingerprint(el, id)
+	if e != nil {
+		// select the signing key, then the agent key holding it
+		sk, ok := e.SigningKey(now)
+		if !ok {
+			return nil, fmt.Errorf("key %X has no valid signing key", e.PrimaryKey.Fingerprint)
+		}
+		k = sk.PublicKey
+
+		keys, err := AgentKeys(c, openpgp.EntityList{e})
+		if err != nil {
+			return nil, err
+		}
+		for _, ak := range keys {
+			if ak.PublicKey == k {
+				keygrip = ak.Keygrip
+				break
+			}
+		}
+		if keygrip == "" {
+			return nil, fmt.Errorf("gpg-agent holds no secret key for signing key %X of key %X", k.Fingerprint, e.PrimaryKey.Fingerprint)
+		}
+	} else {
+		pub, err := c.ReadKey(id)
+		if err != nil {
+			return nil, fmt.Errorf("no key with fingerprint or keygrip %s: %w", id, err)
+		}
+		if e, k = findPublicKey(el, pub); e == nil {
+			return nil, fmt.Errorf("no public key matching gpg-agent key %s in the keyring, import it first", id)
+		}
+		if sk, ok := e.SigningKeyById(now, k.KeyId); !ok || sk.PublicKey != k {
+			return nil, fmt.Errorf("gpg-agent key %s isn't a valid signing key of key %X", id, e.PrimaryKey.Fingerprint)
+		}
+		keygrip = id
+	}
+
+	if e.Revoked(now) {
+		return nil, fmt.Errorf("key %X has been revoked", e.PrimaryKey.Fingerprint)
+	}
+	if t, ok := KeyExpiry(e); ok && now.After(t) {
+		return nil, fmt.Errorf("key %X expired on %s", e.PrimaryKey.Fingerprint, t.Format(time.DateOnly))
+	}
+	if k.PubKeyAlgo != packet.PubKeyAlgoRSA && k.PubKeyAlgo != packet.PubKeyAlgoRSASignOnly && k.PubKeyAlgo != packet.PubKeyAlgoECDSA {
+		return nil, fmt.Errorf("signing key %X is not supported, only RSA and ECDSA keys can sign through gpg-agent", k.Fingerprint)
+	}
+
+	s, err := c.NewSigner(keygrip)
+	if err != nil {
+		return nil, err
+	}
+
+	se := *e
+	se.PrivateKey = &packet.PrivateKey{
+		PublicKey:  *k,
+		PrivateKey: s,
+	}
+	return &se, nil
+}
+
+// printAgentKeys prints the keys held by gpg-agent to w.
+func printAgentKeys(w io.Writer, keys []AgentKey) {
+	for i, k := range keys {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "%d)", i)
+		if k.Entity != nil {
+			for _, v := range k.Entity.Identities {
+				fmt.Fprintf(tw, "\tUser:\t%s (%s) <%s>\n", v.UserId.Name, v.UserId.Comment, v.UserId.Email)
+			}
+			fmt.Fprintf(tw, "\tFingerprint:\t%0X\n", k.Entity.PrimaryKey.Fingerprint)
+			if k.PublicKey != k.Entity.PrimaryKey {
+				fmt.Fprintf(tw, "\tSubkey fingerprint:\t%0X\n", k.PublicKey.Fingerprint)
+			}
+		} else {
+			fmt.Fprintf(tw, "\tFingerprint:\tunknown, no matching public key in keyring\n")
+		}
+		fmt.Fprintf(tw, "\tKeygrip:\t%s\n", k.Keygrip)
+		if k.Smartcard {
+			fmt.Fprintf(tw, "\tSmartcard:\t%s\n", k.SerialNumber)
+		}
+		tw.Flush()
+		fmt.Fprintln(w)
+	}
+}
+
+// PrintAgentKeys prints the keys held by gpg-agent, with the public keys of
+// the public local store matching them.
+func (keyring *Handle) PrintAgentKeys(c *gpgagent.Client) error {
+	el, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return err
+	}
+
+	keys, err := AgentKeys(c, el)
+	if err != nil {
+		return err
+	}
+
+	printAgentKeys(os.Stdout, keys)
+
+	return nil
+}
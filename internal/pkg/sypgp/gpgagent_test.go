@@ -0,0 +1,267 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/apptainer/apptainer/internal/pkg/gpgagent"
+)
+
+// gpgTestKeys are the keys generated in the GnuPG home of the tests, by
+// user ID.
+var gpgTestKeys = []struct {
+	uid     string
+	algo    string
+	usage   string
+	subkeys []string
+}{
+	{uid: "RSA <rsa@example.com>", algo: "rsa2048", usage: "sign"},
+	{uid: "ECDSA <ecdsa@example.com>", algo: "nistp256", usage: "sign"},
+	{uid: "Subkey <subkey@example.com>", algo: "ed25519", usage: "cert", subkeys: []string{"rsa2048"}},
+	{uid: "Ed25519 <ed25519@example.com>", algo: "ed25519", usage: "sign"},
+}
+
+// newGPGAgent generates gpgTestKeys in a temporary GnuPG home, and returns a
+// client of its agent, the public keys and the keygrips of the keys and
+// subkeys by fingerprint. The test is skipped if GnuPG is not installed.
+func newGPGAgent(t *testing.T) (*gpgagent.Client, openpgp.EntityList, map[string]string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("GnuPG is not installed")
+	}
+	if _, err := exec.LookPath("gpgconf"); err != nil {
+		t.Skip("GnuPG is not installed")
+	}
+
+	t.Setenv("GNUPGHOME", t.TempDir())
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+	})
+
+	gpg := func(args ...string) []byte {
+		t.Helper()
+		args = append([]string{"--batch", "--pinentry-mode", "loopback", "--passphrase", ""}, args...)
+		out, err := exec.Command("gpg", args...).Output()
+		if err != nil {
+			t.Fatalf("gpg %s failed: %v", strings.Join(args, " "), err)
+		}
+		return out
+	}
+
+	// colonRecords returns the fields of the records of type in out
+	colonRecords := func(out []byte, typ string) []string {
+		var fields []string
+		for _, l := range strings.Split(string(out), "\n") {
+			if f := strings.Split(l, ":"); len(f) > 9 && f[0] == typ {
+				fields = append(fields, f[9])
+			}
+		}
+		return fields
+	}
+
+	for _, k := range gpgTestKeys {
+		gpg("--quick-gen-key", k.uid, k.algo, k.usage, "never")
+		for _, sk := range k.subkeys {
+			fpr := colonRecords(gpg("--list-keys", "--with-colons", k.uid), "fpr")[0]
+			gpg("--quick-add-key", fpr, sk, "sign", "never")
+		}
+	}
+
+	// fpr records are followed by the grp record of the key
+	out := gpg("--list-keys", "--with-colons", "--with-keygrip")
+	fprs := colonRecords(out, "fpr")
+	grps := colonRecords(out, "grp")
+	if len(fprs) != len(grps) {
+		t.Fatalf("got %d fingerprints and %d keygrips", len(fprs), len(grps))
+	}
+	keygrips := make(map[string]string)
+	for i, fpr := range fprs {
+		keygrips[fpr] = grps[i]
+	}
+
+	el, err := openpgp.ReadKeyRing(bytes.NewReader(gpg("--export")))
+	if err != nil {
+		t.Fatalf("failed to read exported keys: %v", err)
+	}
+
+	c, err := gpgagent.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect to gpg-agent: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c, el, keygrips
+}
+
+func TestAgentSigningEntity(t *testing.T) {
+	c, el, keygrips := newGPGAgent(t)
+
+	fingerprint := func(email string) string {
+		for _, e := range el {
+			if entityHasEmail(e, email) {
+				return fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+			}
+		}
+		t.Fatalf("no key for %s", email)
+		return ""
+	}
+	subkeyFingerprint := func(email string) string {
+		for _, e := range el {
+			if entityHasEmail(e, email) && len(e.Subkeys) > 0 {
+				return fmt.Sprintf("%X", e.Subkeys[0].PublicKey.Fingerprint)
+			}
+		}
+		t.Fatalf("no subkey for %s", email)
+		return ""
+	}
+
+	tests := []struct {
+		name          string
+		el            openpgp.EntityList
+		id            string
+		wantSigningFP string
+		wantErr       bool
+	}{
+		{
+			name:          "RSAFingerprint",
+			el:            el,
+			id:            fingerprint("rsa@example.com"),
+			wantSigningFP: fingerprint("rsa@example.com"),
+		},
+		{
+			name:          "RSAKeygrip",
+			el:            el,
+			id:            strings.ToLower(keygrips[fingerprint("rsa@example.com")]),
+			wantSigningFP: fingerprint("rsa@example.com"),
+		},
+		{
+			name:          "ECDSAFingerprint",
+			el:            el,
+			id:            "0x" + fingerprint("ecdsa@example.com"),
+			wantSigningFP: fingerprint("ecdsa@example.com"),
+		},
+		{
+			name:          "SubkeyFingerprint",
+			el:            el,
+			id:            fingerprint("subkey@example.com"),
+			wantSigningFP: subkeyFingerprint("subkey@example.com"),
+		},
+		{
+			name:          "SubkeyKeygrip",
+			el:            el,
+			id:            keygrips[subkeyFingerprint("subkey@example.com")],
+			wantSigningFP: subkeyFingerprint("subkey@example.com"),
+		},
+		{
+			name:    "CertifyOnlyKeygrip",
+			el:      el,
+			id:      keygrips[fingerprint("subkey@example.com")],
+			wantErr: true,
+		},
+		{
+			name:    "Ed25519Unsupported",
+			el:      el,
+			id:      fingerprint("ed25519@example.com"),
+			wantErr: true,
+		},
+		{
+			name:    "NoPublicKey",
+			el:      openpgp.EntityList{},
+			id:      keygrips[fingerprint("rsa@example.com")],
+			wantErr: true,
+		},
+		{
+			name:    "UnknownKey",
+			el:      el,
+			id:      "0000000000000000000000000000000000000000",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := AgentSigningEntity(c, tt.el, tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := fmt.Sprintf("%X", e.PrivateKey.Fingerprint); got != tt.wantSigningFP {
+				t.Errorf("got signing key %s, want %s", got, tt.wantSigningFP)
+			}
+
+			var b bytes.Buffer
+			w, err := clearsign.Encode(&b, e.PrivateKey, nil)
+			if err != nil {
+				t.Fatalf("failed to sign: %v", err)
+			}
+			if _, err := w.Write([]byte("message")); err != nil {
+				t.Fatalf("failed to sign: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("failed to sign: %v", err)
+			}
+
+			block, _ := clearsign.Decode(b.Bytes())
+			if block == nil {
+				t.Fatalf("failed to decode signature")
+			}
+			signer, err := openpgp.CheckDetachedSignature(el, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body, nil)
+			if err != nil {
+				t.Fatalf("failed to verify signature: %v", err)
+			}
+			if !bytes.Equal(signer.PrimaryKey.Fingerprint, e.PrimaryKey.Fingerprint) {
+				t.Errorf("got signer %X, want %X", signer.PrimaryKey.Fingerprint, e.PrimaryKey.Fingerprint)
+			}
+		})
+	}
+}
+
+func TestAgentKeys(t *testing.T) {
+	c, el, keygrips := newGPGAgent(t)
+
+	// only the RSA key is known
+	var known openpgp.EntityList
+	for _, e := range el {
+		if entityHasEmail(e, "rsa@example.com") {
+			known = append(known, e)
+		}
+	}
+
+	keys, err := AgentKeys(c, known)
+	if err != nil {
+		t.Fatalf("failed to list agent keys: %v", err)
+	}
+	if got, want := len(keys), len(keygrips); got != want {
+		t.Fatalf("got %d keys, want %d", got, want)
+	}
+	want := keygrips[fmt.Sprintf("%X", known[0].PrimaryKey.Fingerprint)]
+	matched := false
+	for _, k := range keys {
+		if k.Entity == nil {
+			continue
+		}
+		if k.Keygrip != want || k.Entity != known[0] || k.PublicKey != known[0].PrimaryKey {
+			t.Errorf("unexpected key matched with %s", k.Keygrip)
+		}
+		matched = true
+	}
+	if !matched {
+		t.Errorf("RSA key not matched")
+	}
+}
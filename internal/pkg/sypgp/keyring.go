@@ -44,6 +44,12 @@ func NewHybridKeyRing(ctx context.Context, opts ...client.Option) (openpgp.KeyRi
 		return nil, err
 	}
 
+	return NewHybridKeyRingFrom(ctx, kr, opts...)
+}
+
+// NewHybridKeyRingFrom returns a keyring backed by both the keyring kr and the configured
+// keyserver.
+func NewHybridKeyRingFrom(ctx context.Context, kr openpgp.KeyRing, opts ...client.Option) (openpgp.KeyRing, error) {
 	// Set up client to retrieve keys from keyserver.
 	c, err := client.NewClient(opts...)
 	if err != nil {
@@ -62,7 +68,7 @@ func NewHybridKeyRing(ctx context.Context, opts ...client.Option) (openpgp.KeyRi
 //nolint:revive  // golang/x/crypto uses Id instead of ID so we have to too
 func (kr *hybridKeyRing) KeysById(id uint64) []openpgp.Key {
 	if keys := kr.local.KeysById(id); len(keys) > 0 {
-		return keys
+		return kr.remoteRevocations(id, keys)
 	}
 
 	// No keys found in local keyring, check with keyserver.
@@ -80,7 +86,7 @@ func (kr *hybridKeyRing) KeysById(id uint64) []openpgp.Key {
 //nolint:revive  // golang/x/crypto uses Id instead of ID so we have to too
 func (kr *hybridKeyRing) KeysByIdUsage(id uint64, requiredUsage byte) []openpgp.Key {
 	if keys := kr.local.KeysByIdUsage(id, requiredUsage); len(keys) > 0 {
-		return keys
+		return kr.remoteRevocations(id, keys)
 	}
 
 	// No keys found in local keyring, check with keyserver.
@@ -112,6 +118,25 @@ func (kr *hybridKeyRing) remoteEntitiesByID(id uint64) (openpgp.EntityList, erro
 	return openpgp.ReadArmoredKeyRing(strings.NewReader(kt))
 }
 
+// remoteRevocations returns the local keys with the given key id, with the
+// revocation signatures of their entity on the keyserver, so that keys
+// revoked on the keyserver are seen as revoked.
+func (kr *hybridKeyRing) remoteRevocations(id uint64, keys []openpgp.Key) []openpgp.Key {
+	el, err := kr.remoteEntitiesByID(id)
+	if err != nil {
+		sylog.Debugf("Could not check revocation of key %X on keyserver: %v", id, err)
+		return keys
+	}
+
+	for i, k := range keys {
+		if e := mergeRevocations(k.Entity, el); e != k.Entity {
+			sylog.Debugf("Key %X revoked on keyserver", e.PrimaryKey.Fingerprint)
+			keys[i].Entity = e
+		}
+	}
+	return keys
+}
+
 type multiKeyRing struct {
 	keyrings []openpgp.KeyRing
 }
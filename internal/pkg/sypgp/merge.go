@@ -0,0 +1,143 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// sameSignature returns whether a and b are the same signature, made by the
+// same issuer at the same time.
+func sameSignature(a, b *packet.Signature) bool {
+	if a.SigType != b.SigType || !a.CreationTime.Equal(b.CreationTime) {
+		return false
+	}
+	if (a.IssuerKeyId == nil) != (b.IssuerKeyId == nil) || a.IssuerKeyId != nil && *a.IssuerKeyId != *b.IssuerKeyId {
+		return false
+	}
+	return bytes.Equal(a.IssuerFingerprint, b.IssuerFingerprint)
+}
+
+// mergeSignatures returns a copy of dst with the signatures of src it
+// doesn't hold, and whether any was added.
+func mergeSignatures(dst, src []*packet.Signature) ([]*packet.Signature, bool) {
+	merged := slices.Clone(dst)
+	for _, sig := range src {
+		if !slices.ContainsFunc(merged, func(s *packet.Signature) bool { return sameSignature(s, sig) }) {
+			merged = append(merged, sig)
+		}
+	}
+	return merged, len(merged) != len(dst)
+}
+
+// mergeIdentity returns a copy of dst with the signatures and revocations
+// of src, the same user ID, and whether any was added.
+func mergeIdentity(dst, src *openpgp.Identity) (*openpgp.Identity, bool) {
+	sigs, sigsChanged := mergeSignatures(dst.Signatures, src.Signatures)
+	revocations, revocationsChanged := mergeSignatures(dst.Revocations, src.Revocations)
+	if !sigsChanged && !revocationsChanged {
+		return dst, false
+	}
+
+	id := *dst
+	id.Signatures = sigs
+	id.Revocations = revocations
+	if id.SelfSignature == nil || src.SelfSignature != nil && src.SelfSignature.CreationTime.After(id.SelfSignature.CreationTime) {
+		id.SelfSignature = src.SelfSignature
+	}
+	return &id, true
+}
+
+// mergeEntity returns a copy of dst with the revocations, identities,
+// subkeys and signatures of src, the same key, and whether dst was missing
+// any of them. The signatures of src must have been verified, as done when
+// reading keys.
+func mergeEntity(dst, src *openpgp.Entity) (*openpgp.Entity, bool) {
+	e := *dst
+
+	revocations, changed := mergeSignatures(dst.Revocations, src.Revocations)
+	e.Revocations = revocations
+
+	sigs, ok := mergeSignatures(dst.Signatures, src.Signatures)
+	e.Signatures = sigs
+	changed = changed || ok
+	if src.SelfSignature != nil && (e.SelfSignature == nil || src.SelfSignature.CreationTime.After(e.SelfSignature.CreationTime)) {
+		e.SelfSignature = src.SelfSignature
+	}
+
+	e.Identities = maps.Clone(dst.Identities)
+	for name, sid := range src.Identities {
+		did, found := e.Identities[name]
+		if !found {
+			e.Identities[name] = sid
+			changed = true
+			continue
+		}
+		if id, ok := mergeIdentity(did, sid); ok {
+			e.Identities[name] = id
+			changed = true
+		}
+	}
+
+	e.Subkeys = slices.Clone(dst.Subkeys)
+	for _, ssk := range src.Subkeys {
+		i := slices.IndexFunc(e.Subkeys, func(sk openpgp.Subkey) bool {
+			return bytes.Equal(sk.PublicKey.Fingerprint, ssk.PublicKey.Fingerprint)
+		})
+		if i < 0 {
+			e.Subkeys = append(e.Subkeys, ssk)
+			changed = true
+			continue
+		}
+		sk := &e.Subkeys[i]
+		if ssk.Sig.CreationTime.After(sk.Sig.CreationTime) {
+			sk.Sig = ssk.Sig
+			changed = true
+		}
+		if revocations, ok := mergeSignatures(sk.Revocations, ssk.Revocations); ok {
+			sk.Revocations = revocations
+			changed = true
+		}
+	}
+
+	return &e, changed
+}
+
+// MergePubKey adds the public key e to the public keyring, or merges it into
+// the key of the keyring with the same fingerprint, so that the keyring holds
+// its new identities, subkeys, signatures and revocations. It returns whether
+// the keyring changed.
+func (keyring *Handle) MergePubKey(e *openpgp.Entity) (bool, error) {
+	el, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return false, err
+	}
+
+	i := slices.IndexFunc(el, func(k *openpgp.Entity) bool {
+		return bytes.Equal(k.PrimaryKey.Fingerprint, e.PrimaryKey.Fingerprint)
+	})
+	if i < 0 {
+		return true, keyring.appendPubKey(e)
+	}
+
+	merged, changed := mergeEntity(el[i], e)
+	if !changed {
+		return false, nil
+	}
+	el[i] = merged
+
+	sylog.Verbosef("Updating local keyring: %v", keyring.PublicPath())
+	return true, keyring.storePubKeyring(el)
+}
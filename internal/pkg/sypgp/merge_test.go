@@ -0,0 +1,131 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"crypto"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/apptainer/apptainer/internal/pkg/test"
+)
+
+func TestMergePubKey(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	keyring := NewHandle(t.TempDir())
+
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	e, err := openpgp.NewEntity(testName, testComment, testEmail, config)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	// public returns the public key of e, as read from a keyserver
+	public := func() *openpgp.Entity {
+		t.Helper()
+		kt, err := serializeEntity(e, openpgp.PublicKeyType)
+		if err != nil {
+			t.Fatalf("failed to serialize key: %v", err)
+		}
+		el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(kt))
+		if err != nil {
+			t.Fatalf("failed to read key: %v", err)
+		}
+		return el[0]
+	}
+
+	// merge merges the public key of e, and returns the key of the keyring
+	merge := func(wantChanged bool) *openpgp.Entity {
+		t.Helper()
+		changed, err := keyring.MergePubKey(public())
+		if err != nil {
+			t.Fatalf("failed to merge key: %v", err)
+		}
+		if changed != wantChanged {
+			t.Errorf("got changed %v, want %v", changed, wantChanged)
+		}
+		el, err := keyring.LoadPubKeyring()
+		if err != nil {
+			t.Fatalf("failed to load keyring: %v", err)
+		}
+		if len(el) != 1 {
+			t.Fatalf("got %d keys in keyring, want 1", len(el))
+		}
+		return el[0]
+	}
+
+	merge(true)
+	merge(false)
+
+	if err := e.AddUserId("Other", "", "other@example.com", config); err != nil {
+		t.Fatalf("failed to add identity: %v", err)
+	}
+	if got := merge(true); len(got.Identities) != 2 {
+		t.Errorf("got %d identities, want 2", len(got.Identities))
+	}
+
+	if err := e.AddSigningSubkey(config); err != nil {
+		t.Fatalf("failed to add subkey: %v", err)
+	}
+	if got := merge(true); len(got.Subkeys) != 2 {
+		t.Errorf("got %d subkeys, want 2", len(got.Subkeys))
+	}
+
+	if err := e.RevokeKey(packet.KeyRetired, "retired", config); err != nil {
+		t.Fatalf("failed to revoke key: %v", err)
+	}
+	if got := merge(true); !got.Revoked(time.Now()) || len(got.Identities) != 2 || len(got.Subkeys) != 2 {
+		t.Errorf("got key with revoked %v, %d identities and %d subkeys, want revoked key with 2 identities and 2 subkeys",
+			got.Revoked(time.Now()), len(got.Identities), len(got.Subkeys))
+	}
+	merge(false)
+}
+
+func TestMergeIdentityRevocation(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	e, err := openpgp.NewEntity(testName, testComment, testEmail, config)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	id := e.PrimaryIdentity()
+
+	sig := &packet.Signature{
+		Version:           e.PrimaryKey.Version,
+		SigType:           packet.SigTypeCertificationRevocation,
+		PubKeyAlgo:        e.PrimaryKey.PubKeyAlgo,
+		Hash:              crypto.SHA256,
+		CreationTime:      time.Now(),
+		IssuerKeyId:       &e.PrimaryKey.KeyId,
+		IssuerFingerprint: e.PrimaryKey.Fingerprint,
+	}
+	if err := sig.SignUserId(id.Name, e.PrimaryKey, e.PrivateKey, config); err != nil {
+		t.Fatalf("failed to revoke identity: %v", err)
+	}
+
+	// the revocation is the only new signature of the identity
+	revoked := *id
+	revoked.Revocations = append(slices.Clone(id.Revocations), sig)
+
+	merged, changed := mergeIdentity(id, &revoked)
+	if !changed {
+		t.Errorf("identity revocation not merged")
+	}
+	if !merged.Revoked(time.Now()) {
+		t.Errorf("merged identity not revoked")
+	}
+	if _, changed := mergeIdentity(merged, &revoked); changed {
+		t.Errorf("identity revocation merged twice")
+	}
+}
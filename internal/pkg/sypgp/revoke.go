@@ -0,0 +1,340 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/apptainer/apptainer/internal/pkg/util/interactive"
+	"github.com/apptainer/apptainer/pkg/sylog"
+)
+
+// RevocationDirectory is the directory of the keyring holding the
+// revocation certificates of revoked keys.
+const RevocationDirectory = "revocations"
+
+var errNotRevocation = errors.New("not a key revocation certificate")
+
+// revocationReasons maps the names of the reasons for revoking a key to
+// their OpenPGP code.
+var revocationReasons = map[string]packet.ReasonForRevocation{
+	"unspecified": packet.NoReason,
+	"superseded":  packet.KeySuperseded,
+	"compromised": packet.KeyCompromised,
+	"retired":     packet.KeyRetired,
+}
+
+// RevocationReasons returns the names of the reasons for revoking a key.
+func RevocationReasons() []string {
+	names := make([]string, 0, len(revocationReasons))
+	for name := range revocationReasons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseRevocationReason returns the reason for revoking a key named s.
+func ParseRevocationReason(s string) (packet.ReasonForRevocation, error) {
+	reason, ok := revocationReasons[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown revocation reason %q, must be one of %s", s, strings.Join(RevocationReasons(), ", "))
+	}
+	return reason, nil
+}
+
+// RevocationPath returns the path of the revocation certificate of the key
+// with the given fingerprint.
+func (keyring *Handle) RevocationPath(fingerprint []byte) string {
+	return filepath.Join(keyring.path, RevocationDirectory, fmt.Sprintf("%X.rev", fingerprint))
+}
+
+// RevokeKey revokes the private key matching fingerprint for reason,
+// explained by text. The revocation certificate is written to
+// RevocationPath, and the revoked key is stored in the private and public
+// keyrings.
+func (keyring *Handle) RevokeKey(fingerprint string, reason packet.ReasonForRevocation, text string) (*openpgp.Entity, error) {
+	if keyring.global {
+		return nil, fmt.Errorf("operation not supported for global keyring")
+	}
+
+	privateEntityList, err := keyring.LoadPrivKeyring()
+	if err != nil {
+		return nil, err
+	}
+	e := findKeyByFingerprint(privateEntityList, strings.ToUpper(fingerprint))
+	if e == nil {
+		return nil, fmt.Errorf("no private key matching fingerprint %s found", fingerprint)
+	}
+	if e.Revoked(time.Now()) {
+		return nil, fmt.Errorf("key %X is already revoked", e.PrimaryKey.Fingerprint)
+	}
+
+	var password string
+	if e.PrivateKey.Encrypted {
+		password, err = interactive.AskQuestionNoEcho("Enter key passphrase : ")
+		if err != nil {
+			return nil, err
+		}
+		if err := e.DecryptPrivateKeys([]byte(password)); err != nil {
+			return nil, err
+		}
+	}
+
+	conf := &packet.Config{DefaultHash: crypto.SHA384}
+	if err := e.RevokeKey(reason, text, conf); err != nil {
+		return nil, fmt.Errorf("could not revoke key: %v", err)
+	}
+	revocation := e.Revocations[len(e.Revocations)-1]
+
+	if password != "" {
+		if err := e.EncryptPrivateKeys([]byte(password), nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := keyring.storeRevocation(e.PrimaryKey.Fingerprint, revocation); err != nil {
+		return nil, fmt.Errorf("could not store revocation certificate: %v", err)
+	}
+
+	sylog.Verbosef("Updating local secret keyring: %v", keyring.SecretPath())
+	if err := keyring.storePrivKeyring(privateEntityList); err != nil {
+		return nil, err
+	}
+
+	publicEntityList, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return nil, err
+	}
+	if newList := removeKey(publicEntityList, fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)); newList != nil {
+		publicEntityList = newList
+	}
+	publicEntityList = append(publicEntityList, e)
+
+	sylog.Verbosef("Updating local keyring: %v", keyring.PublicPath())
+	if err := keyring.storePubKeyring(publicEntityList); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// storeRevocation writes the revocation certificate holding sig, which
+// revokes the key with the given fingerprint, to RevocationPath.
+func (keyring *Handle) storeRevocation(fingerprint []byte, sig *packet.Signature) error {
+	path := keyring.RevocationPath(fingerprint)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := createOrTruncateFile(path, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return writeRevocation(f, fingerprint, sig)
+}
+
+// writeRevocation writes the ASCII armored revocation certificate holding
+// sig, which revokes the key with the given fingerprint, to w.
+func writeRevocation(w io.Writer, fingerprint []byte, sig *packet.Signature) error {
+	headers := map[string]string{
+		"Comment": fmt.Sprintf("Revocation certificate for key %X", fingerprint),
+	}
+	wr, err := armor.Encode(w, openpgp.PublicKeyType, headers)
+	if err != nil {
+		return err
+	}
+	if err := sig.Serialize(wr); err != nil {
+		return err
+	}
+	return wr.Close()
+}
+
+// readRevocation returns the key revocation signature of the ASCII armored
+// or binary revocation certificate read from r.
+func readRevocation(r io.Reader) (*packet.Signature, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if block, err := armor.Decode(bytes.NewReader(b)); err == nil {
+		if b, err = io.ReadAll(block.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	p, err := packet.NewReader(bytes.NewReader(b)).Next()
+	if err != nil {
+		return nil, errNotRevocation
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok || sig.SigType != packet.SigTypeKeyRevocation {
+		return nil, errNotRevocation
+	}
+	return sig, nil
+}
+
+// hasRevocation returns whether e already holds the revocation signature sig.
+func hasRevocation(e *openpgp.Entity, sig *packet.Signature) bool {
+	for _, r := range e.Revocations {
+		if r.CreationTime.Equal(sig.CreationTime) && bytes.Equal(r.IssuerFingerprint, sig.IssuerFingerprint) &&
+			r.SigType == sig.SigType {
+			return true
+		}
+	}
+	return false
+}
+
+// addRevocation adds the revocation signature sig to e, once verified
+// against the primary key of e. It returns whether sig was added, or false
+// if e already holds it.
+func addRevocation(e *openpgp.Entity, sig *packet.Signature) (bool, error) {
+	if hasRevocation(e, sig) {
+		return false, nil
+	}
+	if err := e.PrimaryKey.VerifyRevocationSignature(sig); err != nil {
+		return false, fmt.Errorf("invalid revocation signature for key %X: %v", e.PrimaryKey.Fingerprint, err)
+	}
+	e.Revocations = append(e.Revocations, sig)
+	return true, nil
+}
+
+// mergeRevocations returns a copy of e holding the revocation signatures of
+// the entity of src with the same fingerprint as e, or e if there are none
+// to add.
+func mergeRevocations(e *openpgp.Entity, src openpgp.EntityList) *openpgp.Entity {
+	s := findEntityByFingerprint(src, e.PrimaryKey.Fingerprint)
+	if s == nil {
+		return e
+	}
+
+	ne := *e
+	ne.Revocations = append([]*packet.Signature(nil), e.Revocations...)
+	added := false
+	for _, sig := range s.Revocations {
+		ok, err := addRevocation(&ne, sig)
+		if err != nil {
+			sylog.Warningf("%v", err)
+			continue
+		}
+		added = added || ok
+	}
+	if !added {
+		return e
+	}
+	return &ne
+}
+
+// UpdateRevocations adds the revocation signatures of the keys of el to the
+// matching keys of the public keyring, and returns the fingerprints of the
+// keys which were revoked by the update.
+func (keyring *Handle) UpdateRevocations(el openpgp.EntityList) ([]string, error) {
+	publicEntityList, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	var revoked []string
+	for i, e := range publicEntityList {
+		if ne := mergeRevocations(e, el); ne != e {
+			publicEntityList[i] = ne
+			revoked = append(revoked, fmt.Sprintf("%X", e.PrimaryKey.Fingerprint))
+		}
+	}
+	if len(revoked) == 0 {
+		return nil, nil
+	}
+
+	sylog.Verbosef("Updating local keyring: %v", keyring.PublicPath())
+	if err := keyring.storePubKeyring(publicEntityList); err != nil {
+		return nil, err
+	}
+	return revoked, nil
+}
+
+// importRevocationFile adds the revocation certificate read from path to the
+// key it revokes.
+func (keyring *Handle) importRevocationFile(path string) (*openpgp.Entity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sig, err := readRevocation(f)
+	if err != nil {
+		return nil, err
+	}
+	return keyring.importRevocation(sig)
+}
+
+// importRevocation adds the revocation signature sig to the matching key of
+// the public keyring, and of the private keyring if present.
+func (keyring *Handle) importRevocation(sig *packet.Signature) (*openpgp.Entity, error) {
+	publicEntityList, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return nil, err
+	}
+	e := findRevokedEntity(publicEntityList, sig)
+	if e == nil {
+		return nil, fmt.Errorf("no public key matching the revocation certificate found")
+	}
+	if ok, err := addRevocation(e, sig); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("key %X already holds this revocation", e.PrimaryKey.Fingerprint)
+	}
+	if err := keyring.storePubKeyring(publicEntityList); err != nil {
+		return nil, err
+	}
+
+	if keyring.global {
+		return e, nil
+	}
+	privateEntityList, err := keyring.LoadPrivKeyring()
+	if err != nil {
+		return nil, err
+	}
+	if pe := findRevokedEntity(privateEntityList, sig); pe != nil {
+		if ok, _ := addRevocation(pe, sig); ok {
+			if err := keyring.storePrivKeyring(privateEntityList); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return e, nil
+}
+
+// findRevokedEntity returns the entity of el issuing the revocation
+// signature sig.
+func findRevokedEntity(el openpgp.EntityList, sig *packet.Signature) *openpgp.Entity {
+	for _, e := range el {
+		if sig.IssuerFingerprint != nil {
+			if bytes.Equal(e.PrimaryKey.Fingerprint, sig.IssuerFingerprint) {
+				return e
+			}
+		} else if sig.IssuerKeyId != nil && e.PrimaryKey.KeyId == *sig.IssuerKeyId {
+			return e
+		}
+	}
+	return nil
+}
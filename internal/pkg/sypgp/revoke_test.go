@@ -0,0 +1,215 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/apptainer/apptainer/internal/pkg/test"
+)
+
+func TestParseRevocationReason(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    packet.ReasonForRevocation
+		wantErr bool
+	}{
+		{s: "unspecified", want: packet.NoReason},
+		{s: "superseded", want: packet.KeySuperseded},
+		{s: "Compromised", want: packet.KeyCompromised},
+		{s: "retired", want: packet.KeyRetired},
+		{s: "lost", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseRevocationReason(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got reason %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevokeKey(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	keyring := NewHandle(t.TempDir())
+
+	e, err := keyring.GenKeyPair(GenKeyPairOptions{
+		Name:    testName,
+		Email:   testEmail,
+		KeyType: KeyTypeEd25519,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate key pair: %v", err)
+	}
+	fp := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+
+	// keep a copy of the public key before revocation
+	other := NewHandle(t.TempDir())
+	if err := other.appendPubKey(e); err != nil {
+		t.Fatalf("failed to store public key: %v", err)
+	}
+
+	if _, err := keyring.RevokeKey("0000000000000000000000000000000000000000", packet.NoReason, ""); err == nil {
+		t.Errorf("unexpected success with unknown fingerprint")
+	}
+	if _, err := keyring.RevokeKey(fp, packet.KeyCompromised, "lost laptop"); err != nil {
+		t.Fatalf("failed to revoke key: %v", err)
+	}
+	if _, err := keyring.RevokeKey(fp, packet.KeyCompromised, "lost laptop"); err == nil {
+		t.Errorf("unexpected success revoking a revoked key")
+	}
+
+	for _, load := range []func() (openpgp.EntityList, error){keyring.LoadPrivKeyring, keyring.LoadPubKeyring} {
+		el, err := load()
+		if err != nil {
+			t.Fatalf("failed to load keyring: %v", err)
+		}
+		if len(el) != 1 {
+			t.Fatalf("got %d keys, want 1", len(el))
+		}
+		if !el[0].Revoked(time.Now()) {
+			t.Errorf("key not revoked in keyring")
+		}
+	}
+
+	path := keyring.RevocationPath(e.PrimaryKey.Fingerprint)
+	if got, want := filepath.Dir(path), filepath.Join(keyring.path, RevocationDirectory); got != want {
+		t.Errorf("got revocation directory %s, want %s", got, want)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open revocation certificate: %v", err)
+	}
+	defer f.Close()
+	sig, err := readRevocation(f)
+	if err != nil {
+		t.Fatalf("failed to read revocation certificate: %v", err)
+	}
+	if sig.RevocationReason == nil || *sig.RevocationReason != packet.KeyCompromised {
+		t.Errorf("unexpected revocation reason %v", sig.RevocationReason)
+	}
+	if sig.RevocationReasonText != "lost laptop" {
+		t.Errorf("got revocation text %q, want %q", sig.RevocationReasonText, "lost laptop")
+	}
+
+	// importing the certificate revokes the copy of the public key
+	if err := other.ImportKey(path, false); err != nil {
+		t.Fatalf("failed to import revocation certificate: %v", err)
+	}
+	el, err := other.LoadPubKeyring()
+	if err != nil {
+		t.Fatalf("failed to load keyring: %v", err)
+	}
+	if len(el) != 1 || !el[0].Revoked(time.Now()) {
+		t.Errorf("key not revoked by imported certificate")
+	}
+	if err := other.ImportKey(path, false); err == nil {
+		t.Errorf("unexpected success importing the certificate twice")
+	}
+}
+
+func TestUpdateRevocations(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	keyring := NewHandle(t.TempDir())
+
+	e, err := keyring.GenKeyPair(GenKeyPairOptions{
+		Name:    testName,
+		Email:   testEmail,
+		KeyType: KeyTypeEd25519,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate key pair: %v", err)
+	}
+	other, err := keyring.GenKeyPair(GenKeyPairOptions{
+		Name:    testName,
+		Email:   testEmail,
+		KeyType: KeyTypeEd25519,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate key pair: %v", err)
+	}
+
+	if got, err := keyring.UpdateRevocations(openpgp.EntityList{e, other}); err != nil {
+		t.Fatalf("failed to update revocations: %v", err)
+	} else if len(got) != 0 {
+		t.Errorf("got %d keys revoked, want none", len(got))
+	}
+
+	revoked := *e
+	revoked.Revocations = nil
+	if err := revoked.RevokeKey(packet.KeyRetired, "", nil); err != nil {
+		t.Fatalf("failed to revoke key: %v", err)
+	}
+
+	// revocation signed by another key is ignored
+	forged := *other
+	forged.PrimaryKey = e.PrimaryKey
+	forged.Revocations = nil
+	sig := createRevocation(t, other)
+	forged.Revocations = append(forged.Revocations, sig)
+	if got, err := keyring.UpdateRevocations(openpgp.EntityList{&forged}); err != nil {
+		t.Fatalf("failed to update revocations: %v", err)
+	} else if len(got) != 0 {
+		t.Errorf("got %d keys revoked by forged revocation, want none", len(got))
+	}
+
+	got, err := keyring.UpdateRevocations(openpgp.EntityList{&revoked})
+	if err != nil {
+		t.Fatalf("failed to update revocations: %v", err)
+	}
+	if want := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint); len(got) != 1 || got[0] != want {
+		t.Errorf("got keys revoked %v, want %v", got, want)
+	}
+
+	el, err := keyring.LoadPubKeyring()
+	if err != nil {
+		t.Fatalf("failed to load keyring: %v", err)
+	}
+	for _, k := range el {
+		isRevoked := k.Revoked(time.Now())
+		if want := k.PrimaryKey.KeyId == e.PrimaryKey.KeyId; isRevoked != want {
+			t.Errorf("key %X revoked %v, want %v", k.PrimaryKey.Fingerprint, isRevoked, want)
+		}
+	}
+}
+
+// createRevocation returns a revocation signature of the key of e.
+func createRevocation(t *testing.T, e *openpgp.Entity) *packet.Signature {
+	t.Helper()
+
+	c := *e
+	c.Revocations = nil
+	if err := c.RevokeKey(packet.NoReason, "", nil); err != nil {
+		t.Fatalf("failed to revoke key: %v", err)
+	}
+	return c.Revocations[0]
+}
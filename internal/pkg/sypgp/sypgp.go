@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
@@ -86,6 +87,17 @@ type Handle struct {
 	global bool
 }
 
+// KeyType is the public key algorithm of a generated key pair.
+type KeyType string
+
+const (
+	// KeyTypeRSA generates RSA keys of GenKeyPairOptions.KeyLength bits.
+	KeyTypeRSA KeyType = "rsa"
+	// KeyTypeEd25519 generates an Ed25519 signing key, with a Curve25519
+	// encryption subkey.
+	KeyTypeEd25519 KeyType = "ed25519"
+)
+
 // GenKeyPairOptions parameters needed for generating new key pair.
 type GenKeyPairOptions struct {
 	Name      string
@@ -93,6 +105,65 @@ type GenKeyPairOptions struct {
 	Comment   string
 	Password  string
 	KeyLength int
+	// KeyType is the public key algorithm, RSA if not set.
+	KeyType KeyType
+	// Expiry is the expiry date of the key pair, which never expires if
+	// not set.
+	Expiry time.Time
+	// SigningSubkey adds a signing subkey, used to sign images in place of
+	// the primary key.
+	SigningSubkey bool
+}
+
+// packetConfig returns the configuration to generate the key pair at time now.
+func (opts GenKeyPairOptions) packetConfig(now time.Time) (*packet.Config, error) {
+	conf := &packet.Config{
+		DefaultHash: crypto.SHA384,
+		Time:        func() time.Time { return now },
+	}
+
+	switch opts.KeyType {
+	case "", KeyTypeRSA:
+		conf.Algorithm = packet.PubKeyAlgoRSA
+		conf.RSABits = opts.KeyLength
+	case KeyTypeEd25519:
+		conf.Algorithm = packet.PubKeyAlgoEdDSA
+		conf.Curve = packet.Curve25519
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", opts.KeyType)
+	}
+
+	if !opts.Expiry.IsZero() {
+		lifetime, err := keyLifetime(now, opts.Expiry)
+		if err != nil {
+			return nil, err
+		}
+		conf.KeyLifetimeSecs = lifetime
+	}
+	return conf, nil
+}
+
+// keyLifetime returns the lifetime in seconds of a key created at created
+// and expiring at expiry.
+func keyLifetime(created, expiry time.Time) (uint32, error) {
+	secs := expiry.Unix() - created.Unix()
+	if secs <= 0 {
+		return 0, fmt.Errorf("expiry date %s is before the key creation", expiry.Format(time.RFC3339))
+	}
+	if secs > math.MaxUint32 {
+		return 0, fmt.Errorf("expiry date %s is too far in the future", expiry.Format(time.RFC3339))
+	}
+	return uint32(secs), nil
+}
+
+// KeyExpiry returns the expiry date of the primary key of e, and false if it
+// never expires.
+func KeyExpiry(e *openpgp.Entity) (time.Time, bool) {
+	sig, _ := e.PrimarySelfSignature()
+	if sig == nil || sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs == 0 {
+		return time.Time{}, false
+	}
+	return e.PrimaryKey.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second), true
 }
 
 func (e *KeyExistsError) Error() string {
@@ -292,6 +363,12 @@ func printEntity(w io.Writer, index int, e *openpgp.Entity) {
 	fmt.Fprintf(tw, "\tFingerprint:\t%0X\n", e.PrimaryKey.Fingerprint)
 	bits, _ := e.PrimaryKey.BitLength()
 	fmt.Fprintf(tw, "\tLength (in bits):\t%d\n", bits)
+	if t, ok := KeyExpiry(e); ok {
+		fmt.Fprintf(tw, "\tExpiry time:\t%s\n", t)
+	}
+	if len(e.Revocations) > 0 {
+		fmt.Fprintf(tw, "\tRevocation time:\t%s\n", e.Revocations[0].CreationTime)
+	}
 	tw.Flush()
 	fmt.Fprintln(w)
 }
@@ -370,10 +447,8 @@ func (keyring *Handle) storePrivKeyring(keys openpgp.EntityList) error {
 	}
 	defer f.Close()
 
-	for _, k := range keys {
-		if err := k.Serialize(f); err != nil {
-			return fmt.Errorf("could not store private key: %s", err)
-		}
+	if err := storePrivKeys(f, keys); err != nil {
+		return fmt.Errorf("could not store private key: %s", err)
 	}
 
 	return nil
@@ -529,13 +604,22 @@ func (keyring *Handle) RemovePrivKey(toDelete string) error {
 }
 
 func (keyring *Handle) genKeyPair(opts GenKeyPairOptions) (*openpgp.Entity, error) {
-	conf := &packet.Config{RSABits: opts.KeyLength, DefaultHash: crypto.SHA384}
+	conf, err := opts.packetConfig(time.Now())
+	if err != nil {
+		return nil, err
+	}
 
 	entity, err := openpgp.NewEntity(opts.Name, opts.Comment, opts.Email, conf)
 	if err != nil {
 		return nil, err
 	}
 
+	if opts.SigningSubkey {
+		if err := entity.AddSigningSubkey(conf); err != nil {
+			return nil, err
+		}
+	}
+
 	if opts.Password != "" {
 		// Encrypt private key
 		if err = EncryptKey(entity, opts.Password); err != nil {
@@ -586,15 +670,172 @@ func DecryptKey(k *openpgp.Entity, message string) error {
 		return err
 	}
 
-	return k.PrivateKey.Decrypt([]byte(pass))
+	return k.DecryptPrivateKeys([]byte(pass))
 }
 
-// EncryptKey encrypts a private key using a pass phrase
+// EncryptKey encrypts a private key, and its subkeys, using a pass phrase
 func EncryptKey(k *openpgp.Entity, pass string) error {
 	if k.PrivateKey.Encrypted {
 		return fmt.Errorf("key already encrypted")
 	}
-	return k.PrivateKey.Encrypt([]byte(pass))
+	return k.EncryptPrivateKeys([]byte(pass), nil)
+}
+
+// SigningEntity returns the entity to sign with the key pair e: e itself, or
+// a copy of e holding the private key of its signing subkey in place of the
+// primary private key. Signatures made with the copy are issued by the subkey
+// and attributed to the fingerprint of the primary key. An error is returned
+// if e is revoked or expired.
+func SigningEntity(e *openpgp.Entity) (*openpgp.Entity, error) {
+	now := time.Now()
+	if e.Revoked(now) {
+		return nil, fmt.Errorf("key %X has been revoked", e.PrimaryKey.Fingerprint)
+	}
+	if t, ok := KeyExpiry(e); ok && now.After(t) {
+		return nil, fmt.Errorf("key %X expired on %s", e.PrimaryKey.Fingerprint, t.Format(time.DateOnly))
+	}
+
+	k, ok := e.SigningKey(now)
+	if !ok {
+		return nil, fmt.Errorf("key %X has no valid signing key", e.PrimaryKey.Fingerprint)
+	}
+	if k.PrivateKey == nil {
+		return nil, fmt.Errorf("key %X has no private signing key", e.PrimaryKey.Fingerprint)
+	}
+	if k.PrivateKey == e.PrivateKey {
+		return e, nil
+	}
+
+	se := *e
+	se.PrivateKey = k.PrivateKey
+	return &se, nil
+}
+
+// ExtendKey sets the expiry date of the private key matching fingerprint, and
+// of its subkeys that expire, to expiry, or removes their expiry if expiry is
+// not set. The new self-signatures are stored in the private and public
+// keyrings.
+func (keyring *Handle) ExtendKey(fingerprint string, expiry time.Time) (*openpgp.Entity, error) {
+	if keyring.global {
+		return nil, fmt.Errorf("operation not supported for global keyring")
+	}
+
+	now := time.Now()
+	if !expiry.IsZero() && !expiry.After(now) {
+		return nil, fmt.Errorf("expiry date %s is in the past", expiry.Format(time.RFC3339))
+	}
+
+	privateEntityList, err := keyring.LoadPrivKeyring()
+	if err != nil {
+		return nil, err
+	}
+	e := findKeyByFingerprint(privateEntityList, strings.ToUpper(fingerprint))
+	if e == nil {
+		return nil, fmt.Errorf("no private key matching fingerprint %s found", fingerprint)
+	}
+
+	var password string
+	if e.PrivateKey.Encrypted {
+		password, err = interactive.AskQuestionNoEcho("Enter key passphrase : ")
+		if err != nil {
+			return nil, err
+		}
+		if err := e.DecryptPrivateKeys([]byte(password)); err != nil {
+			return nil, err
+		}
+	}
+
+	conf := &packet.Config{
+		DefaultHash: crypto.SHA384,
+		Time:        func() time.Time { return now },
+	}
+	if err := setKeyExpiry(e, expiry, conf); err != nil {
+		return nil, err
+	}
+
+	if password != "" {
+		if err := e.EncryptPrivateKeys([]byte(password), nil); err != nil {
+			return nil, err
+		}
+	}
+
+	sylog.Verbosef("Updating local secret keyring: %v", keyring.SecretPath())
+	if err := keyring.storePrivKeyring(privateEntityList); err != nil {
+		return nil, err
+	}
+
+	publicEntityList, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return nil, err
+	}
+	if newList := removeKey(publicEntityList, fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)); newList != nil {
+		publicEntityList = newList
+	}
+	publicEntityList = append(publicEntityList, e)
+
+	sylog.Verbosef("Updating local keyring: %v", keyring.PublicPath())
+	if err := keyring.storePubKeyring(publicEntityList); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// setKeyExpiry renews the self-signatures of the identities of e with the
+// expiry date expiry, and the binding signatures of the subkeys of e which
+// expire. The private key of e must be decrypted.
+func setKeyExpiry(e *openpgp.Entity, expiry time.Time, conf *packet.Config) error {
+	var lifetime uint32
+	if !expiry.IsZero() {
+		var err error
+		if lifetime, err = keyLifetime(e.PrimaryKey.CreationTime, expiry); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range e.Identities {
+		if id.SelfSignature == nil {
+			continue
+		}
+		old := id.SelfSignature
+		sig := *old
+		sig.CreationTime = conf.Now()
+		sig.KeyLifetimeSecs = &lifetime
+		if err := sig.SignUserId(id.UserId.Id, e.PrimaryKey, e.PrivateKey, conf); err != nil {
+			return err
+		}
+		id.SelfSignature = &sig
+
+		signatures := []*packet.Signature{&sig}
+		for _, s := range id.Signatures {
+			if s != old {
+				signatures = append(signatures, s)
+			}
+		}
+		id.Signatures = signatures
+	}
+
+	for i := range e.Subkeys {
+		sk := &e.Subkeys[i]
+		if sk.Sig.KeyLifetimeSecs == nil || *sk.Sig.KeyLifetimeSecs == 0 {
+			// bound by the expiry of the primary key
+			continue
+		}
+		subLifetime := uint32(0)
+		if !expiry.IsZero() {
+			var err error
+			if subLifetime, err = keyLifetime(sk.PublicKey.CreationTime, expiry); err != nil {
+				return err
+			}
+		}
+		sig := *sk.Sig
+		sig.CreationTime = conf.Now()
+		sig.KeyLifetimeSecs = &subLifetime
+		if err := sig.SignKey(sk.PublicKey, e.PrivateKey, conf); err != nil {
+			return err
+		}
+		sk.Sig = &sig
+	}
+	return nil
 }
 
 // selectPubKey prints a public key list to user and returns the choice
@@ -990,11 +1231,11 @@ func RecryptKey(k *openpgp.Entity, passphrase []byte) error {
 		return errNotEncrypted
 	}
 
-	if err := k.PrivateKey.Decrypt(passphrase); err != nil {
+	if err := k.DecryptPrivateKeys(passphrase); err != nil {
 		return err
 	}
 
-	return k.PrivateKey.Encrypt(passphrase)
+	return k.EncryptPrivateKeys(passphrase, nil)
 }
 
 // ExportPrivateKey Will export a private key into a file (kpath).
@@ -1125,7 +1366,7 @@ func (keyring *Handle) importPrivateKey(entity *openpgp.Entity, setNewPassword b
 		if err != nil {
 			return err
 		}
-		if err := newEntity.PrivateKey.Decrypt([]byte(password)); err != nil {
+		if err := newEntity.DecryptPrivateKeys([]byte(password)); err != nil {
 			return err
 		}
 	}
@@ -1139,7 +1380,7 @@ func (keyring *Handle) importPrivateKey(entity *openpgp.Entity, setNewPassword b
 	}
 
 	if password != "" {
-		if err := newEntity.PrivateKey.Encrypt([]byte(password)); err != nil {
+		if err := newEntity.EncryptPrivateKeys([]byte(password), nil); err != nil {
 			return err
 		}
 	}
@@ -1166,11 +1407,19 @@ func (keyring *Handle) importPublicKey(entity *openpgp.Entity) error {
 
 // ImportKey imports one or more keys from the specified file. The keys
 // can be either a public or private keys, and the file can be either in
-// binary or ascii-armored format.
+// binary or ascii-armored format. A revocation certificate is added to the
+// key it revokes.
 func (keyring *Handle) ImportKey(kpath string, setNewPassword bool) error {
 	// Load the private key as an entitylist
 	pathEntityList, err := loadKeysFromFile(kpath)
 	if err != nil {
+		// perhaps it's a revocation certificate?
+		if e, rerr := keyring.importRevocationFile(kpath); rerr == nil {
+			fmt.Printf("Key with fingerprint %X successfully revoked\n", e.PrimaryKey.Fingerprint)
+			return nil
+		} else if !errors.Is(rerr, errNotRevocation) {
+			return rerr
+		}
 		return fmt.Errorf("unable to get entity from: %s: %v", kpath, err)
 	}
 
@@ -13,12 +13,15 @@ package sypgp
 import (
 	"bytes"
 	"encoding/hex"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/ProtonMail/go-crypto/openpgp/armor"
@@ -465,6 +468,22 @@ func TestGenKeyPair(t *testing.T) {
 			encrypted: true,
 			shallPass: true,
 		},
+		{
+			name:      "valid case, ed25519 with signing subkey and expiry",
+			options:   GenKeyPairOptions{Name: "teste", Email: "test@my.info", Password: "1234", KeyType: KeyTypeEd25519, SigningSubkey: true, Expiry: time.Now().AddDate(1, 0, 0)},
+			encrypted: true,
+			shallPass: true,
+		},
+		{
+			name:      "invalid key type",
+			options:   GenKeyPairOptions{Name: "teste", Email: "test@my.info", KeyType: "dsa"},
+			shallPass: false,
+		},
+		{
+			name:      "expiry in the past",
+			options:   GenKeyPairOptions{Name: "teste", Email: "test@my.info", Expiry: time.Now().AddDate(-1, 0, 0)},
+			shallPass: false,
+		},
 	}
 
 	// Create a temporary directory to store the keyring
@@ -491,6 +510,130 @@ func TestGenKeyPair(t *testing.T) {
 	}
 }
 
+func TestSigningEntity(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	now := time.Now()
+	newEntity := func(t *testing.T, opts GenKeyPairOptions, created time.Time) *openpgp.Entity {
+		conf, err := opts.packetConfig(created)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := openpgp.NewEntity(testName, testComment, testEmail, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opts.SigningSubkey {
+			if err := e.AddSigningSubkey(conf); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return e
+	}
+
+	t.Run("PrimaryKey", func(t *testing.T) {
+		e := newEntity(t, GenKeyPairOptions{KeyType: KeyTypeEd25519}, now)
+		se, err := SigningEntity(e)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if se.PrivateKey != e.PrivateKey {
+			t.Errorf("expected primary key to sign")
+		}
+	})
+
+	t.Run("SigningSubkey", func(t *testing.T) {
+		e := newEntity(t, GenKeyPairOptions{KeyType: KeyTypeEd25519, SigningSubkey: true}, now)
+		se, err := SigningEntity(e)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if se.PrivateKey != e.Subkeys[1].PrivateKey {
+			t.Errorf("expected signing subkey to sign")
+		}
+		if !bytes.Equal(se.PrimaryKey.Fingerprint, e.PrimaryKey.Fingerprint) {
+			t.Errorf("expected primary key fingerprint")
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		created := now.AddDate(-2, 0, 0)
+		e := newEntity(t, GenKeyPairOptions{KeyType: KeyTypeEd25519, Expiry: created.AddDate(1, 0, 0)}, created)
+		if _, err := SigningEntity(e); err == nil || !strings.Contains(err.Error(), "expired") {
+			t.Errorf("got error %v, want expired", err)
+		}
+	})
+}
+
+func TestExtendKey(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	keyring := NewHandle(t.TempDir())
+
+	e, err := keyring.GenKeyPair(GenKeyPairOptions{
+		Name:          testName,
+		Email:         testEmail,
+		KeyType:       KeyTypeEd25519,
+		SigningSubkey: true,
+		Expiry:        time.Now().AddDate(0, 1, 0),
+	})
+	if err != nil {
+		t.Fatalf("failed to generate key pair: %v", err)
+	}
+	fp := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+
+	if _, err := keyring.ExtendKey(fp, time.Now().AddDate(0, 0, -1)); err == nil {
+		t.Errorf("unexpected success with expiry in the past")
+	}
+	if _, err := keyring.ExtendKey("0000000000000000000000000000000000000000", time.Now().AddDate(1, 0, 0)); err == nil {
+		t.Errorf("unexpected success with unknown fingerprint")
+	}
+
+	expiry := time.Now().AddDate(2, 0, 0).Truncate(time.Second)
+	if _, err := keyring.ExtendKey(fp, expiry); err != nil {
+		t.Fatalf("failed to extend key: %v", err)
+	}
+
+	for _, load := range []func() (openpgp.EntityList, error){keyring.LoadPrivKeyring, keyring.LoadPubKeyring} {
+		el, err := load()
+		if err != nil {
+			t.Fatalf("failed to load keyring: %v", err)
+		}
+		if len(el) != 1 {
+			t.Fatalf("got %d keys, want 1", len(el))
+		}
+		if got, ok := KeyExpiry(el[0]); !ok || !got.Equal(expiry) {
+			t.Errorf("got expiry %v, want %v", got, expiry)
+		}
+		// the signing subkey must still be valid past the previous expiry
+		k, ok := el[0].SigningKey(time.Now().AddDate(1, 0, 0))
+		if !ok || k.PublicKey == el[0].PrimaryKey {
+			t.Errorf("signing subkey not valid after extension")
+		}
+	}
+
+	if _, err := keyring.ExtendKey(fp, time.Time{}); err != nil {
+		t.Fatalf("failed to remove key expiry: %v", err)
+	}
+	el, err := keyring.LoadPrivKeyring()
+	if err != nil {
+		t.Fatalf("failed to load keyring: %v", err)
+	}
+	if _, ok := KeyExpiry(el[0]); ok {
+		t.Errorf("key still expires")
+	}
+	if el[0].PrivateKey == nil {
+		t.Errorf("private key lost from the private keyring")
+	}
+}
+
 func TestCompareKeyEntity(t *testing.T) {
 	cases := []struct {
 		name        string
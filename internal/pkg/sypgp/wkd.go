@@ -0,0 +1,229 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/apptainer/apptainer/pkg/sylog"
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
+)
+
+const (
+	// wkdTimeout is the timeout of a Web Key Directory request.
+	wkdTimeout = 30 * time.Second
+	// wkdMaxKeySize is the maximum size of the keys served for an address.
+	wkdMaxKeySize = 4 << 20
+)
+
+// zbase32 is the z-base-32 encoding used to encode the hashed local part of
+// addresses in Web Key Directory URLs.
+var zbase32 = base32.NewEncoding("ybndrfg8ejkmcpqxot1uwisza345h769").WithPadding(base32.NoPadding)
+
+var errWKDKeyNotFound = errors.New("no key found in web key directory")
+
+// wkdOpts are the options of Web Key Directory lookups.
+type wkdOpts struct {
+	client *http.Client
+}
+
+// WKDOpt are used to configure Web Key Directory lookups.
+type WKDOpt func(*wkdOpts)
+
+// OptWKDHTTPClient sets the HTTP client used to query Web Key Directories.
+func OptWKDHTTPClient(c *http.Client) WKDOpt {
+	return func(o *wkdOpts) {
+		o.client = c
+	}
+}
+
+// IsEmail returns whether s is a bare email address.
+func IsEmail(s string) bool {
+	a, err := mail.ParseAddress(s)
+	return err == nil && a.Address == s
+}
+
+// wkdHash returns the z-base-32 encoded SHA-1 digest of the lowercase local
+// part of an address.
+func wkdHash(local string) string {
+	sum := sha1.Sum([]byte(strings.ToLower(local))) //nolint:gosec // SHA-1 is mandated by the WKD specification
+	return zbase32.EncodeToString(sum[:])
+}
+
+// wkdURLs returns the URLs of the keys of email in the Web Key Directory,
+// with the advanced and direct methods.
+func wkdURLs(email string) (advanced, direct string, err error) {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" || domain == "" || strings.Contains(domain, "@") {
+		return "", "", fmt.Errorf("invalid email address %q", email)
+	}
+	domain = strings.ToLower(domain)
+	query := "?l=" + url.QueryEscape(local)
+	hash := wkdHash(local)
+
+	advanced = fmt.Sprintf("https://openpgpkey.%s/.well-known/openpgpkey/%s/hu/%s%s", domain, domain, hash, query)
+	direct = fmt.Sprintf("https://%s/.well-known/openpgpkey/hu/%s%s", domain, hash, query)
+	return advanced, direct, nil
+}
+
+// FetchWKD retrieves the public keys of email from its Web Key Directory. The
+// advanced method is tried first, then the direct method. Only the keys with
+// a user ID matching email are returned.
+func FetchWKD(ctx context.Context, email string, opts ...WKDOpt) (openpgp.EntityList, error) {
+	o := wkdOpts{
+		client: &http.Client{Timeout: wkdTimeout},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	advanced, direct, err := wkdURLs(email)
+	if err != nil {
+		return nil, err
+	}
+
+	el, err := fetchWKDKeys(ctx, o.client, advanced)
+	if err != nil {
+		sylog.Debugf("Web key directory advanced method failed for %s: %v", email, err)
+		if el, err = fetchWKDKeys(ctx, o.client, direct); err != nil {
+			return nil, fmt.Errorf("while looking up %s in web key directory: %w", email, err)
+		}
+	}
+
+	var keys openpgp.EntityList
+	for _, e := range el {
+		if entityHasEmail(e, email) {
+			keys = append(keys, e)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("web key directory returned no key with user ID %s", email)
+	}
+	return keys, nil
+}
+
+// fetchWKDKeys retrieves the binary or ASCII armored keys served at u.
+func fetchWKDKeys(ctx context.Context, c *http.Client, u string) (openpgp.EntityList, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", useragent.Value())
+
+	sylog.Debugf("Fetching keys from %s", u)
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errWKDKeyNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from %s: %s", u, res.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, wkdMaxKeySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > wkdMaxKeySize {
+		return nil, fmt.Errorf("keys served by %s exceed %d bytes", u, wkdMaxKeySize)
+	}
+
+	if el, err := openpgp.ReadKeyRing(bytes.NewReader(b)); err == nil {
+		return el, nil
+	}
+	return openpgp.ReadArmoredKeyRing(bytes.NewReader(b))
+}
+
+// entityHasEmail returns whether one of the user IDs of e has address email.
+func entityHasEmail(e *openpgp.Entity, email string) bool {
+	for _, id := range e.Identities {
+		if strings.EqualFold(id.UserId.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// wkdKeyRing is a keyring retrieving the keys missing from a keyring from
+// the Web Key Directories of a set of addresses. The type satisfies the
+// openpgp.KeyRing interface.
+type wkdKeyRing struct {
+	openpgp.KeyRing
+	ctx    context.Context //nolint:containedctx // Context, for use when retrieving keys remotely.
+	emails []string
+	opts   []WKDOpt
+
+	once sync.Once
+	el   openpgp.EntityList
+}
+
+// NewWKDKeyRing returns a keyring backed by kr, and by the Web Key
+// Directories of emails for keys missing from kr.
+func NewWKDKeyRing(ctx context.Context, kr openpgp.KeyRing, emails []string, opts ...WKDOpt) openpgp.KeyRing {
+	return &wkdKeyRing{
+		KeyRing: kr,
+		ctx:     ctx,
+		emails:  emails,
+		opts:    opts,
+	}
+}
+
+// remote returns the keys of the Web Key Directories, retrieved once.
+func (kr *wkdKeyRing) remote() openpgp.EntityList {
+	kr.once.Do(func() {
+		for _, email := range kr.emails {
+			el, err := FetchWKD(kr.ctx, email, kr.opts...)
+			if err != nil {
+				sylog.Warningf("failed to get key material: %v", err)
+				continue
+			}
+			sylog.Infof("Retrieved key(s) of %s from web key directory", email)
+			kr.el = append(kr.el, el...)
+		}
+	})
+	return kr.el
+}
+
+// KeysById returns the set of keys that have the given key id.
+//
+//nolint:revive  // golang/x/crypto uses Id instead of ID so we have to too
+func (kr *wkdKeyRing) KeysById(id uint64) []openpgp.Key {
+	if keys := kr.KeyRing.KeysById(id); len(keys) > 0 {
+		return keys
+	}
+	return kr.remote().KeysById(id)
+}
+
+// KeysByIdUsage returns the set of keys with the given id that also meet the key usage given by
+// requiredUsage. The requiredUsage is expressed as the bitwise-OR of packet.KeyFlag* values.
+//
+//nolint:revive  // golang/x/crypto uses Id instead of ID so we have to too
+func (kr *wkdKeyRing) KeysByIdUsage(id uint64, requiredUsage byte) []openpgp.Key {
+	if keys := kr.KeyRing.KeysByIdUsage(id, requiredUsage); len(keys) > 0 {
+		return keys
+	}
+	return kr.remote().KeysByIdUsage(id, requiredUsage)
+}
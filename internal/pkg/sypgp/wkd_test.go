@@ -0,0 +1,233 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sypgp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestWKDHash(t *testing.T) {
+	// test vector of the Web Key Directory specification
+	if got, want := wkdHash("Joe.Doe"), "iy9q119eutrkn8s1mk4r39qejnbu3n5q"; got != want {
+		t.Errorf("got hash %s, want %s", got, want)
+	}
+}
+
+func TestWKDURLs(t *testing.T) {
+	tests := []struct {
+		name         string
+		email        string
+		wantAdvanced string
+		wantDirect   string
+		wantErr      bool
+	}{
+		{
+			name:         "Valid",
+			email:        "Joe.Doe@Example.ORG",
+			wantAdvanced: "https://openpgpkey.example.org/.well-known/openpgpkey/example.org/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe",
+			wantDirect:   "https://example.org/.well-known/openpgpkey/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe",
+		},
+		{
+			name:    "NoDomain",
+			email:   "joe.doe",
+			wantErr: true,
+		},
+		{
+			name:    "NoLocal",
+			email:   "@example.org",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			advanced, direct, err := wkdURLs(tt.email)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if advanced != tt.wantAdvanced {
+				t.Errorf("got advanced URL %s, want %s", advanced, tt.wantAdvanced)
+			}
+			if direct != tt.wantDirect {
+				t.Errorf("got direct URL %s, want %s", direct, tt.wantDirect)
+			}
+		})
+	}
+}
+
+func TestIsEmail(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"joe.doe@example.org", true},
+		{"Joe Doe <joe.doe@example.org>", false},
+		{"8883491F4268F173C6E5DC49EDECE4F3F38D871E", false},
+		{"joe.doe", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsEmail(tt.s); got != tt.want {
+			t.Errorf("IsEmail(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+// newWKDTestEntity returns a new Ed25519 entity with user ID email.
+func newWKDTestEntity(t *testing.T, email string) *openpgp.Entity {
+	t.Helper()
+
+	e, err := openpgp.NewEntity("WKD Test", "", email, &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// serializeTestEntities returns the binary public keys of el.
+func serializeTestEntities(t *testing.T, el ...*openpgp.Entity) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	for _, e := range el {
+		if err := e.Serialize(&b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.Bytes()
+}
+
+// newWKDTestServer returns a HTTPS server serving the keys of paths, for any
+// host, and a client resolving all hosts to the server.
+func newWKDTestServer(t *testing.T, paths map[string][]byte) (*httptest.Server, *http.Client) {
+	t.Helper()
+
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, ok := paths[r.Host+r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(b)
+	}))
+	t.Cleanup(s.Close)
+
+	tr := s.Client().Transport.(*http.Transport).Clone()
+	tr.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, s.Listener.Addr().String())
+	}
+	return s, &http.Client{Transport: tr}
+}
+
+func TestFetchWKD(t *testing.T) {
+	joe := newWKDTestEntity(t, "joe.doe@example.com")
+	jane := newWKDTestEntity(t, "jane.doe@example.com")
+	other := newWKDTestEntity(t, "other@example.com")
+
+	joeHash := wkdHash("joe.doe")
+	janeHash := wkdHash("jane.doe")
+	otherHash := wkdHash("other")
+
+	armored, err := serializeEntity(jane, openpgp.PublicKeyType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, c := newWKDTestServer(t, map[string][]byte{
+		// advanced method
+		"openpgpkey.example.com/.well-known/openpgpkey/example.com/hu/" + joeHash: serializeTestEntities(t, joe, other),
+		// direct method only, ASCII armored
+		"example.com/.well-known/openpgpkey/hu/" + janeHash: []byte(armored),
+		// wrong key
+		"example.com/.well-known/openpgpkey/hu/" + otherHash: serializeTestEntities(t, joe),
+	})
+
+	tests := []struct {
+		name    string
+		email   string
+		want    *openpgp.Entity
+		wantErr bool
+	}{
+		{name: "Advanced", email: "joe.doe@example.com", want: joe},
+		{name: "AdvancedCase", email: "Joe.Doe@EXAMPLE.com", want: joe},
+		{name: "Direct", email: "jane.doe@example.com", want: jane},
+		{name: "WrongUserID", email: "other@example.com", wantErr: true},
+		{name: "NotFound", email: "nobody@example.com", wantErr: true},
+		{name: "InvalidEmail", email: "nobody", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el, err := FetchWKD(t.Context(), tt.email, OptWKDHTTPClient(c))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want == nil {
+				return
+			}
+			if len(el) != 1 {
+				t.Fatalf("got %d keys, want 1", len(el))
+			}
+			if !bytes.Equal(el[0].PrimaryKey.Fingerprint, tt.want.PrimaryKey.Fingerprint) {
+				t.Errorf("got key %X, want %X", el[0].PrimaryKey.Fingerprint, tt.want.PrimaryKey.Fingerprint)
+			}
+		})
+	}
+}
+
+func TestWKDKeyRing(t *testing.T) {
+	joe := newWKDTestEntity(t, "joe.doe@example.com")
+	local := newWKDTestEntity(t, "local@example.com")
+	missing := newWKDTestEntity(t, "missing@example.com")
+
+	requests := 0
+	_, c := newWKDTestServer(t, map[string][]byte{
+		"openpgpkey.example.com/.well-known/openpgpkey/example.com/hu/" + wkdHash("joe.doe"): serializeTestEntities(t, joe),
+	})
+	c.Transport = &countingTransport{RoundTripper: c.Transport, count: &requests}
+
+	kr := NewWKDKeyRing(t.Context(), openpgp.EntityList{local}, []string{"joe.doe@example.com"}, OptWKDHTTPClient(c))
+
+	if keys := kr.KeysById(local.PrimaryKey.KeyId); len(keys) != 1 {
+		t.Errorf("got %d local keys, want 1", len(keys))
+	}
+	if requests != 0 {
+		t.Errorf("web key directory queried for local key")
+	}
+	if keys := kr.KeysById(joe.PrimaryKey.KeyId); len(keys) != 1 {
+		t.Errorf("got %d web key directory keys, want 1", len(keys))
+	}
+	if keys := kr.KeysById(missing.PrimaryKey.KeyId); len(keys) != 0 {
+		t.Errorf("got %d keys for missing key, want none", len(keys))
+	}
+	if requests != 1 {
+		t.Errorf("got %d web key directory requests, want 1", requests)
+	}
+}
+
+// countingTransport counts the requests made through a RoundTripper.
+type countingTransport struct {
+	http.RoundTripper
+	count *int
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	*t.count++
+	return t.RoundTripper.RoundTrip(r)
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/apptainer/apptainer/internal/pkg/buildcfg"
 	"github.com/apptainer/apptainer/internal/pkg/security/apparmor"
+	"github.com/apptainer/apptainer/internal/pkg/security/landlock"
 	"github.com/apptainer/apptainer/internal/pkg/security/seccomp"
 	"github.com/apptainer/apptainer/internal/pkg/security/selinux"
 	"github.com/apptainer/apptainer/internal/pkg/util/rpm"
@@ -298,6 +299,14 @@ func Seccomp(t *testing.T) {
 	}
 }
 
+// Landlock checks that the kernel supports Landlock. If not, the test is
+// skipped with a message.
+func Landlock(t *testing.T) {
+	if landlock.ABI() == 0 {
+		t.Skipf("landlock is not supported by the kernel")
+	}
+}
+
 // Apparmor checks that apparmor is enabled. If not, the test is skipped with a
 // message.
 func Apparmor(t *testing.T) {
@@ -0,0 +1,159 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package tsa provides an RFC 3161 Time Stamping Authority for tests.
+package tsa
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitorus/timestamp"
+)
+
+// Server is a TSA issuing timestamps signed by a time stamping certificate
+// of a dedicated root.
+type Server struct {
+	// URL is the URL of the TSA.
+	URL string
+	// Roots holds the root certificate of the TSA.
+	Roots *x509.CertPool
+	// RootPEM is the PEM encoded root certificate of the TSA.
+	RootPEM []byte
+
+	cert *x509.Certificate
+	key  crypto.Signer
+
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewServer starts a TSA, closed at the end of the test, issuing timestamps
+// of the current time.
+func NewServer(t *testing.T) *Server {
+	t.Helper()
+
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	rootKey, root := createCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "tsa root"},
+		NotBefore:             start,
+		NotAfter:              start.AddDate(100, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, nil)
+	key, cert := createCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "tsa"},
+		NotBefore:    start,
+		NotAfter:     start.AddDate(100, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}, root, rootKey)
+
+	s := &Server{
+		Roots:   x509.NewCertPool(),
+		RootPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}),
+		cert:    cert,
+		key:     key,
+	}
+	s.Roots.AddCert(root)
+
+	srv := httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(srv.Close)
+	s.URL = srv.URL
+
+	return s
+}
+
+// SetTime sets the time of the timestamps issued by s, or the current time
+// if tm is zero.
+func (s *Server) SetTime(tm time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.t = tm
+}
+
+func (s *Server) now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.t.IsZero() {
+		return time.Now()
+	}
+	return s.t
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req, err := timestamp.ParseRequest(b)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ts := timestamp.Timestamp{
+		HashAlgorithm:     req.HashAlgorithm,
+		HashedMessage:     req.HashedMessage,
+		Time:              s.now(),
+		Nonce:             req.Nonce,
+		Policy:            asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 2, 3},
+		AddTSACertificate: req.Certificates,
+	}
+	resp, err := ts.CreateResponseWithOpts(s.cert, s.key, crypto.SHA256)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Write(resp) //nolint:errcheck
+}
+
+// createCertificate creates a certificate from tmpl with a new ECDSA key,
+// signed by parentKey, or self-signed if parent is nil.
+func createCertificate(t *testing.T, tmpl, parent *x509.Certificate, parentKey crypto.Signer) (crypto.Signer, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, c
+}
@@ -0,0 +1,142 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package tsa requests RFC 3161 timestamp tokens from a Time Stamping
+// Authority, and verifies them.
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
+	"github.com/digitorus/pkcs7"
+	"github.com/digitorus/timestamp"
+)
+
+const (
+	requestMediaType  = "application/timestamp-query"
+	responseMediaType = "application/timestamp-reply"
+
+	// maxResponseSize bounds the size of the responses read from a TSA.
+	maxResponseSize = 1 << 20
+)
+
+// ErrMessageMismatch is returned when a timestamp is not for the timestamped data.
+var ErrMessageMismatch = errors.New("timestamp is not for the signed data")
+
+// Request returns the DER encoded timestamp token of the SHA256 digest of
+// data, issued by the TSA at url. The token includes the TSA certificate.
+func Request(ctx context.Context, url string, data []byte) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	req, err := timestamp.CreateRequest(bytes.NewReader(data), &timestamp.RequestOptions{
+		Hash:         crypto.SHA256,
+		Certificates: true,
+		Nonce:        nonce,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while creating timestamp request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", requestMediaType)
+	httpReq.Header.Set("Accept", responseMediaType)
+	httpReq.Header.Set("User-Agent", useragent.Value())
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("while requesting timestamp from %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("timestamp request to %s failed: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("while reading timestamp response: %w", err)
+	}
+
+	ts, err := timestamp.ParseResponse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp response from %s: %w", url, err)
+	}
+	if ts.Nonce == nil || ts.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("invalid timestamp response from %s: nonce mismatch", url)
+	}
+	if err := checkMessage(ts, data); err != nil {
+		return nil, err
+	}
+	if len(ts.Certificates) == 0 {
+		return nil, fmt.Errorf("timestamp response from %s doesn't include the TSA certificate", url)
+	}
+	return ts.RawToken, nil
+}
+
+// Verify checks that token is a timestamp of data, issued by a TSA with a
+// time stamping certificate chaining to roots at the timestamped time, and
+// returns this time.
+func Verify(token, data []byte, roots *x509.CertPool) (time.Time, error) {
+	ts, err := timestamp.Parse(token)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	if err := checkMessage(ts, data); err != nil {
+		return time.Time{}, err
+	}
+
+	p7, err := pkcs7.Parse(token)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	if len(p7.Certificates) == 0 {
+		return time.Time{}, fmt.Errorf("timestamp doesn't include the TSA certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range p7.Certificates {
+		intermediates.AddCert(c)
+	}
+	err = p7.VerifyWithOpts(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   ts.Time,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("while verifying timestamp: %w", err)
+	}
+	return ts.Time, nil
+}
+
+// checkMessage checks that the message imprint of ts is the digest of data.
+func checkMessage(ts *timestamp.Timestamp, data []byte) error {
+	if !ts.HashAlgorithm.Available() {
+		return fmt.Errorf("unsupported timestamp hash function %v", ts.HashAlgorithm)
+	}
+	h := ts.HashAlgorithm.New()
+	h.Write(data)
+	if !bytes.Equal(h.Sum(nil), ts.HashedMessage) {
+		return ErrMessageMismatch
+	}
+	return nil
+}
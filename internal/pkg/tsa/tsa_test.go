@@ -0,0 +1,84 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package tsa
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	testtsa "github.com/apptainer/apptainer/internal/pkg/test/tool/tsa"
+	useragent "github.com/apptainer/apptainer/pkg/util/user-agent"
+)
+
+func TestMain(m *testing.M) {
+	useragent.InitValue("apptainer", "v0.1.0-30-g67692d50f-dirty")
+
+	os.Exit(m.Run())
+}
+
+func TestRequestVerify(t *testing.T) {
+	srv := testtsa.NewServer(t)
+	tm := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	srv.SetTime(tm)
+
+	data := []byte("signature")
+	token, err := Request(context.Background(), srv.URL, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := Verify(token, data, srv.Roots)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !got.Equal(tm) {
+		t.Errorf("got time %v, want %v", got, tm)
+	}
+
+	if _, err := Verify(token, []byte("other"), srv.Roots); !errors.Is(err, ErrMessageMismatch) {
+		t.Errorf("got error %v, want %v", err, ErrMessageMismatch)
+	}
+
+	other := testtsa.NewServer(t)
+	if _, err := Verify(token, data, other.Roots); err == nil {
+		t.Errorf("unexpected success with other TSA roots")
+	}
+
+	if _, err := Verify(token, data, x509.NewCertPool()); err == nil {
+		t.Errorf("unexpected success with empty TSA roots")
+	}
+
+	if _, err := Verify([]byte("token"), data, srv.Roots); err == nil {
+		t.Errorf("unexpected success with invalid token")
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	invalid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("not a timestamp")) //nolint:errcheck
+	}))
+	defer invalid.Close()
+
+	for _, url := range []string{failing.URL, invalid.URL} {
+		if _, err := Request(context.Background(), url, []byte("signature")); err == nil {
+			t.Errorf("unexpected success with %s", url)
+		}
+	}
+}
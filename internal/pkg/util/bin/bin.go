@@ -67,6 +67,7 @@ func FindBin(name string) (path string, err error) {
 		"proot",
 		"rpm",
 		"rpmkeys",
+		"slirp4netns",
 		"squashfuse",
 		"squashfuse_ll",
 		"SUSEConnect",
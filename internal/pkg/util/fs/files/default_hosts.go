@@ -9,6 +9,20 @@
 
 package files
 
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// HostGateway is the special address value resolved to the
+// container network gateway when used in a host entry.
+const HostGateway = "host-gateway"
+
+// hostNameRegex validates the hostnames of host entries.
+var hostNameRegex = regexp.MustCompile(hostRegex)
+
 var defaultContent = `127.0.0.1   localhost
 ::1         localhost ip6-localhost ip6-loopback
 ff02::1     ip6-allnodes
@@ -19,3 +33,36 @@ ff02::2     ip6-allrouters
 func DefaultHosts() []byte {
 	return []byte(defaultContent)
 }
+
+// ParseHostEntry parses a host entry in the form name:ip and returns
+// the hostname and IP address, an IPv6 address may be enclosed in
+// square brackets. The IP address may also be HostGateway.
+func ParseHostEntry(entry string) (name string, ip string, err error) {
+	name, ip, found := strings.Cut(entry, ":")
+	if !found {
+		return "", "", fmt.Errorf("%q is not in name:ip format", entry)
+	}
+	if !hostNameRegex.MatchString(name) {
+		return "", "", fmt.Errorf("%s is not a valid hostname", name)
+	}
+	ip = strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]")
+	if ip != HostGateway && net.ParseIP(ip) == nil {
+		return "", "", fmt.Errorf("%s is not a valid IP address", ip)
+	}
+	return name, ip, nil
+}
+
+// AppendHost appends a line mapping the IP address to hostname to the
+// hosts file content and returns it.
+func AppendHost(content []byte, name string, ip string) ([]byte, error) {
+	if !hostNameRegex.MatchString(name) {
+		return content, fmt.Errorf("%s is not a valid hostname", name)
+	}
+	if net.ParseIP(ip) == nil {
+		return content, fmt.Errorf("%s is not a valid IP address", ip)
+	}
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		content = append(content, '\n')
+	}
+	return append(content, fmt.Sprintf("%s\t%s\n", ip, name)...), nil
+}
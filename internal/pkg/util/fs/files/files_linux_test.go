@@ -87,3 +87,47 @@ func TestResolvConf(t *testing.T) {
 		t.Errorf("ResolvConf returns a bad content")
 	}
 }
+
+func TestParseHostEntry(t *testing.T) {
+	tests := []struct {
+		entry   string
+		name    string
+		ip      string
+		wantErr bool
+	}{
+		{entry: "myhost:10.0.0.1", name: "myhost", ip: "10.0.0.1"},
+		{entry: "my.host:fd00::1", name: "my.host", ip: "fd00::1"},
+		{entry: "myhost:[fd00::1]", name: "myhost", ip: "fd00::1"},
+		{entry: "myhost:host-gateway", name: "myhost", ip: HostGateway},
+		{entry: "myhost", wantErr: true},
+		{entry: "bad|host:10.0.0.1", wantErr: true},
+		{entry: "myhost:10.0.0", wantErr: true},
+		{entry: ":10.0.0.1", wantErr: true},
+	}
+	for _, tt := range tests {
+		name, ip, err := ParseHostEntry(tt.entry)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseHostEntry(%q) error = %v, wantErr %v", tt.entry, err, tt.wantErr)
+			continue
+		}
+		if name != tt.name || ip != tt.ip {
+			t.Errorf("ParseHostEntry(%q) = %q, %q, want %q, %q", tt.entry, name, ip, tt.name, tt.ip)
+		}
+	}
+}
+
+func TestAppendHost(t *testing.T) {
+	content, err := AppendHost([]byte("127.0.0.1 localhost"), "myhost", "10.0.0.1")
+	if err != nil {
+		t.Errorf("should have passed with valid entry: %s", err)
+	}
+	if !bytes.Equal(content, []byte("127.0.0.1 localhost\n10.0.0.1\tmyhost\n")) {
+		t.Errorf("AppendHost returns a bad content: %q", content)
+	}
+	if _, err := AppendHost(nil, "myhost", HostGateway); err == nil {
+		t.Errorf("should have failed with unresolved gateway")
+	}
+	if _, err := AppendHost(nil, "bad|host", "10.0.0.1"); err == nil {
+		t.Errorf("should have failed with non valid hostname")
+	}
+}
@@ -132,9 +132,23 @@ func LoginAndStore(registry, username, password string, insecure bool, reqAuthFi
 		return err
 	}
 
+	filename, err := StoreCredentials(registry, username, password, reqAuthFile)
+	if err != nil {
+		return err
+	}
+
+	sylog.Infof("Token stored in %s", filename)
+
+	return nil
+}
+
+// StoreCredentials stores the credentials of registry in the auth file
+// reqAuthFile, or else in the default OCI registry auth file, without checking
+// them. The path of the auth file is returned.
+func StoreCredentials(registry, username, password string, reqAuthFile string) (string, error) {
 	cf, err := ConfigFileFromPath(ChooseAuthFile(reqAuthFile))
 	if err != nil {
-		return fmt.Errorf("while loading existing OCI registry credentials from %q: %w", ChooseAuthFile(reqAuthFile), err)
+		return "", fmt.Errorf("while loading existing OCI registry credentials from %q: %w", ChooseAuthFile(reqAuthFile), err)
 	}
 
 	creds := cf.GetCredentialsStore(registry)
@@ -151,12 +165,10 @@ func LoginAndStore(registry, username, password string, insecure bool, reqAuthFi
 		Password:      password,
 		ServerAddress: serverAddress,
 	}); err != nil {
-		return fmt.Errorf("while trying to store new credentials: %w", err)
+		return "", fmt.Errorf("while trying to store new credentials: %w", err)
 	}
 
-	sylog.Infof("Token stored in %s", cf.Filename)
-
-	return nil
+	return cf.Filename, nil
 }
 
 func checkOCILogin(regName string, username, password string, insecure bool) error {
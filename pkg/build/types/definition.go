@@ -45,6 +45,8 @@ type ImageData struct {
 	Metadata     []byte            `json:"metadata"`
 	Labels       map[string]string `json:"labels"`
 	ImageScripts `json:"imageScripts"`
+	// Security declares the security profile of the image.
+	Security Script `json:"security"`
 }
 
 // ImageScripts contains scripts that are used after build time.
@@ -215,6 +217,7 @@ func populateRaw(d *Definition, w io.Writer) {
 	writeSectionIfExists(w, "runscript", d.Runscript)
 	writeSectionIfExists(w, "test", d.Test)
 	writeSectionIfExists(w, "startscript", d.Startscript)
+	writeSectionIfExists(w, "security", d.Security)
 	writeSectionIfExists(w, "pre", d.BuildData.Pre)
 	writeSectionIfExists(w, "setup", d.BuildData.Setup)
 	writeSectionIfExists(w, "post", d.BuildData.Post)
@@ -312,7 +312,8 @@ func populateDefinition(sections map[string]*types.Script, files *[]types.Files,
 			Test:        *sections["test"],
 			Startscript: *sections["startscript"],
 		},
-		Labels: GetLabels(sections["labels"].Script),
+		Labels:   GetLabels(sections["labels"].Script),
+		Security: *sections["security"],
 	}
 	d.BuildData.Files = *files
 	d.BuildData.Scripts = types.Scripts{
@@ -561,6 +562,7 @@ var validSections = map[string]bool{
 	"test":        true,
 	"startscript": true,
 	"arguments":   true,
+	"security":    true,
 }
 
 var appSections = map[string]bool{
@@ -26,6 +26,8 @@ const (
 	SIFDescOCIConfigJSON = "oci-config.json"
 	// SIFDescInspectMetadataJSON is the name of the SIF descriptor holding the container metadata.
 	SIFDescInspectMetadataJSON = "inspect-metadata.json"
+	// SIFDescSecurityProfileJSON is the name of the SIF descriptor holding the security profile.
+	SIFDescSecurityProfileJSON = "security-profile.json"
 )
 
 type sifFormat struct{}
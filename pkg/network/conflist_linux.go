@@ -0,0 +1,300 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/containernetworking/cni/libcni"
+)
+
+const (
+	// BridgeType is the network type connecting containers to a host bridge.
+	BridgeType = "bridge"
+	// MacvlanType is the network type connecting containers to a parent
+	// interface with their own MAC address.
+	MacvlanType = "macvlan"
+	// IpvlanType is the network type connecting containers to a parent
+	// interface sharing its MAC address.
+	IpvlanType = "ipvlan"
+)
+
+// confListVersion is the CNI specification version of generated
+// network configurations.
+const confListVersion = "1.0.0"
+
+// maxIfNameLen is the maximum length of a network interface name.
+const maxIfNameLen = 15
+
+var networkNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.\-]*$`)
+
+// reservedNetworks are network names with a special meaning for --network.
+var reservedNetworks = []string{"none", SlirpNetwork}
+
+// ConfListOptions describes a network configuration generated by NewConfList.
+type ConfListOptions struct {
+	// Name is the network name.
+	Name string
+	// Type is one of BridgeType, MacvlanType or IpvlanType.
+	Type string
+	// Subnet is the network subnet in CIDR notation.
+	Subnet string
+	// Gateway is the gateway address, the first address of the subnet
+	// is used by default.
+	Gateway string
+	// IPRange restricts the allocated addresses, in the form start-end.
+	IPRange string
+	// IPAM is the IPAM plugin type, host-local by default or dhcp.
+	IPAM string
+	// Bridge is the name of the host bridge for BridgeType networks.
+	Bridge string
+	// Parent is the host interface used by MacvlanType and IpvlanType networks.
+	Parent string
+	// Mode is the MacvlanType or IpvlanType mode.
+	Mode string
+}
+
+type confRoute struct {
+	Dst string `json:"dst"`
+}
+
+type confRange struct {
+	Subnet     string `json:"subnet"`
+	RangeStart string `json:"rangeStart,omitempty"`
+	RangeEnd   string `json:"rangeEnd,omitempty"`
+	Gateway    string `json:"gateway,omitempty"`
+}
+
+type confIPAM struct {
+	Type   string        `json:"type"`
+	Ranges [][]confRange `json:"ranges,omitempty"`
+	Routes []confRoute   `json:"routes,omitempty"`
+}
+
+type confPlugin struct {
+	Type         string          `json:"type"`
+	Bridge       string          `json:"bridge,omitempty"`
+	Master       string          `json:"master,omitempty"`
+	Mode         string          `json:"mode,omitempty"`
+	IsGateway    bool            `json:"isGateway,omitempty"`
+	IPMasq       bool            `json:"ipMasq,omitempty"`
+	IPAM         *confIPAM       `json:"ipam,omitempty"`
+	Capabilities map[string]bool `json:"capabilities,omitempty"`
+	SNAT         bool            `json:"snat,omitempty"`
+}
+
+type confList struct {
+	CNIVersion string       `json:"cniVersion"`
+	Name       string       `json:"name"`
+	Plugins    []confPlugin `json:"plugins"`
+}
+
+// CheckNetworkName returns an error if name can't be used for a new network.
+func CheckNetworkName(name string) error {
+	if !networkNameRegex.MatchString(name) {
+		return fmt.Errorf("%q is not a valid network name", name)
+	}
+	for _, r := range reservedNetworks {
+		if name == r {
+			return fmt.Errorf("network name %q is reserved", name)
+		}
+	}
+	return nil
+}
+
+// NewConfList returns a CNI network configuration list in JSON format
+// generated from the provided options.
+func NewConfList(opts ConfListOptions) ([]byte, error) {
+	if err := CheckNetworkName(opts.Name); err != nil {
+		return nil, err
+	}
+
+	ipam, err := newIPAM(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cl := confList{
+		CNIVersion: confListVersion,
+		Name:       opts.Name,
+	}
+
+	switch opts.Type {
+	case BridgeType, "":
+		if opts.Parent != "" || opts.Mode != "" {
+			return nil, fmt.Errorf("parent interface and mode are not supported by %s networks", BridgeType)
+		}
+		bridge := opts.Bridge
+		if bridge == "" {
+			bridge = "apptbr-" + opts.Name
+		}
+		if len(bridge) > maxIfNameLen {
+			return nil, fmt.Errorf("bridge name %q is longer than %d characters, please provide a bridge name", bridge, maxIfNameLen)
+		}
+		cl.Plugins = []confPlugin{
+			{
+				Type:      BridgeType,
+				Bridge:    bridge,
+				IsGateway: true,
+				IPMasq:    true,
+				IPAM:      ipam,
+			},
+			{
+				Type: "firewall",
+			},
+			{
+				Type:         "portmap",
+				Capabilities: map[string]bool{"portMappings": true},
+				SNAT:         true,
+			},
+		}
+	case MacvlanType, IpvlanType:
+		if opts.Bridge != "" {
+			return nil, fmt.Errorf("bridge name is not supported by %s networks", opts.Type)
+		}
+		if opts.Parent == "" {
+			return nil, fmt.Errorf("%s networks require a parent interface", opts.Type)
+		}
+		if err := checkMode(opts.Type, opts.Mode); err != nil {
+			return nil, err
+		}
+		cl.Plugins = []confPlugin{
+			{
+				Type:   opts.Type,
+				Master: opts.Parent,
+				Mode:   opts.Mode,
+				IPAM:   ipam,
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unsupported network type %q, must be one of %s, %s or %s", opts.Type, BridgeType, MacvlanType, IpvlanType)
+	}
+
+	b, err := json.MarshalIndent(cl, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// checkMode checks the mode of a macvlan or ipvlan network.
+func checkMode(netType, mode string) error {
+	if mode == "" {
+		return nil
+	}
+	modes := map[string][]string{
+		MacvlanType: {"bridge", "private", "vepa", "passthru"},
+		IpvlanType:  {"l2", "l3", "l3s"},
+	}
+	for _, m := range modes[netType] {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported %s mode %q, must be one of %s", netType, mode, strings.Join(modes[netType], ", "))
+}
+
+// newIPAM returns the IPAM configuration corresponding to options.
+func newIPAM(opts ConfListOptions) (*confIPAM, error) {
+	switch opts.IPAM {
+	case "dhcp":
+		if opts.Subnet != "" || opts.Gateway != "" || opts.IPRange != "" {
+			return nil, fmt.Errorf("subnet, gateway and IP range can't be set with dhcp IPAM")
+		}
+		return &confIPAM{Type: "dhcp"}, nil
+	case "host-local", "":
+	default:
+		return nil, fmt.Errorf("unsupported IPAM type %q, must be host-local or dhcp", opts.IPAM)
+	}
+
+	if opts.Subnet == "" {
+		return nil, fmt.Errorf("a subnet is required with host-local IPAM")
+	}
+	_, subnet, err := net.ParseCIDR(opts.Subnet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet %q: %s", opts.Subnet, err)
+	}
+
+	r := confRange{Subnet: subnet.String()}
+	if opts.Gateway != "" {
+		gw := net.ParseIP(opts.Gateway)
+		if gw == nil || !subnet.Contains(gw) {
+			return nil, fmt.Errorf("gateway %q is not an address of subnet %s", opts.Gateway, subnet)
+		}
+		r.Gateway = gw.String()
+	}
+	if opts.IPRange != "" {
+		start, end, ok := strings.Cut(opts.IPRange, "-")
+		startIP := net.ParseIP(strings.TrimSpace(start))
+		endIP := net.ParseIP(strings.TrimSpace(end))
+		if !ok || startIP == nil || endIP == nil {
+			return nil, fmt.Errorf("invalid IP range %q, must be of form start-end", opts.IPRange)
+		}
+		if !subnet.Contains(startIP) || !subnet.Contains(endIP) {
+			return nil, fmt.Errorf("IP range %q is not within subnet %s", opts.IPRange, subnet)
+		}
+		if bytes.Compare(startIP.To16(), endIP.To16()) > 0 {
+			return nil, fmt.Errorf("IP range %q start is after its end", opts.IPRange)
+		}
+		r.RangeStart = startIP.String()
+		r.RangeEnd = endIP.String()
+	}
+
+	route := confRoute{Dst: "0.0.0.0/0"}
+	if subnet.IP.To4() == nil {
+		route.Dst = "::/0"
+	}
+
+	return &confIPAM{
+		Type:   "host-local",
+		Ranges: [][]confRange{{r}},
+		Routes: []confRoute{route},
+	}, nil
+}
+
+// PluginTypes returns the plugin types used by a network configuration,
+// including IPAM plugins.
+func PluginTypes(conf *libcni.NetworkConfigList) []string {
+	types := make([]string, 0, len(conf.Plugins))
+	seen := make(map[string]bool)
+	add := func(t string) {
+		if t != "" && !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	for _, p := range conf.Plugins {
+		if p.Network == nil {
+			continue
+		}
+		add(p.Network.Type)
+		add(p.Network.IPAM.Type)
+	}
+	return types
+}
+
+// MissingPlugins returns the plugin types used by a network configuration
+// which are not found as executables in the CNI plugin directory.
+func MissingPlugins(conf *libcni.NetworkConfigList, pluginPath string) []string {
+	var missing []string
+	for _, t := range PluginTypes(conf) {
+		fi, err := os.Stat(filepath.Join(pluginPath, t))
+		if err != nil || !fi.Mode().IsRegular() || fi.Mode().Perm()&0o111 == 0 {
+			missing = append(missing, t)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,108 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/containernetworking/cni/libcni"
+)
+
+func TestNewConfList(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ConfListOptions
+		plugins []string
+		wantErr bool
+	}{
+		{
+			name:    "Bridge",
+			opts:    ConfListOptions{Name: "mynet", Subnet: "10.30.0.0/16", Gateway: "10.30.0.1", IPRange: "10.30.1.0-10.30.1.255"},
+			plugins: []string{"bridge", "host-local", "firewall", "portmap"},
+		},
+		{
+			name:    "BridgeIPv6",
+			opts:    ConfListOptions{Name: "mynet6", Type: BridgeType, Subnet: "fd00:30::/64"},
+			plugins: []string{"bridge", "host-local", "firewall", "portmap"},
+		},
+		{
+			name:    "Macvlan",
+			opts:    ConfListOptions{Name: "mac", Type: MacvlanType, Parent: "eth0", Mode: "bridge", IPAM: "dhcp"},
+			plugins: []string{"macvlan", "dhcp"},
+		},
+		{
+			name:    "Ipvlan",
+			opts:    ConfListOptions{Name: "ipv", Type: IpvlanType, Parent: "eth0", Mode: "l3", Subnet: "192.168.1.0/24"},
+			plugins: []string{"ipvlan", "host-local"},
+		},
+		{name: "ReservedName", opts: ConfListOptions{Name: "none", Subnet: "10.30.0.0/16"}, wantErr: true},
+		{name: "InvalidName", opts: ConfListOptions{Name: "my/net", Subnet: "10.30.0.0/16"}, wantErr: true},
+		{name: "NoSubnet", opts: ConfListOptions{Name: "mynet"}, wantErr: true},
+		{name: "BadSubnet", opts: ConfListOptions{Name: "mynet", Subnet: "10.30.0.0"}, wantErr: true},
+		{name: "GatewayOutside", opts: ConfListOptions{Name: "mynet", Subnet: "10.30.0.0/16", Gateway: "10.31.0.1"}, wantErr: true},
+		{name: "RangeOutside", opts: ConfListOptions{Name: "mynet", Subnet: "10.30.0.0/16", IPRange: "10.30.0.10-10.31.0.1"}, wantErr: true},
+		{name: "RangeReversed", opts: ConfListOptions{Name: "mynet", Subnet: "10.30.0.0/16", IPRange: "10.30.0.10-10.30.0.1"}, wantErr: true},
+		{name: "DHCPWithSubnet", opts: ConfListOptions{Name: "mynet", Type: MacvlanType, Parent: "eth0", IPAM: "dhcp", Subnet: "10.30.0.0/16"}, wantErr: true},
+		{name: "LongBridgeName", opts: ConfListOptions{Name: "verylongname", Subnet: "10.30.0.0/16"}, wantErr: true},
+		{name: "MacvlanNoParent", opts: ConfListOptions{Name: "mac", Type: MacvlanType, Subnet: "10.30.0.0/16"}, wantErr: true},
+		{name: "MacvlanBadMode", opts: ConfListOptions{Name: "mac", Type: MacvlanType, Parent: "eth0", Mode: "l3", Subnet: "10.30.0.0/16"}, wantErr: true},
+		{name: "UnknownType", opts: ConfListOptions{Name: "mynet", Type: "ptp", Subnet: "10.30.0.0/16"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewConfList(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error state: %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			conf, err := libcni.ConfListFromBytes(b)
+			if err != nil {
+				t.Fatalf("generated configuration can't be loaded: %s", err)
+			}
+			if conf.Name != tt.opts.Name {
+				t.Errorf("got network name %q, want %q", conf.Name, tt.opts.Name)
+			}
+			if got := PluginTypes(conf); !reflect.DeepEqual(got, tt.plugins) {
+				t.Errorf("got plugins %v, want %v", got, tt.plugins)
+			}
+		})
+	}
+}
+
+func TestMissingPlugins(t *testing.T) {
+	b, err := NewConfList(ConfListOptions{Name: "mynet", Subnet: "10.30.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := libcni.ConfListFromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for _, p := range []string{"bridge", "host-local", "firewall"} {
+		if err := os.WriteFile(filepath.Join(dir, p), nil, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// not executable
+	if err := os.WriteFile(filepath.Join(dir, "portmap"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := MissingPlugins(conf, dir); !reflect.DeepEqual(got, []string{"portmap"}) {
+		t.Errorf("got missing plugins %v, want [portmap]", got)
+	}
+}
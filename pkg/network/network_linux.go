@@ -66,6 +66,47 @@ type PortMapEntry struct {
 	HostIP        string `json:"hostIP,omitempty"`
 }
 
+// ParsePortMapping parses a port mapping of the form
+// hostPort[:containerPort]/protocol, the container port is the
+// same as the host port when omitted.
+func ParsePortMapping(value string) (PortMapEntry, error) {
+	pm := PortMapEntry{}
+
+	splittedPort := strings.SplitN(value, "/", 2)
+	if len(splittedPort) != 2 {
+		return pm, fmt.Errorf("badly formatted port mapping '%s', must be of form hostPort[:containerPort]/protocol", value)
+	}
+	pm.Protocol = splittedPort[1]
+	if pm.Protocol != "tcp" && pm.Protocol != "udp" {
+		return pm, fmt.Errorf("only tcp and udp protocol can be specified")
+	}
+	ports := strings.Split(splittedPort[0], ":")
+	if len(ports) != 1 && len(ports) != 2 {
+		return pm, fmt.Errorf("badly formatted ports '%s', must be of form hostPort[:containerPort]", splittedPort[0])
+	}
+	if n, err := strconv.ParseUint(ports[0], 0, 16); err == nil {
+		pm.HostPort = int(n)
+		if pm.HostPort <= 0 || pm.HostPort > 65535 {
+			return pm, fmt.Errorf("host port must be greater than 0 and less than 65535")
+		}
+	} else {
+		return pm, fmt.Errorf("can't convert host port '%s': %s", ports[0], err)
+	}
+	if len(ports) == 2 {
+		if n, err := strconv.ParseUint(ports[1], 0, 16); err == nil {
+			pm.ContainerPort = int(n)
+			if pm.ContainerPort <= 0 || pm.ContainerPort > 65535 {
+				return pm, fmt.Errorf("container port must be greater than 0 and less than 65535")
+			}
+		} else {
+			return pm, fmt.Errorf("can't convert container port '%s': %s", ports[1], err)
+		}
+	} else {
+		pm.ContainerPort = pm.HostPort
+	}
+	return pm, nil
+}
+
 // GetAllNetworkConfigList lists configured networks in configuration path directory
 // provided by cniPath
 func GetAllNetworkConfigList(cniPath *CNIPath) ([]*libcni.NetworkConfigList, error) {
@@ -284,41 +325,11 @@ func (m *Setup) SetArgs(args []string) error {
 			value := kv[1]
 			switch key {
 			case "portmap":
-				pm := &PortMapEntry{}
-
-				splittedPort := strings.SplitN(value, "/", 2)
-				if len(splittedPort) != 2 {
-					return fmt.Errorf("badly formatted portmap argument '%s', must be of form portmap=hostPort:containerPort/protocol", value)
-				}
-				pm.Protocol = splittedPort[1]
-				if pm.Protocol != "tcp" && pm.Protocol != "udp" {
-					return fmt.Errorf("only tcp and udp protocol can be specified")
-				}
-				ports := strings.Split(splittedPort[0], ":")
-				if len(ports) != 1 && len(ports) != 2 {
-					return fmt.Errorf("portmap port argument is badly formatted")
-				}
-				if n, err := strconv.ParseUint(ports[0], 0, 16); err == nil {
-					pm.HostPort = int(n)
-					if pm.HostPort <= 0 || pm.HostPort > 65535 {
-						return fmt.Errorf("host port must be greater than 0 and less than 65535")
-					}
-				} else {
-					return fmt.Errorf("can't convert host port '%s': %s", ports[0], err)
-				}
-				if len(ports) == 2 {
-					if n, err := strconv.ParseUint(ports[1], 0, 16); err == nil {
-						pm.ContainerPort = int(n)
-						if pm.ContainerPort <= 0 || pm.ContainerPort > 65535 {
-							return fmt.Errorf("container port must be greater than 0 and less than 65535")
-						}
-					} else {
-						return fmt.Errorf("can't convert container port '%s': %s", ports[1], err)
-					}
-				} else {
-					pm.ContainerPort = pm.HostPort
+				pm, err := ParsePortMapping(value)
+				if err != nil {
+					return fmt.Errorf("invalid portmap=%s argument: %s", value, err)
 				}
-				if err := m.SetCapability(networkName, "portMappings", *pm); err != nil {
+				if err := m.SetCapability(networkName, "portMappings", pm); err != nil {
 					return err
 				}
 			case "ipRange":
@@ -370,6 +381,37 @@ func (m *Setup) GetNetworkIP(network string, version string) (net.IP, error) {
 	return nil, fmt.Errorf("no IP found for network %s", network)
 }
 
+// GetNetworkGateway returns the gateway address of the container network,
+// if network is empty, the function returns the gateway for the first
+// configured network
+func (m *Setup) GetNetworkGateway(network string, version string) (net.IP, error) {
+	n := network
+	if n == "" && len(m.networkConfList) > 0 {
+		n = m.networkConfList[0].Name
+	}
+
+	for i := 0; i < len(m.networkConfList); i++ {
+		if m.networkConfList[i].Name == n {
+			res, err := cnitypes.NewResultFromResult(m.result[i])
+			if err != nil {
+				return nil, fmt.Errorf("could not convert result: %v", err)
+			}
+			for _, ipResult := range res.IPs {
+				if ipResult.Gateway == nil {
+					continue
+				}
+				is4 := ipResult.Gateway.To4() != nil
+				if (is4 && version == "4") || (!is4 && version == "6") {
+					return ipResult.Gateway, nil
+				}
+			}
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("no gateway found for network %s", network)
+}
+
 // GetNetworkInterface returns container network interface associated
 // with a network, if network is empty, the function returns interface
 // for the first configured network
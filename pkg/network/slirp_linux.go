@@ -0,0 +1,203 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// SlirpNetwork is the network name selecting the unprivileged
+	// user mode network provided by slirp4netns.
+	SlirpNetwork = "slirp4netns"
+	// SlirpContainerIP is the address of the container tap interface.
+	SlirpContainerIP = "10.0.2.100"
+	// SlirpDNS is the address forwarding DNS requests to the host resolver.
+	SlirpDNS = "10.0.2.3"
+)
+
+// slirpReadyTimeout is the time to wait for slirp4netns to configure
+// the container network interface.
+const slirpReadyTimeout = 10 * time.Second
+
+// SlirpConfig describes how to start slirp4netns for a container.
+type SlirpConfig struct {
+	// Binary is the path to the slirp4netns executable.
+	Binary string
+	// Pid is the process ID of a process in the container network namespace.
+	Pid int
+	// UserNS must be set if the network namespace is owned by the
+	// user namespace of the process.
+	UserNS bool
+	// APISocket is the path of the slirp4netns API socket used to
+	// add port mappings.
+	APISocket string
+	// Credential, if not nil, sets the credentials of the slirp4netns process.
+	Credential *syscall.Credential
+}
+
+// Slirp manages a slirp4netns process connecting a container network
+// namespace to the host network through a user mode TCP/IP stack.
+type Slirp struct {
+	cmd       *exec.Cmd
+	apiSocket string
+	exitFd    *os.File
+	stderr    bytes.Buffer
+}
+
+// StartSlirp starts slirp4netns and returns once the container network
+// interface is configured. The slirp4netns process exits when Stop is
+// called or when the calling process exits.
+func StartSlirp(cfg SlirpConfig) (*Slirp, error) {
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("while creating ready pipe: %s", err)
+	}
+	defer readyR.Close()
+
+	exitR, exitW, err := os.Pipe()
+	if err != nil {
+		readyW.Close()
+		return nil, fmt.Errorf("while creating exit pipe: %s", err)
+	}
+	defer exitR.Close()
+
+	args := []string{
+		"--configure",
+		"--mtu=65520",
+		"--disable-host-loopback",
+		"--ready-fd=3",
+		"--exit-fd=4",
+		"--api-socket", cfg.APISocket,
+	}
+	if cfg.UserNS {
+		args = append(args, "--userns-path", fmt.Sprintf("/proc/%d/ns/user", cfg.Pid))
+	}
+	args = append(args, "--netns-type=path", fmt.Sprintf("/proc/%d/ns/net", cfg.Pid), "tap0")
+
+	s := &Slirp{apiSocket: cfg.APISocket, exitFd: exitW}
+
+	s.cmd = exec.Command(cfg.Binary, args...)
+	s.cmd.ExtraFiles = []*os.File{readyW, exitR}
+	s.cmd.Stderr = &s.stderr
+	s.cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:    true,
+		Credential: cfg.Credential,
+	}
+
+	err = s.cmd.Start()
+	readyW.Close()
+	if err != nil {
+		exitW.Close()
+		return nil, fmt.Errorf("while starting %s: %s", cfg.Binary, err)
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		_, err := readyR.Read(b)
+		ready <- err
+	}()
+
+	select {
+	case err = <-ready:
+		if err != nil {
+			err = fmt.Errorf("%s exited before being ready", cfg.Binary)
+		}
+	case <-time.After(slirpReadyTimeout):
+		err = fmt.Errorf("timeout while waiting for %s", cfg.Binary)
+	}
+	if err != nil {
+		s.Stop()
+		if msg := strings.TrimSpace(s.stderr.String()); msg != "" {
+			err = fmt.Errorf("%s: %s", err, msg)
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// AddPortMapping forwards connections received on the host port to
+// the container port.
+func (s *Slirp) AddPortMapping(pm PortMapEntry) error {
+	hostIP := pm.HostIP
+	if hostIP == "" {
+		hostIP = "0.0.0.0"
+	}
+	req := map[string]interface{}{
+		"execute": "add_hostfwd",
+		"arguments": map[string]interface{}{
+			"proto":      pm.Protocol,
+			"host_addr":  hostIP,
+			"host_port":  pm.HostPort,
+			"guest_addr": SlirpContainerIP,
+			"guest_port": pm.ContainerPort,
+		},
+	}
+
+	conn, err := net.Dial("unix", s.apiSocket)
+	if err != nil {
+		return fmt.Errorf("while connecting to slirp4netns API socket: %s", err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("while sending port mapping request: %s", err)
+	}
+	if err := conn.(*net.UnixConn).CloseWrite(); err != nil {
+		return fmt.Errorf("while sending port mapping request: %s", err)
+	}
+
+	b, err := io.ReadAll(conn)
+	if err != nil {
+		return fmt.Errorf("while reading port mapping response: %s", err)
+	}
+	resp := struct {
+		Error *struct {
+			Desc string `json:"desc"`
+		} `json:"error"`
+	}{}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return fmt.Errorf("while decoding port mapping response %q: %s", b, err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("could not forward host port %d/%s: %s", pm.HostPort, pm.Protocol, resp.Error.Desc)
+	}
+	return nil
+}
+
+// Stop stops the slirp4netns process.
+func (s *Slirp) Stop() error {
+	// closing the exit file descriptor asks slirp4netns to exit
+	s.exitFd.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.cmd.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(slirpReadyTimeout):
+		if err := s.cmd.Process.Kill(); err != nil {
+			return fmt.Errorf("while killing slirp4netns: %s", err)
+		}
+		<-done
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) Contributors to the Apptainer project, established as
+//   Apptainer a Series of LF Projects LLC.
+//   For website terms of use, trademark policy, privacy policy and other
+//   project policies see https://lfprojects.org/policies
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePortMapping(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    PortMapEntry
+		wantErr bool
+	}{
+		{value: "8080:80/tcp", want: PortMapEntry{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}},
+		{value: "53/udp", want: PortMapEntry{HostPort: 53, ContainerPort: 53, Protocol: "udp"}},
+		{value: "8080:80", wantErr: true},
+		{value: "8080:80/sctp", wantErr: true},
+		{value: "0:80/tcp", wantErr: true},
+		{value: "8080:70000/tcp", wantErr: true},
+		{value: "a:b:c/tcp", wantErr: true},
+	}
+	for _, tt := range tests {
+		pm, err := ParsePortMapping(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePortMapping(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && pm != tt.want {
+			t.Errorf("ParsePortMapping(%q) = %+v, want %+v", tt.value, pm, tt.want)
+		}
+	}
+}
+
+func TestSlirpAddPortMapping(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "api.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	requests := make(chan map[string]interface{}, 2)
+	go func() {
+		for _, resp := range []string{`{"return":{"id":1}}`, `{"error":{"desc":"bad request"}}`} {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			b, _ := io.ReadAll(conn)
+			req := make(map[string]interface{})
+			json.Unmarshal(b, &req)
+			requests <- req
+			conn.Write([]byte(resp))
+			conn.Close()
+		}
+	}()
+
+	s := &Slirp{apiSocket: socket}
+	pm := PortMapEntry{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}
+
+	if err := s.AddPortMapping(pm); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	req := <-requests
+	if req["execute"] != "add_hostfwd" {
+		t.Errorf("unexpected request %v", req)
+	}
+	args, _ := req["arguments"].(map[string]interface{})
+	if args["host_port"] != float64(8080) || args["guest_port"] != float64(80) || args["proto"] != "tcp" {
+		t.Errorf("unexpected request arguments %v", args)
+	}
+
+	if err := s.AddPortMapping(pm); err == nil {
+		t.Errorf("unexpected success with error response")
+	}
+	<-requests
+}
@@ -10,6 +10,7 @@
 package apptainer
 
 import (
+	"encoding/json"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -111,6 +112,12 @@ type JSONConfig struct {
 	Hostname              string            `json:"hostname,omitempty"`
 	Network               string            `json:"network,omitempty"`
 	DNS                   string            `json:"dns,omitempty"`
+	AddHosts              []string          `json:"addHosts,omitempty"`
+	PublishPorts          []string          `json:"publishPorts,omitempty"`
+	SeccompRecord         string            `json:"seccompRecord,omitempty"`
+	SeccompRecordPair     [2]int            `json:"seccompRecordPair,omitempty"`
+	LandlockRules         []string          `json:"landlockRules,omitempty"`
+	AuditEvent            json.RawMessage   `json:"auditEvent,omitempty"`
 	Cwd                   string            `json:"cwd,omitempty"`
 	SessionLayer          string            `json:"sessionLayer,omitempty"`
 	ConfigurationFile     string            `json:"configurationFile,omitempty"`
@@ -595,6 +602,76 @@ func (e *EngineConfig) GetDNS() string {
 	return e.JSON.DNS
 }
 
+// SetAddHosts sets the list of name:ip entries to add in hosts file.
+func (e *EngineConfig) SetAddHosts(hosts []string) {
+	e.JSON.AddHosts = hosts
+}
+
+// GetAddHosts retrieves the list of name:ip entries to add in hosts file.
+func (e *EngineConfig) GetAddHosts() []string {
+	return e.JSON.AddHosts
+}
+
+// SetPublishPorts sets the list of hostPort:containerPort/protocol port
+// mappings forwarded by the user mode network.
+func (e *EngineConfig) SetPublishPorts(ports []string) {
+	e.JSON.PublishPorts = ports
+}
+
+// GetPublishPorts retrieves the list of port mappings forwarded by the
+// user mode network.
+func (e *EngineConfig) GetPublishPorts() []string {
+	return e.JSON.PublishPorts
+}
+
+// SetSeccompRecord sets the path of the seccomp profile generated from
+// the system calls recorded during the container execution.
+func (e *EngineConfig) SetSeccompRecord(path string) {
+	e.JSON.SeccompRecord = path
+}
+
+// GetSeccompRecord returns the path of the seccomp profile generated from
+// the system calls recorded during the container execution.
+func (e *EngineConfig) GetSeccompRecord() string {
+	return e.JSON.SeccompRecord
+}
+
+// SetSeccompRecordPair sets the unix socketpair used to pass the seccomp
+// notification file descriptor from the container process to master.
+func (e *EngineConfig) SetSeccompRecordPair(fds [2]int) {
+	e.JSON.SeccompRecordPair = fds
+}
+
+// GetSeccompRecordPair returns the unix socketpair previously set
+// in stage one by the engine.
+func (e *EngineConfig) GetSeccompRecordPair() [2]int {
+	return e.JSON.SeccompRecordPair
+}
+
+// SetLandlockRules sets the Landlock rules confining the filesystem
+// accesses of the container process.
+func (e *EngineConfig) SetLandlockRules(rules []string) {
+	e.JSON.LandlockRules = rules
+}
+
+// SetAuditEvent sets the JSON encoded audit event describing the container,
+// written by the master process when the container starts and exits.
+func (e *EngineConfig) SetAuditEvent(event json.RawMessage) {
+	e.JSON.AuditEvent = event
+}
+
+// GetAuditEvent returns the JSON encoded audit event previously set
+// with SetAuditEvent.
+func (e *EngineConfig) GetAuditEvent() json.RawMessage {
+	return e.JSON.AuditEvent
+}
+
+// GetLandlockRules returns the Landlock rules confining the filesystem
+// accesses of the container process.
+func (e *EngineConfig) GetLandlockRules() []string {
+	return e.JSON.LandlockRules
+}
+
 // SetImageList sets image list containing opened images.
 func (e *EngineConfig) SetImageList(list []image.Image) {
 	e.JSON.ImageList = list
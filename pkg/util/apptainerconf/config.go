@@ -115,10 +115,17 @@ type File struct {
 	LimitContainerOwners      []string `directive:"limit container owners"`
 	LimitContainerGroups      []string `directive:"limit container groups"`
 	LimitContainerPaths       []string `directive:"limit container paths"`
+	PolicyFile                string   `directive:"policy file"`
+	SecurityProfileKeys       []string `directive:"security profile keys"`
+	AuditLog                  string   `default:"none" authorized:"none,file,syslog,journald" directive:"audit log"`
+	AuditLogFile              string   `default:"/var/log/apptainer/audit.log" directive:"audit log file"`
+	AuditImageDigest          bool     `default:"yes" authorized:"yes,no" directive:"audit image digest"`
 	AllowNetUsers             []string `directive:"allow net users"`
 	AllowNetGroups            []string `directive:"allow net groups"`
 	AllowNetNetworks          []string `directive:"allow net networks"`
 	AllowNetnsPaths           []string `directive:"allow netns paths"`
+	AllowSysctls              []string `directive:"allow sysctls"`
+	LandlockRules             []string `directive:"landlock rules"`
 	RootDefaultCapabilities   string   `default:"full" authorized:"full,file,no" directive:"root default capabilities"`
 	MemoryFSType              string   `default:"tmpfs" authorized:"tmpfs,ramfs" directive:"memory fs type"`
 	CniConfPath               string   `directive:"cni configuration path"`
@@ -390,6 +397,67 @@ sessiondir max size = {{ .SessiondirMaxSize }}
 {{- if eq $index 0 }}limit container paths = {{ else }}, {{ end }}{{$path}}
 {{- end }}
 
+# POLICY FILE: [STRING]
+# DEFAULT: Undefined
+# Path to a policy file whose rules are evaluated before a container is
+# started. Each rule is a CEL expression which denies the launch when it
+# evaluates to true, with a human readable reason reported to the user.
+# Rules can check the image path, digest and signers, the user and its
+# groups, and the requested binds, namespaces, capabilities and devices.
+# The image argument given by the user, like a registry URI, can't be
+# trusted and is not available to rules, which identify images by their
+# digest and signers. See the admin documentation for the policy file
+# format.
+#
+# Enforced in setuid mode. In non-setuid mode rules are evaluated before
+# the container is started but can be bypassed by users. The file must be
+# owned by root. Instances are checked when started, not when joined.
+#policy file = /usr/local/etc/apptainer/policy.yaml
+{{ if ne .PolicyFile "" }}policy file = {{ .PolicyFile }}{{ end }}
+
+# SECURITY PROFILE KEYS: [STRING]
+# DEFAULT: NULL
+# Fingerprints of the keys from the global keyring trusted to sign the
+# security profile declared by the %security section of a definition file.
+# The profile of a SIF image (seccomp profile, AppArmor profile and
+# capabilities) is applied when it is signed along with the root filesystem
+# by one of these keys, and ignored otherwise. Options given with --security
+# take precedence, and capabilities are subject to the capability
+# configuration like --add-caps.
+#security profile keys = 5994BE54C31CF1B5E1994F987C52CF6D055F072B
+{{ range $index, $key := .SecurityProfileKeys }}
+{{- if eq $index 0 }}security profile keys = {{ else }}, {{ end }}{{$key}}
+{{- end }}
+
+# AUDIT LOG: [STRING]
+# DEFAULT: none
+# Write a structured audit event in JSON format each time a container is
+# started and exits. Events include the user and groups, the image path,
+# digest and signers, the command, binds, namespaces, capabilities, cgroup
+# limits, and the exit code or signal. Possible values are none, file (to
+# the AUDIT LOG FILE below), syslog (authpriv facility) and journald.
+#
+# Events are written by the privileged part of the setuid workflow and
+# can't be suppressed by users, the start event is written before the
+# container process is started and failing to write it prevents the
+# container from starting. In non-setuid mode events are written on a best
+# effort basis, and skipped with a debug message when they can't be
+# written. Joining an instance doesn't produce events.
+audit log = {{ .AuditLog }}
+
+# AUDIT LOG FILE: [STRING]
+# DEFAULT: /var/log/apptainer/audit.log
+# Path of the audit log file when AUDIT LOG is set to file. The file is
+# created readable by root only.
+audit log file = {{ .AuditLogFile }}
+
+# AUDIT IMAGE DIGEST: [BOOL]
+# DEFAULT: yes
+# Compute the SHA256 digest of the container image and its signers from
+# the global keyring for audit events. This reads the whole image each time
+# a container is started, disable it for large images if needed.
+audit image digest = {{ if eq .AuditImageDigest true }}yes{{ else }}no{{ end }}
+
 # ALLOW CONTAINER ${TYPE}: [BOOL]
 # DEFAULT: yes
 # This feature limits what kind of containers that Apptainer will allow
@@ -515,6 +583,32 @@ allow container dir = {{ if eq .AllowContainerDir true }}yes{{ else }}no{{ end }
 {{- if eq $index 0 }}allow netns paths = {{ else }}, {{ end }}{{$path}}
 {{- end }}
 
+# ALLOW SYSCTLS: [STRING]
+# DEFAULT: NULL
+# Specify the namespaced kernel parameters that non-root users may set with
+# the --sysctl option. Entries are either a parameter name or a shell pattern
+# matching parameter names (e.g. net.ipv4.tcp_*). Only parameters belonging
+# to a namespace created for the container (network, ipc or uts) are ever
+# accepted, root may set any of them.
+#allow sysctls = net.ipv4.ip_unprivileged_port_start, net.core.somaxconn
+{{ range $index, $key := .AllowSysctls }}
+{{- if eq $index 0 }}allow sysctls = {{ else }}, {{ end }}{{$key}}
+{{- end }}
+
+# LANDLOCK RULES: [STRING]
+# DEFAULT: NULL
+# Confine the filesystem accesses of every container with the Landlock LSM.
+# Each rule is either ro:<path> to allow reading and executing, or rw:<path>
+# to allow all accesses beneath a container path, everything else is denied.
+# Read access to the container system directories (/bin, /usr, /lib*, /etc,
+# /proc, /sys) and read-write access to /dev are always allowed. Users can't
+# lift these rules, rules given with --landlock only restrict accesses further.
+# Rules are not enforced when the kernel doesn't support Landlock.
+#landlock rules = rw:/tmp, rw:/scratch, ro:/data
+{{ range $index, $rule := .LandlockRules }}
+{{- if eq $index 0 }}landlock rules = {{ else }}, {{ end }}{{$rule}}
+{{- end }}
+
 # ALWAYS USE NV ${TYPE}: [BOOL]
 # DEFAULT: no
 # This feature allows an administrator to determine that every action command
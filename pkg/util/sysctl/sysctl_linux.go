@@ -12,12 +12,31 @@ package sysctl
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
 
 const procSys = "/proc/sys"
 
+// ipcKeys lists the IPC namespaced keys outside of the fs.mqueue hierarchy.
+var ipcKeys = map[string]struct{}{
+	"kernel.msgmax":          {},
+	"kernel.msgmnb":          {},
+	"kernel.msgmni":          {},
+	"kernel.sem":             {},
+	"kernel.shmall":          {},
+	"kernel.shmmax":          {},
+	"kernel.shmmni":          {},
+	"kernel.shm_rmid_forced": {},
+}
+
+// utsKeys lists the UTS namespaced keys.
+var utsKeys = map[string]struct{}{
+	"kernel.domainname": {},
+	"kernel.hostname":   {},
+}
+
 func convertKey(key string) string {
 	return strings.ReplaceAll(strings.TrimSpace(key), ".", string(os.PathSeparator))
 }
@@ -58,3 +77,36 @@ func Set(key string, value string) error {
 
 	return os.WriteFile(path, []byte(value), 0o000)
 }
+
+// Namespace returns the namespace ("ipc", "net" or "uts") a sysctl key
+// belongs to, it returns an error if the key is not namespaced and would
+// then affect the whole host.
+func Namespace(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	if key == "" || strings.ContainsRune(key, os.PathSeparator) {
+		return "", fmt.Errorf("invalid sysctl key %q", key)
+	}
+	if _, ok := ipcKeys[key]; ok || strings.HasPrefix(key, "fs.mqueue.") {
+		return "ipc", nil
+	}
+	if strings.HasPrefix(key, "net.") {
+		return "net", nil
+	}
+	if _, ok := utsKeys[key]; ok {
+		return "uts", nil
+	}
+	return "", fmt.Errorf("sysctl %s is not namespaced", key)
+}
+
+// Allowed returns whether a sysctl key matches one of the provided
+// patterns, a pattern is either a plain key or a shell pattern like
+// net.ipv4.tcp_*.
+func Allowed(key string, patterns []string) bool {
+	key = strings.TrimSpace(key)
+	for _, p := range patterns {
+		if match, err := path.Match(strings.TrimSpace(p), key); err == nil && match {
+			return true
+		}
+	}
+	return false
+}
@@ -40,3 +40,56 @@ func TestGetSet(t *testing.T) {
 		t.Errorf("should have failed, key doesn't exists")
 	}
 }
+
+func TestNamespace(t *testing.T) {
+	tests := []struct {
+		key       string
+		namespace string
+		wantErr   bool
+	}{
+		{key: "net.ipv4.ip_unprivileged_port_start", namespace: "net"},
+		{key: "net.core.somaxconn", namespace: "net"},
+		{key: "kernel.shmmax", namespace: "ipc"},
+		{key: "fs.mqueue.msg_max", namespace: "ipc"},
+		{key: "kernel.domainname", namespace: "uts"},
+		{key: "kernel.pid_max", wantErr: true},
+		{key: "vm.swappiness", wantErr: true},
+		{key: "net./../../kernel/pid_max", wantErr: true},
+		{key: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		ns, err := Namespace(tt.key)
+		if tt.wantErr && err == nil {
+			t.Errorf("unexpected success for key %q", tt.key)
+		} else if !tt.wantErr && err != nil {
+			t.Errorf("unexpected error for key %q: %s", tt.key, err)
+		} else if ns != tt.namespace {
+			t.Errorf("wrong namespace for key %q: got %q instead of %q", tt.key, ns, tt.namespace)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	patterns := []string{"net.core.somaxconn", " net.ipv4.tcp_*"}
+
+	tests := []struct {
+		key     string
+		allowed bool
+	}{
+		{key: "net.core.somaxconn", allowed: true},
+		{key: "net.ipv4.tcp_keepalive_time", allowed: true},
+		{key: "net.ipv4.ip_unprivileged_port_start", allowed: false},
+		{key: "net.core.somaxconn2", allowed: false},
+	}
+
+	for _, tt := range tests {
+		if got := Allowed(tt.key, patterns); got != tt.allowed {
+			t.Errorf("Allowed(%q) returned %v instead of %v", tt.key, got, tt.allowed)
+		}
+	}
+
+	if Allowed("net.core.somaxconn", nil) {
+		t.Errorf("unexpected allowed key with an empty list")
+	}
+}